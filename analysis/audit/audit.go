@@ -0,0 +1,161 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package audit counts, for each file in a program, the places where the Go
+// Doctor's refactorings (or similar cleanups) could be applied: exported
+// declarations without doc comments (candidates for Add GoDoc), functions
+// longer than a threshold (candidates for Extract Function), and so forth.
+// The counts are purely syntactic, so they can be computed quickly for large
+// code bases, e.g., to track a cleanup campaign on a dashboard.
+package audit
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// DefaultMaxFuncLines is the default number of lines a function may contain
+// before it is considered long.
+const DefaultMaxFuncLines = 50
+
+// Options control how files are audited.
+type Options struct {
+	// Function and method declarations whose bodies span more lines than
+	// this are counted as long functions (default: DefaultMaxFuncLines)
+	MaxFuncLines int
+}
+
+// A FileReport contains the counts for a single file.
+type FileReport struct {
+	Filename string `json:"file"`
+	// Number of lines in the file
+	Lines int `json:"lines"`
+	// Number of function and method declarations
+	Funcs int `json:"funcs"`
+	// Exported declarations without doc comments (Add GoDoc candidates)
+	MissingDocs int `json:"missingDocs"`
+	// Functions longer than Options.MaxFuncLines (Extract Function
+	// candidates)
+	LongFuncs int `json:"longFuncs"`
+	// Return statements without results in functions with named results
+	NakedReturns int `json:"nakedReturns"`
+}
+
+// Add adds the counts in other to the counts in r (e.g., to compute totals
+// for several files).  The filename is not changed.
+func (r *FileReport) Add(other FileReport) {
+	r.Lines += other.Lines
+	r.Funcs += other.Funcs
+	r.MissingDocs += other.MissingDocs
+	r.LongFuncs += other.LongFuncs
+	r.NakedReturns += other.NakedReturns
+}
+
+// File audits a single file, which must have been parsed with comments
+// (parser.ParseComments).
+func File(fset *token.FileSet, file *ast.File, opts Options) FileReport {
+	report := FileReport{Filename: fset.Position(file.Pos()).Filename}
+	if tf := fset.File(file.Pos()); tf != nil {
+		report.Lines = tf.LineCount()
+	}
+	if opts.MaxFuncLines <= 0 {
+		opts.MaxFuncLines = DefaultMaxFuncLines
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			report.Funcs++
+			if decl.Name.IsExported() && decl.Doc == nil {
+				report.MissingDocs++
+			}
+		case *ast.GenDecl:
+			report.MissingDocs += missingDocs(decl)
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		var typ *ast.FuncType
+		var body *ast.BlockStmt
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			typ, body = n.Type, n.Body
+		case *ast.FuncLit:
+			typ, body = n.Type, n.Body
+		default:
+			return true
+		}
+		if body == nil {
+			return false
+		}
+		if _, isDecl := n.(*ast.FuncDecl); isDecl &&
+			lines(fset, body) > opts.MaxFuncLines {
+			report.LongFuncs++
+		}
+		if hasNamedResults(typ) {
+			report.NakedReturns += nakedReturns(body)
+		}
+		return true
+	})
+	return report
+}
+
+// missingDocs returns the number of exported names declared in the given
+// declaration that are not documented, either by a doc comment on the
+// declaration or on the spec declaring them.
+func missingDocs(decl *ast.GenDecl) int {
+	if decl.Tok == token.IMPORT || decl.Doc != nil {
+		return 0
+	}
+	result := 0
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			if spec.Name.IsExported() && spec.Doc == nil {
+				result++
+			}
+		case *ast.ValueSpec:
+			if spec.Doc != nil {
+				continue
+			}
+			for _, name := range spec.Names {
+				if name.IsExported() {
+					result++
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+// lines returns the number of lines spanned by the given node.
+func lines(fset *token.FileSet, node ast.Node) int {
+	return fset.Position(node.End()).Line - fset.Position(node.Pos()).Line + 1
+}
+
+// hasNamedResults returns true if the given function type has named results.
+func hasNamedResults(typ *ast.FuncType) bool {
+	return typ.Results != nil && len(typ.Results.List) > 0 &&
+		len(typ.Results.List[0].Names) > 0
+}
+
+// nakedReturns returns the number of return statements without results in
+// the given function body, excluding those in nested function literals
+// (which are counted separately).
+func nakedReturns(body *ast.BlockStmt) int {
+	result := 0
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			if len(n.Results) == 0 {
+				result++
+			}
+		}
+		return true
+	})
+	return result
+}
@@ -0,0 +1,80 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+const src = `package p
+
+// Documented is documented.
+func Documented() {}
+
+func Undocumented() {}
+
+func unexported() {}
+
+type (
+	// A is documented.
+	A int
+	B int
+	c int
+)
+
+// Doc covers the whole declaration.
+var (
+	X, Y = 1, 2
+)
+
+const Z, z = 1, 2
+
+func (A) Method() (n int, err error) {
+	if n > 0 {
+		return
+	}
+	f := func() (m int) {
+		return
+	}
+	n = f()
+	return n, nil
+}
+
+func long() {
+	println(1)
+	println(2)
+	println(3)
+}
+`
+
+func TestFile(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := File(fset, file, Options{MaxFuncLines: 4})
+	want := FileReport{
+		Filename:     "p.go",
+		Lines:        39,
+		Funcs:        5,
+		MissingDocs:  4, // Undocumented, B, Z, and Method
+		LongFuncs:    2, // Method and long
+		NakedReturns: 2,
+	}
+	if got != want {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+
+	total := FileReport{Filename: "total"}
+	total.Add(got)
+	total.Add(got)
+	if total.Funcs != 10 || total.NakedReturns != 4 ||
+		total.Filename != "total" {
+		t.Fatalf("Incorrect total %+v", total)
+	}
+}
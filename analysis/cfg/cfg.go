@@ -410,7 +410,10 @@ func (b *builder) buildSwitch(sw ast.Stmt) {
 		}
 	}
 
-	if !defaultCase {
+	// Without a default case, control may flow past a switch statement
+	// without executing any of its cases.  A select statement blocks until
+	// one of its cases can proceed, so this is never true for a select.
+	if _, isSelect := sw.(*ast.SelectStmt); !defaultCase && !isSelect {
 		caseExits = append(caseExits, swPrev...)
 	}
 
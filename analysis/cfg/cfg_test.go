@@ -411,6 +411,53 @@ func TestSelectDefault(t *testing.T) {
 	c.expectPreds(t, END, 5, 7)
 }
 
+func TestSelectNoDefault(t *testing.T) {
+	c := getWrapper(t, `
+  package main
+
+  func foo(ch chan int, done chan bool) {
+    //START
+    select { // 1
+    case got := <- ch: // 2, 3
+      print(got) // 4
+    case ch <- 1: // 5, 6
+    case <-done: // 7, 8
+      break // 9
+    }
+    print("after") // 10
+    //END
+  }`)
+
+	c.expectSuccs(t, START, 1)
+	c.expectSuccs(t, 1, 2, 5, 7)
+	c.expectSuccs(t, 2, 3)
+	c.expectSuccs(t, 3, 4)
+	c.expectSuccs(t, 4, 10)
+	c.expectSuccs(t, 5, 6)
+	c.expectSuccs(t, 6, 10)
+	c.expectSuccs(t, 9, 10)
+
+	c.expectPreds(t, 10, 4, 6, 9)
+}
+
+func TestEmptySelect(t *testing.T) {
+	c := getWrapper(t, `
+  package main
+
+  func foo() {
+    //START
+    print("before") // 1
+    select {} // 2
+    print("after") // 3
+    //END
+  }`)
+
+	c.expectSuccs(t, START, 1)
+	c.expectSuccs(t, 1, 2)
+	c.expectSuccs(t, 2)
+	c.expectPreds(t, 3)
+}
+
 // TODO modify ast.Inspect for go statements
 // TODO also, does a go statement have control ever?
 //func TestClosure(t *testing.T) {
@@ -0,0 +1,105 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dataflow
+
+// This file contains an address-taken analysis for local variables.
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// AddressTaken returns the local variables whose addresses are taken within
+// the given node, mapped to the expressions that take them.  An address is
+// taken explicitly (&x, &x.f, or &x[i] for an array x), by slicing an array
+// (x[:]), or implicitly, by calling a method with a pointer receiver on a
+// variable that is not a pointer (x.M(), where M has receiver type *T).
+//
+// A variable whose address is taken may be accessed through a pointer, so
+// copying it to a new variable (e.g., a parameter of an extracted function)
+// can change the program's behavior.
+func AddressTaken(node ast.Node, info *packages.Package) map[*types.Var][]ast.Expr {
+	result := map[*types.Var][]ast.Expr{}
+	add := func(operand ast.Expr, expr ast.Expr) {
+		if v := addressedVar(operand, info); v != nil {
+			result[v] = append(result[v], expr)
+		}
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				add(n.X, n)
+			}
+		case *ast.SliceExpr:
+			if isArray(info.TypesInfo.TypeOf(n.X)) {
+				add(n.X, n)
+			}
+		case *ast.SelectorExpr:
+			sel := info.TypesInfo.Selections[n]
+			if sel == nil || sel.Kind() != types.MethodVal || sel.Indirect() {
+				return true
+			}
+			recv := sel.Obj().Type().(*types.Signature).Recv()
+			if !isPointer(recv.Type()) ||
+				isPointer(info.TypesInfo.TypeOf(n.X)) {
+				return true
+			}
+			add(n.X, n)
+		}
+		return true
+	})
+	return result
+}
+
+// addressedVar returns the local variable whose address is taken when the
+// address of the given expression is taken (e.g., x for x.f or x[i], if x is
+// a struct or array), or nil if there is none.
+func addressedVar(expr ast.Expr, info *packages.Package) *types.Var {
+	for {
+		switch e := expr.(type) {
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			sel := info.TypesInfo.Selections[e]
+			if sel == nil || sel.Kind() != types.FieldVal || sel.Indirect() {
+				return nil
+			}
+			expr = e.X
+		case *ast.IndexExpr:
+			if !isArray(info.TypesInfo.TypeOf(e.X)) {
+				return nil
+			}
+			expr = e.X
+		case *ast.Ident:
+			vars := collectVars(map[*ast.Ident]struct{}{e: {}}, info)
+			if len(vars) == 0 || vars[0].Parent() == info.Types.Scope() {
+				return nil
+			}
+			return vars[0]
+		default:
+			return nil
+		}
+	}
+}
+
+func isArray(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	_, ok := t.Underlying().(*types.Array)
+	return ok
+}
+
+func isPointer(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	_, ok := t.Underlying().(*types.Pointer)
+	return ok
+}
@@ -15,6 +15,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"testing"
 
 	"golang.org/x/tools/go/packages"
@@ -506,6 +507,43 @@ func TestFuncLit(t *testing.T) {
 	c.expectLive(t, 4)
 }
 
+func TestAddressTaken(t *testing.T) {
+	c := getWrapper(t, `
+  package main
+
+  import "strings"
+
+  func foo() {
+    a, b, s := 1, 2, point{} // 1
+    var arr [3]int           // 2
+    var sb strings.Builder   // 3
+    ptr := &point{}          // 4
+    slice := []int{1, 2}     // 5
+    _ = &a                   // 6
+    _ = &s.x                 // 7
+    _ = arr[:]               // 8
+    sb.WriteString("x")      // 9
+    _ = &ptr.y               // 10
+    _ = &slice[0]            // 11
+    _ = &global              // 12
+    _ = b + sb.Len()         // 13
+  }
+
+  type point struct{ x, y int }
+
+  var global int`)
+
+	expected := []string{"a", "arr", "s", "sb"}
+	actual := []string{}
+	for v := range AddressTaken(c.f, c.prog) {
+		actual = append(actual, v.Name())
+	}
+	sort.Strings(actual)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected address taken for %v, got %v", expected, actual)
+	}
+}
+
 func BenchmarkReaching(b *testing.B) {
 	c := getWrapper(b, `package main
 
@@ -0,0 +1,374 @@
+package loader
+
+// This file implements loading a program without the go command, for clients
+// that embed the Go Doctor (e.g., code review bots) in an environment that
+// has no Go toolchain.  The packages being refactored are parsed and type
+// checked from source, and the packages they import are obtained from an
+// importer, typically one that reads export data shipped with the client.
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/gcexportdata"
+	"golang.org/x/tools/go/packages"
+)
+
+// ExportDataImporter returns an importer that reads the gc compiler's export
+// data for each imported package from the reader returned by lookup (e.g., a
+// file listed by "go list -export", shipped with the client).  Objects in
+// imported packages are given positions in the given FileSet, which should be
+// the FileSet the program is loaded into.
+func ExportDataImporter(fset *token.FileSet, lookup func(path string) (io.ReadCloser, error)) types.Importer {
+	return &exportDataImporter{
+		fset:     fset,
+		lookup:   lookup,
+		packages: map[string]*types.Package{},
+	}
+}
+
+type exportDataImporter struct {
+	fset   *token.FileSet
+	lookup func(path string) (io.ReadCloser, error)
+	// Packages read so far, keyed by import path (including packages
+	// that were only referenced by other packages' export data)
+	packages map[string]*types.Package
+}
+
+func (imp *exportDataImporter) Import(path string) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := imp.packages[path]; ok && pkg.Complete() {
+		return pkg, nil
+	}
+	rc, err := imp.lookup(path)
+	if err != nil {
+		return nil, fmt.Errorf("no export data for %s: %v", path, err)
+	}
+	defer rc.Close()
+	r, err := gcexportdata.NewReader(rc)
+	if err != nil {
+		return nil, fmt.Errorf("reading export data for %s: %v", path, err)
+	}
+	return gcexportdata.Read(r, imp.fset, imp.packages, path)
+}
+
+// LoadWithImporter is like Load, but it does not run the go command, so it
+// does not require a Go toolchain.  Each argument is a directory, whose Go
+// files (including tests) are loaded as a package (and an external test
+// package, if any), or a Go source file; the source files given are loaded
+// together as a single package, as the go command would.  Relative paths are
+// relative to dir.  Patterns such as ./... are not supported.
+//
+// Files are read, and build constraints evaluated, using the given build
+// context, and positions are recorded in the given FileSet.  Imports of the
+// loaded packages are type checked from source; all other imports are
+// obtained from the given importer.  The imported packages are included in
+// the Program's AllPackages, but they have no syntax.
+//
+// Import paths are determined from the go.mod file in the directory or one
+// of its ancestors, or else from the build context's GOPATH.
+func LoadWithImporter(ctxt *build.Context, fset *token.FileSet, importer types.Importer, errorH func(error), dir string, args ...string) (*Program, error) {
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		dir = wd
+	}
+	l := &sourceLoader{
+		ctxt:     ctxt,
+		fset:     fset,
+		importer: importer,
+		errorH:   errorH,
+		byPath:   map[string]*sourcePackage{},
+		pkgs:     map[*types.Package]*packages.Package{},
+	}
+
+	files := []string{}
+	for _, arg := range args {
+		if strings.Contains(arg, "...") {
+			return nil, fmt.Errorf("%s cannot be loaded without the go "+
+				"command; list the directories to load instead", arg)
+		}
+		if !filepath.IsAbs(arg) {
+			arg = filepath.Join(dir, arg)
+		}
+		if strings.HasSuffix(arg, ".go") {
+			files = append(files, arg)
+		} else if err := l.addDir(arg); err != nil {
+			return nil, err
+		}
+	}
+	if len(files) > 0 {
+		if err := l.addFiles("command-line-arguments", files); err != nil {
+			return nil, err
+		}
+	}
+
+	paths := []string{}
+	for path := range l.byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if _, err := l.Import(path); err != nil {
+			return nil, err
+		}
+	}
+	return &Program{Fset: fset, AllPackages: l.pkgs}, nil
+}
+
+// A sourceLoader type checks packages from source for LoadWithImporter.  It is
+// the importer used to type check them, so that they can import each other.
+type sourceLoader struct {
+	ctxt     *build.Context
+	fset     *token.FileSet
+	importer types.Importer
+	errorH   func(error)
+	// The packages to load from source, keyed by import path
+	byPath map[string]*sourcePackage
+	// The packages loaded so far, from source or from the importer
+	pkgs map[*types.Package]*packages.Package
+}
+
+// A sourcePackage is a package to load from source.
+type sourcePackage struct {
+	name     string
+	files    []string
+	syntax   []*ast.File
+	pkg      *packages.Package // nil until type checked
+	checking bool              // true while it is being type checked
+}
+
+// addDir adds the package (and external test package) in the given
+// directory.
+func (l *sourceLoader) addDir(dir string) error {
+	infos, err := l.readDir(dir)
+	if err != nil {
+		return err
+	}
+	files := []string{}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		if match, err := l.ctxt.MatchFile(dir, name); err == nil && match {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no Go files in %s", dir)
+	}
+	return l.addFiles(l.importPath(dir), files)
+}
+
+// addFiles parses the given files and adds them to the package with the given
+// import path (or, for files in an external test package, to that package).
+func (l *sourceLoader) addFiles(path string, files []string) error {
+	for _, filename := range files {
+		file, err := l.parseFile(filename)
+		if file == nil {
+			return err
+		}
+		if err != nil {
+			l.errorH(err)
+		}
+		pkgPath, name := path, file.Name.Name
+		if strings.HasSuffix(name, "_test") &&
+			strings.HasSuffix(filename, "_test.go") {
+			pkgPath += "_test"
+		}
+		p, ok := l.byPath[pkgPath]
+		if !ok {
+			p = &sourcePackage{name: name}
+			l.byPath[pkgPath] = p
+		}
+		if p.name != name {
+			return fmt.Errorf("found packages %s and %s in %s",
+				p.name, name, filepath.Dir(filename))
+		}
+		p.files = append(p.files, filename)
+		p.syntax = append(p.syntax, file)
+	}
+	return nil
+}
+
+func (l *sourceLoader) parseFile(filename string) (*ast.File, error) {
+	r, err := l.openFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	const mode = parser.AllErrors | parser.ParseComments
+	return parser.ParseFile(l.fset, filename, src, mode)
+}
+
+func (l *sourceLoader) openFile(filename string) (io.ReadCloser, error) {
+	if l.ctxt.OpenFile != nil {
+		return l.ctxt.OpenFile(filename)
+	}
+	return os.Open(filename)
+}
+
+func (l *sourceLoader) readDir(dir string) ([]os.FileInfo, error) {
+	if l.ctxt.ReadDir != nil {
+		return l.ctxt.ReadDir(dir)
+	}
+	return ioutil.ReadDir(dir)
+}
+
+// importPath returns the import path of the package in the given directory,
+// based on the nearest enclosing go.mod file or, if there is none, the
+// GOPATH.  If neither determines it, a local import path is returned, as
+// go/build does.
+func (l *sourceLoader) importPath(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if module := l.modulePath(filepath.Join(d, "go.mod")); module != "" {
+			rel, err := filepath.Rel(d, dir)
+			if err == nil {
+				return path.Join(module, filepath.ToSlash(rel))
+			}
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	for _, root := range filepath.SplitList(l.ctxt.GOPATH) {
+		src := filepath.Join(root, "src")
+		if rel, err := filepath.Rel(src, dir); err == nil &&
+			rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return "_" + filepath.ToSlash(dir)
+}
+
+// modulePath returns the module path declared in the given go.mod file, or ""
+// if it cannot be read.
+func (l *sourceLoader) modulePath(gomod string) string {
+	r, err := l.openFile(gomod)
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			if path, err := strconv.Unquote(fields[1]); err == nil {
+				return path
+			}
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// Import type checks the package with the given import path, if it is one of
+// the packages being loaded from source, or otherwise imports it using the
+// importer.
+func (l *sourceLoader) Import(path string) (*types.Package, error) {
+	p, ok := l.byPath[path]
+	if !ok {
+		pkg, err := l.importer.Import(path)
+		if err != nil {
+			return nil, err
+		}
+		l.addImported(pkg)
+		return pkg, nil
+	}
+	if p.pkg != nil {
+		return p.pkg.Types, nil
+	}
+	if p.checking {
+		return nil, fmt.Errorf("import cycle through %s", path)
+	}
+	p.checking = true
+	defer func() { p.checking = false }()
+
+	info := newInfo()
+	sizes := types.SizesFor("gc", l.ctxt.GOARCH)
+	conf := types.Config{
+		Importer: l,
+		Sizes:    sizes,
+		Error:    l.errorH,
+	}
+	// Errors are reported to errorH, so they are not returned here
+	pkg, _ := conf.Check(path, l.fset, p.syntax, info)
+
+	p.pkg = &packages.Package{
+		ID:              path,
+		Name:            p.name,
+		PkgPath:         path,
+		GoFiles:         p.files,
+		CompiledGoFiles: p.files,
+		Imports:         map[string]*packages.Package{},
+		Types:           pkg,
+		Fset:            l.fset,
+		Syntax:          p.syntax,
+		TypesInfo:       info,
+		TypesSizes:      sizes,
+	}
+	for _, imp := range pkg.Imports() {
+		if imported, ok := l.pkgs[imp]; ok {
+			p.pkg.Imports[imp.Path()] = imported
+		}
+	}
+	l.pkgs[pkg] = p.pkg
+	return pkg, nil
+}
+
+// addImported adds a package obtained from the importer (and the packages it
+// imports) to the loaded packages.  Since they are not loaded from source,
+// they have no syntax, and their TypesInfo is empty.
+func (l *sourceLoader) addImported(pkg *types.Package) *packages.Package {
+	if result, ok := l.pkgs[pkg]; ok {
+		return result
+	}
+	result := &packages.Package{
+		ID:         pkg.Path(),
+		Name:       pkg.Name(),
+		PkgPath:    pkg.Path(),
+		Imports:    map[string]*packages.Package{},
+		Types:      pkg,
+		Fset:       l.fset,
+		TypesInfo:  newInfo(),
+		TypesSizes: types.SizesFor("gc", l.ctxt.GOARCH),
+	}
+	l.pkgs[pkg] = result
+	for _, imp := range pkg.Imports() {
+		result.Imports[imp.Path()] = l.addImported(imp)
+	}
+	return result
+}
+
+func newInfo() *types.Info {
+	return &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Implicits:  map[ast.Node]types.Object{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		Scopes:     map[ast.Node]*types.Scope{},
+	}
+}
@@ -9,9 +9,12 @@ package loader
 // relies heavily on the packages package to do the heavy lifting.
 
 import (
+	"context"
 	"go/ast"
+	"go/parser"
 	"go/token"
 	"go/types"
+	"sync"
 
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
@@ -32,6 +35,16 @@ type Program struct {
 
 // Load loads a package, calling packages.Load
 func Load(conf *packages.Config, errorH func(error), args ...string) (*Program, error) {
+	return LoadWithProgress(conf, errorH, nil, args...)
+}
+
+// LoadWithProgress is like Load, but if progress is non-nil, it is called
+// periodically with the number of packages that have been loaded (i.e., whose
+// files have been parsed, so that they can be type checked) and the total
+// number of packages to load.  Determining the total requires listing the
+// packages, which is done concurrently with loading them, so progress is not
+// called until the packages have been listed.
+func LoadWithProgress(conf *packages.Config, errorH func(error), progress func(done, total int), args ...string) (*Program, error) {
 	// TODO(reed): we do kinda need to ensure types is set so that
 	// files are parsed, and syntax is used heavily, and deps are used
 	// in rename refactoring (but not some others, could save some time).
@@ -56,6 +69,16 @@ func Load(conf *packages.Config, errorH func(error), args ...string) (*Program,
 		// we need this
 		conf.Fset = token.NewFileSet()
 	}
+	if progress != nil {
+		counter := newProgressCounter(progress)
+		stop := counter.listPackages(conf, args...)
+		defer stop()
+		conf.ParseFile = func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			defer counter.parsed(filename)
+			const mode = parser.AllErrors | parser.ParseComments
+			return parser.ParseFile(fset, filename, src, mode)
+		}
+	}
 	prog, err := packages.Load(conf, args...)
 	if err != nil {
 		return nil, err
@@ -77,6 +100,118 @@ func Load(conf *packages.Config, errorH func(error), args ...string) (*Program,
 	}, nil
 }
 
+// Merge adds the packages in another program, which must have been loaded
+// using the same FileSet, to this program.  This allows packages that cannot
+// be loaded together (e.g., packages in different modules) to be refactored
+// together.  If both programs contain the same package, it is type checked
+// separately in each, so its objects are distinct, and a file it contains
+// appears twice (at different positions in the FileSet).
+func (prog *Program) Merge(other *Program) {
+	for pkg, pkgInfo := range other.AllPackages {
+		prog.AllPackages[pkg] = pkgInfo
+	}
+}
+
+// A progressCounter determines how many packages have been loaded, based on
+// which files have been parsed, for LoadWithProgress.
+type progressCounter struct {
+	mu       sync.Mutex
+	progress func(done, total int)
+	// Files that have been parsed
+	parsedFiles map[string]bool
+	// The IDs of the packages containing each file; nil until the
+	// packages have been listed
+	pkgsOf map[string][]string
+	// The number of files in each package that have not been parsed
+	remaining map[string]int
+	// The number of packages whose files have all been parsed
+	done int
+}
+
+func newProgressCounter(progress func(done, total int)) *progressCounter {
+	return &progressCounter{
+		progress:    progress,
+		parsedFiles: map[string]bool{},
+	}
+}
+
+// listPackages lists the packages that will be loaded (with the given
+// configuration and patterns) in a new goroutine, so that the total number of
+// packages is known.  It returns a function that cancels the listing if it
+// has not finished.
+func (c *progressCounter) listPackages(conf *packages.Config, args ...string) func() {
+	ctx := conf.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	listConf := &packages.Config{
+		Mode: packages.NeedName | packages.NeedCompiledGoFiles |
+			packages.NeedImports | packages.NeedDeps,
+		Context:    ctx,
+		Dir:        conf.Dir,
+		Env:        conf.Env,
+		BuildFlags: conf.BuildFlags,
+		Tests:      conf.Tests,
+		Overlay:    conf.Overlay,
+	}
+	go func() {
+		pkgs, err := packages.Load(listConf, args...)
+		if err != nil {
+			return
+		}
+		pkgsOf := map[string][]string{}
+		remaining := map[string]int{}
+		packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+			remaining[pkg.ID] = len(pkg.CompiledGoFiles)
+			for _, f := range pkg.CompiledGoFiles {
+				pkgsOf[f] = append(pkgsOf[f], pkg.ID)
+			}
+		})
+		c.listed(pkgsOf, remaining)
+	}()
+	return cancel
+}
+
+// listed records the packages that will be loaded, given the IDs of the
+// packages containing each file and the number of files in each package.
+func (c *progressCounter) listed(pkgsOf map[string][]string, remaining map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pkgsOf, c.remaining = pkgsOf, remaining
+	for f := range c.parsedFiles {
+		for _, id := range pkgsOf[f] {
+			remaining[id]--
+		}
+	}
+	for _, n := range remaining {
+		if n <= 0 {
+			c.done++
+		}
+	}
+	c.progress(c.done, len(c.remaining))
+}
+
+// parsed records that the given file has been parsed.
+func (c *progressCounter) parsed(filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.parsedFiles[filename] {
+		return
+	}
+	c.parsedFiles[filename] = true
+	if c.pkgsOf == nil {
+		return
+	}
+	for _, id := range c.pkgsOf[filename] {
+		c.remaining[id]--
+		if c.remaining[id] == 0 {
+			c.done++
+			c.progress(c.done, len(c.remaining))
+		}
+	}
+}
+
 // PathEnclosingInterval returns the PackageInfo and ast.Node that
 // contain source interval [start, end), and all the node's ancestors
 // up to the AST root.  It searches all ast.Files of all packages in prog.
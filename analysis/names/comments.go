@@ -5,45 +5,159 @@
 package names
 
 import (
-	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
-	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/godoctor/godoctor/text"
 )
 
+// A CommentOccurrenceKind indicates whether an occurrence of a name in a
+// comment appears to refer to the identifier with that name.
+type CommentOccurrenceKind int
+
+const (
+	// The name appears as a whole word, but nothing about its context
+	// suggests that it refers to code (e.g., "Run" in "Run the tests")
+	CommentWord CommentOccurrenceKind = iota
+	// The name appears in backquotes (`Run`), before a parenthesis
+	// (Run()), or after a selector (t.Run)
+	CommentReference
+	// The name is part of a doc link (e.g., [Run], [T.Run], or [pkg.Run]),
+	// which can be resolved precisely (see FindDocLinks)
+	CommentDocLink
+)
+
+// A CommentOccurrence is the location of a name in a comment, along with
+// whether it appears to refer to code.
+type CommentOccurrence struct {
+	*text.Extent
+	Kind CommentOccurrenceKind
+}
+
 // FindInComments searches the comments of the given packages' source files for
 // occurrences of the given name (as a word, not a subword) and returns their
 // source locations.  Position information is obtained from the given FileSet.
 func FindInComments(name string, f *ast.File, scope *types.Scope, fset *token.FileSet) []*text.Extent {
 	result := []*text.Extent{}
+	for _, occurrence := range FindCommentOccurrences(name, f, scope, fset) {
+		result = append(result, occurrence.Extent)
+	}
+	return result
+}
+
+// FindCommentOccurrences is like FindInComments, but it also indicates which
+// occurrences appear to refer to code, so a client can rename those but leave
+// others (e.g., words in ordinary sentences) alone.
+func FindCommentOccurrences(name string, f *ast.File, scope *types.Scope, fset *token.FileSet) []CommentOccurrence {
+	result := []CommentOccurrence{}
 	for _, commentGroup := range f.Comments {
 		for _, comment := range commentGroup.List {
 			if isInScope(comment.Slash, scope) {
-				slashIdx := fset.Position(comment.Slash).Offset
-				whitespaceIdx := 1
-				regexpstring := fmt.Sprintf("[\\PL]%s[\\PL]|//%s[\\PL]|/\\*%s[\\PL]|[\\PL]%s$", name, name, name, name)
-				re := regexp.MustCompile(regexpstring)
-				matchcount := strings.Count(comment.Text, name)
-				for _, idx := range re.FindAllStringIndex(comment.Text, matchcount) {
-					var offset int
-					if idx[0] == 0 {
-						offset = slashIdx + idx[0] + whitespaceIdx + 1
-					} else {
-						offset = slashIdx + idx[0] + whitespaceIdx
-					}
-					result = append(result, &text.Extent{offset, len(name)})
-				}
+				result = append(result,
+					findInComment(name, comment, fset)...)
 			}
 		}
+	}
+	return result
+}
 
+// FindInDocComment searches a single comment group (typically the doc comment
+// for a function declaration) for occurrences of the given name (as a word,
+// not a subword) and returns their source locations.  Position information is
+// obtained from the given FileSet.
+func FindInDocComment(name string, doc *ast.CommentGroup, fset *token.FileSet) []*text.Extent {
+	result := []*text.Extent{}
+	if doc == nil {
+		return result
+	}
+	for _, comment := range doc.List {
+		for _, occurrence := range findInComment(name, comment, fset) {
+			result = append(result, occurrence.Extent)
+		}
 	}
 	return result
 }
 
+// findInComment returns the source locations of occurrences of the given name
+// (as a whole identifier, not part of a longer identifier) in a single
+// comment.
+func findInComment(name string, comment *ast.Comment, fset *token.FileSet) []CommentOccurrence {
+	result := []CommentOccurrence{}
+	if name == "" {
+		return result
+	}
+	offset := fset.Position(comment.Slash).Offset
+	inDocLink := map[int]bool{}
+	for _, link := range findDocLinks(comment.Text) {
+		for _, linkOffset := range link.Offsets {
+			inDocLink[linkOffset] = true
+		}
+	}
+	for i := 0; i < len(comment.Text); {
+		start := strings.Index(comment.Text[i:], name)
+		if start < 0 {
+			break
+		}
+		start += i
+		end := start + len(name)
+		if isWholeIdentifier(comment.Text, start, end) {
+			kind := CommentDocLink
+			if !inDocLink[start] {
+				kind = commentOccurrenceKind(comment.Text, start, end)
+			}
+			result = append(result, CommentOccurrence{
+				Extent: &text.Extent{offset + start, len(name)},
+				Kind:   kind,
+			})
+		}
+		i = end
+	}
+	return result
+}
+
+// isWholeIdentifier returns true if s[start:end] is not immediately preceded
+// or followed by a character that can appear in an identifier.
+func isWholeIdentifier(s string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(s[:start])
+	after, _ := utf8.DecodeRuneInString(s[end:])
+	return !isIdentifierRune(before) && !isIdentifierRune(after)
+}
+
+// isIdentifierRune returns true if ch can appear in a Go identifier.
+func isIdentifierRune(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
+
+// commentOccurrenceKind determines whether the identifier at s[start:end], in
+// the text of a comment, appears to refer to code.
+func commentOccurrenceKind(s string, start, end int) CommentOccurrenceKind {
+	before, after := s[:start], s[end:]
+
+	// `Name` or `x.Name()`
+	if strings.Count(before, "`")%2 == 1 && strings.Contains(after, "`") {
+		return CommentReference
+	}
+
+	// Name(
+	if strings.HasPrefix(after, "(") {
+		return CommentReference
+	}
+
+	// x.Name
+	if strings.HasSuffix(before, ".") {
+		ch, _ := utf8.DecodeLastRuneInString(before[:len(before)-1])
+		if isIdentifierRune(ch) {
+			return CommentReference
+		}
+	}
+
+	return CommentWord
+}
+
 func isInScope(pos token.Pos, scope *types.Scope) bool {
 	// Object.Parent() is nil for methods and struct fields
 	if scope == nil {
@@ -0,0 +1,119 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package names
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+// A DocLink is a doc link in a comment (see "Links" in
+// https://go.dev/doc/comment), such as [Name], [T.Name], [*T.Name],
+// [pkg.Name], [pkg.T.Name], or [path/to/pkg.Name].
+type DocLink struct {
+	// The import path of the package, if the link contains a slash (as
+	// in [encoding/json.Marshal]); otherwise, empty
+	ImportPath string
+	// The identifiers in the link, excluding the import path (if any):
+	// e.g., ["pkg", "T", "Name"] for [pkg.T.Name] or ["Marshal"] for
+	// [encoding/json.Marshal]
+	Names []string
+	// The file offset of each identifier in Names
+	Offsets []int
+}
+
+// FindDocLinks returns the doc links in the comments of the given file.
+// Position information is obtained from the given FileSet.
+func FindDocLinks(f *ast.File, fset *token.FileSet) []DocLink {
+	result := []DocLink{}
+	for _, commentGroup := range f.Comments {
+		for _, comment := range commentGroup.List {
+			offset := fset.Position(comment.Slash).Offset
+			for _, link := range findDocLinks(comment.Text) {
+				for i := range link.Offsets {
+					link.Offsets[i] += offset
+				}
+				result = append(result, link)
+			}
+		}
+	}
+	return result
+}
+
+// findDocLinks returns the doc links in the given comment text, with offsets
+// relative to the start of the text.
+func findDocLinks(s string) []DocLink {
+	result := []DocLink{}
+	for i := 0; i < len(s); {
+		open := strings.IndexByte(s[i:], '[')
+		if open < 0 {
+			break
+		}
+		open += i
+		close := strings.IndexAny(s[open+1:], "[]\n")
+		if close < 0 {
+			break
+		}
+		close += open + 1
+		i = close
+		if s[close] != ']' {
+			continue
+		}
+		// [Text]: URL is a link definition, not a doc link
+		if strings.HasPrefix(s[close+1:], ":") {
+			continue
+		}
+		if link, ok := parseDocLink(s[open+1:close], open+1); ok {
+			result = append(result, link)
+		}
+	}
+	return result
+}
+
+// parseDocLink parses the text between the brackets of a doc link, which
+// begins at the given offset.  It returns false if the text is not a doc
+// link.
+func parseDocLink(s string, offset int) (DocLink, bool) {
+	link := DocLink{Names: []string{}, Offsets: []int{}}
+	if strings.HasPrefix(s, "*") {
+		s, offset = s[1:], offset+1
+	}
+	if slash := strings.LastIndex(s, "/"); slash >= 0 {
+		dot := strings.Index(s[slash:], ".")
+		if dot < 0 {
+			return link, false
+		}
+		link.ImportPath = s[:slash+dot]
+		s, offset = s[slash+dot+1:], offset+slash+dot+1
+	}
+	for _, name := range strings.Split(s, ".") {
+		if !isIdentifier(name) {
+			return link, false
+		}
+		link.Names = append(link.Names, name)
+		link.Offsets = append(link.Offsets, offset)
+		offset += len(name) + 1
+	}
+	if len(link.Names) > 3 ||
+		(link.ImportPath != "" && len(link.Names) > 2) {
+		return link, false
+	}
+	return link, true
+}
+
+// isIdentifier returns true if s is a (possibly predeclared) Go identifier.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, ch := range s {
+		if !isIdentifierRune(ch) || (i == 0 && unicode.IsDigit(ch)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package names
+
+import (
+	"go/ast"
+	"go/types"
+
+	"github.com/godoctor/godoctor/analysis/loader"
+	"golang.org/x/tools/go/packages"
+)
+
+// A DotImport is an import declaration of the form import . "path", which
+// makes the exported names of the imported package accessible without a
+// qualifier in the importing file.
+type DotImport struct {
+	Spec    *ast.ImportSpec
+	File    *ast.File
+	Package *packages.Package // the importing package
+}
+
+// FindDotImports returns the dot imports of the package with the given import
+// path in every package of the program (including test variants).
+func FindDotImports(path string, prog *loader.Program) []*DotImport {
+	result := []*DotImport{}
+	for _, pkgInfo := range prog.AllPackages {
+		if pkgInfo.TypesInfo == nil {
+			continue
+		}
+		for _, file := range pkgInfo.Syntax {
+			for _, spec := range file.Imports {
+				if spec.Name == nil || spec.Name.Name != "." {
+					continue
+				}
+				// Depending on the version of go/types, the PkgName
+				// is recorded as the definition of the dot or as an
+				// implicit object of the import spec
+				var obj types.Object = pkgInfo.TypesInfo.Defs[spec.Name]
+				if obj == nil {
+					obj = pkgInfo.TypesInfo.Implicits[spec]
+				}
+				pkgName, ok := obj.(*types.PkgName)
+				if ok && pkgName.Imported().Path() == path {
+					result = append(result, &DotImport{spec, file, pkgInfo})
+				}
+			}
+		}
+	}
+	return result
+}
+
+// FindDotImportConflict determines if renaming the given package-level object
+// to the given name would conflict with a declaration in a file that
+// dot-imports the object's package.  In such a file, the object is referred
+// to by an unqualified name, so the new name must not be declared in the
+// importing package, imported into the file by another import, or declared
+// in a scope nested within the file.  It returns one such conflicting
+// declaration and the dot import that makes it a conflict, or nil if there
+// are none.
+func FindDotImportConflict(obj types.Object, name string, prog *loader.Program) (types.Object, *DotImport) {
+	if obj == nil || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() ||
+		!obj.Exported() {
+		return nil, nil
+	}
+	for _, dot := range FindDotImports(obj.Pkg().Path(), prog) {
+		if result := dot.Package.Types.Scope().Lookup(name); result != nil {
+			return result, dot
+		}
+		fileScope := dot.Package.TypesInfo.Scopes[dot.File]
+		if fileScope == nil {
+			continue
+		}
+		if result := findConflictInChildScope(fileScope, name); result != nil {
+			return result, dot
+		}
+	}
+	return nil, nil
+}
@@ -57,28 +57,60 @@ func methodReceiver(obj types.Object) *types.Var {
 	return nil
 }
 
+// A MethodLink explains why a method is among the methods returned by
+// FindDeclarationsAcrossInterfaces: Method must be renamed along with Via
+// (which is either the given method or another MethodLink's Method), since
+// the receivers of both implement (or the receiver of one is) Interface.
+type MethodLink struct {
+	// The method that must be renamed
+	Method types.Object
+	// The method whose renaming forces Method to be renamed
+	Via types.Object
+	// The interface relating them: a *types.Named if the interface is
+	// declared by a type declaration, and a *types.Interface otherwise
+	Interface types.Type
+}
+
+// ExplainDeclarationsAcrossInterfaces returns a MethodLink for each method,
+// other than the given object, that FindDeclarationsAcrossInterfaces returns.
+// The links are in breadth-first order, so the Via of each link is either the
+// given object or the Method of an earlier link.  It returns an empty slice if
+// the given object is not a method.
+func ExplainDeclarationsAcrossInterfaces(obj types.Object, program *loader.Program) []MethodLink {
+	if !isMethod(obj) {
+		return []MethodLink{}
+	}
+	_, links := reachableMethodLinks(obj.Name(), obj.(*types.Func), program.AllPackages[obj.Pkg()])
+	return links
+}
+
 // reachableMethods receives an object for a method (i.e., a types.Func with
 // a non-nil receiver) and the PackageInfo in which it was declared and returns
 // a set of objects that must be renamed if that method is renamed.
 func reachableMethods(name string, obj *types.Func, pkgInfo *packages.Package) map[types.Object]bool {
+	affected, _ := reachableMethodLinks(name, obj, pkgInfo)
+	return affected
+}
+
+// reachableMethodLinks is like reachableMethods, but it also returns a
+// MethodLink explaining why each method other than obj is affected.
+func reachableMethodLinks(name string, obj *types.Func, pkgInfo *packages.Package) (map[types.Object]bool, []MethodLink) {
 	// Find methods and interfaces defined in the given package that have
 	// the same signature as the argument method (obj)
 	sig := obj.Type().(*types.Signature)
-	methods, interfaces := methodDeclsMatchingSig(name, sig, pkgInfo)
+	methods, interfaces, named := methodDeclsMatchingSig(name, sig, pkgInfo)
 
-	// Map methods to interfaces their receivers implement and vice versa
-	methodInterfaces := map[types.Object]map[*types.Interface]bool{}
-	interfaceMethods := map[*types.Interface]map[types.Object]bool{}
-	for iface := range interfaces {
-		interfaceMethods[iface] = map[types.Object]bool{}
-	}
-	for method := range methods {
-		methodInterfaces[method] = map[*types.Interface]bool{}
+	// Map methods to interfaces their receivers implement and vice versa.
+	// Both are kept in source order, so the search below (and the links
+	// it finds) are deterministic.
+	methodInterfaces := map[types.Object][]*types.Interface{}
+	interfaceMethods := map[*types.Interface][]types.Object{}
+	for _, method := range methods {
 		recv := methodReceiver(method).Type()
-		for iface := range interfaces {
+		for _, iface := range interfaces {
 			if types.Implements(recv, iface) {
-				methodInterfaces[method][iface] = true
-				interfaceMethods[iface][method] = true
+				methodInterfaces[method] = append(methodInterfaces[method], iface)
+				interfaceMethods[iface] = append(interfaceMethods[iface], method)
 			}
 		}
 	}
@@ -88,34 +120,46 @@ func reachableMethods(name string, obj *types.Func, pkgInfo *packages.Package) m
 	// a breadth-first search of this graph, starting from obj, to find the
 	// reflexive, transitive closure of methods affected by renaming obj.
 	affectedMethods := map[types.Object]bool{obj: true}
-	affectedInterfaces := map[*types.Interface]bool{}
+	// Maps each affected interface to the method from which it was reached
+	affectedInterfaces := map[*types.Interface]types.Object{}
+	links := []MethodLink{}
 	queue := []interface{}{obj}
 	for i := 0; i < len(queue); i++ {
 		switch elt := queue[i].(type) {
 		case *types.Func:
-			for iface := range methodInterfaces[elt] {
-				if !affectedInterfaces[iface] {
-					affectedInterfaces[iface] = true
+			for _, iface := range methodInterfaces[elt] {
+				if affectedInterfaces[iface] == nil {
+					affectedInterfaces[iface] = elt
 					queue = append(queue, iface)
 				}
 			}
 		case *types.Interface:
-			for method := range interfaceMethods[elt] {
+			for _, method := range interfaceMethods[elt] {
 				if !affectedMethods[method] {
 					affectedMethods[method] = true
 					queue = append(queue, method)
+					var typ types.Type = elt
+					if n := named[elt]; n != nil {
+						typ = n
+					}
+					links = append(links, MethodLink{
+						Method:    method,
+						Via:       affectedInterfaces[elt],
+						Interface: typ,
+					})
 				}
 			}
 		}
 	}
 
-	return affectedMethods
+	return affectedMethods, links
 }
 
 // methodDeclsMatchingSig walks all of the ASTs in the given package and
 // returns methods with the given signature and interfaces that explicitly
-// define a method with the given signature.
-func methodDeclsMatchingSig(name string, sig *types.Signature, pkgInfo *packages.Package) (methods map[types.Object]bool, interfaces map[*types.Interface]bool) {
+// define a method with the given signature, in source order.  It also maps
+// each interface declared by a type declaration to its named type.
+func methodDeclsMatchingSig(name string, sig *types.Signature, pkgInfo *packages.Package) (methods []types.Object, interfaces []*types.Interface, named map[*types.Interface]*types.Named) {
 	// XXX(review D7): This looks quite expensive to do in a relatively low-level
 	// function. Consider doing an initial pass over the ASTs to gather this
 	// information if performance becomes an issue.
@@ -129,30 +173,39 @@ func methodDeclsMatchingSig(name string, sig *types.Signature, pkgInfo *packages
 	// you can have a legal struct or interface with two fields/methods both named
 	// "f", if they come from different packages.
 
-	methods = map[types.Object]bool{}
-	interfaces = map[*types.Interface]bool{}
+	methods = []types.Object{}
+	interfaces = []*types.Interface{}
+	named = map[*types.Interface]*types.Named{}
 	for _, file := range pkgInfo.Syntax {
 		ast.Inspect(file, func(node ast.Node) bool {
 			switch n := node.(type) {
+			case *ast.TypeSpec:
+				if _, ok := n.Type.(*ast.InterfaceType); ok {
+					if typ, ok := pkgInfo.TypesInfo.Defs[n.Name].Type().(*types.Named); ok {
+						if iface, ok := typ.Underlying().(*types.Interface); ok {
+							named[iface] = typ
+						}
+					}
+				}
 			case *ast.InterfaceType:
 				iface := pkgInfo.TypesInfo.TypeOf(n).Underlying().(*types.Interface)
-				interfaces[iface] = true
+				interfaces = append(interfaces, iface)
 				for i := 0; i < iface.NumExplicitMethods(); i++ {
 					method := iface.ExplicitMethod(i)
 					methodSig := method.Type().(*types.Signature)
 					if method.Name() == name && types.Identical(sig, methodSig) {
-						methods[method] = true
+						methods = append(methods, method)
 					}
 				}
 			case *ast.FuncDecl:
 				obj := pkgInfo.TypesInfo.ObjectOf(n.Name)
 				fnSig := obj.Type().Underlying().(*types.Signature)
 				if fnSig.Recv() != nil && n.Name.Name == name && types.Identical(sig, fnSig) {
-					methods[obj] = true
+					methods = append(methods, obj)
 				}
 			}
 			return true
 		})
 	}
-	return methods, interfaces
+	return methods, interfaces, named
 }
@@ -7,10 +7,13 @@ package names_test
 import (
 	"fmt"
 	"go/ast"
+	"go/parser"
+	"go/token"
 	"go/types"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/godoctor/godoctor/analysis/loader"
@@ -23,8 +26,12 @@ import (
 // -=- Utility Functions -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
 
 func setup(t *testing.T) *loader.Program {
+	return load("testdata/src/foo", t)
+}
+
+func load(dir string, t *testing.T) *loader.Program {
 	var lconfig packages.Config
-	lconfig.Dir = filepath.Join("testdata/src/foo")
+	lconfig.Dir = filepath.Join(dir)
 	prog, err := loader.Load(&lconfig, func(err error) { t.Fatal(err.Error()) })
 	if err != nil {
 		t.Fatal(err)
@@ -181,6 +188,168 @@ func TestFindOccurrences(t *testing.T) {
 			"testdata/src/foo/foo.go:285"}, t)
 }
 
+func TestFindOccurrencesInTestVariants(t *testing.T) {
+	prog := load("testdata/src/baz", t)
+	variants := 0
+	for pkg, info := range prog.AllPackages {
+		if pkg.Path() != "baz" {
+			continue
+		}
+		variants++
+		// Occurrences are the same regardless of which variant of the
+		// package ("baz" or "baz [baz.test]") the object comes from
+		check(occurrencesOf(prog, info, "Exported", t),
+			[]string{
+				"testdata/src/baz/baz.go:18",
+				"testdata/src/baz/baz_test.go:90",
+			}, t)
+		check(occurrencesOf(prog, info, "unexported", t),
+			[]string{
+				"testdata/src/baz/baz.go:42",
+				"testdata/src/baz/baz.go:63",
+				"testdata/src/baz/export_test.go:30",
+			}, t)
+	}
+	if variants != 2 {
+		t.Fatalf("Expected 2 variants of package baz, found %d", variants)
+	}
+}
+
+func TestExplainDeclarationsAcrossInterfaces(t *testing.T) {
+	prog := load("testdata/src/ifaces", t)
+	method := lookupFieldOrMethod(prog, "ifaces", "File", "Size", t)
+	name := func(obj types.Object) string {
+		recv := obj.Type().(*types.Signature).Recv().Type()
+		if ptr, ok := recv.(*types.Pointer); ok {
+			recv = ptr.Elem()
+		}
+		return types.TypeString(recv, types.RelativeTo(obj.Pkg())) +
+			"." + obj.Name()
+	}
+	result := []string{}
+	for _, link := range names.ExplainDeclarationsAcrossInterfaces(method, prog) {
+		result = append(result, fmt.Sprintf("%s via %s (%s)",
+			name(link.Method), name(link.Via),
+			types.TypeString(link.Interface, types.RelativeTo(method.Pkg()))))
+	}
+	expect := []string{
+		"Sizer.Size via File.Size (Sizer)",
+		"Measurer.Size via File.Size (Sizer)",
+		"Disk.Size via File.Size (Sizer)",
+	}
+	if !equals(result, expect) {
+		t.Fatalf("Expected %v, got %v", expect, result)
+	}
+	if len(names.FindDeclarationsAcrossInterfaces(method, prog)) != len(expect)+1 {
+		t.Fatalf("Expected every affected method to be explained")
+	}
+}
+
+func TestFindCommentOccurrences(t *testing.T) {
+	src := `package p
+
+// Run the tests.  Running them twice calls Run() again, as does t.Run,
+// [Run], [T.Run], and ` + "`Run`" + `; Run_ and Run2 are unrelated.
+func Run() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := []string{}
+	for _, occ := range names.FindCommentOccurrences("Run", file, nil, fset) {
+		kind := "word"
+		switch occ.Kind {
+		case names.CommentReference:
+			kind = "ref"
+		case names.CommentDocLink:
+			kind = "link"
+		}
+		result = append(result, fmt.Sprintf("%s:%s",
+			src[occ.Offset:occ.OffsetPastEnd()], kind))
+	}
+	expect := []string{"Run:word", "Run:ref", "Run:ref", "Run:link",
+		"Run:link", "Run:ref"}
+	if !equals(result, expect) {
+		t.Fatalf("Expected %v, got %v", expect, result)
+	}
+}
+
+func TestFindDocLinks(t *testing.T) {
+	src := `package p
+
+// See [Name], [T.Name], [*T.Name], [pkg.T.Name], and [encoding/json.Marshal],
+// but not [a link], [1x], [a.b.c.d], or [x.].
+//
+// [Text]: https://example.com/
+var x int
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := []string{}
+	for _, link := range names.FindDocLinks(file, fset) {
+		parts := []string{}
+		for i, name := range link.Names {
+			if src[link.Offsets[i]:link.Offsets[i]+len(name)] != name {
+				t.Fatalf("Incorrect offset for %s", name)
+			}
+			parts = append(parts, name)
+		}
+		result = append(result,
+			link.ImportPath+":"+strings.Join(parts, "."))
+	}
+	expect := []string{":Name", ":T.Name", ":T.Name", ":pkg.T.Name",
+		"encoding/json:Marshal"}
+	if !equals(result, expect) {
+		t.Fatalf("Expected %v, got %v", expect, result)
+	}
+}
+
+func TestSplitIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"ParseHTTPRequest": "Parse HTTP Request",
+		"max_line_len":     "max line len",
+		"utf8Reader":       "utf8 Reader",
+		"HTTP2Server":      "HTTP2 Server",
+		"UserIDs":          "User IDs",
+		"URLsForHost":      "URLs For Host",
+		"ID":               "ID",
+		"x":                "x",
+		"_":                "",
+		"Über_Größe":       "Über Größe",
+	}
+	for name, expect := range tests {
+		result := strings.Join(names.SplitIdentifier(name), " ")
+		if result != expect {
+			t.Errorf("SplitIdentifier(%s): expected %q, got %q",
+				name, expect, result)
+		}
+	}
+	if !names.IsInitialism("HTTP2") || names.IsInitialism("Http") ||
+		names.IsInitialism("A") {
+		t.Error("IsInitialism returned an incorrect result")
+	}
+}
+
+func occurrencesOf(prog *loader.Program, pkg *packages.Package, name string, t *testing.T) []string {
+	obj := pkg.Types.Scope().Lookup(name)
+	if obj == nil {
+		t.Fatalf("%s not found in %s", name, pkg.ID)
+	}
+	result := []string{}
+	for id := range names.FindOccurrences(obj, prog) {
+		pos := prog.Fset.Position(id.Pos())
+		result = append(result, fmt.Sprintf("%s:%d",
+			pos.Filename, pos.Offset))
+	}
+	sort.Strings(result)
+	return result
+}
+
 func check(actual, expect []string, t *testing.T) {
 	wd, err := os.Getwd()
 	if err != nil {
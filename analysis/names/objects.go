@@ -25,6 +25,7 @@ func FindOccurrences(obj types.Object, prog *loader.Program) map[*ast.Ident]bool
 	} else if isMethod(obj) {
 		decls = FindDeclarationsAcrossInterfaces(obj, prog)
 	}
+	decls = addTestVariants(decls, prog)
 
 	result := make(map[*ast.Ident]bool)
 	for pkgInfo := range packagesContaining(decls, prog) {
@@ -56,8 +57,66 @@ func packagesContaining(decls map[types.Object]bool, program *loader.Program) ma
 		if decl.Exported() {
 			return allPackages(program)
 		}
-		pkgInfo := program.AllPackages[decl.Pkg()]
-		result[pkgInfo] = true
+		for _, pkgInfo := range program.AllPackages {
+			if pkgInfo.Types.Path() == decl.Pkg().Path() {
+				result[pkgInfo] = true
+			}
+		}
+	}
+	return result
+}
+
+// addTestVariants returns a set containing the given declarations along with
+// the corresponding declarations in every variant of the packages declaring
+// them.  When tests are loaded, a package with _test.go files is type checked
+// twice: once alone ("foo"), and once with its in-package tests
+// ("foo [foo.test]"), and the external test package (foo_test) imports the
+// latter.  Each variant has its own Objects, but the variants share ASTs, so
+// corresponding declarations have the same name, package path, and position.
+//
+// Similarly, when the program is loaded from several modules (see
+// loader.Program.Merge), a package may be loaded more than once, e.g., as
+// part of one module and as a dependency of another.  These are type checked
+// separately, and their files are parsed separately, but corresponding
+// declarations are at the same offset in the same file.
+func addTestVariants(decls map[types.Object]bool, prog *loader.Program) map[types.Object]bool {
+	type key struct {
+		pkgPath  string
+		name     string
+		filename string
+		offset   int
+	}
+	keyOf := func(pkgPath string, obj types.Object) key {
+		pos := prog.Fset.Position(obj.Pos())
+		return key{pkgPath, obj.Name(), pos.Filename, pos.Offset}
+	}
+	keys := map[key]bool{}
+	paths := map[string]bool{}
+	for decl := range decls {
+		if decl.Pkg() == nil || !decl.Pos().IsValid() {
+			continue
+		}
+		keys[keyOf(decl.Pkg().Path(), decl)] = true
+		paths[decl.Pkg().Path()] = true
+	}
+	if len(keys) == 0 {
+		return decls
+	}
+
+	result := make(map[types.Object]bool, len(decls))
+	for decl := range decls {
+		result[decl] = true
+	}
+	for pkg, pkgInfo := range prog.AllPackages {
+		if pkg == nil || !paths[pkg.Path()] || pkgInfo.TypesInfo == nil {
+			continue
+		}
+		for _, obj := range pkgInfo.TypesInfo.Defs {
+			if obj != nil && obj.Pos().IsValid() &&
+				keys[keyOf(pkg.Path(), obj)] {
+				result[obj] = true
+			}
+		}
 	}
 	return result
 }
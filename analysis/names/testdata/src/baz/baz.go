@@ -0,0 +1,5 @@
+package baz
+
+func Exported() int { return unexported() }
+
+func unexported() int { return 3 }
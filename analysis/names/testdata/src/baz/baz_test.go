@@ -0,0 +1,12 @@
+package baz_test
+
+import (
+	"baz"
+	"testing"
+)
+
+func TestExported(t *testing.T) {
+	if baz.Exported() != baz.Unexported() {
+		t.Fail()
+	}
+}
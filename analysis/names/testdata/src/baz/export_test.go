@@ -0,0 +1,3 @@
+package baz
+
+var Unexported = unexported
@@ -0,0 +1,3 @@
+module baz
+
+go 1.14
@@ -0,0 +1,3 @@
+module ifaces
+
+go 1.14
@@ -0,0 +1,23 @@
+package ifaces
+
+type Sizer interface {
+	Size() int
+}
+
+type Measurer interface {
+	Size() int
+	Unit() string
+}
+
+type File struct{}
+
+func (File) Size() int { return 1 }
+
+type Disk struct{}
+
+func (*Disk) Size() int    { return 2 }
+func (*Disk) Unit() string { return "GB" }
+
+type Unrelated struct{}
+
+func (Unrelated) Size() string { return "" }
@@ -53,3 +53,34 @@ func caseClauseVars(typeSwitch *ast.TypeSwitchStmt, pkgInfo *packages.Package) m
 	}
 	return result
 }
+
+// FindTypeSwitchVarConflict is like FindConflict, but for the variable defined
+// in the given type switch statement, which is declared implicitly in each
+// case clause.  If the variable conflicts with an imported package name in
+// one clause and with another declaration in another clause, the other
+// declaration is returned.
+func FindTypeSwitchVarConflict(typeSwitch *ast.TypeSwitchStmt, pkgInfo *packages.Package, name string) types.Object {
+	var result types.Object
+	for _, v := range TypeSwitchVars(typeSwitch, pkgInfo) {
+		conflict := FindConflict(v, name)
+		if _, isPkgName := conflict.(*types.PkgName); conflict != nil && !isPkgName {
+			return conflict
+		}
+		if result == nil {
+			result = conflict
+		}
+	}
+	return result
+}
+
+// TypeSwitchVars returns the variables declared implicitly by the case clauses
+// of the given type switch statement.
+func TypeSwitchVars(typeSwitch *ast.TypeSwitchStmt, pkgInfo *packages.Package) []types.Object {
+	result := []types.Object{}
+	for _, stmt := range typeSwitch.Body.List {
+		if obj := pkgInfo.TypesInfo.Implicits[stmt.(*ast.CaseClause)]; obj != nil {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
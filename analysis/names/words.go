@@ -0,0 +1,69 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package names
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SplitIdentifier splits a Go identifier into the words it is composed of,
+// using underscores and changes of case as word boundaries.  A run of
+// uppercase letters is treated as an initialism, and digits belong to the
+// word they follow.  For example,
+//
+//	ParseHTTPRequest -> Parse HTTP Request
+//	max_line_len     -> max line len
+//	utf8Reader       -> utf8 Reader
+//
+// The case of each word is preserved.
+func SplitIdentifier(name string) []string {
+	result := []string{}
+	for _, part := range strings.Split(name, "_") {
+		runes := []rune(part)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			prev, cur := runes[i-1], runes[i]
+			if !unicode.IsUpper(cur) {
+				continue
+			}
+			// Split fooBar and foo8Bar before B, and split HTTPServer
+			// before S (the last uppercase letter of an initialism
+			// begins the next word, unless it is a plural like IDs)
+			if !unicode.IsUpper(prev) ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1]) &&
+					!isPluralSuffix(runes[i+1:]) {
+				result = append(result, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			result = append(result, string(runes[start:]))
+		}
+	}
+	return result
+}
+
+// isPluralSuffix returns true if the given runes, which follow an uppercase
+// letter, begin with an s that ends a word (as in IDs or URLsFor).
+func isPluralSuffix(runes []rune) bool {
+	return runes[0] == 's' && (len(runes) == 1 || !unicode.IsLower(runes[1]))
+}
+
+// IsInitialism returns true if the given word (e.g., from SplitIdentifier)
+// is an initialism or acronym, such as HTTP or URL: it contains at least two
+// letters, and all of its letters are uppercase.
+func IsInitialism(word string) bool {
+	letters := 0
+	for _, r := range word {
+		if unicode.IsLetter(r) {
+			if !unicode.IsUpper(r) {
+				return false
+			}
+			letters++
+		}
+	}
+	return letters >= 2
+}
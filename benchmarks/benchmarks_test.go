@@ -0,0 +1,209 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package benchmarks_test
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/godoctor/godoctor/benchmarks"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+var (
+	packages  = flag.Int("packages", 50, "number of packages in the generated program")
+	files     = flag.Int("files", 20, "number of files per package in the generated program")
+	record    = flag.String("record", "", "TestRegression writes results to this JSON file")
+	baseline  = flag.String("baseline", "", "TestRegression compares results to this JSON file")
+	tolerance = flag.Float64("tolerance", 0.25, "allowed fractional increase over the baseline")
+)
+
+// prog is the generated program, shared by all benchmarks; it is generated
+// by the first benchmark that needs it (see generate)
+var (
+	prog     *benchmarks.Program
+	progDir  string
+	progErr  error
+	progOnce sync.Once
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	result := m.Run()
+	if progDir != "" {
+		os.RemoveAll(progDir)
+	}
+	os.Exit(result)
+}
+
+// generate creates the program in a temporary directory the first time it is
+// called, so that a plain "go test" does not pay for a program it never uses.
+func generate(tb testing.TB) {
+	progOnce.Do(func() {
+		progDir, progErr = ioutil.TempDir("", "godoctor-benchmarks")
+		if progErr != nil {
+			return
+		}
+		prog, progErr = benchmarks.Generate(progDir, *packages, *files)
+	})
+	if progErr != nil {
+		tb.Fatal(progErr)
+	}
+}
+
+// A benchmark runs a refactoring on the generated program and checks that it
+// succeeds and produces the expected number of edited files.
+type benchmark struct {
+	name        string
+	refactoring func() refactoring.Refactoring
+	selection   func() text.Selection
+	args        []interface{}
+	editedFiles func() int
+}
+
+var allBenchmarks = []benchmark{
+	{
+		name:        "Rename",
+		refactoring: func() refactoring.Refactoring { return new(refactoring.Rename) },
+		selection: func() text.Selection {
+			return &text.LineColSelection{
+				Filename:  prog.BaseFile(),
+				StartLine: benchmarks.ValueLine,
+				StartCol:  benchmarks.ValueCol,
+				EndLine:   benchmarks.ValueLine,
+				EndCol:    benchmarks.ValueCol + len("Value"),
+			}
+		},
+		args:        []interface{}{"Compute"},
+		editedFiles: func() int { return prog.Files() },
+	},
+	{
+		name:        "Extract",
+		refactoring: func() refactoring.Refactoring { return new(refactoring.ExtractFunc) },
+		selection: func() text.Selection {
+			return &text.LineColSelection{
+				Filename:  prog.BaseFile(),
+				StartLine: benchmarks.LoopStartLine,
+				StartCol:  2,
+				EndLine:   benchmarks.LoopEndLine,
+				EndCol:    3,
+			}
+		},
+		args:        []interface{}{"addValues"},
+		editedFiles: func() int { return 1 },
+	},
+}
+
+func (bm *benchmark) run(b *testing.B) {
+	generate(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		result := bm.refactoring().Run(&refactoring.Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Scope:      []string{"./..."},
+			Dir:        prog.Dir,
+			Selection:  bm.selection(),
+			Args:       bm.args,
+		})
+		if result.Log.ContainsErrors() {
+			b.Fatalf("%s failed:\n%s", bm.name, result.Log)
+		}
+		if len(result.Edits) != bm.editedFiles() {
+			b.Fatalf("%s edited %d files; expected %d", bm.name,
+				len(result.Edits), bm.editedFiles())
+		}
+	}
+}
+
+func BenchmarkRename(b *testing.B) {
+	allBenchmarks[0].run(b)
+}
+
+func BenchmarkExtract(b *testing.B) {
+	allBenchmarks[1].run(b)
+}
+
+// A measurement records the cost of one run of a refactoring.
+type measurement struct {
+	NsPerOp     int64 `json:"nsPerOp"`
+	AllocsPerOp int64 `json:"allocsPerOp"`
+	BytesPerOp  int64 `json:"bytesPerOp"`
+}
+
+// TestRegression runs every benchmark and, if -record is given, saves the
+// results; if -baseline is given, it fails if any benchmark's time or
+// allocations exceed those in the baseline by more than -tolerance.  It is
+// skipped unless one of these flags is given.
+func TestRegression(t *testing.T) {
+	if *record == "" && *baseline == "" {
+		t.Skip("neither -record nor -baseline given")
+	}
+	generate(t)
+
+	var base map[string]measurement
+	if *baseline != "" {
+		data, err := ioutil.ReadFile(*baseline)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &base); err != nil {
+			t.Fatalf("%s: %v", *baseline, err)
+		}
+	}
+
+	results := map[string]measurement{}
+	for i := range allBenchmarks {
+		bm := &allBenchmarks[i]
+		r := testing.Benchmark(bm.run)
+		if r.N == 0 {
+			t.Fatalf("%s failed", bm.name)
+		}
+		results[bm.name] = measurement{
+			NsPerOp:     r.NsPerOp(),
+			AllocsPerOp: r.AllocsPerOp(),
+			BytesPerOp:  r.AllocedBytesPerOp(),
+		}
+		t.Logf("%s: %s %s", bm.name, r.String(), r.MemString())
+	}
+
+	if *record != "" {
+		data, err := json.MarshalIndent(results, "", "\t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(*record, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := []string{}
+	for name := range base {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		old, cur := base[name], results[name]
+		checkRegression(t, name, "ns/op", old.NsPerOp, cur.NsPerOp)
+		checkRegression(t, name, "allocs/op", old.AllocsPerOp, cur.AllocsPerOp)
+		checkRegression(t, name, "B/op", old.BytesPerOp, cur.BytesPerOp)
+	}
+}
+
+// checkRegression marks a test as having failed if actual exceeds expected
+// by more than the allowed tolerance.
+func checkRegression(t *testing.T, name, unit string, expected, actual int64) {
+	limit := float64(expected) * (1 + *tolerance)
+	if expected > 0 && float64(actual) > limit {
+		t.Errorf("%s regressed: %d %s (baseline %d %s)",
+			name, actual, unit, expected, unit)
+	}
+}
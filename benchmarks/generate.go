@@ -0,0 +1,154 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package benchmarks measures the performance of refactorings on large,
+// synthetic Go programs.  The benchmarks are in benchmarks_test.go; run
+//     go test -run=NONE -bench=. -benchmem ./benchmarks
+// to measure wall time and allocations, or
+//     go test -run=TestRegression -record=base.json ./benchmarks
+//     go test -run=TestRegression -baseline=base.json ./benchmarks
+// to record a baseline and later fail if a change makes a refactoring
+// significantly slower or more allocation-heavy.
+package benchmarks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ModulePath is the module path of generated programs.
+const ModulePath = "example.com/synthetic"
+
+// A Program is a synthetic Go module, generated by Generate, consisting of
+// Packages packages with FilesPerPackage files each.  Every package imports
+// the first package, p000, and calls its Value function from every file, so
+// renaming Value requires updating every file in the module.
+type Program struct {
+	// Root directory of the module (containing go.mod)
+	Dir             string
+	Packages        int
+	FilesPerPackage int
+}
+
+// Generate writes a synthetic module with the given number of packages and
+// files per package into dir, which must exist.
+func Generate(dir string, packages, filesPerPackage int) (*Program, error) {
+	if packages < 1 || filesPerPackage < 1 {
+		return nil, fmt.Errorf("A program must have at least one " +
+			"package and one file per package")
+	}
+
+	gomod := fmt.Sprintf("module %s\n\ngo 1.14\n", ModulePath)
+	if err := writeFile(filepath.Join(dir, "go.mod"), gomod); err != nil {
+		return nil, err
+	}
+
+	for p := 0; p < packages; p++ {
+		pkgDir := filepath.Join(dir, packageName(p))
+		if err := os.MkdirAll(pkgDir, 0755); err != nil {
+			return nil, err
+		}
+		for f := 0; f < filesPerPackage; f++ {
+			var src string
+			if p == 0 && f == 0 {
+				src = baseFile
+			} else {
+				src = generateFile(p, f)
+			}
+			filename := filepath.Join(pkgDir, fileName(f))
+			if err := writeFile(filename, src); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &Program{
+		Dir:             dir,
+		Packages:        packages,
+		FilesPerPackage: filesPerPackage,
+	}, nil
+}
+
+// BaseFile returns the path of the file declaring Value and Sum.
+func (p *Program) BaseFile() string {
+	return filepath.Join(p.Dir, packageName(0), fileName(0))
+}
+
+// Files returns the total number of Go files in the program.
+func (p *Program) Files() int {
+	return p.Packages * p.FilesPerPackage
+}
+
+// Positions of identifiers and statements in baseFile, for use in selections
+const (
+	// Line and column of the name Value in its declaration
+	ValueLine, ValueCol = 6, 6
+	// Lines containing the for loop in Sum (to be extracted)
+	LoopStartLine, LoopEndLine = 15, 17
+)
+
+// baseFile is the content of p000/f000.go.  If this changes, the line and
+// column constants above must be updated.
+const baseFile = `package p000
+
+// The name Value is renamed by BenchmarkRename; the loop in Sum is extracted
+// by BenchmarkExtract.
+
+func Value(n int) int {
+	x := n * 2
+	y := x + 1
+	return x + y
+}
+
+// Sum returns the sum of the given values.
+func Sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += Value(v)
+	}
+	return total
+}
+`
+
+func generateFile(p, f int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n\n", packageName(p))
+	if p > 0 {
+		fmt.Fprintf(&b, "import \"%s/%s\"\n\n", ModulePath, packageName(0))
+	}
+	qualifier := ""
+	if p > 0 {
+		qualifier = packageName(0) + "."
+	}
+	name := fmt.Sprintf("F%03d", f)
+	fmt.Fprintf(&b, "// %s computes a value derived from n.\n", name)
+	fmt.Fprintf(&b, "func %s(n int) int {\n", name)
+	fmt.Fprintf(&b, "\ta := %sValue(n)\n", qualifier)
+	fmt.Fprintf(&b, "\tb := a * %d\n", f+1)
+	fmt.Fprintf(&b, "\tfor i := 0; i < n; i++ {\n")
+	fmt.Fprintf(&b, "\t\tb += %sValue(i)\n", qualifier)
+	fmt.Fprintf(&b, "\t}\n")
+	fmt.Fprintf(&b, "\treturn a + b\n")
+	fmt.Fprintf(&b, "}\n\n")
+	fmt.Fprintf(&b, "type T%03d struct {\n\tValue int\n}\n\n", f)
+	fmt.Fprintf(&b, "func (t *T%03d) Get() int {\n", f)
+	fmt.Fprintf(&b, "\treturn %sValue(t.Value)\n", qualifier)
+	fmt.Fprintf(&b, "}\n")
+	return b.String()
+}
+
+func packageName(p int) string {
+	return fmt.Sprintf("p%03d", p)
+}
+
+func fileName(f int) string {
+	return fmt.Sprintf("f%03d.go", f)
+}
+
+func writeFile(filename, contents string) error {
+	return ioutil.WriteFile(filename, []byte(contents), 0644)
+}
@@ -79,6 +79,12 @@ Display a list of available refactorings:
 -list
 .PP
 .TP
+Describe the available refactorings, including their parameters, in JSON format (e.g., for an editor plugin):
+.B godoctor
+-list
+-format json
+.PP
+.TP
 Display usage information for the Rename refactoring:
 .B godoctor
 rename
@@ -92,6 +98,64 @@ rename
 bar
 .PP
 .TP
+The same, but giving the new name as a named argument (run godoctor -list to see the names of each refactoring's arguments):
+.B godoctor
+-pos 5,6:5,6
+-file main.go
+rename
+--new-name=bar
+.PP
+.TP
+Rename the identifier beginning at byte offset 1200 in main.go (which is 3 bytes long) to bar:
+.B godoctor
+-pos 1200+3
+-file main.go
+rename
+bar
+.PP
+.TP
+Rename the method Method of the type Type in the package example.com/pkg to Renamed, without giving a position (see -decl):
+.B godoctor
+-scope example.com/...
+-decl example.com/pkg.Type.Method
+rename
+Renamed
+.PP
+.TP
+Rename the identifier in main.go at line 5, column 6 to bar, outputting a patch with as few added and removed lines as possible (by default, lines in the patch are matched using patience diff, which is often easier to read when code has been moved or heavily edited):
+.B godoctor
+-diff-algo myers
+-pos 5,6:5,6
+-file main.go
+rename
+bar
+.PP
+.TP
+Rename the identifier in main.go at line 5, column 6 to bar, updating both the files compiled on Linux and the files compiled on Windows (e.g., foo_linux.go and foo_windows.go):
+.B godoctor
+-pos 5,6:5,6
+-file main.go
+-build linux,windows
+rename
+bar
+.PP
+.TP
+Rename the identifier in main.go at line 5, column 6 to bar, where main.go is one of the files in the txtar archive in.txtar (e.g., from a bug report), writing an archive of the refactored files to out.txtar:
+.B godoctor
+-archive in.txtar
+-pos 5,6:5,6
+-file main.go
+rename
+bar
+> out.txtar
+.PP
+.TP
+Run as a protocol daemon (e.g., for a text editor), serving counters at http://localhost:6060/debug/vars and profiles at http://localhost:6060/debug/pprof/:
+.B godoctor
+-json
+-debug-addr localhost:6060
+.PP
+.TP
 Toy example: Pipe a file to the godoctor and rename n to foo, displaying the result:
 echo 'package main; import "fmt"; func main() { n := 1; fmt.Println(n) }' | godoctor -pos 1,43:1,43 -w rename foo
 .PP
@@ -108,6 +172,9 @@ Help/usage information was displayed; no commands were executed
 .TP
 3
 The refactoring could not be completed; output contains a detailed error log
+.TP
+4
+With -safe, the refactoring completed, but its changes were not output or applied, since it reported warnings (i.e., it preserves behavior only under the assumptions described in the log)
 .SH AUTHOR
 See http://gorefactor.org
 `
@@ -0,0 +1,140 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements "godoctor -save", which saves a refactoring's edits to
+// a file, and "godoctor apply", which applies saved edits to the working
+// tree.  This allows edits to be reviewed (or generated on a CI server) and
+// applied later.
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// savedEdits is the JSON representation of a refactoring's edits, as
+// written by -save and read by "godoctor apply".
+type savedEdits struct {
+	Files []savedFile `json:"files"`
+}
+
+// savedFile describes the edits to a single file.  The hash of the file's
+// contents before the edits are applied is recorded so that "godoctor apply"
+// can refuse to apply the edits if the file has changed in the meantime.
+type savedFile struct {
+	// Path of the file, using forward slashes; relative to the current
+	// directory (when the edits were saved) if possible
+	Filename string `json:"filename"`
+	// Hex-encoded SHA-256 hash of the file's original contents
+	SHA256 string        `json:"sha256"`
+	Edits  *text.EditSet `json:"edits"`
+}
+
+// saveEdits writes the given edits, along with the hashes of the files they
+// apply to, to the given file in JSON format.
+func saveEdits(filename string, edits map[string]*text.EditSet, fs filesystem.FileSystem) error {
+	filenames := make([]string, 0, len(edits))
+	for f := range edits {
+		if filesystem.IsFakeStdinPath(f) {
+			return fmt.Errorf("Edits to standard input cannot be saved")
+		}
+		filenames = append(filenames, f)
+	}
+	sort.Strings(filenames)
+
+	saved := savedEdits{Files: []savedFile{}}
+	for _, f := range filenames {
+		hash := edits[f].BaseHash()
+		if hash == "" {
+			var err error
+			if hash, err = hashFile(fs, f); err != nil {
+				return err
+			}
+		}
+		saved.Files = append(saved.Files, savedFile{
+			Filename: relativePath(f),
+			SHA256:   hash,
+			Edits:    edits[f],
+		})
+	}
+
+	data, err := json.MarshalIndent(saved, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// applySavedEdits reads edits saved by saveEdits from the given file and
+// applies them to the files on disk.  If any file's contents have changed
+// since the edits were saved, a *text.StaleError is returned, and no files
+// are modified.
+func applySavedEdits(filename string, fs filesystem.FileSystem, stderr io.Writer, verbose bool) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var saved savedEdits
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	// Check every file before modifying any of them
+	edits := map[string]*text.EditSet{}
+	for _, file := range saved.Files {
+		path := filepath.FromSlash(file.Filename)
+		if file.Edits == nil {
+			file.Edits = text.NewEditSet()
+		}
+		hash, err := hashFile(fs, path)
+		if err != nil {
+			return err
+		}
+		if hash != file.SHA256 {
+			return &text.StaleError{
+				Filename: file.Filename,
+				Expected: file.SHA256,
+				Actual:   hash,
+			}
+		}
+		file.Edits.SetBaseHash(file.SHA256)
+		edits[path] = file.Edits
+	}
+
+	if err := filesystem.NewEditTransaction(edits, nil).Apply(fs); err != nil {
+		return err
+	}
+	for _, file := range saved.Files {
+		path := filepath.FromSlash(file.Filename)
+		if verbose {
+			fmt.Fprintf(stderr, "%s: %d edit(s) applied\n",
+				file.Filename, edits[path].Len())
+		}
+	}
+	return nil
+}
+
+// hashFile returns the hex-encoded SHA-256 hash of the given file's contents.
+func hashFile(fs filesystem.FileSystem, filename string) (string, error) {
+	f, err := fs.OpenFile(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
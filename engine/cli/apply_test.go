@@ -0,0 +1,64 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestSaveAndApplyEdits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(source, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	es := text.NewEditSet()
+	es.Add(&text.Extent{8, 4}, "other")
+
+	fs := filesystem.NewLocalFileSystem()
+	saved := filepath.Join(dir, "edits.json")
+	err = saveEdits(saved, map[string]*text.EditSet{source: es}, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if err := applySavedEdits(saved, fs, &stderr, true); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "package other\n" {
+		t.Fatalf("Edits were not applied correctly:\n%s", contents)
+	}
+	if !strings.Contains(stderr.String(), "1 edit(s) applied") {
+		t.Fatalf("Verbose output incorrect:\n%s", stderr.String())
+	}
+
+	// The file has now changed, so the edits must not be applied again
+	err = applySavedEdits(saved, fs, &stderr, false)
+	if err == nil || !strings.Contains(err.Error(), "has changed") {
+		t.Fatalf("Applying edits to a changed file should fail (%v)", err)
+	}
+	contents, _ = ioutil.ReadFile(source)
+	if string(contents) != "package other\n" {
+		t.Fatalf("File should not have been modified:\n%s", contents)
+	}
+}
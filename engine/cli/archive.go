@@ -0,0 +1,134 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements "godoctor -archive", which runs a refactoring on the
+// files in a txtar archive (see golang.org/x/tools/txtar) and outputs an
+// archive containing the refactored files.  This makes it possible to
+// reproduce a bug report, or write a regression test, using a single file
+// rather than a directory tree.
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"golang.org/x/tools/txtar"
+)
+
+// extractArchive reads the txtar archive with the given filename and writes
+// its files into a new temporary directory, returning the archive and the
+// path of the directory.  The caller must remove the directory.
+func extractArchive(filename string) (*txtar.Archive, string, error) {
+	ar, err := txtar.ParseFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(ar.Files) == 0 {
+		return nil, "", fmt.Errorf("The archive %s does not contain "+
+			"any files", filename)
+	}
+	for _, f := range ar.Files {
+		if !isArchivePath(f.Name) {
+			return nil, "", fmt.Errorf("The archive %s cannot be "+
+				"extracted, since it contains the file \"%s\"; "+
+				"file names must be relative paths within the "+
+				"archive", filename, f.Name)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "godoctor-archive")
+	if err != nil {
+		return nil, "", err
+	}
+	for _, f := range ar.Files {
+		filename := filepath.Join(dir, filepath.FromSlash(f.Name))
+		err := os.MkdirAll(filepath.Dir(filename), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filename, f.Data, 0644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", err
+		}
+	}
+	return ar, dir, nil
+}
+
+// isArchivePath returns true if the given name, from a txtar archive, is a
+// slash-separated relative path that does not refer to a parent directory
+// (e.g., "a/b.go", but not "/a/b.go" or "../b.go").
+func isArchivePath(name string) bool {
+	if name == "" || strings.Contains(name, `\`) || path.IsAbs(name) ||
+		filepath.IsAbs(filepath.FromSlash(name)) {
+		return false
+	}
+	cleaned := path.Clean(name)
+	return cleaned != "." && cleaned != ".." &&
+		!strings.HasPrefix(cleaned, "../")
+}
+
+// writeArchive applies the refactoring's changes to the files extracted from
+// the given archive (into dir), then outputs an archive of the resulting
+// files.  The archive's comment is preserved, and its files are listed in the
+// same order, followed by any files the refactoring created, in sorted order.
+func writeArchive(out io.Writer, ar *txtar.Archive, dir string, result *refactoring.Result, fs filesystem.FileSystem) error {
+	if err := result.Transaction().Apply(fs); err != nil {
+		return err
+	}
+
+	names := []string{}
+	err := filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	order := map[string]int{}
+	for i, f := range ar.Files {
+		order[path.Clean(f.Name)] = i
+	}
+	position := func(name string) int {
+		if i, found := order[name]; found {
+			return i
+		}
+		return len(ar.Files)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		if pi, pj := position(names[i]), position(names[j]); pi != pj {
+			return pi < pj
+		}
+		return names[i] < names[j]
+	})
+
+	output := &txtar.Archive{Comment: ar.Comment}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if i, found := order[name]; found {
+			name = ar.Files[i].Name
+		}
+		output.Files = append(output.Files, txtar.File{Name: name, Data: data})
+	}
+	_, err = out.Write(txtar.Format(output))
+	return err
+}
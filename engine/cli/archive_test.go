@@ -0,0 +1,92 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in.txtar")
+	const archive = `Comment
+-- main.go --
+package main
+-- sub/b.go --
+package sub
+`
+	if err := ioutil.WriteFile(in, []byte(archive), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ar, extracted, err := extractArchive(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(extracted)
+	data, err := ioutil.ReadFile(filepath.Join(extracted, "sub", "b.go"))
+	if err != nil || string(data) != "package sub\n" {
+		t.Fatalf("sub/b.go was not extracted (%v): %q", err, data)
+	}
+
+	es := text.NewEditSet()
+	es.Add(&text.Extent{8, 4}, "other")
+	result := &refactoring.Result{
+		Edits: map[string]*text.EditSet{
+			filepath.Join(extracted, "main.go"): es,
+		},
+		FSChanges: []filesystem.Change{
+			&filesystem.CreateDirectory{Path: filepath.Join(extracted, "a")},
+			&filesystem.CreateFile{
+				Path:     filepath.Join(extracted, "a", "a.go"),
+				Contents: "package a\n",
+			},
+		},
+	}
+	var out bytes.Buffer
+	err = writeArchive(&out, ar, extracted, result, filesystem.NewLocalFileSystem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `Comment
+-- main.go --
+package other
+-- sub/b.go --
+package sub
+-- a/a.go --
+package a
+`
+	if out.String() != expected {
+		t.Fatalf("Expected archive\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestArchivePaths(t *testing.T) {
+	valid := []string{"a.go", "a/b.go", "./a.go", "a/../b.go"}
+	for _, name := range valid {
+		if !isArchivePath(name) {
+			t.Errorf("%s should be a valid path in an archive", name)
+		}
+	}
+	invalid := []string{"", ".", "..", "../a.go", "a/../../b.go",
+		"/a.go", `a\b.go`}
+	for _, name := range invalid {
+		if isArchivePath(name) {
+			t.Errorf("%s should not be a valid path in an archive", name)
+		}
+	}
+}
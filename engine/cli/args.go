@@ -0,0 +1,137 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file allows a refactoring's arguments to be given by name, e.g.,
+//     godoctor -pos 5,2:7,10 extract --name=NewFunc
+// The name of each argument is derived from the label of the corresponding
+// parameter (see refactoring.Parameter.Name).
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/godoctor/godoctor/refactoring"
+)
+
+// positionalArgs converts the arguments following a refactoring's name, which
+// may include named arguments of the form --name=value (or --name value), into
+// a list of positional arguments in the order the refactoring expects.
+// Positional arguments may precede named arguments; an argument of -- ends
+// the named arguments, so that a value beginning with -- can be given
+// positionally.  A boolean argument given as --name (without a value) is true.
+// Optional arguments that are omitted, but precede one that is given, are
+// replaced by their default values.
+func positionalArgs(args []string, desc *refactoring.Description) ([]string, error) {
+	params := append(append([]refactoring.Parameter{}, desc.Params...),
+		desc.OptionalParams...)
+
+	positional := []string{}
+	named := map[int]string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			if len(named) > 0 {
+				return nil, fmt.Errorf("The argument %s must "+
+					"be given by name, since it follows a "+
+					"named argument", arg)
+			}
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, value := strings.TrimPrefix(arg, "--"), ""
+		hasValue := false
+		if idx := strings.Index(name, "="); idx >= 0 {
+			name, value, hasValue = name[:idx], name[idx+1:], true
+		}
+		idx := paramIndex(params, name)
+		if idx < 0 {
+			return nil, fmt.Errorf("The %s refactoring does not have "+
+				"a parameter named %s (%s)", desc.Name, name,
+				paramNames(params))
+		}
+		p := params[idx]
+		if _, found := named[idx]; found || idx < len(positional) {
+			return nil, fmt.Errorf("The %s parameter is given "+
+				"more than once", name)
+		}
+		if !hasValue && p.IsBoolean() {
+			value = "true"
+		} else if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("A value is required for "+
+					"the %s parameter", name)
+			}
+			i++
+			value = args[i]
+		}
+		if p.IsBoolean() && value != "true" && value != "false" {
+			return nil, fmt.Errorf("The %s parameter must be true "+
+				"or false, not \"%s\"", name, value)
+		}
+		named[idx] = value
+	}
+	if len(named) == 0 {
+		return positional, nil
+	}
+
+	result := positional
+	for idx := len(positional); len(named) > 0; idx++ {
+		if value, found := named[idx]; found {
+			result = append(result, value)
+			delete(named, idx)
+		} else if idx < len(desc.Params) {
+			return nil, errMissingParam(params[idx])
+		} else {
+			result = append(result,
+				fmt.Sprint(params[idx].DefaultValue))
+		}
+	}
+	if len(result) < len(desc.Params) {
+		return nil, errMissingParam(params[len(result)])
+	}
+	return result, nil
+}
+
+// errMissingParam returns an error indicating that a value for the given
+// (required) parameter was not supplied.
+func errMissingParam(p refactoring.Parameter) error {
+	return fmt.Errorf("The %s parameter is required (e.g., --%s=...)",
+		p.Name(), p.Name())
+}
+
+// paramIndex returns the index of the parameter with the given name, or -1 if
+// there is no such parameter.
+func paramIndex(params []refactoring.Parameter, name string) int {
+	for i, p := range params {
+		if p.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// paramNames returns a description of the names of the given parameters,
+// e.g., "its parameters are --new-name and --rename-all-receivers".
+func paramNames(params []refactoring.Parameter) string {
+	if len(params) == 0 {
+		return "it has no parameters"
+	}
+	names := []string{}
+	for _, p := range params {
+		names = append(names, "--"+p.Name())
+	}
+	if len(names) == 1 {
+		return "its only parameter is " + names[0]
+	}
+	return "its parameters are " +
+		strings.Join(names[:len(names)-1], ", ") + " and " +
+		names[len(names)-1]
+}
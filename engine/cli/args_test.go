@@ -0,0 +1,56 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/refactoring"
+)
+
+func TestPositionalArgs(t *testing.T) {
+	desc := new(refactoring.Rename).Description()
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"foo"}, "foo"},
+		{[]string{"--new-name=foo"}, "foo"},
+		{[]string{"--new-name", "foo"}, "foo"},
+		{[]string{"foo", "--rename-all-receivers"}, "foo false true"},
+		{[]string{"--rename-all-receivers=false", "--new-name=foo"},
+			"foo false false"},
+		{[]string{"--", "--foo"}, "--foo"},
+	}
+	for _, test := range tests {
+		args, err := positionalArgs(test.args, desc)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", test.args, err)
+		} else if strings.Join(args, " ") != test.expected {
+			t.Errorf("%v: expected %s, got %v", test.args,
+				test.expected, args)
+		}
+	}
+
+	errors := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--name=foo"}, "does not have a parameter named name"},
+		{[]string{"foo", "--new-name=bar"}, "new-name parameter is given more than once"},
+		{[]string{"--new-name"}, "A value is required for the new-name parameter"},
+		{[]string{"--rename-all-receivers=yes"}, "rename-all-receivers parameter must be true or false"},
+		{[]string{"--rename-all-receivers"}, "new-name parameter is required"},
+		{[]string{"--new-name=foo", "true"}, "must be given by name"},
+	}
+	for _, test := range errors {
+		_, err := positionalArgs(test.args, desc)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%v: expected error containing %q, got %v",
+				test.args, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements "godoctor audit", which reports, for each file in a
+// set of packages, how many places could benefit from refactoring (exported
+// declarations without doc comments, long functions, etc.) in JSON or CSV
+// format, e.g., for use in a dashboard.
+
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/audit"
+	"golang.org/x/tools/go/packages"
+)
+
+// auditReport is the JSON representation of the output of "godoctor audit".
+type auditReport struct {
+	MaxFuncLines int                `json:"maxFuncLines"`
+	Files        []audit.FileReport `json:"files"`
+	Total        audit.FileReport   `json:"total"`
+}
+
+// runAudit runs "godoctor audit" with the given arguments (following the
+// word "audit") and returns the exit code.
+func runAudit(cmdName string, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(cmdName+" audit", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "json",
+		"Output format (json or csv)")
+	maxLines := flags.Int("maxlines", audit.DefaultMaxFuncLines,
+		"Count functions longer than this many lines")
+	tests := flags.Bool("tests", false,
+		"Include test files")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s audit [<flag> ...] "+
+			"[<package> ...]\n\nEach <flag> must be one of the "+
+			"following:\n", cmdName)
+		flags.VisitAll(func(flag *flag.Flag) {
+			fmt.Fprintf(stderr, "    -%-8s %s\n", flag.Name, flag.Usage)
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 2
+		}
+		return 1
+	}
+	if *format != "json" && *format != "csv" {
+		fmt.Fprintln(stderr, "Error: The -format flag must be "+
+			"\"json\" or \"csv\"")
+		return 1
+	}
+	if *maxLines <= 0 {
+		fmt.Fprintln(stderr, "Error: The -maxlines flag must be positive")
+		return 1
+	}
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	reports, err := auditPackages("", patterns, *tests,
+		audit.Options{MaxFuncLines: *maxLines}, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s.\n", err)
+		return 1
+	}
+
+	if *format == "csv" {
+		err = writeAuditCSV(stdout, reports)
+	} else {
+		err = writeAuditJSON(stdout, reports, *maxLines)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s.\n", err)
+		return 1
+	}
+	return 0
+}
+
+// auditPackages audits every Go file in the packages matching the given
+// patterns (resolved relative to dir, or the current directory if dir is
+// empty), returning one report per file, sorted by filename.  Errors in
+// individual packages are reported to stderr, and those packages' files are
+// audited if possible.
+func auditPackages(dir string, patterns []string, tests bool, opts audit.Options, stderr io.Writer) ([]audit.FileReport, error) {
+	config := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles,
+		Dir:   dir,
+		Tests: tests,
+	}
+	pkgs, err := packages.Load(config, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	filenames := []string{}
+	seen := map[string]bool{}
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg.ID, ".test") {
+			continue // generated test main package
+		}
+		for _, err := range pkg.Errors {
+			fmt.Fprintf(stderr, "Warning: %s\n", err)
+		}
+		for _, filename := range pkg.GoFiles {
+			if !seen[filename] {
+				seen[filename] = true
+				filenames = append(filenames, filename)
+			}
+		}
+	}
+	sort.Strings(filenames)
+
+	reports := make([]audit.FileReport, 0, len(filenames))
+	fset := token.NewFileSet()
+	for _, filename := range filenames {
+		file, err := parser.ParseFile(fset, filename, nil,
+			parser.ParseComments)
+		if err != nil {
+			fmt.Fprintf(stderr, "Warning: %s\n", err)
+			continue
+		}
+		report := audit.File(fset, file, opts)
+		report.Filename = relativePath(filename)
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// writeAuditJSON writes the given reports, along with their total, in JSON
+// format.
+func writeAuditJSON(out io.Writer, reports []audit.FileReport, maxFuncLines int) error {
+	result := auditReport{
+		MaxFuncLines: maxFuncLines,
+		Files:        reports,
+		Total:        auditTotal(reports),
+	}
+	data, err := json.MarshalIndent(result, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
+}
+
+// writeAuditCSV writes the given reports in CSV format: a header, one row per
+// file, and a final row (for the file "total") containing the totals.
+func writeAuditCSV(out io.Writer, reports []audit.FileReport) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"file", "lines", "funcs", "missing_docs",
+		"long_funcs", "naked_returns"})
+	for _, r := range append(reports, auditTotal(reports)) {
+		w.Write([]string{
+			r.Filename,
+			strconv.Itoa(r.Lines),
+			strconv.Itoa(r.Funcs),
+			strconv.Itoa(r.MissingDocs),
+			strconv.Itoa(r.LongFuncs),
+			strconv.Itoa(r.NakedReturns),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// auditTotal returns the sum of the given reports, with the filename "total".
+func auditTotal(reports []audit.FileReport) audit.FileReport {
+	total := audit.FileReport{Filename: "total"}
+	for _, r := range reports {
+		total.Add(r)
+	}
+	return total
+}
@@ -0,0 +1,85 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/analysis/audit"
+)
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod": "module example.com/audit\n",
+		"a.go": "package a\n\nfunc Exported() {}\n\n" +
+			"func f() (n int) {\n\treturn\n}\n",
+		"a_test.go": "package a\n\nfunc Helper() {}\n",
+		"b/b.go":    "package b\n\n// Doc is documented.\nvar Doc = 1\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stderr bytes.Buffer
+	opts := audit.Options{MaxFuncLines: 2}
+	reports, err := auditPackages(dir, []string{"./..."}, false, opts, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("Expected reports for 2 files, got %d", len(reports))
+	}
+	a := reports[0]
+	if filepath.Base(a.Filename) != "a.go" || a.Funcs != 2 ||
+		a.MissingDocs != 1 || a.LongFuncs != 1 || a.NakedReturns != 1 {
+		t.Fatalf("Incorrect report for a.go: %+v", a)
+	}
+
+	reports, err = auditPackages(dir, []string{"./..."}, true, opts, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("Expected reports for 3 files with -tests, got %d",
+			len(reports))
+	}
+
+	var out bytes.Buffer
+	if err := writeAuditCSV(&out, reports); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 ||
+		lines[0] != "file,lines,funcs,missing_docs,long_funcs,naked_returns" ||
+		lines[4] != "total,14,3,2,1,1" {
+		t.Fatalf("Incorrect CSV output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := writeAuditJSON(&out, reports, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"maxFuncLines": 2`) ||
+		!strings.Contains(out.String(), `"missingDocs": 2`) {
+		t.Fatalf("Incorrect JSON output:\n%s", out.String())
+	}
+}
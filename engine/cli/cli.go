@@ -24,6 +24,7 @@ import (
 	"github.com/godoctor/godoctor/filesystem"
 	"github.com/godoctor/godoctor/refactoring"
 	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/txtar"
 )
 
 // Usage is the text template used to produce the output of "godoctor -help"
@@ -75,7 +76,15 @@ The <refactoring> argument determines the refactoring to perform:
 {{.Refactorings}}
 The <args> following the refactoring name vary depending on the refactoring.
 If a refactoring requires arguments but none are supplied, a message will be
-displayed with a synopsis of the correct usage.
+displayed with a synopsis of the correct usage.  Arguments may also be given by
+name (e.g., --new-name=foo); run {{.CommandName}} -list to see their names.
+
+Edits saved using -save can be applied later by running
+    {{.CommandName}} apply <file>
+
+To count the places in a set of packages where refactorings could be applied
+(e.g., exported declarations without doc comments), run
+    {{.CommandName}} audit [-format json|csv] [-maxlines <n>] [<package> ...]
 
 For complete usage information, see the user manual: http://gorefactor.org/doc.html
 `
@@ -101,12 +110,9 @@ func printHelp(cmdName, aboutText string, flags *flag.FlagSet, stderr io.Writer)
 	usageFields.Flags = flagList.String()
 
 	var refactorings bytes.Buffer
-	for _, key := range engine.AllRefactoringNames() {
-		r := engine.GetRefactoring(key)
-		if !r.Description().Hidden {
-			fmt.Fprintf(&refactorings, "    %-15s %s\n",
-				key, r.Description().Synopsis)
-		}
+	for _, d := range engine.OfferedDescriptions() {
+		fmt.Fprintf(&refactorings, "    %-15s %s\n",
+			d.ShortName, d.Synopsis)
 	}
 	usageFields.Refactorings = refactorings.String()
 
@@ -123,13 +129,35 @@ type CLIFlags struct {
 	*flag.FlagSet
 	fileFlag        *string
 	posFlag         *string
+	declFlag        *string
 	scopeFlag       *string
+	scopeFromFlag   *string
+	scopeInclFlag   *string
+	scopeExclFlag   *string
+	buildFlag       *string
+	tagsFlag        *string
+	sidecarFlag     *string
+	licenseFlag     *string
+	templatesFlag   *string
+	postProcessFlag *string
 	completeFlag    *bool
+	summaryFlag     *bool
+	diffAlgoFlag    *string
+	saveFlag        *string
 	writeFlag       *bool
+	gitCommitFlag   *string
+	threadsFlag     *int
+	safeFlag        *bool
 	verboseFlag     *bool
 	veryVerboseFlag *bool
+	noProgressFlag  *bool
 	listFlag        *bool
+	formatFlag      *string
+	experimentFlag  *bool
+	repeatFlag      *bool
 	jsonFlag        *bool
+	debugAddrFlag   *string
+	archiveFlag     *string
 	docFlag         *string
 }
 
@@ -141,20 +169,64 @@ func Flags() *CLIFlags {
 		"Filename containing an element to refactor (default: stdin)")
 	flags.posFlag = flags.String("pos", "1,1:1,1",
 		"Position of a syntax element to refactor (default: entire file)")
+	flags.declFlag = flags.String("decl", "",
+		"Name of a declaration to refactor (Func, Type.Method, pkg.Func)")
 	flags.scopeFlag = flags.String("scope", "",
 		"Package name(s), or source file containing a program entrypoint")
+	flags.scopeFromFlag = flags.String("scopefrom", "",
+		"Determine scope using \"bazel\" query or a JSON file of source roots")
+	flags.scopeInclFlag = flags.String("scope-include", "",
+		"Only load scope packages with these import path prefixes (a,b,c)")
+	flags.scopeExclFlag = flags.String("scope-exclude", "",
+		"Do not load scope packages with these import path prefixes (a,b,c)")
+	flags.buildFlag = flags.String("build", "",
+		"Refactor under these GOOS/GOARCH configurations (linux,windows/386)")
+	flags.tagsFlag = flags.String("tags", "",
+		"Build tags to satisfy when loading the program (a,b,c)")
+	flags.sidecarFlag = flags.String("sidecar", "",
+		"JSON file listing non-Go files with references to rename")
+	flags.licenseFlag = flags.String("license-header", "",
+		"File containing the license header for newly-created files")
+	flags.templatesFlag = flags.String("templates", "",
+		"File defining templates for generated code (doc comments, etc.)")
+	flags.postProcessFlag = flags.String("postprocess", "",
+		"JSON file listing post-processors to apply to edited files")
 	flags.completeFlag = flags.Bool("complete", false,
 		"Output entire modified source files instead of displaying a diff")
+	flags.summaryFlag = flags.Bool("summary", false,
+		"List affected files with edit and line counts instead of a diff")
+	flags.diffAlgoFlag = flags.String("diff-algo", "patience",
+		"Algorithm for matching lines in diffs (patience, histogram, myers)")
+	flags.saveFlag = flags.String("save", "",
+		"Save edits to a file for \"apply\" instead of displaying a diff")
 	flags.writeFlag = flags.Bool("w", false,
 		"Modify source files on disk (write) instead of displaying a diff")
+	flags.gitCommitFlag = flags.String("git-commit", "",
+		"With -w, commit the modified files with this message using git")
+	flags.threadsFlag = flags.Int("threads", 0,
+		"Maximum number of files to process concurrently (default: CPUs)")
+	flags.safeFlag = flags.Bool("safe", false,
+		"Output or apply changes only if the refactoring is Safe (else exit 4)")
 	flags.verboseFlag = flags.Bool("v", false,
-		"Verbose: list affected files")
+		"Verbose: list affected files and every repeated diagnostic")
 	flags.veryVerboseFlag = flags.Bool("vv", false,
 		"Very verbose: list individual edits (implies -v)")
+	flags.noProgressFlag = flags.Bool("no-progress", false,
+		"Do not report progress (to stderr) while loading packages")
 	flags.listFlag = flags.Bool("list", false,
 		"List all refactorings and exit")
+	flags.formatFlag = flags.String("format", "table",
+		"With -list, output format (table or json)")
+	flags.experimentFlag = flags.Bool("experimental", false,
+		"Offer Testing- and Development-quality refactorings")
+	flags.repeatFlag = flags.Bool("repeat", false,
+		"Repeat the most recent refactoring with the same arguments")
 	flags.jsonFlag = flags.Bool("json", false,
 		"Accept commands in OpenRefactory JSON protocol format")
+	flags.debugAddrFlag = flags.String("debug-addr", "",
+		"With -json, serve metrics and pprof on this localhost address")
+	flags.archiveFlag = flags.String("archive", "",
+		"Refactor the files in this txtar archive; output a new archive")
 	flags.docFlag = flags.String("doc", "",
 		"Output documentation (install, user, man, or vim) and exit")
 	return &flags
@@ -172,7 +244,9 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 	flags.Usage = func() {}
 	flags.Init(cmdName, flag.ContinueOnError)
 	flags.SetOutput(stderr)
-	if err := flags.Parse(args[1:]); err != nil {
+	err := flags.Parse(args[1:])
+	engine.SetExperimental(*flags.experimentFlag)
+	if err != nil {
 		// (err has already been printed)
 		if err == flag.ErrHelp {
 			// Invoked as "godoctor [flags] -help"
@@ -209,6 +283,11 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 	}
 
 	if *flags.listFlag {
+		if *flags.formatFlag != "table" && *flags.formatFlag != "json" {
+			fmt.Fprintln(stderr, "Error: The -format flag must be "+
+				"\"table\" or \"json\"")
+			return 1
+		}
 		if len(args) > 0 {
 			fmt.Fprintln(stderr, "Error: The -list flag "+
 				"cannot be used with any arguments")
@@ -216,33 +295,63 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		}
 		if *flags.verboseFlag || *flags.veryVerboseFlag ||
 			*flags.writeFlag || *flags.completeFlag ||
-			*flags.jsonFlag {
+			*flags.summaryFlag || *flags.jsonFlag {
 			fmt.Fprintln(stderr, "Error: The -list flag "+
 				"cannot be used with the -v, -vv, -w, "+
-				"-complete, or -json flags")
+				"-complete, -summary, or -json flags")
 			return 1
 		}
-		// Invoked: godoctor [-file=""] [-pos=""] [-scope=""] -list
-		fmt.Fprintf(stderr, "%-15s\t%-47s\t%s\n",
-			"Refactoring", "Description", "     Multifile?")
-		fmt.Fprintf(stderr, "--------------------------------------------------------------------------------\n")
-		for _, key := range engine.AllRefactoringNames() {
-			r := engine.GetRefactoring(key)
-			d := r.Description()
-			if !r.Description().Hidden {
-				fmt.Fprintf(stderr, "%-15s\t%-50s\t%v\n",
-					key, d.Synopsis, d.Multifile)
+		if *flags.formatFlag == "json" {
+			// Invoked: godoctor -list -format=json
+			if err := writeListJSON(stdout, engine.OfferedDescriptions()); err != nil {
+				fmt.Fprintf(stderr, "Error: %s\n", err)
+				return 1
 			}
+			return 0
 		}
+		// Invoked: godoctor [-file=""] [-pos=""] [-scope=""] -list
+		writeListTable(stderr, engine.OfferedDescriptions())
 		return 0
 	}
 
+	if *flags.formatFlag != "table" {
+		fmt.Fprintln(stderr, "Error: The -format flag cannot be "+
+			"used without the -list flag")
+		return 1
+	}
+
+	if *flags.debugAddrFlag != "" && !*flags.jsonFlag {
+		fmt.Fprintln(stderr, "Error: The -debug-addr flag cannot be "+
+			"used without the -json flag")
+		return 1
+	}
+
 	if *flags.jsonFlag {
-		if flags.NFlag() != 1 {
+		allowed := 1
+		if *flags.experimentFlag {
+			allowed++
+		}
+		if *flags.debugAddrFlag != "" {
+			allowed++
+		}
+		if flags.NFlag() != allowed {
 			fmt.Fprintln(stderr, "Error: The -json flag "+
-				"cannot be used with any other flags")
+				"cannot be used with any other flags "+
+				"except -experimental and -debug-addr")
 			return 1
 		}
+		if *flags.debugAddrFlag != "" {
+			// Invoked as "godoctor -json -debug-addr=localhost:6060"
+			listener, err := protocol.ServeDebug(*flags.debugAddrFlag)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %s\n", err)
+				return 1
+			}
+			defer listener.Close()
+			fmt.Fprintf(stderr, "Serving metrics at http://%s/debug/vars "+
+				"and profiles at http://%s/debug/pprof/\n",
+				listener.Addr(), listener.Addr())
+		}
 		// Invoked as "godoctor -json [args]
 		protocol.Run(os.Stdout, aboutText, args)
 		return 0
@@ -254,14 +363,149 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		return 1
 	}
 
+	if *flags.summaryFlag && (*flags.writeFlag || *flags.completeFlag) {
+		fmt.Fprintln(stderr, "Error: The -summary flag cannot be "+
+			"used with the -w or -complete flags")
+		return 1
+	}
+
+	if *flags.gitCommitFlag != "" && !*flags.writeFlag {
+		fmt.Fprintln(stderr, "Error: The -git-commit flag cannot be "+
+			"used without the -w flag")
+		return 1
+	}
+
+	if *flags.gitCommitFlag != "" &&
+		(*flags.fileFlag == "" && *flags.declFlag == "" ||
+			*flags.fileFlag == "-") {
+		fmt.Fprintln(stderr, "Error: The -git-commit flag cannot be "+
+			"used when source code is given on standard input")
+		return 1
+	}
+
+	if *flags.threadsFlag < 0 {
+		fmt.Fprintln(stderr, "Error: The -threads flag cannot be "+
+			"negative")
+		return 1
+	}
+	engine.SetThreads(*flags.threadsFlag)
+
+	diffAlgo, ok := text.ParseDiffAlgorithm(*flags.diffAlgoFlag)
+	if !ok {
+		fmt.Fprintf(stderr, "Error: The -diff-algo flag cannot be "+
+			"\"%s\" (use patience, histogram, or myers)\n",
+			*flags.diffAlgoFlag)
+		return 1
+	}
+
+	if *flags.declFlag != "" {
+		posGiven := false
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "pos" {
+				posGiven = true
+			}
+		})
+		if posGiven {
+			fmt.Fprintln(stderr, "Error: The -pos and -decl "+
+				"flags cannot both be present")
+			return 1
+		}
+		if *flags.fileFlag == "" && *flags.scopeFlag == "" &&
+			*flags.scopeFromFlag == "" {
+			fmt.Fprintln(stderr, "Error: The -decl flag requires "+
+				"either -file or -scope (or -scopefrom)")
+			return 1
+		}
+	}
+
+	if *flags.scopeFlag != "" && *flags.scopeFromFlag != "" {
+		fmt.Fprintln(stderr, "Error: The -scope and -scopefrom "+
+			"flags cannot both be present")
+		return 1
+	}
+
+	if *flags.saveFlag != "" &&
+		(*flags.writeFlag || *flags.completeFlag || *flags.summaryFlag) {
+		fmt.Fprintln(stderr, "Error: The -save flag cannot be "+
+			"used with the -w, -complete, or -summary flags")
+		return 1
+	}
+
+	if *flags.archiveFlag != "" {
+		if *flags.writeFlag || *flags.completeFlag ||
+			*flags.summaryFlag || *flags.saveFlag != "" {
+			fmt.Fprintln(stderr, "Error: The -archive flag cannot "+
+				"be used with the -w, -complete, -summary, or "+
+				"-save flags")
+			return 1
+		}
+		if (*flags.fileFlag == "" || *flags.fileFlag == "-") &&
+			*flags.declFlag == "" {
+			fmt.Fprintln(stderr, "Error: The -archive flag cannot "+
+				"be used without the -file or -decl flag")
+			return 1
+		}
+	}
+
 	if len(args) > 0 && args[0] == "help" {
 		// Invoked as "godoctor [flags] help"
 		printHelp(cmdName, aboutText, flags.FlagSet, stderr)
 		return 2
 	}
 
+	if len(args) > 0 && args[0] == "apply" &&
+		engine.GetRefactoring("apply") == nil {
+		// Invoked as "godoctor [-v] apply <file>"
+		if len(args) != 2 {
+			fmt.Fprintf(stderr, "Usage: %s apply <file>\n", cmdName)
+			return 2
+		}
+		if flags.NFlag() > 1 || flags.NFlag() == 1 && !*flags.verboseFlag {
+			fmt.Fprintln(stderr, "Error: apply cannot be used "+
+				"with any flags other than -v")
+			return 1
+		}
+		err := applySavedEdits(args[1], filesystem.NewLocalFileSystem(),
+			stderr, *flags.verboseFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if len(args) > 0 && args[0] == "audit" &&
+		engine.GetRefactoring("audit") == nil {
+		// Invoked as "godoctor audit [<flag> ...] [<package> ...]"
+		if flags.NFlag() > 0 {
+			fmt.Fprintf(stderr, "Error: Flags for audit must follow "+
+				"the word audit (run '%s audit -help')\n", cmdName)
+			return 1
+		}
+		return runAudit(cmdName, args[1:], stdout, stderr)
+	}
+
 	var refacName string
-	if len(engine.AllRefactoringNames()) == 1 {
+	if *flags.repeatFlag {
+		if len(args) > 0 {
+			fmt.Fprintln(stderr, "Error: The -repeat flag cannot "+
+				"be used with a refactoring name or arguments")
+			return 1
+		}
+		history, err := engine.ReadHistory()
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+		if len(history) == 0 {
+			fmt.Fprintln(stderr, "Error: There is no refactoring "+
+				"in the history to repeat")
+			return 1
+		}
+		// Invoked as "godoctor [flags] -repeat"
+		refacName = history[0].Refactoring
+		args = history[0].Args
+	} else if len(engine.AllRefactoringNames()) == 1 {
 		refacName = engine.AllRefactoringNames()[0]
 	} else {
 		if len(args) == 0 {
@@ -290,6 +534,34 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		return 2
 	}
 
+	// Arguments may be given by name (e.g., --new-name=foo)
+	args, err = positionalArgs(args, refac.Description())
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s.\n", err)
+		return 1
+	}
+
+	var archive *txtar.Archive
+	var archiveDir string
+	if *flags.archiveFlag != "" {
+		// Invoked as "godoctor -archive in.txtar [flags] refactoring
+		// [args]"; file names (e.g., in -file and -scope) are relative
+		// to the root of the archive
+		archive, archiveDir, err = extractArchive(*flags.archiveFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+		defer os.RemoveAll(archiveDir)
+		if cwd, err := os.Getwd(); err == nil {
+			defer os.Chdir(cwd)
+		}
+		if err := os.Chdir(archiveDir); err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+	}
+
 	stdinPath := ""
 
 	var fileName string
@@ -297,6 +569,9 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 	if *flags.fileFlag != "" && *flags.fileFlag != "-" {
 		fileName = *flags.fileFlag
 		fileSystem = &filesystem.LocalFileSystem{}
+	} else if *flags.fileFlag == "" && *flags.declFlag != "" {
+		// The declaration is found in the scope, not standard input
+		fileSystem = &filesystem.LocalFileSystem{}
 	} else {
 		// Filename is - or no filename given; read from standard input
 		var err error
@@ -322,12 +597,34 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		}
 	}
 
-	selection, err := text.NewSelection(fileName, *flags.posFlag)
+	var selection text.Selection
+	if *flags.declFlag != "" {
+		selection = &refactoring.DeclSelection{
+			Filename: fileName,
+			Name:     *flags.declFlag,
+		}
+	} else {
+		selection, err = text.NewSelection(fileName, *flags.posFlag)
+	}
 	if err != nil {
 		fmt.Fprintf(stderr, "Error: %s.\n", err)
 		return 1
 	}
 
+	var scopeProvider refactoring.ScopeProvider
+	if *flags.scopeFromFlag != "" {
+		if *flags.scopeFromFlag == "bazel" {
+			scopeProvider = &refactoring.BazelScopeProvider{}
+		} else {
+			scopeProvider, err = refactoring.NewJSONScopeProvider(
+				*flags.scopeFromFlag)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %s.\n", err)
+				return 1
+			}
+		}
+	}
+
 	var scope []string
 	if *flags.scopeFlag == "" {
 		// If no scope provided, let refactoring.go guess the scope
@@ -340,6 +637,63 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		scope = strings.Split(*flags.scopeFlag, ",")
 	}
 
+	var scopeInclude, scopeExclude []string
+	if *flags.scopeInclFlag != "" {
+		scopeInclude = strings.Split(*flags.scopeInclFlag, ",")
+	}
+	if *flags.scopeExclFlag != "" {
+		scopeExclude = strings.Split(*flags.scopeExclFlag, ",")
+	}
+
+	var tags []string
+	if *flags.tagsFlag != "" {
+		tags = strings.Split(*flags.tagsFlag, ",")
+	}
+	builds, err := refactoring.ParseBuildConfigs(*flags.buildFlag, tags)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %s.\n", err)
+		return 1
+	}
+
+	var sidecarScanners []refactoring.SidecarScanner
+	if *flags.sidecarFlag != "" {
+		sidecarScanners, err = refactoring.ReadSidecarScanners(
+			*flags.sidecarFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+	}
+
+	licenseHeader := ""
+	if *flags.licenseFlag != "" {
+		contents, err := ioutil.ReadFile(*flags.licenseFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+		licenseHeader = string(contents)
+	}
+
+	var templates refactoring.CodeTemplates
+	if *flags.templatesFlag != "" {
+		templates, err = refactoring.ReadCodeTemplates(*flags.templatesFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+	}
+
+	var postProcessors []refactoring.PostProcessor
+	if *flags.postProcessFlag != "" {
+		postProcessors, err = refactoring.ReadPostProcessors(
+			*flags.postProcessFlag)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+	}
+
 	verbosity := 0
 	if *flags.verboseFlag {
 		verbosity = 1
@@ -348,12 +702,35 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		verbosity = 2
 	}
 
-	result := refac.Run(&refactoring.Config{
-		FileSystem: fileSystem,
-		Scope:      scope,
-		Selection:  selection,
-		Args:       refactoring.InterpretArgs(args, refac),
-		Verbosity:  verbosity})
+	var progress func(done, total int)
+	if !*flags.noProgressFlag {
+		progress = newProgressReporter(stderr).report
+	}
+
+	// Files modified after this time may have changed after they were
+	// analyzed, so they are not overwritten (see writeToDisk)
+	analyzed := time.Now()
+
+	// With -build, the refactoring is run once for each configuration, and
+	// the results are merged
+	result := refactoring.RunInConfigurations(refac, &refactoring.Config{
+		FileSystem:      fileSystem,
+		Scope:           scope,
+		ScopeProvider:   scopeProvider,
+		ScopeInclude:    scopeInclude,
+		ScopeExclude:    scopeExclude,
+		SidecarScanners: sidecarScanners,
+		LicenseHeader:   licenseHeader,
+		Templates:       templates,
+		PostProcessors:  postProcessors,
+		Selection:       selection,
+		Args:            refactoring.InterpretArgs(args, refac),
+		Verbosity:       verbosity,
+		Progress:        progress}, builds)
+	engine.ProtectFiles(result, fileSystem, builds...)
+	if verbosity == 0 {
+		result.Log.Aggregate(refactoring.MaxAggregatePositions)
+	}
 
 	// Display log in GNU-style 'file:line.col-line.col: message' format
 	cwd, err := os.Getwd()
@@ -365,12 +742,32 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 	// If input was supplied on standard input, ensure that the refactoring
 	// makes changes only to that code (and does not affect any other files)
 	if stdinPath != "" {
-		for f := range result.Edits {
-			if f != stdinPath {
+		for _, f := range engine.SortedFilenames(result.Edits) {
+			if !filesystem.IsFakeStdinPath(f) {
 				fmt.Fprintf(stderr, "Error: When source code is given on standard input, refactorings are prohibited from changing any other files.  This refactoring would require modifying %s.\n", f)
 				return 1
 			}
 		}
+		for _, change := range result.FSChanges {
+			fmt.Fprintf(stderr, "Error: When source code is given on standard input, refactorings are prohibited from changing any other files.  This refactoring would require the following change: %s.\n", change.String(cwd))
+			return 1
+		}
+	}
+
+	// With -safe, changes that may not preserve behavior are not output
+	// or applied, so automated tools can queue them for review
+	safety := result.Safety()
+	if verbosity > 0 {
+		fmt.Fprintf(stderr, "Safety level: %s\n", safety)
+		fmt.Fprint(stderr, refactoring.APIReport(result.APIChanges))
+	}
+	if *flags.safeFlag && safety != refactoring.Safe {
+		fmt.Fprintf(stderr, "The refactoring's safety level is %s, "+
+			"so its changes were not output (-safe).\n", safety)
+		if result.Log.ContainsErrors() {
+			return 3
+		}
+		return 4
 	}
 
 	debugOutput := result.DebugOutput.String()
@@ -378,12 +775,21 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 		fmt.Fprintln(stdout, debugOutput)
 	}
 
-	if *flags.writeFlag {
-		err = writeToDisk(result, fileSystem)
+	if archive != nil {
+		err = writeArchive(stdout, archive, archiveDir, result, fileSystem)
+	} else if *flags.writeFlag {
+		err = writeToDisk(result, fileSystem, analyzed)
 	} else if *flags.completeFlag {
-		err = writeFileContents(stdout, result.Edits, fileSystem)
+		err = writeFileContents(stdout, result, fileSystem)
+	} else if *flags.summaryFlag {
+		err = writeSummary(stdout, result, fileSystem, diffAlgo)
+	} else if *flags.saveFlag != "" && len(result.FSChanges) > 0 {
+		err = fmt.Errorf("This refactoring creates files, so its " +
+			"changes cannot be saved; use -w to apply them")
+	} else if *flags.saveFlag != "" {
+		err = saveEdits(*flags.saveFlag, result.Edits, fileSystem)
 	} else {
-		err = writeDiff(stdout, result.Edits, fileSystem)
+		err = writeDiff(stdout, result, fileSystem, diffAlgo)
 	}
 	if err != nil {
 		fmt.Fprintf(stderr, "Error: %s.\n", err)
@@ -391,26 +797,46 @@ func Run(aboutText string, stdin io.Reader, stdout io.Writer, stderr io.Writer,
 	}
 
 	if result.Log.ContainsErrors() {
+		if *flags.gitCommitFlag != "" {
+			fmt.Fprintln(stderr, "No commit was created, since the "+
+				"refactoring produced errors.")
+		}
 		return 3
-	} else {
-		return 0
 	}
-}
 
-// writeDiff outputs a multi-file unified diff describing this refactoring's
-// changes.  It can be applied using GNU patch.
-func writeDiff(out io.Writer, edits map[string]*text.EditSet, fs filesystem.FileSystem) error {
-	for f, e := range edits {
-		p, err := filesystem.CreatePatch(e, fs, f)
+	if *flags.gitCommitFlag != "" {
+		err := commitChanges(*flags.gitCommitFlag, refacName, args, result)
 		if err != nil {
-			return err
+			fmt.Fprintf(stderr, "Error: %s.\n", err)
+			return 1
+		}
+	}
+
+	// Record the refactoring so it can be repeated with -repeat
+	if !refac.Description().Hidden {
+		if err := engine.AddToHistory(refacName, args); err != nil &&
+			verbosity > 0 {
+			fmt.Fprintf(stderr, "Warning: Unable to record "+
+				"refactoring history: %s\n", err)
 		}
+	}
+	return 0
+}
 
-		if !p.IsEmpty() {
+// writeDiff outputs a multi-file unified diff describing this refactoring's
+// changes, using the given algorithm to match lines within each hunk.  It can
+// be applied using GNU patch.  Files are listed in sorted order, so the output
+// is the same regardless of how many threads are used.
+func writeDiff(out io.Writer, result *refactoring.Result, fs filesystem.FileSystem, algo text.DiffAlgorithm) error {
+	filenames, patches, err := createPatches(result.Edits, fs, algo)
+	if err != nil {
+		return err
+	}
+	for i, f := range filenames {
+		if p := patches[i]; !p.IsEmpty() {
 			inFile := f
 			outFile := f
-			stdinPath, _ := filesystem.FakeStdinPath()
-			if f == stdinPath {
+			if filesystem.IsFakeStdinPath(f) {
 				inFile = os.Stdin.Name()
 				outFile = os.Stdout.Name()
 			} else {
@@ -422,75 +848,194 @@ func writeDiff(out io.Writer, edits map[string]*text.EditSet, fs filesystem.File
 			p.Write(inFile, outFile, time.Time{}, time.Time{}, out)
 		}
 	}
+	for _, change := range result.FSChanges {
+		if c, ok := change.(*filesystem.CreateFile); ok {
+			p, err := newFilePatch(c)
+			if err != nil {
+				return err
+			}
+			outFile := relativePath(c.Path)
+			fmt.Fprintf(out, "diff -u %s %s\n", os.DevNull, outFile)
+			p.Write(os.DevNull, outFile, time.Time{}, time.Time{}, out)
+		}
+	}
+	return nil
+}
+
+// createPatches creates a patch for each file in edits, processing up to
+// engine.Threads() files concurrently.  It returns the filenames, sorted, and
+// the corresponding patches, which use the given diff algorithm.  If any patch
+// cannot be created, the error for the first such file (in sorted order) is
+// returned.
+func createPatches(edits map[string]*text.EditSet, fs filesystem.FileSystem, algo text.DiffAlgorithm) ([]string, []*text.Patch, error) {
+	filenames := engine.SortedFilenames(edits)
+	patches := make([]*text.Patch, len(filenames))
+	errs := make([]error, len(filenames))
+	engine.ForEachFile(filenames, func(i int, f string) {
+		patches[i], errs[i] = filesystem.CreatePatch(edits[f], fs, f)
+		if errs[i] == nil {
+			patches[i].SetDiffAlgorithm(algo)
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return filenames, patches, nil
+}
+
+// newFilePatch returns a patch that creates the given file.
+func newFilePatch(c *filesystem.CreateFile) (*text.Patch, error) {
+	es := text.NewEditSet()
+	es.Add(&text.Extent{Offset: 0, Length: 0}, c.Contents)
+	return es.CreatePatch(strings.NewReader(""))
+}
+
+// writeSummary outputs one line for each file affected by this refactoring,
+// listing the number of edits made to that file and the number of lines that
+// will be added and removed (as they would be counted in a unified diff
+// written using the given algorithm).
+func writeSummary(out io.Writer, result *refactoring.Result, fs filesystem.FileSystem, algo text.DiffAlgorithm) error {
+	filenames, patches, err := createPatches(result.Edits, fs, algo)
+	if err != nil {
+		return err
+	}
+	for i, f := range filenames {
+		if p := patches[i]; !p.IsEmpty() {
+			added, removed, err := p.Stats()
+			if err != nil {
+				return err
+			}
+			name := f
+			if filesystem.IsFakeStdinPath(f) {
+				name = os.Stdin.Name()
+			} else {
+				name = relativePath(f)
+			}
+			fmt.Fprintf(out, "%s: %d edit(s), +%d -%d\n",
+				name, result.Edits[f].Len(), added, removed)
+		}
+	}
+	for _, change := range result.FSChanges {
+		if c, ok := change.(*filesystem.CreateFile); ok {
+			p, err := newFilePatch(c)
+			if err != nil {
+				return err
+			}
+			added, _, err := p.Stats()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%s: created, +%d\n",
+				relativePath(c.Path), added)
+		}
+	}
 	return nil
 }
 
 // relativePath returns a relative path to fname, or fname if a relative path
-// cannot be computed due to an error
+// cannot be computed due to an error (e.g., if fname is on a different
+// Windows volume).  Since the result is displayed in patch headers, it always
+// uses forward slashes as separators.
 func relativePath(fname string) string {
 	if cwd, err := os.Getwd(); err == nil {
 		if rel, err := filepath.Rel(cwd, fname); err == nil {
-			return rel
+			return filepath.ToSlash(rel)
 		}
 	}
-	return fname
+	return filepath.ToSlash(fname)
 }
 
 // writeFileContents outputs the complete contents of each file affected by
-// this refactoring.
-func writeFileContents(out io.Writer, edits map[string]*text.EditSet, fs filesystem.FileSystem) error {
-	for filename, edits := range edits {
-		data, err := filesystem.ApplyEdits(edits, fs, filename)
+// this refactoring, in sorted order.
+func writeFileContents(out io.Writer, result *refactoring.Result, fs filesystem.FileSystem) error {
+	filenames := engine.SortedFilenames(result.Edits)
+	contents := make([][]byte, len(filenames))
+	errs := make([]error, len(filenames))
+	engine.ForEachFile(filenames, func(i int, f string) {
+		contents[i], errs[i] = filesystem.ApplyEdits(result.Edits[f], fs, f)
+	})
+	for i, filename := range filenames {
+		data, err := contents[i], errs[i]
 		if err != nil {
 			return err
 		}
 
-		stdinPath, _ := filesystem.FakeStdinPath()
-		if filename == stdinPath {
+		if filesystem.IsFakeStdinPath(filename) {
 			filename = os.Stdin.Name()
 		}
 
-		if _, err := fmt.Fprintf(out, "@@@@@ %s @@@@@ %d @@@@@\n",
-			filename, len(data)); err != nil {
+		if err := writeFileContent(out, filename, data); err != nil {
 			return err
 		}
-		n, err := out.Write(data)
-		if n < len(data) && err == nil {
-			err = io.ErrShortWrite
-		}
-		if err != nil {
-			return err
-		}
-		if len(data) > 0 && data[len(data)-1] != '\n' {
-			fmt.Fprintln(out)
+	}
+	for _, change := range result.FSChanges {
+		if c, ok := change.(*filesystem.CreateFile); ok {
+			err := writeFileContent(out, c.Path, []byte(c.Contents))
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
+// writeFileContent outputs the complete contents of a single file, preceded
+// by a header line giving its name and length.
+func writeFileContent(out io.Writer, filename string, data []byte) error {
+	if _, err := fmt.Fprintf(out, "@@@@@ %s @@@@@ %d @@@@@\n",
+		filename, len(data)); err != nil {
+		return err
+	}
+	n, err := out.Write(data)
+	if n < len(data) && err == nil {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
 // writeToDisk overwrites existing files with their refactored versions and
 // applies any other changes to the file system that the refactoring requires
-// (e.g., renaming directories).
-func writeToDisk(result *refactoring.Result, fs filesystem.FileSystem) error {
-	for filename, edits := range result.Edits {
-		data, err := filesystem.ApplyEdits(edits, fs, filename)
-		if err != nil {
-			return err
-		}
+// (e.g., creating files).  Either all of the changes are made, or (if any of
+// them fails) none are.  No changes are made if a file to be overwritten was
+// modified after the given time, when the refactoring began analyzing the
+// program (see checkUnmodified).
+func writeToDisk(result *refactoring.Result, fs filesystem.FileSystem, analyzed time.Time) error {
+	if err := checkUnmodified(engine.SortedFilenames(result.Edits), analyzed); err != nil {
+		return err
+	}
+	return result.Transaction().Apply(fs)
+}
 
-		f, err := fs.OverwriteFile(filename)
-		if err != nil {
-			return err
-		}
-		n, err := f.Write(data)
-		if err == nil && n < len(data) {
-			err = io.ErrShortWrite
-		}
-		if err1 := f.Close(); err == nil {
-			err = err1
+// checkUnmodified returns an error if any of the given files was modified
+// after the given time.  A long-running refactoring may analyze a file before
+// it is changed (e.g., in a text editor), in which case writing its refactored
+// version would discard those changes.  Refactorings record the contents of
+// some of the files they change, so that the edits are refused if those files
+// change (see text.EditSet.SetBase), but they do not record every file they
+// change (e.g., every file referring to a renamed identifier), so the files'
+// modification times are checked as well.
+func checkUnmodified(filenames []string, analyzed time.Time) error {
+	for _, filename := range filenames {
+		if filesystem.IsFakeStdinPath(filename) {
+			continue
 		}
+		info, err := os.Stat(filename)
 		if err != nil {
-			return err
+			continue // Reported when the edits are applied
+		}
+		if info.ModTime().After(analyzed) {
+			return fmt.Errorf("%s was modified while the refactoring "+
+				"was running, so no files were changed; run the "+
+				"refactoring again to refactor the modified file",
+				relativePath(filename))
 		}
 	}
 	return nil
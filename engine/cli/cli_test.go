@@ -7,7 +7,10 @@ package cli_test
 import (
 	"bytes"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -37,7 +40,9 @@ func main() {
  func main() {
 -	fmt.Println(こんにちはmsg)
 +	fmt.Println(renamedネーム)
- }`
+ }
+\ No newline at end of file
+`
 
 	complete = `@@@@@ /dev/stdin @@@@@ 119 @@@@@
 package main
@@ -49,6 +54,20 @@ func main() {
 `
 )
 
+// TestMain directs the refactoring history to a temporary file, so running
+// the tests does not affect the user's history.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv(engine.HistoryEnvVar, filepath.Join(dir, "history.json"))
+	exit := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(exit)
+}
+
 func addRefactoringsAndRunCLI(addRefactorings func(), stdin string, args ...string) (exit int, stdout string, stderr string) {
 	args = append(args, "godoctor")
 	copy(args[1:], args[0:len(args)-1])
@@ -67,7 +86,7 @@ func addRefactoringsAndRunCLI(addRefactorings func(), stdin string, args ...stri
 }
 
 func runCLI(stdin string, args ...string) (exit int, stdout string, stderr string) {
-	return addRefactoringsAndRunCLI(engine.AddDefaultRefactorings, stdin, args...)
+	return addRefactoringsAndRunCLI(func() { engine.AddDefaultRefactorings() }, stdin, args...)
 }
 
 func TestNoArgsNoInput(t *testing.T) {
@@ -140,6 +159,7 @@ func TestInvalidCombos(t *testing.T) {
 		{"-complete", "-list"},
 		{"-complete", "-doc=man"},
 		{"-complete", "-w"},
+		{"-complete", "-summary"},
 		{"-file=-", "-json"},
 		{"-file=-", "-doc=man"},
 		{"-json", "-list"},
@@ -148,15 +168,34 @@ func TestInvalidCombos(t *testing.T) {
 		{"-json", "-scope=golang.org/x/tools"},
 		{"-json", "-v"},
 		{"-json", "-w"},
+		{"-json", "-experimental", "-v"},
+		{"-json", "-debug-addr=0.0.0.0:0"},
+		{"-debug-addr=localhost:0"},
 		{"-list", "-doc=man"},
 		{"-list", "-v"},
 		{"-list", "-w"},
 		{"-list", "somearg"},
+		{"-list", "-summary"},
+		{"-format=json"},
+		{"-format=json", "-complete"},
 		{"-doc=man", "-pos=1,1:1,1"},
 		{"-doc=man", "-scope=golang.org/x/tools"},
 		{"-doc=man", "-v"},
 		{"-doc=man", "-w"},
 		{"-doc=man", "somearg"},
+		{"-summary", "-w"},
+		{"-save=edits.json", "-w"},
+		{"-save=edits.json", "-summary"},
+		{"-scope=golang.org/x/tools", "-scopefrom=bazel"},
+		{"-w", "apply", "edits.json"},
+		{"-git-commit=Refactor"},
+		{"-git-commit=Refactor", "-complete"},
+		{"-git-commit=Refactor", "-file=-", "-w"},
+		{"-threads=-1"},
+		{"-diff-algo=lcs"},
+		{"-archive=in.txtar", "-file=main.go", "-w"},
+		{"-archive=in.txtar", "-file=main.go", "-complete"},
+		{"-archive=in.txtar"},
 	}
 	for _, flags := range invalid {
 		exit, stdout, stderr := runCLI("", flags...)
@@ -222,6 +261,44 @@ func TestRenameComplete(t *testing.T) {
 	}
 }
 
+func TestRenameSummary(t *testing.T) {
+	exit, stdout, stderr := runCLI(hello, "-scope=-", pos, "-summary", "rename", "renamedネーム")
+	if exit != 0 {
+		t.Fatalf("Rename expected exit code 0; got %d", exit)
+	}
+	if stdout != "/dev/stdin: 2 edit(s), +2 -2\n" {
+		t.Fatalf("Output did not match expected summary:\n%s\n%s",
+			stdout, stderr)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	exit, _, _ := runCLI(hello, "-scope=-", pos, "rename", "renamedネーム")
+	if exit != 0 {
+		t.Fatalf("Rename expected exit code 0; got %d", exit)
+	}
+	exit, stdout, stderr := runCLI(hello, "-scope=-", pos, "-repeat")
+	if exit != 0 {
+		t.Fatalf("Repeat expected exit code 0; got %d\n%s", exit, stderr)
+	}
+	if stdout != diff {
+		t.Fatalf("Repeated rename did not produce expected diff:\n%s",
+			stdout)
+	}
+
+	exit, _, stderr = runCLI(hello, "-repeat", "rename", "x")
+	if exit != 1 || !strings.Contains(stderr, "-repeat") {
+		t.Fatal("-repeat with a refactoring name should have failed")
+	}
+}
+
+func TestApplyUsage(t *testing.T) {
+	exit, _, stderr := runCLI("", "apply")
+	if exit != 2 || !strings.Contains(stderr, "Usage: godoctor apply") {
+		t.Fatal("\"godoctor apply\" expected usage info with exit 2")
+	}
+}
+
 func TestRenameInvalidPos(t *testing.T) {
 	exit, stdout, stderr := runCLI(hello, "-pos=1000,", "rename", "x")
 	if exit != 1 || stderr == "" {
@@ -348,3 +425,43 @@ func TestOneRefactoringOneParam(t *testing.T) {
 		t.Fatal("One refactoring with one arg, no input expected exit 0")
 	}
 }
+
+type customWarning struct{}
+
+func (*customWarning) Description() *refactoring.Description {
+	return &refactoring.Description{
+		Name:   "Test",
+		Params: nil,
+		Hidden: false,
+	}
+}
+
+func (*customWarning) Run(config *refactoring.Config) *refactoring.Result {
+	log := refactoring.NewLog()
+	log.Warn("Assumption")
+	return &refactoring.Result{
+		Log:   log,
+		Edits: map[string]*text.EditSet{},
+	}
+}
+
+func TestSafe(t *testing.T) {
+	addNoParams := func() { engine.AddRefactoring("custom", &customNoParams{}) }
+	exit, _, stderr := addRefactoringsAndRunCLI(addNoParams, "", "-file=-", "-safe", "-v")
+	if exit != 0 || !strings.Contains(stderr, "Safety level: Safe") {
+		t.Fatalf("Safe refactoring with -safe expected exit 0; got %d\n%s",
+			exit, stderr)
+	}
+
+	addWarning := func() { engine.AddRefactoring("custom", &customWarning{}) }
+	exit, _, _ = addRefactoringsAndRunCLI(addWarning, "", "-file=-")
+	if exit != 0 {
+		t.Fatalf("Refactoring with warning expected exit 0; got %d", exit)
+	}
+	exit, stdout, stderr := addRefactoringsAndRunCLI(addWarning, "", "-file=-", "-safe")
+	if exit != 4 || stdout != "" ||
+		!strings.Contains(stderr, "BehaviorPreservingUnderAssumptions") {
+		t.Fatalf("Refactoring with warning and -safe expected exit 4; got %d\n%s",
+			exit, stderr)
+	}
+}
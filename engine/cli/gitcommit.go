@@ -0,0 +1,105 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements "godoctor -w -git-commit <message>", which commits
+// the files that a refactoring modified after they are written to disk.  The
+// refactoring and its arguments are recorded in trailers at the end of the
+// commit message, so automated changes can be traced.
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+)
+
+// commitChanges stages exactly the files that the given result modified or
+// created and commits them (and no other staged changes) using git.
+func commitChanges(message, refacName string, args []string, result *refactoring.Result) error {
+	files := changedFiles(result)
+	if len(files) == 0 {
+		return fmt.Errorf("The refactoring did not change any files, " +
+			"so no commit was created")
+	}
+	dir := filepath.Dir(files[0])
+	if err := runGit(dir, "", append([]string{"add", "--"}, files...)...); err != nil {
+		return err
+	}
+	commitArgs := append([]string{"commit", "--quiet", "-F", "-", "--"}, files...)
+	return runGit(dir, commitMessage(message, refacName, args), commitArgs...)
+}
+
+// changedFiles returns the absolute paths of the files that the given result
+// modifies or creates, sorted.
+func changedFiles(result *refactoring.Result) []string {
+	set := map[string]struct{}{}
+	for filename, edits := range result.Edits {
+		if edits.Len() > 0 {
+			set[filename] = struct{}{}
+		}
+	}
+	for _, change := range result.FSChanges {
+		if c, ok := change.(*filesystem.CreateFile); ok {
+			set[c.Path] = struct{}{}
+		}
+	}
+	files := []string{}
+	for filename := range set {
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+		files = append(files, filename)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// commitMessage returns the given message followed by trailers recording the
+// refactoring and its arguments, e.g.,
+//
+//	Godoctor-Refactoring: rename
+//	Godoctor-Args: newName
+func commitMessage(message, refacName string, args []string) string {
+	var buf bytes.Buffer
+	buf.WriteString(strings.TrimRightFunc(message, unicode.IsSpace))
+	buf.WriteString("\n\nGodoctor-Refactoring: " + refacName + "\n")
+	if len(args) > 0 {
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			if arg == "" || strings.IndexFunc(arg, unicode.IsSpace) >= 0 ||
+				!strconv.CanBackquote(arg) {
+				arg = strconv.Quote(arg)
+			}
+			quoted[i] = arg
+		}
+		buf.WriteString("Godoctor-Args: " + strings.Join(quoted, " ") + "\n")
+	}
+	return buf.String()
+}
+
+// runGit runs git with the given arguments in the given directory, providing
+// the given string on standard input.
+func runGit(dir, stdin string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(stdin)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("git %s failed: %s", args[0], msg)
+	}
+	return nil
+}
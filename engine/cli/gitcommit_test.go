@@ -0,0 +1,93 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestCommitChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s\n%s", args[0], err, out)
+		}
+		return string(out)
+	}
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	git("init", "--quiet")
+	git("config", "user.name", "Test")
+	git("config", "user.email", "test@example.com")
+	main := write("main.go", "package main\n")
+	write("other.go", "package main\n")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "Initial commit")
+
+	// other.go is modified and staged, but not by the refactoring, so it
+	// must not be committed
+	write("main.go", "package other\n")
+	write("other.go", "package other\n")
+	git("add", "other.go")
+	created := write("new.go", "package other\n")
+
+	es := text.NewEditSet()
+	es.Add(&text.Extent{8, 4}, "other")
+	result := &refactoring.Result{
+		Edits: map[string]*text.EditSet{main: es},
+		FSChanges: []filesystem.Change{
+			&filesystem.CreateFile{Path: created, Contents: "package other\n"},
+		},
+	}
+	err = commitChanges("Rename package\n", "rename", []string{"other", "a b"}, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := git("show", "--name-only", "--format=", "HEAD")
+	if strings.Fields(files)[0] != "main.go" || strings.Fields(files)[1] != "new.go" ||
+		len(strings.Fields(files)) != 2 {
+		t.Fatalf("Expected main.go and new.go to be committed; got\n%s", files)
+	}
+	msg := git("log", "-1", "--format=%B")
+	expected := "Rename package\n\nGodoctor-Refactoring: rename\nGodoctor-Args: other \"a b\"\n"
+	if !strings.HasPrefix(msg, expected) {
+		t.Fatalf("Expected commit message\n%s\ngot\n%s", expected, msg)
+	}
+	if status := git("status", "--porcelain"); !strings.Contains(status, "M  other.go") {
+		t.Fatalf("other.go should still be staged; status is\n%s", status)
+	}
+
+	err = commitChanges("Nothing", "rename", nil, &refactoring.Result{})
+	if err == nil || !strings.Contains(err.Error(), "did not change any files") {
+		t.Fatalf("Committing an empty result should fail (%v)", err)
+	}
+}
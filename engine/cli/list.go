@@ -0,0 +1,127 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements "godoctor -list", which describes the refactorings
+// offered to the end user (see engine.OfferedDescriptions) either as a table (for people) or in JSON format (so that
+// editor plugins can build their menus and dialogs from a single call).
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/refactoring"
+)
+
+// listEntry is the JSON representation of a refactoring in the output of
+// "godoctor -list -format=json".
+type listEntry struct {
+	ShortName string      `json:"shortName"`
+	Name      string      `json:"name"`
+	Synopsis  string      `json:"synopsis"`
+	Usage     string      `json:"usage"`
+	Quality   string      `json:"quality"`
+	Multifile bool        `json:"multifile"`
+	Params    []listParam `json:"params"`
+}
+
+// listParam is the JSON representation of a refactoring's parameter.
+type listParam struct {
+	Name     string      `json:"name"`
+	Label    string      `json:"label"`
+	Prompt   string      `json:"prompt"`
+	Type     string      `json:"type"`
+	Default  interface{} `json:"default"`
+	Optional bool        `json:"optional"`
+}
+
+// listParams returns the required parameters, followed by the optional
+// parameters, of the given refactoring.
+func listParams(d engine.NamedDescription) []listParam {
+	result := []listParam{}
+	add := func(params []refactoring.Parameter, optional bool) {
+		for _, p := range params {
+			typ := "string"
+			if p.IsBoolean() {
+				typ = "boolean"
+			}
+			result = append(result, listParam{
+				Name:     p.Name(),
+				Label:    p.Label,
+				Prompt:   p.Prompt,
+				Type:     typ,
+				Default:  p.DefaultValue,
+				Optional: optional,
+			})
+		}
+	}
+	add(d.Params, false)
+	add(d.OptionalParams, true)
+	return result
+}
+
+// writeListTable writes a table describing the given refactorings: one row
+// per refactoring giving its short name, synopsis, quality, and whether it
+// may change several files, followed by its usage and parameters.
+func writeListTable(out io.Writer, descs []engine.NamedDescription) {
+	// The rows are aligned first, since the usage and parameter lines
+	// beneath each row would otherwise end the tabwriter's columns
+	var rows bytes.Buffer
+	w := tabwriter.NewWriter(&rows, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(w, "Refactoring\tDescription\tQuality\tMultifile?")
+	fmt.Fprintln(w, "-----------\t-----------\t-------\t----------")
+	for _, d := range descs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\n",
+			d.ShortName, d.Synopsis, d.Quality, d.Multifile)
+	}
+	w.Flush()
+
+	lines := strings.SplitAfter(rows.String(), "\n")
+	fmt.Fprint(out, lines[0], lines[1])
+	for i, d := range descs {
+		fmt.Fprint(out, lines[i+2])
+		fmt.Fprintf(out, "    Usage:  %s\n",
+			strings.TrimSpace(d.ShortName+" "+d.Usage))
+		params := []string{}
+		for _, p := range listParams(d) {
+			desc := p.Type
+			if p.Optional {
+				desc += ", optional"
+			}
+			params = append(params, fmt.Sprintf("%s (--%s, %s)",
+				strings.TrimSuffix(strings.TrimSpace(p.Label), ":"),
+				p.Name, desc))
+		}
+		if len(params) > 0 {
+			fmt.Fprintf(out, "    Params: %s\n", strings.Join(params, "; "))
+		}
+	}
+}
+
+// writeListJSON writes a JSON array describing the given refactorings.
+func writeListJSON(out io.Writer, descs []engine.NamedDescription) error {
+	result := []listEntry{}
+	for _, d := range descs {
+		result = append(result, listEntry{
+			ShortName: d.ShortName,
+			Name:      d.Name,
+			Synopsis:  d.Synopsis,
+			Usage:     d.Usage,
+			Quality:   d.Quality.String(),
+			Multifile: d.Multifile,
+			Params:    listParams(d),
+		})
+	}
+	// Usages contain angle brackets, which should not be escaped
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	return enc.Encode(result)
+}
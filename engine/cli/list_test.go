@@ -0,0 +1,131 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cli_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestListTable(t *testing.T) {
+	exit, stdout, stderr := runCLI("", "-list", "-format=table")
+	if exit != 0 || stdout != "" {
+		t.Fatalf("-list -format=table expected table with exit 0")
+	}
+	for _, expected := range []string{
+		"Quality",
+		"Usage:  rename <new_name>",
+		"Params: New Name (--new-name, string)",
+		"Production",
+	} {
+		if !strings.Contains(stderr, expected) {
+			t.Fatalf("-list output does not contain %q:\n%s",
+				expected, stderr)
+		}
+	}
+	for _, unexpected := range []string{"debug", "globalparam", "Testing"} {
+		if strings.Contains(stderr, unexpected) {
+			t.Fatalf("-list output should not include experimental "+
+				"refactorings without -experimental:\n%s", stderr)
+		}
+	}
+
+	exit, stdout, stderr = runCLI("", "-experimental", "-list")
+	if exit != 0 || stdout != "" {
+		t.Fatalf("-experimental -list expected table with exit 0")
+	}
+	for _, expected := range []string{"debug", "globalparam", "Testing",
+		"Development"} {
+		if !strings.Contains(stderr, expected) {
+			t.Fatalf("-experimental -list output does not contain "+
+				"%q:\n%s", expected, stderr)
+		}
+	}
+
+	// The Quality column lines up, whatever the length of each synopsis
+	column := -1
+	for _, line := range strings.Split(stderr, "\n") {
+		if strings.HasPrefix(line, " ") || !strings.Contains(line, "true") &&
+			!strings.Contains(line, "false") {
+			continue
+		}
+		for _, quality := range []string{"Production", "Testing",
+			"Development"} {
+			if i := strings.Index(line, quality); i >= 0 {
+				if column >= 0 && i != column {
+					t.Fatalf("-list columns are not aligned:\n%s",
+						stderr)
+				}
+				column = i
+			}
+		}
+	}
+	if column < 0 {
+		t.Fatalf("-list output has no rows:\n%s", stderr)
+	}
+}
+
+func TestListJSON(t *testing.T) {
+	exit, stdout, stderr := runCLI("", "-experimental", "-list",
+		"-format=json")
+	if exit != 0 || stderr != "" {
+		t.Fatalf("-list -format=json expected JSON with exit 0: %s",
+			stderr)
+	}
+	var entries []struct {
+		ShortName string
+		Name      string
+		Synopsis  string
+		Usage     string
+		Quality   string
+		Multifile bool
+		Params    []struct {
+			Type     string
+			Optional bool
+		}
+	}
+	if err := json.Unmarshal([]byte(stdout), &entries); err != nil {
+		t.Fatalf("Invalid JSON: %s\n%s", err, stdout)
+	}
+	found := map[string]bool{}
+	for _, e := range entries {
+		found[e.ShortName] = true
+		switch e.ShortName {
+		case "debug":
+			if e.Quality != "Development" {
+				t.Fatalf("Incorrect entry for debug: %+v", e)
+			}
+		case "rename":
+			if e.Name != "Rename" || e.Quality != "Production" ||
+				!e.Multifile || e.Usage == "" || e.Synopsis == "" {
+				t.Fatalf("Incorrect entry for rename: %+v", e)
+			}
+			if len(e.Params) == 0 || e.Params[0].Type != "string" ||
+				e.Params[0].Optional {
+				t.Fatalf("Incorrect params for rename: %+v",
+					e.Params)
+			}
+		case "globalparam":
+			if e.Quality != "Testing" || len(e.Params) != 2 ||
+				!e.Params[1].Optional {
+				t.Fatalf("Incorrect entry for globalparam: %+v", e)
+			}
+		}
+	}
+	for _, shortName := range []string{"rename", "globalparam", "debug"} {
+		if !found[shortName] {
+			t.Fatalf("%s was not listed:\n%s", shortName, stdout)
+		}
+	}
+}
+
+func TestListInvalidFormat(t *testing.T) {
+	exit, stdout, stderr := runCLI("", "-list", "-format=csv")
+	if exit != 1 || stdout != "" ||
+		!strings.Contains(stderr, "-format flag must be") {
+		t.Fatalf("-format=csv should fail and exit 1")
+	}
+}
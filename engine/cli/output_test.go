@@ -0,0 +1,121 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestOutputIsSorted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	result := &refactoring.Result{
+		Log:   refactoring.NewLog(),
+		Edits: map[string]*text.EditSet{},
+	}
+	filenames := []string{}
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file%02d.go", i))
+		if err := ioutil.WriteFile(path, []byte("package p\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result.Edits[path] = text.NewEditSet()
+		result.Edits[path].Add(&text.Extent{8, 1}, "q")
+		filenames = append(filenames, path)
+	}
+
+	fs := filesystem.NewLocalFileSystem()
+	defer engine.SetThreads(0)
+	var expectedDiff, expectedContents string
+	for _, threads := range []int{1, 8} {
+		engine.SetThreads(threads)
+
+		var diff bytes.Buffer
+		if err := writeDiff(&diff, result, fs, text.DiffPatience); err != nil {
+			t.Fatal(err)
+		}
+		var contents bytes.Buffer
+		if err := writeFileContents(&contents, result, fs); err != nil {
+			t.Fatal(err)
+		}
+
+		if threads == 1 {
+			expectedDiff = diff.String()
+			expectedContents = contents.String()
+			last := -1
+			for _, f := range filenames {
+				i := strings.Index(expectedDiff, relativePath(f))
+				if i <= last {
+					t.Fatalf("Diff is not sorted:\n%s", expectedDiff)
+				}
+				last = i
+			}
+		} else if diff.String() != expectedDiff {
+			t.Fatalf("Diff with %d threads differs:\n%s",
+				threads, diff.String())
+		} else if contents.String() != expectedContents {
+			t.Fatalf("Contents with %d threads differ:\n%s",
+				threads, contents.String())
+		}
+	}
+}
+
+func TestCheckUnmodified(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	analyzed := time.Now()
+	before := analyzed.Add(-time.Minute)
+	if err := os.Chtimes(path, before, before); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.go")
+	if err := checkUnmodified([]string{path, missing}, analyzed); err != nil {
+		t.Errorf("Unmodified file was rejected: %s", err)
+	}
+
+	// The file is edited while the refactoring is running
+	after := analyzed.Add(time.Minute)
+	if err := os.Chtimes(path, after, after); err != nil {
+		t.Fatal(err)
+	}
+	result := &refactoring.Result{
+		Log:   refactoring.NewLog(),
+		Edits: map[string]*text.EditSet{path: text.NewEditSet()},
+	}
+	result.Edits[path].Add(&text.Extent{8, 4}, "p")
+	err = writeToDisk(result, filesystem.NewLocalFileSystem(), analyzed)
+	if err == nil || !strings.Contains(err.Error(), "was modified") {
+		t.Errorf("Modified file should have been rejected (%v)", err)
+	}
+	if contents, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(contents) != "package main\n" {
+		t.Errorf("Modified file was overwritten: %q", contents)
+	}
+}
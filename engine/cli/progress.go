@@ -0,0 +1,78 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file reports progress while a refactoring loads the program (which can
+// take minutes when the scope includes hundreds of packages), so that users do
+// not assume the Go Doctor has hung.  Progress is not reported if -no-progress
+// is given.
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// Nothing is reported until loading has taken this long, so that
+	// progress is not reported for small programs
+	progressDelay = 2 * time.Second
+	// Minimum time between progress messages
+	progressInterval = 2 * time.Second
+)
+
+// A progressReporter writes messages like
+//
+//	Loaded 120/480 packages (about 1m30s remaining)
+//
+// as a program is loaded.  Its report method can be used as the Progress
+// function in a refactoring.Config.
+type progressReporter struct {
+	out io.Writer
+	// Returns the current time (replaced in tests)
+	now func() time.Time
+	// When the current load started (or progress was first reported for
+	// it), and when progress was last reported
+	start, lastReport time.Time
+	// The number of packages loaded at the start time
+	startDone int
+	// Arguments to the most recent call to report
+	lastDone, lastTotal int
+}
+
+func newProgressReporter(out io.Writer) *progressReporter {
+	return &progressReporter{out: out, now: time.Now}
+}
+
+// report records that done of total packages have been loaded, writing a
+// message if loading has taken long enough and a message has not been written
+// recently.  The message includes an estimate of the time remaining, assuming
+// the remaining packages load at the same rate as those loaded since the start
+// time.
+func (p *progressReporter) report(done, total int) {
+	now := p.now()
+	if p.start.IsZero() || done < p.lastDone || total != p.lastTotal {
+		// A new load has started (e.g., the refactored program is
+		// being loaded to check it for errors)
+		p.start, p.lastReport, p.startDone = now, now, done
+	}
+	p.lastDone, p.lastTotal = done, total
+
+	elapsed := now.Sub(p.start)
+	if elapsed < progressDelay ||
+		(done < total && now.Sub(p.lastReport) < progressInterval) {
+		return
+	}
+	p.lastReport = now
+
+	msg := fmt.Sprintf("Loaded %d/%d packages", done, total)
+	if done > p.startDone && done < total {
+		remaining := time.Duration(float64(elapsed) *
+			float64(total-done) / float64(done-p.startDone))
+		msg += fmt.Sprintf(" (about %s remaining)",
+			remaining.Round(time.Second))
+	}
+	fmt.Fprintln(p.out, msg)
+}
@@ -0,0 +1,49 @@
+// Copyright 2016-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestProgressReporter(t *testing.T) {
+	var out bytes.Buffer
+	now := time.Unix(0, 0)
+	p := newProgressReporter(&out)
+	p.now = func() time.Time { return now }
+
+	// Nothing is reported during the first few seconds
+	p.report(0, 100)
+	now = now.Add(time.Second)
+	p.report(10, 100)
+	if out.Len() != 0 {
+		t.Fatalf("Unexpected progress output: %s", out.String())
+	}
+
+	now = now.Add(3 * time.Second)
+	p.report(20, 100)
+	now = now.Add(time.Second)
+	p.report(25, 100) // too soon after the previous message
+	now = now.Add(3 * time.Second)
+	p.report(40, 100)
+	p.report(100, 100) // completion is always reported
+	expected := "Loaded 20/100 packages (about 16s remaining)\n" +
+		"Loaded 40/100 packages (about 12s remaining)\n" +
+		"Loaded 100/100 packages\n"
+	if out.String() != expected {
+		t.Fatalf("Expected:\n%sActual:\n%s", expected, out.String())
+	}
+
+	// A second load starts over, so it is not reported immediately
+	out.Reset()
+	p.report(0, 120)
+	now = now.Add(time.Second)
+	p.report(120, 120)
+	if out.Len() != 0 {
+		t.Fatalf("Unexpected progress output: %s", out.String())
+	}
+}
@@ -7,10 +7,18 @@ package engine
 
 import (
 	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
 
 	"github.com/godoctor/godoctor/refactoring"
 )
 
+// ShortNamePattern is the form of a refactoring's short name (e.g., rename or
+// extractfile): one word, beginning with a lowercase letter and containing
+// only lowercase letters, digits, and underscores.
+var ShortNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
 // All available refactorings, keyed by a unique, one-word, all-lowercase name
 var refactorings map[string]refactoring.Refactoring
 
@@ -18,6 +26,9 @@ var refactorings map[string]refactoring.Refactoring
 // displayed in a menu presented to the end user
 var refactoringsInOrder []string
 
+// True if experimental refactorings should be offered to the end user
+var experimental bool
+
 func init() {
 	ClearRefactorings()
 }
@@ -32,14 +43,60 @@ func init() {
 // The choice between #2 and #3 will determine whether the client's custom
 // refactorings are listed before or after the built-in refactorings when
 // "godoctor -list" is run.
+//
+// If a custom refactoring was already added with the same short name as a
+// built-in refactoring, AddDefaultRefactorings panics; use
+// AddDefaultRefactoringsErr to handle the collision instead.
 func AddDefaultRefactorings() {
-	AddRefactoring("rename", new(refactoring.Rename))
-	AddRefactoring("extract", new(refactoring.ExtractFunc))
-	AddRefactoring("var", new(refactoring.ExtractLocal))
-	AddRefactoring("toggle", new(refactoring.ToggleVar))
-	AddRefactoring("godoc", new(refactoring.AddGoDoc))
-	AddRefactoring("debug", new(refactoring.Debug))
-	AddRefactoring("null", new(refactoring.Null))
+	if err := AddDefaultRefactoringsErr(); err != nil {
+		panic(err)
+	}
+}
+
+// AddDefaultRefactoringsErr is like AddDefaultRefactorings, but if a custom
+// refactoring was already added with the same short name as a built-in
+// refactoring, the built-in refactoring is not added, and an error is
+// returned identifying the collision(s).
+func AddDefaultRefactoringsErr() error {
+	defaults := []struct {
+		shortName string
+		refac     refactoring.Refactoring
+	}{
+		{"rename", new(refactoring.Rename)},
+		{"extract", new(refactoring.ExtractFunc)},
+		{"var", new(refactoring.ExtractLocal)},
+		{"hoist", new(refactoring.HoistSubexpr)},
+		{"extractfile", new(refactoring.ExtractFile)},
+		{"extractpackage", new(refactoring.ExtractPackage)},
+		{"inline", new(refactoring.Inline)},
+		{"inlinelocal", new(refactoring.InlineLocal)},
+		{"namefunc", new(refactoring.NameFunc)},
+		{"functype", new(refactoring.IntroduceFuncType)},
+		{"enum", new(refactoring.ExtractEnum)},
+		{"stringer", new(refactoring.GenerateStringer)},
+		{"toggle", new(refactoring.ToggleVar)},
+		{"godoc", new(refactoring.AddGoDoc)},
+		{"options", new(refactoring.IntroduceOptions)},
+		{"keyed", new(refactoring.ConvertStructLit)},
+		{"globalparam", new(refactoring.GlobalToParam)},
+		{"localize", new(refactoring.LocalizeVar)},
+		{"move", new(refactoring.MoveStmt)},
+		{"extractloop", new(refactoring.ExtractLoop)},
+		{"errgroup", new(refactoring.ConvertToErrgroup)},
+		{"editscript", new(refactoring.EditScript)},
+		{"debug", new(refactoring.Debug)},
+		{"null", new(refactoring.Null)},
+	}
+	errs := []string{}
+	for _, d := range defaults {
+		if err := AddRefactoring(d.shortName, d.refac); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
 }
 
 // AllRefactoringNames returns the short names of all refactorings in an
@@ -48,6 +105,60 @@ func AllRefactoringNames() []string {
 	return refactoringsInOrder
 }
 
+// A NamedDescription is the description of a refactoring, together with the
+// short name under which it was added to the engine.
+type NamedDescription struct {
+	ShortName string
+	*refactoring.Description
+}
+
+// AllDescriptions returns the descriptions of all refactorings (including
+// hidden refactorings) in an order suitable for display in a menu.
+func AllDescriptions() []NamedDescription {
+	result := make([]NamedDescription, 0, len(refactoringsInOrder))
+	for _, shortName := range refactoringsInOrder {
+		result = append(result, NamedDescription{
+			ShortName:   shortName,
+			Description: refactorings[shortName].Description(),
+		})
+	}
+	return result
+}
+
+// SetExperimental determines whether experimental refactorings (see
+// IsExperimental) are included in OfferedDescriptions.  By default, they are
+// not, so end users are only offered Production-quality refactorings unless
+// they opt in (e.g., using "godoctor -experimental").
+func SetExperimental(enabled bool) {
+	experimental = enabled
+}
+
+// ExperimentalEnabled returns true if experimental refactorings are offered
+// to the end user (see SetExperimental).
+func ExperimentalEnabled() bool {
+	return experimental
+}
+
+// IsExperimental returns true if the refactoring with the given description
+// is hidden or is not of Production quality.
+func IsExperimental(d *refactoring.Description) bool {
+	return d.Hidden || d.Quality != refactoring.Production
+}
+
+// OfferedDescriptions returns the descriptions of the refactorings that
+// should be offered to the end user (e.g., in a menu), in an order suitable
+// for display in a menu: experimental refactorings are included only if they
+// have been enabled using SetExperimental.
+func OfferedDescriptions() []NamedDescription {
+	result := []NamedDescription{}
+	for _, d := range AllDescriptions() {
+		if experimental || !IsExperimental(d.Description) {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
 // GetRefactoring returns a Refactoring keyed by the given short name.  The
 // short name must be one of the keys in the map returned by AllRefactorings.
 func GetRefactoring(shortName string) refactoring.Refactoring {
@@ -57,13 +168,35 @@ func GetRefactoring(shortName string) refactoring.Refactoring {
 // AddRefactoring allows custom refactorings to be added to the refactoring
 // engine.  Invoke this method before starting the command line or protocol
 // driver.
+//
+// An error is returned (and the refactoring is not added) if the short name
+// does not match ShortNamePattern, if another refactoring has already been
+// added with the same short name, or if the same refactoring has already
+// been added under a different short name.
 func AddRefactoring(shortName string, newRefac refactoring.Refactoring) error {
+	if newRefac == nil {
+		return fmt.Errorf("The refactoring \"%s\" is nil", shortName)
+	}
+	if !ShortNamePattern.MatchString(shortName) {
+		return fmt.Errorf("The short name \"%s\" is invalid; it must "+
+			"match %s", shortName, ShortNamePattern)
+	}
 	if r, ok := refactorings[shortName]; ok {
 		return fmt.Errorf("The short name \"%s\" is already "+
 			"associated with a refactoring (%s)",
 			shortName,
 			r.Description().Name)
 	}
+	// Refactorings are normally pointers; a refactoring of any other type
+	// (e.g., a struct containing a slice) may not be comparable
+	canCompare := reflect.TypeOf(newRefac).Comparable()
+	for name, r := range refactorings {
+		if canCompare && r == newRefac {
+			return fmt.Errorf("The refactoring %s cannot be added as "+
+				"\"%s\"; it was already added as \"%s\"",
+				newRefac.Description().Name, shortName, name)
+		}
+	}
 	refactorings[shortName] = newRefac
 	refactoringsInOrder = append(refactoringsInOrder, shortName)
 	return nil
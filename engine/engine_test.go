@@ -5,9 +5,15 @@
 package engine_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/filesystem"
 	"github.com/godoctor/godoctor/refactoring"
 	"github.com/godoctor/godoctor/text"
 )
@@ -29,6 +35,19 @@ func (*customRefactoring) Run(config *refactoring.Config) *refactoring.Result {
 	}
 }
 
+// A refactoring that is not a pointer and is not comparable
+type valueRefactoring struct {
+	names []string
+}
+
+func (valueRefactoring) Description() *refactoring.Description {
+	return &refactoring.Description{Name: "Value"}
+}
+
+func (valueRefactoring) Run(config *refactoring.Config) *refactoring.Result {
+	return &refactoring.Result{Log: refactoring.NewLog()}
+}
+
 func TestEngine(t *testing.T) {
 	engine.AddDefaultRefactorings()
 
@@ -47,8 +66,286 @@ func TestEngine(t *testing.T) {
 		t.Fatalf("Should have forbidden adding with existing name")
 	}
 
-	err = engine.AddRefactoring("zz_new", &customRefactoring{})
+	custom := &customRefactoring{}
+	err = engine.AddRefactoring("zz_new", custom)
 	if err != nil {
 		t.Fatalf("The name zz_new should be unique and OK to add (?!)")
 	}
+
+	err = engine.AddRefactoring("zz_other", custom)
+	if err == nil {
+		t.Fatalf("Should have forbidden adding the same refactoring twice")
+	}
+
+	value := valueRefactoring{names: []string{"value"}}
+	if err := engine.AddRefactoring("zz_value", value); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.AddRefactoring("zz_value2", value); err != nil {
+		t.Fatalf("A refactoring that is not comparable cannot be "+
+			"identified as a duplicate (%v)", err)
+	}
+
+	for _, name := range []string{"", "Rename", "extract-func", "1st", "a b"} {
+		if engine.AddRefactoring(name, &customRefactoring{}) == nil {
+			t.Fatalf("Should have forbidden adding with name %q", name)
+		}
+	}
+
+	descriptions := engine.AllDescriptions()
+	names := engine.AllRefactoringNames()
+	if len(descriptions) != len(names) {
+		t.Fatalf("AllDescriptions returned %d descriptions; expected %d",
+			len(descriptions), len(names))
+	}
+	for i, d := range descriptions {
+		if d.ShortName != names[i] {
+			t.Fatalf("AllDescriptions()[%d] is %s; expected %s",
+				i, d.ShortName, names[i])
+		}
+		expected := engine.GetRefactoring(names[i]).Description().Name
+		if d.Name != expected {
+			t.Fatalf("Description of %s is %s; expected %s",
+				d.ShortName, d.Name, expected)
+		}
+	}
+}
+
+func TestOfferedDescriptions(t *testing.T) {
+	engine.ClearRefactorings()
+	defer engine.ClearRefactorings()
+	defer engine.SetExperimental(false)
+
+	if err := engine.AddDefaultRefactoringsErr(); err != nil {
+		t.Fatal(err)
+	}
+	offered := func() map[string]bool {
+		result := map[string]bool{}
+		for _, d := range engine.OfferedDescriptions() {
+			result[d.ShortName] = true
+		}
+		return result
+	}
+
+	// Only the stable refactorings are offered by default; those added
+	// since are of Testing quality until they have seen more use
+	engine.SetExperimental(false)
+	names := offered()
+	stable := []string{"rename", "extract", "toggle", "godoc"}
+	if len(names) != len(stable) {
+		t.Fatalf("Only %v should be offered by default; got %v",
+			stable, names)
+	}
+	for _, name := range stable {
+		if !names[name] {
+			t.Fatalf("Only %v should be offered by default; got %v",
+				stable, names)
+		}
+	}
+
+	engine.SetExperimental(true)
+	names = offered()
+	if !names["rename"] || !names["globalparam"] || !names["debug"] {
+		t.Fatalf("All refactorings should be offered when "+
+			"experimental refactorings are enabled; got %v", names)
+	}
+}
+
+func TestDefaultRefactoringCollision(t *testing.T) {
+	engine.ClearRefactorings()
+	defer engine.ClearRefactorings()
+
+	if err := engine.AddRefactoring("rename", &customRefactoring{}); err != nil {
+		t.Fatal(err)
+	}
+	err := engine.AddDefaultRefactoringsErr()
+	if err == nil || !strings.Contains(err.Error(), "rename") {
+		t.Fatalf("Should have reported a collision with rename (%v)", err)
+	}
+	if engine.GetRefactoring("rename").Description().Name != "Test" {
+		t.Fatalf("The custom refactoring should not have been replaced")
+	}
+	if engine.GetRefactoring("extract") == nil {
+		t.Fatalf("Other default refactorings should have been added")
+	}
+
+	engine.ClearRefactorings()
+	engine.AddRefactoring("rename", &customRefactoring{})
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("AddDefaultRefactorings should panic on a collision")
+		}
+	}()
+	engine.AddDefaultRefactorings()
+}
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv(engine.HistoryEnvVar, os.Getenv(engine.HistoryEnvVar))
+	os.Setenv(engine.HistoryEnvVar, filepath.Join(dir, "sub", "history.json"))
+
+	history, err := engine.ReadHistory()
+	if err != nil || len(history) != 0 {
+		t.Fatalf("Missing history file should be empty (%v)", err)
+	}
+
+	for i := 0; i < engine.MaxHistoryEntries+5; i++ {
+		if err := engine.AddToHistory("rename", []string{fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := engine.AddToHistory("godoc", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.AddToHistory("rename", []string{"10"}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err = engine.ReadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != engine.MaxHistoryEntries {
+		t.Fatalf("Expected %d history entries, found %d",
+			engine.MaxHistoryEntries, len(history))
+	}
+	if history[0].Refactoring != "rename" || history[0].Args[0] != "10" ||
+		history[1].Refactoring != "godoc" || len(history[1].Args) != 0 ||
+		history[2].Args[0] != fmt.Sprint(engine.MaxHistoryEntries+4) {
+		t.Fatalf("History entries are incorrect: %v", history)
+	}
+	for _, entry := range history[1:] {
+		if entry.Refactoring == "rename" && entry.Args[0] == "10" {
+			t.Fatalf("Repeated entry was duplicated: %v", history)
+		}
+	}
+}
+
+func TestProtectFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"plain.go":    "package p\n",
+		"cgo.go":      "package p\n\nimport \"C\"\n",
+		"excluded.go": "//go:build zz_never\n\npackage p\n",
+		"other.go":    "// +build zz_never\n\npackage p\n",
+	}
+	result := &refactoring.Result{
+		Log:   refactoring.NewLog(),
+		Edits: map[string]*text.EditSet{},
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if name != "other.go" {
+			result.Edits[path] = text.NewEditSet()
+			result.Edits[path].Add(&text.Extent{0, 0}, "// Edited\n")
+		}
+	}
+
+	engine.ProtectFiles(result, filesystem.NewLocalFileSystem())
+
+	if len(result.Edits) != 1 ||
+		result.Edits[filepath.Join(dir, "plain.go")] == nil {
+		t.Fatalf("Only plain.go should remain edited: %v", result.Edits)
+	}
+	log := result.Log.String()
+	for _, expected := range []string{
+		"cgo.go was not modified because it uses cgo",
+		"excluded.go was not modified because it is excluded by build constraints",
+		"2 file(s) were not modified",
+		"excluded by build constraints, so they were not analyzed or updated and may need to be updated by hand: " + filepath.Join(dir, "other.go") + "\n",
+	} {
+		if !strings.Contains(log, expected) {
+			t.Fatalf("Log does not contain \"%s\":\n%s", expected, log)
+		}
+	}
+
+	// With several build configurations, a file is only protected if it
+	// is excluded in all of them
+	result = &refactoring.Result{
+		Log:   refactoring.NewLog(),
+		Edits: map[string]*text.EditSet{},
+	}
+	for _, name := range []string{"a_windows.go", "a_plan9.go"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("package p\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result.Edits[path] = text.NewEditSet()
+		result.Edits[path].Add(&text.Extent{0, 0}, "// Edited\n")
+	}
+	engine.ProtectFiles(result, filesystem.NewLocalFileSystem(),
+		refactoring.BuildConfig{GOOS: "linux"},
+		refactoring.BuildConfig{GOOS: "windows", Tags: []string{"zz_never"}})
+	if len(result.Edits) != 1 ||
+		result.Edits[filepath.Join(dir, "a_windows.go")] == nil {
+		t.Fatalf("Only a_windows.go should remain edited: %v", result.Edits)
+	}
+	log = result.Log.String()
+	if !strings.Contains(log, "a_plan9.go was not modified because it is excluded by build constraints") ||
+		strings.Contains(log, "other.go") {
+		t.Fatalf("Unexpected log:\n%s", log)
+	}
+
+	// Excluded files are not protected if every edit is a syntactic
+	// occurrence (e.g., from Rename)
+	path := filepath.Join(dir, "a_plan9.go")
+	result = &refactoring.Result{
+		Log:   refactoring.NewLog(),
+		Edits: map[string]*text.EditSet{path: text.NewEditSet()},
+		Occurrences: []refactoring.Occurrence{{
+			Filename: path,
+			Extent:   &text.Extent{8, 1},
+			Kind:     refactoring.OccurrenceSyntactic,
+		}},
+	}
+	result.Edits[path].Add(&text.Extent{8, 1}, "q")
+	engine.ProtectFiles(result, filesystem.NewLocalFileSystem())
+	if result.Edits[path] == nil ||
+		strings.Contains(result.Log.String(), "a_plan9.go") {
+		t.Fatalf("Syntactic edits should not be protected:\n%s",
+			result.Log)
+	}
+}
+
+func TestForEachFile(t *testing.T) {
+	edits := map[string]*text.EditSet{}
+	for i := 0; i < 50; i++ {
+		edits[fmt.Sprintf("file%02d.go", 49-i)] = text.NewEditSet()
+	}
+	filenames := engine.SortedFilenames(edits)
+	if len(filenames) != 50 || filenames[0] != "file00.go" ||
+		filenames[49] != "file49.go" {
+		t.Fatalf("Filenames are not sorted: %v", filenames)
+	}
+
+	defer engine.SetThreads(0)
+	for _, threads := range []int{0, 1, 4, 100} {
+		engine.SetThreads(threads)
+		if threads > 0 && engine.Threads() != threads {
+			t.Fatalf("Expected %d threads; got %d",
+				threads, engine.Threads())
+		}
+		results := make([]string, len(filenames))
+		engine.ForEachFile(filenames, func(i int, filename string) {
+			results[i] = strings.TrimSuffix(filename, ".go")
+		})
+		for i, result := range results {
+			if result != fmt.Sprintf("file%02d", i) {
+				t.Fatalf("With %d threads, result %d was %q",
+					threads, i, result)
+			}
+		}
+	}
 }
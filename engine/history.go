@@ -0,0 +1,115 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the refactoring history, a per-user file recording the
+// most recent refactorings that were performed, so that the same refactoring
+// can be repeated on another file (e.g., "godoctor -repeat").
+
+package engine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// HistoryEnvVar is the name of an environment variable that, if set, gives
+// the path of the history file, overriding the default location.
+const HistoryEnvVar = "GODOCTOR_HISTORY"
+
+// MaxHistoryEntries is the maximum number of refactorings recorded in the
+// history file.
+const MaxHistoryEntries = 20
+
+// A HistoryEntry records one invocation of a refactoring: its short name and
+// its arguments.  Selections are deliberately not recorded, since the entry
+// is intended to be replayed on a different file or selection.
+type HistoryEntry struct {
+	Refactoring string   `json:"refactoring"`
+	Args        []string `json:"args"`
+}
+
+// HistoryFile returns the path of the history file.  This is the value of
+// $GODOCTOR_HISTORY if it is set; otherwise, it is godoctor/history.json in
+// the user's configuration directory.
+func HistoryFile() (string, error) {
+	if path := os.Getenv(HistoryEnvVar); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "godoctor", "history.json"), nil
+}
+
+// ReadHistory returns the entries in the history file, most recent first.
+// If the history file does not exist, the result is empty.
+func ReadHistory() ([]HistoryEntry, error) {
+	path, err := HistoryFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []HistoryEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var history []HistoryEntry
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// AddToHistory records an invocation of the refactoring with the given short
+// name and arguments as the most recent entry in the history file.  If an
+// identical entry is already present, it is moved to the front rather than
+// duplicated.  At most MaxHistoryEntries entries are retained.
+func AddToHistory(shortName string, args []string) error {
+	history, err := ReadHistory()
+	if err != nil {
+		// A corrupt history file is replaced rather than preventing
+		// new entries from being recorded
+		history = []HistoryEntry{}
+	}
+
+	entry := HistoryEntry{Refactoring: shortName, Args: args}
+	if entry.Args == nil {
+		entry.Args = []string{}
+	}
+	newHistory := []HistoryEntry{entry}
+	for _, old := range history {
+		if !old.equals(entry) && len(newHistory) < MaxHistoryEntries {
+			newHistory = append(newHistory, old)
+		}
+	}
+
+	data, err := json.MarshalIndent(newHistory, "", "\t")
+	if err != nil {
+		return err
+	}
+	path, err := HistoryFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (e HistoryEntry) equals(other HistoryEntry) bool {
+	if e.Refactoring != other.Refactoring || len(e.Args) != len(other.Args) {
+		return false
+	}
+	for i := range e.Args {
+		if e.Args[i] != other.Args[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines utilities that drivers use to process the files affected
+// by a refactoring concurrently while still producing output in a
+// deterministic order.
+
+package engine
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// The maximum number of files to process concurrently, or 0 to use the
+// number of CPUs
+var threads int
+
+// SetThreads sets the maximum number of files that the engine (and drivers
+// using ForEachFile) will process concurrently, e.g., when parsing files or
+// generating patches.  If n is less than 1, the number of CPUs is used.
+func SetThreads(n int) {
+	if n < 0 {
+		n = 0
+	}
+	threads = n
+}
+
+// Threads returns the maximum number of files that will be processed
+// concurrently.
+func Threads() int {
+	if threads > 0 {
+		return threads
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// SortedFilenames returns the names of the files with edits in the given map,
+// sorted.  Drivers should display and apply edits in this order, so that
+// their output is reproducible.
+func SortedFilenames(edits map[string]*text.EditSet) []string {
+	filenames := make([]string, 0, len(edits))
+	for filename := range edits {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+// ForEachFile invokes f(i, filenames[i]) for each of the given filenames,
+// using at most Threads() goroutines, and returns after all invocations have
+// completed.  The invocations may run in any order, so f should store its
+// result at index i (rather than appending it to a shared slice) and must not
+// modify any other shared state without synchronization.
+func ForEachFile(filenames []string, f func(i int, filename string)) {
+	n := Threads()
+	if n > len(filenames) {
+		n = len(filenames)
+	}
+	if n <= 1 {
+		for i, filename := range filenames {
+			f(i, filename)
+		}
+		return
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for w := 0; w < n; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				f(i, filenames[i])
+			}
+		}()
+	}
+	for i := range filenames {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
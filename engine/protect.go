@@ -0,0 +1,214 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines protections that prevent refactorings from modifying
+// files that the refactoring engine cannot analyze reliably.
+
+package engine
+
+import (
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/refactoring"
+	"github.com/godoctor/godoctor/text"
+)
+
+// ProtectFiles removes from result the edits to any file that refactorings
+// should not modify automatically, replacing them with warnings.  A file is
+// protected if
+//     1. it uses cgo (import "C"), since cgo files are preprocessed before
+//        they are type checked, so their positions cannot be trusted; or
+//     2. it is excluded from the build by build constraints (a //go:build
+//        line or a _GOOS/_GOARCH filename suffix), since it was not loaded
+//        and analyzed.
+// In addition, since a refactoring cannot update files that were not loaded,
+// a warning lists any files excluded by build constraints that are in the
+// same directory as a modified file; these files may need to be updated by
+// hand.  Drivers should call this before displaying or applying a result.
+//
+// If the refactoring was run in several build configurations (see
+// refactoring.RunInConfigurations), they should be passed as builds; a file is
+// then considered excluded only if it is excluded in every configuration.
+func ProtectFiles(result *refactoring.Result, fs filesystem.FileSystem, builds ...refactoring.BuildConfig) {
+	if result == nil || len(result.Edits) == 0 {
+		return
+	}
+
+	if len(builds) == 0 {
+		builds = []refactoring.BuildConfig{{}}
+	}
+	ctxts := make(buildContexts, 0, len(builds))
+	for _, b := range builds {
+		ctxts = append(ctxts, b.Context(fs))
+	}
+
+	// Parsing the files to check for cgo is the expensive part, so the
+	// files are checked concurrently, but warnings are logged in order
+	filenames := SortedFilenames(result.Edits)
+	syntactic := syntacticFiles(result)
+	reasons := make([]string, len(filenames))
+	ForEachFile(filenames, func(i int, filename string) {
+		reasons[i] = protectionReason(ctxts, fs, filename,
+			syntactic[filename])
+	})
+
+	protected := []string{}
+	dirs := map[string]bool{}
+	for i, filename := range filenames {
+		if reason := reasons[i]; reason != "" {
+			delete(result.Edits, filename)
+			result.Log.Warnf("%s was not modified because it %s",
+				filename, reason)
+			protected = append(protected, filename)
+		} else if !filesystem.IsFakeStdinPath(filename) {
+			dirs[filepath.Dir(filename)] = true
+		}
+	}
+	if len(protected) > 0 {
+		result.Log.Warnf("%d file(s) were not modified and may need "+
+			"to be updated by hand: %s", len(protected),
+			strings.Join(protected, ", "))
+	}
+
+	excluded := []string{}
+	for dir := range dirs {
+		for _, filename := range excludedFiles(ctxts, fs, dir) {
+			if !contains(protected, filename) &&
+				result.Edits[filename] == nil {
+				excluded = append(excluded, filename)
+			}
+		}
+	}
+	sort.Strings(excluded)
+	if len(excluded) > 0 {
+		result.Log.Warnf("The following files are excluded by build "+
+			"constraints, so they were not analyzed or updated and "+
+			"may need to be updated by hand: %s",
+			strings.Join(excluded, ", "))
+	}
+}
+
+// protectionReason returns a description of why the given file should not
+// be modified (suitable to follow the word "it" in a message), or "" if the
+// file may be modified.  If syntactic is true, the file may be modified even
+// if it is excluded by build constraints (see syntacticFiles).
+func protectionReason(ctxts buildContexts, fs filesystem.FileSystem, filename string, syntactic bool) string {
+	if !strings.HasSuffix(filename, ".go") {
+		return ""
+	}
+	if !filesystem.IsFakeStdinPath(filename) && !syntactic {
+		dir, name := filepath.Split(filename)
+		if ctxts.excluded(dir, name) {
+			return "is excluded by build constraints"
+		}
+	}
+	if usesCgo(fs, filename) {
+		return "uses cgo (import \"C\")"
+	}
+	return ""
+}
+
+// syntacticFiles returns the names of the files in which every edit is an
+// OccurrenceSyntactic.  A refactoring makes such edits to files that are
+// excluded by build constraints (e.g., Rename can update a file that is only
+// compiled on another platform), and it has already warned about them, so they
+// are not protected.
+func syntacticFiles(result *refactoring.Result) map[string]bool {
+	syntactic := map[string]map[text.Extent]bool{}
+	for _, occ := range result.Occurrences {
+		if occ.Kind == refactoring.OccurrenceSyntactic {
+			if syntactic[occ.Filename] == nil {
+				syntactic[occ.Filename] = map[text.Extent]bool{}
+			}
+			syntactic[occ.Filename][*occ.Extent] = true
+		}
+	}
+	files := map[string]bool{}
+	for filename, extents := range syntactic {
+		files[filename] = true
+		result.Edits[filename].Iterate(func(extent *text.Extent, _ string) bool {
+			files[filename] = extents[*extent]
+			return files[filename]
+		})
+	}
+	return files
+}
+
+// usesCgo returns true if the given Go source file imports "C".
+func usesCgo(fs filesystem.FileSystem, filename string) bool {
+	reader, err := fs.OpenFile(filename)
+	if err != nil {
+		return false
+	}
+	src, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return false
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), filename, src,
+		parser.ImportsOnly)
+	if err != nil {
+		return false
+	}
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil &&
+			path == "C" {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedFiles returns the paths of the Go source files in the given
+// directory that are excluded from the build by build constraints.
+func excludedFiles(ctxts buildContexts, fs filesystem.FileSystem, dir string) []string {
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	result := []string{}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".go") ||
+			strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ctxts.excluded(dir, name) {
+			result = append(result, filepath.Join(dir, name))
+		}
+	}
+	return result
+}
+
+// buildContexts are the build contexts corresponding to the build
+// configurations in which a refactoring was run.
+type buildContexts []*build.Context
+
+// excluded returns true if the given file is excluded from the build by build
+// constraints in every build context.
+func (ctxts buildContexts) excluded(dir, name string) bool {
+	for _, ctxt := range ctxts {
+		if match, err := ctxt.MatchFile(dir, name); err != nil || match {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(filenames []string, filename string) bool {
+	for _, f := range filenames {
+		if filesystem.SamePath(f, filename) {
+			return true
+		}
+	}
+	return false
+}
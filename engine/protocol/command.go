@@ -7,6 +7,9 @@ package protocol
 import (
 	"errors"
 	"fmt"
+	"go/build"
+	"go/token"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -50,19 +53,21 @@ func list(state *State, input map[string]interface{}) (Reply, error) {
 		return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
 	}
 	hiddenOK := true
+	minQuality := refactoring.Development
 	switch input["quality"].(string) {
 	case "in_testing":
 		hiddenOK = false
+		minQuality = refactoring.Testing
 	case "production":
 		hiddenOK = false
+		minQuality = refactoring.Production
 	}
 
 	// get all of the refactoring names
 	namesList := make([]map[string]string, 0)
-	for _, shortName := range engine.AllRefactoringNames() {
-		refactoring := engine.GetRefactoring(shortName)
-		if hiddenOK || !refactoring.Description().Hidden {
-			namesList = append(namesList, map[string]string{"shortName": shortName, "name": refactoring.Description().Name})
+	for _, d := range engine.OfferedDescriptions() {
+		if (hiddenOK || !d.Hidden) && d.Quality >= minQuality {
+			namesList = append(namesList, map[string]string{"shortName": d.ShortName, "name": d.Name})
 		}
 	}
 	return Reply{map[string]interface{}{"reply": "OK", "transformations": namesList}}, nil
@@ -111,15 +116,83 @@ func listValidate(state *State, input map[string]interface{}) error {
 
 // -=-= Open =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
 
-// TODO open with version
+// versions of the protocol the server supports, oldest first.  Version 1.0 is
+// the original protocol, which is assumed if the client does not give a
+// version; version 1.1 adds capability negotiation
+var protocolVersions = []string{"1.0", "1.1"}
+
+// optional behaviors that a client using protocol version 1.1 or later can
+// enable by listing them in the "capabilities" key of the open command.  They
+// are off by default, since older clients do not expect them
+const (
+	// put accepts a "files" key, so a client can send the contents of
+	// several unsaved buffers at once (see put)
+	capPutMulti = "supports-put-multi"
+	// while a refactoring loads the program, progress replies are sent
+	// before the command's reply (see runCancelable)
+	capProgress = "supports-progress"
+)
+
+var serverCapabilities = []string{capPutMulti, capProgress}
 
+// negotiates the protocol version and capabilities with the client.  The reply
+// gives the negotiated version, all of the versions the server supports, and
+// the capabilities in effect for the session, along with the short names of
+// the refactorings the server offers
 func open(state *State, input map[string]interface{}) (Reply, error) {
+	if err := openValidate(state, input); err != nil {
+		return Reply{map[string]interface{}{"reply": "Error", "message": err.Error(), "versions": protocolVersions}}, err
+	}
 	state.State = 1
-	return Reply{map[string]interface{}{"reply": "OK"}}, nil
+	state.Version = protocolVersions[0]
+	if version, found := input["version"]; found {
+		state.Version = version.(string)
+	}
+	state.Capabilities = map[string]bool{}
+	if state.Version != protocolVersions[0] {
+		requested, _ := input["capabilities"].([]interface{})
+		for _, capability := range requested {
+			for _, supported := range serverCapabilities {
+				if capability == supported {
+					state.Capabilities[supported] = true
+				}
+			}
+		}
+	}
+
+	capabilities := map[string]interface{}{}
+	for _, capability := range serverCapabilities {
+		capabilities[capability] = state.Capabilities[capability]
+	}
+	names := make([]string, 0)
+	for _, d := range engine.OfferedDescriptions() {
+		names = append(names, d.ShortName)
+	}
+	capabilities["refactorings"] = names
+	return Reply{map[string]interface{}{"reply": "OK", "version": state.Version, "versions": protocolVersions, "capabilities": capabilities}}, nil
 }
 
-// basically useless until we implement versioning...
 func openValidate(state *State, input map[string]interface{}) error {
+	if version, found := input["version"]; found {
+		supported := false
+		for _, v := range protocolVersions {
+			supported = supported || version == v
+		}
+		if !supported {
+			return fmt.Errorf("Protocol version %v is not supported; supported versions are %s", version, strings.Join(protocolVersions, ", "))
+		}
+	}
+	if capabilities, found := input["capabilities"]; found {
+		list, ok := capabilities.([]interface{})
+		if !ok {
+			return errors.New("\"capabilities\" key must be a list of strings")
+		}
+		for _, capability := range list {
+			if _, ok := capability.(string); !ok {
+				return errors.New("\"capabilities\" key must be a list of strings")
+			}
+		}
+	}
 	return nil
 }
 
@@ -166,11 +239,30 @@ func paramsValidate(state *State, input map[string]interface{}) error {
 
 // -=-= Put -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
 
+// stores the contents of the fake standard input file (in web mode) or, if the
+// client negotiated the supports-put-multi capability, of several files given
+// in the "files" key as a list of {"filename", "content"} objects.  In local
+// mode, the files are unsaved buffers in the client, and their contents
+// replace the files on disk for subsequent commands
 func put(state *State, input map[string]interface{}) (Reply, error) {
 	if err := putValidate(state, input); err != nil {
 		return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
 	}
 
+	if files, found := input["files"]; found {
+		for _, f := range files.([]interface{}) {
+			file := f.(map[string]interface{})
+			filename, err := putPath(state, file["filename"].(string))
+			if err != nil {
+				return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+			}
+			if err := updateOverlay(state, filename, []byte(file["content"].(string))); err != nil {
+				return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+			}
+		}
+		return Reply{map[string]interface{}{"reply": "OK"}}, nil
+	}
+
 	var editedFS *filesystem.EditedFileSystem
 	editedFS = state.Filesystem.(*filesystem.EditedFileSystem)
 
@@ -191,6 +283,9 @@ func putValidate(state *State, input map[string]interface{}) error {
 	if state.State < 2 {
 		return fmt.Errorf("put requires state of 2 (file system configured)")
 	}
+	if files, found := input["files"]; found {
+		return putMultiValidate(state, files)
+	}
 	if state.Mode != "web" {
 		return fmt.Errorf("put can only be executed in Web mode")
 	}
@@ -216,6 +311,45 @@ func putValidate(state *State, input map[string]interface{}) error {
 	return nil
 }
 
+func putMultiValidate(state *State, files interface{}) error {
+	if !state.Capabilities[capPutMulti] {
+		return fmt.Errorf("put with a \"files\" key requires the %s capability (see open)", capPutMulti)
+	}
+	list, ok := files.([]interface{})
+	if !ok {
+		return errors.New("\"files\" key must be a list of {\"filename\", \"content\"} objects")
+	}
+	for _, f := range list {
+		file, ok := f.(map[string]interface{})
+		if !ok {
+			return errors.New("\"files\" key must be a list of {\"filename\", \"content\"} objects")
+		}
+		filename, ok := file["filename"].(string)
+		if !ok {
+			return fmt.Errorf("filename is required")
+		}
+		if _, ok := file["content"].(string); !ok {
+			return fmt.Errorf("content is required")
+		}
+		if _, err := putPath(state, filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the path of a file given to put.  In web mode, the only file is the
+// fake standard input file
+func putPath(state *State, filename string) (string, error) {
+	if filename == filesystem.FakeStdinFilename {
+		return filesystem.FakeStdinPath()
+	}
+	if state.Mode == "web" {
+		return "", fmt.Errorf("put filename must be \"%s\" in Web mode", filesystem.FakeStdinFilename)
+	}
+	return filepath.Join(state.Dir, filename), nil
+}
+
 // -=-= Setdir =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
 
 var setdirModeChk = "local|web"
@@ -279,6 +413,85 @@ func setdirValidate(state *State, input map[string]interface{}) error {
 	return nil
 }
 
+// -=-= History =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+func history(state *State, input map[string]interface{}) (Reply, error) {
+	if err := historyValidate(state, input); err != nil {
+		return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+	}
+	entries, err := engine.ReadHistory()
+	if err != nil {
+		return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+	}
+	// entries use the same keys as xrun, so they can be passed back to it
+	historyList := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		historyList = append(historyList, map[string]interface{}{
+			"transformation": entry.Refactoring,
+			"arguments":      entry.Args})
+	}
+	return Reply{map[string]interface{}{"reply": "OK", "history": historyList}}, nil
+}
+
+func historyValidate(state *State, input map[string]interface{}) error {
+	if state.State < 1 {
+		return errors.New("The history command requires a state of non-zero")
+	}
+	return nil
+}
+
+// -=-= Expand =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
+
+// returns the regions enclosing the text selection (usually a single position)
+// that can be extracted, from the innermost region outward, so that clients
+// can implement "expand selection to extractable region" before invoking
+// Extract Function or Extract Local Variable
+func expand(state *State, input map[string]interface{}) (Reply, error) {
+	if err := expandValidate(state, input); err != nil {
+		return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+	}
+	textselection := input["textselection"].(map[string]interface{})
+	ts, _ := parseSelection(state, textselection)
+	if err := replaceFakeStdin(ts); err != nil {
+		return Reply{map[string]interface{}{"reply": "Error",
+			"message": err.Error()}}, err
+	}
+
+	regions, log := refactoring.ExtractableRegions(&refactoring.Config{
+		FileSystem: state.Filesystem,
+		Scope:      nil,
+		Selection:  ts,
+		Context:    state.Context,
+		Progress:   state.Progress,
+	})
+	for _, entry := range log.Entries {
+		if entry.Severity == refactoring.Error {
+			err := errors.New(entry.Message)
+			return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+		}
+	}
+
+	regionList := make([]map[string]interface{}, 0, len(regions))
+	for _, region := range regions {
+		r := positionJSON(log.Fset, region.Start, region.End)
+		r["kind"] = region.Kind.String()
+		regionList = append(regionList, r)
+	}
+	return Reply{map[string]interface{}{"reply": "OK", "regions": regionList}}, nil
+}
+
+func expandValidate(state *State, input map[string]interface{}) error {
+	if state.State < 2 {
+		return errors.New("State of 2 (file system configured) is required")
+	}
+	textselection, found := input["textselection"].(map[string]interface{})
+	if !found {
+		return errors.New("\"textselection\" key is required")
+	}
+	_, err := parseSelection(state, textselection)
+	return err
+}
+
 // -=-= XRun =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
 
 var xRunModeChk = "text|patch"
@@ -292,19 +505,9 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 	textselection := input["textselection"].(map[string]interface{})
 
 	ts, _ := parseSelection(state, textselection)
-
-	if ts.GetFilename() == filesystem.FakeStdinFilename {
-		stdinPath, err := filesystem.FakeStdinPath()
-		if err != nil {
-			return Reply{map[string]interface{}{"reply": "Error",
-				"message": err.Error()}}, err
-		}
-		switch ts := ts.(type) {
-		case *text.OffsetLengthSelection:
-			ts.Filename = stdinPath
-		case *text.LineColSelection:
-			ts.Filename = stdinPath
-		}
+	if err := replaceFakeStdin(ts); err != nil {
+		return Reply{map[string]interface{}{"reply": "Error",
+			"message": err.Error()}}, err
 	}
 
 	// get refactoring
@@ -315,10 +518,26 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 		Scope:      nil,
 		Selection:  ts,
 		Args:       input["arguments"].([]interface{}),
+		Context:    state.Context,
+		Progress:   state.Progress,
+		Loaded:     recordLoad,
 	}
 
 	// run
+	refactorings.Add(input["transformation"].(string), 1)
 	result := refac.Run(config)
+	engine.ProtectFiles(result, state.Filesystem)
+
+	// occurrences of the kinds excluded by the client (e.g., after it
+	// displayed a preview grouped by kind) are left unchanged
+	exclude, _ := parseExclude(input)
+	result.ExcludeOccurrences(exclude...)
+
+	// unless verbose output is requested, identical log entries are
+	// combined into one entry with a count
+	if verbose, _ := input["verbose"].(bool); !verbose {
+		result.Log.Aggregate(refactoring.MaxAggregatePositions)
+	}
 
 	// grab logs
 	limit, found := input["limit"].(int)
@@ -337,17 +556,52 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 			severity = "error"
 		}
 		log := map[string]interface{}{"severity": severity, "message": entry.Message}
+		if entry.Code != "" {
+			log["code"] = entry.Code
+		}
+		if entry.Count > 1 {
+			log["count"] = entry.Count
+		}
+		if pos := positionJSON(result.Log.Fset, entry.Pos, entry.End); pos != nil {
+			log["position"] = pos
+		}
+		if len(entry.Related) > 0 {
+			related := make([]map[string]interface{}, 0, len(entry.Related))
+			for _, rel := range entry.Related {
+				r := map[string]interface{}{"message": rel.Message}
+				if pos := positionJSON(result.Log.Fset, rel.Pos, rel.End); pos != nil {
+					r["position"] = pos
+				}
+				related = append(related, r)
+			}
+			log["related"] = related
+		}
 		logs = append(logs, log)
 	}
 
 	changes := make([]map[string]string, 0)
-
-	// if mode == patch or no mode was given
-	if mode, found := input["mode"]; !found || mode.(string) == "patch" {
-		for f, e := range result.Edits {
+	edits := make([]map[string]interface{}, 0)
+
+	// if applyInClient is true, the edits are returned for the client to
+	// apply to its buffers, and the session's file system is updated to
+	// reflect them, so the next command sees the refactored files even
+	// before the client saves them
+	if applyInClient, _ := input["applyInClient"].(bool); applyInClient {
+		for _, f := range engine.SortedFilenames(result.Edits) {
+			content, err := filesystem.ApplyEdits(result.Edits[f], state.Filesystem, f)
+			if err != nil {
+				return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+			}
+			if err := updateOverlay(state, f, content); err != nil {
+				return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+			}
+			edits = append(edits, map[string]interface{}{"filename": f, "edits": result.Edits[f]})
+		}
+	} else if mode, found := input["mode"]; !found || mode.(string) == "patch" {
+		for _, f := range engine.SortedFilenames(result.Edits) {
 			var p *text.Patch
 			var err error
-			p, err = filesystem.CreatePatch(e, state.Filesystem, f)
+			p, err = filesystem.CreatePatch(result.Edits[f], state.Filesystem, f)
 			if err != nil {
 				return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
 			}
@@ -357,8 +611,8 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 			diffFile.Close()
 		}
 	} else {
-		for f, e := range result.Edits {
-			content, err := filesystem.ApplyEdits(e, state.Filesystem, f)
+		for _, f := range engine.SortedFilenames(result.Edits) {
+			content, err := filesystem.ApplyEdits(result.Edits[f], state.Filesystem, f)
 			if err != nil {
 				return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
 			}
@@ -366,8 +620,109 @@ func xRun(state *State, input map[string]interface{}) (Reply, error) {
 		}
 	}
 
-	// return without filesystem changes
-	return Reply{map[string]interface{}{"reply": "OK", "description": refac.Description().Name, "log": logs, "files": changes}}, nil
+	// record the refactoring so clients can repeat it on another file
+	if !result.Log.ContainsErrors() && !refac.Description().Hidden {
+		args := make([]string, 0, len(config.Args))
+		for _, arg := range config.Args {
+			args = append(args, fmt.Sprint(arg))
+		}
+		engine.AddToHistory(input["transformation"].(string), args)
+	}
+
+	// classified occurrences, so clients can display a grouped preview
+	occurrences := make([]map[string]interface{}, 0)
+	for _, occ := range result.Occurrences {
+		if _, found := result.Edits[occ.Filename]; !found {
+			continue
+		}
+		occurrence := map[string]interface{}{
+			"filename": occ.Filename,
+			"offset":   occ.Extent.Offset,
+			"length":   occ.Extent.Length,
+			"kind":     occ.Kind.String()}
+		if occ.Reason != "" {
+			occurrence["reason"] = occ.Reason
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	// changes to the exported API of a package (e.g., a renamed exported
+	// name), so library maintainers can review them
+	apiChanges := make([]map[string]interface{}, 0)
+	for _, change := range result.APIChanges {
+		apiChanges = append(apiChanges, map[string]interface{}{
+			"package":    change.Package,
+			"name":       change.Name,
+			"message":    change.Message,
+			"compatible": change.Compatible})
+	}
+
+	// the region actually refactored, if it differs from the selection
+	// (e.g., Extract Function extends it to complete statements), so
+	// clients can show it
+	var adjustedSelection map[string]interface{}
+	if sel := result.AdjustedSelection; sel != nil {
+		adjustedSelection = map[string]interface{}{
+			"filename": sel.Filename,
+			"offset":   sel.Offset,
+			"length":   sel.Length}
+	}
+
+	// file system changes (e.g., new files) are returned separately, since
+	// they are not edits to existing files
+	fsChanges := make([]map[string]string, 0)
+	for _, change := range result.FSChanges {
+		switch change := change.(type) {
+		case *filesystem.CreateDirectory:
+			fsChanges = append(fsChanges, map[string]string{
+				"change": "mkdir",
+				"file":   change.Path})
+		case *filesystem.CreateFile:
+			fsChanges = append(fsChanges, map[string]string{
+				"change":  "create",
+				"file":    change.Path,
+				"content": change.Contents})
+		}
+	}
+
+	reply := map[string]interface{}{"reply": "OK", "description": refac.Description().Name, "safety": result.Safety().String(), "log": logs, "files": changes, "edits": edits, "occurrences": occurrences, "apiChanges": apiChanges, "fsChanges": fsChanges}
+	if adjustedSelection != nil {
+		reply["adjustedSelection"] = adjustedSelection
+	}
+	return Reply{reply}, nil
+}
+
+// records the given contents of a file in the session's file system, so that
+// subsequent commands see the file as the client does after applying edits.
+// Unless the file system already is one, it is replaced by an
+// EditedFileSystem over the original file system
+func updateOverlay(state *State, filename string, contents []byte) error {
+	overlay, ok := state.Filesystem.(*filesystem.EditedFileSystem)
+	if !ok {
+		overlay = filesystem.NewEditedFileSystem(state.Filesystem,
+			map[string]*text.EditSet{})
+		state.Filesystem = overlay
+	}
+
+	// the edit replaces the entire file in the base file system, so it
+	// remains correct if the client later saves the file
+	size := 0
+	if !filesystem.IsFakeStdinPath(filename) {
+		file, err := overlay.BaseFS.OpenFile(filename)
+		if err != nil {
+			return err
+		}
+		base, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		size = len(base)
+	}
+	es := text.NewEditSet()
+	es.Add(&text.Extent{0, size}, string(contents))
+	overlay.Edits[filename] = es
+	return nil
 }
 
 // TODO validate TextSelection, FileSelection, arguments
@@ -413,12 +768,197 @@ func xRunValidate(state *State, input map[string]interface{}) error {
 		}
 	}
 
+	// check applyInClient key if exists
+	if applyInClient, found := input["applyInClient"]; found {
+		if _, ok := applyInClient.(bool); !ok {
+			return errors.New("\"applyInClient\" key must be a boolean")
+		}
+		if _, found := input["mode"]; found {
+			return errors.New("\"applyInClient\" and \"mode\" keys cannot be used together")
+		}
+	}
+
+	// check exclude key if exists
+	if _, err := parseExclude(input); err != nil {
+		return err
+	}
+
 	// all good?
 	return nil
 }
 
+// -=-= Play =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
+
+// the only file accepted by play, as on the Go Playground
+const playFilename = "main.go"
+
+// returns the go.mod file of the temporary module fabricated by play.  Its go
+// directive is the version of the running toolchain; without one, the module
+// would be treated as Go 1.16, so generics and newer features would not type
+// check
+func playModFile() string {
+	tags := build.Default.ReleaseTags
+	version := strings.TrimPrefix(tags[len(tags)-1], "go")
+	return fmt.Sprintf("module play\n\ngo %s\n", version)
+}
+
+// runs a refactoring on a single main.go file (given in the "content" key),
+// like a program on the Go Playground.  Unlike put, which refactors a lone file
+// outside any package, this writes the file into a temporary module, so the
+// program is loaded and type checked exactly as it would be in a project.  The
+// other keys are the same as for xrun, and the reply is the same as xrun's in
+// text mode, with filenames relative to the temporary module (i.e., main.go)
+func play(state *State, input map[string]interface{}) (Reply, error) {
+	if err := playValidate(state, input); err != nil {
+		return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+	}
+
+	dir, err := ioutil.TempDir("", "godoctor-play")
+	if err != nil {
+		return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod":     playModFile(),
+		playFilename: input["content"].(string),
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			return Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}}, err
+		}
+	}
+
+	playState := &State{
+		State:        2,
+		About:        state.About,
+		Mode:         "local",
+		Dir:          dir,
+		Filesystem:   filesystem.NewLocalFileSystem(),
+		Context:      state.Context,
+		Version:      state.Version,
+		Capabilities: state.Capabilities,
+		Progress:     state.Progress,
+	}
+	xRunInput := map[string]interface{}{}
+	for key, value := range input {
+		xRunInput[key] = value
+	}
+	textselection := map[string]interface{}{}
+	for key, value := range input["textselection"].(map[string]interface{}) {
+		textselection[key] = value
+	}
+	textselection["filename"] = playFilename
+	xRunInput["textselection"] = textselection
+	xRunInput["mode"] = "text"
+	if _, found := xRunInput["arguments"]; !found {
+		xRunInput["arguments"] = []interface{}{}
+	}
+
+	reply, err := xRun(playState, xRunInput)
+	relativizePaths(reply.Params, dir)
+	return reply, err
+}
+
+func playValidate(state *State, input map[string]interface{}) error {
+	if state.State < 1 {
+		return errors.New("The play command requires a state of non-zero")
+	}
+	if _, ok := input["content"].(string); !ok {
+		return errors.New("\"content\" key is required")
+	}
+	if _, ok := input["transformation"].(string); !ok {
+		return errors.New("\"transformation\" key is required")
+	}
+	textselection, found := input["textselection"].(map[string]interface{})
+	if !found {
+		return errors.New("\"textselection\" key is required")
+	}
+	if filename, found := textselection["filename"]; found &&
+		filename != playFilename {
+		return fmt.Errorf("play filename must be \"%s\"", playFilename)
+	}
+	if mode, found := input["mode"]; found && mode != "text" {
+		return errors.New("\"mode\" key must be \"text\" for play")
+	}
+	if _, found := input["applyInClient"]; found {
+		return errors.New("\"applyInClient\" key cannot be used with play")
+	}
+	return nil
+}
+
+// replaces paths in the given reply (e.g., filenames and log messages) that are
+// in the given directory with paths relative to that directory, so replies to
+// play do not reveal the temporary module's location
+func relativizePaths(value interface{}, dir string) interface{} {
+	switch value := value.(type) {
+	case string:
+		return strings.Replace(value, dir+string(filepath.Separator), "", -1)
+	case map[string]interface{}:
+		for key, elt := range value {
+			value[key] = relativizePaths(elt, dir)
+		}
+	case map[string]string:
+		for key, elt := range value {
+			value[key] = relativizePaths(elt, dir).(string)
+		}
+	case []map[string]interface{}:
+		for _, elt := range value {
+			relativizePaths(elt, dir)
+		}
+	case []map[string]string:
+		for _, elt := range value {
+			relativizePaths(elt, dir)
+		}
+	}
+	return value
+}
+
 // -=-= Helpers =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
 
+// returns the filename, offset, and length of the region [start, end) in the
+// given FileSet, or nil if no position information is available
+func positionJSON(fset *token.FileSet, start, end token.Pos) map[string]interface{} {
+	if fset == nil || !start.IsValid() {
+		return nil
+	}
+	startPos := fset.Position(start)
+	length := 0
+	if end.IsValid() && end > start {
+		length = fset.Position(end).Offset - startPos.Offset
+	}
+	return map[string]interface{}{
+		"filename": startPos.Filename,
+		"offset":   startPos.Offset,
+		"length":   length,
+		"line":     startPos.Line,
+		"column":   startPos.Column,
+	}
+}
+
+// returns the occurrence kinds listed in the "exclude" key of the given input
+// (e.g., ["comment", "string"]), if any
+func parseExclude(input map[string]interface{}) ([]refactoring.OccurrenceKind, error) {
+	value, found := input["exclude"]
+	if !found {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("\"exclude\" key must be a list of occurrence kinds")
+	}
+	result := make([]refactoring.OccurrenceKind, 0, len(list))
+	for _, elt := range list {
+		name, _ := elt.(string)
+		kind, ok := refactoring.ParseOccurrenceKind(name)
+		if !ok {
+			return nil, fmt.Errorf("Invalid occurrence kind in \"exclude\": %v", elt)
+		}
+		result = append(result, kind)
+	}
+	return result, nil
+}
+
 // takes a map for a text selection, either in line/col form or offset/length
 // and returns the appropriate type (LineColSelection or OffsetLengthSelection)
 // also can be used to simply validate the text selection given
@@ -474,3 +1014,22 @@ func parseSelection(state *State, input map[string]interface{}) (text.Selection,
 
 	return nil, fmt.Errorf("invalid selection (offset/length or line/col")
 }
+
+// if the given selection is in the fake standard input file (see put), changes
+// its filename to the path of that file
+func replaceFakeStdin(ts text.Selection) error {
+	if ts.GetFilename() != filesystem.FakeStdinFilename {
+		return nil
+	}
+	stdinPath, err := filesystem.FakeStdinPath()
+	if err != nil {
+		return err
+	}
+	switch ts := ts.(type) {
+	case *text.OffsetLengthSelection:
+		ts.Filename = stdinPath
+	case *text.LineColSelection:
+		ts.Filename = stdinPath
+	}
+	return nil
+}
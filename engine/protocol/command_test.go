@@ -4,7 +4,17 @@
 
 package protocol
 
-import "testing"
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/engine"
+	"github.com/godoctor/godoctor/refactoring"
+)
 
 func TestAboutValidatePass(t *testing.T) {
 	// about requires state > 0 to pass validation
@@ -52,3 +62,291 @@ func TestAboutRunPass(t *testing.T) {
 		}
 	}
 }
+
+func TestParseExclude(t *testing.T) {
+	if kinds, err := parseExclude(map[string]interface{}{}); err != nil || len(kinds) != 0 {
+		t.Fatal("parseExclude: a missing exclude key should be allowed")
+	}
+	input := map[string]interface{}{
+		"exclude": []interface{}{"comment", "string"},
+	}
+	kinds, err := parseExclude(input)
+	if err != nil || len(kinds) != 2 ||
+		kinds[0] != refactoring.OccurrenceComment ||
+		kinds[1] != refactoring.OccurrenceString {
+		t.Fatal("parseExclude: incorrect occurrence kinds", kinds, err)
+	}
+	for _, invalid := range []interface{}{"comment", []interface{}{"bogus"}, []interface{}{1.0}} {
+		input["exclude"] = invalid
+		if _, err := parseExclude(input); err == nil {
+			t.Fatalf("parseExclude: %v should be rejected", invalid)
+		}
+	}
+}
+
+func TestExpandValidateFail(t *testing.T) {
+	// expand requires a configured file system and a text selection
+	state := State{State: 1}
+	if err := expandValidate(&state, map[string]interface{}{}); err == nil {
+		t.Fatal("Expand.Validate: should fail with state < 2")
+	}
+	state = State{State: 2}
+	if err := expandValidate(&state, map[string]interface{}{}); err == nil {
+		t.Fatal("Expand.Validate: should fail without a text selection")
+	}
+	input := map[string]interface{}{
+		"textselection": map[string]interface{}{"filename": "main.go"},
+	}
+	if err := expandValidate(&state, input); err == nil {
+		t.Fatal("Expand.Validate: should fail without a position")
+	}
+}
+
+// registers the default refactorings unless an earlier test already did
+func addDefaultRefactorings(t *testing.T) {
+	if engine.GetRefactoring("rename") != nil {
+		return
+	}
+	if err := engine.AddDefaultRefactoringsErr(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv(engine.HistoryEnvVar, os.Getenv(engine.HistoryEnvVar))
+	os.Setenv(engine.HistoryEnvVar, filepath.Join(dir, "history.json"))
+	addDefaultRefactorings(t)
+
+	input := map[string]interface{}{
+		"content":        "package main\n\nfunc main() {\n\tx := 1\n\tprintln(x)\n}\n",
+		"transformation": "rename",
+		"arguments":      []interface{}{"y"},
+		"textselection": map[string]interface{}{
+			"startline": 4.0, "startcol": 2.0,
+			"endline": 4.0, "endcol": 2.0,
+		},
+	}
+	reply, err := play(&State{State: 1}, input)
+	if err != nil {
+		t.Fatal("Play:", err)
+	}
+	files := reply.Params["files"].([]map[string]string)
+	expected := "package main\n\nfunc main() {\n\ty := 1\n\tprintln(y)\n}\n"
+	if len(files) != 1 || files[0]["filename"] != "main.go" ||
+		files[0]["content"] != expected {
+		t.Fatalf("Play: incorrect files in reply %v", reply)
+	}
+
+	input["textselection"].(map[string]interface{})["filename"] = "other.go"
+	if _, err := play(&State{State: 1}, input); err == nil {
+		t.Fatal("Play: only main.go should be accepted")
+	}
+}
+
+func TestPlayGeneric(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv(engine.HistoryEnvVar, os.Getenv(engine.HistoryEnvVar))
+	os.Setenv(engine.HistoryEnvVar, filepath.Join(dir, "history.json"))
+	addDefaultRefactorings(t)
+
+	// the temporary module must use the running Go version, not Go 1.16
+	input := map[string]interface{}{
+		"content":        "package main\n\nfunc id[T any](x T) T {\n\treturn x\n}\n\nfunc main() {\n\tx := 1\n\tprintln(id(x))\n}\n",
+		"transformation": "rename",
+		"arguments":      []interface{}{"y"},
+		"textselection": map[string]interface{}{
+			"startline": 8.0, "startcol": 2.0,
+			"endline": 8.0, "endcol": 2.0,
+		},
+	}
+	reply, err := play(&State{State: 1}, input)
+	if err != nil {
+		t.Fatal("Play:", err)
+	}
+	tags := build.Default.ReleaseTags
+	if !strings.Contains(playModFile(), "\ngo "+strings.TrimPrefix(tags[len(tags)-1], "go")+"\n") {
+		t.Fatalf("Play: go.mod should use the running Go version:\n%s",
+			playModFile())
+	}
+	files := reply.Params["files"].([]map[string]string)
+	expected := "package main\n\nfunc id[T any](x T) T {\n\treturn x\n}\n\nfunc main() {\n\ty := 1\n\tprintln(id(y))\n}\n"
+	if len(files) != 1 || files[0]["content"] != expected {
+		t.Fatalf("Play: incorrect files in reply %v", reply)
+	}
+}
+
+func TestXRunApplyInClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv(engine.HistoryEnvVar, os.Getenv(engine.HistoryEnvVar))
+	os.Setenv(engine.HistoryEnvVar, filepath.Join(dir, "history.json"))
+	addDefaultRefactorings(t)
+
+	original := "package main\n\nfunc main() {\n\tx := 1\n\tprintln(x)\n}\n"
+	filename := filepath.Join(dir, "main.go")
+	files := map[string]string{"go.mod": "module m\n", "main.go": original}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state := &State{State: 1}
+	if _, err := setdir(state, map[string]interface{}{"mode": "local", "directory": dir}); err != nil {
+		t.Fatal("Setdir:", err)
+	}
+	rename := func(newName string) Reply {
+		reply, err := xRun(state, map[string]interface{}{
+			"transformation": "rename",
+			"arguments":      []interface{}{newName},
+			"applyInClient":  true,
+			"textselection": map[string]interface{}{
+				"filename":  "main.go",
+				"startline": 4.0, "startcol": 2.0,
+				"endline": 4.0, "endcol": 2.0,
+			},
+		})
+		if err != nil {
+			t.Fatal("XRun:", err)
+		}
+		return reply
+	}
+
+	reply := rename("y")
+	edits := reply.Params["edits"].([]map[string]interface{})
+	if len(edits) != 1 || edits[0]["filename"] != filename {
+		t.Fatalf("XRun: incorrect edits in reply %v", reply)
+	}
+	if contents, _ := ioutil.ReadFile(filename); string(contents) != original {
+		t.Fatal("XRun: applyInClient should not change files on disk")
+	}
+
+	// the second rename sees the result of the first one
+	rename("z")
+	file, err := state.Filesystem.OpenFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "package main\n\nfunc main() {\n\tz := 1\n\tprintln(z)\n}\n"
+	if string(contents) != expected {
+		t.Fatalf("XRun: incorrect file system contents after applyInClient:\n%s", contents)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	addDefaultRefactorings(t)
+
+	// without a version, the original protocol is used, and no
+	// capabilities are enabled
+	state := &State{}
+	reply, err := open(state, map[string]interface{}{
+		"capabilities": []interface{}{"supports-progress"},
+	})
+	if err != nil {
+		t.Fatal("Open:", err)
+	}
+	if reply.Params["version"] != "1.0" || state.State != 1 ||
+		len(state.Capabilities) != 0 {
+		t.Fatalf("Open: incorrect negotiation %v", reply)
+	}
+
+	state = &State{}
+	reply, err = open(state, map[string]interface{}{
+		"version":      "1.1",
+		"capabilities": []interface{}{"supports-progress", "bogus"},
+	})
+	if err != nil {
+		t.Fatal("Open:", err)
+	}
+	capabilities := reply.Params["capabilities"].(map[string]interface{})
+	if reply.Params["version"] != "1.1" ||
+		capabilities["supports-progress"] != true ||
+		capabilities["supports-put-multi"] != false ||
+		!state.Capabilities["supports-progress"] ||
+		state.Capabilities["bogus"] {
+		t.Fatalf("Open: incorrect negotiation %v", reply)
+	}
+	found := false
+	for _, name := range capabilities["refactorings"].([]string) {
+		found = found || name == "rename"
+	}
+	if !found {
+		t.Fatalf("Open: rename should be listed in %v", reply)
+	}
+
+	for _, input := range []map[string]interface{}{
+		{"version": "2.0"},
+		{"version": 1.1},
+		{"version": "1.1", "capabilities": "supports-progress"},
+	} {
+		reply, err := open(&State{}, input)
+		if err == nil {
+			t.Fatalf("Open: %v should be rejected", input)
+		}
+		if reply.Params["versions"] == nil {
+			t.Fatalf("Open: supported versions missing from %v", reply)
+		}
+	}
+}
+
+func TestPutMulti(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(filename, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	state := &State{State: 1}
+	if _, err := setdir(state, map[string]interface{}{"mode": "local", "directory": dir}); err != nil {
+		t.Fatal("Setdir:", err)
+	}
+	content := "package main\n\nfunc main() {}\n"
+	input := map[string]interface{}{
+		"command": "put",
+		"files": []interface{}{
+			map[string]interface{}{"filename": "main.go", "content": content},
+		},
+	}
+	if _, err := put(state, input); err == nil {
+		t.Fatal("Put: files should require the supports-put-multi capability")
+	}
+
+	state.Capabilities = map[string]bool{"supports-put-multi": true}
+	if _, err := put(state, input); err != nil {
+		t.Fatal("Put:", err)
+	}
+	file, err := state.Filesystem.OpenFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != content {
+		t.Fatalf("Put: incorrect file system contents:\n%s", contents)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the counters that the protocol daemon maintains (the
+// number of commands received, how many failed or were cancelled, which
+// refactorings were run, and how long it took to load programs) and
+// ServeDebug, which makes them available over HTTP, along with the runtime
+// profiles in net/http/pprof, so that operators of a shared refactoring
+// service can monitor it.
+
+package protocol
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+)
+
+// metrics is published by the expvar package (and served at /debug/vars) as
+// the variable "godoctor".
+var metrics = expvar.NewMap("godoctor")
+
+var (
+	// Number of commands received, by command name
+	requests = new(expvar.Map).Init()
+	// Number of commands that produced an error reply
+	requestErrors = new(expvar.Int)
+	// Number of commands cancelled by the client
+	cancellations = new(expvar.Int)
+	// Number of times each refactoring was run, by name
+	refactorings = new(expvar.Map).Init()
+	// Number of times a program was loaded, and the time taken
+	loads       = new(expvar.Int)
+	loadTotalMs = new(expvar.Int)
+	loadLastMs  = new(expvar.Int)
+	loadMaxMs   = new(expvar.Int)
+	// Guards loadMaxMs, which is compared and then updated
+	loadMaxMutex sync.Mutex
+)
+
+func init() {
+	metrics.Set("requests", requests)
+	metrics.Set("errors", requestErrors)
+	metrics.Set("cancellations", cancellations)
+	metrics.Set("refactorings", refactorings)
+	metrics.Set("loads", loads)
+	metrics.Set("loadTotalMs", loadTotalMs)
+	metrics.Set("loadLastMs", loadLastMs)
+	metrics.Set("loadMaxMs", loadMaxMs)
+}
+
+// recordRequest counts a command received from the client, along with its
+// reply, if it was an error.  Unrecognized commands are counted together
+// as "invalid", so a client cannot add arbitrarily many counters.
+func recordRequest(command interface{}, reply Reply) {
+	name, _ := command.(string)
+	if _, found := setup()[name]; !found && name != "cancel" {
+		name = "invalid"
+	}
+	requests.Add(name, 1)
+	if reply.Params["reply"] == "Error" {
+		requestErrors.Add(1)
+	}
+}
+
+// recordLoad records the time taken to load a program.  It is used as the
+// refactoring.Config's Loaded function.
+func recordLoad(elapsed time.Duration) {
+	ms := int64(elapsed / time.Millisecond)
+	loads.Add(1)
+	loadTotalMs.Add(ms)
+	loadLastMs.Set(ms)
+	loadMaxMutex.Lock()
+	if ms > loadMaxMs.Value() {
+		loadMaxMs.Set(ms)
+	}
+	loadMaxMutex.Unlock()
+}
+
+// ServeDebug starts an HTTP server on the given address (e.g.,
+// "localhost:6060") that serves the daemon's counters at /debug/vars and
+// runtime profiles at /debug/pprof/.  These reveal details of the code being
+// refactored, so the address must be a loopback address.  The server runs
+// until the process exits; the returned listener identifies the address on
+// which it is listening (e.g., if the given port was 0).
+func ServeDebug(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !isLoopback(host) {
+		return nil, fmt.Errorf("The debug address cannot be %s; it "+
+			"must be a loopback address (e.g., localhost:6060)", addr)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(listener, debugHandler())
+	return listener, nil
+}
+
+// isLoopback returns true if the given host name or IP address refers only to
+// the local machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// debugHandler returns a handler for the debugging endpoints.  A separate mux
+// is used (rather than http.DefaultServeMux) so that only these endpoints are
+// served.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
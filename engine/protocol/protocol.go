@@ -9,7 +9,9 @@ package protocol
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -33,6 +35,18 @@ type State struct {
 	Mode       string
 	Dir        string
 	Filesystem filesystem.FileSystem
+	// Context for the command currently executing.  In single command
+	// mode, it is cancelled when the client sends a "cancel" command.
+	Context context.Context
+	// Protocol version and optional capabilities negotiated by the open
+	// command (see open)
+	Version      string
+	Capabilities map[string]bool
+	// If non-nil, called by commands while a program is loaded, with the
+	// number of packages loaded so far and the total number to load.  It
+	// is set only while a command is running, and only if the client
+	// negotiated the supports-progress capability.
+	Progress func(done, total int)
 }
 
 func Run(writer io.Writer, aboutText string, args []string) {
@@ -68,44 +82,170 @@ func Run(writer io.Writer, aboutText string, args []string) {
 	runList(writer, aboutText, argJson)
 }
 
+// an input line read from the client in single command mode
+type input struct {
+	bytes []byte
+	err   error
+}
+
+// readInputs reads newline-terminated commands from the given reader, sending
+// them on the returned channel.  The channel is closed when the end of the
+// input is reached.
+func readInputs(reader io.Reader) <-chan input {
+	inputs := make(chan input)
+	go func() {
+		defer close(inputs)
+		ioreader := bufio.NewReader(reader)
+		for {
+			bytes, err := ioreader.ReadBytes('\n')
+			if err == io.EOF {
+				return
+			}
+			inputs <- input{bytes, err}
+		}
+	}()
+	return inputs
+}
+
 func runSingle(writer io.Writer, aboutText string) {
 	cmdList := setup()
 	var state = State{State: 0, About: aboutText, Mode: "", Dir: "", Filesystem: nil}
-	var inputJson map[string]interface{}
-	ioreader := bufio.NewReader(os.Stdin)
-	for {
-		input, err := ioreader.ReadBytes('\n')
-		if err == io.EOF {
-			// exit
-			break
-		} else if err != nil {
-			printReply(writer, Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}})
-			continue
-		}
-		err = json.Unmarshal(input, &inputJson)
+	inputs := readInputs(os.Stdin)
+	for in := range inputs {
+		inputJson, err := parseInput(in)
 		if err != nil {
-			printReply(writer, Reply{map[string]interface{}{"reply": "Error", "message": err.Error()}})
-			continue
-		}
-		// check command key exists
-		cmd, found := inputJson["command"]
-		if !found {
-			printReply(writer, Reply{map[string]interface{}{"reply": "Error", "message": "Invalid JSON command"}})
+			reply := errorReply(err.Error())
+			recordRequest(inputJson["command"], reply)
+			printReply(writer, withID(reply, inputJson))
 			continue
 		}
+		cmd := inputJson["command"]
 		// if close command, just exit
 		if cmd == "close" {
 			break
 		}
+		// nothing to cancel; a cancel is only meaningful while another
+		// command is running
+		if cmd == "cancel" {
+			reply := errorReply("No command is in progress")
+			recordRequest(cmd, reply)
+			printReply(writer, withID(reply, inputJson))
+			continue
+		}
 		// check command is one we support
 		if _, found := cmdList[cmd.(string)]; !found {
-			printReply(writer, Reply{map[string]interface{}{"reply": "Error", "message": "Invalid JSON command"}})
+			reply := errorReply("Invalid JSON command")
+			recordRequest(cmd, reply)
+			printReply(writer, withID(reply, inputJson))
 			continue
 		}
 		// everything good to run command
-		result, _ := cmdList[cmd.(string)](&state, inputJson) // run the command
-		printReply(writer, result)
+		if !runCancelable(writer, cmdList[cmd.(string)], &state, inputJson, inputs) {
+			break
+		}
+	}
+}
+
+// runCancelable runs the given command in a separate goroutine, printing its
+// reply when it completes.  While the command is running, inputs are read
+// from the client: a "cancel" command cancels the running command (via
+// state.Context), and any other command is rejected.  It returns false if the
+// client closed the input or sent a "close" command while the command was
+// running.
+func runCancelable(writer io.Writer, cmd Command, state *State, inputJson map[string]interface{}, inputs <-chan input) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	state.Context = ctx
+	defer func() { state.Context = nil }()
+
+	// progress replies are sent to this loop, so they are not written
+	// concurrently with other replies
+	progress := make(chan Reply)
+	if state.Capabilities[capProgress] {
+		state.Progress = func(loaded, total int) {
+			progress <- Reply{map[string]interface{}{"reply": "Progress", "done": loaded, "total": total}}
+		}
+		defer func() { state.Progress = nil }()
+	}
+
+	done := make(chan Reply, 1)
+	go func() {
+		result, _ := cmd(state, inputJson) // run the command
+		done <- result
+	}()
+
+	keepRunning := true
+	cancelled := false
+	for {
+		select {
+		case result := <-done:
+			if cancelled {
+				result = errorReply("Command cancelled")
+				cancellations.Add(1)
+			}
+			recordRequest(inputJson["command"], result)
+			printReply(writer, withID(result, inputJson))
+			return keepRunning
+		case reply := <-progress:
+			printReply(writer, withID(reply, inputJson))
+		case in, ok := <-inputs:
+			if !ok {
+				// Input closed; abort the command and exit
+				cancel()
+				cancelled = true
+				keepRunning = false
+				inputs = nil
+				continue
+			}
+			other, err := parseInput(in)
+			if err != nil {
+				reply := errorReply(err.Error())
+				recordRequest(other["command"], reply)
+				printReply(writer, withID(reply, other))
+				continue
+			}
+			var reply Reply
+			switch other["command"] {
+			case "cancel":
+				if id, found := other["id"]; found && id != inputJson["id"] {
+					reply = errorReply("No command with the given id is in progress")
+				} else {
+					cancel()
+					cancelled = true
+					reply = Reply{map[string]interface{}{"reply": "OK"}}
+				}
+			case "close":
+				cancel()
+				cancelled = true
+				keepRunning = false
+				continue
+			default:
+				reply = errorReply("Another command is in progress; it must complete or be cancelled first")
+			}
+			recordRequest(other["command"], reply)
+			printReply(writer, withID(reply, other))
+		}
+	}
+}
+
+// parseInput parses a single line of input as a JSON object, ensuring that it
+// contains a "command" key.  If the input cannot be parsed, the (possibly
+// partial) result is returned along with an error.
+func parseInput(in input) (map[string]interface{}, error) {
+	if in.err != nil {
+		return nil, in.err
+	}
+	var inputJson map[string]interface{}
+	if err := json.Unmarshal(in.bytes, &inputJson); err != nil {
+		return inputJson, err
 	}
+	// check command key exists
+	if cmd, found := inputJson["command"]; !found {
+		return inputJson, errors.New("Invalid JSON command")
+	} else if _, ok := cmd.(string); !ok {
+		return inputJson, errors.New("Invalid JSON command")
+	}
+	return inputJson, nil
 }
 
 func runList(writer io.Writer, aboutText string, argJson []map[string]interface{}) {
@@ -121,6 +261,7 @@ func runList(writer io.Writer, aboutText string, argJson []map[string]interface{
 		// valid command?
 		if _, found := cmdList[cmd.(string)]; found {
 			resultReply, err := cmdList[cmd.(string)](&state, cmdObj)
+			recordRequest(cmd, resultReply)
 			if err != nil {
 				printReply(writer, resultReply)
 				return
@@ -146,9 +287,26 @@ func setup() map[string]Command {
 	cmds["params"] = params
 	cmds["put"] = put
 	cmds["xrun"] = xRun
+	cmds["history"] = history
+	cmds["expand"] = expand
+	cmds["play"] = play
 	return cmds
 }
 
+func errorReply(message string) Reply {
+	return Reply{map[string]interface{}{"reply": "Error", "message": message}}
+}
+
+// withID copies the "id" key, if any, from the given command into the given
+// reply, so that clients can match replies with the commands that produced
+// them.
+func withID(reply Reply, inputJson map[string]interface{}) Reply {
+	if id, found := inputJson["id"]; found {
+		reply.Params["id"] = id
+	}
+	return reply
+}
+
 func printReply(writer io.Writer, reply Reply) {
 	fmt.Fprintf(writer, "%s\n", reply)
 }
@@ -0,0 +1,155 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCancelable(t *testing.T) {
+	started := make(chan struct{})
+	blocking := func(state *State, input map[string]interface{}) (Reply, error) {
+		close(started)
+		<-state.Context.Done()
+		return Reply{map[string]interface{}{"reply": "OK"}}, nil
+	}
+
+	inputs := make(chan input)
+	go func() {
+		<-started
+		inputs <- input{bytes: []byte(`{"command":"about","id":2}`)}
+		inputs <- input{bytes: []byte(`{"command":"cancel","id":1}`)}
+	}()
+
+	var out bytes.Buffer
+	state := State{State: 1}
+	cmd := map[string]interface{}{"command": "xrun", "id": 1.0}
+	if !runCancelable(&out, blocking, &state, cmd, inputs) {
+		t.Fatal("runCancelable should not request exit after cancel")
+	}
+	if state.Context != nil {
+		t.Fatal("state.Context should be cleared after the command completes")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 replies, got %d:\n%s", len(lines), out.String())
+	}
+	if !strings.Contains(lines[0], `"id":2`) ||
+		!strings.Contains(lines[0], "in progress") {
+		t.Fatalf("Expected busy error for command 2, got %s", lines[0])
+	}
+	if lines[1] != `{"id":1,"reply":"OK"}` {
+		t.Fatalf("Expected OK reply to cancel, got %s", lines[1])
+	}
+	if !strings.Contains(lines[2], "Command cancelled") ||
+		!strings.Contains(lines[2], `"id":1`) {
+		t.Fatalf("Expected cancelled reply for command 1, got %s", lines[2])
+	}
+}
+
+func TestRunCancelableCompletes(t *testing.T) {
+	quick := func(state *State, input map[string]interface{}) (Reply, error) {
+		return Reply{map[string]interface{}{"reply": "OK"}}, nil
+	}
+	var out bytes.Buffer
+	state := State{State: 1}
+	inputs := make(chan input)
+	if !runCancelable(&out, quick, &state, map[string]interface{}{}, inputs) {
+		t.Fatal("runCancelable should not request exit")
+	}
+	if out.String() != "{\"reply\":\"OK\"}\n" {
+		t.Fatalf("Unexpected reply: %s", out.String())
+	}
+}
+
+func TestRunCancelableProgress(t *testing.T) {
+	loading := func(state *State, input map[string]interface{}) (Reply, error) {
+		if state.Progress != nil {
+			state.Progress(1, 2)
+		}
+		return Reply{map[string]interface{}{"reply": "OK"}}, nil
+	}
+	cmd := map[string]interface{}{"command": "xrun", "id": 1.0}
+
+	var out bytes.Buffer
+	state := State{State: 1}
+	runCancelable(&out, loading, &state, cmd, make(chan input))
+	if out.String() != "{\"id\":1,\"reply\":\"OK\"}\n" {
+		t.Fatalf("Progress should not be reported unless negotiated: %s", out.String())
+	}
+
+	out.Reset()
+	state.Capabilities = map[string]bool{"supports-progress": true}
+	runCancelable(&out, loading, &state, cmd, make(chan input))
+	expected := "{\"done\":1,\"id\":1,\"reply\":\"Progress\",\"total\":2}\n" +
+		"{\"id\":1,\"reply\":\"OK\"}\n"
+	if out.String() != expected {
+		t.Fatalf("Expected\n%sgot\n%s", expected, out.String())
+	}
+	if state.Progress != nil {
+		t.Fatal("state.Progress should be cleared after the command completes")
+	}
+}
+
+func TestServeDebug(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", "example.com:6060", "6060"} {
+		if _, err := ServeDebug(addr); err == nil {
+			t.Fatalf("Expected ServeDebug to reject %s", addr)
+		}
+	}
+
+	listener, err := ServeDebug("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	recordRequest("about", Reply{map[string]interface{}{"reply": "OK"}})
+	recordRequest("bogus", errorReply("Invalid JSON command"))
+	recordLoad(1500 * time.Millisecond)
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vars struct {
+		Godoctor struct {
+			Requests  map[string]int64
+			Errors    int64
+			Loads     int64
+			LoadMaxMs int64
+		}
+	}
+	if err := json.Unmarshal(body, &vars); err != nil {
+		t.Fatalf("%s\n%s", err, body)
+	}
+	m := vars.Godoctor
+	if m.Requests["about"] < 1 || m.Requests["invalid"] < 1 ||
+		m.Requests["bogus"] != 0 || m.Errors < 1 || m.Loads < 1 ||
+		m.LoadMaxMs < 1500 {
+		t.Fatalf("Unexpected metrics: %s", body)
+	}
+
+	resp, err = http.Get("http://" + listener.Addr().String() + "/debug/pprof/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected /debug/pprof/ to be served, got %s", resp.Status)
+	}
+}
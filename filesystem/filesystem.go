@@ -17,6 +17,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
@@ -45,6 +46,34 @@ func FakeStdinPath() (string, error) {
 	return result, nil
 }
 
+// IsFakeStdinPath returns true if the given path denotes the file whose
+// absolute path is returned by FakeStdinPath.  Callers should use this
+// instead of comparing strings, since the same path may be spelled several
+// ways (e.g., with forward or backward slashes on Windows).
+func IsFakeStdinPath(path string) bool {
+	stdin, err := FakeStdinPath()
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return SamePath(absPath, stdin)
+}
+
+// SamePath returns true if the two paths are equal after cleaning.  On
+// Windows, where file names are case insensitive, the comparison ignores
+// case, so C:\src\a.go, c:/src/a.go, and C:\src\.\A.GO are all the same
+// path.  This is a lexical comparison; the file system is not consulted.
+func SamePath(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
 /* -=-=- File System Interface -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
 
 // A FileSystem provides the ability to read directories and files, as well as
@@ -65,6 +94,11 @@ type FileSystem interface {
 	// permissions.
 	CreateFile(path, contents string) error
 
+	// CreateDirectory creates a new, empty directory with default
+	// permissions.  It is an error if the path already exists or if its
+	// parent directory does not exist.
+	CreateDirectory(path string) error
+
 	// Rename changes the name of a file or directory.  newName should be a
 	// bare name, not including a directory prefix; the existing file will
 	// be renamed within its existing parent directory.
@@ -118,6 +152,13 @@ func (fs *LocalFileSystem) CreateFile(path, contents string) error {
 	return nil
 }
 
+func (fs *LocalFileSystem) CreateDirectory(path string) error {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return fmt.Errorf("Path already exists: %s", path)
+	}
+	return os.Mkdir(path, 0777)
+}
+
 func (fs *LocalFileSystem) Rename(oldPath, newName string) error {
 	if !isBareFilename(newName) {
 		return fmt.Errorf("newName must be a bare filename: %s",
@@ -178,11 +219,7 @@ func NewSingleEditedFileSystem(filename, contents string) (*EditedFileSystem, er
 }
 
 func sizeOf(filename string) (int, error) {
-	stdin, err := FakeStdinPath()
-	if err != nil {
-		return 0, err
-	}
-	if filename == stdin {
+	if IsFakeStdinPath(filename) {
 		return 0, nil
 	}
 
@@ -208,17 +245,11 @@ func sizeOf(filename string) (int, error) {
 }
 
 func (fs *EditedFileSystem) OpenFile(path string) (io.ReadCloser, error) {
-	var localReader io.ReadCloser
-	stdin, err := FakeStdinPath()
-	if err != nil {
+	localReader, err := fs.BaseFS.OpenFile(path)
+	if err != nil && os.IsNotExist(err) && IsFakeStdinPath(path) {
+		localReader = ioutil.NopCloser(strings.NewReader(""))
+	} else if err != nil {
 		return nil, err
-	} else {
-		localReader, err = fs.BaseFS.OpenFile(path)
-		if err != nil && os.IsNotExist(err) && path == stdin {
-			localReader = ioutil.NopCloser(strings.NewReader(""))
-		} else if err != nil {
-			return nil, err
-		}
 	}
 	editSet, ok := fs.Edits[path]
 	if !ok {
@@ -236,11 +267,7 @@ func (fs *EditedFileSystem) OpenFile(path string) (io.ReadCloser, error) {
 }
 
 func (fs *EditedFileSystem) OverwriteFile(path string) (io.WriteCloser, error) {
-	stdin, err := FakeStdinPath()
-	if err != nil {
-		return nil, err
-	}
-	if path == stdin {
+	if IsFakeStdinPath(path) {
 		return os.Stdout, nil
 	}
 
@@ -320,7 +347,8 @@ func (fs *EditedFileSystem) Remove(path string) error {
 /* -=-=- Utility Functions -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
 
 // CreatePatch reads bytes from a file, applying the edits in an EditSet and
-// returning a Patch.
+// returning a Patch.  If the EditSet records a base (see EditSet.SetBase) that
+// does not match the file, a *text.StaleError naming the file is returned.
 func CreatePatch(es *text.EditSet, fs FileSystem, filename string) (*text.Patch, error) {
 	file, err := fs.OpenFile(filename)
 	if err != nil {
@@ -329,11 +357,13 @@ func CreatePatch(es *text.EditSet, fs FileSystem, filename string) (*text.Patch,
 
 	defer file.Close()
 
-	return es.CreatePatch(file)
+	patch, err := es.CreatePatch(file)
+	return patch, withFilename(err, filename)
 }
 
 // ApplyEdits reads bytes from a file, applying the edits in an EditSet and
-// returning the result as a slice of bytes.
+// returning the result as a slice of bytes.  As with CreatePatch, a
+// *text.StaleError is returned if the file does not match a recorded base.
 func ApplyEdits(es *text.EditSet, fs FileSystem, filename string) ([]byte, error) {
 	file, err := fs.OpenFile(filename)
 	if err != nil {
@@ -342,5 +372,64 @@ func ApplyEdits(es *text.EditSet, fs FileSystem, filename string) ([]byte, error
 
 	defer file.Close()
 
-	return text.ApplyToReader(es, file)
+	contents, err := text.ApplyToReader(es, file)
+	return contents, withFilename(err, filename)
+}
+
+// withFilename adds the given filename to err if it is a *text.StaleError.
+func withFilename(err error, filename string) error {
+	if err, ok := err.(*text.StaleError); ok && err.Filename == "" {
+		err.Filename = filename
+	}
+	return err
+}
+
+/* -=-=- File System Changes -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-= */
+
+// A Change is a change to the file system, such as creating a file, that a
+// refactoring requires in addition to text edits to existing files.
+type Change interface {
+	// ExecuteUsing applies this change to the given file system.
+	ExecuteUsing(fs FileSystem) error
+	// String returns a human-readable description of this change, with
+	// paths relative to the given directory (if possible).
+	String(relativeTo string) string
+}
+
+// CreateFile is a Change that creates a new file with the given contents.
+type CreateFile struct {
+	Path     string
+	Contents string
+}
+
+func (c *CreateFile) ExecuteUsing(fs FileSystem) error {
+	return fs.CreateFile(c.Path, c.Contents)
+}
+
+func (c *CreateFile) String(relativeTo string) string {
+	return fmt.Sprintf("create %s", relativePath(c.Path, relativeTo))
+}
+
+// CreateDirectory is a Change that creates a new, empty directory.
+type CreateDirectory struct {
+	Path string
+}
+
+func (c *CreateDirectory) ExecuteUsing(fs FileSystem) error {
+	return fs.CreateDirectory(c.Path)
+}
+
+func (c *CreateDirectory) String(relativeTo string) string {
+	return fmt.Sprintf("create directory %s", relativePath(c.Path, relativeTo))
+}
+
+// relativePath returns path relative to dir, or path itself if a relative
+// path cannot be computed.
+func relativePath(path, dir string) string {
+	if dir != "" {
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			return rel
+		}
+	}
+	return path
 }
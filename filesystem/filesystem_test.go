@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -46,6 +47,31 @@ func TestCreateFile1(t *testing.T) {
 	os.Remove(testFile)
 }
 
+func TestCreateFileChange(t *testing.T) {
+	abs, err := filepath.Abs(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := &CreateFile{Path: abs, Contents: "contents"}
+	if s := change.String(filepath.Dir(abs)); s != "create "+testFile {
+		t.Fatalf("Incorrect description: %s", s)
+	}
+	if err := change.ExecuteUsing(NewLocalFileSystem()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(testFile)
+	bytes, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bytes) != "contents" {
+		t.Fatal("Incorrect file contents:\n", string(bytes))
+	}
+	if err := change.ExecuteUsing(NewLocalFileSystem()); err == nil {
+		t.Fatal("CreateFile should fail if the file exists")
+	}
+}
+
 func TestCreateFile2Remove(t *testing.T) {
 	fs := NewLocalFileSystem()
 	if err := fs.CreateFile(testFile, ""); err != nil {
@@ -177,6 +203,26 @@ Line 3
 	}
 }
 
+func TestPatchOnChangedFile(t *testing.T) {
+	testfile := "testdata/lines.txt"
+
+	fs := &LocalFileSystem{}
+	es := text.NewEditSet()
+	es.Add(&text.Extent{0, 0}, "Before line 1\n")
+	es.SetBase([]byte("Contents before the file changed\n"))
+
+	_, err := CreatePatch(es, fs, testfile)
+	if stale, ok := err.(*text.StaleError); !ok || stale.Filename != testfile {
+		t.Fatalf("CreatePatch should return a StaleError for %s (%v)",
+			testfile, err)
+	}
+	_, err = ApplyEdits(es, fs, testfile)
+	if stale, ok := err.(*text.StaleError); !ok || stale.Filename != testfile {
+		t.Fatalf("ApplyEdits should return a StaleError for %s (%v)",
+			testfile, err)
+	}
+}
+
 func TestPatchOnMissingFile(t *testing.T) {
 	fileDNE := "this_file_does_not_exist_ZzZzZz.txt"
 
@@ -193,6 +239,26 @@ func TestPatchOnMissingFile(t *testing.T) {
 	}
 }
 
+func TestIsFakeStdinPath(t *testing.T) {
+	stdin, err := FakeStdinPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{stdin, FakeStdinFilename,
+		filepath.Join(".", FakeStdinFilename),
+		filepath.Join(filepath.Dir(stdin), "x", "..", FakeStdinFilename)} {
+		if !IsFakeStdinPath(path) {
+			t.Errorf("%s should denote the fake stdin file", path)
+		}
+	}
+	for _, path := range []string{testFile,
+		filepath.Join("x", FakeStdinFilename)} {
+		if IsFakeStdinPath(path) {
+			t.Errorf("%s should not denote the fake stdin file", path)
+		}
+	}
+}
+
 func TestLoader(t *testing.T) {
 	local := NewLocalFileSystem()
 	var lconfig loader.Config
@@ -215,3 +281,119 @@ func TestLoader(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// A failingChange is a Change whose execution always fails.
+type failingChange struct{}
+
+func (c *failingChange) ExecuteUsing(fs FileSystem) error {
+	return fmt.Errorf("change failed")
+}
+
+func (c *failingChange) String(relativeTo string) string {
+	return "fail"
+}
+
+func TestEditTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file1 := filepath.Join(dir, "a.txt")
+	file2 := filepath.Join(dir, "b.txt")
+	created := filepath.Join(dir, "c.txt")
+	for _, f := range []string{file1, file2} {
+		if err := ioutil.WriteFile(f, []byte("contents\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contentsOf := func(f string) string {
+		data, _ := ioutil.ReadFile(f)
+		return string(data)
+	}
+	newTransaction := func(length2 int, changes ...Change) *EditTransaction {
+		edits := map[string]*text.EditSet{
+			file1: text.NewEditSet(),
+			file2: text.NewEditSet(),
+		}
+		edits[file1].Add(&text.Extent{0, 8}, "first")
+		edits[file2].Add(&text.Extent{0, length2}, "second")
+		return NewEditTransaction(edits, changes)
+	}
+	fs := NewLocalFileSystem()
+
+	// The second edit is out of bounds, so neither file is modified
+	tx := newTransaction(100)
+	if err := tx.Validate(fs); err == nil {
+		t.Fatal("Validate should fail for an edit beyond the end of a file")
+	}
+	if err := tx.Apply(fs); err == nil || contentsOf(file1) != "contents\n" {
+		t.Fatalf("Apply should fail without modifying files (%v)", err)
+	}
+
+	// The last change fails, so the edits and creation are undone
+	tx = newTransaction(8, &CreateFile{created, "created"}, &failingChange{})
+	if err := tx.Apply(fs); err == nil {
+		t.Fatal("Apply should fail when a change fails")
+	}
+	if contentsOf(file1) != "contents\n" || contentsOf(file2) != "contents\n" {
+		t.Fatal("Edited files were not restored")
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Fatal("Created file was not removed")
+	}
+
+	// A created directory is removed, along with the file created in it
+	newDir := filepath.Join(dir, "pkg")
+	tx = newTransaction(8, &CreateDirectory{newDir},
+		&CreateFile{filepath.Join(newDir, "pkg.go"), "package pkg\n"},
+		&failingChange{})
+	if err := tx.Apply(fs); err == nil {
+		t.Fatal("Apply should fail when a change fails")
+	}
+	if _, err := os.Stat(newDir); !os.IsNotExist(err) {
+		t.Fatal("Created directory was not removed")
+	}
+
+	tx = newTransaction(8, &CreateFile{created, "created"})
+	if err := tx.Apply(fs); err != nil {
+		t.Fatal(err)
+	}
+	if contentsOf(file1) != "first\n" || contentsOf(file2) != "second\n" ||
+		contentsOf(created) != "created" {
+		t.Fatal("Transaction was not applied correctly")
+	}
+
+	// The file to create now exists
+	if err := newTransaction(0, &CreateFile{created, "x"}).Validate(fs); err == nil {
+		t.Fatal("Validate should fail if a file to create exists")
+	}
+}
+
+func TestCreateDirectoryChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pkg")
+	change := &CreateDirectory{Path: path}
+	if s := change.String(dir); s != "create directory pkg" {
+		t.Fatalf("Incorrect description: %s", s)
+	}
+	if err := change.ExecuteUsing(NewLocalFileSystem()); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		t.Fatalf("Directory was not created (%v)", err)
+	}
+	if err := change.ExecuteUsing(NewLocalFileSystem()); err == nil {
+		t.Fatal("CreateDirectory should fail if the directory exists")
+	}
+	tx := NewEditTransaction(nil, []Change{change})
+	if err := tx.Validate(NewLocalFileSystem()); err == nil {
+		t.Fatal("Validate should fail if a directory to create exists")
+	}
+}
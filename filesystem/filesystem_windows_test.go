@@ -0,0 +1,35 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package filesystem
+
+import "testing"
+
+func TestSamePathWindows(t *testing.T) {
+	same := [][2]string{
+		{`C:\src\a.go`, `C:\src\a.go`},
+		{`C:\src\a.go`, `c:/src/a.go`},
+		{`C:\src\a.go`, `C:\src\.\b\..\A.GO`},
+		{`\\server\share\a.go`, `//server/share/a.go`},
+		{`\\server\share\a.go`, `\\SERVER\Share\dir\..\a.go`},
+	}
+	for _, paths := range same {
+		if !SamePath(paths[0], paths[1]) {
+			t.Errorf("%s and %s should be the same path",
+				paths[0], paths[1])
+		}
+	}
+
+	different := [][2]string{
+		{`C:\src\a.go`, `D:\src\a.go`},
+		{`C:\src\a.go`, `\\server\share\src\a.go`},
+		{`\\server\share\a.go`, `\\server\other\a.go`},
+	}
+	for _, paths := range different {
+		if SamePath(paths[0], paths[1]) {
+			t.Errorf("%s and %s should be different paths",
+				paths[0], paths[1])
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines EditTransaction, which groups the text edits to several
+// files with other changes to the file system, so that a refactoring's
+// changes are either applied completely or not at all.
+
+package filesystem
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// An EditTransaction is a set of text edits to existing files, together with
+// other changes to the file system (e.g., creating files), that must be
+// applied as a unit.  Apply checks that every change can be made before
+// making any of them, and if a change fails nonetheless, it undoes the changes
+// that were already made.
+type EditTransaction struct {
+	// Maps filenames to the text edits that should be applied to them
+	Edits map[string]*text.EditSet
+	// Changes to the file system, made (in order) after the text edits
+	Changes []Change
+}
+
+// NewEditTransaction returns a transaction containing the given edits and
+// file system changes.  Either may be nil.
+func NewEditTransaction(edits map[string]*text.EditSet, changes []Change) *EditTransaction {
+	if edits == nil {
+		edits = map[string]*text.EditSet{}
+	}
+	return &EditTransaction{Edits: edits, Changes: changes}
+}
+
+// Filenames returns the names of the files with text edits, sorted.
+func (t *EditTransaction) Filenames() []string {
+	filenames := make([]string, 0, len(t.Edits))
+	for filename := range t.Edits {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+// Validate determines whether this transaction can be applied to the given
+// file system: every edited file must exist, its edits must lie within the
+// file, its contents must match the base recorded in its EditSet (if any),
+// and every file to be created must not already exist.  It returns an error
+// describing the first problem found, or nil if there are none.
+func (t *EditTransaction) Validate(fs FileSystem) error {
+	_, _, err := t.read(fs)
+	return err
+}
+
+// read returns the current and edited contents of every file with edits,
+// keyed by filename, after checking that the transaction can be applied.
+func (t *EditTransaction) read(fs FileSystem) (map[string][]byte, map[string][]byte, error) {
+	oldContents := make(map[string][]byte, len(t.Edits))
+	newContents := make(map[string][]byte, len(t.Edits))
+	for _, filename := range t.Filenames() {
+		old, err := readFile(fs, filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		contents, err := ApplyEdits(t.Edits[filename], fs, filename)
+		if err != nil {
+			if _, ok := err.(*text.StaleError); !ok {
+				err = fmt.Errorf("%s: %v", filename, err)
+			}
+			return nil, nil, err
+		}
+		oldContents[filename] = old
+		newContents[filename] = contents
+	}
+	for _, change := range t.Changes {
+		switch c := change.(type) {
+		case *CreateFile:
+			if f, err := fs.OpenFile(c.Path); err == nil {
+				f.Close()
+				return nil, nil, fmt.Errorf("Path already exists: %s",
+					c.Path)
+			}
+		case *CreateDirectory:
+			if _, err := fs.ReadDir(c.Path); err == nil {
+				return nil, nil, fmt.Errorf("Path already exists: %s",
+					c.Path)
+			}
+		}
+	}
+	return oldContents, newContents, nil
+}
+
+// Apply applies this transaction to the given file system: it overwrites the
+// edited files (in sorted order) and then makes the other changes.  If the
+// transaction is not valid (see Validate), an error is returned, and the file
+// system is not modified.  If a change fails after others have been made, the
+// files that were already overwritten are restored and the files that were
+// already created are removed (as far as possible) before the error is
+// returned.
+func (t *EditTransaction) Apply(fs FileSystem) error {
+	oldContents, newContents, err := t.read(fs)
+	if err != nil {
+		return err
+	}
+
+	written := []string{}
+	created := []string{}
+	rollback := func(err error) error {
+		for i := len(created) - 1; i >= 0; i-- {
+			fs.Remove(created[i])
+		}
+		for _, filename := range written {
+			writeFile(fs, filename, oldContents[filename])
+		}
+		return err
+	}
+
+	for _, filename := range t.Filenames() {
+		if err := writeFile(fs, filename, newContents[filename]); err != nil {
+			return rollback(err)
+		}
+		written = append(written, filename)
+	}
+	for _, change := range t.Changes {
+		if err := change.ExecuteUsing(fs); err != nil {
+			return rollback(err)
+		}
+		switch c := change.(type) {
+		case *CreateFile:
+			created = append(created, c.Path)
+		case *CreateDirectory:
+			created = append(created, c.Path)
+		}
+	}
+	return nil
+}
+
+// readFile returns the contents of the given file.
+func readFile(fs FileSystem, filename string) ([]byte, error) {
+	return ApplyEdits(text.NewEditSet(), fs, filename)
+}
+
+// writeFile replaces the contents of an existing file.
+func writeFile(fs FileSystem, filename string, data []byte) error {
+	f, err := fs.OverwriteFile(filename)
+	if err != nil {
+		return err
+	}
+	n, err := f.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
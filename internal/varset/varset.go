@@ -0,0 +1,85 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package varset provides set operations on lists of variables, such as those
+// used to determine the parameters, results, and local variables of an
+// extracted function.  Variables are compared by identity, so distinct
+// variables with the same name (e.g., a variable and one that shadows it) are
+// different elements.
+package varset
+
+import (
+	"go/types"
+	"sort"
+)
+
+// Sort sorts the given variables by name, ordering variables with the same
+// name by the positions of their declarations.
+func Sort(vars []*types.Var) {
+	sort.Slice(vars, func(i, j int) bool {
+		if vars[i].Name() != vars[j].Name() {
+			return vars[i].Name() < vars[j].Name()
+		}
+		return vars[i].Pos() < vars[j].Pos()
+	})
+}
+
+// Of returns the variables in the given set, sorted (see Sort).
+func Of(set map[*types.Var]struct{}) []*types.Var {
+	result := make([]*types.Var, 0, len(set))
+	for v := range set {
+		result = append(result, v)
+	}
+	Sort(result)
+	return result
+}
+
+// Contains returns true if v is one of the given variables.
+func Contains(vars []*types.Var, v *types.Var) bool {
+	for _, elt := range vars {
+		if elt == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersection returns the variables that are in both s1 and s2, in the
+// order they appear in s1.
+func Intersection(s1, s2 []*types.Var) []*types.Var {
+	result := []*types.Var{}
+	for _, v := range s1 {
+		if Contains(s2, v) && !Contains(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Union returns the variables that are in s1, s2, or both, sorted (see
+// Sort).
+func Union(s1, s2 []*types.Var) []*types.Var {
+	result := []*types.Var{}
+	for _, vars := range [][]*types.Var{s1, s2} {
+		for _, v := range vars {
+			if !Contains(result, v) {
+				result = append(result, v)
+			}
+		}
+	}
+	Sort(result)
+	return result
+}
+
+// Difference returns the variables in s1 that are not in s2, in the order
+// they appear in s1.
+func Difference(s1, s2 []*types.Var) []*types.Var {
+	result := []*types.Var{}
+	for _, v := range s1 {
+		if !Contains(s2, v) && !Contains(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package varset
+
+import (
+	"go/token"
+	"go/types"
+	"testing"
+	"testing/quick"
+)
+
+// pool contains the variables from which sets are chosen in the property
+// tests.  Several variables have the same name, as a variable and one that
+// shadows it would.
+var pool = func() []*types.Var {
+	names := []string{"x", "y", "x", "z", "_", "y", "_", "a"}
+	result := []*types.Var{}
+	for i, name := range names {
+		result = append(result,
+			types.NewVar(token.Pos(i+1), nil, name, types.Typ[types.Int]))
+	}
+	return result
+}()
+
+// subset returns the variables in pool whose bits are set in mask.  If dup
+// is nonzero, the variables whose bits are set in dup are repeated.
+func subset(mask, dup uint8) []*types.Var {
+	result := []*types.Var{}
+	for i, v := range pool {
+		if mask&(1<<uint(i)) != 0 {
+			result = append(result, v)
+			if dup&(1<<uint(i)) != 0 {
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+// isSet returns true if vars contains no duplicates.
+func isSet(vars []*types.Var) bool {
+	for i, v := range vars {
+		if Contains(vars[:i], v) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestUnion(t *testing.T) {
+	property := func(m1, d1, m2, d2 uint8) bool {
+		s1, s2 := subset(m1, d1), subset(m2, d2)
+		union := Union(s1, s2)
+		for _, v := range pool {
+			if Contains(union, v) != (Contains(s1, v) || Contains(s2, v)) {
+				return false
+			}
+		}
+		return isSet(union)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIntersection(t *testing.T) {
+	property := func(m1, d1, m2, d2 uint8) bool {
+		s1, s2 := subset(m1, d1), subset(m2, d2)
+		intersection := Intersection(s1, s2)
+		for _, v := range pool {
+			if Contains(intersection, v) != (Contains(s1, v) && Contains(s2, v)) {
+				return false
+			}
+		}
+		return isSet(intersection)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDifference(t *testing.T) {
+	property := func(m1, d1, m2, d2 uint8) bool {
+		s1, s2 := subset(m1, d1), subset(m2, d2)
+		difference := Difference(s1, s2)
+		for _, v := range pool {
+			if Contains(difference, v) != (Contains(s1, v) && !Contains(s2, v)) {
+				return false
+			}
+		}
+		// s1 = (s1 - s2) + (s1 * s2)
+		restored := Union(difference, Intersection(s1, s2))
+		return isSet(difference) &&
+			len(restored) == len(Union(s1, nil)) &&
+			len(Intersection(restored, s1)) == len(restored)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSort(t *testing.T) {
+	property := func(mask uint8) bool {
+		vars := subset(mask, 0)
+		Sort(vars)
+		for i := 1; i < len(vars); i++ {
+			prev, v := vars[i-1], vars[i]
+			if prev.Name() > v.Name() ||
+				prev.Name() == v.Name() && prev.Pos() > v.Pos() {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOf(t *testing.T) {
+	set := map[*types.Var]struct{}{pool[2]: {}, pool[0]: {}, pool[7]: {}}
+	vars := Of(set)
+	if len(vars) != 3 || vars[0] != pool[7] || vars[1] != pool[0] ||
+		vars[2] != pool[2] {
+		t.Errorf("Of returned %v", vars)
+	}
+}
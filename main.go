@@ -23,6 +23,9 @@ var version string = "0.6 (Beta)"
 
 func main() {
 	aboutText := fmt.Sprintf("%s %s", name, version)
-	engine.AddDefaultRefactorings()
+	if err := engine.AddDefaultRefactoringsErr(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	os.Exit(cli.Run(aboutText, os.Stdin, os.Stdout, os.Stderr, os.Args))
 }
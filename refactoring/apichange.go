@@ -0,0 +1,67 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines APIChange, which describes how a refactoring changes the
+// exported API of a package (e.g., when Rename changes an exported name), so
+// that library maintainers can review the effect on code outside the module.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// An APIChange describes a change to the exported API of a package, in the
+// style of the apidiff tool (golang.org/x/exp/apidiff).
+type APIChange struct {
+	// The import path of the package
+	Package string
+	// The name of the declaration that changed, qualified by the name of
+	// its type for a method or field (e.g., "T.M")
+	Name string
+	// Describes the change (e.g., "removed" or "added")
+	Message string
+	// True if the change cannot break code outside the package (e.g.,
+	// adding a function); false if it can (e.g., removing one)
+	Compatible bool
+}
+
+// APIReport formats the given changes as apidiff does: for each package,
+// the incompatible changes are listed first, then the compatible changes.
+// It returns "" if there are no changes.
+func APIReport(changes []APIChange) string {
+	byPackage := map[string][]APIChange{}
+	paths := []string{}
+	for _, change := range changes {
+		if byPackage[change.Package] == nil {
+			paths = append(paths, change.Package)
+		}
+		byPackage[change.Package] = append(byPackage[change.Package], change)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	for _, path := range paths {
+		fmt.Fprintf(&buf, "%s\n", path)
+		for _, compatible := range []bool{false, true} {
+			heading := "Incompatible changes:"
+			if compatible {
+				heading = "Compatible changes:"
+			}
+			for _, change := range byPackage[path] {
+				if change.Compatible != compatible {
+					continue
+				}
+				if heading != "" {
+					fmt.Fprintf(&buf, "%s\n", heading)
+					heading = ""
+				}
+				fmt.Fprintf(&buf, "- %s: %s\n", change.Name, change.Message)
+			}
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,357 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines BuildConfig, which determines the target operating
+// system, architecture, and build tags under which a program is loaded, and
+// RunInConfigurations, which runs a refactoring under several build
+// configurations and merges the results.  This allows (e.g.) an identifier to
+// be renamed in files that are only compiled on Linux as well as files that
+// are only compiled on Windows.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/build"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// A BuildConfig describes the build configuration under which a program is
+// loaded.  Empty fields are determined from the environment (i.e., the zero
+// value is the default build configuration).
+type BuildConfig struct {
+	// The target operating system (e.g., "linux"), i.e., GOOS
+	GOOS string
+	// The target architecture (e.g., "amd64"), i.e., GOARCH
+	GOARCH string
+	// Build tags (e.g., "integration") that are satisfied
+	Tags []string
+}
+
+// String returns a description of this build configuration, such as
+// "windows/amd64" or "linux/* (tags: integration)", which also serves as a
+// key identifying it.
+func (b BuildConfig) String() string {
+	goos, goarch := b.GOOS, b.GOARCH
+	if goos == "" {
+		goos = "*"
+	}
+	if goarch == "" {
+		goarch = "*"
+	}
+	result := goos + "/" + goarch
+	if len(b.Tags) > 0 {
+		result += fmt.Sprintf(" (tags: %s)", strings.Join(b.Tags, ","))
+	}
+	return result
+}
+
+// ParseBuildConfigs parses a comma-separated list of target platforms of the
+// form GOOS or GOOS/GOARCH (e.g., "linux/amd64,windows"), returning one build
+// configuration for each, with the given build tags.  If the list is empty,
+// a single build configuration is returned with the given tags and the
+// default GOOS and GOARCH.
+func ParseBuildConfigs(platforms string, tags []string) ([]BuildConfig, error) {
+	if strings.TrimSpace(platforms) == "" {
+		return []BuildConfig{{Tags: tags}}, nil
+	}
+	result := []BuildConfig{}
+	for _, platform := range strings.Split(platforms, ",") {
+		platform = strings.TrimSpace(platform)
+		parts := strings.Split(platform, "/")
+		if len(parts) > 2 || parts[0] == "" ||
+			(len(parts) == 2 && parts[1] == "") {
+			return nil, fmt.Errorf("Invalid platform \"%s\" "+
+				"(expected GOOS or GOOS/GOARCH, e.g., "+
+				"linux/amd64)", platform)
+		}
+		build := BuildConfig{GOOS: parts[0], Tags: tags}
+		if len(parts) == 2 {
+			build.GOARCH = parts[1]
+		}
+		result = append(result, build)
+	}
+	return result, nil
+}
+
+// env returns the environment variables that select this build configuration.
+func (b BuildConfig) env() []string {
+	result := []string{}
+	if b.GOOS != "" {
+		result = append(result, "GOOS="+b.GOOS)
+	}
+	if b.GOARCH != "" {
+		result = append(result, "GOARCH="+b.GOARCH)
+	}
+	return result
+}
+
+// buildFlags returns the flags for the go command that select this build
+// configuration's build tags.
+func (b BuildConfig) buildFlags() []string {
+	if len(b.Tags) == 0 {
+		return nil
+	}
+	return []string{"-tags=" + strings.Join(b.Tags, ",")}
+}
+
+// Context returns a build context (based on build.Default) for this build
+// configuration, which reads files from the given file system.  It can be used
+// to determine which files are excluded from the build by build constraints.
+func (b BuildConfig) Context(fs filesystem.FileSystem) *build.Context {
+	ctxt := build.Default
+	if b.GOOS != "" {
+		ctxt.GOOS = b.GOOS
+	}
+	if b.GOARCH != "" {
+		ctxt.GOARCH = b.GOARCH
+	}
+	ctxt.BuildTags = b.Tags
+	ctxt.OpenFile = fs.OpenFile
+	ctxt.ReadDir = fs.ReadDir
+	ctxt.IsDir = nil     // not provided by FileSystem
+	ctxt.HasSubdir = nil // not provided by FileSystem
+	return &ctxt
+}
+
+// RunInConfigurations runs the given refactoring once for each of the given
+// build configurations (see Config.Build) and merges the results.  The
+// results are cached by build configuration, so a configuration that is
+// listed more than once is only analyzed once.
+//
+// The merged Result contains the union of the edits made in each build
+// configuration; edits that several configurations make identically (e.g., to
+// a file that is compiled on every platform) are included only once.  If two
+// configurations require conflicting edits, an error is logged.  Log entries
+// that occur in every configuration are included as-is; other entries are
+// prefixed with the configuration(s) in which they occurred.
+func RunInConfigurations(r Refactoring, config *Config, builds []BuildConfig) *Result {
+	if len(builds) == 0 {
+		return r.Run(config)
+	}
+
+	keys := []string{}
+	results := map[string]*Result{}
+	for _, build := range builds {
+		key := build.String()
+		if _, found := results[key]; found {
+			continue
+		}
+		c := *config
+		c.Env = append([]string{}, config.Env...)
+		c.Build = build
+		results[key] = detachResult(r.Run(&c))
+		keys = append(keys, key)
+	}
+	if len(keys) == 1 {
+		return results[keys[0]]
+	}
+	return mergeResults(keys, results, config.FileSystem)
+}
+
+// detachResult returns a copy of the given Result, which is the Result
+// embedded in a refactoring's RefactoringBase, so that it is not reset when
+// the refactoring is run again.
+func detachResult(result *Result) *Result {
+	copy := &Result{
+		Log:         result.Log,
+		Edits:       result.Edits,
+		FSChanges:   result.FSChanges,
+		Occurrences: result.Occurrences,
+		APIChanges:  result.APIChanges,
+	}
+	copy.DebugOutput.Write(result.DebugOutput.Bytes())
+	return copy
+}
+
+// mergeResults merges the Results of running a refactoring in several build
+// configurations, given the keys identifying the configurations (in order).
+// See RunInConfigurations.
+func mergeResults(keys []string, results map[string]*Result, fs filesystem.FileSystem) *Result {
+	merged := &Result{
+		Log:       NewLog(),
+		Edits:     map[string]*text.EditSet{},
+		FSChanges: []filesystem.Change{},
+	}
+	merged.Log.Fset = results[keys[0]].Log.Fset
+	mergeLogs(merged.Log, keys, results, fs)
+
+	type occurrence struct {
+		filename string
+		extent   text.Extent
+	}
+	seenOccurrences := map[occurrence]bool{}
+	seenChanges := map[string]bool{}
+	seenAPIChanges := map[APIChange]bool{}
+	for _, key := range keys {
+		result := results[key]
+		for _, filename := range sortedFilenames(result.Edits) {
+			mergeEdits(merged, key, filename, result.Edits[filename])
+		}
+		for _, occ := range result.Occurrences {
+			o := occurrence{occ.Filename, *occ.Extent}
+			if !seenOccurrences[o] {
+				seenOccurrences[o] = true
+				merged.Occurrences = append(merged.Occurrences, occ)
+			}
+		}
+		for _, change := range result.APIChanges {
+			if !seenAPIChanges[change] {
+				seenAPIChanges[change] = true
+				merged.APIChanges = append(merged.APIChanges, change)
+			}
+		}
+		for _, change := range result.FSChanges {
+			desc := fmt.Sprintf("%#v", change)
+			if !seenChanges[desc] {
+				seenChanges[desc] = true
+				merged.FSChanges = append(merged.FSChanges, change)
+			}
+		}
+		merged.DebugOutput.Write(result.DebugOutput.Bytes())
+	}
+	return merged
+}
+
+// mergeEdits adds the given edits to a file, made in the build configuration
+// with the given key, to the merged Result, logging an error if they conflict
+// with edits made in another build configuration.
+func mergeEdits(merged *Result, key, filename string, edits *text.EditSet) {
+	existing := merged.Edits[filename]
+	if existing == nil {
+		existing = text.NewEditSet()
+		existing.SetBaseHash(edits.BaseHash())
+		merged.Edits[filename] = existing
+	}
+	replacements := map[text.Extent]string{}
+	existing.Iterate(func(extent *text.Extent, replacement string) bool {
+		replacements[*extent] = replacement
+		return true
+	})
+	edits.Iterate(func(extent *text.Extent, replacement string) bool {
+		if r, found := replacements[*extent]; found && r == replacement {
+			return true
+		}
+		if err := existing.Add(extent, replacement); err != nil {
+			merged.Log.Errorf("The changes to %s in the %s build "+
+				"configuration conflict with the changes in "+
+				"another configuration", filename, key)
+			return false
+		}
+		return true
+	})
+}
+
+// mergeLogs adds the log entries from the given results to the given Log,
+// whose Fset is the FileSet of the first result.  See RunInConfigurations.
+func mergeLogs(log *Log, keys []string, results map[string]*Result, fs filesystem.FileSystem) {
+	type entryKey struct {
+		severity Severity
+		message  string
+		pos      string
+	}
+	order := []entryKey{}
+	entries := map[entryKey]*Entry{}
+	configs := map[entryKey][]string{}
+	m := newPosMapper(log.Fset, fs)
+	for _, key := range keys {
+		from := results[key].Log.Fset
+		for _, entry := range results[key].Log.Entries {
+			e := *entry
+			e.Pos = m.remap(from, entry.Pos)
+			e.End = m.remap(from, entry.End)
+			e.Related = nil
+			for _, rel := range entry.Related {
+				e.Related = append(e.Related, &Related{
+					Message: rel.Message,
+					Pos:     m.remap(from, rel.Pos),
+					End:     m.remap(from, rel.End),
+				})
+			}
+			k := entryKey{e.Severity, e.Message, ""}
+			if e.Pos.IsValid() {
+				k.pos = log.Fset.Position(e.Pos).String()
+			}
+			if _, found := entries[k]; !found {
+				order = append(order, k)
+				entries[k] = &e
+			}
+			if n := len(configs[k]); n == 0 || configs[k][n-1] != key {
+				configs[k] = append(configs[k], key)
+			}
+		}
+	}
+	for _, k := range order {
+		entry := entries[k]
+		if len(configs[k]) < len(keys) {
+			entry.Message = fmt.Sprintf("(%s) %s",
+				strings.Join(configs[k], "; "), entry.Message)
+		}
+		log.Entries = append(log.Entries, entry)
+	}
+}
+
+// A posMapper converts positions in one FileSet to the corresponding
+// positions in another, adding files to the latter FileSet as needed.
+type posMapper struct {
+	to    *token.FileSet
+	fs    filesystem.FileSystem
+	files map[string]*token.File
+}
+
+func newPosMapper(to *token.FileSet, fs filesystem.FileSystem) *posMapper {
+	m := &posMapper{to: to, fs: fs, files: map[string]*token.File{}}
+	if to != nil {
+		to.Iterate(func(f *token.File) bool {
+			m.files[f.Name()] = f
+			return true
+		})
+	}
+	return m
+}
+
+// remap converts a position in the given FileSet to the corresponding
+// position in the target FileSet.  If the file is not in the target FileSet,
+// it is added (and its contents are read from the file system to determine
+// where its lines begin).  It returns token.NoPos if the position cannot be
+// converted.
+func (m *posMapper) remap(from *token.FileSet, pos token.Pos) token.Pos {
+	if !pos.IsValid() || from == nil || m.to == nil {
+		return token.NoPos
+	}
+	if from == m.to {
+		return pos
+	}
+	file := from.File(pos)
+	if file == nil {
+		return token.NoPos
+	}
+	target := m.files[file.Name()]
+	if target == nil || target.Size() != file.Size() {
+		target = m.to.AddFile(file.Name(), -1, file.Size())
+		if reader, err := m.fs.OpenFile(file.Name()); err == nil {
+			if contents, err := ioutil.ReadAll(reader); err == nil {
+				target.SetLinesForContent(contents)
+			}
+		}
+		m.files[file.Name()] = target
+	}
+	return target.Pos(file.Offset(pos))
+}
+
+// sortedFilenames returns the keys of the given map in sorted order.
+func sortedFilenames(edits map[string]*text.EditSet) []string {
+	result := make([]string, 0, len(edits))
+	for filename := range edits {
+		result = append(result, filename)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,113 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestParseBuildConfigs(t *testing.T) {
+	builds, err := ParseBuildConfigs("linux/amd64, windows", []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := fmt.Sprintf("%v", builds)
+	expected := "[linux/amd64 (tags: a) windows/* (tags: a)]"
+	if actual != expected {
+		t.Fatalf("Expected %s, got %s", expected, actual)
+	}
+
+	builds, err = ParseBuildConfigs("", nil)
+	if err != nil || len(builds) != 1 || builds[0].String() != "*/*" {
+		t.Fatalf("Expected default configuration, got %v (%v)",
+			builds, err)
+	}
+
+	for _, invalid := range []string{"linux/", "/amd64", "a/b/c", "linux,"} {
+		if _, err := ParseBuildConfigs(invalid, nil); err == nil {
+			t.Fatalf("Expected error parsing %s", invalid)
+		}
+	}
+}
+
+func TestRunInConfigurations(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	dir := filepath.Join(gopath, "src", "example.com", "app")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"main.go":           "package main\n\nfunc main() {\n\thelper()\n}\n",
+		"helper_linux.go":   "package main\n\nfunc helper() {}\n",
+		"helper_windows.go": "package main\n\nfunc helper() {}\n",
+		"helper_darwin.go":  "package main\n\nfunc helper() {}\n",
+		"helper_integ.go":   "// +build integ\n\npackage main\n\nfunc integ() { helper() }\n",
+	}
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mainFile := filepath.Join(dir, "main.go")
+	run := func(builds []BuildConfig) *Result {
+		return RunInConfigurations(new(Rename), &Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Scope:      []string{"example.com/app"},
+			Selection: &text.LineColSelection{
+				Filename:  mainFile,
+				StartLine: 4, StartCol: 2,
+				EndLine: 4, EndCol: 2,
+			},
+			Args:       []interface{}{"assist"},
+			GoPath:     gopath,
+			ModulesOff: true,
+			Dir:        dir,
+		}, builds)
+	}
+
+	builds, err := ParseBuildConfigs("linux/amd64,windows/amd64,linux/amd64",
+		[]string{"integ"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := run(builds)
+	if result.Log.ContainsErrors() {
+		t.Fatal(result.Log)
+	}
+	actual := fmt.Sprintf("%v", editedFiles(result, dir))
+	expected := "[helper_integ.go helper_linux.go helper_windows.go main.go]"
+	if actual != expected {
+		t.Fatalf("Expected edits to %s, got %s", expected, actual)
+	}
+	if n := result.Edits[mainFile].Len(); n != 1 {
+		t.Fatalf("Expected 1 edit to main.go, got %d", n)
+	}
+}
+
+// editedFiles returns the names (relative to dir) of the files with edits.
+func editedFiles(result *Result, dir string) []string {
+	names := []string{}
+	for _, filename := range sortedFilenames(result.Edits) {
+		if result.Edits[filename].Len() > 0 {
+			rel, _ := filepath.Rel(dir, filename)
+			names = append(names, rel)
+		}
+	}
+	return names
+}
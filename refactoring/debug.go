@@ -13,6 +13,7 @@ package refactoring
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"go/ast"
 	"go/parser"
@@ -49,6 +50,9 @@ If an identifier is selected:
     showaffected      Show names affected if the selected identifier is renamed
     showreferences    Show all direct references to the selected identifier
 
+If an identifier or expression is selected:
+    showtypeinfo      Show the type, object, enclosing scopes, etc. as JSON
+
 If a function is selected...
     showcfg           Output the control flow graph (CFG) in GraphViz DOT format
     showdefuse        Output CFG with def-use information GraphViz DOT format
@@ -75,7 +79,8 @@ func (r *Debug) Description() *Description {
 			Prompt:       "Command",
 			DefaultValue: "",
 		}},
-		Hidden: true,
+		Hidden:  true,
+		Quality: Development,
 	}
 }
 
@@ -113,6 +118,8 @@ func (r *Debug) Run(config *Config) *Result {
 		r.showLoadedPackagesAndFiles(&r.DebugOutput)
 	case "showreferences":
 		r.showReferences(&r.DebugOutput)
+	case "showtypeinfo":
+		r.showTypeInfo(&r.DebugOutput)
 	default:
 		r.Log.Errorf("Unknown option %s", command)
 	}
@@ -422,3 +429,197 @@ func (r *Debug) showReferences(out io.Writer) {
 		return
 	}
 }
+
+// typeInfo is the JSON output of showtypeinfo.
+type typeInfo struct {
+	Node        string       `json:"node"`
+	Expr        string       `json:"expr,omitempty"`
+	Type        string       `json:"type,omitempty"`
+	Value       string       `json:"value,omitempty"`
+	Addressable bool         `json:"addressable"`
+	Assignable  bool         `json:"assignable"`
+	Object      *objectInfo  `json:"object,omitempty"`
+	Scopes      []*scopeInfo `json:"scopes"`
+}
+
+// objectInfo describes the object referenced by the selected identifier (or
+// the selector, if a selector expression is selected).
+type objectInfo struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Type     string `json:"type"`
+	Package  string `json:"package,omitempty"`
+	Declared string `json:"declared,omitempty"`
+	Exported bool   `json:"exported"`
+}
+
+// scopeInfo describes one scope in the chain of scopes enclosing the
+// selection, from innermost to outermost.
+type scopeInfo struct {
+	Kind     string   `json:"kind"`
+	Position string   `json:"position,omitempty"`
+	Names    []string `json:"names,omitempty"`
+}
+
+func (r *Debug) showTypeInfo(out io.Writer) {
+	if r.SelectedNode == nil {
+		r.Log.Error("Please select an identifier or expression for showtypeinfo")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return
+	}
+
+	pkgInfo := r.SelectedNodePkg
+	info := &typeInfo{
+		Node:   reflect.TypeOf(r.SelectedNode).String(),
+		Scopes: r.describeScopes(pkgInfo, r.SelectedNode.Pos()),
+	}
+
+	if expr, ok := r.SelectedNode.(ast.Expr); ok {
+		var b bytes.Buffer
+		if err := printer.Fprint(&b, r.Program.Fset, expr); err == nil {
+			info.Expr = b.String()
+		}
+		if tv, ok := pkgInfo.TypesInfo.Types[expr]; ok {
+			if tv.Type != nil {
+				info.Type = tv.Type.String()
+			}
+			if tv.Value != nil {
+				info.Value = tv.Value.String()
+			}
+			info.Addressable = tv.Addressable()
+			info.Assignable = tv.Assignable()
+		}
+	}
+
+	id, ok := r.SelectedNode.(*ast.Ident)
+	if sel, isSel := r.SelectedNode.(*ast.SelectorExpr); isSel {
+		id, ok = sel.Sel, true
+	}
+	if ok {
+		if obj := pkgInfo.TypesInfo.ObjectOf(id); obj != nil {
+			info.Object = r.describeObject(obj)
+			if info.Type == "" && obj.Type() != nil {
+				info.Type = obj.Type().String()
+			}
+			if _, isVar := obj.(*types.Var); isVar &&
+				pkgInfo.TypesInfo.Defs[id] == obj {
+				// A declared variable is not in TypesInfo.Types
+				info.Addressable = true
+				info.Assignable = true
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	fmt.Fprintf(out, "%s\n", data)
+}
+
+func (r *Debug) describeObject(obj types.Object) *objectInfo {
+	result := &objectInfo{
+		Name:     obj.Name(),
+		Kind:     objectKind(obj),
+		Exported: obj.Exported(),
+	}
+	if obj.Type() != nil {
+		result.Type = obj.Type().String()
+	}
+	if obj.Pkg() != nil {
+		result.Package = obj.Pkg().Path()
+	}
+	if obj.Pos().IsValid() {
+		result.Declared = r.Program.Fset.Position(obj.Pos()).String()
+	}
+	return result
+}
+
+// objectKind returns a short description of the kind of the given object,
+// e.g., "var" or "func".
+func objectKind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Var:
+		if obj.IsField() {
+			return "field"
+		}
+		return "var"
+	case *types.Func:
+		if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.Const:
+		return "const"
+	case *types.TypeName:
+		return "type"
+	case *types.PkgName:
+		return "package"
+	case *types.Label:
+		return "label"
+	case *types.Builtin:
+		return "builtin"
+	case *types.Nil:
+		return "nil"
+	default:
+		return reflect.TypeOf(obj).String()
+	}
+}
+
+// describeScopes returns the chain of scopes enclosing the given position,
+// from innermost to outermost.  The names in the universe scope are omitted.
+func (r *Debug) describeScopes(pkgInfo *packages.Package, pos token.Pos) []*scopeInfo {
+	nodes := map[*types.Scope]ast.Node{}
+	for node, scope := range pkgInfo.TypesInfo.Scopes {
+		nodes[scope] = node
+	}
+
+	result := []*scopeInfo{}
+	scope := pkgInfo.Types.Scope().Innermost(pos)
+	if scope == nil {
+		scope = pkgInfo.Types.Scope()
+	}
+	for ; scope != nil; scope = scope.Parent() {
+		info := &scopeInfo{Kind: scopeKind(scope, nodes[scope], pkgInfo)}
+		if scope.Pos().IsValid() {
+			info.Position = r.Program.Fset.Position(scope.Pos()).String()
+		}
+		if scope != types.Universe {
+			info.Names = scope.Names()
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// scopeKind returns a short description of the kind of the given scope,
+// based on the AST node that introduces it.
+func scopeKind(scope *types.Scope, node ast.Node, pkgInfo *packages.Package) string {
+	switch {
+	case scope == types.Universe:
+		return "universe"
+	case scope == pkgInfo.Types.Scope():
+		return "package"
+	}
+	switch node.(type) {
+	case *ast.File:
+		return "file"
+	case *ast.FuncType:
+		return "function"
+	case *ast.BlockStmt:
+		return "block"
+	case *ast.IfStmt:
+		return "if"
+	case *ast.ForStmt, *ast.RangeStmt:
+		return "for"
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+		return "switch"
+	case *ast.CaseClause:
+		return "case"
+	case *ast.CommClause:
+		return "select case"
+	default:
+		return "scope"
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines DeclSelection, which selects a declaration by name (e.g.,
+// "Func", "Type.Method", or "example.com/pkg.Type.Method") rather than by
+// line/column or offset.  Scripts that apply the same refactoring to many
+// programs (e.g., bulk codemods or CI bots) can use this instead of positions,
+// which change whenever a file is edited.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/loader"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/packages"
+)
+
+// A DeclSelection is a text.Selection that selects the name of a declaration.
+// Since a declaration can only be found by name once the program has been
+// loaded, it is resolved by RefactoringBase.Init (its Convert method always
+// returns an error).
+//
+// Name has the form [pkg.]Name or [pkg.]Type.Member, where pkg is a package's
+// import path or name, Name is a package-level function, type, variable, or
+// constant, and Member is a method or field declared in Type.  If Filename is
+// non-empty, only declarations in that file are considered; the package may
+// only be omitted if Filename is given.
+type DeclSelection struct {
+	Filename string
+	Name     string
+}
+
+// Convert returns an error, since a DeclSelection must be resolved against
+// the loaded program (see Init).
+func (d *DeclSelection) Convert(fset *token.FileSet) (token.Pos, token.Pos, error) {
+	return token.NoPos, token.NoPos, fmt.Errorf("The declaration %s "+
+		"cannot be found until the program is loaded", d.Name)
+}
+
+// GetFilename returns the file containing the declaration, or "" if a file
+// was not given.
+func (d *DeclSelection) GetFilename() string {
+	return d.Filename
+}
+
+func (d *DeclSelection) String() string {
+	if d.Filename == "" {
+		return d.Name
+	}
+	return fmt.Sprintf("%s: %s", d.Filename, d.Name)
+}
+
+// resolve finds the declaration with the given name in the loaded program,
+// returning the start and end positions of its name.  It returns an error if
+// the declaration cannot be found or if the name is ambiguous.
+func (d *DeclSelection) resolve(prog *loader.Program) (token.Pos, token.Pos, error) {
+	if strings.TrimSpace(d.Name) == "" {
+		return token.NoPos, token.NoPos,
+			fmt.Errorf("A declaration name must be given")
+	}
+
+	pkgs := make([]*packages.Package, 0, len(prog.AllPackages))
+	for _, pkg := range prog.AllPackages {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].ID < pkgs[j].ID })
+
+	var file *token.File
+	if d.Filename != "" {
+		if file = text.FindFile(prog.Fset, d.Filename); file == nil {
+			return token.NoPos, token.NoPos, fmt.Errorf(
+				"The file %s was not found or was not loaded",
+				d.Filename)
+		}
+	}
+
+	// A package may be loaded more than once (e.g., with and without its
+	// tests), so matches are identified by filename and offset
+	matches := []types.Object{}
+	found := map[string]bool{}
+	for _, pkg := range pkgs {
+		if pkg.Types == nil {
+			continue
+		}
+		for _, name := range d.unqualifiedNames(pkg) {
+			obj := lookupDecl(pkg.Types, name)
+			if obj == nil || !obj.Pos().IsValid() {
+				continue
+			}
+			pos := prog.Fset.Position(obj.Pos())
+			if file != nil && pos.Filename != file.Name() {
+				continue
+			}
+			key := fmt.Sprintf("%s:%d", pos.Filename, pos.Offset)
+			if !found[key] {
+				found[key] = true
+				matches = append(matches, obj)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		if d.Filename != "" {
+			return token.NoPos, token.NoPos, fmt.Errorf(
+				"The declaration %s was not found in %s",
+				d.Name, d.Filename)
+		}
+		return token.NoPos, token.NoPos, fmt.Errorf(
+			"The declaration %s was not found in the provided scope",
+			d.Name)
+	case 1:
+		obj := matches[0]
+		return obj.Pos(), obj.Pos() + token.Pos(len(obj.Name())), nil
+	default:
+		locations := []string{}
+		for _, obj := range matches {
+			locations = append(locations,
+				prog.Fset.Position(obj.Pos()).String())
+		}
+		return token.NoPos, token.NoPos, fmt.Errorf(
+			"The declaration %s is ambiguous; it could refer to "+
+				"any of the following: %s", d.Name,
+			strings.Join(locations, ", "))
+	}
+}
+
+// unqualifiedNames returns the possible names (of the form Name or
+// Type.Member) that the selection could denote in the given package.  If the
+// selected name begins with the package's import path or name, that prefix is
+// removed; an unqualified name may only denote a declaration in the selected
+// file.
+func (d *DeclSelection) unqualifiedNames(pkg *packages.Package) []string {
+	result := []string{}
+	for _, prefix := range []string{pkg.PkgPath, pkg.Name} {
+		if prefix != "" && strings.HasPrefix(d.Name, prefix+".") {
+			result = append(result, strings.TrimPrefix(d.Name, prefix+"."))
+		}
+	}
+	if d.Filename != "" {
+		result = append(result, d.Name)
+	}
+	return result
+}
+
+// lookupDecl returns the object declared in the given package with the given
+// name (of the form Name or Type.Member), or nil if there is no such object.
+// Promoted fields and methods are not considered, since they are not declared
+// in Type.
+func lookupDecl(pkg *types.Package, name string) types.Object {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return nil
+	}
+	obj := pkg.Scope().Lookup(parts[0])
+	if obj == nil || len(parts) == 1 {
+		return obj
+	}
+	if _, ok := obj.(*types.TypeName); !ok {
+		return nil
+	}
+	member, index, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg, parts[1])
+	if member == nil || len(index) != 1 {
+		return nil
+	}
+	return member
+}
@@ -0,0 +1,80 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+)
+
+func TestDeclSelection(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	files := map[string]string{
+		"lib/lib.go": "package lib\n\ntype T struct{ F int }\n\n" +
+			"func (t T) M() int { return t.F }\n\nfunc Helper() {}\n",
+		"main.go": "package main\n\nimport \"example.com/app/lib\"\n\n" +
+			"func Helper() {}\n\nfunc main() {\n\tlib.Helper()\n" +
+			"\tprintln(lib.T{}.M())\n}\n",
+	}
+	dir := filepath.Join(gopath, "src", "example.com", "app")
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// rename renames the selected declaration to X, returning the names
+	// of the edited files or the log, if it contains errors
+	rename := func(filename, name string) string {
+		if filename != "" {
+			filename = filepath.Join(dir, filename)
+		}
+		result := new(Rename).Run(&Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Scope:      []string{"example.com/app"},
+			Selection:  &DeclSelection{Filename: filename, Name: name},
+			Args:       []interface{}{"X"},
+			GoPath:     gopath,
+			ModulesOff: true,
+		})
+		if result.Log.ContainsErrors() {
+			return result.Log.String()
+		}
+		return strings.Join(editedFiles(result, dir), " ")
+	}
+
+	tests := []struct{ filename, name, expected string }{
+		{"", "example.com/app/lib.T.M", "lib/lib.go main.go"},
+		{"", "lib.T.F", "lib/lib.go"},
+		{"", "lib.Helper", "lib/lib.go main.go"},
+		{"", "main.Helper", "main.go"},
+		{"main.go", "Helper", "main.go"},
+		{"lib/lib.go", "T.M", "lib/lib.go main.go"},
+		{"", "Helper", "not found in the provided scope"},
+		{"main.go", "T.M", "not found in"},
+		{"", "lib.T.String", "not found in the provided scope"},
+	}
+	for _, test := range tests {
+		actual := rename(test.filename, test.name)
+		if !strings.Contains(actual, test.expected) {
+			t.Errorf("Renaming %s in %q: expected %s, got %s",
+				test.name, test.filename, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Apply Edit Script refactoring, which applies text
+// edits listed in a JSON file.  It allows external tools to make their own
+// mechanical changes with the same safeguards as the built-in refactorings:
+// the edited code is post-processed (e.g., reformatted), the edited program is
+// checked for errors, and the changes can be previewed as a patch.
+
+package refactoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// An EditScript refactoring applies the text edits listed in a JSON file
+// (an edit script), e.g.,
+//
+//	{
+//	    "edits": [
+//	        {"file": "main.go", "offset": 1200, "length": 3, "replacement": "bar"}
+//	    ]
+//	}
+//
+// Each edit replaces length bytes, starting at the given byte offset, with
+// the replacement text.  Relative filenames are resolved with respect to
+// the directory containing the edit script.  A relative path to the edit
+// script itself (the refactoring's argument) is resolved with respect to the
+// directory containing the file being refactored.
+type EditScript struct {
+	RefactoringBase
+}
+
+// A scriptEdit is a single text edit in an edit script.
+type scriptEdit struct {
+	File        string `json:"file"`
+	Offset      int    `json:"offset"`
+	Length      int    `json:"length"`
+	Replacement string `json:"replacement"`
+}
+
+func (r *EditScript) Description() *Description {
+	return &Description{
+		Name:      "Apply Edit Script",
+		Synopsis:  "Applies text edits listed in a JSON file",
+		Usage:     "<edit_script>",
+		HTMLDoc:   editScriptDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Edit Script:",
+			Prompt:       "Path of a JSON file listing the edits to apply (relative to this file's directory).",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+		Quality:        Testing,
+	}
+}
+
+func (r *EditScript) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	scriptFilename := config.Args[0].(string)
+	if !filepath.IsAbs(scriptFilename) {
+		scriptFilename = filepath.Join(filepath.Dir(r.Filename),
+			filepath.FromSlash(scriptFilename))
+	}
+	edits, err := readEditScript(scriptFilename)
+	if err != nil {
+		r.Log.Error(err)
+		return &r.Result
+	}
+	if len(edits) == 0 {
+		r.Log.Warnf("%s does not contain any edits", scriptFilename)
+		return &r.Result
+	}
+
+	files := newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+	for i, edit := range edits {
+		if edit.File == "" {
+			r.Log.Errorf("Edit %d does not specify a file", i+1)
+			continue
+		}
+		contents, err := files.read(edit.File)
+		if err != nil {
+			r.Log.Errorf("Edit %d: %v", i+1, err)
+			continue
+		}
+		if edit.Offset < 0 || edit.Length < 0 ||
+			edit.Offset+edit.Length > len(contents) {
+			r.Log.Errorf("Edit %d: offset %d and length %d are not "+
+				"within %s (%d bytes)", i+1, edit.Offset,
+				edit.Length, filepath.Base(edit.File), len(contents))
+			continue
+		}
+		if r.Edits[edit.File] == nil {
+			r.Edits[edit.File] = text.NewEditSet()
+		}
+		extent := &text.Extent{Offset: edit.Offset, Length: edit.Length}
+		if err := r.Edits[edit.File].Add(extent, edit.Replacement); err != nil {
+			r.Log.Errorf("Edit %d: %v in %s", i+1, err,
+				filepath.Base(edit.File))
+		}
+	}
+	if r.Log.ContainsErrors() {
+		r.Edits = map[string]*text.EditSet{}
+		return &r.Result
+	}
+
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// readEditScript reads the edits from the given edit script, resolving
+// relative filenames with respect to the directory containing it.
+func readEditScript(filename string) ([]*scriptEdit, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var script struct {
+		Edits []*scriptEdit `json:"edits"`
+	}
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	base, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	for _, edit := range script.Edits {
+		if edit.File == "" {
+			continue
+		}
+		edit.File = filepath.FromSlash(edit.File)
+		if !filepath.IsAbs(edit.File) {
+			edit.File = filepath.Join(base, edit.File)
+		}
+	}
+	return script.Edits, nil
+}
+
+const editScriptDoc = `
+  <h4>Purpose</h4>
+  <p>The Apply Edit Script refactoring applies a list of text edits produced
+  by another tool (e.g., a script that finds byte ranges with
+  <tt>grep -b</tt>).  The edits are applied in the same way as those of the
+  built-in refactorings: the edited code is reformatted (or post-processed
+  as configured with the <tt>-postprocess</tt> flag), the edited program is
+  checked for errors, and the changes can be previewed as a patch before they
+  are written.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Create a JSON file (the edit script) listing the edits.</li>
+    <li>Activate the Apply Edit Script refactoring.</li>
+    <li>Enter the path of the edit script.  A relative path is resolved with
+    respect to the directory containing the file being refactored.</li>
+  </ol>
+
+  <p>The edit script has the following form:</p>
+  <pre>{
+    "edits": [
+        {"file": "main.go", "offset": 1200, "length": 3, "replacement": "bar"}
+    ]
+}</pre>
+  <p>Each edit replaces <tt>length</tt> bytes, starting at the byte offset
+  <tt>offset</tt>, with the <tt>replacement</tt> text.  Offsets refer to the
+  original contents of the file, before any of the edits are applied.
+  Relative filenames are resolved with respect to the directory containing
+  the edit script.</p>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>An edit is outside the bounds of its file.</li>
+    <li>Two edits to the same file overlap.</li>
+    <li>The edits would introduce syntax or type errors into the program.</li>
+  </ul>
+`
@@ -0,0 +1,994 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Convert to errgroup refactoring, which replaces a
+// sync.WaitGroup and a channel of errors, used to run goroutines and report
+// the first error, with an errgroup.Group.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// errgroupPath is the import path of the errgroup package.
+const errgroupPath = "golang.org/x/sync/errgroup"
+
+// A ConvertToErrgroup refactoring rewrites code that starts goroutines using
+// a sync.WaitGroup, has them send errors on a channel, and receives the first
+// error after waiting, so that it uses an errgroup.Group instead.  Each
+// goroutine becomes a function passed to the group's Go method, which returns
+// the error it would have sent, and the first error is received from the
+// group's Wait method.  Every use of the WaitGroup and the channel must be
+// part of this pattern; otherwise, the uses that are not are reported.
+type ConvertToErrgroup struct {
+	RefactoringBase
+	groupName string // name of the errgroup.Group variable
+	limit     int    // argument to SetLimit, or 0 if there is no limit
+	// Whether each iteration of a loop declares new loop variables (Go
+	// 1.22 and later), so goroutines need not copy them
+	perIteration bool
+
+	wg   *types.Var     // the sync.WaitGroup (or *sync.WaitGroup)
+	errs *types.Var     // the channel on which goroutines send errors
+	body *ast.BlockStmt // body of the function declaring wg
+	// Statements declaring wg and errs
+	wgDecl, errsDecl ast.Stmt
+	// Goroutines that defer wg.Done() (in order), and the deferred calls
+	goStmts []*ast.GoStmt
+	dones   map[*ast.GoStmt]*ast.DeferStmt
+	// Sends on errs in the goroutines, mapped to the (bare) return
+	// statements that follow them, or to nil if the goroutine ends after
+	// the send
+	sends map[*ast.SendStmt]*ast.ReturnStmt
+	// Calls to wg.Add and close(errs), which are removed
+	removed []ast.Stmt
+	wait    ast.Stmt // wg.Wait()
+	// The expression that receives the first error (<-errs), or the
+	// for ... range errs statement that handles it
+	consumer ast.Node
+}
+
+func (r *ConvertToErrgroup) Description() *Description {
+	return &Description{
+		Name:      "Convert to errgroup",
+		Synopsis:  "Replaces a sync.WaitGroup and an error channel with an errgroup.Group",
+		Usage:     "<group_name> [<limit>]",
+		HTMLDoc:   convertToErrgroupDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Group Name:",
+			Prompt:       "Enter a name for the errgroup.Group variable.",
+			DefaultValue: "g",
+		}},
+		OptionalParams: []Parameter{{
+			Label:        "Limit:",
+			Prompt:       "Maximum number of goroutines that may run at once (default: no limit).",
+			DefaultValue: "",
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *ConvertToErrgroup) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.wg, r.errs, r.body, r.wgDecl, r.errsDecl = nil, nil, nil, nil, nil
+	r.goStmts, r.dones = nil, map[*ast.GoStmt]*ast.DeferStmt{}
+	r.sends = map[*ast.SendStmt]*ast.ReturnStmt{}
+	r.removed, r.wait, r.consumer = nil, nil, nil
+
+	if !r.parseArgs(config) || !r.findWaitGroup() {
+		return &r.Result
+	}
+	r.classifyWaitGroupUses()
+	if r.Log.ContainsErrors() || !r.findErrorChannel() {
+		return &r.Result
+	}
+	r.classifyErrorChannelUses()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.checkGoroutines()
+	r.checkOrder()
+	r.checkConsumer()
+	r.checkGroupName()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	dir := ""
+	if !config.ModulesOff {
+		dir = filepath.Dir(r.Filename)
+	}
+	r.perIteration, _ = goVersionAtLeast(dir, 22)
+	r.addEdits()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// parseArgs sets r.groupName and r.limit from the arguments.  If they are
+// invalid, it logs an error and returns false.
+func (r *ConvertToErrgroup) parseArgs(config *Config) bool {
+	r.groupName = strings.TrimSpace(config.Args[0].(string))
+	if !isIdentifierValid(r.groupName) || r.groupName == "_" {
+		r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
+			r.groupName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return false
+	}
+	r.limit = 0
+	if len(config.Args) > 1 {
+		limit := strings.TrimSpace(config.Args[1].(string))
+		if limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n <= 0 {
+				r.Log.Errorf("The limit must be a positive integer, not %q",
+					limit)
+				r.Log.AssociateCode(CodeInvalidArgs)
+				return false
+			}
+			r.limit = n
+		}
+	}
+	return true
+}
+
+// findWaitGroup sets r.wg to the first local sync.WaitGroup variable in the
+// selection, and r.wgDecl and r.body to its declaration and the body of the
+// function containing it.  If there is no such variable, it logs an error
+// and returns false.
+func (r *ConvertToErrgroup) findWaitGroup() bool {
+	info := r.SelectedNodePkg.TypesInfo
+	ast.Inspect(r.SelectedNode, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && r.wg == nil {
+			v, ok := info.ObjectOf(id).(*types.Var)
+			if ok && isWaitGroup(v.Type()) && !v.IsField() &&
+				v.Parent() != v.Pkg().Scope() {
+				r.wg = v
+			}
+		}
+		return r.wg == nil
+	})
+	if r.wg == nil {
+		r.Log.Error("Please select a local sync.WaitGroup variable " +
+			"(e.g., its declaration).")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	r.wgDecl, r.body = r.declStmt(r.wg)
+	if r.wgDecl == nil {
+		r.Log.Errorf("%s cannot be converted, since it is not declared "+
+			"by a statement that declares only %s.",
+			r.wg.Name(), r.wg.Name())
+		r.Log.AssociatePos(r.wg.Pos(), r.wg.Pos())
+		r.Log.AssociateCode(CodeErrgroupPattern)
+		return false
+	}
+	return true
+}
+
+// isWaitGroup returns true if the given type is sync.WaitGroup or a pointer
+// to it.
+func isWaitGroup(t types.Type) bool {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil &&
+		named.Obj().Pkg().Path() == "sync" && named.Obj().Name() == "WaitGroup"
+}
+
+// declStmt returns the statement declaring the given local variable and the
+// body of the function containing it, or nil if the variable is not declared
+// in a block by a statement that declares only it.
+func (r *ConvertToErrgroup) declStmt(v *types.Var) (ast.Stmt, *ast.BlockStmt) {
+	path, _ := astutil.PathEnclosingInterval(r.File, v.Pos(), v.Pos())
+	for i, n := range path {
+		stmt, ok := n.(ast.Stmt)
+		if !ok {
+			continue
+		}
+		if _, inBlock := path[i+1].(*ast.BlockStmt); !inBlock || !declaresOneVar(stmt) {
+			return nil, nil
+		}
+		for _, n := range path[i+1:] {
+			switch fn := n.(type) {
+			case *ast.FuncLit:
+				return stmt, fn.Body
+			case *ast.FuncDecl:
+				return stmt, fn.Body
+			}
+		}
+		return nil, nil
+	}
+	return nil, nil
+}
+
+// declaresOneVar returns true if the given statement declares exactly one
+// variable, e.g., var x T or x := e.
+func declaresOneVar(stmt ast.Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *ast.DeclStmt:
+		gen := stmt.Decl.(*ast.GenDecl)
+		return gen.Tok == token.VAR && len(gen.Specs) == 1 &&
+			len(gen.Specs[0].(*ast.ValueSpec).Names) == 1
+	case *ast.AssignStmt:
+		return stmt.Tok == token.DEFINE && len(stmt.Lhs) == 1
+	}
+	return false
+}
+
+// uses returns the identifiers referring to the given variable in r.body,
+// each with the path of nodes enclosing it (see PathEnclosingInterval).
+func (r *ConvertToErrgroup) uses(v *types.Var) [][]ast.Node {
+	info := r.SelectedNodePkg.TypesInfo
+	result := [][]ast.Node{}
+	ast.Inspect(r.body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && info.Uses[id] == v {
+			path, _ := astutil.PathEnclosingInterval(r.File, id.Pos(), id.End())
+			result = append(result, path)
+		}
+		return true
+	})
+	return result
+}
+
+// logUnrecognized logs an error for a use of wg or errs (the identifier
+// path[0]) that is not part of the pattern this refactoring converts.
+func (r *ConvertToErrgroup) logUnrecognized(path []ast.Node, reason string) {
+	id := path[0].(*ast.Ident)
+	r.Log.Errorf("This use of %s cannot be converted to use an "+
+		"errgroup.Group%s.", id.Name, reason)
+	r.Log.AssociateNode(id)
+	r.Log.AssociateCode(CodeErrgroupPattern)
+}
+
+// classifyWaitGroupUses finds the calls to wg.Add, wg.Done, and wg.Wait,
+// logging an error for any other use of wg.
+func (r *ConvertToErrgroup) classifyWaitGroupUses() {
+	for _, path := range r.uses(r.wg) {
+		if len(path) < 4 {
+			r.logUnrecognized(path, "")
+			continue
+		}
+		sel, ok := path[1].(*ast.SelectorExpr)
+		if !ok || sel.X != path[0] {
+			r.logUnrecognized(path, "")
+			continue
+		}
+		call, ok := path[2].(*ast.CallExpr)
+		if !ok || call.Fun != sel {
+			r.logUnrecognized(path, "")
+			continue
+		}
+		switch sel.Sel.Name {
+		case "Add":
+			if stmt, ok := path[3].(*ast.ExprStmt); ok {
+				r.removed = append(r.removed, stmt)
+				continue
+			}
+		case "Wait":
+			if stmt, ok := path[3].(*ast.ExprStmt); ok && r.wait == nil {
+				r.wait = stmt
+				continue
+			}
+		case "Done":
+			if goStmt := goroutineDeferring(path); goStmt != nil &&
+				r.dones[goStmt] == nil {
+				r.goStmts = append(r.goStmts, goStmt)
+				r.dones[goStmt] = path[3].(*ast.DeferStmt)
+				continue
+			}
+			r.logUnrecognized(path, ", since only a deferred call "+
+				"to Done at the beginning of a goroutine can be "+
+				"converted")
+			continue
+		}
+		r.logUnrecognized(path, "")
+	}
+	if !r.Log.ContainsErrors() && len(r.goStmts) == 0 {
+		r.Log.Errorf("No goroutine defers %s.Done().", r.wg.Name())
+		r.Log.AssociatePos(r.wg.Pos(), r.wg.Pos())
+		r.Log.AssociateCode(CodeErrgroupPattern)
+	}
+	if !r.Log.ContainsErrors() && r.wait == nil {
+		r.Log.Errorf("%s.Wait() is never called.", r.wg.Name())
+		r.Log.AssociatePos(r.wg.Pos(), r.wg.Pos())
+		r.Log.AssociateCode(CodeErrgroupPattern)
+	}
+}
+
+// goroutineDeferring returns the go statement that starts a function literal
+// whose body contains (at the top level) the defer statement path[3], or nil
+// if path does not describe such a statement.
+func goroutineDeferring(path []ast.Node) *ast.GoStmt {
+	if len(path) < 8 {
+		return nil
+	}
+	if _, ok := path[3].(*ast.DeferStmt); !ok {
+		return nil
+	}
+	lit, ok := path[5].(*ast.FuncLit)
+	if !ok || lit.Body != path[4] {
+		return nil
+	}
+	call, ok := path[6].(*ast.CallExpr)
+	if !ok || call.Fun != lit {
+		return nil
+	}
+	goStmt, ok := path[7].(*ast.GoStmt)
+	if !ok || goStmt.Call != call {
+		return nil
+	}
+	return goStmt
+}
+
+// goroutineBody returns the body of the function literal started by the
+// given go statement.
+func goroutineBody(goStmt *ast.GoStmt) *ast.BlockStmt {
+	return goStmt.Call.Fun.(*ast.FuncLit).Body
+}
+
+// findErrorChannel sets r.errs to the channel on which the goroutines send
+// errors, and r.errsDecl to its declaration.  If the goroutines do not send
+// on a local chan error variable, or they send on more than one, it logs an
+// error and returns false.
+func (r *ConvertToErrgroup) findErrorChannel() bool {
+	info := r.SelectedNodePkg.TypesInfo
+	for _, goStmt := range r.goStmts {
+		ast.Inspect(goroutineBody(goStmt), func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.SendStmt:
+				id, ok := unparen(n.Chan).(*ast.Ident)
+				if !ok {
+					return true
+				}
+				v, ok := info.Uses[id].(*types.Var)
+				if !ok || !isErrorChan(v.Type()) {
+					return true
+				}
+				if r.errs == nil {
+					r.errs = v
+				} else if v != r.errs {
+					r.Log.Errorf("The goroutines send errors on "+
+						"both %s and %s.", r.errs.Name(),
+						v.Name())
+					r.Log.AssociateNode(n)
+					r.Log.AssociateCode(CodeErrgroupPattern)
+				}
+			}
+			return true
+		})
+	}
+	if r.Log.ContainsErrors() {
+		return false
+	}
+	if r.errs == nil {
+		r.Log.Error("The goroutines do not send errors on a channel, " +
+			"so there are no errors for an errgroup.Group to report.")
+		r.Log.AssociateNode(r.goStmts[0])
+		r.Log.AssociateCode(CodeErrgroupPattern)
+		return false
+	}
+	var body *ast.BlockStmt
+	r.errsDecl, body = r.declStmt(r.errs)
+	if r.errsDecl == nil || body != r.body || !r.initializedByMake(r.errsDecl) {
+		r.Log.Errorf("%s cannot be converted, since it is not declared "+
+			"by a statement like %s := make(chan error, n) in the "+
+			"same function as %s.",
+			r.errs.Name(), r.errs.Name(), r.wg.Name())
+		r.Log.AssociatePos(r.errs.Pos(), r.errs.Pos())
+		r.Log.AssociateCode(CodeErrgroupPattern)
+		return false
+	}
+	return true
+}
+
+// isErrorChan returns true if the given type is a channel of errors.
+func isErrorChan(t types.Type) bool {
+	ch, ok := t.Underlying().(*types.Chan)
+	return ok && types.Identical(ch.Elem(), types.Universe.Lookup("error").Type())
+}
+
+// initializedByMake returns true if the given declaration (which declares
+// one variable) initializes it by calling the built-in make function.
+func (r *ConvertToErrgroup) initializedByMake(decl ast.Stmt) bool {
+	var value ast.Expr
+	switch decl := decl.(type) {
+	case *ast.DeclStmt:
+		spec := decl.Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+		if len(spec.Values) == 1 {
+			value = spec.Values[0]
+		}
+	case *ast.AssignStmt:
+		value = decl.Rhs[0]
+	}
+	call, ok := unparen(value).(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	id, ok := unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, isBuiltin := r.SelectedNodePkg.TypesInfo.Uses[id].(*types.Builtin)
+	return isBuiltin && id.Name == "make"
+}
+
+// classifyErrorChannelUses finds the sends on errs in the goroutines, the
+// calls to close(errs), and the receive (or range loop) that consumes the
+// first error, logging an error for any other use of errs.
+func (r *ConvertToErrgroup) classifyErrorChannelUses() {
+	for _, path := range r.uses(r.errs) {
+		switch parent := path[1].(type) {
+		case *ast.SendStmt:
+			if r.classifySend(parent, path) {
+				continue
+			}
+		case *ast.CallExpr:
+			id, ok := unparen(parent.Fun).(*ast.Ident)
+			if ok && id.Name == "close" && len(parent.Args) == 1 {
+				_, isBuiltin := r.SelectedNodePkg.TypesInfo.Uses[id].(*types.Builtin)
+				if stmt, ok := path[2].(*ast.ExprStmt); ok && isBuiltin {
+					r.removed = append(r.removed, stmt)
+					continue
+				}
+			}
+		case *ast.UnaryExpr:
+			if parent.Op == token.ARROW && r.consumer == nil {
+				r.consumer = parent
+				continue
+			}
+		case *ast.RangeStmt:
+			if parent.X == path[0] && r.consumer == nil {
+				r.consumer = parent
+				continue
+			}
+		}
+		r.logUnrecognized(path, "")
+	}
+	if !r.Log.ContainsErrors() && r.consumer == nil {
+		r.Log.Errorf("No error is received from %s.", r.errs.Name())
+		r.Log.AssociatePos(r.errs.Pos(), r.errs.Pos())
+		r.Log.AssociateCode(CodeErrgroupPattern)
+	}
+}
+
+// classifySend determines whether the given send statement (whose ancestors
+// are path[2:]) is in one of the goroutines, returning false if it is not.
+// If it is followed by a return statement (or the end of the goroutine), so
+// it can be replaced by a return statement, it is recorded in r.sends;
+// otherwise, an error is logged.
+func (r *ConvertToErrgroup) classifySend(send *ast.SendStmt, path []ast.Node) bool {
+	var lit *ast.FuncLit
+	for _, n := range path[2:] {
+		if fn, ok := n.(*ast.FuncLit); ok {
+			lit = fn
+			break
+		}
+	}
+	if lit == nil || !r.isGoroutine(lit) {
+		return false
+	}
+	block, ok := path[2].(*ast.BlockStmt)
+	if !ok {
+		return false
+	}
+	for i, stmt := range block.List {
+		if stmt != send {
+			continue
+		}
+		if i+1 < len(block.List) {
+			ret, ok := block.List[i+1].(*ast.ReturnStmt)
+			if ok && len(ret.Results) == 0 {
+				r.sends[send] = ret
+				return true
+			}
+		}
+		if isTail(send, path[2:], lit) {
+			r.sends[send] = nil
+			return true
+		}
+	}
+	r.logUnrecognized(path, ", since this send statement is not "+
+		"followed by a return statement")
+	return true
+}
+
+// isGoroutine returns true if the given function literal is started by one
+// of the go statements in r.goStmts.
+func (r *ConvertToErrgroup) isGoroutine(lit *ast.FuncLit) bool {
+	for _, goStmt := range r.goStmts {
+		if goStmt.Call.Fun == lit {
+			return true
+		}
+	}
+	return false
+}
+
+// isTail returns true if control flows from the end of the given statement
+// (whose ancestors are path) to the end of the function literal lit, through
+// the ends of enclosing blocks and if statements.
+func isTail(stmt ast.Node, path []ast.Node, lit *ast.FuncLit) bool {
+	switch parent := path[0].(type) {
+	case *ast.BlockStmt:
+		if parent.List[len(parent.List)-1] != stmt {
+			return false
+		}
+		if parent == lit.Body {
+			return true
+		}
+		return isTail(parent, path[1:], lit)
+	case *ast.IfStmt:
+		if stmt != parent.Body && stmt != parent.Else {
+			return false
+		}
+		return isTail(parent, path[1:], lit)
+	}
+	return false
+}
+
+// checkGoroutines logs an error if a goroutine cannot be passed to Go,
+// because it returns results or its call has a variadic argument.
+func (r *ConvertToErrgroup) checkGoroutines() {
+	for _, goStmt := range r.goStmts {
+		lit := goStmt.Call.Fun.(*ast.FuncLit)
+		if lit.Type.Results != nil || goStmt.Call.Ellipsis.IsValid() {
+			r.Log.Error("This goroutine cannot be converted, since " +
+				"its function has results or a variadic argument.")
+			r.Log.AssociateNode(goStmt)
+			r.Log.AssociateCode(CodeErrgroupPattern)
+		}
+	}
+}
+
+// checkOrder logs an error unless the goroutines are started (and wg.Add is
+// called) before wg.Wait, outside the goroutines, and the first error is
+// consumed after wg.Wait in the same block.
+func (r *ConvertToErrgroup) checkOrder() {
+	inGoroutine := func(node ast.Node) bool {
+		for _, goStmt := range r.goStmts {
+			if goStmt.Pos() <= node.Pos() && node.End() <= goStmt.End() {
+				return true
+			}
+		}
+		return false
+	}
+	for _, stmt := range append([]ast.Stmt{r.wait}, r.removed...) {
+		if inGoroutine(stmt) {
+			r.Log.Error("This statement cannot be converted, since it " +
+				"is in a goroutine.")
+			r.Log.AssociateNode(stmt)
+			r.Log.AssociateCode(CodeErrgroupPattern)
+		}
+	}
+	for _, stmt := range r.goStmts {
+		if stmt.End() > r.wait.Pos() {
+			r.Log.Errorf("This goroutine cannot be converted, since it "+
+				"is started after %s.Wait() is called.", r.wg.Name())
+			r.Log.AssociateNode(stmt)
+			r.Log.AssociateCode(CodeErrgroupPattern)
+		}
+	}
+
+	// The consumer must be (or be in) a statement after wg.Wait() in the
+	// same block, and not in a loop or function literal in that statement
+	waitPath, _ := astutil.PathEnclosingInterval(r.File, r.wait.Pos(), r.wait.End())
+	var block ast.Node
+	for _, n := range waitPath {
+		if _, ok := n.(*ast.BlockStmt); ok {
+			block = n
+			break
+		}
+	}
+	path, _ := astutil.PathEnclosingInterval(r.File, r.consumer.Pos(), r.consumer.End())
+	ok := false
+search:
+	for i, n := range path {
+		if n == block {
+			ok = i > 0 && path[i-1].Pos() > r.wait.Pos()
+			break
+		}
+		switch n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt, *ast.FuncLit:
+			if n != r.consumer {
+				break search
+			}
+		}
+	}
+	if !ok {
+		r.Log.Errorf("The first error cannot be received here; it must "+
+			"be received once, after %s.Wait() is called, in the "+
+			"same block.", r.wg.Name())
+		r.Log.AssociateNode(r.consumer)
+		r.Log.AssociateCode(CodeErrgroupPattern)
+	}
+}
+
+// checkConsumer logs an error if the consumer is a range loop that may
+// handle more than one error, since Wait returns only the first error.  Such
+// a loop must declare a variable for the error, and its body must end with a
+// return statement (optionally inside an if err != nil statement).
+func (r *ConvertToErrgroup) checkConsumer() {
+	rng, ok := r.consumer.(*ast.RangeStmt)
+	if !ok {
+		return
+	}
+	if key, ok := rng.Key.(*ast.Ident); !ok || key.Name == "_" ||
+		rng.Tok != token.DEFINE || r.errorHandler(rng) == nil {
+		r.Log.Error("Only a loop that declares a variable for the " +
+			"error and returns after handling it can be converted, " +
+			"since an errgroup.Group reports only the first error.")
+		r.Log.AssociateNode(rng)
+		r.Log.AssociateCode(CodeErrgroupPattern)
+	}
+}
+
+// errorHandler returns the statements in the given range loop over errs that
+// handle an error: the body of the loop, or the body of an if err != nil
+// statement that is the only statement in the loop.  It returns nil unless
+// those statements end with a return statement.
+func (r *ConvertToErrgroup) errorHandler(rng *ast.RangeStmt) *ast.BlockStmt {
+	handler := rng.Body
+	if len(handler.List) == 1 {
+		if ifStmt, ok := handler.List[0].(*ast.IfStmt); ok &&
+			ifStmt.Init == nil && ifStmt.Else == nil &&
+			r.isNotNil(ifStmt.Cond, rng.Key.(*ast.Ident)) {
+			handler = ifStmt.Body
+		}
+	}
+	if len(handler.List) == 0 {
+		return nil
+	}
+	if _, ok := handler.List[len(handler.List)-1].(*ast.ReturnStmt); !ok {
+		return nil
+	}
+	return handler
+}
+
+// isNotNil returns true if the given expression is err != nil (or nil !=
+// err), where err is the variable declared by the given identifier.
+func (r *ConvertToErrgroup) isNotNil(expr ast.Expr, err *ast.Ident) bool {
+	info := r.SelectedNodePkg.TypesInfo
+	binary, ok := unparen(expr).(*ast.BinaryExpr)
+	if !ok || binary.Op != token.NEQ {
+		return false
+	}
+	isErr := func(e ast.Expr) bool {
+		id, ok := unparen(e).(*ast.Ident)
+		return ok && info.Uses[id] == info.Defs[err]
+	}
+	isNil := func(e ast.Expr) bool {
+		id, ok := unparen(e).(*ast.Ident)
+		if !ok {
+			return false
+		}
+		_, isNil := info.Uses[id].(*types.Nil)
+		return isNil
+	}
+	return (isErr(binary.X) && isNil(binary.Y)) ||
+		(isNil(binary.X) && isErr(binary.Y))
+}
+
+// checkGroupName logs an error if the function declaring wg already uses the
+// name chosen for the errgroup.Group (other than as the name of wg).
+func (r *ConvertToErrgroup) checkGroupName() {
+	info := r.SelectedNodePkg.TypesInfo
+	var conflict *ast.Ident
+	ast.Inspect(r.body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == r.groupName &&
+			info.ObjectOf(id) != r.wg {
+			conflict = id
+		}
+		return conflict == nil
+	})
+	if conflict != nil {
+		r.Log.Errorf("The name %s is already used in this function; "+
+			"please choose a different name for the errgroup.Group.",
+			r.groupName)
+		r.Log.AssociateNode(conflict)
+		r.Log.AssociateCode(CodeRenameConflict)
+	}
+}
+
+// addEdits adds edits that replace wg with an errgroup.Group, start the
+// goroutines with its Go method, and receive the first error from its Wait
+// method, removing errs and any imports that are no longer used.
+func (r *ConvertToErrgroup) addEdits() {
+	q := newTypeQualifier(r.SelectedNodePkg.Types, r.File)
+	pkg := q.qualify(types.NewPackage(errgroupPath, "errgroup"))
+	decl := fmt.Sprintf("var %s %s.Group", r.groupName, pkg)
+	if r.limit > 0 {
+		decl += fmt.Sprintf("\n%s.SetLimit(%d)", r.groupName, r.limit)
+	}
+	r.replace(r.wgDecl, decl)
+
+	removed := []*declText{r.newStmtText(r.wgDecl)}
+	for _, stmt := range append([]ast.Stmt{r.errsDecl, r.wait}, r.removed...) {
+		start, end := r.lineExtent(stmt)
+		r.Edits[r.Filename].Add(&text.Extent{start, end - start}, "")
+		removed = append(removed, r.newStmtText(stmt))
+	}
+
+	for _, goStmt := range r.goStmts {
+		r.replace(goStmt, r.goroutineCode(goStmt))
+	}
+
+	wait := r.groupName + ".Wait()"
+	switch consumer := r.consumer.(type) {
+	case *ast.UnaryExpr:
+		r.replace(consumer, wait)
+	case *ast.RangeStmt:
+		err := consumer.Key.(*ast.Ident).Name
+		handler := r.errorHandler(consumer)
+		r.replace(consumer, fmt.Sprintf("if %s := %s; %s != nil {%s}",
+			err, wait, err, r.text(handler.Lbrace+1, handler.Rbrace)))
+	}
+
+	r.updateImports(r.Filename, r.FileContents, q,
+		r.unusedImports(removed, nil))
+}
+
+// replace adds an edit replacing the given node with the given text.
+func (r *ConvertToErrgroup) replace(node ast.Node, replacement string) {
+	start, end := r.OffsetOfPos(node.Pos()), r.OffsetOfPos(node.End())
+	r.Edits[r.Filename].Add(&text.Extent{start, end - start}, replacement)
+}
+
+// text returns the text of the file between the given positions.
+func (r *ConvertToErrgroup) text(pos, end token.Pos) string {
+	return string(r.FileContents[r.OffsetOfPos(pos):r.OffsetOfPos(end)])
+}
+
+// newStmtText returns a declText describing the text of the given statement,
+// which is removed or replaced, so that unusedImports can determine which
+// imports it used.
+func (r *ConvertToErrgroup) newStmtText(stmt ast.Stmt) *declText {
+	return &declText{
+		filename: r.Filename,
+		file:     r.File,
+		node:     stmt,
+		start:    r.OffsetOfPos(stmt.Pos()),
+		end:      r.OffsetOfPos(stmt.End()),
+	}
+}
+
+// goroutineCode returns the code that replaces the given go statement: a
+// call to the Go method of the errgroup.Group, passing a function literal
+// that returns the error the goroutine sent (or nil), preceded by
+// declarations that copy the goroutine's arguments into its parameters.
+func (r *ConvertToErrgroup) goroutineCode(goStmt *ast.GoStmt) string {
+	info := r.SelectedNodePkg.TypesInfo
+	lit := goStmt.Call.Fun.(*ast.FuncLit)
+
+	var buf bytes.Buffer
+	i := 0
+	for _, field := range lit.Type.Params.List {
+		if len(field.Names) == 0 {
+			i++
+			continue
+		}
+		for _, name := range field.Names {
+			arg := goStmt.Call.Args[i]
+			i++
+			if name.Name == "_" || r.isLoopVarCopy(name, arg, goStmt) {
+				continue
+			}
+			argText := r.text(arg.Pos(), arg.End())
+			param := info.Defs[name]
+			if param != nil && types.Identical(param.Type(), info.TypeOf(arg)) {
+				fmt.Fprintf(&buf, "%s := %s\n", name.Name, argText)
+			} else {
+				fmt.Fprintf(&buf, "var %s %s = %s\n", name.Name,
+					r.text(field.Type.Pos(), field.Type.End()), argText)
+			}
+		}
+	}
+
+	// Replace the deferred call to Done, sends on errs, and returns
+	type replacement struct {
+		start, end int
+		text       string
+	}
+	replacements := []replacement{}
+	start, end := r.lineExtent(r.dones[goStmt])
+	replacements = append(replacements, replacement{start, end, ""})
+	returns := map[*ast.ReturnStmt]bool{}
+	for send, ret := range r.sends {
+		if send.Pos() < lit.Pos() || send.End() > lit.End() {
+			continue
+		}
+		end := send.End()
+		if ret != nil {
+			returns[ret] = true
+			end = ret.End()
+		}
+		replacements = append(replacements, replacement{
+			r.OffsetOfPos(send.Pos()), r.OffsetOfPos(end),
+			"return " + r.text(send.Value.Pos(), send.Value.End())})
+	}
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			if !returns[n] {
+				replacements = append(replacements, replacement{
+					r.OffsetOfPos(n.Pos()), r.OffsetOfPos(n.End()),
+					"return nil"})
+			}
+		}
+		return true
+	})
+	sort.Slice(replacements, func(i, j int) bool {
+		return replacements[i].start < replacements[j].start
+	})
+
+	fmt.Fprintf(&buf, "%s.Go(func() error {", r.groupName)
+	offset := r.OffsetOfPos(lit.Body.Lbrace) + 1
+	for _, rep := range replacements {
+		buf.Write(r.FileContents[offset:rep.start])
+		buf.WriteString(rep.text)
+		offset = rep.end
+	}
+	buf.Write(r.FileContents[offset:r.OffsetOfPos(lit.Body.Rbrace)])
+	if !r.endsWithReturn(lit.Body) {
+		buf.WriteString("return nil\n")
+	}
+	buf.WriteString("})")
+	return buf.String()
+}
+
+// isLoopVarCopy returns true if copying the given argument into the given
+// parameter is unnecessary, because the argument is a variable with the same
+// name declared by a loop enclosing the go statement, and each iteration of
+// the loop declares a new variable (Go 1.22 and later).
+func (r *ConvertToErrgroup) isLoopVarCopy(param *ast.Ident, arg ast.Expr, goStmt *ast.GoStmt) bool {
+	id, ok := arg.(*ast.Ident)
+	if !ok || id.Name != param.Name || !r.perIteration {
+		return false
+	}
+	v := r.SelectedNodePkg.TypesInfo.Uses[id]
+	if v == nil {
+		return false
+	}
+	path, _ := astutil.PathEnclosingInterval(r.File, goStmt.Pos(), goStmt.End())
+	for _, n := range path {
+		var body *ast.BlockStmt
+		switch loop := n.(type) {
+		case *ast.ForStmt:
+			body = loop.Body
+		case *ast.RangeStmt:
+			body = loop.Body
+		case *ast.FuncLit, *ast.FuncDecl:
+			return false
+		default:
+			continue
+		}
+		if n.Pos() <= v.Pos() && v.Pos() < body.Lbrace {
+			return true
+		}
+	}
+	return false
+}
+
+// endsWithReturn returns true if the last statement in the given goroutine
+// body is (or will be replaced by) a return statement.
+func (r *ConvertToErrgroup) endsWithReturn(body *ast.BlockStmt) bool {
+	if len(body.List) == 0 {
+		return false
+	}
+	switch last := body.List[len(body.List)-1].(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.SendStmt:
+		_, ok := r.sends[last]
+		return ok
+	}
+	return false
+}
+
+const convertToErrgroupDoc = `
+  <h4>Purpose</h4>
+  <p>The Convert to errgroup refactoring replaces a <tt>sync.WaitGroup</tt>
+  and a channel of errors, which are used to run goroutines and report the
+  first error, with an <tt>errgroup.Group</tt> from
+  <tt>golang.org/x/sync/errgroup</tt>.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the <tt>sync.WaitGroup</tt> variable (e.g., its
+    declaration).</li>
+    <li>Activate the Convert to errgroup refactoring.</li>
+    <li>Enter a name for the <tt>errgroup.Group</tt> variable (by default,
+    <tt>g</tt>).</li>
+    <li>Optionally, enter the maximum number of goroutines that may run at
+    once; the <tt>errgroup.Group</tt>'s <tt>SetLimit</tt> method will be
+    called with this limit.</li>
+  </ol>
+
+  <p>The import of <tt>golang.org/x/sync/errgroup</tt> is added, so the
+  module must require <tt>golang.org/x/sync</tt>.  Imports that are no
+  longer used (e.g., <tt>sync</tt>) are removed.</p>
+
+  <h4>Example</h4>
+  <p>In this example, the <tt>WaitGroup</tt> <tt>wg</tt> and the channel
+  <tt>errs</tt> are replaced by an <tt>errgroup.Group</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+  <pre><span class="highlight">var wg sync.WaitGroup</span>
+errs := make(chan error, len(urls))
+for _, url := range urls {
+    wg.Add(1)
+    go func(url string) {
+        defer wg.Done()
+        if err := fetch(url); err != nil {
+            errs <- err
+        }
+    }(url)
+}
+wg.Wait()
+close(errs)
+if err := <-errs; err != nil {
+    return err
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+  <pre>var g errgroup.Group
+for _, url := range urls {
+    g.Go(func() error {
+        if err := fetch(url); err != nil {
+            return err
+        }
+        return nil
+    })
+}
+if err := g.Wait(); err != nil {
+    return err
+}</pre>
+      </td>
+    </tr>
+  </table>
+
+  <p>Arguments passed to a goroutine are copied into variables, so the
+  function passed to <tt>Go</tt> can use them, unless they are loop
+  variables (in Go 1.22 and later).</p>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The <tt>WaitGroup</tt> is used other than by calling <tt>Add</tt>,
+    calling <tt>Wait</tt> once after the goroutines are started, and
+    deferring <tt>Done</tt> at the beginning of each goroutine.</li>
+    <li>The goroutines send errors on more than one channel, or a send is
+    not followed by a return statement (or the end of the goroutine).</li>
+    <li>The channel is used other than by sending errors, closing it, and
+    receiving the first error once, after calling <tt>Wait</tt>.  The error
+    may be received in a loop (<tt>for err := range errs</tt>) only if the
+    loop returns after handling the first error, since an
+    <tt>errgroup.Group</tt> reports only the first error.</li>
+  </ul>
+`
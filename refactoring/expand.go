@@ -0,0 +1,189 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file finds the regions enclosing a selection that could be extracted
+// by the Extract Function or Extract Local Variable refactoring, so that
+// editors can implement "expand selection to extractable region."
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// A RegionKind describes what an ExtractableRegion contains.
+type RegionKind int
+
+const (
+	// An expression, which can be extracted to a local variable
+	RegionExpression RegionKind = iota
+	// A single statement
+	RegionStatement
+	// All of the statements in a block, case clause, or comm clause
+	RegionStatements
+	// A block, including its braces (e.g., the body of an if statement)
+	RegionBlock
+	// The body of a function or method
+	RegionFunction
+)
+
+// regionKindNames are the names returned by RegionKind.String
+var regionKindNames = []string{
+	"expression",
+	"statement",
+	"statements",
+	"block",
+	"function",
+}
+
+// String returns the name of the region kind (e.g., "statement"), which
+// drivers can display or use in machine-readable output.
+func (k RegionKind) String() string {
+	if k < 0 || int(k) >= len(regionKindNames) {
+		return "unknown"
+	}
+	return regionKindNames[k]
+}
+
+// An ExtractableRegion is a region of a file that can be selected before
+// invoking Extract Local Variable (if it is an expression) or Extract Function
+// (otherwise).
+type ExtractableRegion struct {
+	Kind       RegionKind
+	Start, End token.Pos
+}
+
+// ExtractableRegions returns the regions of the selected file that enclose the
+// selection given in the Config (which is usually a single position) and could
+// be extracted: the enclosing expressions, statements, statement lists, and
+// blocks, from the innermost region outward, ending with the body of the
+// enclosing function.  Each region is strictly larger than the one before it;
+// when several kinds of region have the same extent (e.g., a call and the
+// statement consisting of that call), only the outermost kind is reported.
+//
+// A region is reported only if the same preconditions that Extract Local
+// Variable or Extract Function check before extracting it are satisfied
+// (e.g., a statement list containing a break statement whose target is
+// outside the list is not reported).  The returned Log describes any errors
+// that occurred; its Fset can be used to find the regions' positions.
+func ExtractableRegions(config *Config) ([]ExtractableRegion, *Log) {
+	r := &RefactoringBase{}
+	r.Init(config, &Description{})
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return nil, r.Log
+	}
+
+	path := r.PathEnclosingSelection
+	inFunc := false
+	for _, node := range path {
+		if _, ok := node.(*ast.FuncDecl); ok {
+			inFunc = true
+			break
+		}
+	}
+	if !inFunc {
+		r.Log.Error("Please select a position inside a function declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return nil, r.Log
+	}
+
+	result := []ExtractableRegion{}
+	add := func(kind RegionKind, start, end token.Pos) {
+		region := ExtractableRegion{kind, start, end}
+		if n := len(result); n > 0 &&
+			result[n-1].Start == start && result[n-1].End == end {
+			result[n-1] = region
+		} else {
+			result = append(result, region)
+		}
+	}
+	for i, node := range path {
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			return result, r.Log
+		case *ast.BlockStmt:
+			if hasCaseClauses(path[i+1]) {
+				// The body of a switch or select statement
+				continue
+			}
+			kind := RegionBlock
+			if _, ok := path[i+1].(*ast.FuncDecl); ok {
+				kind = RegionFunction
+			}
+			if r.stmtsAreExtractable(node.Pos(), node.End()) {
+				add(kind, node.Pos(), node.End())
+			}
+		case *ast.CaseClause, *ast.CommClause:
+			continue
+		case ast.Stmt:
+			list := stmtList(path[i+1])
+			if list == nil {
+				continue
+			}
+			if r.stmtsAreExtractable(node.Pos(), node.End()) {
+				add(RegionStatement, node.Pos(), node.End())
+			}
+			start, end := list[0].Pos(), list[len(list)-1].End()
+			if r.stmtsAreExtractable(start, end) {
+				add(RegionStatements, start, end)
+			}
+		case ast.Expr:
+			if r.exprIsExtractable(path[i:]) {
+				add(RegionExpression, node.Pos(), node.End())
+			}
+		}
+	}
+	return result, r.Log
+}
+
+// stmtList returns the list of statements in the given BlockStmt, CaseClause,
+// or CommClause, or nil if the node is not one of these.
+func stmtList(node ast.Node) []ast.Stmt {
+	switch node := node.(type) {
+	case *ast.BlockStmt:
+		return node.List
+	case *ast.CaseClause:
+		return node.Body
+	case *ast.CommClause:
+		return node.Body
+	}
+	return nil
+}
+
+// stmtsAreExtractable returns true if the statements in the region from start
+// to end can be extracted by the Extract Function refactoring, i.e., if the
+// region contains complete statements that are not in an anonymous function
+// and do not transfer control outside the region.
+func (r *RefactoringBase) stmtsAreExtractable(start, end token.Pos) bool {
+	stmts, err := newStmtRange(r.File, start, end, r.SelectedNodePkg)
+	return err == nil && !stmts.IsInAnonymousFunc() &&
+		len(stmts.BranchesOutOfRange()) == 0
+}
+
+// exprIsExtractable returns true if the expression at the start of the given
+// path (from PathEnclosingInterval) can be extracted by the Extract Local
+// Variable refactoring.
+func (r *RefactoringBase) exprIsExtractable(path []ast.Node) bool {
+	// Exclude package names, types, etc., which have no value
+	tv, ok := r.SelectedNodePkg.TypesInfo.Types[path[0].(ast.Expr)]
+	if !ok || !tv.IsValue() {
+		return false
+	}
+	e := &ExtractLocal{varNames: []string{"extracted"}}
+	e.Log = NewLog()
+	e.Log.Fset = r.Program.Fset
+	e.Program = r.Program
+	e.File = r.File
+	e.Filename = r.Filename
+	e.FileContents = r.FileContents
+	e.SelectionStart, e.SelectionEnd = path[0].Pos(), path[0].End()
+	e.PathEnclosingSelection = path
+	e.SelectionIsExact = true
+	e.SelectedNode = path[0]
+	e.SelectedNodePkg = r.SelectedNodePkg
+	return e.checkExprIsExtractable()
+}
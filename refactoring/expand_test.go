@@ -0,0 +1,99 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestExtractableRegions(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	dir := filepath.Join(gopath, "src", "example.com", "app")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const contents = `package main
+
+var v = 1
+
+func main() {
+	x := 1
+	if x > 0 {
+		println(x + 2)
+		x++
+	}
+	for {
+		break
+	}
+}
+`
+	mainFile := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(mainFile, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expand := func(line, col int) (string, *Log) {
+		regions, log := ExtractableRegions(&Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Scope:      []string{mainFile},
+			Selection: &text.LineColSelection{
+				Filename:  mainFile,
+				StartLine: line, StartCol: col,
+				EndLine: line, EndCol: col,
+			},
+			GoPath:     gopath,
+			ModulesOff: true,
+		})
+		result := []string{}
+		for _, region := range regions {
+			start := log.Fset.Position(region.Start)
+			end := log.Fset.Position(region.End)
+			result = append(result, fmt.Sprintf("%s %d,%d:%d,%d",
+				region.Kind, start.Line, start.Column,
+				end.Line, end.Column))
+		}
+		return strings.Join(result, "; "), log
+	}
+
+	// x in println(x + 2)
+	regions, log := expand(8, 11)
+	if log.ContainsErrors() {
+		t.Fatal(log)
+	}
+	expected := "expression 8,11:8,12; expression 8,11:8,16; " +
+		"statement 8,3:8,17; statements 8,3:9,6; block 7,11:10,3; " +
+		"statement 7,2:10,3; statements 6,2:13,3; function 5,13:14,2"
+	if regions != expected {
+		t.Errorf("Expected %s, got %s", expected, regions)
+	}
+
+	// break (which cannot be extracted without the for statement)
+	regions, log = expand(12, 3)
+	if log.ContainsErrors() {
+		t.Fatal(log)
+	}
+	expected = "statement 11,2:13,3; statements 6,2:13,3; function 5,13:14,2"
+	if regions != expected {
+		t.Errorf("Expected %s, got %s", expected, regions)
+	}
+
+	// Outside a function
+	if _, log = expand(3, 9); !log.ContainsErrors() {
+		t.Errorf("Expected an error outside a function")
+	}
+}
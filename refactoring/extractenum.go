@@ -0,0 +1,514 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Extract Enum refactoring, which replaces the string
+// or integer literals in the cases of an enum-like switch statement with a
+// block of typed constants.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// An ExtractEnum refactoring declares a new type and a block of constants
+// of that type, one for each literal in the cases of the selected switch
+// statement (e.g., switch color { case "red": ... case "green": ... }).  The
+// literals are replaced with the constants, and the switch statement's tag is
+// converted to the new type.  Other switch statements and comparisons in the
+// package that compare a value of the same type against the same literals
+// are changed similarly.
+type ExtractEnum struct {
+	RefactoringBase
+	files        *sourceFiles
+	typeName     string
+	stringMethod bool       // Generate a String() method for the new type
+	tagType      types.Type // Type of the selected switch statement's tag
+	values       []*enumValue
+	// Values keyed by their exact representation (constant.Value's
+	// ExactString)
+	valueMap map[string]*enumValue
+}
+
+// An enumValue is one of the constants declared by ExtractEnum.
+type enumValue struct {
+	name  string
+	value constant.Value
+	text  string // source text of the literal
+}
+
+// An enumUse is a switch statement or comparison (==, !=) whose literals
+// will be replaced with constants.
+type enumUse struct {
+	file *ast.File
+	tag  ast.Expr // Tag or operand converted to the new type
+	lits []*ast.BasicLit
+}
+
+func (r *ExtractEnum) Description() *Description {
+	return &Description{
+		Name:      "Extract Enum",
+		Synopsis:  "Replaces switch case literals with typed constants",
+		Usage:     "<type_name> [<string_method>]",
+		HTMLDoc:   extractEnumDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Type Name:",
+			Prompt:       "Name of the type to declare for the constants.",
+			DefaultValue: "",
+		}},
+		OptionalParams: []Parameter{{
+			Label:        "Generate String Method:",
+			Prompt:       "Generate a String() method for the new type.",
+			DefaultValue: false,
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *ExtractEnum) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+
+	if r.SelectedNode == nil {
+		r.Log.Error("Please select a switch statement.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+
+	r.typeName = config.Args[0].(string)
+	r.stringMethod = false
+	if len(config.Args) > 1 {
+		r.stringMethod = config.Args[1].(bool)
+	}
+	if !isIdentifierValid(r.typeName) || r.typeName == "_" {
+		r.Log.Errorf("The type name \"%s\" is not a valid Go identifier",
+			r.typeName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return &r.Result
+	}
+	if isReservedWord(r.typeName) {
+		r.Log.Errorf("The type name \"%s\" is a reserved word",
+			r.typeName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return &r.Result
+	}
+
+	sw := r.selectedSwitch()
+	if sw == nil || !r.findValues(sw) {
+		return &r.Result
+	}
+	uses := r.findUses()
+	if !r.checkConflicts(uses) {
+		return &r.Result
+	}
+	for _, use := range uses {
+		r.replaceLiterals(use)
+	}
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.addDecls()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// selectedSwitch returns the innermost expression switch statement
+// containing the selection.  It logs an error and returns nil if there is no
+// such statement.
+func (r *ExtractEnum) selectedSwitch() *ast.SwitchStmt {
+	for _, node := range r.PathEnclosingSelection {
+		if sw, ok := node.(*ast.SwitchStmt); ok {
+			return sw
+		}
+	}
+	r.Log.Error("Please select a switch statement.")
+	r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+	r.Log.AssociateCode(CodeInvalidSelection)
+	return nil
+}
+
+// findValues determines the constants to declare from the literals in the
+// cases of the given switch statement.  It logs an error and returns false
+// if the switch statement is not enum-like, i.e., if its tag is not a string
+// or integer or its cases are not all string or integer literals.
+func (r *ExtractEnum) findValues(sw *ast.SwitchStmt) bool {
+	info := r.SelectedNodePkg.TypesInfo
+	if sw.Tag == nil {
+		r.Log.Error("The switch statement must have a tag (e.g., " +
+			"switch x { ... }).")
+		r.Log.AssociateNode(sw)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	tv, ok := info.Types[sw.Tag]
+	if !ok || tv.Value != nil || !isEnumType(tv.Type) {
+		r.Log.Error("The switch statement's tag must be a (non-constant) " +
+			"string or integer.")
+		r.Log.AssociateNode(sw.Tag)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	r.tagType = tv.Type
+
+	r.values = []*enumValue{}
+	r.valueMap = map[string]*enumValue{}
+	names := map[string]*enumValue{}
+	for _, stmt := range sw.Body.List {
+		for _, expr := range stmt.(*ast.CaseClause).List {
+			lit, ok := expr.(*ast.BasicLit)
+			if !ok || (lit.Kind != token.STRING && lit.Kind != token.INT) {
+				r.Log.Error("Every case in the switch statement must " +
+					"be a string or integer literal.")
+				r.Log.AssociateNode(expr)
+				r.Log.AssociateCode(CodeInvalidSelection)
+				return false
+			}
+			value := info.Types[lit].Value
+			if _, found := r.valueMap[value.ExactString()]; found {
+				continue
+			}
+			name := r.constName(value)
+			if name == "" {
+				r.Log.Errorf("A constant name cannot be derived from "+
+					"%s.", lit.Value)
+				r.Log.AssociateNode(lit)
+				return false
+			}
+			if other, found := names[name]; found {
+				r.Log.Errorf("Both %s and %s would be named %s.",
+					other.text, lit.Value, name)
+				r.Log.AssociateNode(lit)
+				return false
+			}
+			v := &enumValue{name: name, value: value, text: lit.Value}
+			r.values = append(r.values, v)
+			r.valueMap[value.ExactString()] = v
+			names[name] = v
+		}
+	}
+	if len(r.values) == 0 {
+		r.Log.Error("The switch statement does not have any cases.")
+		r.Log.AssociateNode(sw)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	if r.values[0].value.Kind() == constant.Int {
+		sort.SliceStable(r.values, func(i, j int) bool {
+			return constant.Compare(r.values[i].value, token.LSS,
+				r.values[j].value)
+		})
+	}
+	return true
+}
+
+// isEnumType returns true if the given type is a (typed) string or integer
+// type.
+func isEnumType(typ types.Type) bool {
+	basic, ok := typ.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsUntyped == 0 &&
+		basic.Info()&(types.IsString|types.IsInteger) != 0
+}
+
+// constName returns the name of the constant for the given value: the type
+// name followed by the words in a string (e.g., ColorDarkBlue for
+// "dark-blue") or by the decimal value of an integer (e.g., Status200).  It
+// returns the empty string if a string contains no letters or digits.
+func (r *ExtractEnum) constName(value constant.Value) string {
+	if value.Kind() == constant.Int {
+		return r.typeName + value.ExactString()
+	}
+	var buf bytes.Buffer
+	for _, word := range strings.FieldsFunc(constant.StringVal(value),
+		func(ch rune) bool {
+			return !unicode.IsLetter(ch) && !unicode.IsDigit(ch)
+		}) {
+		first, size := utf8.DecodeRuneInString(word)
+		buf.WriteRune(unicode.ToUpper(first))
+		buf.WriteString(word[size:])
+	}
+	if buf.Len() == 0 {
+		return ""
+	}
+	return r.typeName + buf.String()
+}
+
+// findUses returns the switch statements and comparisons in the package
+// containing the selected switch statement that compare a value of the same
+// type against the literals being replaced.
+func (r *ExtractEnum) findUses() []*enumUse {
+	info := r.SelectedNodePkg.TypesInfo
+	isOperand := func(expr ast.Expr) bool {
+		tv, ok := info.Types[expr]
+		return ok && tv.Value == nil && types.Identical(tv.Type, r.tagType)
+	}
+	isLiteral := func(expr ast.Expr) (*ast.BasicLit, bool) {
+		lit, ok := expr.(*ast.BasicLit)
+		if !ok {
+			return nil, false
+		}
+		_, found := r.valueMap[info.Types[lit].Value.ExactString()]
+		return lit, found
+	}
+
+	uses := []*enumUse{}
+	for _, file := range r.SelectedNodePkg.Syntax {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SwitchStmt:
+				if n.Tag == nil || !isOperand(n.Tag) {
+					return true
+				}
+				use := &enumUse{file: file, tag: n.Tag}
+				for _, stmt := range n.Body.List {
+					for _, expr := range stmt.(*ast.CaseClause).List {
+						lit, ok := isLiteral(expr)
+						if !ok {
+							return true
+						}
+						use.lits = append(use.lits, lit)
+					}
+				}
+				if len(use.lits) > 0 {
+					uses = append(uses, use)
+				}
+			case *ast.BinaryExpr:
+				if n.Op != token.EQL && n.Op != token.NEQ {
+					return true
+				}
+				if lit, ok := isLiteral(n.Y); ok && isOperand(n.X) {
+					uses = append(uses, &enumUse{file, n.X, []*ast.BasicLit{lit}})
+				} else if lit, ok := isLiteral(n.X); ok && isOperand(n.Y) {
+					uses = append(uses, &enumUse{file, n.Y, []*ast.BasicLit{lit}})
+				}
+			}
+			return true
+		})
+	}
+	return uses
+}
+
+// checkConflicts checks that the names of the new type and constants do not
+// conflict with existing declarations in the package, and that they will
+// not be shadowed where they are used.  It logs an error and returns false
+// if they will.
+func (r *ExtractEnum) checkConflicts(uses []*enumUse) bool {
+	pkg := r.SelectedNodePkg
+	names := []string{r.typeName}
+	for _, v := range r.values {
+		names = append(names, v.name)
+	}
+
+	for _, name := range names {
+		if obj := pkg.Types.Scope().Lookup(name); obj != nil {
+			r.Log.Errorf("The name %s conflicts with an existing "+
+				"declaration", name)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+		for _, file := range pkg.Syntax {
+			if obj := pkg.TypesInfo.Scopes[file].Lookup(name); obj != nil {
+				r.Log.Errorf("The name %s conflicts with an "+
+					"imported package name", name)
+				r.Log.AssociatePos(obj.Pos(), obj.Pos())
+				r.Log.AssociateCode(CodeRenameConflict)
+				return false
+			}
+		}
+	}
+
+	for _, use := range uses {
+		_, path, _ := r.Program.PathEnclosingInterval(use.tag.Pos(), use.tag.End())
+		scope := scopeAt(pkg.TypesInfo, path)
+		for _, name := range names {
+			if _, obj := scope.LookupParent(name, use.tag.Pos()); obj != nil {
+				r.Log.Errorf("The name %s would refer to a different "+
+					"declaration here", name)
+				r.Log.AssociateNode(use.tag)
+				r.Log.AddRelated("Conflicting declaration",
+					obj.Pos(), obj.Pos())
+				r.Log.AssociateCode(CodeRenameConflict)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// replaceLiterals adds edits converting the tag (or operand) of the given
+// use to the new type and replacing its literals with constants.
+func (r *ExtractEnum) replaceLiterals(use *enumUse) {
+	info := r.SelectedNodePkg.TypesInfo
+	filename := r.Program.Fset.Position(use.file.Pos()).Filename
+	if usesCgo(use.file) {
+		r.Log.Errorf("%s cannot be modified because it uses cgo "+
+			"(import \"C\")", filepath.Base(filename))
+		r.Log.AssociateNode(use.tag)
+		return
+	}
+	edits := r.editSet(r.files, filename)
+	if edits == nil {
+		return
+	}
+	edits.Add(&text.Extent{Offset: r.OffsetOfPos(use.tag.Pos())},
+		r.typeName+"(")
+	edits.Add(&text.Extent{Offset: r.OffsetOfPos(use.tag.End())}, ")")
+	for _, lit := range use.lits {
+		v := r.valueMap[info.Types[lit].Value.ExactString()]
+		edits.Add(r.Extent(lit), v.name)
+	}
+}
+
+// addDecls adds an edit inserting the declarations of the new type, the
+// constants, and (optionally) the String method before the declaration
+// containing the selected switch statement.
+func (r *ExtractEnum) addDecls() {
+	path := r.PathEnclosingSelection
+	file := path[len(path)-1].(*ast.File)
+	var decl ast.Node = path[len(path)-2]
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			decl = d.Doc
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			decl = d.Doc
+		}
+	}
+	q := newTypeQualifier(r.SelectedNodePkg.Types, file)
+	src, err := format.Source([]byte(r.declsText(q)))
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	edits := r.editSet(r.files, r.Filename)
+	if edits == nil {
+		return
+	}
+	edits.Add(&text.Extent{Offset: r.OffsetOfPos(decl.Pos())},
+		string(src)+"\n")
+	r.addImports(q)
+}
+
+// declsText returns the source code for the new type, the constants, and
+// (optionally) the String method.
+func (r *ExtractEnum) declsText(q *typeQualifier) string {
+	basic := r.tagType.Underlying().(*types.Basic)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type %s %s\n\n", r.typeName, basic.Name())
+
+	buf.WriteString("const (\n")
+	if start, ok := r.iotaStart(); ok {
+		value := "iota"
+		if start > 0 {
+			value = fmt.Sprintf("iota + %d", start)
+		}
+		fmt.Fprintf(&buf, "\t%s %s = %s\n", r.values[0].name,
+			r.typeName, value)
+		for _, v := range r.values[1:] {
+			fmt.Fprintf(&buf, "\t%s\n", v.name)
+		}
+	} else {
+		for _, v := range r.values {
+			fmt.Fprintf(&buf, "\t%s %s = %s\n", v.name, r.typeName,
+				v.text)
+		}
+	}
+	buf.WriteString(")\n")
+
+	if !r.stringMethod {
+		return buf.String()
+	}
+	if basic.Info()&types.IsString != 0 {
+		fmt.Fprintf(&buf, "\nfunc (%s %s) String() string {\n"+
+			"\treturn string(%s)\n}\n", receiverName(r.typeName),
+			r.typeName, receiverName(r.typeName))
+		return buf.String()
+	}
+	names := make([]string, len(r.values))
+	for i, v := range r.values {
+		names[i] = v.name
+	}
+	buf.WriteString("\n")
+	buf.WriteString(switchStringMethod(r.typeName,
+		receiverName(r.typeName), names, basic, strconvQualifier(q)))
+	return buf.String()
+}
+
+// iotaStart returns the smallest value and true if the constants are
+// consecutive integers that can be declared using iota (e.g., 0, 1, 2 or
+// 5, 6, 7), or false otherwise.
+func (r *ExtractEnum) iotaStart() (int64, bool) {
+	if len(r.values) < 2 || r.values[0].value.Kind() != constant.Int {
+		return 0, false
+	}
+	start, exact := constant.Int64Val(r.values[0].value)
+	if !exact {
+		return 0, false
+	}
+	for i, v := range r.values {
+		if n, exact := constant.Int64Val(v.value); !exact ||
+			n != start+int64(i) {
+			return 0, false
+		}
+	}
+	return start, true
+}
+
+const extractEnumDoc = `
+  <h4>Purpose</h4>
+  <p>The Extract Enum refactoring replaces the string or integer literals in
+  the cases of an enum-like switch statement with a block of constants of a
+  new type.  Optionally, it also generates a <tt>String()</tt> method for the
+  new type.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a switch statement whose cases are all string or integer
+    literals (e.g., <tt>switch color { case "red": ... }</tt>).</li>
+    <li>Activate the Extract Enum refactoring.</li>
+    <li>Enter a name for the new type (e.g., <tt>Color</tt>).</li>
+  </ol>
+
+  <p>The new type and constants are declared before the function containing
+  the switch statement.  Each constant is named after the type and the
+  literal it replaces (e.g., <tt>ColorRed</tt> for <tt>"red"</tt>, or
+  <tt>Status200</tt> for <tt>200</tt>).  Integer constants are sorted, and
+  they are declared using <tt>iota</tt> if their values are consecutive.</p>
+
+  <p>The switch statement's tag is converted to the new type (e.g.,
+  <tt>switch Color(color)</tt>).  Other switch statements and comparisons
+  (<tt>==</tt> and <tt>!=</tt>) in the same package that compare a value of
+  the same type against the same literals are changed similarly.</p>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The switch statement has no tag, or its tag is not a string or
+    integer.</li>
+    <li>A case is not a string or integer literal.</li>
+    <li>Two literals would produce the same constant name.</li>
+    <li>The name of the type or a constant conflicts with an existing
+    declaration.</li>
+  </ul>
+`
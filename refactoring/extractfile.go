@@ -0,0 +1,433 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Extract to New File refactoring, which moves a type
+// declaration, along with its methods and constructors, into a new file in
+// the same package.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// An ExtractFile refactoring moves a package-level type declaration, all of
+// the methods declared on that type, and its constructors (functions named
+// NewT, or newT, that return a T or *T) into a new file in the same package.
+type ExtractFile struct {
+	RefactoringBase
+	files    *sourceFiles
+	typeName *types.TypeName
+}
+
+// A movedDecl is a declaration (or, in a grouped type declaration, a type
+// spec) that will be moved to the new file.
+type movedDecl struct {
+	*declText
+	// Keyword to prepend when a spec is moved out of a grouped declaration
+	keyword string
+	// Edits to the text of the declaration (with offsets relative to
+	// declText.start), or nil if it is moved unchanged
+	edits *text.EditSet
+}
+
+func (r *ExtractFile) Description() *Description {
+	return &Description{
+		Name:      "Extract to New File",
+		Synopsis:  "Moves a type, its methods, and its constructors to a new file",
+		Usage:     "[<filename>]",
+		HTMLDoc:   extractFileDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "File Name:",
+			Prompt:       "Name of the new file (default: the type's name in lowercase).",
+			DefaultValue: "",
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *ExtractFile) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+
+	if r.SelectedNode == nil {
+		r.Log.Error("Please select a type declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+
+	if filesystem.IsFakeStdinPath(r.Filename) {
+		r.Log.Error("A new file cannot be created when the source code " +
+			"is given on standard input.")
+		return &r.Result
+	}
+
+	spec, decl := r.selectedTypeSpec()
+	if spec == nil {
+		r.Log.Error("Please select a package-level type declaration.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+	typeName, ok := r.SelectedNodePkg.TypesInfo.Defs[spec.Name].(*types.TypeName)
+	if !ok {
+		r.Log.Errorf("The type %s cannot be moved", spec.Name.Name)
+		r.Log.AssociateNode(spec)
+		return &r.Result
+	}
+	r.typeName = typeName
+
+	newFilename := r.newFilename(config.Args)
+	if newFilename == "" {
+		return &r.Result
+	}
+
+	decls := r.findDecls(spec, decl)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	contents, err := r.newFileContents(r.files, r.File.Name.Name, decls,
+		importsUsedBy(r.SelectedNodePkg.TypesInfo, decls),
+		config.LicenseHeader)
+	if err != nil {
+		r.Log.Errorf("Unable to create %s: %v", filepath.Base(newFilename), err)
+		return &r.Result
+	}
+
+	removed := make([]*declText, len(decls))
+	for i, d := range decls {
+		removed[i] = d.declText
+	}
+	r.removeDecls(removed, r.files, nil)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.FSChanges = append(r.FSChanges, &filesystem.CreateFile{
+		Path:     newFilename,
+		Contents: contents,
+	})
+	r.UpdateLog(config, false)
+	return &r.Result
+}
+
+// selectedTypeSpec returns the package-level type spec enclosing the
+// selection, along with the declaration containing it, or nil if the
+// selection is not in a package-level type declaration.
+func (r *ExtractFile) selectedTypeSpec() (*ast.TypeSpec, *ast.GenDecl) {
+	return packageLevelTypeSpec(r.PathEnclosingSelection)
+}
+
+// newFilename returns the absolute path of the file to create, or "" (after
+// logging an error) if the file cannot be created.
+func (r *ExtractFile) newFilename(args []interface{}) string {
+	name := strings.ToLower(r.typeName.Name())
+	if strings.HasSuffix(r.Filename, "_test.go") {
+		name += "_test"
+	}
+	name += ".go"
+	if len(args) > 0 {
+		if arg := strings.TrimSpace(args[0].(string)); arg != "" {
+			name = arg
+			if !strings.HasSuffix(name, ".go") {
+				name += ".go"
+			}
+		}
+	}
+	if filepath.Base(name) != name || name == ".go" {
+		r.Log.Errorf("The new file name must be a file name, not a "+
+			"path: %s", name)
+		return ""
+	}
+	if strings.HasSuffix(name, "_test.go") !=
+		strings.HasSuffix(r.Filename, "_test.go") {
+		r.Log.Errorf("Declarations cannot be moved between test and "+
+			"non-test files (%s)", name)
+		return ""
+	}
+
+	path := filepath.Join(filepath.Dir(r.Filename), name)
+	if f, err := r.files.fileSystem.OpenFile(path); err == nil {
+		f.Close()
+		r.Log.Errorf("The file %s already exists; provide a different "+
+			"file name", name)
+		return ""
+	}
+	return path
+}
+
+// findDecls returns the declarations to move: the type declaration, followed
+// by its constructors and methods.  Methods and constructors are moved only
+// from files that are test files if and only if the type is declared in a
+// test file.
+func (r *ExtractFile) findDecls(spec *ast.TypeSpec, decl *ast.GenDecl) []*movedDecl {
+	var typeDecl *movedDecl
+	if len(decl.Specs) == 1 {
+		typeDecl = r.newMovedDecl(r.Filename, r.File, decl)
+	} else {
+		typeDecl = r.newMovedDecl(r.Filename, r.File, spec)
+		typeDecl.keyword = "type "
+	}
+
+	isTest := strings.HasSuffix(r.Filename, "_test.go")
+	constructors, methods := []*movedDecl{}, []*movedDecl{}
+	for _, file := range r.SelectedNodePkg.Syntax {
+		filename := r.Program.Fset.Position(file.Pos()).Filename
+		if strings.HasSuffix(filename, "_test.go") != isTest {
+			continue
+		}
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if r.isMethod(funcDecl) {
+				methods = append(methods, r.newMovedDecl(filename, file, funcDecl))
+			} else if r.isConstructor(funcDecl) {
+				constructors = append(constructors, r.newMovedDecl(filename, file, funcDecl))
+			}
+		}
+	}
+
+	result := append([]*movedDecl{typeDecl}, constructors...)
+	result = append(result, methods...)
+	for _, d := range result {
+		if usesCgo(d.file) {
+			r.Log.Errorf("%s cannot be modified because it uses cgo "+
+				"(import \"C\")", filepath.Base(d.filename))
+			r.Log.AssociateNode(d.node)
+			return nil
+		}
+		if _, err := r.files.read(d.filename); err != nil {
+			r.Log.Error(err)
+			return nil
+		}
+	}
+	for _, d := range result {
+		d.declText = r.newDeclText(r.files, d.filename, d.file, d.node)
+	}
+	return result
+}
+
+// newMovedDecl returns a movedDecl for the given node; its extent is computed
+// once the contents of its file have been read.
+func (r *ExtractFile) newMovedDecl(filename string, file *ast.File, node ast.Node) *movedDecl {
+	return &movedDecl{declText: &declText{filename: filename, file: file, node: node}}
+}
+
+// isMethod returns true if the given function is a method whose receiver has
+// the type being moved (or a pointer to it).
+func (r *ExtractFile) isMethod(funcDecl *ast.FuncDecl) bool {
+	if funcDecl.Recv == nil {
+		return false
+	}
+	fn, ok := r.SelectedNodePkg.TypesInfo.Defs[funcDecl.Name].(*types.Func)
+	if !ok {
+		return false
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	return recv != nil && r.isMovedType(recv.Type())
+}
+
+// isConstructor returns true if the given function is named NewT (or newT)
+// for the type T being moved and returns a T or *T.
+func (r *ExtractFile) isConstructor(funcDecl *ast.FuncDecl) bool {
+	if funcDecl.Recv != nil ||
+		!strings.EqualFold(funcDecl.Name.Name, "New"+r.typeName.Name()) {
+		return false
+	}
+	fn, ok := r.SelectedNodePkg.TypesInfo.Defs[funcDecl.Name].(*types.Func)
+	if !ok {
+		return false
+	}
+	results := fn.Type().(*types.Signature).Results()
+	for i := 0; i < results.Len(); i++ {
+		if r.isMovedType(results.At(i).Type()) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMovedType returns true if typ is the type being moved or a pointer to it.
+func (r *ExtractFile) isMovedType(typ types.Type) bool {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, ok := typ.(*types.Named)
+	return ok && named.Obj() == r.typeName
+}
+
+// newFileContents returns the contents of a new file in the package with the
+// given name containing the given declarations: header comments (e.g.,
+// copyright notice and build constraints; see newFileHeader), a package
+// clause, the given imports, and the moved declarations themselves.
+func (r *RefactoringBase) newFileContents(files *sourceFiles, pkgName string, decls []*movedDecl, imports []importSpec, licenseHeader string) (string, error) {
+	var buf bytes.Buffer
+	header := r.newFileHeader(files, r.File, licenseHeader)
+	if header != "" {
+		buf.WriteString(header)
+		buf.WriteString("\n\n")
+	}
+	fmt.Fprintf(&buf, "package %s\n", pkgName)
+	for _, d := range decls {
+		code := string(files.contents[d.filename][d.start:d.end])
+		// The keyword (if any) follows the doc comment
+		nodeStart := r.Program.Fset.Position(d.node.Pos()).Offset - d.start
+		if d.edits != nil {
+			var err error
+			if code, err = text.ApplyToString(d.edits, code); err != nil {
+				return "", err
+			}
+			nodeStart = d.edits.NewOffset(nodeStart)
+		}
+		buf.WriteString("\n")
+		buf.WriteString(code[:nodeStart])
+		buf.WriteString(d.keyword)
+		buf.WriteString(code[nodeStart:])
+		buf.WriteString("\n")
+	}
+
+	extent, replacement, err := rewriteImports("", buf.Bytes(),
+		func(fset *token.FileSet, file *ast.File) {
+			for _, imp := range imports {
+				astutil.AddNamedImport(fset, file, imp.name, imp.path)
+			}
+		})
+	if err != nil {
+		return "", err
+	}
+	es := text.NewEditSet()
+	es.Add(extent, replacement)
+	src, err := text.ApplyToString(es, buf.String())
+	if err != nil {
+		return "", err
+	}
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return "", err
+	}
+	return string(formatted), nil
+}
+
+// An importSpec describes an import needed by the new file.  The name is
+// empty unless the import must be renamed (or is a dot import).
+type importSpec struct {
+	name, path string
+}
+
+// importsUsedBy returns the imports required by the given declarations, whose
+// identifiers are resolved in the given types.Info.
+func importsUsedBy(info *types.Info, decls []*movedDecl) []importSpec {
+	found := map[importSpec]bool{}
+	for _, d := range decls {
+		dotImports := map[string]bool{}
+		for _, spec := range d.file.Imports {
+			if spec.Name != nil && spec.Name.Name == "." {
+				if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+					dotImports[path] = true
+				}
+			}
+		}
+		ast.Inspect(d.node, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			switch obj := info.Uses[id].(type) {
+			case nil:
+			case *types.PkgName:
+				imp := importSpec{path: obj.Imported().Path()}
+				if obj.Name() != obj.Imported().Name() {
+					imp.name = obj.Name()
+				}
+				found[imp] = true
+			default:
+				if obj.Pkg() != nil && dotImports[obj.Pkg().Path()] {
+					found[importSpec{".", obj.Pkg().Path()}] = true
+				}
+			}
+			return true
+		})
+	}
+
+	result := make([]importSpec, 0, len(found))
+	for imp := range found {
+		result = append(result, imp)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].path < result[j].path
+	})
+	return result
+}
+
+// usesCgo returns true if the given file imports "C".
+func usesCgo(file *ast.File) bool {
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil &&
+			path == "C" {
+			return true
+		}
+	}
+	return false
+}
+
+const extractFileDoc = `
+  <h4>Purpose</h4>
+  <p>The Extract to New File refactoring moves a type declaration, together
+  with its methods and constructors, into a new file in the same package.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a package-level type declaration (or the name of the type in its
+    declaration).</li>
+    <li>Activate the Extract to New File refactoring.</li>
+    <li>Optionally, enter a name for the new file.  By default, the file is
+    named after the type, in lowercase (e.g., <tt>point.go</tt> for a type
+    named <tt>Point</tt>).</li>
+  </ol>
+
+  <p>The following declarations are moved to the new file:</p>
+  <ul>
+    <li>The type declaration (including its doc comment).</li>
+    <li>Functions named New<i>T</i> (or new<i>T</i>) that return a <i>T</i>
+    or *<i>T</i>, where <i>T</i> is the name of the type.</li>
+    <li>All of the methods declared on the type, in any file of the package.
+    (If the type is declared in a test file, only methods in test files are
+    moved, and vice versa.)</li>
+  </ul>
+  <p>The new file begins with the same header comments (e.g., a copyright
+  notice or build constraints) as the file containing the type, and it
+  imports the packages used by the moved declarations.  Imports that are no
+  longer used in the original files are removed.  If the file containing the
+  type has no copyright notice, the notice from another file in the package
+  is used instead.  (From the command line, a license header can also be
+  given explicitly with the <tt>-license-header</tt> flag.)</p>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The selection is not a package-level type declaration.</li>
+    <li>The new file already exists.</li>
+    <li>A declaration to be moved is in a file that uses cgo.</li>
+  </ul>
+`
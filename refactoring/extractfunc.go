@@ -8,13 +8,17 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
+	"go/printer"
 	"go/token"
 	"go/types"
+	"path/filepath"
 	"reflect"
-	"sort"
+	"regexp"
+	"strings"
 
 	"github.com/godoctor/godoctor/analysis/cfg"
 	"github.com/godoctor/godoctor/analysis/dataflow"
+	"github.com/godoctor/godoctor/internal/varset"
 	"github.com/godoctor/godoctor/text"
 
 	"golang.org/x/tools/go/ast/astutil"
@@ -23,15 +27,10 @@ import (
 
 /* -=-=- Sorting -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
 
-// type for sorting []*types.Var variables alphabetically by name
-type varSlice []*types.Var
-
-func (t varSlice) Len() int           { return len(t) }
-func (t varSlice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
-func (t varSlice) Less(i, j int) bool { return t[i].Name() < t[j].Name() }
-
+// SortVars sorts the given variables by name (see varset.Sort), so that
+// extracted code always lists them in the same order.
 func SortVars(vars []*types.Var) {
-	sort.Sort(varSlice(vars))
+	varset.Sort(vars)
 }
 
 /* -=-=- stmtRange -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
@@ -66,11 +65,21 @@ type stmtRange struct {
 // newStmtRange creates a stmtRange corresponding to a selected region of a
 // file.  If the selected range of characters does not enclose complete
 // statements, the stmtRange is adjusted (if possible) to the closest legal
-// selection.  The given pkgInfo is used to determine the types and bindings of
-// variables in the selection.
+// selection; its Pos and End give the adjusted range.  An empty selection
+// (i.e., a cursor position) selects the statement containing it.  The given
+// pkgInfo is used to determine the types and bindings of variables in the
+// selection.
 func newStmtRange(file *ast.File, start, end token.Pos, pkgInfo *packages.Package) (*stmtRange, error) {
+	// The selection ends immediately before end, so the last selected
+	// character is at end-1.  An empty selection has no last character;
+	// using end-1 would find the path to the character preceding it.
+	empty := end <= start
+	last := end - 1
+	if empty {
+		end, last = start, start
+	}
 	startPath, _ := astutil.PathEnclosingInterval(file, start, start)
-	endPath, _ := astutil.PathEnclosingInterval(file, end-1, end-1)
+	endPath, _ := astutil.PathEnclosingInterval(file, last, last)
 
 	// Work downward from the root of the AST, counting the number of nodes
 	// that enclose both the start and end of the selection
@@ -89,11 +98,27 @@ func newStmtRange(file *ast.File, start, end token.Pos, pkgInfo *packages.Packag
 	// something similar), raise an error; it cannot be extracted.
 	blockDepth := deepestCommonAncestorDepth
 	body := []ast.Stmt{}
+	var clause ast.Stmt // set if the selection is inside a case clause
 loop:
 	for blockDepth > 0 {
 		switch node := startPath[len(startPath)-1-blockDepth].(type) {
 		case *ast.BlockStmt:
-			body = node.List
+			if !hasCaseClauses(startPath[len(startPath)-blockDepth]) {
+				body = node.List
+				break loop
+			}
+			// The selection is in the body of a switch or select
+			// statement but not inside a single case clause (e.g.,
+			// it ends with the whitespace following a clause)
+			clause = clauseContaining(node, start, end)
+			switch clause := clause.(type) {
+			case *ast.CaseClause:
+				body = clause.Body
+			case *ast.CommClause:
+				body = clause.Body
+			default:
+				return nil, errInvalidSelection("Please select a sequence of statements inside a single case of a switch or select statement.")
+			}
 			break loop
 		case *ast.CaseClause:
 			body = node.Body
@@ -121,6 +146,9 @@ loop:
 	// statements in the selection, from the enclosing
 	// BlockStmt/CaseClause/CommClause up through the root
 	pathToRoot := startPath[len(startPath)-1-blockDepth:]
+	if clause != nil {
+		pathToRoot = append([]ast.Node{clause}, pathToRoot...)
+	}
 
 	var enclosingFunc *ast.FuncDecl
 	for _, node := range pathToRoot {
@@ -142,6 +170,9 @@ loop:
 		overlapStart := maxPos(start, stmt.Pos())
 		overlapEnd := minPos(end, stmt.End())
 		inSelection := overlapStart < overlapEnd
+		if empty {
+			inSelection = stmt.Pos() <= start && start < stmt.End()
+		}
 		if inSelection && firstIdx < 0 {
 			// We found the first statement in the selection
 			firstIdx = i
@@ -157,6 +188,9 @@ loop:
 	}
 
 	if firstIdx < 0 || lastIdx < 0 {
+		if empty {
+			return nil, errInvalidSelection("Please select a sequence of statements inside a block.")
+		}
 		// There are no statements in the block.  Most likely, the user
 		// selected an empty block, {}.
 		return nil, errInvalidSelection("An empty block cannot be extracted")
@@ -176,26 +210,58 @@ loop:
 		enclosingFunc:         enclosingFunc,
 	}
 
+	result.analyzeBlocks()
+	return result, nil
+}
+
+// analyzeBlocks determines the CFG blocks inside the selected statements and
+// the definitions reaching them.
+func (r *stmtRange) analyzeBlocks() {
 	// Determine the subset of blocks in the CFG that correspond to
 	// statements within the selected region.
 	blocksInRange := []ast.Stmt{}
-	for _, stmt := range cfg.Blocks() {
-		if result.Contains(stmt) {
+	for _, stmt := range r.cfg.Blocks() {
+		if r.Contains(stmt) {
 			blocksInRange = append(blocksInRange, stmt)
 		}
 	}
-	result.blocksInRange = blocksInRange
+	r.blocksInRange = blocksInRange
 
 	// Find those definitions that reach the entry to the selected region.
 	reaching := make(map[ast.Stmt]struct{})
-	for _, entry := range result.EntryPoints() {
-		for def := range dataflow.DefsReaching(entry, cfg, pkgInfo) {
+	for _, entry := range r.EntryPoints() {
+		for def := range dataflow.DefsReaching(entry, r.cfg, r.pkgInfo) {
 			reaching[def] = struct{}{}
 		}
 	}
-	result.defsReachingSelection = reaching
+	r.defsReachingSelection = reaching
+}
 
-	return result, nil
+// hasCaseClauses returns true if the given node is a switch, type switch, or
+// select statement, i.e., if its body consists of case clauses rather than
+// statements.
+func hasCaseClauses(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		return true
+	}
+	return false
+}
+
+// clauseContaining returns the case clause in the body of a switch, type
+// switch, or select statement whose text (including any whitespace following
+// it) contains the region from start to end, or nil if there is none.
+func clauseContaining(body *ast.BlockStmt, start, end token.Pos) ast.Stmt {
+	for i, clause := range body.List {
+		limit := body.Rbrace
+		if i+1 < len(body.List) {
+			limit = body.List[i+1].Pos()
+		}
+		if clause.Pos() <= start && end <= limit {
+			return clause
+		}
+	}
+	return nil
 }
 
 // min returns the minimum of two integers.
@@ -229,18 +295,35 @@ func maxPos(m, n token.Pos) token.Pos {
 // that this only includes immediate children; to visit nested statements, use
 // Inspect.
 func (r *stmtRange) selectedStmts() []ast.Stmt {
-	list := []ast.Stmt{}
+	return r.blockStmts()[r.firstIdx : r.lastIdx+1]
+}
+
+// blockStmts returns all of the children of the enclosing
+// BlockStmt/CaseClause/CommClause, including those that are not selected.
+func (r *stmtRange) blockStmts() []ast.Stmt {
 	switch node := r.pathToRoot[0].(type) {
 	case *ast.BlockStmt:
-		list = node.List
+		return node.List
 	case *ast.CaseClause:
-		list = node.Body
+		return node.Body
 	case *ast.CommClause:
-		list = node.Body
+		return node.Body
 	default:
 		panic("unexpected node type")
 	}
-	return list[r.firstIdx : r.lastIdx+1]
+}
+
+// Scope returns the innermost scope containing the selected statements (i.e.,
+// the scope of the enclosing block, case clause, or function), or nil if it is
+// not known.
+func (r *stmtRange) Scope() *types.Scope {
+	node := r.pathToRoot[0]
+	if fn, ok := r.pathToRoot[1].(*ast.FuncDecl); ok && fn.Body == node {
+		// The statements in a function body are in the function's
+		// scope, along with its parameters
+		node = fn.Type
+	}
+	return r.pkgInfo.TypesInfo.Scopes[node]
 }
 
 // Inspect traverses the selected statements and their children.
@@ -303,6 +386,63 @@ func (r *stmtRange) ContainsReturn() bool {
 	return flag
 }
 
+// BranchesOutOfRange returns the break, continue, goto, and fallthrough
+// statements within the selected statements that transfer control to a
+// statement outside the selection (e.g., break outer, where the statement
+// labeled outer encloses the selection).  Branch statements inside function
+// literals are ignored, since their targets are always inside the literal.
+func (r *stmtRange) BranchesOutOfRange() []*ast.BranchStmt {
+	result := []*ast.BranchStmt{}
+	for _, stmt := range r.selectedStmts() {
+		// Nodes enclosing the current node, up to (but excluding) the
+		// selected statement
+		enclosing := []ast.Node{}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if n == nil {
+				enclosing = enclosing[:len(enclosing)-1]
+				return true
+			}
+			if _, ok := n.(*ast.FuncLit); ok {
+				return false
+			}
+			if branch, ok := n.(*ast.BranchStmt); ok {
+				if !r.branchTargetIsInRange(branch, enclosing) {
+					result = append(result, branch)
+				}
+			}
+			enclosing = append(enclosing, n)
+			return true
+		})
+	}
+	return result
+}
+
+// branchTargetIsInRange returns true if the statement to which the given
+// branch statement transfers control is within the selected statements.  The
+// enclosing argument lists the ancestors of the branch statement within the
+// selection.
+func (r *stmtRange) branchTargetIsInRange(branch *ast.BranchStmt, enclosing []ast.Node) bool {
+	if branch.Label != nil {
+		obj := r.pkgInfo.TypesInfo.ObjectOf(branch.Label)
+		if obj == nil {
+			return false
+		}
+		return r.Pos() <= obj.Pos() && obj.Pos() < r.End()
+	}
+
+	for i := len(enclosing) - 1; i >= 0; i-- {
+		switch enclosing[i].(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return true
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			if branch.Tok == token.BREAK || branch.Tok == token.FALLTHROUGH {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Contains returns true if the given node lies (lexically) within the region
 // of text corresponding to the selected statements.  Equivalently, it will
 // return true if the given node is either a selected statement or a descendent
@@ -446,39 +586,57 @@ func (r *stmtRange) String() string {
 type extractedFunc struct {
 	name       string                        // name of the new function
 	recv       *types.Var                    // receiver variable, or nil
+	recvName   string                        // receiver name, if not recv's
+	recvPtr    bool                          // receiver is *T, where recv has type T
 	params     []*types.Var                  // parameters for the new function
 	returns    []*types.Var                  // variables whose values will be returned
 	locals     []*types.Var                  // local variables to declare
 	localInits map[*types.Var]ast.Expr       // initialization expressions for locals
 	define     bool                          // x := f() instead of x = f()
+	varDecls   []*types.Var                  // results to declare before the call
 	code       []byte                        // code to copy into the function body
 	pkgFmt     func(p *types.Package) string // rewrite import uses
+	callPkg    string                        // package qualifying the call, or ""
+	doc        string                        // doc comment (with newline), or ""
+	templates  CodeTemplates                 // overrides ExtractedFuncTemplate
 }
 
 // SourceCode returns source code for (1) the new function declaration that
 // should be inserted, and (2) the function call that should replace the
-// selected statements.
-func (f *extractedFunc) SourceCode() (funcDecl, funcCall string) {
+// selected statements.  The declaration is generated by the
+// ExtractedFuncTemplate, so an error is returned if that template fails.
+func (f *extractedFunc) SourceCode() (funcDecl, funcCall string, err error) {
 	paramNames, paramTypes := namesAndTypes(f.params, f.pkgFmt)
-	funcDeclParams := createParamDecls(paramNames, paramTypes)
+	data := ExtractedFuncData{
+		Doc:    f.doc,
+		Name:   f.name,
+		Params: createParamDecls(paramNames, paramTypes),
+	}
 	funcCallArgs := commaSeparated(paramNames)
+	callName := f.name
+	if f.callPkg != "" {
+		callName = f.callPkg + "." + f.name
+	}
 	if f.recv != nil {
 		recvType := types.TypeString(f.recv.Type(), f.pkgFmt)
-		funcDecl = fmt.Sprintf("(%s %s) %s(%s)",
-			f.recv.Name(), recvType, f.name, funcDeclParams)
+		if f.recvPtr {
+			recvType = "*" + recvType
+		}
+		recvName := f.recv.Name()
+		if f.recvName != "" {
+			recvName = f.recvName
+		}
+		data.Recv = fmt.Sprintf("%s %s", recvName, recvType)
 		funcCall = fmt.Sprintf("%s.%s(%s)",
 			f.recv.Name(), f.name, funcCallArgs)
 	} else {
-		funcDecl = fmt.Sprintf("%s(%s)", f.name, funcDeclParams)
-		funcCall = fmt.Sprintf("%s(%s)", f.name, funcCallArgs)
+		funcCall = fmt.Sprintf("%s(%s)", callName, funcCallArgs)
 	}
 
 	names, types := namesAndTypes(f.locals, f.pkgFmt)
 	localVarDecls := createVarDecls(names, types, initStrings(f.localInits))
 	if len(f.returns) == 0 {
-		funcDecl = fmt.Sprintf("\n\nfunc %s {\n%s%s\n}\n",
-			funcDecl, localVarDecls, f.code)
-		funcCall = fmt.Sprintf("%s", funcCall)
+		data.Body = fmt.Sprintf("%s%s", localVarDecls, f.code)
 	} else {
 		returnNames, returnTypes := namesAndTypes(f.returns, f.pkgFmt)
 		returnExprs := commaSeparated(returnNames)
@@ -489,23 +647,25 @@ func (f *extractedFunc) SourceCode() (funcDecl, funcCall string) {
 			assignSymbol = " := "
 		}
 
-		funcDefReturnTypes := commaSeparated(returnTypes)
+		data.Results = commaSeparated(returnTypes)
 		if len(returnNames) > 1 {
-			funcDecl = fmt.Sprintf("\n\nfunc %s(%s) {\n%s%s\n%s\n}\n",
-				funcDecl, funcDefReturnTypes, localVarDecls,
-				f.code, returnStmt)
-			funcCall = fmt.Sprintf("%s%s%s",
-				returnExprs, assignSymbol, funcCall)
-		} else {
-			funcDecl = fmt.Sprintf("\n\nfunc %s %s {\n%s%s\n%s\n}\n",
-				funcDecl, funcDefReturnTypes, localVarDecls,
-				f.code, returnStmt)
-			funcCall = fmt.Sprintf("%s%s%s",
-				returnExprs, assignSymbol, funcCall)
+			data.Results = "(" + data.Results + ")"
 		}
+		data.Body = fmt.Sprintf("%s%s\n%s", localVarDecls, f.code,
+			returnStmt)
+		funcCall = fmt.Sprintf("%s%s%s",
+			returnExprs, assignSymbol, funcCall)
+
+		// Declare results that must not be declared by the call
+		declNames, declTypes := namesAndTypes(f.varDecls, f.pkgFmt)
+		funcCall = createVarDecls(declNames, declTypes, nil) + funcCall
 	}
 
-	return funcDecl, funcCall
+	funcDecl, err = executeTemplate(f.templates, ExtractedFuncTemplate, data)
+	if err != nil {
+		return "", "", err
+	}
+	return "\n\n" + funcDecl, funcCall, nil
 }
 
 // namesAndTypes receives a list of variables and returns strings describing
@@ -536,19 +696,37 @@ func initStrings(inits map[*types.Var]ast.Expr) map[string]string {
 	return result
 }
 
-// createVarDecls returns source code for a sequence of var statements
-// declaring variables with the given names, types, and initial values.
+// createVarDecls returns source code for a sequence of statements declaring
+// variables with the given names, types, and initial values.  A variable with
+// an initial value in localInits is declared using a short variable
+// declaration (x := init); other variables are declared with a var statement
+// (var x T), so they are initialized to their zero values.  Each statement is
+// followed by a newline, so the result is empty if there are no variables.
 func createVarDecls(names []string, types []string, localInits map[string]string) string {
 	var buf bytes.Buffer
-	for i := 0; i < len(names); i++ {
-		if init, ok := localInits[names[i]]; ok {
-			buf.WriteString(names[i] + " := " + init)
+	for i, name := range names {
+		// Types and initial values are already source code, so they are
+		// printed verbatim as identifiers
+		var stmt ast.Stmt
+		if init, ok := localInits[name]; ok {
+			stmt = &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(name)},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{ast.NewIdent(init)},
+			}
 		} else {
-			buf.WriteString("var " + names[i] + " " + types[i])
-		}
-		if i > 1 || i <= len(names)-1 {
-			buf.WriteString("\n")
+			stmt = &ast.DeclStmt{
+				Decl: &ast.GenDecl{
+					Tok: token.VAR,
+					Specs: []ast.Spec{&ast.ValueSpec{
+						Names: []*ast.Ident{ast.NewIdent(name)},
+						Type:  ast.NewIdent(types[i]),
+					}},
+				},
+			}
 		}
+		printer.Fprint(&buf, token.NewFileSet(), stmt)
+		buf.WriteString("\n")
 	}
 	return buf.String()
 }
@@ -590,22 +768,55 @@ type ExtractFunc struct {
 	RefactoringBase
 	funcName  string     // name of the extracted function
 	stmtRange *stmtRange // selected statements (to be extracted)
+	// If the function will be added to a different package, the package
+	// and the file to which it will be added (otherwise, nil)
+	targetPkg      *packages.Package
+	targetFile     *ast.File
+	targetFilename string
+	files          *sourceFiles
+	// If the function will be a method on the type of one of its
+	// parameters, the name of that parameter, the parameter itself (see
+	// checkReceiver), and whether the receiver must be a pointer
+	recvName string
+	recv     *types.Var
+	recvPtr  bool
+	addDoc   bool // add a TODO doc comment to the new function
+	// Overrides for the templates used to generate the new function
+	templates CodeTemplates
+	// If the selected statements are the body of a loop (see ExtractLoop),
+	// the loop and the label on it (or nil); continue statements targeting
+	// the loop become return statements in the extracted function
+	loop      ast.Stmt
+	loopLabel types.Object
 }
 
 func (r *ExtractFunc) Description() *Description {
 	return &Description{
 		Name:      "Extract Function",
 		Synopsis:  "Extracts statements to a new function/method",
-		Usage:     "<new_name>",
+		Usage:     "<new_name> [<package> [<receiver> [<add_doc>]]]",
 		HTMLDoc:   extractFuncDoc,
-		Multifile: false,
+		Multifile: true,
 		Params: []Parameter{{
 			Label:        "Name:",
 			Prompt:       "Enter a name for the new function.",
 			DefaultValue: "",
 		}},
-		OptionalParams: nil,
-		Hidden:         false,
+		OptionalParams: []Parameter{{
+			Label:        "Package:",
+			Prompt:       "Import path of the package to add the function to (default: the current package).",
+			DefaultValue: "",
+		}, {
+			Label:        "Receiver:",
+			Prompt:       "Name of a parameter whose type the new function should be a method on (default: none).",
+			DefaultValue: "",
+		}, {
+			Label:        "Add Doc Comment:",
+			Prompt:       "Add a TODO doc comment to the new function (as the Add GoDoc refactoring does).",
+			DefaultValue: false,
+		}},
+		Hidden:  false,
+		Quality: Production,
 	}
 }
 
@@ -613,11 +824,49 @@ func (r *ExtractFunc) Run(config *Config) *Result {
 	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
 		return &r.Result
 	}
+	r.loop, r.loopLabel = nil, nil
+	return r.extract(config)
+}
 
+// extract extracts the selected statements into a new function, as described
+// by the arguments in the given configuration.  It is called after Init, so
+// ExtractLoop can use it to extract a loop body.
+func (r *ExtractFunc) extract(config *Config) *Result {
 	r.funcName = (config.Args[0]).(string)
 	if !isIdentifierValid(r.funcName) {
 		r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
 			r.funcName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return &r.Result
+	}
+
+	// The same ExtractFunc may be run several times (e.g., by the test
+	// runner), so do not reuse the target package from a previous run
+	r.targetPkg, r.targetFile, r.targetFilename, r.files = nil, nil, "", nil
+	r.recvName, r.recv, r.recvPtr, r.addDoc = "", nil, false, false
+	r.templates = config.Templates
+	if len(config.Args) > 1 {
+		pkgPath := strings.TrimSpace(config.Args[1].(string))
+		r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+		if pkgPath != "" && !r.findTargetPackage(pkgPath) {
+			return &r.Result
+		}
+	}
+	if len(config.Args) > 2 {
+		r.recvName = strings.TrimSpace(config.Args[2].(string))
+	}
+	if len(config.Args) > 3 {
+		r.addDoc = config.Args[3].(bool)
+	}
+	if r.recvName != "" && r.targetPkg != nil {
+		r.Log.Error("A function extracted to another package cannot " +
+			"be a method, so a receiver cannot be specified.")
+		r.Log.AssociateCode(CodeInvalidArgs)
+		return &r.Result
+	}
+	// A method's name is checked against its receiver's fields and
+	// methods by checkReceiver
+	if r.recvName == "" && !r.checkFuncName() {
 		return &r.Result
 	}
 
@@ -626,33 +875,76 @@ func (r *ExtractFunc) Run(config *Config) *Result {
 	if err != nil {
 		r.Log.Error(err)
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
 		return &r.Result
 	}
+	// Editors can show the statements that were actually extracted,
+	// which may differ from the selection (e.g., a selected argument
+	// extracts the statement containing the call)
+	r.adjustSelection(r.stmtRange.Pos(), r.stmtRange.End())
 
 	if r.stmtRange.IsInAnonymousFunc() {
 		r.Log.Error("Code inside an anonymous function cannot be extracted.")
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeExtractAnonFunc)
+		return &r.Result
+	}
+
+	if branches := r.branchesOutOfRange(); len(branches) > 0 {
+		for _, branch := range branches {
+			r.Log.Errorf("The selected statements cannot be extracted "+
+				"since this %s statement transfers control to a "+
+				"statement outside the selection.", branch.Tok)
+			r.Log.AssociateNode(branch)
+			r.Log.AssociateCode(CodeExtractBranch)
+			if branch.Label != nil {
+				obj := r.SelectedNodePkg.TypesInfo.ObjectOf(branch.Label)
+				if obj != nil && obj.Pos().IsValid() {
+					r.Log.AddRelated(fmt.Sprintf(
+						"Label %s is declared here",
+						branch.Label.Name),
+						obj.Pos(), obj.Pos())
+				}
+			}
+		}
 		return &r.Result
 	}
 
+	if r.targetPkg != nil && !r.checkTargetPackage() {
+		return &r.Result
+	}
+
+	if r.recvName != "" && !r.checkReceiver() {
+		return &r.Result
+	}
+	if r.recvName == "" && r.targetPkg == nil &&
+		r.stmtRange.enclosingFunc.Recv == nil {
+		r.suggestReceiver()
+	}
+
 	// Errors from here onward are non-fatal: The extraction can proceed,
 	// but it may not preserve semantics.
 
 	if r.stmtRange.ContainsAnonymousFunc() {
 		r.Log.Error("Code containing anonymous functions may not extract correctly.")
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeExtractAnonFunc)
 	}
 
 	if r.stmtRange.ContainsDefer() {
 		r.Log.Error("Code containing defer statements may change behavior if it is extracted.")
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeExtractDefer)
 	}
 
 	if r.stmtRange.ContainsReturn() {
 		r.Log.Error("Code containing return statements may change behavior if it is extracted.")
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeExtractReturn)
 	}
 
+	r.checkAddressTaken()
+
 	// The next two checks determine if the single-entry-single-exit
 	// criterion is met.  The call to UpdateLog (below) will check the
 	// refactored code for errors.  If the SESE criterion is not met,
@@ -663,74 +955,280 @@ func (r *ExtractFunc) Run(config *Config) *Result {
 	if len(entryPoints) > 1 {
 		r.Log.Error("There are multiple control flow paths into the selected statements.  Extraction will likely be incorrect.")
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeExtractMultiEntries)
 	}
 
 	exitDests := r.stmtRange.ExitDestinations()
 	if len(exitDests) > 1 {
 		r.Log.Error("There are multiple control flow paths out of the selected statements.  Extraction will likely be incorrect.")
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeExtractMultiExits)
 	}
 
 	r.Log.ChangeInitialErrorsToWarnings()
 	r.addEdits()
-	r.FormatFileInEditor()
 	r.UpdateLog(config, true) // Check for errors in the refactored code
 	return &r.Result
 }
 
+// checkAddressTaken logs an error for each variable declared outside the
+// selected statements that would be copied when they are extracted (to a
+// parameter, result, or local variable of the extracted function) even
+// though it may be accessed through a pointer.  This is the case if its
+// address is taken in the selection and it is used afterward, since the
+// pointer would then refer to the copy, or if its address is taken outside
+// the selection and it is assigned in the selection, since assignments to
+// the copy would not be visible through the pointer.
+func (r *ExtractFunc) checkAddressTaken() {
+	assigned, updated, declared, used := r.stmtRange.LocalsReferenced()
+	defined := varset.Union(assigned, updated)
+	referenced := varset.Difference(varset.Union(defined, used), declared)
+	if r.recv != nil && r.recvPtr {
+		// The extracted method's receiver points to the variable
+		referenced = varset.Difference(referenced, []*types.Var{r.recv})
+	}
+	aliveLast := r.stmtRange.LocalsLiveAfterExit()
+
+	addressTaken := dataflow.AddressTaken(r.stmtRange.enclosingFunc.Body,
+		r.SelectedNodePkg)
+	for _, v := range referenced {
+		var inside, outside []ast.Expr
+		for _, expr := range addressTaken[v] {
+			if r.stmtRange.Contains(expr) {
+				inside = append(inside, expr)
+			} else {
+				outside = append(outside, expr)
+			}
+		}
+		switch {
+		case len(inside) > 0 && varset.Contains(aliveLast, v):
+			r.Log.Errorf("The address of %s is taken in the selected "+
+				"statements, so it cannot be copied into the "+
+				"extracted function.", v.Name())
+			r.Log.AssociateNode(inside[0])
+		case len(outside) > 0 && varset.Contains(defined, v):
+			r.Log.Errorf("%s is assigned in the selected statements, "+
+				"but its address is taken elsewhere, so it cannot "+
+				"be copied into the extracted function.", v.Name())
+			r.Log.AssociateNode(outside[0])
+		default:
+			continue
+		}
+		r.Log.AssociateCode(CodeExtractAddressTaken)
+		r.Log.AddRelated(fmt.Sprintf("%s is declared here", v.Name()),
+			v.Pos(), v.Pos())
+	}
+}
+
+// checkFuncName logs an error and returns false if a function named
+// r.funcName cannot be declared in the file to which it will be added: the
+// name is already declared in the package or by an import in the file, or it
+// is init (which cannot be called).  Otherwise, the conflict would only be
+// reported later as a confusing type error in the refactored code.
+func (r *ExtractFunc) checkFuncName() bool {
+	if r.funcName == "init" {
+		r.Log.Error("The function cannot be named init, since init " +
+			"functions cannot be called.")
+		r.Log.AssociateCode(CodeInvalidName)
+		return false
+	}
+	pkg, file, filename := r.SelectedNodePkg, r.File, r.Filename
+	if r.targetPkg != nil {
+		pkg, file, filename = r.targetPkg, r.targetFile, r.targetFilename
+	}
+	obj := packageLevelConflict(pkg, file, r.funcName)
+	if obj == nil {
+		return true
+	}
+	if _, isImport := obj.(*types.PkgName); isImport {
+		r.Log.Errorf("The function cannot be named %s, since %s "+
+			"imports a package with that name.", r.funcName,
+			filepath.Base(filename))
+	} else {
+		r.Log.Errorf("The function cannot be named %s, since %s is "+
+			"already declared in package %s.", r.funcName,
+			r.funcName, pkg.Types.Name())
+	}
+	r.Log.AssociateCode(CodeRenameConflict)
+	if obj.Pos().IsValid() {
+		r.Log.AddRelated(fmt.Sprintf("%s is declared here", r.funcName),
+			obj.Pos(), obj.Pos())
+	}
+	return false
+}
+
+// packageLevelConflict returns the object that a new package-level
+// declaration with the given name, added to the given file, would conflict
+// with: a package-level declaration in the package, or an import in the
+// file.  It returns nil if there is no such object.
+func packageLevelConflict(pkg *packages.Package, file *ast.File, name string) types.Object {
+	if obj := pkg.Types.Scope().Lookup(name); obj != nil {
+		return obj
+	}
+	if scope := pkg.TypesInfo.Scopes[file]; scope != nil {
+		return scope.Lookup(name)
+	}
+	return nil
+}
+
 // addEdits updates r.Edits, adding edits to insert a new function declaration
 // and replace the selected statements with a call to that function.
 func (r *ExtractFunc) addEdits() {
-	funcDecl, funcCall := r.createExtractedFunc().SourceCode()
+	if r.targetPkg != nil {
+		r.addEditsToTargetPackage()
+		return
+	}
+
+	qualifier := newTypeQualifier(r.SelectedNodePkg.Types, r.File)
+	funcDecl, funcCall, err := r.createExtractedFunc(qualifier).SourceCode()
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
 
 	// Replace the selected statements with a function call
-	offset := r.Program.Fset.Position(r.stmtRange.Pos()).Offset
-	length := r.Program.Fset.Position(r.stmtRange.End()).Offset - offset
-	r.Edits[r.Filename].Add(&text.Extent{offset, length}, funcCall)
+	offset, end := r.movedExtent()
+	r.Edits[r.Filename].Add(&text.Extent{offset, end - offset}, funcCall)
 
 	next := r.Program.Fset.Position(r.stmtRange.enclosingFunc.End()).Offset
 
 	// Insert the new function declaration
 	r.Edits[r.Filename].Add(&text.Extent{next, 0}, funcDecl)
+	r.removeLoopLabel()
+
+	// Import any packages needed to name the types of parameters, results,
+	// and locals
+	r.addImports(qualifier)
 }
 
 // createExtractedFunc returns an extractedFunc, which contains information
 // about the extracted function and how it should be called.  Source code can
-// be obtained from the extractedFunc object.
-func (r *ExtractFunc) createExtractedFunc() *extractedFunc {
+// be obtained from the extractedFunc object; types in that source code are
+// qualified using the given qualifier.
+func (r *ExtractFunc) createExtractedFunc(qualifier *typeQualifier) *extractedFunc {
 	recv, params, returns, locals, localInits, declareResult := r.analyzeVars()
 
-	startOffset := r.Program.Fset.Position(r.stmtRange.Pos()).Offset
-	endOffset := r.Program.Fset.Position(r.stmtRange.End()).Offset
+	startOffset, endOffset := r.movedExtent()
 	code := r.FileContents[startOffset:endOffset]
+	if r.targetPkg != nil {
+		code = r.codeForTargetPackage(qualifier)
+	}
+	recvName := ""
+	if r.recv != nil {
+		recvName = r.receiverRename()
+		if recvName != "" {
+			code = r.renameReceiverInCode(code, recvName)
+		}
+	}
+	if r.loop != nil {
+		code = r.replaceLoopContinues(code, returns)
+	}
 
+	define, varDecls := r.resultDecls(returns, declareResult)
+	doc := ""
+	if r.addDoc {
+		comment, err := docCommentStub(&ast.FuncDecl{}, r.funcName, "",
+			r.templates)
+		if err != nil {
+			r.Log.Error(err)
+		} else {
+			doc = comment + "\n"
+		}
+	}
 	return &extractedFunc{
 		name:       r.funcName,
 		recv:       recv,
+		recvName:   recvName,
+		recvPtr:    r.recvPtr,
 		params:     params,
 		returns:    returns,
 		locals:     locals,
 		localInits: localInits,
-		define:     declareResult,
+		define:     define,
+		varDecls:   varDecls,
 		code:       code,
-		pkgFmt:     pkgUseFmt(r.SelectedNodePkg.Types),
+		pkgFmt:     qualifier.qualify,
+		doc:        doc,
+		templates:  r.templates,
+	}
+}
+
+// resultDecls determines how the call to the extracted function should
+// assign its results to the given variables: either by declaring them
+// (x, y := f()) or by assigning them (x, y = f()), in which case the returned
+// varDecls must be declared (var x T) before the call.
+//
+// If declareResult is true, some of the variables are declared in the
+// selected statements, so they must be declared at the call.  However,
+// x, y := f() assigns to y only if y is declared in the same scope as the
+// call; if y is declared in an enclosing scope, a new y would be declared,
+// shadowing it.  In that case, the variables declared in the selected
+// statements are declared explicitly, and the call assigns to all of them.
+func (r *ExtractFunc) resultDecls(returns []*types.Var, declareResult bool) (define bool, varDecls []*types.Var) {
+	if !declareResult {
+		return false, nil
+	}
+	scope := r.stmtRange.Scope()
+	shadowed := false
+	for _, v := range returns {
+		if r.stmtRange.Pos() <= v.Pos() && v.Pos() < r.stmtRange.End() {
+			varDecls = append(varDecls, v)
+		} else if scope == nil || v.Parent() != scope {
+			shadowed = true
+		}
 	}
+	if !shadowed {
+		return true, nil
+	}
+	return false, varDecls
 }
 
-// pkgUseFmt returns a types.Qualifier similar to types.RelativeTo,
-// but instead of returning full paths, it returns only the package's base
-// name, i.e. 'github.com/some/pkg' -> 'pkg'. The current package's name
-// is also omitted (since it would be a circular dependency on itself).
-func pkgUseFmt(pkg *types.Package) types.Qualifier {
-	if pkg == nil {
-		return nil // wat
-	}
-	return func(other *types.Package) string {
-		if pkg == other {
-			return "" // same package; unqualified
+// directivePattern matches a comment that is a directive to a tool (e.g.,
+// //go:noinline or //lint:ignore) rather than prose.
+var directivePattern = regexp.MustCompile(`^//([a-z0-9]+:[a-z0-9]|nolint\b)`)
+
+// movedExtent returns the offsets of the start and end of the text that will
+// be moved into the extracted function.  This consists of the selected
+// statements, together with any directive comments (e.g., //nolint) on the
+// lines immediately preceding the first statement and following the last
+// statement on the same line.  Directives apply to the statements they are
+// attached to, so they must move with them.
+func (r *ExtractFunc) movedExtent() (start, end int) {
+	start = r.OffsetOfPos(r.stmtRange.Pos())
+	end = r.OffsetOfPos(r.stmtRange.End())
+	comments := []*ast.Comment{}
+	for _, cg := range r.File.Comments {
+		comments = append(comments, cg.List...)
+	}
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		cStart, cEnd := r.OffsetOfPos(c.Pos()), r.OffsetOfPos(c.End())
+		if cEnd > start {
+			continue
+		}
+		lineStart := bytes.LastIndexByte(r.FileContents[:cStart], '\n') + 1
+		if !directivePattern.MatchString(c.Text) ||
+			len(bytes.TrimSpace(r.FileContents[lineStart:cStart])) > 0 ||
+			len(bytes.TrimSpace(r.FileContents[cEnd:start])) > 0 ||
+			bytes.Count(r.FileContents[cEnd:start], []byte("\n")) != 1 {
+			break
+		}
+		start = cStart
+	}
+	for _, c := range comments {
+		cStart, cEnd := r.OffsetOfPos(c.Pos()), r.OffsetOfPos(c.End())
+		if cStart < end {
+			continue
+		}
+		between := r.FileContents[end:cStart]
+		if directivePattern.MatchString(c.Text) &&
+			len(bytes.TrimSpace(between)) == 0 &&
+			!bytes.Contains(between, []byte("\n")) {
+			end = cEnd
 		}
-		return other.Name()
+		break
 	}
+	return start, end
 }
 
 // analyzeVars determines (1) whether the extracted function should be a method
@@ -750,10 +1248,10 @@ func (r *ExtractFunc) analyzeVars() (recv *types.Var,
 	aliveFirst := r.stmtRange.LocalsLiveAtEntry()
 	aliveLast := r.stmtRange.LocalsLiveAfterExit()
 	assigned, updated, declared, used := r.stmtRange.LocalsReferenced()
-	defined := union(union(assigned, updated), declared)
+	defined := varset.Union(varset.Union(assigned, updated), declared)
 
 	// Params = LIVE_IN[Entry(selectionnode)] ⋂ USE[selection]
-	params = intersection(aliveFirst, union(union(used, assigned), updated))
+	params = varset.Intersection(aliveFirst, varset.Union(varset.Union(used, assigned), updated))
 
 	// returns = LIVE_OUT[exit(sel)] ⋂ DEF[sel]
 	// If someStruct is a pointer and someStruct.field is assigned, but
@@ -761,25 +1259,34 @@ func (r *ExtractFunc) analyzeVars() (recv *types.Var,
 	// returned.  Likewise, if individual elements of a slice are updated
 	// but the slice itself is not reassigned, then the slice variable
 	// does not need to be returned.
-	updatedOnlyThruPointers := difference(r.varsWithPointerOrSliceTypes(updated), assigned)
-	returns = difference(
-		intersection(aliveLast, defined),
+	updatedOnlyThruPointers := varset.Difference(r.varsWithPointerOrSliceTypes(updated), assigned)
+	returns = varset.Difference(
+		varset.Intersection(aliveLast, defined),
 		updatedOnlyThruPointers)
 
-	locals = difference(
-		union(difference(assigned, params),
-			difference(used, aliveFirst)),
+	locals = varset.Difference(
+		varset.Union(varset.Difference(assigned, params),
+			varset.Difference(used, aliveFirst)),
 		declared)
 
 	// If we are returning the value of a variable declared in the
 	// selected statements, then the result variable needs to be declared.
-	declareResult = len(intersection(returns, declared)) > 0
-
-	if recvNode := r.stmtRange.enclosingFunc.Recv; recvNode != nil {
+	declareResult = len(varset.Intersection(returns, declared)) > 0
+
+	// A function in another package cannot be a method; if the receiver
+	// is used, it is passed as an argument.  Likewise, if the extracted
+	// function will be a method on the type of one of its parameters
+	// (see checkReceiver), the enclosing method's receiver is an ordinary
+	// parameter.
+	if r.recv != nil {
+		recv = r.recv
+	} else if recvNode := r.stmtRange.enclosingFunc.Recv; recvNode != nil && r.targetPkg == nil && r.recvName == "" {
 		recv = r.SelectedNodePkg.TypesInfo.ObjectOf(recvNode.List[0].Names[0]).(*types.Var)
-		params = difference(params, []*types.Var{recv})
-		returns = difference(returns, []*types.Var{recv})
-		locals = difference(locals, []*types.Var{recv})
+	}
+	if recv != nil {
+		params = varset.Difference(params, []*types.Var{recv})
+		returns = varset.Difference(returns, []*types.Var{recv})
+		locals = varset.Difference(locals, []*types.Var{recv})
 	}
 
 	// If an argument always has a constant value, there is no reason to
@@ -787,7 +1294,7 @@ func (r *ExtractFunc) analyzeVars() (recv *types.Var,
 	// set it equal to its constant value.
 	constants := r.constantValues(params)
 	for param := range constants {
-		params = difference(params, []*types.Var{param})
+		params = varset.Difference(params, []*types.Var{param})
 		locals = append(locals, param)
 	}
 
@@ -1010,49 +1517,6 @@ func (r *ExtractFunc) varsWithPointerOrSliceTypes(varList []*types.Var) []*types
 	return result
 }
 
-func intersection(s1, s2 []*types.Var) []*types.Var {
-	result := []*types.Var{}
-	for i := 0; i < len(s2); i++ {
-		for j := 0; j < len(s1); j++ {
-			if s2[i] == s1[j] {
-				result = append(result, s2[i])
-			}
-		}
-	}
-	return result
-}
-
-func union(v1, v2 []*types.Var) []*types.Var {
-	insec := intersection(v1, v2) // check for duplicates and removes them
-	for _, a := range v2 {
-		v1 = append(v1, a)
-	}
-	v1 = difference(v1, insec)
-	for _, b := range insec {
-		v1 = append(v1, b) // adding back the variables to the array only once
-	}
-	SortVars(v1)
-	return v1
-}
-
-func difference(use, in []*types.Var) []*types.Var {
-	var flag bool
-	var result []*types.Var
-	for i := 0; i < len(use); i++ {
-		flag = false
-		for j := 0; j < len(in); j++ {
-			if use[i].Name() == in[j].Name() || use[i].Name() == "_" {
-				flag = true
-				break
-			}
-		}
-		if flag == false {
-			result = append(result, use[i])
-		}
-	}
-	return result
-}
-
 const extractFuncDoc = `
   <h4>Purpose</h4>
   <p>The Extract Function refactoring creates a new function (or method) from a
@@ -1067,9 +1531,51 @@ const extractFuncDoc = `
     <li>Enter a name for the new function that will be created.</li>
   </ol>
 
+  <p>If the selection does not consist of complete statements (e.g., only the
+  arguments of a call are selected, or the cursor is placed in a statement
+  without selecting anything), it is extended to the statements it overlaps.
+  Editors are told which statements were actually extracted, so they can
+  show them.</p>
+
   <p>The refactoring will automatically determine what local variables need to
   be passed to the extracted function and returned as results.</p>
 
+  <p>Optionally, enter the import path of a different package.  The new
+  function will be added to that package (at the end of one of its files)
+  rather than the current one.  Its name will be exported (e.g.,
+  <tt>computeTotal</tt> becomes <tt>ComputeTotal</tt>), it will be called
+  through the package's import name, and imports will be added to both files
+  as needed.  The package must be loaded as part of the refactoring scope
+  (e.g., because the current package imports it).  Since the current package
+  will import the other package, the extraction will be refused if the
+  selected statements refer to declarations in the current package, if the
+  function's signature would refer to types declared in the current package
+  (in particular, unexported types), or if the other package already imports
+  the current one.  A method's receiver is passed as an ordinary
+  argument.</p>
+
+  <p>Optionally, enter the name of one of the new function's parameters as the
+  receiver.  The new function will be a method on that parameter's type, which
+  must be a named type declared in the current package (or a pointer to one).
+  If the parameter is not a pointer but the selected statements modify it
+  (e.g., by assigning to one of its fields), the method will have a pointer
+  receiver, so that the modifications are still made to the caller's
+  variable; otherwise, the receiver will have the same type as the parameter.
+  If the type's other methods name their receivers differently (e.g.,
+  <tt>a</tt> rather than <tt>acct</tt>), the receiver is given the name they
+  use most often, unless that name is already used in the selected statements.
+  When the selected statements mostly use one such parameter, the refactoring
+  suggests this option.</p>
+
+  <p>Optionally, set the "Add Doc Comment" parameter to true to add a TODO doc
+  comment above the new function, like those added by the Add GoDoc
+  refactoring (e.g., <tt>// ParseHeader parses a header. TODO: NEEDS COMMENT
+  INFO</tt>).  This is useful when the new function is exported.  The
+  text of the comment and of the new function can be changed to follow a
+  project's conventions by overriding the <tt>docComment</tt> and
+  <tt>extractedFunc</tt> templates (from the command line, with the
+  <tt>-templates</tt> flag).</p>
+
   <p>An error or warning will be reported if the selected statements cannot be
   extracted into a new function.  Usually, this occurs because they contain a
   statement like <tt>return</tt> which will have a different meaning in the
@@ -1079,5 +1585,10 @@ const extractFuncDoc = `
   <ul>
     <li>Code containing <tt>return</tt> statements, <tt>defer</tt> statements,
     or anonymous functions cannot be extracted.</li>
+    <li>A variable declared outside the selected statements cannot be
+    extracted if it may be accessed through a pointer: that is, if its address
+    is taken in the selection (e.g., <tt>&amp;x</tt>, or <tt>x.M()</tt> where
+    <tt>M</tt> has a pointer receiver) and it is used afterward, or if it is
+    assigned in the selection and its address is taken elsewhere.</li>
   </ul>
 `
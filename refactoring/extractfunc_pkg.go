@@ -0,0 +1,383 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains the parts of the Extract Function refactoring that add
+// the extracted function to a different package than the one containing the
+// selected statements.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/packages"
+)
+
+// findTargetPackage finds the package with the given import path, to which
+// the extracted function will be added, along with the file in that package
+// to which it will be added, and exports the name of the new function.  If
+// the import path is that of the current package, the function is extracted
+// normally.  It logs an error and returns false if the function cannot be
+// added to the package.
+func (r *ExtractFunc) findTargetPackage(pkgPath string) bool {
+	origin := r.SelectedNodePkg
+	if pkgPath == origin.PkgPath {
+		return true
+	}
+
+	if filesystem.IsFakeStdinPath(r.Filename) {
+		r.Log.Error("A function cannot be extracted to another package " +
+			"when the source code is given on standard input.")
+		return false
+	}
+
+	var target *packages.Package
+	for _, pkg := range r.Program.AllPackages {
+		// Skip test variants of the package (e.g., "p [p.test]")
+		if pkg.PkgPath == pkgPath && pkg.ID == pkgPath {
+			target = pkg
+			break
+		}
+	}
+	if target == nil {
+		r.Log.Errorf("The package %s was not found.  It must be imported "+
+			"by %s or included in the refactoring scope.", pkgPath,
+			origin.PkgPath)
+		return false
+	}
+	if target.Name == "main" {
+		r.Log.Errorf("The function cannot be extracted to %s, since "+
+			"package main cannot be imported.", pkgPath)
+		return false
+	}
+	if importsPackage(target, origin.PkgPath, map[string]bool{}) {
+		r.Log.Errorf("The function cannot be extracted to %s, since it "+
+			"imports %s (directly or indirectly), so calling the "+
+			"function would create an import cycle.", pkgPath,
+			origin.PkgPath)
+		return false
+	}
+
+	r.targetFile, r.targetFilename = targetFile(r.Program.Fset.Position, target)
+	if r.targetFile == nil {
+		r.Log.Errorf("Package %s does not contain a Go source file to "+
+			"which the function can be added.", pkgPath)
+		return false
+	}
+
+	name := exportedName(r.funcName)
+	if !ast.IsExported(name) {
+		r.Log.Errorf("The name \"%s\" cannot be exported, so the "+
+			"function cannot be extracted to another package.",
+			r.funcName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return false
+	}
+	if target.Types.Scope().Lookup(name) != nil {
+		r.Log.Errorf("Package %s already declares %s.", pkgPath, name)
+		r.Log.AssociateCode(CodeInvalidName)
+		return false
+	}
+	r.funcName = name
+	r.targetPkg = target
+	return true
+}
+
+// importsPackage returns true if the given package imports the package with
+// the given import path, directly or indirectly.
+func importsPackage(pkg *packages.Package, pkgPath string, visited map[string]bool) bool {
+	if visited[pkg.PkgPath] {
+		return false
+	}
+	visited[pkg.PkgPath] = true
+	for _, imp := range pkg.Imports {
+		if imp.PkgPath == pkgPath || importsPackage(imp, pkgPath, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetFile returns the file in the given package to which an extracted
+// function should be added, along with its filename: the non-test file named
+// after the package (e.g., util.go in package util) if there is one, or the
+// first non-test file (alphabetically) otherwise.  It returns nil if the
+// package has no such file.
+func targetFile(position func(token.Pos) token.Position, pkg *packages.Package) (*ast.File, string) {
+	files := map[string]*ast.File{}
+	for _, file := range pkg.Syntax {
+		filename := position(file.Pos()).Filename
+		files[filename] = file
+	}
+	filenames := []string{}
+	for _, filename := range pkg.GoFiles {
+		if _, ok := files[filename]; ok &&
+			!strings.HasSuffix(filename, "_test.go") {
+			filenames = append(filenames, filename)
+		}
+	}
+	if len(filenames) == 0 {
+		return nil, ""
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		if filepath.Base(filename) == pkg.Name+".go" {
+			return files[filename], filename
+		}
+	}
+	return files[filenames[0]], filenames[0]
+}
+
+// exportedName returns the given name with its first letter capitalized.
+func exportedName(name string) string {
+	ch, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(ch)) + name[size:]
+}
+
+// checkTargetPackage checks that the selected statements can be moved to
+// r.targetPkg, which will be imported by the current package.  It logs an
+// error and returns false if they cannot.
+func (r *ExtractFunc) checkTargetPackage() bool {
+	origin := r.SelectedNodePkg.Types
+	target := r.targetPkg.Types
+	info := r.SelectedNodePkg.TypesInfo
+
+	// The function's signature and local variables must not refer to
+	// types declared in the current package, since the target package
+	// cannot import it (and unexported types would leak into the
+	// signature of an exported function)
+	_, params, returns, locals, _, _ := r.analyzeVars()
+	vars := append(append(append([]*types.Var{}, params...), returns...), locals...)
+	for _, v := range vars {
+		for _, typeName := range typesDeclaredIn(v.Type(), origin) {
+			if typeName.Exported() {
+				r.Log.Errorf("The function cannot be extracted to %s, "+
+					"since the type of %s refers to %s.%s, and "+
+					"%s cannot import %s.", target.Path(), v.Name(),
+					origin.Name(), typeName.Name(), target.Path(),
+					origin.Path())
+			} else {
+				r.Log.Errorf("The function cannot be extracted to %s, "+
+					"since the unexported type %s (the type of %s) "+
+					"would leak into another package.",
+					target.Path(), typeName.Name(), v.Name())
+			}
+			r.Log.AssociatePos(v.Pos(), v.Pos())
+			return false
+		}
+	}
+
+	// The selected statements must not refer to package-level
+	// declarations in the current package or dot-imported packages, and
+	// names they use must mean the same thing in the target package
+	ok := true
+	r.stmtRange.Inspect(func(n ast.Node) bool {
+		if !ok {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if x, isIdent := n.X.(*ast.Ident); isIdent {
+				if _, isPkg := info.Uses[x].(*types.PkgName); isPkg {
+					return false // qualified identifier
+				}
+			}
+		case *ast.Ident:
+			obj := info.Uses[n]
+			switch {
+			case obj == nil:
+			case obj.Parent() == types.Universe:
+				if target.Scope().Lookup(n.Name) != nil {
+					r.Log.Errorf("The selected statements cannot be "+
+						"moved to %s, since %s refers to a different "+
+						"declaration there.", target.Path(), n.Name)
+					r.Log.AssociateNode(n)
+					ok = false
+				}
+			case obj.Pkg() == origin && obj.Parent() == origin.Scope():
+				r.Log.Errorf("The selected statements cannot be moved "+
+					"to %s, since they refer to %s, which is declared "+
+					"in %s.", target.Path(), n.Name, origin.Path())
+				r.Log.AssociateNode(n)
+				ok = false
+			case obj.Pkg() != origin && obj.Pkg() != nil &&
+				obj.Parent() == obj.Pkg().Scope():
+				r.Log.Errorf("The selected statements cannot be moved "+
+					"to %s, since they refer to %s, which is imported "+
+					"by a dot import.", target.Path(), n.Name)
+				r.Log.AssociateNode(n)
+				ok = false
+			}
+		}
+		return ok
+	})
+	if !ok {
+		return false
+	}
+
+	// The call must refer to the target package by a name that is not
+	// shadowed at the position of the call
+	q := newTypeQualifier(origin, r.File)
+	if name := q.qualify(target); name != "" {
+		_, path, _ := r.Program.PathEnclosingInterval(r.stmtRange.Pos(),
+			r.stmtRange.Pos())
+		found := scopeAt(info, path).Lookup(name)
+		if _, isPkg := found.(*types.PkgName); found != nil && !isPkg {
+			r.Log.Errorf("The function cannot be extracted to %s, "+
+				"since %s is declared at the position of the call.",
+				target.Path(), name)
+			r.Log.AssociatePos(found.Pos(), found.Pos())
+			return false
+		}
+	}
+	return true
+}
+
+// typesDeclaredIn returns the named types in the given package that are
+// referred to by the given type.
+func typesDeclaredIn(typ types.Type, pkg *types.Package) []*types.TypeName {
+	result := []*types.TypeName{}
+	var visit func(types.Type, map[types.Type]bool)
+	visit = func(typ types.Type, visited map[types.Type]bool) {
+		if visited[typ] {
+			return
+		}
+		visited[typ] = true
+		switch t := typ.(type) {
+		case *types.Named:
+			if t.Obj().Pkg() == pkg {
+				result = append(result, t.Obj())
+			}
+		case *types.Pointer:
+			visit(t.Elem(), visited)
+		case *types.Slice:
+			visit(t.Elem(), visited)
+		case *types.Array:
+			visit(t.Elem(), visited)
+		case *types.Chan:
+			visit(t.Elem(), visited)
+		case *types.Map:
+			visit(t.Key(), visited)
+			visit(t.Elem(), visited)
+		case *types.Signature:
+			visit(t.Params(), visited)
+			visit(t.Results(), visited)
+		case *types.Tuple:
+			for i := 0; i < t.Len(); i++ {
+				visit(t.At(i).Type(), visited)
+			}
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				visit(t.Field(i).Type(), visited)
+			}
+		case *types.Interface:
+			for i := 0; i < t.NumMethods(); i++ {
+				visit(t.Method(i).Type(), visited)
+			}
+		}
+	}
+	visit(typ, map[types.Type]bool{})
+	return result
+}
+
+// codeForTargetPackage returns the text of the selected statements, with
+// package qualifiers replaced by the names under which the target file
+// imports those packages.
+func (r *ExtractFunc) codeForTargetPackage(q *typeQualifier) []byte {
+	info := r.SelectedNodePkg.TypesInfo
+	start, end := r.movedExtent()
+	code := r.FileContents[start:end]
+
+	var buf bytes.Buffer
+	offset := 0
+	r.stmtRange.Inspect(func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		pkgName, ok := info.Uses[x].(*types.PkgName)
+		if !ok {
+			return true
+		}
+		// Replace "x." with "name." (or nothing, if the name is in
+		// the target package or a dot import)
+		buf.Write(code[offset : r.OffsetOfPos(x.Pos())-start])
+		if name := q.qualify(pkgName.Imported()); name != "" {
+			buf.WriteString(name)
+			buf.WriteString(".")
+		}
+		offset = r.OffsetOfPos(sel.Sel.Pos()) - start
+		return false
+	})
+	buf.Write(code[offset:])
+	return buf.Bytes()
+}
+
+// addEditsToTargetPackage updates r.Edits, adding edits to insert a new
+// function declaration at the end of r.targetFile and replace the selected
+// statements with a call to that function.
+func (r *ExtractFunc) addEditsToTargetPackage() {
+	contents, err := r.files.read(r.targetFilename)
+	if err != nil {
+		r.Log.Errorf("Unable to read %s: %v", r.targetFilename, err)
+		return
+	}
+
+	qualifier := newTypeQualifier(r.targetPkg.Types, r.targetFile)
+	callerQualifier := newTypeQualifier(r.SelectedNodePkg.Types, r.File)
+	extracted := r.createExtractedFunc(qualifier)
+	extracted.callPkg = callerQualifier.qualify(r.targetPkg.Types)
+	funcDecl, funcCall, err := extracted.SourceCode()
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+
+	// Replace the selected statements with a function call, and remove
+	// imports that were used only by those statements
+	start, end := r.movedExtent()
+	moved := &declText{
+		filename: r.Filename,
+		file:     r.File,
+		node:     r.stmtRange.pathToRoot[0],
+		start:    start,
+		end:      end,
+	}
+	r.Edits[r.Filename].Add(&text.Extent{moved.start, moved.end - moved.start},
+		funcCall)
+	keep := map[*types.PkgName]bool{} // the call uses the target package
+	r.stmtRange.Inspect(func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			obj := r.SelectedNodePkg.TypesInfo.Uses[id]
+			if pkgName, ok := obj.(*types.PkgName); ok &&
+				pkgName.Imported() == r.targetPkg.Types {
+				keep[pkgName] = true
+			}
+		}
+		return true
+	})
+	r.updateImports(r.Filename, r.FileContents, callerQualifier,
+		r.unusedImports([]*declText{moved}, keep))
+
+	// Add the new function declaration to the end of the target file
+	r.Edits[r.targetFilename] = text.NewEditSet()
+	r.Edits[r.targetFilename].SetBase(contents)
+	r.Edits[r.targetFilename].Add(&text.Extent{len(contents), 0},
+		strings.TrimPrefix(funcDecl, "\n"))
+	r.addImportsToFile(r.targetFilename, contents, qualifier)
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestCreateVarDeclsNone(t *testing.T) {
+	assertEquals("", createVarDecls(nil, nil, nil), t)
+}
+
+func TestCreateVarDeclsOne(t *testing.T) {
+	assertEquals("var x int\n",
+		createVarDecls([]string{"x"}, []string{"int"}, nil), t)
+	assertEquals("x := 3\n",
+		createVarDecls([]string{"x"}, []string{"int"},
+			map[string]string{"x": "3"}), t)
+}
+
+func TestCreateVarDeclsMany(t *testing.T) {
+	names := []string{"a", "b", "c", "d"}
+	types := []string{"int", "*bytes.Buffer", "map[string][]int", "func(int) error"}
+	inits := map[string]string{"b": "new(bytes.Buffer)", "c": "map[string][]int{}"}
+	expected := `var a int
+b := new(bytes.Buffer)
+c := map[string][]int{}
+var d func(int) error
+`
+	assertEquals(expected, createVarDecls(names, types, inits), t)
+}
+
+func TestNewStmtRangeAdjustsSelection(t *testing.T) {
+	const src = `package main
+
+func foo(a, b int) {}
+
+func main() {
+	a, b := 1, 2
+	foo(a, b)
+	if a > 0 {
+		foo(a, b)
+	}
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:  map[ast.Expr]types.TypeAndValue{},
+		Defs:   map[*ast.Ident]types.Object{},
+		Uses:   map[*ast.Ident]types.Object{},
+		Scopes: map[ast.Node]*types.Scope{},
+	}
+	conf := &types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check("main", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgInfo := &packages.Package{Fset: fset, Types: pkg, TypesInfo: info}
+	tokFile := fset.File(file.Pos())
+
+	call := strings.Index(src, "foo(a, b)\n\tif")
+	inner := strings.Index(src, "\t\tfoo") + 2
+	tests := []struct {
+		start, end int
+		expected   string
+	}{
+		{call, call + len("foo(a, b)"), "foo(a, b)"},
+		{call - 1, call + len("foo(a, b)\n"), "foo(a, b)"},
+		{call + len("foo("), call + len("foo(a, b"), "foo(a, b)"},
+		{call, call, "foo(a, b)"},
+		{call + len("foo(a, b)"), call + len("foo(a, b)"), ""},
+		{inner, inner + len("foo(a, b)\n\t}"), "foo(a, b)"},
+		{call, inner + len("foo(a, b)\n\t}"),
+			"foo(a, b)\n\tif a > 0 {\n\t\tfoo(a, b)\n\t}"},
+	}
+	for _, test := range tests {
+		selection := src[test.start:test.end]
+		stmts, err := newStmtRange(file, tokFile.Pos(test.start),
+			tokFile.Pos(test.end), pkgInfo)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("Selecting %q at offset %d should fail",
+					selection, test.start)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Selecting %q: %v", selection, err)
+			continue
+		}
+		actual := src[tokFile.Offset(stmts.Pos()):tokFile.Offset(stmts.End())]
+		if actual != test.expected {
+			t.Errorf("Selecting %q: expected %q, got %q", selection,
+				test.expected, actual)
+		}
+	}
+}
@@ -6,19 +6,24 @@ package refactoring
 
 import (
 	"bytes"
+	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
 	"reflect"
+	"strings"
+	"unicode"
 
 	"github.com/godoctor/godoctor/analysis/cfg"
 	"github.com/godoctor/godoctor/analysis/dataflow"
+	"github.com/godoctor/godoctor/internal/varset"
 	"github.com/godoctor/godoctor/text"
 )
 
 type ExtractLocal struct {
 	RefactoringBase
-	varName string
+	varName  string
+	varNames []string // Names of the new variables (>1 for tuple types)
 }
 
 func (r *ExtractLocal) Description() *Description {
@@ -35,6 +40,7 @@ func (r *ExtractLocal) Description() *Description {
 		}},
 		OptionalParams: nil,
 		Hidden:         false,
+		Quality:        Testing,
 	}
 }
 
@@ -46,17 +52,43 @@ func (r *ExtractLocal) Run(config *Config) *Result {
 	}
 
 	r.varName = config.Args[0].(string)
-	if !isIdentifierValid(r.varName) {
-		r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
-			r.varName)
-		return &r.Result
+	r.varNames = strings.FieldsFunc(r.varName, func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c)
+	})
+	if len(r.varNames) == 0 {
+		r.varNames = []string{r.varName}
+	}
+	for _, name := range r.varNames {
+		if !isIdentifierValid(name) {
+			r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
+				name)
+			r.Log.AssociateCode(CodeInvalidName)
+			return &r.Result
+		}
 	}
 
 	// First check preconditions that cause fatal errors
 	// (i.e., the transformation cannot proceed unless they are met,
 	// since it won't know where to insert the extracted expression,
 	// or the extraction is likely to produce invalid code)
-	if r.checkSelectedNodeIsExpr() &&
+	if r.checkExprIsExtractable() {
+		// Now, check preconditions that are only for semantic
+		// preservation (i.e., they should not block the refactoring,
+		// but the user should be made aware of a potential problem)
+		r.checkForNameConflict()
+		// Finally, perform the transformation
+		r.addEdits(r.findStmtToInsertBefore())
+		r.UpdateLog(config, false)
+	}
+	return &r.Result
+}
+
+// checkExprIsExtractable checks the preconditions that cause fatal errors,
+// logging an error and returning false if the selected expression cannot be
+// extracted.  (This is also used to find extractable regions; see
+// ExtractableRegions.)
+func (r *ExtractLocal) checkExprIsExtractable() bool {
+	return r.checkSelectedNodeIsExpr() &&
 		r.checkExprHasValidType() &&
 		r.checkExprIsNotFieldSelector() &&
 		r.checkExprAddressIsNotTaken() &&
@@ -69,18 +101,9 @@ func (r *ExtractLocal) Run(config *Config) *Result {
 		r.checkExprIsNotAssignStmtLhs() &&
 		r.checkEnclosingIfStmt() &&
 		r.checkEnclosingForStmt() &&
+		r.checkEnclosingSwitchStmt() &&
 		r.checkExprIsNotRangeStmtLhs() &&
-		r.checkExprIsNotInCaseClauseOfTypeSwitchStmt() {
-		// Now, check preconditions that are only for semantic
-		// preservation (i.e., they should not block the refactoring,
-		// but the user should be made aware of a potential problem)
-		r.checkForNameConflict()
-		// Finally, perform the transformation
-		r.addEdits(r.findStmtToInsertBefore())
-		r.FormatFileInEditor()
-		r.UpdateLog(config, false)
-	}
-	return &r.Result
+		r.checkExprIsNotInCaseClauseOfTypeSwitchStmt()
 }
 
 // checkSelectedNodeIsExpr checks that the user has selected an expression,
@@ -112,8 +135,14 @@ func (r *ExtractLocal) checkExprHasValidType() bool {
 	// fmt.Printf("Node is %s\n", reflect.TypeOf(r.SelectedNode))
 	// fmt.Printf("Type is %s\n", exprType)
 
-	if _, isFunctionType := exprType.(*types.Tuple); isFunctionType {
-		r.Log.Errorf("The selected expression cannot be assigned to a variable since it has a tuple type %s", exprType)
+	if tuple, isTuple := exprType.(*types.Tuple); isTuple {
+		return r.checkTupleCanBeExtracted(tuple)
+	}
+
+	if len(r.varNames) > 1 {
+		r.Log.Errorf("The selected expression has a single value, "+
+			"so only one variable name may be given (found %d)",
+			len(r.varNames))
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
 		return false
 	}
@@ -127,6 +156,54 @@ func (r *ExtractLocal) checkExprHasValidType() bool {
 	return true
 }
 
+// checkTupleCanBeExtracted determines whether a multi-valued expression (a
+// function call returning several results) can be assigned to several new
+// variables, logging an error and returning false if it cannot.  This is
+// possible only when the call is the sole right-hand side of an assignment,
+// the sole result in a return statement, or the sole argument to a function
+// call, since only then can it be replaced by a list of variables.  If a
+// single name was given, names for the new variables are generated by
+// appending 1, 2, etc. to that name.
+func (r *ExtractLocal) checkTupleCanBeExtracted(tuple *types.Tuple) bool {
+	// Comma-ok expressions (v, ok := m[k]) have a tuple type only in
+	// the context of a two-valued assignment, so they cannot be extracted
+	if _, isCall := r.SelectedNode.(*ast.CallExpr); !isCall {
+		r.Log.Errorf("The selected expression cannot be assigned to variables since it has a tuple type %s", tuple)
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+
+	allowed := false
+	switch parent := r.PathEnclosingSelection[1].(type) {
+	case *ast.AssignStmt:
+		allowed = len(parent.Rhs) == 1 && parent.Rhs[0] == r.SelectedNode
+	case *ast.ReturnStmt:
+		allowed = len(parent.Results) == 1
+	case *ast.CallExpr:
+		allowed = len(parent.Args) == 1 && parent.Args[0] == r.SelectedNode
+	}
+	if !allowed {
+		r.Log.Errorf("The selected expression cannot be assigned to variables since it has a tuple type %s", tuple)
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+
+	if len(r.varNames) == 1 {
+		base := r.varNames[0]
+		r.varNames = make([]string, tuple.Len())
+		for i := range r.varNames {
+			r.varNames[i] = fmt.Sprintf("%s%d", base, i+1)
+		}
+	} else if len(r.varNames) != tuple.Len() {
+		r.Log.Errorf("The selected expression has %d values, but "+
+			"%d variable names were given", tuple.Len(),
+			len(r.varNames))
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	return true
+}
+
 func (r *ExtractLocal) checkExprIsNotFieldSelector() bool {
 	parentNode := r.PathEnclosingSelection[1]
 	if selectorExpr, ok := parentNode.(*ast.SelectorExpr); ok {
@@ -256,32 +333,36 @@ func (r *ExtractLocal) checkExprHasEnclosingStmt() bool {
 //
 // Precondition: r.enclosingStmtIndex() >= 0
 func (r *ExtractLocal) checkEnclosingStmtIsAllowed() bool {
-	// fmt.Printf("Enclosing stmt is %s\n", reflect.TypeOf(r.enclosingStmt()))
-	switch r.enclosingStmt().(type) {
+	switch stmt := r.enclosingStmt().(type) {
 	case *ast.AssignStmt:
 		return true
 	case *ast.CaseClause:
 		return true
 	//case *ast.DeclStmt: // const, type, or var
-	//case *ast.DeferStmt:
+	case *ast.DeferStmt:
+		return r.checkExprIsNotDeferredCall(stmt.Call, "defer")
 	//case *ast.EmptyStmt: impossible
 	case *ast.ExprStmt:
 		return true
 	case *ast.ForStmt:
 		return true
-	//case *ast.GoStmt:
+	case *ast.GoStmt:
+		return r.checkExprIsNotDeferredCall(stmt.Call, "go")
 	case *ast.IfStmt:
 		return true
-	//case *ast.IncDecStmt:
+	case *ast.IncDecStmt:
+		return true
 	//case *ast.LabeledStmt not allowed - label cannot be extracted
 	case *ast.RangeStmt:
 		return true
 	case *ast.ReturnStmt:
 		return true
-	//case *ast.SelectStmt:
-	//case *ast.SendStmt:
-	//case *ast.SwitchStmt:
-	//case *ast.TypeSwitchStmt:
+	//case *ast.SelectStmt: no expressions, except in comm clauses
+	case *ast.SendStmt:
+		return true
+	case *ast.SwitchStmt:
+		return true
+	//case *ast.TypeSwitchStmt: no expressions, except in Assign
 	default:
 		r.Log.Errorf("The selected expression cannot be extracted.")
 		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
@@ -291,9 +372,26 @@ func (r *ExtractLocal) checkEnclosingStmtIsAllowed() bool {
 	}
 }
 
+// checkExprIsNotDeferredCall determines if the selected node is the function
+// call in a defer or go statement (given the call and the keyword), logging
+// an error and returning false if it is.  The call cannot be assigned to a
+// variable since it must be executed later (or in a new goroutine); however,
+// the function value and arguments are evaluated immediately, so they can be
+// extracted.
+func (r *ExtractLocal) checkExprIsNotDeferredCall(call *ast.CallExpr, keyword string) bool {
+	if r.SelectedNode == call {
+		r.Log.Errorf("The selected expression cannot be extracted since "+
+			"it is the function call in a %s statement.", keyword)
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	return true
+}
+
 // checkExprIsNotAssignStmtLhs determines if the selected node is one of the
-// LHS expressions for the given assignment statement, logging an error and
-// returning false if it is.
+// LHS expressions for the given assignment statement, or the operand of an
+// increment or decrement statement, logging an error and returning false if
+// it is.
 //
 // Note, in particular, that this prevents extracting _.
 //
@@ -301,14 +399,21 @@ func (r *ExtractLocal) checkEnclosingStmtIsAllowed() bool {
 // (e.g., the subscript expression in a[i+2]=...), but not the entire expression.
 func (r *ExtractLocal) checkExprIsNotAssignStmtLhs() bool {
 	for _, node := range r.PathEnclosingSelection {
-		if asgt, ok := node.(*ast.AssignStmt); ok {
-			for _, lhsExpr := range asgt.Lhs {
+		switch stmt := node.(type) {
+		case *ast.AssignStmt:
+			for _, lhsExpr := range stmt.Lhs {
 				if r.SelectedNode == lhsExpr {
 					r.Log.Error("The selected expression cannot be extracted since it is assigned to.")
 					r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
 					return false
 				}
 			}
+		case *ast.IncDecStmt:
+			if r.SelectedNode == stmt.X {
+				r.Log.Errorf("The selected expression cannot be extracted since it is the operand of %s.", stmt.Tok)
+				r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+				return false
+			}
 		}
 	}
 	return true
@@ -321,16 +426,23 @@ func (r *ExtractLocal) checkExprIsNotAssignStmtLhs() bool {
 //
 // There are several problems with if-statements:
 // (1) if x := 3; x < 5
-//     Here, the definition (and declaration) of x in the init statement
-//     reaches the condition, so an expression involving x cannot be
-//     extracted from the condition.
+//
+//	Here, the definition (and declaration) of x in the init statement
+//	reaches the condition, so an expression involving x cannot be
+//	extracted from the condition.
+//
 // (2) if thing, ok := x.(*Thing); ok
-//     The type assertion cannot be extracted, since it assigns both thing and
-//     ok in this context.
+//
+//	The type assertion cannot be extracted, since it assigns both thing and
+//	ok in this context.
+//
 // (3) if value, found := myMap[entry]
-//     Similar.
+//
+//	Similar.
+//
 // (4) if x := 3; x < 0 {} else if x < 5 {}
-//     The "x < 5" depends on the initialization of the parent if-statement.
+//
+//	The "x < 5" depends on the initialization of the parent if-statement.
 //
 // Precondition: r.enclosingStmtIndex() >= 0
 func (r *ExtractLocal) checkEnclosingIfStmt() bool {
@@ -395,7 +507,8 @@ func (r *ExtractLocal) enclosingFuncDecl() *ast.FuncDecl {
 // condition.
 //
 // For example:
-//     if variable := 1; variable < 5 {}  // Variable cannot be extracted
+//
+//	if variable := 1; variable < 5 {}  // Variable cannot be extracted
 func (r *ExtractLocal) checkForReachingDefsFromIfStmtInit(ifStmt *ast.IfStmt, du map[ast.Stmt]map[ast.Stmt]struct{}) bool {
 	if ifStmt.Init == nil {
 		return true
@@ -427,20 +540,10 @@ func (r *ExtractLocal) varsInSelectionWithReachingDefsFrom(from ast.Stmt, defUse
 		r.SelectedNodePkg)
 	use := dataflow.Vars(r.SelectedNode.(ast.Expr), r.SelectedNodePkg)
 
-	for variable := range asgt {
-		if _, used := use[variable]; used {
-			result[variable] = struct{}{}
-		}
-	}
-	for variable := range updt {
-		if _, used := use[variable]; used {
-			result[variable] = struct{}{}
-		}
-	}
-	for variable := range decl {
-		if _, used := use[variable]; used {
-			result[variable] = struct{}{}
-		}
+	defined := varset.Union(varset.Union(varset.Of(asgt), varset.Of(updt)),
+		varset.Of(decl))
+	for _, variable := range varset.Intersection(defined, varset.Of(use)) {
+		result[variable] = struct{}{}
 	}
 	return result
 }
@@ -449,7 +552,7 @@ func (r *ExtractLocal) varsInSelectionWithReachingDefsFrom(from ast.Stmt, defUse
 // the string "the variables x, y, and z" (for use in an error message)
 func describeVars(vars map[*types.Var]struct{}) string {
 	names := []string{}
-	for variable := range vars {
+	for _, variable := range varset.Of(vars) {
 		names = append(names, variable.Name())
 	}
 
@@ -483,13 +586,14 @@ func describeVars(vars map[*types.Var]struct{}) string {
 // statements.
 //
 // For example:
-//     if a := 1; false {
-//     } else if b := 2; false {
-//     } else if c := 3; a + b == c {  // a + b cannot be extracted because
-//                                     // the extracted variable assignment
-//                                     // will be inserted before the outermost
-//                                     // if-statement
-//     }
+//
+//	if a := 1; false {
+//	} else if b := 2; false {
+//	} else if c := 3; a + b == c {  // a + b cannot be extracted because
+//	                                // the extracted variable assignment
+//	                                // will be inserted before the outermost
+//	                                // if-statement
+//	}
 //
 // Precondition: The selected expression occurs in either the initialization
 // statement or the condition of an if-statement.
@@ -529,12 +633,15 @@ func (r *ExtractLocal) checkForReachingDefsFromElseIfChain(ifStmtIdx int, du map
 //
 // There are several problems with if-statements:
 // (1) for i = 0; i < x; i++ {}
-//     The variable i cannot be extracted from the condition because it depends
-//     on the definition (assignment) in the initialization.  However, the
-//     variable x can be extracted.
+//
+//	The variable i cannot be extracted from the condition because it depends
+//	on the definition (assignment) in the initialization.  However, the
+//	variable x can be extracted.
+//
 // (2) for i = 0; i < x; i++ { x-- }
-//     Here, the variable x cannot be extracted from the condition because it
-//     is assigned in the body of the loop.
+//
+//	Here, the variable x cannot be extracted from the condition because it
+//	is assigned in the body of the loop.
 //
 // Precondition: r.enclosingStmtIndex() >= 0
 func (r *ExtractLocal) checkEnclosingForStmt() bool {
@@ -655,6 +762,98 @@ func (r *ExtractLocal) findDefsInBodyReachingSelection(enclosingForStmt *ast.For
 	return result
 }
 
+// checkEnclosingSwitchStmt determines if the selected expression is in the
+// header of a switch or type switch statement -- its initialization statement,
+// its tag (switch x+1 {), its type switch guard (switch y := x.(type) {), or
+// a case clause -- and, if so, determines whether it can be extracted,
+// logging an error if it cannot.
+//
+// The assignment to the extracted variable is inserted before the switch
+// statement, so the selected expression cannot use a variable assigned in
+// the switch statement's initialization statement; e.g., x+1 cannot be
+// extracted from switch x := f(); x+1 {.  An expression in the
+// initialization statement itself can be extracted.
+//
+// Expressions in the send or receive statement of a comm clause (case v :=
+// <-ch:) cannot be extracted either, since the statement must remain a
+// single send or receive operation.
+//
+// Precondition: r.enclosingStmtIndex() >= 0
+func (r *ExtractLocal) checkEnclosingSwitchStmt() bool {
+	if _, isInComm := r.isCommClauseComm(); isInComm {
+		r.Log.Error("Expressions cannot be extracted from a comm " +
+			"clause of a select statement.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+
+	switchStmt, isInHeader := r.isSwitchStmtHeader()
+	if !isInHeader {
+		return true
+	}
+
+	var init ast.Stmt
+	switch switchStmt := switchStmt.(type) {
+	case *ast.SwitchStmt:
+		init = switchStmt.Init
+	case *ast.TypeSwitchStmt:
+		init = switchStmt.Init
+	}
+	if init == nil || r.enclosingStmt() == init {
+		return true
+	}
+
+	vars := r.varsInSelectionWithReachingDefsFrom(init, r.defUse())
+	if len(vars) > 0 {
+		r.Log.Errorf("This expression cannot be extracted "+
+			"because it uses %s assigned in the "+
+			"enclosing switch statement's initialization "+
+			"statement.", describeVars(vars))
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	return true
+}
+
+// isSwitchStmtHeader determines if the selected expression is part of the
+// header of a switch or type switch statement (see checkEnclosingSwitchStmt),
+// returning true or false; if it returns true, the first return value is the
+// enclosing switch or type switch statement.
+//
+// Precondition: r.enclosingStmtIndex() >= 0
+func (r *ExtractLocal) isSwitchStmtHeader() (ast.Stmt, bool) {
+	index := r.enclosingStmtIndex()
+	switch stmt := r.enclosingStmt().(type) {
+	case *ast.SwitchStmt:
+		return stmt, true
+	case *ast.CaseClause:
+		// grandparent will be switch or type switch statement
+		return r.PathEnclosingSelection[index+2].(ast.Stmt), true
+	}
+	switch parent := r.PathEnclosingSelection[index+1].(type) {
+	case *ast.SwitchStmt:
+		return parent, r.enclosingStmt() == parent.Init
+	case *ast.TypeSwitchStmt:
+		return parent, r.enclosingStmt() == parent.Init ||
+			r.enclosingStmt() == parent.Assign
+	}
+	return nil, false
+}
+
+// isCommClauseComm determines if the selected expression is part of the
+// send or receive statement in a comm clause of a select statement (e.g.,
+// case v := <-ch:), returning true or false; if it returns true, the first
+// return value is the enclosing comm clause.
+//
+// Precondition: r.enclosingStmtIndex() >= 0
+func (r *ExtractLocal) isCommClauseComm() (*ast.CommClause, bool) {
+	index := r.enclosingStmtIndex()
+	if clause, found := r.PathEnclosingSelection[index+1].(*ast.CommClause); found {
+		return clause, r.enclosingStmt() == clause.Comm
+	}
+	return nil, false
+}
+
 // checkExprIsNotRangeStmtLhs determines if the selected node is either the key
 // or value expression for a range statement, logging an error and returning
 // false if it is.
@@ -707,20 +906,22 @@ func (r *ExtractLocal) checkForNameConflict() bool {
 	// scope.WriteTo(&buf, 0, true)
 	// fmt.Println(buf.String())
 
-	existingObj := scope.Lookup(r.varName)
-	if existingObj != nil {
-		r.Log.Errorf("If a variable named %s is introduced, it will "+
-			"conflict with an existing declaration.", r.varName)
-		r.Log.AssociatePos(existingObj.Pos(), existingObj.Pos())
-		return false
-	}
+	for _, name := range r.varNames {
+		existingObj := scope.Lookup(name)
+		if existingObj != nil {
+			r.Log.Errorf("If a variable named %s is introduced, it will "+
+				"conflict with an existing declaration.", name)
+			r.Log.AssociatePos(existingObj.Pos(), existingObj.Pos())
+			return false
+		}
 
-	_, existingObj = scope.LookupParent(r.varName, r.SelectedNode.Pos())
-	if existingObj != nil {
-		r.Log.Errorf("If a variable named %s is introduced, it will "+
-			"shadow an existing declaration.", r.varName)
-		r.Log.AssociatePos(existingObj.Pos(), existingObj.Pos())
-		return false
+		_, existingObj = scope.LookupParent(name, r.SelectedNode.Pos())
+		if existingObj != nil {
+			r.Log.Errorf("If a variable named %s is introduced, it will "+
+				"shadow an existing declaration.", name)
+			r.Log.AssociatePos(existingObj.Pos(), existingObj.Pos())
+			return false
+		}
 	}
 
 	return true
@@ -770,6 +971,9 @@ func (r *ExtractLocal) findStmtToInsertBefore() ast.Stmt {
 		if enclosingFor, isPost := r.isForStmtPost(); isPost {
 			return enclosingFor
 		}
+		if switchStmt, isHeader := r.isSwitchStmtHeader(); isHeader {
+			return switchStmt
+		}
 
 		return r.enclosingStmt().(ast.Stmt)
 	}
@@ -787,14 +991,14 @@ func (r *ExtractLocal) findStmtToInsertBefore() ast.Stmt {
 // As the following example shows, this traces else-if chains upward.
 // This is not the same as finding the outermost enclosing if-statement.
 //
-//     if (v) {                 // The beginning of the else-if chain is NOT v;
-//         if (w) {             // it is w...
-//         } else if (x) {
-//             if (y) {
-//             } else if (z) {  // ...if we start from z
-//             }
-//         }
-//     }
+//	if (v) {                 // The beginning of the else-if chain is NOT v;
+//	    if (w) {             // it is w...
+//	    } else if (x) {
+//	        if (y) {
+//	        } else if (z) {  // ...if we start from z
+//	        }
+//	    }
+//	}
 func (r *ExtractLocal) findBeginningOfElseIfChain(index int) int {
 	ifStmt := r.PathEnclosingSelection[index].(*ast.IfStmt)
 	if index+1 < len(r.PathEnclosingSelection) {
@@ -811,14 +1015,16 @@ func (r *ExtractLocal) addEdits(insertBefore ast.Stmt) {
 	selectedExprEnd := r.getEndOffset(r.SelectedNode)
 	selectedExprLen := selectedExprEnd - selectedExprOffset
 
+	varList := strings.Join(r.varNames, ", ")
+
 	// First, replace the original expression.
-	r.Edits[r.Filename].Add(&text.Extent{selectedExprOffset, selectedExprLen}, r.varName)
+	r.Edits[r.Filename].Add(&text.Extent{selectedExprOffset, selectedExprLen}, varList)
 
 	// Then, add the assignment statement afterward.
 	// If this inserts at the same position as the replacement, this
 	// guarantees that it will be inserted before it, which is what we want
 	expression := string(r.FileContents[selectedExprOffset:selectedExprEnd])
-	assignment := r.varName + " := " + expression + "\n"
+	assignment := varList + " := " + expression + "\n"
 	r.Edits[r.Filename].Add(&text.Extent{r.getOffset(insertBefore), 0}, assignment)
 }
 
@@ -845,6 +1051,12 @@ const extractLocalDoc = `
     <li>Enter a name for the new variable that will be created.</li>
   </ol>
 
+  <p>If the selected expression is a function call returning several values
+  (e.g., <tt>f()</tt> in <tt>x, y := f()</tt>), one variable is introduced for
+  each value.  Enter either one name for each variable, separated by commas or
+  spaces (e.g., <tt>quot, rem</tt>), or a single name, which will be numbered
+  (e.g., <tt>v</tt> introduces <tt>v1, v2</tt>).</p>
+
   <p>An error or warning will be reported if the selected expression cannot be
   extracted into a variable assignment.  For example, this could occur if the
   extracted expression is in a loop condition but its value may change on each
@@ -0,0 +1,602 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Extract Loop refactoring, which extracts the body of
+// a for or range loop into a function that the loop calls, or (in Go 1.23
+// and later) extracts the loop's header into an iterator function, so that
+// the loop ranges over that iterator.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// iteratorGoVersion is the minor version of the first Go release that
+// supports ranging over functions (e.g., iter.Seq).
+const iteratorGoVersion = 23
+
+// An ExtractLoop refactoring extracts the body of the selected loop.  By
+// default, the body is extracted into a new function (using Extract
+// Function), and continue statements that target the loop become return
+// statements in that function.  Alternatively, the loop's header (which
+// produces the values the body consumes) can be extracted into a new
+// function that returns an iterator (iter.Seq or iter.Seq2), and the loop
+// is rewritten to range over the result of calling that function.
+type ExtractLoop struct {
+	ExtractFunc
+	iterator bool // Extract an iterator, rather than the loop body
+	// The selected loop (an *ast.ForStmt or *ast.RangeStmt), and the
+	// top-level declaration enclosing it
+	selectedLoop ast.Stmt
+	enclosing    ast.Decl
+}
+
+func (r *ExtractLoop) Description() *Description {
+	return &Description{
+		Name:      "Extract Loop",
+		Synopsis:  "Extracts a loop body to a function, or a loop header to an iterator",
+		Usage:     "<new_name> [<iterator>]",
+		HTMLDoc:   extractLoopDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Name:",
+			Prompt:       "Enter a name for the new function.",
+			DefaultValue: "",
+		}},
+		OptionalParams: []Parameter{{
+			Label:        "Extract Iterator:",
+			Prompt:       "Extract the loop header into a function returning an iterator (requires Go 1.23), rather than extracting the loop body.",
+			DefaultValue: false,
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *ExtractLoop) Run(config *Config) *Result {
+	if r.Init(config, r.Description()); r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.iterator = false
+	if len(config.Args) > 1 {
+		r.iterator = config.Args[1].(bool)
+	}
+	if !r.findLoop() {
+		return &r.Result
+	}
+
+	if r.iterator {
+		r.funcName = config.Args[0].(string)
+		if !r.checkIteratorName() {
+			return &r.Result
+		}
+		r.addIteratorEdits(config)
+		r.UpdateLog(config, true)
+		return &r.Result
+	}
+
+	body := loopBody(r.selectedLoop)
+	if len(body.List) == 0 {
+		r.Log.Error("The loop body is empty, so there is nothing to extract.")
+		r.Log.AssociateNode(r.selectedLoop)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return &r.Result
+	}
+	r.SelectionStart = body.List[0].Pos()
+	r.SelectionEnd = body.List[len(body.List)-1].End()
+	r.loop = r.selectedLoop
+
+	// Extract Function's optional arguments do not apply
+	bodyConfig := *config
+	bodyConfig.Args = config.Args[:1]
+	return r.extract(&bodyConfig)
+}
+
+// findLoop sets r.selectedLoop to the innermost for or range loop enclosing
+// the selection (within the enclosing function), r.loopLabel to its label (if
+// any), and r.enclosing to the top-level declaration containing it.  If there
+// is no such loop, it logs an error and returns false.
+func (r *ExtractLoop) findLoop() bool {
+	r.selectedLoop, r.loopLabel, r.enclosing = nil, nil, nil
+	path := r.PathEnclosingSelection
+	if len(path) >= 2 {
+		r.enclosing, _ = path[len(path)-2].(ast.Decl)
+	}
+	info := r.SelectedNodePkg.TypesInfo
+search:
+	for i, n := range path {
+		switch n := n.(type) {
+		case *ast.LabeledStmt:
+			switch n.Stmt.(type) {
+			case *ast.ForStmt, *ast.RangeStmt:
+				r.selectedLoop, r.loopLabel = n.Stmt, info.Defs[n.Label]
+				break search
+			}
+		case *ast.ForStmt, *ast.RangeStmt:
+			r.selectedLoop = n.(ast.Stmt)
+			if i+1 < len(path) {
+				if labeled, ok := path[i+1].(*ast.LabeledStmt); ok {
+					r.loopLabel = info.Defs[labeled.Label]
+				}
+			}
+			break search
+		case *ast.FuncLit, *ast.FuncDecl:
+			break search
+		}
+	}
+	if r.selectedLoop == nil || r.enclosing == nil {
+		r.Log.Error("Please select a for loop or a range loop.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	return true
+}
+
+// loopBody returns the body of the given *ast.ForStmt or *ast.RangeStmt.
+func loopBody(loop ast.Stmt) *ast.BlockStmt {
+	if rng, ok := loop.(*ast.RangeStmt); ok {
+		return rng.Body
+	}
+	return loop.(*ast.ForStmt).Body
+}
+
+/* -=-=- Extracting the Loop Body -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// branchesOutOfRange returns the branch statements in the selected
+// statements that transfer control outside them (see BranchesOutOfRange),
+// except for continue statements that will become return statements in the
+// extracted function (see loopContinues).
+func (r *ExtractFunc) branchesOutOfRange() []*ast.BranchStmt {
+	continues := r.loopContinues()
+	result := []*ast.BranchStmt{}
+	for _, branch := range r.stmtRange.BranchesOutOfRange() {
+		if !continues[branch] {
+			result = append(result, branch)
+		}
+	}
+	return result
+}
+
+// loopContinues returns the continue statements in the selected statements
+// that continue r.loop, whose body is being extracted.  In the extracted
+// function, returning has the same effect as continuing the loop.
+func (r *ExtractFunc) loopContinues() map[*ast.BranchStmt]bool {
+	result := map[*ast.BranchStmt]bool{}
+	if r.loop == nil {
+		return result
+	}
+	info := r.SelectedNodePkg.TypesInfo
+	for _, branch := range r.stmtRange.BranchesOutOfRange() {
+		if branch.Tok != token.CONTINUE {
+			continue
+		}
+		// An unlabeled continue outside any loop in the body continues
+		// the loop whose body it is
+		if branch.Label == nil ||
+			(r.loopLabel != nil && info.Uses[branch.Label] == r.loopLabel) {
+			result[branch] = true
+		}
+	}
+	return result
+}
+
+// replaceLoopContinues returns the given code, which is the text of the
+// selected statements, with each continue statement that continues r.loop
+// (see loopContinues) replaced by a return statement that returns the given
+// variables (the results of the extracted function).
+func (r *ExtractFunc) replaceLoopContinues(code []byte, returns []*types.Var) []byte {
+	continues := r.loopContinues()
+	names := []string{}
+	for _, v := range returns {
+		names = append(names, v.Name())
+	}
+	replacement := strings.TrimSpace("return " + commaSeparated(names))
+	start, _ := r.movedExtent()
+
+	var buf bytes.Buffer
+	offset := 0
+	r.stmtRange.Inspect(func(n ast.Node) bool {
+		if branch, ok := n.(*ast.BranchStmt); ok && continues[branch] {
+			buf.Write(code[offset : r.OffsetOfPos(branch.Pos())-start])
+			buf.WriteString(replacement)
+			offset = r.OffsetOfPos(branch.End()) - start
+		}
+		return true
+	})
+	buf.Write(code[offset:])
+	return buf.Bytes()
+}
+
+// removeLoopLabel adds an edit that removes the label on r.loop if every
+// reference to the label is a continue statement that will become a return
+// statement (see loopContinues), since a label that is not used is an error.
+func (r *ExtractFunc) removeLoopLabel() {
+	if r.loop == nil || r.loopLabel == nil {
+		return
+	}
+	replaced := map[*ast.Ident]bool{}
+	for branch := range r.loopContinues() {
+		if branch.Label != nil {
+			replaced[branch.Label] = true
+		}
+	}
+	if len(replaced) == 0 {
+		return
+	}
+	for id, obj := range r.SelectedNodePkg.TypesInfo.Uses {
+		if obj == r.loopLabel && !replaced[id] {
+			return
+		}
+	}
+	start := r.OffsetOfPos(r.loopLabel.Pos())
+	end := r.OffsetOfPos(r.loop.Pos())
+	r.Edits[r.Filename].Add(&text.Extent{start, end - start}, "")
+}
+
+/* -=-=- Extracting an Iterator -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// checkIteratorName logs an error and returns false if r.funcName is not a
+// valid name for a new package-level function.
+func (r *ExtractLoop) checkIteratorName() bool {
+	if !isIdentifierValid(r.funcName) {
+		r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
+			r.funcName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return false
+	}
+	if obj := packageLevelConflict(r.SelectedNodePkg, r.File, r.funcName); obj != nil {
+		r.Log.Errorf("The name \"%s\" is already declared in package %s",
+			r.funcName, r.SelectedNodePkg.Types.Name())
+		r.Log.AssociateCode(CodeRenameConflict)
+		r.Log.AddRelated("Conflicting declaration", obj.Pos(), obj.Pos())
+		return false
+	}
+	return true
+}
+
+// addIteratorEdits adds edits that insert a function returning an iterator
+// over the values produced by the header of the selected loop, and that
+// rewrite the loop to range over the result of calling that function.  If
+// the loop cannot be converted, it logs an error instead.
+func (r *ExtractLoop) addIteratorEdits(config *Config) {
+	dir := ""
+	if !config.ModulesOff {
+		dir = filepath.Dir(r.Filename)
+	}
+	if ok, version := goVersionAtLeast(dir, iteratorGoVersion); !ok {
+		r.Log.Errorf("Ranging over an iterator requires Go 1.%d or "+
+			"later, but this code uses Go %s.",
+			iteratorGoVersion, version)
+		r.Log.AssociateNode(r.selectedLoop)
+		r.Log.AssociateCode(CodeGoVersion)
+		return
+	}
+
+	yielded, tok, header, ok := r.iteratorHeader()
+	if !ok {
+		return
+	}
+	if len(yielded) > 2 {
+		r.Log.Error("An iterator can produce at most two values per " +
+			"iteration, but this loop declares more than two variables.")
+		r.Log.AssociateNode(r.selectedLoop)
+		r.Log.AssociateCode(CodeExtractIterator)
+		return
+	}
+	params := r.iteratorParams()
+	for _, v := range append(r.objects(yielded), params...) {
+		if v.Name() == "yield" {
+			r.Log.Error("The loop cannot be converted since it refers " +
+				"to a variable named yield, which the iterator " +
+				"uses as a parameter name.")
+			r.Log.AssociatePos(v.Pos(), v.Pos())
+			r.Log.AssociateCode(CodeExtractIterator)
+			return
+		}
+	}
+	if !r.checkIteratorBody(yielded, params) {
+		return
+	}
+
+	qualifier := newTypeQualifier(r.SelectedNodePkg.Types, r.File)
+	yieldNames, yieldTypes := []string{}, []string{}
+	for _, id := range yielded {
+		yieldNames = append(yieldNames, id.Name)
+		yieldTypes = append(yieldTypes,
+			qualifier.TypeString(r.SelectedNodePkg.TypesInfo.TypeOf(id)))
+	}
+	paramNames, paramTypes := namesAndTypes(params, qualifier.qualify)
+
+	// There is no iter.Seq0, so an iterator yielding no values is declared
+	// using the underlying function type
+	resultType := "func(yield func() bool)"
+	if len(yielded) > 0 {
+		iterPkg := qualifier.qualify(types.NewPackage("iter", "iter"))
+		resultType = fmt.Sprintf("%s.Seq[%s]", iterPkg, yieldTypes[0])
+		if len(yielded) == 2 {
+			resultType = fmt.Sprintf("%s.Seq2[%s]", iterPkg,
+				commaSeparated(yieldTypes))
+		}
+	}
+
+	funcDecl := fmt.Sprintf("\n\nfunc %s(%s) %s {\n"+
+		"return func(yield func(%s) bool) {\n"+
+		"%s {\n"+
+		"if !yield(%s) {\n"+
+		"return\n"+
+		"}\n"+
+		"}\n"+
+		"}\n"+
+		"}\n",
+		r.funcName, createParamDecls(paramNames, paramTypes), resultType,
+		commaSeparated(yieldTypes), header, commaSeparated(yieldNames))
+
+	newHeader := "for range "
+	if len(yielded) > 0 {
+		newHeader = fmt.Sprintf("for %s %s range ",
+			commaSeparated(yieldNames), tok)
+	}
+	newHeader += fmt.Sprintf("%s(%s) ", r.funcName,
+		commaSeparated(paramNames))
+
+	start := r.OffsetOfPos(r.selectedLoop.Pos())
+	end := r.OffsetOfPos(loopBody(r.selectedLoop).Lbrace)
+	r.Edits[r.Filename].Add(&text.Extent{start, end - start}, newHeader)
+	next := r.OffsetOfPos(r.enclosing.End())
+	r.Edits[r.Filename].Add(&text.Extent{next, 0}, funcDecl)
+	r.addImports(qualifier)
+}
+
+// iteratorHeader returns the variables the selected loop declares (or, for
+// a range loop, assigns) in each iteration, which the iterator will yield;
+// the token (:= or =) with which the rewritten loop should assign them; and
+// the header of the loop that the iterator will contain.  If the loop cannot
+// be converted, it logs an error and returns false.
+func (r *ExtractLoop) iteratorHeader() (yielded []*ast.Ident, tok token.Token, header string, ok bool) {
+	info := r.SelectedNodePkg.TypesInfo
+	switch loop := r.selectedLoop.(type) {
+	case *ast.RangeStmt:
+		if _, isFunc := info.TypeOf(loop.X).Underlying().(*types.Signature); isFunc {
+			r.Log.Error("This loop already ranges over an iterator.")
+			r.Log.AssociateNode(loop.X)
+			r.Log.AssociateCode(CodeExtractIterator)
+			return nil, token.ILLEGAL, "", false
+		}
+		vars := []string{}
+		for _, e := range []ast.Expr{loop.Key, loop.Value} {
+			if e == nil {
+				continue
+			}
+			id, isIdent := e.(*ast.Ident)
+			if !isIdent {
+				r.Log.Error("The loop cannot be converted since it " +
+					"assigns to an expression that is not a " +
+					"variable.")
+				r.Log.AssociateNode(e)
+				r.Log.AssociateCode(CodeExtractIterator)
+				return nil, token.ILLEGAL, "", false
+			}
+			vars = append(vars, id.Name)
+			if id.Name != "_" {
+				yielded = append(yielded, id)
+			}
+		}
+		if len(yielded) == 0 {
+			vars = nil
+		} else if vars[len(vars)-1] == "_" {
+			vars = vars[:len(vars)-1]
+		}
+		header = "for range "
+		if len(vars) > 0 {
+			header = "for " + commaSeparated(vars) + " := range "
+		}
+		header += string(r.FileContents[r.OffsetOfPos(loop.X.Pos()):r.OffsetOfPos(loop.X.End())])
+		return yielded, loop.Tok, header, true
+
+	case *ast.ForStmt:
+		if loop.Init != nil {
+			init, isAssign := loop.Init.(*ast.AssignStmt)
+			if !isAssign || init.Tok != token.DEFINE {
+				r.Log.Error("The loop cannot be converted since its " +
+					"init statement does not declare its loop " +
+					"variables (e.g., i := 0).")
+				r.Log.AssociateNode(loop.Init)
+				r.Log.AssociateCode(CodeExtractIterator)
+				return nil, token.ILLEGAL, "", false
+			}
+			for _, e := range init.Lhs {
+				if id, isIdent := e.(*ast.Ident); isIdent && id.Name != "_" {
+					yielded = append(yielded, id)
+				}
+			}
+		}
+		start := r.OffsetOfPos(loop.For)
+		end := r.OffsetOfPos(loop.Body.Lbrace)
+		header = strings.TrimSpace(string(r.FileContents[start:end]))
+		return yielded, token.DEFINE, header, true
+	}
+	return nil, token.ILLEGAL, "", false
+}
+
+// objects returns the variables declared by the given identifiers.
+func (r *ExtractLoop) objects(ids []*ast.Ident) []*types.Var {
+	result := []*types.Var{}
+	for _, id := range ids {
+		if v, ok := r.SelectedNodePkg.TypesInfo.ObjectOf(id).(*types.Var); ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// iteratorParams returns the local variables that the header of the selected
+// loop refers to (other than those it declares), in order of first use.
+// These become parameters of the iterator function.
+func (r *ExtractLoop) iteratorParams() []*types.Var {
+	info := r.SelectedNodePkg.TypesInfo
+	body := loopBody(r.selectedLoop)
+	result := []*types.Var{}
+	seen := map[*types.Var]bool{}
+	ast.Inspect(r.selectedLoop, func(n ast.Node) bool {
+		if n == body {
+			return false
+		}
+		if id, ok := n.(*ast.Ident); ok {
+			v, ok := info.Uses[id].(*types.Var)
+			if ok && !seen[v] && !v.IsField() && v.Pkg() != nil &&
+				v.Parent() != v.Pkg().Scope() &&
+				!(r.selectedLoop.Pos() <= v.Pos() && v.Pos() < r.selectedLoop.End()) {
+				seen[v] = true
+				result = append(result, v)
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// checkIteratorBody logs an error and returns false if the body of a
+// three-clause for loop assigns to its loop variables or to a variable used
+// in its condition or post statement.  The iterator evaluates these using its
+// own copies of the variables, so such assignments would not affect the
+// iteration, as they do in the original loop.
+func (r *ExtractLoop) checkIteratorBody(yielded []*ast.Ident, params []*types.Var) bool {
+	if _, ok := r.selectedLoop.(*ast.ForStmt); !ok {
+		return true
+	}
+	vars := map[types.Object]bool{}
+	for _, v := range append(r.objects(yielded), params...) {
+		vars[v] = true
+	}
+	info := r.SelectedNodePkg.TypesInfo
+	result := true
+	check := func(e ast.Expr) {
+		id, ok := unparen(e).(*ast.Ident)
+		if ok && vars[info.Uses[id]] {
+			r.Log.Errorf("The loop cannot be converted since its body "+
+				"modifies %s, which the loop header uses.", id.Name)
+			r.Log.AssociateNode(id)
+			r.Log.AssociateCode(CodeExtractIterator)
+			result = false
+		}
+	}
+	ast.Inspect(loopBody(r.selectedLoop), func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				check(lhs)
+			}
+		case *ast.IncDecStmt:
+			check(n.X)
+		case *ast.RangeStmt:
+			if n.Tok == token.ASSIGN {
+				if n.Key != nil {
+					check(n.Key)
+				}
+				if n.Value != nil {
+					check(n.Value)
+				}
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				check(n.X)
+			}
+		}
+		return true
+	})
+	return result
+}
+
+const extractLoopDoc = `
+  <h4>Purpose</h4>
+  <p>The Extract Loop refactoring extracts the body of a <tt>for</tt> loop
+  into a new function, which the loop calls on each iteration.
+  Alternatively, in Go 1.23 and later, it can extract the loop's header into
+  a new function that returns an iterator (<tt>iter.Seq</tt> or
+  <tt>iter.Seq2</tt>), so that the loop ranges over that iterator.  This
+  separates the code that produces a sequence of values from the code that
+  consumes it.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a <tt>for</tt> loop or a <tt>range</tt> loop (or any part of
+    its header).</li>
+    <li>Activate the Extract Loop refactoring.</li>
+    <li>Enter a name for the new function.</li>
+    <li>Optionally, choose to extract an iterator rather than the loop
+    body.</li>
+  </ol>
+
+  <p>When the loop body is extracted, it is extracted as the Extract Function
+  refactoring would extract it, except that <tt>continue</tt> statements
+  that continue the loop become <tt>return</tt> statements in the new
+  function.  A <tt>break</tt> statement that exits the loop cannot be
+  extracted.</p>
+
+  <h4>Example</h4>
+  <p>In this example, the header of the loop is extracted into an iterator
+  named <tt>evens</tt>, which yields the values the loop body uses.  The
+  local variables the header refers to (here, <tt>n</tt>) become parameters
+  of the new function.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+  <pre>func main() {
+    n := 10
+    <span class="highlight">for i := 0; i < n; i += 2 {</span>
+        fmt.Println(i)
+    }
+}
+</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+  <pre>func main() {
+    n := 10
+    <span class="highlight">for i := range evens(n) {</span>
+        fmt.Println(i)
+    }
+}
+
+<span class="highlight">func evens(n int) iter.Seq[int] {
+    return func(yield func(int) bool) {
+        for i := 0; i < n; i += 2 {
+            if !yield(i) {
+                return
+            }
+        }
+    }
+}</span>
+</pre>
+      </td>
+    </tr>
+  </table>
+
+  <p>An iterator cannot be extracted if:</p>
+  <ul>
+    <li>The module's <tt>go.mod</tt> file specifies a Go version earlier
+    than 1.23.</li>
+    <li>The loop already ranges over a function, or it assigns to an
+    expression other than a variable.</li>
+    <li>The init statement of a three-clause <tt>for</tt> loop does not
+    declare its loop variables, or it declares more than two.</li>
+    <li>The body of a three-clause <tt>for</tt> loop modifies its loop
+    variables or a variable used in its condition or post statement, since
+    the iterator evaluates these independently of the body.</li>
+  </ul>
+`
@@ -0,0 +1,224 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains the parts of the Extract Function refactoring that make
+// the extracted function a method on the type of one of its parameters.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/ast"
+	"go/types"
+
+	"github.com/godoctor/godoctor/internal/varset"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// receiverCandidates returns the local variables that would be passed as
+// arguments to the extracted function if it were not a method: those that are
+// live at the entry to the selected statements and referenced in them.
+func (r *ExtractFunc) receiverCandidates() []*types.Var {
+	aliveFirst := r.stmtRange.LocalsLiveAtEntry()
+	assigned, updated, _, used := r.stmtRange.LocalsReferenced()
+	return varset.Intersection(aliveFirst, varset.Union(varset.Union(used, assigned), updated))
+}
+
+// receiverBase returns the named type T if the given variable has type T or
+// *T, where T is declared at the package level of the current package and is
+// not an interface or pointer type (i.e., methods can be declared on T).  It
+// returns nil otherwise.
+func (r *ExtractFunc) receiverBase(v *types.Var) *types.Named {
+	typ := v.Type()
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return nil
+	}
+	pkg := r.SelectedNodePkg.Types
+	if named.Obj().Pkg() != pkg || named.Obj().Parent() != pkg.Scope() {
+		return nil
+	}
+	switch named.Underlying().(type) {
+	case *types.Interface, *types.Pointer:
+		return nil
+	}
+	return named
+}
+
+// receiverUses returns the identifiers in the selected statements that refer
+// to the given variable, along with their paths (from PathEnclosingInterval).
+func (r *ExtractFunc) receiverUses(v *types.Var) map[*ast.Ident][]ast.Node {
+	result := map[*ast.Ident][]ast.Node{}
+	info := r.SelectedNodePkg.TypesInfo
+	r.stmtRange.Inspect(func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && info.Uses[id] == v {
+			result[id], _ = astutil.PathEnclosingInterval(r.File,
+				id.Pos(), id.End())
+		}
+		return true
+	})
+	return result
+}
+
+// checkReceiver finds the parameter named r.recvName, which will become the
+// receiver of the extracted method, and determines whether the receiver
+// should be a pointer.  It logs an error and returns false if the
+// parameter does not exist or the method cannot be declared on its type.
+//
+// If the parameter has type *T, the receiver has type *T.  If it has type T,
+// the receiver has type T unless the selected statements may modify it (e.g.,
+// by assigning to one of its fields); then, the receiver has type *T, so that
+// the modifications are visible to the caller.  This requires every use of
+// the parameter to select a field or method, since other uses (e.g., passing
+// it as an argument) would need to dereference the receiver.
+func (r *ExtractFunc) checkReceiver() bool {
+	r.recv, r.recvPtr = nil, false
+	var v *types.Var
+	for _, candidate := range r.receiverCandidates() {
+		if candidate.Name() == r.recvName {
+			v = candidate
+			break
+		}
+	}
+	if v == nil {
+		r.Log.Errorf("%s cannot be the receiver of the extracted method, "+
+			"since it is not a local variable that is declared before "+
+			"the selected statements and used in them.", r.recvName)
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidArgs)
+		return false
+	}
+
+	named := r.receiverBase(v)
+	if named == nil {
+		r.Log.Errorf("%s cannot be the receiver of the extracted method, "+
+			"since methods cannot be declared on its type (%s).  The "+
+			"type must be a named non-interface type declared in "+
+			"this package, or a pointer to one.", v.Name(),
+			types.TypeString(v.Type(), types.RelativeTo(r.SelectedNodePkg.Types)))
+		r.Log.AssociatePos(v.Pos(), v.Pos())
+		return false
+	}
+	if obj, _, _ := types.LookupFieldOrMethod(named, true, named.Obj().Pkg(), r.funcName); obj != nil {
+		r.Log.Errorf("%s already has a field or method named %s.",
+			named.Obj().Name(), r.funcName)
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		r.Log.AssociateCode(CodeInvalidName)
+		return false
+	}
+
+	assigned, _, _, _ := r.stmtRange.LocalsReferenced()
+	if varset.Contains(assigned, v) {
+		r.Log.Errorf("%s cannot be the receiver of the extracted method, "+
+			"since it is assigned a new value in the selected "+
+			"statements.", v.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+
+	if _, isPtr := v.Type().(*types.Pointer); isPtr {
+		r.recv = v
+		return true
+	}
+	uses := r.receiverUses(v)
+	info := r.SelectedNodePkg.TypesInfo
+	for _, path := range uses {
+		if isModifiedAt(info, path) {
+			r.recvPtr = true
+			break
+		}
+	}
+	if r.recvPtr {
+		for id, path := range uses {
+			if sel, ok := path[1].(*ast.SelectorExpr); !ok || sel.X != id {
+				r.Log.Errorf("%s is modified in the selected "+
+					"statements, so the receiver of the "+
+					"extracted method must be a pointer, but "+
+					"here its value is used.", v.Name())
+				r.Log.AssociateNode(id)
+				return false
+			}
+		}
+	}
+	r.recv = v
+	return true
+}
+
+// suggestReceiver logs an informational message if most of the references to
+// the parameters of the extracted function are references to a single
+// parameter whose type could have a method, since the extracted code might be
+// better as a method on that type (see checkReceiver).
+func (r *ExtractFunc) suggestReceiver() {
+	total := 0
+	var best *types.Var
+	bestCount := 0
+	for _, v := range r.receiverCandidates() {
+		count := len(r.receiverUses(v))
+		total += count
+		if count > bestCount {
+			best, bestCount = v, count
+		}
+	}
+	if best == nil || bestCount*2 <= total {
+		return
+	}
+	named := r.receiverBase(best)
+	if named == nil {
+		return
+	}
+	if obj, _, _ := types.LookupFieldOrMethod(named, true, named.Obj().Pkg(), r.funcName); obj != nil {
+		return
+	}
+	r.Log.Infof("The selected statements mostly use %s, so they could "+
+		"be extracted to a method on %s instead; to do so, specify %s "+
+		"as the receiver.", best.Name(), named.Obj().Name(), best.Name())
+}
+
+// receiverRename returns the name that the receiver of the extracted method
+// should be given so that it is consistent with the receivers of the type's
+// other methods (see existingReceiverName), or "" if the receiver should keep
+// the name of the variable that becomes the receiver: because the type has no
+// methods with named receivers, the variable already has the conventional
+// name, or that name is already used in the selected statements.
+func (r *ExtractFunc) receiverRename() string {
+	name := existingReceiverName(r.receiverBase(r.recv))
+	if name == "" || name == r.recv.Name() {
+		return ""
+	}
+	conflict := false
+	r.stmtRange.Inspect(func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == name {
+			conflict = true
+		}
+		return !conflict
+	})
+	if conflict {
+		return ""
+	}
+	return name
+}
+
+// renameReceiverInCode returns the given code, which is the text of the
+// selected statements, with each reference to the receiver variable replaced
+// by the given name.
+func (r *ExtractFunc) renameReceiverInCode(code []byte, name string) []byte {
+	info := r.SelectedNodePkg.TypesInfo
+	start, _ := r.movedExtent()
+
+	var buf bytes.Buffer
+	offset := 0
+	r.stmtRange.Inspect(func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && info.Uses[id] == r.recv {
+			buf.Write(code[offset : r.OffsetOfPos(id.Pos())-start])
+			buf.WriteString(name)
+			offset = r.OffsetOfPos(id.End()) - start
+		}
+		return true
+	})
+	buf.Write(code[offset:])
+	return buf.Bytes()
+}
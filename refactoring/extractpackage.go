@@ -0,0 +1,1016 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Extract Package refactoring, which moves a set of
+// package-level declarations into a new package, updating references to them
+// throughout the refactoring scope.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/godoctor/godoctor/analysis/names"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/packages"
+)
+
+// An ExtractPackage refactoring moves the selected package-level declarations
+// (along with the methods of any types among them) into a new package.  Moved
+// names that are referenced outside the moved declarations are exported, and
+// those references are qualified with the name of the new package, which is
+// imported where necessary.
+type ExtractPackage struct {
+	RefactoringBase
+	files *sourceFiles
+	// Import path, name, and directory of the new package
+	pkgPath, pkgName, dir string
+	// A placeholder for the new package, used to qualify references
+	newPkg *types.Package
+	// The declarations to move, in the order they will appear in the new
+	// file
+	decls []*movedDecl
+	// The moved package-level objects (including methods), keyed by the
+	// positions of their declarations (see posKey)
+	moved map[string]types.Object
+	// The new names of moved objects that must be exported, keyed by the
+	// positions of their declarations
+	exported map[string]string
+	// References to moved objects outside the moved declarations
+	refs []*movedRef
+	// The names qualifying references to moved objects (the name of the
+	// new package or an alias for it), keyed by filename
+	qualifiers map[string]string
+}
+
+// A movedRef is a reference to a moved object outside the moved declarations,
+// which must be qualified with the name of the new package.
+type movedRef struct {
+	pkg      *packages.Package
+	filename string
+	file     *ast.File
+	id       *ast.Ident
+	// The qualified identifier (pkg.Name) containing id, or nil if the
+	// reference is not qualified
+	sel *ast.SelectorExpr
+}
+
+func (r *ExtractPackage) Description() *Description {
+	return &Description{
+		Name:      "Extract Package",
+		Synopsis:  "Moves declarations into a new package",
+		Usage:     "<import_path> [<declarations>]",
+		HTMLDoc:   extractPackageDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Package Path:",
+			Prompt:       "Import path of the new package.",
+			DefaultValue: "",
+		}},
+		OptionalParams: []Parameter{{
+			Label:        "Declarations:",
+			Prompt:       "Names of other declarations to move (comma-separated).",
+			DefaultValue: "",
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *ExtractPackage) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+
+	r.pkgPath, r.pkgName, r.dir, r.newPkg = "", "", "", nil
+	r.decls, r.refs = nil, nil
+	r.moved, r.exported = map[string]types.Object{}, map[string]string{}
+	r.qualifiers = map[string]string{}
+
+	if filesystem.IsFakeStdinPath(r.Filename) {
+		r.Log.Error("A new package cannot be created when the source " +
+			"code is given on standard input.")
+		return &r.Result
+	}
+	if strings.HasSuffix(r.Filename, "_test.go") {
+		r.Log.Error("Declarations in test files cannot be moved to a " +
+			"new package.")
+		return &r.Result
+	}
+
+	if !r.newPackage(strings.TrimSpace(config.Args[0].(string))) {
+		return &r.Result
+	}
+	names := ""
+	if len(config.Args) > 1 {
+		names = config.Args[1].(string)
+	}
+	if !r.findDecls(names) || !r.checkMovedDecls() ||
+		!r.findRefs() || !r.exportNames() {
+		return &r.Result
+	}
+	r.chooseQualifiers()
+
+	contents, err := r.newFileContents(r.files, r.pkgName, r.decls,
+		importsUsedBy(r.SelectedNodePkg.TypesInfo, r.decls),
+		config.LicenseHeader)
+	if err != nil {
+		r.Log.Errorf("Unable to create package %s: %v", r.pkgPath, err)
+		return &r.Result
+	}
+	r.updateFiles()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.FSChanges = append(r.FSChanges, r.newDirectories()...)
+	r.FSChanges = append(r.FSChanges, &filesystem.CreateFile{
+		Path:     filepath.Join(r.dir, r.pkgName+".go"),
+		Contents: contents,
+	})
+	r.UpdateLog(config, false)
+	return &r.Result
+}
+
+// newPackage checks that a new package with the given import path can be
+// created, and determines its name and directory.  It logs an error and
+// returns false if the package cannot be created.
+func (r *ExtractPackage) newPackage(pkgPath string) bool {
+	origin := r.SelectedNodePkg
+	r.pkgPath = strings.Trim(pkgPath, "/")
+	r.pkgName = path.Base(r.pkgPath)
+	if r.pkgPath == "" || !isIdentifierValid(r.pkgName) ||
+		token.Lookup(r.pkgName).IsKeyword() || r.pkgName == "main" {
+		r.Log.Errorf("The last element of the import path \"%s\" must "+
+			"be a valid package name.", pkgPath)
+		r.Log.AssociateCode(CodeInvalidName)
+		return false
+	}
+	if r.pkgPath == origin.PkgPath {
+		r.Log.Errorf("The declarations are already in %s.", r.pkgPath)
+		return false
+	}
+	for _, pkg := range r.Program.AllPackages {
+		if pkg.PkgPath == r.pkgPath {
+			r.Log.Errorf("The package %s already exists.", r.pkgPath)
+			return false
+		}
+	}
+
+	// The new package is placed relative to the module (or GOPATH
+	// directory) containing the current package
+	dir := filepath.Dir(r.Filename)
+	if m := origin.Module; m != nil && m.Dir != "" {
+		if !strings.HasPrefix(r.pkgPath, m.Path+"/") {
+			r.Log.Errorf("The new package must be in the module %s "+
+				"(e.g., %s/%s).", m.Path, m.Path, r.pkgName)
+			return false
+		}
+		r.dir = filepath.Join(m.Dir, filepath.FromSlash(
+			strings.TrimPrefix(r.pkgPath, m.Path+"/")))
+	} else if suffix := string(filepath.Separator) +
+		filepath.FromSlash(origin.PkgPath); strings.HasSuffix(dir, suffix) {
+		r.dir = filepath.Join(strings.TrimSuffix(dir, suffix),
+			filepath.FromSlash(r.pkgPath))
+	} else {
+		r.Log.Errorf("The directory for the package %s could not be "+
+			"determined.", r.pkgPath)
+		return false
+	}
+
+	if infos, err := r.files.fileSystem.ReadDir(r.dir); err == nil {
+		for _, info := range infos {
+			if !info.IsDir() && strings.HasSuffix(info.Name(), ".go") {
+				r.Log.Errorf("The directory %s already contains Go "+
+					"source files.", r.dir)
+				return false
+			}
+		}
+	}
+	r.newPkg = types.NewPackage(r.pkgPath, r.pkgName)
+	return true
+}
+
+// newDirectories returns the changes that create the directory of the new
+// package and any of its parent directories that do not exist.
+func (r *ExtractPackage) newDirectories() []filesystem.Change {
+	result := []filesystem.Change{}
+	for dir := r.dir; ; dir = filepath.Dir(dir) {
+		if _, err := r.files.fileSystem.ReadDir(dir); err == nil ||
+			dir == filepath.Dir(dir) {
+			break
+		}
+		result = append([]filesystem.Change{
+			&filesystem.CreateDirectory{Path: dir}}, result...)
+	}
+	return result
+}
+
+// findDecls finds the declarations to move: the package-level declarations
+// overlapping the selection, those named in the given (comma- or
+// space-separated) list, and the methods of the types among them.  It logs
+// an error and returns false if they cannot be moved.
+func (r *ExtractPackage) findDecls(names string) bool {
+	pkg := r.SelectedNodePkg
+	nodes := map[ast.Node]bool{}
+	decls := []*movedDecl{}
+	add := func(filename string, file *ast.File, node ast.Node, keyword string) {
+		if !nodes[node] {
+			nodes[node] = true
+			d := &movedDecl{
+				declText: &declText{filename: filename, file: file, node: node},
+				keyword:  keyword,
+			}
+			decls = append(decls, d)
+		}
+	}
+
+	for _, decl := range r.File.Decls {
+		if r.overlapsSelection(decl) {
+			r.addSelectedDecl(decl, add)
+		}
+	}
+	for _, name := range strings.FieldsFunc(names, func(ch rune) bool {
+		return ch == ',' || ch == ' ' || ch == '\t'
+	}) {
+		obj := pkg.Types.Scope().Lookup(name)
+		if obj == nil {
+			r.Log.Errorf("%s is not declared in package %s.", name,
+				pkg.Types.Name())
+			return false
+		}
+		filename, file, decl := r.declOf(obj)
+		if decl == nil {
+			r.Log.Errorf("%s is not declared in a non-test file of "+
+				"package %s.", name, pkg.Types.Name())
+			return false
+		}
+		if spec, ok := decl.(ast.Spec); ok {
+			add(filename, file, spec,
+				r.genDeclOf(file, spec).Tok.String()+" ")
+		} else {
+			add(filename, file, decl, "")
+		}
+	}
+	if len(decls) == 0 {
+		r.Log.Error("Please select one or more package-level " +
+			"declarations, or list them by name.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+
+	// A spec is not moved separately if its entire declaration is moved
+	result := []*movedDecl{}
+	for _, d := range decls {
+		if spec, ok := d.node.(ast.Spec); ok && nodes[r.genDeclOf(d.file, spec)] {
+			continue
+		}
+		result = append(result, d)
+	}
+	for _, d := range result {
+		r.addMovedObjects(d.node)
+	}
+
+	// Methods are moved along with their receiver types; other methods
+	// cannot be moved
+	for _, file := range pkg.Syntax {
+		filename := r.Program.Fset.Position(file.Pos()).Filename
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Recv == nil {
+				continue
+			}
+			recv := r.movedReceiver(funcDecl)
+			switch {
+			case recv && strings.HasSuffix(filename, "_test.go"):
+				r.Log.Errorf("The method %s cannot be moved, since it "+
+					"is declared in a test file.", funcDecl.Name.Name)
+				r.Log.AssociateNode(funcDecl.Name)
+				return false
+			case recv && !nodes[funcDecl]:
+				nodes[funcDecl] = true
+				result = append(result, &movedDecl{declText: &declText{
+					filename: filename, file: file, node: funcDecl}})
+				r.addMovedObjects(funcDecl)
+			case !recv && nodes[funcDecl]:
+				r.Log.Errorf("The method %s can only be moved along "+
+					"with its receiver type.", funcDecl.Name.Name)
+				r.Log.AssociateNode(funcDecl.Name)
+				return false
+			}
+		}
+	}
+
+	for _, d := range result {
+		if usesCgo(d.file) {
+			r.Log.Errorf("%s cannot be modified because it uses cgo "+
+				"(import \"C\")", filepath.Base(d.filename))
+			r.Log.AssociateNode(d.node)
+			return false
+		}
+		if _, err := r.files.read(d.filename); err != nil {
+			r.Log.Error(err)
+			return false
+		}
+	}
+	for _, d := range result {
+		d.declText = r.newDeclText(r.files, d.filename, d.file, d.node)
+	}
+	r.decls = result
+	return true
+}
+
+// overlapsSelection returns true if the given node overlaps the selection
+// (or, if the selection is empty, contains it).
+func (r *ExtractPackage) overlapsSelection(node ast.Node) bool {
+	if r.SelectionStart == r.SelectionEnd {
+		return node.Pos() <= r.SelectionStart && r.SelectionStart < node.End()
+	}
+	return node.Pos() < r.SelectionEnd && r.SelectionStart < node.End()
+}
+
+// addSelectedDecl calls add for the given package-level declaration in the
+// current file, or for the specs in it that overlap the selection if only
+// some of them do.  Imports are ignored.  A constant declaration is always
+// moved in its entirety, since its specs may depend on each other (e.g., via
+// iota).
+func (r *ExtractPackage) addSelectedDecl(decl ast.Decl, add func(string, *ast.File, ast.Node, string)) {
+	genDecl, ok := decl.(*ast.GenDecl)
+	if !ok {
+		add(r.Filename, r.File, decl, "")
+		return
+	}
+	if genDecl.Tok == token.IMPORT {
+		return
+	}
+	specs := []ast.Spec{}
+	for _, spec := range genDecl.Specs {
+		if r.overlapsSelection(spec) {
+			specs = append(specs, spec)
+		}
+	}
+	if len(specs) == 0 || len(specs) == len(genDecl.Specs) ||
+		genDecl.Tok == token.CONST {
+		add(r.Filename, r.File, genDecl, "")
+		return
+	}
+	for _, spec := range specs {
+		add(r.Filename, r.File, spec, genDecl.Tok.String()+" ")
+	}
+}
+
+// declOf returns the declaration of the given package-level object (or, if it
+// is declared by one spec in a grouped variable or type declaration, the
+// spec), along with the file containing it, or a nil declaration if it is
+// not declared in a non-test file of the current package.
+func (r *ExtractPackage) declOf(obj types.Object) (string, *ast.File, ast.Node) {
+	info := r.SelectedNodePkg.TypesInfo
+	for _, file := range r.SelectedNodePkg.Syntax {
+		filename := r.Program.Fset.Position(file.Pos()).Filename
+		if strings.HasSuffix(filename, "_test.go") ||
+			obj.Pos() < file.Pos() || obj.Pos() >= file.End() {
+			continue
+		}
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil && info.Defs[decl.Name] == obj {
+					return filename, file, decl
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if spec.Pos() <= obj.Pos() && obj.Pos() < spec.End() {
+						if len(decl.Specs) == 1 || decl.Tok == token.CONST {
+							return filename, file, decl
+						}
+						return filename, file, spec
+					}
+				}
+			}
+		}
+	}
+	return "", nil, nil
+}
+
+// genDeclOf returns the declaration in the given file containing the given
+// spec.
+func (r *ExtractPackage) genDeclOf(file *ast.File, spec ast.Spec) *ast.GenDecl {
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok &&
+			genDecl.Pos() <= spec.Pos() && spec.End() <= genDecl.End() {
+			return genDecl
+		}
+	}
+	return nil
+}
+
+// addMovedObjects records the package-level objects declared by the given
+// declaration or spec as moved.
+func (r *ExtractPackage) addMovedObjects(node ast.Node) {
+	info := r.SelectedNodePkg.TypesInfo
+	addIdent := func(id *ast.Ident) {
+		if obj := info.Defs[id]; obj != nil && id.Name != "_" {
+			r.moved[r.posKey(obj.Pos())] = obj
+		}
+	}
+	var addSpec func(ast.Spec)
+	addSpec = func(spec ast.Spec) {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			addIdent(spec.Name)
+		case *ast.ValueSpec:
+			for _, id := range spec.Names {
+				addIdent(id)
+			}
+		}
+	}
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		addIdent(node.Name)
+	case *ast.GenDecl:
+		for _, spec := range node.Specs {
+			addSpec(spec)
+		}
+	case ast.Spec:
+		addSpec(node)
+	}
+}
+
+// movedReceiver returns true if the given method's receiver type (or the type
+// it points to) is being moved.
+func (r *ExtractPackage) movedReceiver(funcDecl *ast.FuncDecl) bool {
+	fn, ok := r.SelectedNodePkg.TypesInfo.Defs[funcDecl.Name].(*types.Func)
+	if !ok {
+		return false
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return false
+	}
+	typ := recv.Type()
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, ok := typ.(*types.Named)
+	return ok && r.moved[r.posKey(named.Obj().Pos())] != nil
+}
+
+// posKey returns a string identifying the given position.  Objects are
+// identified by position, rather than by identity, since a package's files
+// may be loaded (and type checked) more than once, e.g., with and without its
+// tests.
+func (r *ExtractPackage) posKey(pos token.Pos) string {
+	p := r.Program.Fset.Position(pos)
+	return fmt.Sprintf("%s:%d", p.Filename, p.Offset)
+}
+
+// inMovedText returns true if the given position is in the text of a moved
+// declaration.
+func (r *ExtractPackage) inMovedText(pos token.Pos) bool {
+	p := r.Program.Fset.Position(pos)
+	for _, d := range r.decls {
+		if d.filename == p.Filename && d.start <= p.Offset && p.Offset < d.end {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMovedDecls checks that the moved declarations do not refer to
+// declarations that remain in the current package (which the new package
+// cannot import, since the current package will import it) and that they do
+// not import a package that imports the current package.  It logs an error
+// and returns false if they do.
+func (r *ExtractPackage) checkMovedDecls() bool {
+	origin := r.SelectedNodePkg.Types
+	info := r.SelectedNodePkg.TypesInfo
+	for _, d := range r.decls {
+		ok := true
+		ast.Inspect(d.node, func(n ast.Node) bool {
+			id, isIdent := n.(*ast.Ident)
+			if !ok || !isIdent {
+				return ok
+			}
+			obj := info.Uses[id]
+			if obj == nil || obj.Pkg() != origin || r.inMovedText(obj.Pos()) {
+				return true
+			}
+			if obj.Parent() == origin.Scope() {
+				r.Log.Errorf("The moved declarations refer to %s, "+
+					"which is not being moved.  It must be moved "+
+					"as well (add it to the list of declarations).",
+					obj.Name())
+				r.Log.AssociateNode(id)
+				ok = false
+			} else if !obj.Exported() && isMember(obj) {
+				r.Log.Errorf("The moved declarations refer to %s, "+
+					"which is declared in a type that is not being "+
+					"moved and would not be accessible from %s.",
+					obj.Name(), r.pkgPath)
+				r.Log.AssociateNode(id)
+				ok = false
+			}
+			return ok
+		})
+		if !ok {
+			return false
+		}
+	}
+
+	for _, imp := range importsUsedBy(info, r.decls) {
+		for _, pkg := range r.Program.AllPackages {
+			if pkg.PkgPath == imp.path &&
+				importsPackage(pkg, r.SelectedNodePkg.PkgPath, map[string]bool{}) {
+				r.Log.Errorf("The declarations cannot be moved to %s, "+
+					"since they use %s, which imports %s (directly or "+
+					"indirectly), so the packages would form an "+
+					"import cycle.", r.pkgPath, imp.path,
+					r.SelectedNodePkg.PkgPath)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isMember returns true if the given object is a field or method.
+func isMember(obj types.Object) bool {
+	switch obj := obj.(type) {
+	case *types.Var:
+		return obj.IsField()
+	case *types.Func:
+		return obj.Type().(*types.Signature).Recv() != nil
+	}
+	return false
+}
+
+// findRefs finds the references to moved objects outside the moved
+// declarations, in every package in the refactoring scope, recording them in
+// r.refs.  It logs an error and returns false if a reference cannot be
+// updated: a reference to an unexported field or method of a moved type, or
+// an unqualified reference via a dot import.
+func (r *ExtractPackage) findRefs() bool {
+	pkgs := []*packages.Package{r.SelectedNodePkg}
+	for _, pkg := range r.Program.AllPackages {
+		if pkg != r.SelectedNodePkg {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.SliceStable(pkgs[1:], func(i, j int) bool {
+		return pkgs[i+1].ID < pkgs[j+1].ID
+	})
+
+	// A file is loaded in several packages if the package containing it
+	// is loaded with and without its tests; each file is examined once
+	visited := map[string]bool{}
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for _, file := range pkg.Syntax {
+			filename := r.Program.Fset.Position(file.Pos()).Filename
+			if visited[filename] {
+				continue
+			}
+			visited[filename] = true
+			if !r.findRefsInFile(pkg, filename, file) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// findRefsInFile finds the references to moved objects in the given file (see
+// findRefs).
+func (r *ExtractPackage) findRefsInFile(pkg *packages.Package, filename string, file *ast.File) bool {
+	selectors := map[*ast.Ident]*ast.SelectorExpr{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				if _, isPkg := pkg.TypesInfo.Uses[x].(*types.PkgName); isPkg {
+					selectors[sel.Sel] = sel
+				}
+			}
+		}
+		return true
+	})
+
+	ok := true
+	ast.Inspect(file, func(n ast.Node) bool {
+		id, isIdent := n.(*ast.Ident)
+		if !ok || !isIdent {
+			return ok
+		}
+		obj := pkg.TypesInfo.Uses[id]
+		if obj == nil || obj.Pkg() == nil || r.inMovedText(id.Pos()) {
+			return true
+		}
+		if isMember(obj) {
+			if !obj.Exported() && r.inMovedText(obj.Pos()) {
+				r.Log.Errorf("%s is unexported, so it cannot be "+
+					"used outside %s after it is moved.",
+					obj.Name(), r.pkgPath)
+				r.Log.AssociateNode(id)
+				ok = false
+			}
+			return ok
+		}
+		if _, moved := r.moved[r.posKey(obj.Pos())]; !moved {
+			return true
+		}
+		ref := &movedRef{pkg: pkg, filename: filename, file: file, id: id,
+			sel: selectors[id]}
+		if ref.sel == nil && pkg.PkgPath != r.SelectedNodePkg.PkgPath {
+			r.Log.Errorf("The reference to %s cannot be updated, "+
+				"since it refers to a dot import.", obj.Name())
+			r.Log.AssociateNode(id)
+			ok = false
+			return false
+		}
+		r.refs = append(r.refs, ref)
+		return true
+	})
+	return ok
+}
+
+// exportNames determines which moved objects must be exported: those that are
+// referenced outside the moved declarations.  It logs an error and returns
+// false if a name cannot be exported.
+func (r *ExtractPackage) exportNames() bool {
+	taken := map[string]bool{}
+	for _, obj := range r.moved {
+		if !isMember(obj) {
+			taken[obj.Name()] = true
+		}
+	}
+	for _, ref := range r.refs {
+		obj := ref.pkg.TypesInfo.Uses[ref.id]
+		key := r.posKey(obj.Pos())
+		if obj.Exported() || r.exported[key] != "" {
+			continue
+		}
+		name := exportedName(obj.Name())
+		if !ast.IsExported(name) {
+			r.Log.Errorf("The name \"%s\" cannot be exported, so it "+
+				"cannot be used outside %s.", obj.Name(), r.pkgPath)
+			r.Log.AssociateCode(CodeInvalidName)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			return false
+		}
+		if taken[name] {
+			r.Log.Errorf("%s cannot be exported as %s, since %s is "+
+				"also being moved to %s.", obj.Name(), name, name,
+				r.pkgPath)
+			r.Log.AssociateCode(CodeInvalidName)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			return false
+		}
+		taken[name] = true
+		r.exported[key] = name
+	}
+
+	// Rename the exported objects in the moved declarations
+	info := r.SelectedNodePkg.TypesInfo
+	for _, d := range r.decls {
+		ast.Inspect(d.node, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj := info.Defs[id]
+			if obj == nil {
+				obj = info.Uses[id]
+			}
+			if obj == nil {
+				return true
+			}
+			if name := r.exported[r.posKey(obj.Pos())]; name != "" {
+				offset := r.Program.Fset.Position(id.Pos()).Offset
+				r.addMovedEdit(d, &text.Extent{Offset: offset, Length: len(id.Name)}, name)
+			}
+			return true
+		})
+		r.exportDocComments(d)
+	}
+	return true
+}
+
+// exportDocComments renames the exported objects at the beginning of the doc
+// comments of the declarations and specs declaring them in the given moved
+// declaration (e.g., "parseLine returns..." becomes "ParseLine returns...").
+func (r *ExtractPackage) exportDocComments(d *movedDecl) {
+	ast.Inspect(d.node, func(n ast.Node) bool {
+		var doc *ast.CommentGroup
+		var ids []*ast.Ident
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			doc, ids = n.Doc, []*ast.Ident{n.Name}
+		case *ast.GenDecl:
+			if len(n.Specs) == 1 {
+				doc, ids = n.Doc, specNames(n.Specs[0])
+			}
+		case ast.Spec:
+			if spec, ok := n.(*ast.TypeSpec); ok {
+				doc = spec.Doc
+			} else if spec, ok := n.(*ast.ValueSpec); ok {
+				doc = spec.Doc
+			}
+			ids = specNames(n)
+		}
+		for _, id := range ids {
+			name := r.exported[r.posKey(id.Pos())]
+			if name == "" {
+				continue
+			}
+			// Only the name beginning the comment is renamed, since
+			// other occurrences may be prose (e.g., "distance returns
+			// the distance...")
+			if doc == nil || !strings.HasPrefix(doc.List[0].Text, "// ") {
+				continue
+			}
+			start := r.Program.Fset.Position(doc.List[0].Slash).Offset + len("// ")
+			for _, extent := range names.FindInDocComment(id.Name, doc, r.Program.Fset) {
+				if extent.Offset == start {
+					r.addMovedEdit(d, extent, name)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// specNames returns the names declared by the given type or value spec.
+func specNames(spec ast.Spec) []*ast.Ident {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		return []*ast.Ident{spec.Name}
+	case *ast.ValueSpec:
+		return spec.Names
+	}
+	return nil
+}
+
+// addMovedEdit adds an edit replacing the given extent (with an offset
+// relative to the start of the file) in the text of the given moved
+// declaration.
+func (r *ExtractPackage) addMovedEdit(d *movedDecl, extent *text.Extent, replacement string) {
+	if d.edits == nil {
+		d.edits = text.NewEditSet()
+	}
+	d.edits.Add(&text.Extent{Offset: extent.Offset - d.start, Length: extent.Length},
+		replacement)
+}
+
+// chooseQualifiers determines the name used to qualify references to moved
+// objects in each file containing them.  This is the name of the new package,
+// unless that name refers to a different declaration (e.g., another import or
+// a local variable) at one of the references; then the new package is
+// imported under an alias (see importAlias).
+func (r *ExtractPackage) chooseQualifiers() {
+	refs := map[string][]*movedRef{}
+	filenames := []string{}
+	for _, ref := range r.refs {
+		if refs[ref.filename] == nil {
+			filenames = append(filenames, ref.filename)
+		}
+		refs[ref.filename] = append(refs[ref.filename], ref)
+	}
+	for _, filename := range filenames {
+		fileRefs := refs[filename]
+		ref := fileRefs[0]
+		q := newTypeQualifier(ref.pkg.Types, ref.file)
+		name, ok := q.importedName(r.newPkg)
+		if !ok {
+			name = r.pkgName
+		}
+		if r.qualifierConflict(name, fileRefs) != nil {
+			name = r.importAlias(fileRefs)
+		}
+		r.qualifiers[filename] = name
+	}
+}
+
+// qualifierConflict returns the reference at which the given name would not
+// refer to the new package, or nil if there is no such reference.
+func (r *ExtractPackage) qualifierConflict(name string, refs []*movedRef) *movedRef {
+	for _, ref := range refs {
+		scope := ref.pkg.Types.Scope().Innermost(ref.id.Pos())
+		if scope == nil {
+			continue
+		}
+		_, obj := scope.LookupParent(name, ref.id.Pos())
+		if obj == nil || r.moved[r.posKey(obj.Pos())] != nil {
+			continue
+		}
+		if pkgName, ok := obj.(*types.PkgName); ok &&
+			pkgName.Imported().Path() == r.pkgPath {
+			continue
+		}
+		return ref
+	}
+	return nil
+}
+
+// importAlias returns a name under which the new package can be imported in
+// a file containing the given references, when its own name is unavailable.
+// The alias is formed from the last two elements of the import path (e.g.,
+// geoshapes for geo/shapes), followed by a number if that name is also
+// unavailable.
+func (r *ExtractPackage) importAlias(refs []*movedRef) string {
+	prefix := strings.Map(func(ch rune) rune {
+		if unicode.IsLetter(ch) || unicode.IsDigit(ch) {
+			return unicode.ToLower(ch)
+		}
+		return -1
+	}, path.Base(path.Dir(r.pkgPath)))
+	base := prefix + r.pkgName
+	if !isIdentifierValid(base) {
+		base = r.pkgName
+	}
+	alias := base
+	for i := 2; alias == r.pkgName || isReservedWord(alias) ||
+		r.qualifierConflict(alias, refs) != nil; i++ {
+		alias = fmt.Sprintf("%s%d", base, i)
+	}
+	return alias
+}
+
+// updateFiles adds edits that remove the moved declarations from their files,
+// qualify references to the moved objects with the name of the new package,
+// and update the imports of the modified files.
+func (r *ExtractPackage) updateFiles() {
+	type fileInfo struct {
+		pkg   *packages.Package
+		file  *ast.File
+		decls []*declText
+		refs  []*movedRef
+	}
+	byFile := map[string]*fileInfo{}
+	filenames := []string{}
+	infoFor := func(filename string, pkg *packages.Package, file *ast.File) *fileInfo {
+		if byFile[filename] == nil {
+			byFile[filename] = &fileInfo{pkg: pkg, file: file}
+			filenames = append(filenames, filename)
+		}
+		return byFile[filename]
+	}
+	for _, d := range r.decls {
+		fi := infoFor(d.filename, r.SelectedNodePkg, d.file)
+		fi.decls = append(fi.decls, d.declText)
+	}
+	for _, ref := range r.refs {
+		fi := infoFor(ref.filename, ref.pkg, ref.file)
+		fi.refs = append(fi.refs, ref)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		fi := byFile[filename]
+		contents, err := r.files.read(filename)
+		if err != nil {
+			r.Log.Error(err)
+			return
+		}
+		if r.Edits[filename] == nil {
+			r.Edits[filename] = text.NewEditSet()
+			r.Edits[filename].SetBase(contents)
+		}
+
+		q := newTypeQualifier(fi.pkg.Types, fi.file)
+		if _, ok := q.importedName(r.newPkg); !ok && r.qualifiers[filename] != "" {
+			q.importAs(r.newPkg, r.qualifiers[filename])
+		}
+		rewritten := map[*ast.Ident]bool{}
+		for _, ref := range fi.refs {
+			obj := ref.pkg.TypesInfo.Uses[ref.id]
+			name := r.exported[r.posKey(obj.Pos())]
+			if name == "" {
+				name = obj.Name()
+			}
+			var node ast.Node = ref.id
+			if ref.sel != nil {
+				node = ref.sel
+				rewritten[ref.sel.X.(*ast.Ident)] = true
+			}
+			offset := r.Program.Fset.Position(node.Pos()).Offset
+			length := r.Program.Fset.Position(node.End()).Offset - offset
+			r.Edits[filename].Add(&text.Extent{Offset: offset, Length: length},
+				q.qualify(r.newPkg)+"."+name)
+		}
+
+		var unused []importSpec
+		if len(fi.decls) > 0 {
+			r.removeDeclText(filename, contents, fi.decls)
+			unused = r.unusedImports(fi.decls, nil)
+		} else {
+			unused = r.rewrittenImports(fi.pkg, fi.file, rewritten)
+		}
+		r.updateImports(filename, contents, q, unused)
+	}
+}
+
+// rewrittenImports returns the imports of the current package in the given
+// file that are no longer used once the given qualifiers (pkg in pkg.Name)
+// are replaced with the name of the new package.
+func (r *ExtractPackage) rewrittenImports(pkg *packages.Package, file *ast.File, rewritten map[*ast.Ident]bool) []importSpec {
+	remaining := map[*types.PkgName]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && !rewritten[id] {
+			if pkgName, ok := pkg.TypesInfo.Uses[id].(*types.PkgName); ok {
+				remaining[pkgName] = true
+			}
+		}
+		return true
+	})
+
+	unused := []importSpec{}
+	for _, spec := range file.Imports {
+		var obj types.Object
+		if spec.Name != nil {
+			obj = pkg.TypesInfo.Defs[spec.Name]
+		} else {
+			obj = pkg.TypesInfo.Implicits[spec]
+		}
+		pkgName, ok := obj.(*types.PkgName)
+		if !ok || remaining[pkgName] ||
+			pkgName.Imported().Path() != r.SelectedNodePkg.PkgPath {
+			continue
+		}
+		imp := importSpec{path: pkgName.Imported().Path()}
+		if spec.Name != nil {
+			imp.name = spec.Name.Name
+		}
+		unused = append(unused, imp)
+	}
+	return unused
+}
+
+const extractPackageDoc = `
+  <h4>Purpose</h4>
+  <p>The Extract Package refactoring moves a set of package-level
+  declarations into a new package, creating a directory and a Go source file
+  for it, and updates the references to the moved declarations throughout the
+  refactoring scope.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select one or more package-level declarations (functions, types,
+    variables, or constants).</li>
+    <li>Activate the Extract Package refactoring.</li>
+    <li>Enter the import path of the new package (e.g.,
+    <tt>example.com/app/util</tt>).  The last element of the path is used
+    as the package name, and the package's directory is determined from its
+    import path, relative to the module (or GOPATH directory) containing the
+    current package.</li>
+    <li>Optionally, enter the names of other declarations in the current
+    package to move (separated by commas).</li>
+  </ol>
+
+  <p>The methods of every moved type are moved along with it.  The new file
+  is named after the package (e.g., <tt>util.go</tt>), begins with the same
+  header comments (e.g., a copyright notice) as the file containing the
+  selection, and imports the packages used by the moved declarations.</p>
+
+  <p>Moved declarations that are used outside the moved code are exported
+  (e.g., <tt>parseLine</tt> becomes <tt>ParseLine</tt>), and references to
+  them are qualified with the name of the new package (e.g.,
+  <tt>util.ParseLine</tt>).  The new package is imported by the files
+  containing those references, and imports that are no longer used are
+  removed.  In a file where the new package's name already refers to a
+  different declaration (e.g., another imported package with the same name),
+  the new package is imported under an alias formed from the last two
+  elements of its import path (e.g., <tt>apputil</tt>), and references there
+  are qualified with the alias.  If a grouped declaration (e.g., <tt>var ( ... )</tt>) is only
+  partially selected, only the selected specs are moved, except that a
+  constant declaration is always moved in its entirety.</p>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The moved declarations refer to a declaration that remains in the
+    current package, since the new package cannot import the current package
+    (which will import it).  Move that declaration as well.</li>
+    <li>A method is selected without its receiver type, or a method of a
+    moved type is declared in a test file.</li>
+    <li>An unexported field or method of a moved type is used outside the
+    moved code.</li>
+    <li>A moved declaration is referenced via a dot import
+    (<tt>import . "pkg"</tt>).</li>
+    <li>The package already exists, its directory already contains Go source
+    files, or it is outside the current module.</li>
+    <li>A declaration to be moved is in a test file or a file that uses
+    cgo.</li>
+  </ul>
+`
@@ -0,0 +1,51 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// TestExtractPackageReused checks that an ExtractPackage instance can be run
+// more than once (as the protocol daemon and the test harness do) without
+// carrying edits over from an earlier run.
+func TestExtractPackageReused(t *testing.T) {
+	r := &ExtractPackage{}
+	run := func(dir string, line, col int, args ...interface{}) *Result {
+		gopath, err := filepath.Abs(filepath.Join("testdata",
+			"extractpackage", dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(gopath, "src", "geo", "geo.go")
+		result := r.Run(&Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Scope:      []string{filepath.Join(gopath, "src", "main.go")},
+			Selection: &text.LineColSelection{Filename: filename,
+				StartLine: line, StartCol: col,
+				EndLine: line, EndCol: col + 4},
+			Args:       args,
+			GoPath:     gopath,
+			ModulesOff: true,
+		})
+		if result.Log.ContainsErrors() {
+			t.Fatalf("%s: %s", dir, result.Log)
+		}
+		for filename := range result.Edits {
+			if !strings.HasPrefix(filename, gopath+string(filepath.Separator)) {
+				t.Errorf("%s: unexpected edits to %s", dir, filename)
+			}
+		}
+		return result
+	}
+
+	run("001-basic", 12, 1, "geo/shapes", "distance")
+	run("004-grouped-var", 7, 1, "geo/config")
+}
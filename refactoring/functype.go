@@ -0,0 +1,418 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Introduce Function Type refactoring, which declares a
+// named type for a function signature and replaces occurrences of that
+// signature in the package with the new type.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/types"
+	"path/filepath"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// An IntroduceFuncType refactoring declares a named function type (e.g., type
+// Handler func(ctx context.Context, req *Request) error) for the selected
+// function type and replaces every function type in the package that denotes
+// the same signature with the new type.  Function types in function and
+// method declarations, function literals, and interface methods are
+// signatures, not uses of a type, so they are not replaced.
+type IntroduceFuncType struct {
+	RefactoringBase
+	files    *sourceFiles
+	typeName string
+	selected *ast.FuncType
+	sig      *types.Signature
+}
+
+// A funcTypeUse is a function type expression that will be replaced with the
+// new type.
+type funcTypeUse struct {
+	file *ast.File
+	expr *ast.FuncType
+	// True if the function type is part of another type (e.g., []func()),
+	// which will no longer be identical to the original type
+	nested bool
+}
+
+func (r *IntroduceFuncType) Description() *Description {
+	return &Description{
+		Name:      "Introduce Function Type",
+		Synopsis:  "Declares a named type for a repeated function signature",
+		Usage:     "<type_name>",
+		HTMLDoc:   introduceFuncTypeDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Type Name:",
+			Prompt:       "Name of the function type to declare.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+		Quality:        Testing,
+	}
+}
+
+func (r *IntroduceFuncType) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+
+	r.typeName = config.Args[0].(string)
+	r.selected, r.sig = nil, nil
+	if !isIdentifierValid(r.typeName) || r.typeName == "_" {
+		r.Log.Errorf("The type name \"%s\" is not a valid Go identifier",
+			r.typeName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return &r.Result
+	}
+	if isReservedWord(r.typeName) {
+		r.Log.Errorf("The type name \"%s\" is a reserved word",
+			r.typeName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return &r.Result
+	}
+
+	if !r.selectedFuncType() || !r.checkLocalNames() {
+		return &r.Result
+	}
+	uses := r.findUses()
+	if uses == nil || !r.checkConflicts(uses) {
+		return &r.Result
+	}
+	for _, use := range uses {
+		r.replaceUse(use)
+	}
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.addDecl()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// selectedFuncType finds the innermost function type expression containing
+// the selection.  It logs an error and returns false if there is no such
+// expression.
+func (r *IntroduceFuncType) selectedFuncType() bool {
+	path := r.PathEnclosingSelection
+	for i, node := range path {
+		if ft, ok := node.(*ast.FuncType); ok && isFuncTypeExpr(ft, path[i+1:]) {
+			r.selected = ft
+			r.sig, _ = r.SelectedNodePkg.TypesInfo.TypeOf(ft).(*types.Signature)
+			break
+		}
+	}
+	if r.selected == nil || r.sig == nil {
+		r.Log.Error("Please select a function type (e.g., the type " +
+			"func(int) error in a parameter or variable declaration).")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		r.selected = nil
+		return false
+	}
+	return true
+}
+
+// isFuncTypeExpr returns true if the given function type is a type
+// expression, rather than the signature of a function declaration, function
+// literal, or interface method, given the nodes enclosing it (innermost
+// first).
+func isFuncTypeExpr(ft *ast.FuncType, parents []ast.Node) bool {
+	if len(parents) == 0 {
+		return false
+	}
+	switch p := parents[0].(type) {
+	case *ast.FuncDecl, *ast.FuncLit:
+		return false
+	case *ast.Field:
+		if len(parents) > 2 && len(p.Names) > 0 {
+			_, isInterface := parents[2].(*ast.InterfaceType)
+			return !isInterface
+		}
+	}
+	return true
+}
+
+// checkLocalNames logs an error and returns false if the selected function
+// type refers to a type or constant declared in a function, which cannot be
+// referenced by a package-level type declaration.
+func (r *IntroduceFuncType) checkLocalNames() bool {
+	pkg := r.SelectedNodePkg
+	var local *ast.Ident
+	ast.Inspect(r.selected, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && local == nil {
+			obj := pkg.TypesInfo.Uses[id]
+			if obj != nil && obj.Pkg() == pkg.Types &&
+				obj.Parent() != nil &&
+				obj.Parent() != pkg.Types.Scope() &&
+				obj.Parent().Parent() != pkg.Types.Scope() {
+				local = id
+			}
+		}
+		return local == nil
+	})
+	if local != nil {
+		r.Log.Errorf("The function type refers to %s, which is "+
+			"declared in a function", local.Name)
+		r.Log.AssociateNode(local)
+		return false
+	}
+	return true
+}
+
+// findUses returns the function type expressions in the package that denote
+// the selected signature.  It logs an error and returns nil if the signature
+// is used in a type assertion or type switch, since the dynamic type of a
+// value converted to the new type would no longer match it.
+func (r *IntroduceFuncType) findUses() []*funcTypeUse {
+	info := r.SelectedNodePkg.TypesInfo
+	uses := []*funcTypeUse{}
+	for _, file := range r.SelectedNodePkg.Syntax {
+		stack := []ast.Node{}
+		ast.Inspect(file, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			parents := make([]ast.Node, len(stack))
+			for i, node := range stack {
+				parents[len(stack)-1-i] = node
+			}
+			stack = append(stack, n)
+
+			ft, ok := n.(*ast.FuncType)
+			if !ok || !isFuncTypeExpr(ft, parents) ||
+				!types.Identical(info.TypeOf(ft), r.sig) {
+				return true
+			}
+			if isAssertedType(ft, parents) {
+				r.Log.Errorf("The function type is used in a type "+
+					"assertion or type switch, so it cannot be "+
+					"replaced with %s", r.typeName)
+				r.Log.AssociateNode(ft)
+				uses = nil
+				return true
+			}
+			if uses != nil {
+				uses = append(uses, &funcTypeUse{file, ft,
+					isNestedType(parents)})
+			}
+			return true
+		})
+	}
+	return uses
+}
+
+// isAssertedType returns true if the given type expression is the type in a
+// type assertion or in a case of a type switch, given the nodes enclosing it
+// (innermost first).
+func isAssertedType(expr ast.Expr, parents []ast.Node) bool {
+	var node ast.Node = expr
+	for i, parent := range parents {
+		switch p := parent.(type) {
+		case *ast.ParenExpr:
+			node = p
+			continue
+		case *ast.TypeAssertExpr:
+			return p.Type == node
+		case *ast.CaseClause:
+			if i+2 < len(parents) {
+				_, ok := parents[i+2].(*ast.TypeSwitchStmt)
+				return ok
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// isNestedType returns true if a type expression with the given enclosing
+// nodes (innermost first) is part of a composite type: the element type of
+// an array, slice, map, channel, or pointer type, or the type of a parameter
+// or result in a function type expression.
+func isNestedType(parents []ast.Node) bool {
+	for i, parent := range parents {
+		switch parent.(type) {
+		case *ast.ParenExpr, *ast.Ellipsis:
+			continue
+		case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.StarExpr:
+			return true
+		case *ast.Field:
+			if i+2 < len(parents) {
+				if ft, ok := parents[i+2].(*ast.FuncType); ok {
+					return isFuncTypeExpr(ft, parents[i+3:])
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// checkConflicts checks that the name of the new type does not conflict with
+// an existing declaration in the package, and that it will not be shadowed
+// where it is used.  It logs an error and returns false if it will.
+func (r *IntroduceFuncType) checkConflicts(uses []*funcTypeUse) bool {
+	pkg := r.SelectedNodePkg
+	if obj := pkg.Types.Scope().Lookup(r.typeName); obj != nil {
+		r.Log.Errorf("The name %s conflicts with an existing "+
+			"declaration", r.typeName)
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		r.Log.AssociateCode(CodeRenameConflict)
+		return false
+	}
+	for _, file := range pkg.Syntax {
+		if obj := pkg.TypesInfo.Scopes[file].Lookup(r.typeName); obj != nil {
+			r.Log.Errorf("The name %s conflicts with an imported "+
+				"package name", r.typeName)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+	}
+
+	for _, use := range uses {
+		_, path, _ := r.Program.PathEnclosingInterval(use.expr.Pos(), use.expr.End())
+		scope := scopeAt(pkg.TypesInfo, path)
+		if scope == nil {
+			continue
+		}
+		if _, obj := scope.LookupParent(r.typeName, use.expr.Pos()); obj != nil {
+			r.Log.Errorf("The name %s would refer to a different "+
+				"declaration here", r.typeName)
+			r.Log.AssociateNode(use.expr)
+			r.Log.AddRelated("Conflicting declaration",
+				obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+	}
+	return true
+}
+
+// replaceUse adds an edit replacing the given function type with the new
+// type.  If the function type is part of another type, it logs a warning,
+// since values of the original type can no longer be used where that type is
+// expected (e.g., a []func() cannot be passed to a parameter of type
+// []Handler).
+func (r *IntroduceFuncType) replaceUse(use *funcTypeUse) {
+	filename := r.Program.Fset.Position(use.file.Pos()).Filename
+	if usesCgo(use.file) {
+		r.Log.Errorf("%s cannot be modified because it uses cgo "+
+			"(import \"C\")", filepath.Base(filename))
+		r.Log.AssociateNode(use.expr)
+		return
+	}
+	edits := r.editSet(r.files, filename)
+	if edits == nil {
+		return
+	}
+	if use.nested {
+		r.Log.Warnf("This type will contain %s instead of a function "+
+			"type, so values of the original type will not be "+
+			"assignable to it (e.g., in other packages)", r.typeName)
+		r.Log.AssociateNode(use.expr)
+	}
+	edits.Add(r.Extent(use.expr), r.typeName)
+}
+
+// addDecl adds an edit inserting the declaration of the new type before the
+// declaration containing the selected function type.
+func (r *IntroduceFuncType) addDecl() {
+	path := r.PathEnclosingSelection
+	var decl ast.Node = path[len(path)-2]
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			decl = d.Doc
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			decl = d.Doc
+		}
+	}
+	start, end := r.OffsetOfPos(r.selected.Pos()), r.OffsetOfPos(r.selected.End())
+	src := "type " + r.typeName + " " + string(r.FileContents[start:end])
+	edits := r.editSet(r.files, r.Filename)
+	if edits == nil {
+		return
+	}
+	edits.Add(&text.Extent{Offset: r.OffsetOfPos(decl.Pos())}, src+"\n\n")
+}
+
+const introduceFuncTypeDoc = `
+  <h4>Purpose</h4>
+  <p>The Introduce Function Type refactoring declares a named type for a
+  function signature that is repeated throughout a package (e.g., the type of
+  a callback) and replaces each occurrence of that signature with the new
+  type.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function type, such as the type of a parameter, variable, or
+    struct field (e.g., <tt>func(int) error</tt>).</li>
+    <li>Activate the Introduce Function Type refactoring.</li>
+    <li>Enter a name for the new type.</li>
+  </ol>
+
+  <p>The new type is declared before the declaration containing the
+  selection.  Every function type in the package that denotes the same
+  signature (i.e., with the same parameter and result types, regardless of
+  the parameters' names) is replaced with the new type.  The signatures of
+  function declarations, function literals, and interface methods are not
+  changed.</p>
+
+  <h4>Example</h4>
+  <p>In this example, the type of <tt>handler</tt> is selected, and the new
+  type is named <tt>Handler</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+  <pre>type Server struct {
+    handler <span class="highlight">func(req string) error</span>
+}
+
+func (s *Server) Handle(h func(string) error) {
+    s.handler = h
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+  <pre><span class="highlight">type Handler func(req string) error</span>
+
+type Server struct {
+    handler <span class="highlight">Handler</span>
+}
+
+func (s *Server) Handle(h <span class="highlight">Handler</span>) {
+    s.handler = h
+}</pre>
+      </td>
+    </tr>
+  </table>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The function type refers to a type or constant declared in a
+    function.</li>
+    <li>The function type is used in a type assertion or type switch (a
+    function value converted to the new type would no longer match it).</li>
+    <li>The name of the new type conflicts with an existing declaration.</li>
+  </ul>
+
+  <p>A warning will be reported if the function type is part of another type
+  (e.g., <tt>[]func(int) error</tt>), since values of the original type will no
+  longer be assignable to it.</p>
+`
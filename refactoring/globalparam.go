@@ -0,0 +1,726 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Convert Global to Parameter refactoring, which
+// replaces the uses of a package-level variable in a function (and the
+// functions it calls) with a new parameter, so the dependency is passed in
+// explicitly rather than read from global state.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/names"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/packages"
+)
+
+// A GlobalToParam refactoring threads a package-level variable through a
+// function and its callees as a parameter.  For example, given
+//
+//	var db *sql.DB
+//
+//	func handle(id int) { save(id) }
+//	func save(id int)   { db.Exec("...", id) }
+//
+// converting db to a parameter of handle produces
+//
+//	func handle(db *sql.DB, id int) { save(db, id) }
+//	func save(db *sql.DB, id int)   { db.Exec("...", id) }
+//
+// and calls to handle elsewhere pass the global variable, handle(db, 1).  If
+// the variable is assigned anywhere (or its address is taken), a pointer to
+// it is passed instead, so assignments still affect the global variable.
+type GlobalToParam struct {
+	RefactoringBase
+	files     *sourceFiles
+	global    *types.Var
+	uses      map[*ast.Ident]bool // all uses of the global variable
+	paramName string
+	pointer   bool // true iff the parameter is a pointer to the global
+	// Functions that will receive the parameter
+	funcs map[*ast.FuncDecl]*globalParamFunc
+	// Remaining depth with which each function has been visited
+	visited map[*ast.FuncDecl]int
+}
+
+// A globalParamFunc is a function that will receive the global variable as
+// a parameter.
+type globalParamFunc struct {
+	fn       *types.Func
+	decl     *ast.FuncDecl
+	pkg      *packages.Package
+	file     *ast.File
+	filename string
+}
+
+func (r *GlobalToParam) Description() *Description {
+	return &Description{
+		Name:      "Convert Global to Parameter",
+		Synopsis:  "Passes a package-level variable to a function as a parameter",
+		Usage:     "<function> [<depth>]",
+		HTMLDoc:   globalParamDoc,
+		Multifile: true,
+		Params: []Parameter{{
+			Label:        "Function:",
+			Prompt:       "Name of the function that will receive the variable as a parameter.",
+			DefaultValue: "",
+		}},
+		OptionalParams: []Parameter{{
+			Label:        "Depth:",
+			Prompt:       "Levels of callees that will also receive the parameter (default: 1).",
+			DefaultValue: "",
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *GlobalToParam) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+	r.funcs = map[*ast.FuncDecl]*globalParamFunc{}
+	r.visited = map[*ast.FuncDecl]int{}
+
+	funcName := strings.TrimSpace(config.Args[0].(string))
+	depth := 1
+	if len(config.Args) > 1 {
+		if arg := strings.TrimSpace(config.Args[1].(string)); arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				r.Log.Errorf("The depth must be a nonnegative "+
+					"integer, not \"%s\"", arg)
+				r.Log.AssociateCode(CodeInvalidArgs)
+				return &r.Result
+			}
+			depth = n
+		}
+	}
+
+	if !r.findGlobal() {
+		return &r.Result
+	}
+	root := r.findRoot(funcName)
+	if root == nil {
+		return &r.Result
+	}
+	if !r.include(root, depth) {
+		r.Log.Errorf("%s does not use %s (or call a function that "+
+			"uses it, up to a depth of %d)", funcName,
+			r.global.Name(), depth)
+		r.Log.AssociateNode(root.decl.Name)
+		return &r.Result
+	}
+
+	funcs := r.sortedFuncs()
+	r.pointer = r.isModified()
+	for _, f := range funcs {
+		r.checkFunc(f)
+	}
+	calls := r.findCalls(funcs)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	for _, f := range funcs {
+		r.addParam(f)
+	}
+	r.replaceUses()
+	for _, call := range calls {
+		r.updateCall(call)
+	}
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if len(funcs) > 1 {
+		names := []string{}
+		for _, f := range funcs[1:] {
+			names = append(names, f.fn.Name())
+		}
+		r.Log.Infof("%s will also be passed to %s", r.global.Name(),
+			strings.Join(names, ", "))
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findGlobal finds the package-level variable named by the selected
+// identifier and chooses the name of the new parameter.  It logs an error and
+// returns false if the selection is not such a variable.
+func (r *GlobalToParam) findGlobal() bool {
+	id, ok := r.SelectedNode.(*ast.Ident)
+	if ok {
+		r.global, ok = r.SelectedNodePkg.TypesInfo.ObjectOf(id).(*types.Var)
+	}
+	if !ok || r.global.Pkg() == nil ||
+		r.global.Parent() != r.global.Pkg().Scope() {
+		r.Log.Error("Please select a package-level variable.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	r.uses = names.FindOccurrences(r.global, r.Program)
+
+	r.paramName = unexportedName(r.global.Name())
+	if token.Lookup(r.paramName).IsKeyword() || r.paramName == "_" {
+		r.Log.Errorf("%s cannot be used as the name of a parameter",
+			r.paramName)
+		r.Log.AssociateNode(id)
+		return false
+	}
+	return true
+}
+
+// findRoot returns the function with the given name in the global
+// variable's package, which will receive the parameter.  It logs an error and
+// returns nil if there is no such function.
+func (r *GlobalToParam) findRoot(name string) *globalParamFunc {
+	fn, ok := r.SelectedNodePkg.Types.Scope().Lookup(name).(*types.Func)
+	if !ok {
+		r.Log.Errorf("There is no function named \"%s\" in package %s",
+			name, r.SelectedNodePkg.Types.Name())
+		r.Log.AssociateCode(CodeInvalidArgs)
+		return nil
+	}
+	f := r.funcFor(fn)
+	if f == nil {
+		r.Log.Errorf("The declaration of %s could not be found", name)
+		return nil
+	}
+	return f
+}
+
+// funcFor returns a globalParamFunc for the given function if it is declared
+// (with a body) in the global variable's package, or nil otherwise.
+func (r *GlobalToParam) funcFor(fn *types.Func) *globalParamFunc {
+	if fn.Pkg() == nil || fn.Pkg().Path() != r.global.Pkg().Path() ||
+		fn.Parent() != fn.Pkg().Scope() {
+		return nil
+	}
+	pkg, path, _ := r.Program.PathEnclosingInterval(fn.Pos(), fn.Pos())
+	if len(path) < 2 {
+		return nil
+	}
+	decl, ok := path[1].(*ast.FuncDecl)
+	if !ok || decl.Body == nil {
+		return nil
+	}
+	if f, ok := r.funcs[decl]; ok {
+		return f
+	}
+	file := path[len(path)-1].(*ast.File)
+	return &globalParamFunc{
+		fn:       fn,
+		decl:     decl,
+		pkg:      pkg,
+		file:     file,
+		filename: r.Program.Fset.Position(file.Pos()).Filename,
+	}
+}
+
+// include determines whether the given function uses the global variable or
+// calls a function (up to the given depth) that uses it.  Every such function
+// is added to r.funcs.
+func (r *GlobalToParam) include(f *globalParamFunc, depth int) bool {
+	if prev, ok := r.visited[f.decl]; ok && prev >= depth {
+		_, included := r.funcs[f.decl]
+		return included
+	}
+	r.visited[f.decl] = depth
+
+	included := false
+	for id := range r.uses {
+		if f.decl.Body.Pos() <= id.Pos() && id.End() <= f.decl.Body.End() {
+			included = true
+			break
+		}
+	}
+	if depth > 0 {
+		for _, callee := range r.callees(f) {
+			if r.include(callee, depth-1) {
+				included = true
+			}
+		}
+	}
+	if included {
+		r.funcs[f.decl] = f
+	}
+	return included
+}
+
+// callees returns the functions in the global variable's package that are
+// called directly from the given function (not including methods).
+func (r *GlobalToParam) callees(f *globalParamFunc) []*globalParamFunc {
+	result := []*globalParamFunc{}
+	seen := map[*ast.FuncDecl]bool{}
+	ast.Inspect(f.decl.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		id, ok := unparen(call.Fun).(*ast.Ident)
+		if !ok {
+			return true
+		}
+		fn, ok := f.pkg.TypesInfo.Uses[id].(*types.Func)
+		if !ok {
+			return true
+		}
+		if callee := r.funcFor(fn); callee != nil && !seen[callee.decl] {
+			seen[callee.decl] = true
+			result = append(result, callee)
+		}
+		return true
+	})
+	return result
+}
+
+// unparen returns the given expression with any enclosing parentheses removed.
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.X
+	}
+}
+
+// sortedFuncs returns the functions that will receive the parameter, sorted
+// by position.
+func (r *GlobalToParam) sortedFuncs() []*globalParamFunc {
+	result := make([]*globalParamFunc, 0, len(r.funcs))
+	for _, f := range r.funcs {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].decl.Pos() < result[j].decl.Pos()
+	})
+	return result
+}
+
+// isModified returns true if the global variable is assigned, incremented,
+// or has its address taken (explicitly, or implicitly by calling a method
+// with a pointer receiver) anywhere in the program, including assignments to
+// its fields or array elements.
+func (r *GlobalToParam) isModified() bool {
+	for id := range r.uses {
+		pkg, path, _ := r.Program.PathEnclosingInterval(id.Pos(), id.End())
+		if pkg != nil && isModifiedAt(pkg.TypesInfo, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isModifiedAt returns true if the variable referenced by the identifier at
+// the start of the given path (from PathEnclosingInterval) may be modified.
+func isModifiedAt(info *types.Info, path []ast.Node) bool {
+	var node ast.Node = path[0]
+	for _, parent := range path[1:] {
+		switch p := parent.(type) {
+		case *ast.ParenExpr:
+			// Continue with the parent
+		case *ast.SelectorExpr:
+			sel := info.Selections[p]
+			if p.X != node || sel == nil || sel.Indirect() {
+				return false
+			}
+			if sel.Kind() == types.MethodVal {
+				sig := sel.Obj().Type().(*types.Signature)
+				_, ptr := sig.Recv().Type().(*types.Pointer)
+				return ptr
+			}
+			if sel.Kind() != types.FieldVal {
+				return false
+			}
+		case *ast.IndexExpr:
+			if p.X != node {
+				return false
+			}
+			if _, ok := info.TypeOf(p.X).Underlying().(*types.Array); !ok {
+				return false
+			}
+		case *ast.UnaryExpr:
+			return p.Op == token.AND
+		case *ast.AssignStmt:
+			for _, lhs := range p.Lhs {
+				if lhs == node {
+					return p.Tok != token.DEFINE
+				}
+			}
+			return false
+		case *ast.IncDecStmt:
+			return true
+		case *ast.RangeStmt:
+			return p.Tok == token.ASSIGN && (p.Key == node || p.Value == node)
+		default:
+			return false
+		}
+		node = parent
+	}
+	return false
+}
+
+// checkFunc logs an error if the parameter cannot be added to the given
+// function: it cannot be modified, its parameters are unnamed, or the name
+// of the new parameter would conflict with a name used in the function.
+func (r *GlobalToParam) checkFunc(f *globalParamFunc) {
+	switch {
+	case isInGoRoot(f.filename):
+		r.Log.Errorf("%s is defined in $GOROOT and cannot be modified",
+			f.fn.Name())
+	case usesCgo(f.file):
+		r.Log.Errorf("%s cannot be modified because it uses cgo "+
+			"(import \"C\")", filepath.Base(f.filename))
+	case len(f.decl.Type.Params.List) > 0 &&
+		len(f.decl.Type.Params.List[0].Names) == 0:
+		r.Log.Errorf("The parameters of %s are unnamed, so a named "+
+			"parameter cannot be added", f.fn.Name())
+	default:
+		if _, err := r.files.read(f.filename); err != nil {
+			r.Log.Error(err)
+			return
+		}
+		r.checkConflicts(f)
+		return
+	}
+	r.Log.AssociateNode(f.decl.Name)
+}
+
+// checkConflicts logs an error if the given function declares the name of
+// the new parameter, or refers to a different declaration with that name.
+// Only the first conflict in the function is reported.
+func (r *GlobalToParam) checkConflicts(f *globalParamFunc) {
+	found := false
+	ast.Inspect(f.decl, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if found || !ok || id.Name != r.paramName || id == f.decl.Name {
+			return !found
+		}
+		if obj := f.pkg.TypesInfo.Defs[id]; obj != nil {
+			r.Log.Errorf("The parameter %s would conflict with this "+
+				"declaration in %s", r.paramName, f.fn.Name())
+		} else if obj := f.pkg.TypesInfo.Uses[id]; obj != nil &&
+			obj.Pos() != r.global.Pos() {
+			r.Log.Errorf("The parameter %s would hide the declaration "+
+				"%s refers to here", r.paramName, id.Name)
+			r.Log.AddRelated("Hidden declaration", obj.Pos(), obj.Pos())
+		} else {
+			return true
+		}
+		r.Log.AssociateNode(id)
+		r.Log.AssociateCode(CodeRenameConflict)
+		found = true
+		return false
+	})
+}
+
+// A globalParamCall is a call to a function that will receive the
+// parameter.
+type globalParamCall struct {
+	call     *ast.CallExpr
+	filename string
+	caller   *ast.FuncDecl // nil if the call is not in a function
+}
+
+// findCalls returns the calls to the given functions, sorted by position.
+// It logs an error for each use of a function that is not a call, or that
+// is in a different package (which cannot access the global variable).
+func (r *GlobalToParam) findCalls(funcs []*globalParamFunc) []*globalParamCall {
+	result := []*globalParamCall{}
+	seen := map[*ast.CallExpr]bool{}
+	for _, f := range funcs {
+		uses := []*ast.Ident{}
+		for id := range names.FindOccurrences(f.fn, r.Program) {
+			if id != f.decl.Name {
+				uses = append(uses, id)
+			}
+		}
+		sort.Slice(uses, func(i, j int) bool { return uses[i].Pos() < uses[j].Pos() })
+		for _, use := range uses {
+			if c := r.checkCall(f, use); c != nil && !seen[c.call] {
+				seen[c.call] = true
+				result = append(result, c)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].call.Pos() < result[j].call.Pos()
+	})
+	return result
+}
+
+// checkCall returns the call in which the given use of a function appears,
+// or nil (after logging an error) if the call cannot be updated.
+func (r *GlobalToParam) checkCall(f *globalParamFunc, use *ast.Ident) *globalParamCall {
+	pkg, path, _ := r.Program.PathEnclosingInterval(use.Pos(), use.End())
+	file := path[len(path)-1].(*ast.File)
+	filename := r.Program.Fset.Position(file.Pos()).Filename
+	call, qualifier := enclosingCall(path)
+	switch {
+	case pkg.Types.Path() != r.global.Pkg().Path() || qualifier != "":
+		r.Log.Errorf("%s is called from package %s, which cannot "+
+			"pass %s to it", f.fn.Name(), pkg.Types.Name(),
+			r.global.Name())
+	case call == nil:
+		r.Log.Errorf("This use of %s is not a call, so it cannot be "+
+			"updated to pass %s", f.fn.Name(), r.global.Name())
+	case usesCgo(file):
+		r.Log.Errorf("%s cannot be modified because it uses cgo "+
+			"(import \"C\")", filepath.Base(filename))
+	default:
+		if _, err := r.files.read(filename); err != nil {
+			r.Log.Error(err)
+			return nil
+		}
+		c := &globalParamCall{call: call, filename: filename}
+		for _, node := range path {
+			if decl, ok := node.(*ast.FuncDecl); ok {
+				c.caller = decl
+			}
+		}
+		if _, ok := r.funcs[c.caller]; ok {
+			return c
+		}
+		// Outside the functions receiving the parameter, the call
+		// will pass the global variable, which must not be hidden
+		_, obj := scopeAt(pkg.TypesInfo, path).LookupParent(
+			r.global.Name(), call.Pos())
+		if obj == nil || obj.Pos() != r.global.Pos() {
+			r.Log.Errorf("This call to %s cannot pass %s, since %s "+
+				"refers to a different declaration here",
+				f.fn.Name(), r.global.Name(), r.global.Name())
+			r.Log.AssociateNode(call)
+			r.Log.AssociateCode(CodeRenameConflict)
+			return nil
+		}
+		return c
+	}
+	r.Log.AssociateNode(use)
+	return nil
+}
+
+// addParam adds the new parameter to the beginning of the given function's
+// parameter list, adding an import for the package declaring its type if
+// necessary.
+func (r *GlobalToParam) addParam(f *globalParamFunc) {
+	edits := r.editSet(r.files, f.filename)
+	if edits == nil {
+		return
+	}
+	// Use the global variable's type as seen in the function's package,
+	// which may be a test variant of the package containing the selection
+	typ := r.global.Type()
+	if obj := f.pkg.Types.Scope().Lookup(r.global.Name()); obj != nil {
+		typ = obj.Type()
+	}
+	q := newTypeQualifier(f.pkg.Types, f.file)
+	param := r.paramName + " " + q.TypeString(typ)
+	if r.pointer {
+		param = r.paramName + " *" + q.TypeString(typ)
+	}
+	if len(f.decl.Type.Params.List) > 0 {
+		param += ", "
+	}
+	offset := r.OffsetOfPos(f.decl.Type.Params.Opening) + 1
+	edits.Add(&text.Extent{Offset: offset}, param)
+	r.addImportsToFile(f.filename, r.files.contents[f.filename], q)
+}
+
+// replaceUses replaces the uses of the global variable in the functions
+// receiving the parameter with uses of the parameter.
+func (r *GlobalToParam) replaceUses() {
+	for id := range r.uses {
+		pkg, path, _ := r.Program.PathEnclosingInterval(id.Pos(), id.End())
+		if pkg == nil || !r.inFuncs(path) {
+			continue
+		}
+		filename := r.Program.Fset.Position(id.Pos()).Filename
+		edits := r.editSet(r.files, filename)
+		if edits == nil {
+			continue
+		}
+		var node ast.Node = id
+		replacement := r.paramName
+		if r.pointer {
+			node, replacement = r.derefUse(pkg.TypesInfo, path)
+		} else if replacement == id.Name {
+			continue
+		}
+		start, end := r.OffsetOfPos(node.Pos()), r.OffsetOfPos(node.End())
+		edits.Add(&text.Extent{Offset: start, Length: end - start},
+			replacement)
+	}
+}
+
+// inFuncs returns true if the given path (from PathEnclosingInterval) is
+// inside one of the functions receiving the parameter.
+func (r *GlobalToParam) inFuncs(path []ast.Node) bool {
+	for _, node := range path {
+		if decl, ok := node.(*ast.FuncDecl); ok {
+			_, found := r.funcs[decl]
+			return found
+		}
+	}
+	return false
+}
+
+// derefUse returns the node to replace and its replacement when the use of
+// the global variable at the start of the given path becomes a use of a
+// pointer parameter: &global becomes the parameter itself, global.Field
+// becomes param.Field (since selectors dereference pointers to structs
+// automatically), and other uses become *param, parenthesized if necessary.
+func (r *GlobalToParam) derefUse(info *types.Info, path []ast.Node) (ast.Node, string) {
+	id := path[0]
+	if len(path) < 2 {
+		return id, "*" + r.paramName
+	}
+	switch parent := path[1].(type) {
+	case *ast.UnaryExpr:
+		if parent.Op == token.AND {
+			return parent, r.paramName
+		}
+	case *ast.SelectorExpr:
+		switch info.TypeOf(parent.X).Underlying().(type) {
+		case *types.Pointer, *types.Interface:
+		default:
+			return id, r.paramName
+		}
+		return id, "(*" + r.paramName + ")"
+	case *ast.IndexExpr:
+		if parent.X == id {
+			return id, "(*" + r.paramName + ")"
+		}
+	case *ast.SliceExpr:
+		if parent.X == id {
+			return id, "(*" + r.paramName + ")"
+		}
+	case *ast.CallExpr:
+		if parent.Fun == id {
+			return id, "(*" + r.paramName + ")"
+		}
+	case *ast.TypeAssertExpr, *ast.StarExpr:
+		return id, "(*" + r.paramName + ")"
+	}
+	return id, "*" + r.paramName
+}
+
+// updateCall adds the new argument to the beginning of the given call's
+// argument list: the parameter, if the call is in a function receiving the
+// parameter, and otherwise the global variable (or its address).
+func (r *GlobalToParam) updateCall(c *globalParamCall) {
+	edits := r.editSet(r.files, c.filename)
+	if edits == nil {
+		return
+	}
+	arg := r.paramName
+	if _, ok := r.funcs[c.caller]; !ok {
+		arg = r.global.Name()
+		if r.pointer {
+			arg = "&" + arg
+		}
+	}
+	if len(c.call.Args) > 0 {
+		arg += ", "
+	}
+	offset := r.OffsetOfPos(c.call.Lparen) + 1
+	edits.Add(&text.Extent{Offset: offset}, arg)
+}
+
+const globalParamDoc = `
+  <h4>Purpose</h4>
+  <p>The Convert Global to Parameter refactoring passes a package-level
+  variable to a function as a parameter, rather than having the function
+  read the variable directly.  The parameter is also added to the functions
+  it calls that use the variable (up to a given depth), so the value is
+  threaded through the calls.  This is a step toward code whose dependencies
+  are explicit (and can be replaced in tests).</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the name of a package-level variable.</li>
+    <li>Activate the Convert Global to Parameter refactoring.</li>
+    <li>Enter the name of the function that should receive the variable as a
+    parameter.</li>
+    <li>Optionally, enter the depth: the number of levels of calls through
+    which the parameter is threaded.  By default, the parameter is added to
+    the function and to the functions it calls directly, if they use the
+    variable.  A depth of 0 adds the parameter only to the function
+    itself.</li>
+  </ol>
+
+  <p>The parameter has the same name as the variable (with its first letter
+  in lowercase) and is added at the beginning of each function's parameter
+  list.  In these functions, uses of the variable are replaced by uses of the
+  parameter, and calls between them pass the parameter along.  Other calls
+  pass the global variable itself.  Functions that use the variable beyond
+  the given depth continue to use it directly.</p>
+  <p>If the variable is assigned anywhere in the program, or if its address
+  is taken, the parameter is a pointer to the variable, so that assignments
+  in the functions still change the global variable.</p>
+
+  <h4>Example</h4>
+  <p>In this example, <tt>db</tt> is converted to a parameter of
+  <tt>handle</tt>.  Since <tt>handle</tt> calls <tt>save</tt>, which also
+  uses <tt>db</tt>, the parameter is added to <tt>save</tt> as well.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+  <pre>var <span class="highlight">db</span> *sql.DB
+
+func main() {
+    handle(1)
+}
+
+func handle(id int) {
+    save(id)
+}
+
+func save(id int) {
+    db.Exec("...", id)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+  <pre>var db *sql.DB
+
+func main() {
+    handle(<span class="highlight">db, </span>1)
+}
+
+func handle(<span class="highlight">db *sql.DB, </span>id int) {
+    save(<span class="highlight">db, </span>id)
+}
+
+func save(<span class="highlight">db *sql.DB, </span>id int) {
+    db.Exec("...", id)
+}</pre>
+      </td>
+    </tr>
+  </table>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>A function receiving the parameter already declares, or refers to a
+    different declaration with, the parameter's name.</li>
+    <li>A function receiving the parameter is used as a value (rather than
+    called), or is called from another package.</li>
+    <li>A function receiving the parameter has unnamed parameters.</li>
+  </ul>
+`
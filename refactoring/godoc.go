@@ -8,28 +8,49 @@
 package refactoring
 
 import (
+	"bufio"
 	"go/ast"
 	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 
+	"github.com/godoctor/godoctor/analysis/names"
+	"github.com/godoctor/godoctor/filesystem"
 	"github.com/godoctor/godoctor/text"
 )
 
 // The AddGoDoc refactoring adds GoDoc comments to all exported top-level
-// declarations in a File.
+// declarations in a File (or, in package mode, in every file of its package).
 type AddGoDoc struct {
 	RefactoringBase
+	files        *sourceFiles
+	filename     string           // file currently being commented
+	excludeNames []*regexp.Regexp // declaration names not to comment
+	excludeDirs  []string         // absolute paths of directories to skip
+	templates    CodeTemplates    // overrides the DocCommentTemplate
 }
 
 func (r *AddGoDoc) Description() *Description {
 	return &Description{
-		Name:           "Add GoDoc",
-		Synopsis:       "Adds stub GoDoc comments where they are missing",
-		Usage:          "",
-		HTMLDoc:        godocDoc,
-		Multifile:      false,
-		Params:         nil,
-		OptionalParams: nil,
-		Hidden:         false,
+		Name:      "Add GoDoc",
+		Synopsis:  "Adds stub GoDoc comments where they are missing",
+		Usage:     "[<package_mode> [<exclusions_file>]]",
+		HTMLDoc:   godocDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Package Mode:",
+			Prompt:       "Add comments to every file in the package?",
+			DefaultValue: false,
+		}, {
+			Label:        "Exclusions File:",
+			Prompt:       "File listing names and directories not to comment (optional).",
+			DefaultValue: "",
+		}},
+		Hidden:  false,
+		Quality: Production,
 	}
 }
 
@@ -40,25 +61,230 @@ func (r *AddGoDoc) Run(config *Config) *Result {
 		return &r.Result
 	}
 
-	r.removeSemicolons()
-	r.addComments()
-	r.FormatFileInEditor()
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+	r.templates = config.Templates
+
+	packageMode := false
+	if len(config.Args) > 0 {
+		packageMode = config.Args[0].(bool)
+	}
+	if len(config.Args) > 1 {
+		if path := strings.TrimSpace(config.Args[1].(string)); path != "" {
+			if !r.readExclusions(config.FileSystem, path) {
+				return &r.Result
+			}
+		}
+	}
+
+	if !packageMode {
+		if r.isExcludedFile(r.Filename) {
+			r.Log.Infof("%s is in an excluded directory; no comments were added",
+				filepath.Base(r.Filename))
+			return &r.Result
+		}
+		r.commentFile(r.File, r.Filename)
+		r.formatFile(r.Filename, r.FileContents)
+		r.UpdateLog(config, false)
+		return &r.Result
+	}
+
+	files := r.packageFiles()
+	filenames := make([]string, 0, len(files))
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		file := files[filename]
+		if r.isExcludedFile(filename) {
+			continue
+		}
+		contents, err := r.files.read(filename)
+		if err != nil {
+			r.Log.Error(err)
+			return &r.Result
+		}
+		if r.Edits[filename] == nil {
+			r.Edits[filename] = text.NewEditSet()
+			r.Edits[filename].SetBase(contents)
+		}
+		r.commentFile(file, filename)
+		// Only reformat files that were changed, so that bootstrapping
+		// comments for a package does not touch unrelated files
+		if r.Edits[filename].Len() > 0 {
+			r.formatFile(filename, contents)
+		} else if filename != r.Filename {
+			delete(r.Edits, filename)
+		}
+	}
+	r.UpdateLog(config, false)
 	return &r.Result
 }
 
+// formatFile formats the given file (with the given contents) in its entirety
+// (see FormatFile), so that documenting a file also normalizes its formatting,
+// even where no comments were added.  The file must have an entry in r.Edits.
+func (r *AddGoDoc) formatFile(filename string, contents []byte) {
+	r.postProcessFile(filename, contents, []PostProcessor{FormatFile{}})
+}
+
+// commentFile adds comments to the given file, recording edits in
+// r.Edits[filename].
+func (r *AddGoDoc) commentFile(file *ast.File, filename string) {
+	r.filename = filename
+	r.removeSemicolons(file)
+	r.addComments(file)
+}
+
+// packageFiles returns the files (keyed by filename) of the package
+// containing the file being refactored, including its test files if test
+// packages were loaded.  Only files in the scope are included.
+func (r *AddGoDoc) packageFiles() map[string]*ast.File {
+	dir := filepath.Dir(r.Filename)
+	result := map[string]*ast.File{}
+	for _, pkg := range r.Program.AllPackages {
+		for _, file := range pkg.Syntax {
+			filename := r.Program.Fset.Position(file.Pos()).Filename
+			if filepath.Dir(filename) == dir {
+				result[filename] = file
+			}
+		}
+	}
+	return result
+}
+
+// readExclusions reads the exclusions file at the given path (which, if
+// relative, is relative to the directory containing the file being
+// refactored).  Each line of the file is either a regular expression matching
+// declaration names that should not be commented (e.g., ^Test or ^mock), or a
+// directory (ending with a slash) whose files should be skipped.  Directories
+// are relative to the directory containing the exclusions file.  Blank lines
+// and lines beginning with # are ignored.  It logs an error and returns false
+// if the file cannot be read or contains an invalid regular expression.
+func (r *AddGoDoc) readExclusions(fs filesystem.FileSystem, path string) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(r.Filename), path)
+	}
+	reader, err := fs.OpenFile(path)
+	if err != nil {
+		r.Log.Error(err)
+		return false
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasSuffix(line, "/"):
+			dir := filepath.FromSlash(line)
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(filepath.Dir(path), dir)
+			}
+			r.excludeDirs = append(r.excludeDirs, absPath(dir))
+		default:
+			re, err := regexp.Compile(line)
+			if err != nil {
+				r.Log.Errorf("%s:%d: invalid regular expression: %v",
+					filepath.Base(path), lineNum, err)
+				return false
+			}
+			r.excludeNames = append(r.excludeNames, re)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		r.Log.Error(err)
+		return false
+	}
+	return true
+}
+
+// isExcludedFile returns true if the given file is in an excluded directory
+// (or one of its subdirectories).
+func (r *AddGoDoc) isExcludedFile(filename string) bool {
+	filename = absPath(filename)
+	for _, dir := range r.excludeDirs {
+		rel, err := filepath.Rel(dir, filename)
+		if err == nil && rel != ".." &&
+			!strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcludedName returns true if the given declaration name matches one of the
+// excluded name patterns.
+func (r *AddGoDoc) isExcludedName(name string) bool {
+	for _, re := range r.excludeNames {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsComment returns true if a declaration with the given name should be
+// commented: i.e., it is exported and not excluded.
+func (r *AddGoDoc) needsComment(name string) bool {
+	return ast.IsExported(name) && !r.isExcludedName(name)
+}
+
+// allExportedSpecsExcluded returns true if the given declaration contains at
+// least one exported spec and the names of all such specs are excluded.
+func (r *AddGoDoc) allExportedSpecsExcluded(decl *ast.GenDecl) bool {
+	exported := false
+	for _, spec := range decl.Specs {
+		if name := getName(spec); ast.IsExported(name) {
+			if !r.isExcludedName(name) {
+				return false
+			}
+			exported = true
+		}
+	}
+	return exported
+}
+
+// receiverTypeName returns the name of the receiver's base type if the given
+// declaration is a method, or the empty string otherwise.
+func receiverTypeName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return ""
+	}
+	typ := decl.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// absPath returns an absolute representation of the given path, or the
+// cleaned path if it cannot be made absolute.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
 // removeSemicolons iterates through the top-level declarations in a File and
 // the specs of general declarations, and if two consecutive declarations occur
 // on the same line, splits them onto separate lines.  The intention is to
 // split semicolon-separated declarations onto separate lines.
-func (r *AddGoDoc) removeSemicolons() {
-	for i, d := range r.File.Decls {
+func (r *AddGoDoc) removeSemicolons(file *ast.File) {
+	for i, d := range file.Decls {
 		if i > 0 {
-			r.removeSemicolonBetween(r.File.Decls[i-1], r.File.Decls[i], "\n\n")
+			r.removeSemicolonBetween(file.Decls[i-1], file.Decls[i], "\n\n")
 		}
 		if decl, ok := d.(*ast.GenDecl); ok {
 			for j, spec := range decl.Specs {
 				if spec, ok := spec.(*ast.TypeSpec); ok {
-					if ast.IsExported(spec.Name.Name) && spec.Doc == nil && j > 0 {
+					if r.needsComment(spec.Name.Name) && spec.Doc == nil && j > 0 {
 						r.removeSemicolonBetween(decl.Specs[j-1], decl.Specs[j], "\n")
 					}
 				}
@@ -79,17 +305,20 @@ func (r *AddGoDoc) removeSemicolonBetween(node1, node2 ast.Node, replacement str
 		// but this should occur rarely enough we'll ignore it for now.
 		offset := r.Program.Fset.Position(node1.End()).Offset
 		length := r.Program.Fset.Position(node2.Pos()).Offset - offset
-		r.Edits[r.Filename].Add(&text.Extent{offset, length}, replacement)
+		r.Edits[r.filename].Add(&text.Extent{offset, length}, replacement)
 	}
 }
 
 // addComments inserts a comment immediately before all exported top-level
-// declarations that do not already have an associated doc comment
-func (r *AddGoDoc) addComments() {
-	for _, d := range r.File.Decls {
+// declarations that do not already have an associated doc comment (except
+// those with excluded names, or methods whose receiver type is excluded)
+func (r *AddGoDoc) addComments(file *ast.File) {
+	for _, d := range file.Decls {
 		switch decl := d.(type) {
 		case *ast.FuncDecl: // function or method declaration
-			if ast.IsExported(decl.Name.Name) && decl.Doc == nil {
+			recvType := receiverTypeName(decl)
+			if r.needsComment(decl.Name.Name) && decl.Doc == nil &&
+				(recvType == "" || !r.isExcludedName(recvType)) {
 				r.addComment(decl, decl.Name.Name) //, 1)
 			}
 		case *ast.GenDecl: // type and value declarations
@@ -103,12 +332,39 @@ func (r *AddGoDoc) addComments() {
 	}
 }
 
-// addComment inserts the given comment string immediately before the given
-// declaration
-func (r *AddGoDoc) addComment(decl ast.Node, comment string) {
-	comment = "// " + comment + " TODO: NEEDS COMMENT INFO\n"
-	insertOffset := r.Program.Fset.Position(decl.Pos()).Offset
-	r.Edits[r.Filename].Add(&text.Extent{insertOffset, 0}, comment)
+// addComment inserts a stub comment for the declaration with the given name
+// immediately before the given declaration.  The comment is wrapped (see
+// text.ReflowComment) if the stub is too long to fit on one line.
+func (r *AddGoDoc) addComment(decl ast.Node, name string) {
+	pos := r.Program.Fset.Position(decl.Pos())
+	indent := ""
+	if contents, err := r.files.read(r.filename); err == nil &&
+		pos.Offset <= len(contents) && pos.Column > 0 {
+		indent = string(contents[pos.Offset-(pos.Column-1) : pos.Offset])
+		if strings.TrimSpace(indent) != "" {
+			indent = ""
+		}
+	}
+	comment, err := docCommentStub(decl, name, indent, r.templates)
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	r.Edits[r.filename].Add(&text.Extent{pos.Offset, 0}, comment+"\n")
+}
+
+// docCommentStub returns a doc comment for the declaration with the given
+// name, generated by the DocCommentTemplate (by default, a TODO comment
+// beginning with docStub) and wrapped to fit on lines beginning with the
+// given indentation.  The result does not end with a newline.
+func docCommentStub(decl ast.Node, name, indent string, templates CodeTemplates) (string, error) {
+	comment, err := executeTemplate(templates, DocCommentTemplate,
+		DocCommentData{Name: name, Stub: docStub(decl, name)})
+	if err != nil {
+		return "", err
+	}
+	return text.ReflowComment(commentLines(comment), indent,
+		text.DefaultCommentColumn), nil
 }
 
 // addCommentToGenDecl adds doc comments to a GenDecl (var, type, or const).
@@ -130,13 +386,13 @@ func (r *AddGoDoc) addCommentToGenDecl(decl *ast.GenDecl) {
 			for name, spec := range s {
 				r.addComment(spec, name)
 			}
-		} else {
+		} else if !r.allExportedSpecsExcluded(decl) {
 			r.addComment(decl, "")
 		}
 	} else {
 		// Only one declaration
 		name := getName(decl.Specs[0])
-		if ast.IsExported(name) && decl.Doc == nil {
+		if r.needsComment(name) && decl.Doc == nil {
 			r.addComment(decl, name)
 		}
 	}
@@ -152,6 +408,9 @@ func (r *AddGoDoc) collectSpecsWithoutDoc(decl *ast.GenDecl) (bool, map[string]a
 		name := getName(spec)
 		if ast.IsExported(name) {
 			if !hasDoc(spec) {
+				if r.isExcludedName(name) {
+					continue
+				}
 				specs[name] = spec
 			} else {
 				// They're commenting individual specs; we should too
@@ -184,16 +443,152 @@ func hasDoc(spec ast.Spec) bool {
 	}
 }
 
+// Words that indicate that the first word of a function name is not a verb
+// (e.g., ToUpper or MaxLen), or that the remaining words are not a noun
+// phrase (e.g., ReadAll or WriteTo)
+var godocNonNouns = map[string]bool{
+	"All": true, "And": true, "As": true, "At": true, "By": true,
+	"Default": true, "For": true, "From": true, "In": true, "Max": true,
+	"Min": true, "Must": true, "Of": true, "On": true, "Or": true,
+	"To": true, "With": true,
+}
+
+// docStub returns the beginning of a doc comment for the given declaration
+// with the given name.  If the name consists of several words (see
+// names.SplitIdentifier), this is a sentence built from those words, e.g.,
+// "ParseHTTPRequest parses an HTTP request."  Otherwise, it is just the name.
+func docStub(decl ast.Node, name string) string {
+	words := names.SplitIdentifier(name)
+	if len(words) < 2 {
+		return name
+	}
+	predicate := ""
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		predicate = funcDocPredicate(words)
+	case *ast.TypeSpec:
+		predicate = "is " + withArticle(words)
+	case *ast.ValueSpec:
+		predicate = "is the " + nounPhrase(words)
+	case *ast.GenDecl:
+		if decl.Tok == token.TYPE {
+			predicate = "is " + withArticle(words)
+		} else {
+			predicate = "is the " + nounPhrase(words)
+		}
+	}
+	if predicate == "" {
+		return name
+	}
+	return name + " " + predicate + "."
+}
+
+// funcDocPredicate returns the predicate of a sentence describing a function
+// whose name consists of the given words, assuming the first word is a verb,
+// e.g., "parses an HTTP request" for ParseHTTPRequest.  It returns "" if the
+// first word does not appear to be a verb.
+func funcDocPredicate(words []string) string {
+	verb, rest := words[0], words[1:]
+	switch verb {
+	case "New":
+		return "returns " + withArticle(append([]string{"new"}, rest...))
+	case "Is", "Has", "Can":
+		return "reports whether it " + strings.ToLower(verb) + " " +
+			nounPhrase(rest)
+	}
+	if godocNonNouns[verb] || names.IsInitialism(verb) {
+		return ""
+	}
+	return thirdPerson(strings.ToLower(verb)) + " " + withArticle(rest)
+}
+
+// thirdPerson returns the third-person singular form of the given verb,
+// e.g., "parses" for "parse" or "copies" for "copy".
+func thirdPerson(verb string) string {
+	switch {
+	case strings.HasSuffix(verb, "s"), strings.HasSuffix(verb, "x"),
+		strings.HasSuffix(verb, "z"), strings.HasSuffix(verb, "ch"),
+		strings.HasSuffix(verb, "sh"), strings.HasSuffix(verb, "o"):
+		return verb + "es"
+	case len(verb) > 1 && strings.HasSuffix(verb, "y") &&
+		!strings.ContainsRune("aeiou", rune(verb[len(verb)-2])):
+		return verb[:len(verb)-1] + "ies"
+	default:
+		return verb + "s"
+	}
+}
+
+// nounPhrase joins the given words with spaces, converting them to lowercase
+// unless they are initialisms (e.g., "HTTP request" for HTTP and Request).
+func nounPhrase(words []string) string {
+	result := make([]string, 0, len(words))
+	for _, word := range words {
+		if !names.IsInitialism(word) &&
+			!names.IsInitialism(strings.TrimSuffix(word, "s")) {
+			word = strings.ToLower(word)
+		}
+		result = append(result, word)
+	}
+	return strings.Join(result, " ")
+}
+
+// withArticle returns the noun phrase for the given words (see nounPhrase)
+// preceded by "a" or "an", unless the phrase is plural or is not a noun
+// phrase (e.g., "all" in ReadAll).
+func withArticle(words []string) string {
+	phrase := nounPhrase(words)
+	last := words[len(words)-1]
+	if godocNonNouns[words[0]] || godocNonNouns[last] ||
+		strings.HasSuffix(last, "s") && !strings.HasSuffix(last, "ss") {
+		return phrase
+	}
+	first := words[0]
+	if names.IsInitialism(first) {
+		// Initialisms are usually read letter by letter
+		if strings.ContainsRune("AEFHILMNORSX", rune(first[0])) {
+			return "an " + phrase
+		}
+		return "a " + phrase
+	}
+	lower := strings.ToLower(first)
+	if strings.ContainsRune("aeio", rune(lower[0])) ||
+		strings.HasPrefix(lower, "un") || strings.HasPrefix(lower, "up") {
+		return "an " + phrase
+	}
+	return "a " + phrase
+}
+
 const godocDoc = `
   <h4>Purpose</h4>
   <p>This refactoring searches a file for exported declarations that do not have
   GoDoc comments and adds TODO comment stubs to those declarations.</p>
   <p>The refactored source code is formatted (similarly to gofmt).</p>
+  <p>When a name consists of several words (e.g., <tt>ParseHTTPRequest</tt>
+  or <tt>max_len</tt>), the stub begins with a sentence formed from those
+  words, such as "ParseHTTPRequest parses an HTTP request."  This is only a
+  starting point; the sentence should be checked and completed.</p>
+  <p>The text of the stubs can be changed to follow a project's conventions
+  by overriding the <tt>docComment</tt> template (from the command line,
+  with the <tt>-templates</tt> flag).</p>
 
   <h4>Usage</h4>
   <p>This refactoring is applied to an entire file.  It does not require any
-  particular text to be selected, and it does not prompt for any additional user
-  input.</p>
+  particular text to be selected.</p>
+  <p>If <i>Package Mode</i> is selected, comments are added to every file in
+  the package containing the file (including test files), rather than only
+  that file.  Only files in the refactoring scope are changed, so the scope
+  should include the entire package.  (Files that do not need comments are
+  left unchanged.)</p>
+  <p>Optionally, an <i>Exclusions File</i> can be given, which lists
+  declarations and directories that should not be commented; this is useful
+  when adding comments throughout a code base, so that test helpers and mocks
+  are not annotated.  A relative path is relative to the directory containing
+  the file being refactored.  Each line of the exclusions file is either a
+  regular expression matching declaration names (e.g., <tt>^Test</tt> or
+  <tt>^mock</tt>) or a directory ending with a slash (e.g.,
+  <tt>mocks/</tt>), which is relative to the directory containing the
+  exclusions file.  Blank lines and lines beginning with <tt>#</tt> are
+  ignored.  Methods are also skipped when their receiver type is excluded.</p>
 
   <h4>Example</h4>
   <p>In the following example, Exported, Shaper, and Rectangle are all exported
@@ -0,0 +1,181 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestPackageInGoPath(t *testing.T) {
+	gopath, err := filepath.Abs("gopath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+
+	assertPackageInGoPath(t, filepath.Join(src, "a", "b", "c.go"), gopath, "a/b")
+	assertPackageInGoPath(t, filepath.Join(src, "..a", "c.go"), gopath, "..a")
+	assertPackageInGoPath(t, filepath.Join(src, "c.go"), gopath, "")
+	assertPackageInGoPath(t, filepath.Join(gopath, "c.go"), gopath, "")
+	assertPackageInGoPath(t, filepath.Join(gopath, "pkg", "a", "c.go"), gopath, "")
+}
+
+// assertPackageInGoPath marks a test as having failed unless
+// packageInGoPath(absFilename, gopath) returns the package expected, or
+// returns false if expected is "".
+func assertPackageInGoPath(t *testing.T, absFilename, gopath, expected string) {
+	pkg, ok := packageInGoPath(absFilename, gopath)
+	if expected == "" && ok {
+		t.Errorf("%s should not be in a package in %s (found %s)",
+			absFilename, gopath, pkg)
+	} else if expected != "" && (!ok || pkg != expected) {
+		t.Errorf("%s should be in package %s in %s (found %s)",
+			absFilename, expected, gopath, pkg)
+	}
+}
+
+func TestGoVersionAtLeast(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sub := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gomod := "module example.com/m\n\ngo 1.21.3\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, minor := range []int{14, 21} {
+		if ok, version := goVersionAtLeast(sub, minor); !ok || version != "1.21.3" {
+			t.Errorf("Go 1.%d: expected true, 1.21.3; got %t, %s", minor, ok, version)
+		}
+	}
+	if ok, _ := goVersionAtLeast(sub, 23); ok {
+		t.Errorf("Go 1.23 should not be allowed by go 1.21.3")
+	}
+
+	for version, expected := range map[string]int{
+		"1.21": 21, "1.21.3": 21, "1.22rc1": 22, "2.0": -1, "go1.21": -1, "": -1,
+	} {
+		if minor := goMinorVersion(version); minor != expected {
+			t.Errorf("goMinorVersion(%q): expected %d, got %d", version, expected, minor)
+		}
+	}
+}
+
+func TestRenameExpandsGuessedScope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for file, contents := range map[string]string{
+		"go.mod":      "module example.com/m\n\ngo 1.14\n",
+		"lib/lib.go":  "package lib\n\nfunc Hello() string { return hello }\n\nvar hello = \"hi\"\n",
+		"cmd/main.go": "package main\n\nimport \"example.com/m/lib\"\n\nfunc main() { println(lib.Hello()) }\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	libFile := filepath.Join(dir, "lib", "lib.go")
+
+	rename := func(line, col int) *Result {
+		config := &Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Selection: &text.LineColSelection{
+				Filename:  libFile,
+				StartLine: line, StartCol: col,
+				EndLine: line, EndCol: col,
+			},
+			Args: []interface{}{"Greet"},
+		}
+		result := new(Rename).Run(config)
+		if result.Log.ContainsErrors() {
+			t.Fatal(result.Log)
+		}
+		if config.Scope != nil || config.Dir != "" {
+			t.Fatalf("The expanded scope should not be stored in the "+
+				"Config (Scope %v, Dir %q)", config.Scope, config.Dir)
+		}
+		return result
+	}
+
+	// Hello is exported, so the rename must include cmd/main.go
+	result := rename(3, 6)
+	if !strings.Contains(result.Log.String(), "expanding the scope") {
+		t.Errorf("Expected a message about expanding the scope:\n%s",
+			result.Log)
+	}
+	if _, ok := result.Edits[filepath.Join(dir, "cmd", "main.go")]; !ok {
+		t.Errorf("Renaming an exported function should change its callers")
+	}
+
+	// hello is unexported, so only its package is loaded
+	result = rename(5, 5)
+	if strings.Contains(result.Log.String(), "expanding the scope") {
+		t.Errorf("The scope should not be expanded:\n%s", result.Log)
+	}
+}
+
+func TestGuessedScopeLeavesConfigUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for file, contents := range map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.14\n",
+		"a/a.go": "package a\n\nfunc A() {}\n",
+		"b/b.go": "package b\n\nfunc B() {}\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The same Config is reused for files in different packages, so the
+	// scope guessed for the first must not be used for the second
+	config := &Config{
+		FileSystem: &filesystem.LocalFileSystem{},
+		Args:       []interface{}{false},
+	}
+	for _, pkg := range []string{"a", "b"} {
+		config.Selection = &text.LineColSelection{
+			Filename:  filepath.Join(dir, pkg, pkg+".go"),
+			StartLine: 3, StartCol: 6,
+			EndLine: 3, EndCol: 6,
+		}
+		result := new(Null).Run(config)
+		if result.Log.ContainsErrors() {
+			t.Fatalf("%s: %s", pkg, result.Log)
+		}
+		if config.Scope != nil || config.Dir != "" {
+			t.Fatalf("%s: the Config should not have been changed "+
+				"(Scope %v, Dir %q)", pkg, config.Scope, config.Dir)
+		}
+	}
+}
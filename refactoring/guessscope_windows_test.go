@@ -0,0 +1,16 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import "testing"
+
+func TestPackageInGoPathWindows(t *testing.T) {
+	assertPackageInGoPath(t, `C:\go\src\a\b\c.go`, `C:\go`, "a/b")
+	assertPackageInGoPath(t, `c:\GO\src\a\b\c.go`, `C:\go`, "a/b")
+	assertPackageInGoPath(t, `D:\go\src\a\b\c.go`, `C:\go`, "")
+	assertPackageInGoPath(t, `C:\go\c.go`, `C:\go`, "")
+	assertPackageInGoPath(t, `\\server\share\go\src\a\c.go`, `\\server\share\go`, "a")
+	assertPackageInGoPath(t, `\\server\share\go\src\a\c.go`, `C:\go`, "")
+}
@@ -0,0 +1,152 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines utilities for determining the header comments (e.g., a
+// copyright notice and build constraints) of a file created by a
+// refactoring, so that new files pass the same license checks as the files
+// they are created from.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// A fileHeader contains the comments preceding the package clause (and the
+// package doc comment, if any) of a Go source file.
+type fileHeader struct {
+	text        string // the entire header, with surrounding space trimmed
+	license     string // comments other than build constraints
+	constraints string // build constraints (//go:build and // +build lines)
+}
+
+// readFileHeader returns the header of the given file, whose contents are
+// given.
+func readFileHeader(fset *token.FileSet, file *ast.File, contents []byte) *fileHeader {
+	headerEnd := file.Package
+	if file.Doc != nil {
+		headerEnd = file.Doc.Pos()
+	}
+	h := &fileHeader{
+		text: strings.TrimSpace(string(contents[:fset.Position(headerEnd).Offset])),
+	}
+	license, constraints := []string{}, []string{}
+	for _, cg := range file.Comments {
+		if cg.End() > headerEnd {
+			break
+		}
+		text := string(contents[fset.Position(cg.Pos()).Offset:fset.Position(cg.End()).Offset])
+		if isBuildConstraint(cg) {
+			constraints = append(constraints, text)
+		} else {
+			license = append(license, text)
+		}
+	}
+	h.license = strings.Join(license, "\n\n")
+	h.constraints = strings.Join(constraints, "\n\n")
+	return h
+}
+
+// isBuildConstraint returns true if every comment in the given group is a
+// build constraint.
+func isBuildConstraint(cg *ast.CommentGroup) bool {
+	for _, c := range cg.List {
+		if !strings.HasPrefix(c.Text, "//go:build") &&
+			!strings.HasPrefix(c.Text, "// +build") {
+			return false
+		}
+	}
+	return true
+}
+
+// commentText converts a license header template to a comment: if it does
+// not already consist of comments, each line is prefixed with "// ".
+func commentText(template string) string {
+	template = strings.TrimSpace(template)
+	if template == "" || strings.HasPrefix(template, "//") ||
+		strings.HasPrefix(template, "/*") {
+		return template
+	}
+	lines := strings.Split(template, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("// "+line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// newFileHeader returns the header comments for a new file containing code
+// moved or generated from the given file.  The header consists of the given
+// file's build constraints, together with a license header, which is
+// determined as follows:
+//   - If the template is non-empty, it is used as the license header.
+//   - Otherwise, if the given file has a license header, its entire header
+//     is copied as-is.
+//   - Otherwise, the license header of another file in the package is used
+//     (see packageLicenseHeader).
+func (r *RefactoringBase) newFileHeader(files *sourceFiles, file *ast.File, template string) string {
+	filename := r.Program.Fset.Position(file.Pos()).Filename
+	contents, err := files.read(filename)
+	if err != nil {
+		return ""
+	}
+	header := readFileHeader(r.Program.Fset, file, contents)
+	license := commentText(template)
+	if license == "" {
+		if header.license != "" {
+			return header.text
+		}
+		license = packageLicenseHeader(files, filename, file.Name.Name)
+	}
+
+	parts := []string{}
+	if strings.HasPrefix(license, "/*") {
+		// Build constraints may only be preceded by line comments
+		parts = append(parts, header.constraints, license)
+	} else {
+		parts = append(parts, license, header.constraints)
+	}
+	result := []string{}
+	for _, part := range parts {
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+	return strings.Join(result, "\n\n")
+}
+
+// packageLicenseHeader returns the license header of the first Go file in
+// the same directory as the given file and in the same package (other than
+// the given file itself) that has one, in order by filename, or "" if no
+// such file has a license header.
+func packageLicenseHeader(files *sourceFiles, filename, pkgName string) string {
+	infos, err := files.fileSystem.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		return ""
+	}
+	for _, info := range infos {
+		name := filepath.Join(filepath.Dir(filename), info.Name())
+		if info.IsDir() || filepath.Ext(name) != ".go" ||
+			info.Name() == filepath.Base(filename) {
+			continue
+		}
+		contents, err := files.read(name)
+		if err != nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, name, contents,
+			parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil || f.Name.Name != pkgName {
+			continue
+		}
+		if h := readFileHeader(fset, f, contents); h.license != "" {
+			return h.license
+		}
+	}
+	return ""
+}
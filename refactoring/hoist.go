@@ -0,0 +1,913 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a refactoring that hoists a repeated subexpression in a
+// function into a local variable.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/godoctor/godoctor/analysis/cfg"
+	"github.com/godoctor/godoctor/analysis/dataflow"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// The HoistSubexpr refactoring finds repeated occurrences of a pure
+// subexpression in a function (e.g., len(s)-1), assigns its value to a new
+// local variable at the earliest point that dominates all of the occurrences,
+// and replaces each occurrence with a use of that variable.
+//
+// If the selection is not an expression in a function body (e.g., if the
+// function's name is selected), the repeated subexpressions in the function
+// are reported, and no changes are made.
+type HoistSubexpr struct {
+	RefactoringBase
+	varName  string
+	funcDecl *ast.FuncDecl
+	cfg      *cfg.CFG
+	blocks   map[ast.Stmt]struct{}
+	// Local variables that may be modified without an assignment to the
+	// variable appearing in the CFG (i.e., whose address is taken or
+	// which are assigned in a function literal)
+	unsafeVars map[*types.Var]struct{}
+	// Caches for reaching definitions and the variables each statement
+	// defines
+	reaching map[ast.Stmt]map[ast.Stmt]struct{}
+	defs     map[ast.Stmt]map[*types.Var]struct{}
+}
+
+// A hoistGroup is a set of occurrences of an expression, all of which compute
+// the same value.
+type hoistGroup struct {
+	occs         []ast.Expr // in source order
+	vars         []*types.Var
+	insertBefore ast.Stmt
+}
+
+func (r *HoistSubexpr) Description() *Description {
+	return &Description{
+		Name:      "Hoist Common Subexpression",
+		Synopsis:  "Assigns a repeated expression to a local variable",
+		Usage:     "<new_name>",
+		HTMLDoc:   hoistSubexprDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Name: ",
+			Prompt:       "Enter a name for the new variable.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+		Quality:        Testing,
+	}
+}
+
+func (r *HoistSubexpr) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.varName = config.Args[0].(string)
+	r.funcDecl = nil
+	for _, node := range r.PathEnclosingSelection {
+		if decl, ok := node.(*ast.FuncDecl); ok {
+			r.funcDecl = decl
+			break
+		}
+	}
+	if r.funcDecl == nil || r.funcDecl.Body == nil {
+		r.Log.Error("Please select an expression in a function body.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return &r.Result
+	}
+	if r.containsGoto() {
+		r.Log.Error("Functions containing goto statements are not supported.")
+		r.Log.AssociateNode(r.funcDecl.Name)
+		return &r.Result
+	}
+	r.analyzeFunc()
+
+	expr, isExpr := r.SelectedNode.(ast.Expr)
+	if !isExpr || expr == r.funcDecl.Name ||
+		!(r.funcDecl.Body.Pos() <= expr.Pos() && expr.End() <= r.funcDecl.Body.End()) {
+		r.reportRepeatedExprs()
+		return &r.Result
+	}
+
+	if !isIdentifierValid(r.varName) || r.varName == "_" {
+		r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
+			r.varName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return &r.Result
+	}
+	group := r.selectedGroup(astutil.Unparen(expr))
+	if group == nil || !r.checkForNameConflict() {
+		return &r.Result
+	}
+	r.addEdits(group)
+	r.UpdateLog(config, false)
+	return &r.Result
+}
+
+// analyzeFunc builds the control flow graph of r.funcDecl and initializes
+// the dataflow information computed from it.
+func (r *HoistSubexpr) analyzeFunc() {
+	r.cfg = cfg.FromFunc(r.funcDecl)
+	r.blocks = map[ast.Stmt]struct{}{}
+	for _, stmt := range r.cfg.Blocks() {
+		r.blocks[stmt] = struct{}{}
+	}
+	r.unsafeVars = r.findUnsafeVars()
+	r.reaching = map[ast.Stmt]map[ast.Stmt]struct{}{}
+	r.defs = map[ast.Stmt]map[*types.Var]struct{}{}
+}
+
+// containsGoto returns true if the function contains a goto statement, since
+// inserting a variable declaration could cause a goto to jump over it.
+func (r *HoistSubexpr) containsGoto() bool {
+	found := false
+	ast.Inspect(r.funcDecl.Body, func(n ast.Node) bool {
+		if br, ok := n.(*ast.BranchStmt); ok && br.Tok == token.GOTO {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// findUnsafeVars returns the local variables whose address is taken
+// (explicitly or by calling a method with a pointer receiver) or which are
+// assigned in a function literal.  Such variables may change without the
+// change being visible in the function's control flow graph.
+func (r *HoistSubexpr) findUnsafeVars() map[*types.Var]struct{} {
+	info := r.SelectedNodePkg.TypesInfo
+	result := map[*types.Var]struct{}{}
+	add := func(expr ast.Expr) {
+		for {
+			switch e := expr.(type) {
+			case *ast.ParenExpr:
+				expr = e.X
+				continue
+			case *ast.SelectorExpr:
+				expr = e.X
+				continue
+			case *ast.IndexExpr:
+				expr = e.X
+				continue
+			case *ast.Ident:
+				if v, ok := info.ObjectOf(e).(*types.Var); ok {
+					result[v] = struct{}{}
+				}
+			}
+			return
+		}
+	}
+	var visit func(n ast.Node, inFuncLit bool) bool
+	visit = func(n ast.Node, inFuncLit bool) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			ast.Inspect(n.Body, func(n ast.Node) bool {
+				return visit(n, true)
+			})
+			return false
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				add(n.X)
+			}
+		case *ast.SelectorExpr:
+			if sel, ok := info.Selections[n]; ok && sel.Kind() == types.MethodVal {
+				recv := sel.Obj().Type().(*types.Signature).Recv()
+				if _, ptr := recv.Type().(*types.Pointer); ptr {
+					add(n.X)
+				}
+			}
+		case *ast.AssignStmt:
+			if inFuncLit {
+				for _, lhs := range n.Lhs {
+					add(lhs)
+				}
+			}
+		case *ast.IncDecStmt:
+			if inFuncLit {
+				add(n.X)
+			}
+		case *ast.RangeStmt:
+			if inFuncLit {
+				if n.Key != nil {
+					add(n.Key)
+				}
+				if n.Value != nil {
+					add(n.Value)
+				}
+			}
+		}
+		return true
+	}
+	ast.Inspect(r.funcDecl, func(n ast.Node) bool {
+		return visit(n, false)
+	})
+	return result
+}
+
+// selectedGroup returns the group of occurrences of the selected expression
+// that compute the same value as it, logging an error and returning nil if
+// the selected expression cannot be hoisted.
+func (r *HoistSubexpr) selectedGroup(expr ast.Expr) *hoistGroup {
+	if r.isTrivial(expr) {
+		r.Log.Error("Please select an expression containing an operator, a conversion, or a call to len or cap.")
+		r.Log.AssociateNode(expr)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return nil
+	}
+	if r.isConstant(expr) {
+		r.Log.Error("The selected expression is a constant; it does not need to be hoisted.")
+		r.Log.AssociateNode(expr)
+		return nil
+	}
+	for _, node := range r.PathEnclosingSelection {
+		if _, ok := node.(*ast.FuncLit); ok {
+			r.Log.Error("Expressions in function literals cannot be hoisted.")
+			r.Log.AssociateNode(expr)
+			return nil
+		}
+	}
+	key, ok := r.exprKey(expr)
+	if !ok {
+		r.Log.Error("The selected expression cannot be hoisted, since it may have side effects, it may panic, or its value may change without an assignment to a local variable.")
+		r.Log.AssociateNode(expr)
+		return nil
+	}
+	if r.enclosingBlock(expr) == nil {
+		r.Log.Error("The selected expression is not evaluated where its declaration could be inserted (e.g., it is in a defer statement).")
+		r.Log.AssociateNode(expr)
+		return nil
+	}
+
+	occs := r.exprsByKey()[key]
+	var selected []ast.Expr
+	for _, occs := range r.partitionByValue(occs) {
+		for _, occ := range occs {
+			if occ == expr {
+				selected = occs
+			}
+		}
+	}
+	if len(selected) < 2 {
+		r.Log.Error("The selected expression does not occur elsewhere in the function with the same value.")
+		r.Log.AssociateNode(expr)
+		return nil
+	}
+	group, reason := r.checkGroup(selected)
+	if group == nil {
+		r.Log.Error(reason)
+		r.Log.AssociateNode(expr)
+		return nil
+	}
+	return group
+}
+
+// reportRepeatedExprs logs an informational message for each repeated
+// subexpression in the function that can be hoisted.
+func (r *HoistSubexpr) reportRepeatedExprs() {
+	groups := []*hoistGroup{}
+	for _, occs := range r.exprsByKey() {
+		for _, occs := range r.partitionByValue(occs) {
+			if len(occs) < 2 {
+				continue
+			}
+			if group, _ := r.checkGroup(occs); group != nil {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	// Omit subexpressions that are only repeated as parts of a larger
+	// repeated expression (e.g., len(s) in len(s)-1)
+	result := []*hoistGroup{}
+	for _, group := range groups {
+		if !isSubsumed(group, groups) {
+			result = append(result, group)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].occs[0].Pos() < result[j].occs[0].Pos()
+	})
+
+	if len(result) == 0 {
+		r.Log.Infof("No repeated subexpressions were found in %s.",
+			r.funcDecl.Name.Name)
+		return
+	}
+	for _, group := range result {
+		r.Log.Infof("%s is computed %d times in %s; select it to hoist it into a local variable.",
+			r.nodeText(group.occs[0]), len(group.occs), r.funcDecl.Name.Name)
+		r.Log.AssociateNode(group.occs[0])
+		for _, occ := range group.occs[1:] {
+			r.Log.AddRelatedNode("also computed here", occ)
+		}
+	}
+}
+
+// isSubsumed returns true if every occurrence in the given group is nested
+// inside an occurrence of another group with the same number of occurrences.
+func isSubsumed(group *hoistGroup, groups []*hoistGroup) bool {
+	for _, other := range groups {
+		if other == group || len(other.occs) != len(group.occs) {
+			continue
+		}
+		subsumed := true
+		for i, occ := range group.occs {
+			outer := other.occs[i]
+			if occ == outer || occ.Pos() < outer.Pos() || occ.End() > outer.End() {
+				subsumed = false
+				break
+			}
+		}
+		if subsumed {
+			return true
+		}
+	}
+	return false
+}
+
+// exprsByKey returns the hoistable expressions in the function body (outside
+// of function literals and defer statements), grouped by exprKey, in source
+// order.
+func (r *HoistSubexpr) exprsByKey() map[string][]ast.Expr {
+	result := map[string][]ast.Expr{}
+	ast.Inspect(r.funcDecl.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit, *ast.DeferStmt:
+			return false
+		case *ast.ParenExpr:
+			return true
+		case ast.Expr:
+			if r.isTrivial(n) || r.isConstant(n) {
+				return true
+			}
+			if key, ok := r.exprKey(n); ok && r.enclosingBlock(n) != nil {
+				result[key] = append(result[key], n)
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// isTrivial returns true if the given expression is not worth hoisting (an
+// identifier, literal, or selector).
+func (r *HoistSubexpr) isTrivial(expr ast.Expr) bool {
+	switch astutil.Unparen(expr).(type) {
+	case *ast.Ident, *ast.BasicLit, *ast.SelectorExpr:
+		return true
+	default:
+		return false
+	}
+}
+
+// isConstant returns true if the given expression is a constant expression.
+func (r *HoistSubexpr) isConstant(expr ast.Expr) bool {
+	tv, ok := r.SelectedNodePkg.TypesInfo.Types[expr]
+	return ok && tv.Value != nil
+}
+
+// exprKey returns a string that is the same for two expressions if, and only
+// if, they are structurally identical and refer to the same objects.  It
+// returns false if the expression is not pure: i.e., if it may have side
+// effects, it may panic, or its value may change without an assignment to a
+// local variable appearing in the function's control flow graph.
+func (r *HoistSubexpr) exprKey(expr ast.Expr) (string, bool) {
+	var buf bytes.Buffer
+	ok := r.writeKey(&buf, expr)
+	return buf.String(), ok
+}
+
+func (r *HoistSubexpr) writeKey(buf *bytes.Buffer, expr ast.Expr) bool {
+	info := r.SelectedNodePkg.TypesInfo
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		buf.WriteString(e.Value)
+		return true
+
+	case *ast.Ident:
+		return r.writeObjKey(buf, e)
+
+	case *ast.ParenExpr:
+		return r.writeKey(buf, e.X)
+
+	case *ast.UnaryExpr:
+		switch e.Op {
+		case token.ADD, token.SUB, token.NOT, token.XOR:
+		default: // & and <-
+			return false
+		}
+		buf.WriteString("(" + e.Op.String())
+		ok := r.writeKey(buf, e.X)
+		buf.WriteString(")")
+		return ok
+
+	case *ast.BinaryExpr:
+		if !r.isSafeBinaryExpr(e) {
+			return false
+		}
+		buf.WriteString("(")
+		ok := r.writeKey(buf, e.X)
+		buf.WriteString(" " + e.Op.String() + " ")
+		ok = ok && r.writeKey(buf, e.Y)
+		buf.WriteString(")")
+		return ok
+
+	case *ast.SelectorExpr:
+		sel, ok := info.Selections[e]
+		if !ok { // Qualified identifier
+			return r.writeObjKey(buf, e.Sel)
+		}
+		// Fields reached through a pointer may be modified via aliases
+		if sel.Kind() != types.FieldVal || sel.Indirect() {
+			return false
+		}
+		buf.WriteString("(")
+		ok = r.writeKey(buf, e.X)
+		buf.WriteString("." + e.Sel.Name + ")")
+		return ok
+
+	case *ast.CallExpr:
+		if e.Ellipsis.IsValid() || len(e.Args) != 1 {
+			return false
+		}
+		fun := info.Types[e.Fun]
+		switch {
+		case fun.IsType():
+			if _, ok := fun.Type.Underlying().(*types.Pointer); ok {
+				return false
+			}
+			buf.WriteString("(" + types.TypeString(fun.Type, nil) + "(")
+		case fun.IsBuiltin():
+			id, ok := astutil.Unparen(e.Fun).(*ast.Ident)
+			if !ok || (id.Name != "len" && id.Name != "cap") {
+				return false
+			}
+			// The length of a map or channel may change without an
+			// assignment to the variable
+			switch info.TypeOf(e.Args[0]).Underlying().(type) {
+			case *types.Basic, *types.Slice, *types.Array:
+			default:
+				return false
+			}
+			buf.WriteString("(" + id.Name + "(")
+		default:
+			return false
+		}
+		ok := r.writeKey(buf, e.Args[0])
+		buf.WriteString("))")
+		return ok
+
+	default:
+		// Index and slice expressions, dereferences, type assertions,
+		// and function calls may panic or have side effects
+		return false
+	}
+}
+
+// writeObjKey writes a key for the object that the given identifier refers to,
+// returning false if it is not a constant or a local variable that can only
+// change by assignment.
+func (r *HoistSubexpr) writeObjKey(buf *bytes.Buffer, id *ast.Ident) bool {
+	obj := r.SelectedNodePkg.TypesInfo.ObjectOf(id)
+	switch obj := obj.(type) {
+	case *types.Const, *types.Nil:
+	case *types.Var:
+		if !r.isLocal(obj) {
+			return false
+		}
+		if _, unsafe := r.unsafeVars[obj]; unsafe {
+			return false
+		}
+	default:
+		return false
+	}
+	fmt.Fprintf(buf, "%s#%p", id.Name, obj)
+	return true
+}
+
+// isLocal returns true if the given variable is a local variable or a
+// parameter of the function being refactored.
+func (r *HoistSubexpr) isLocal(v *types.Var) bool {
+	return !v.IsField() &&
+		r.funcDecl.Pos() <= v.Pos() && v.Pos() < r.funcDecl.End()
+}
+
+// isSafeBinaryExpr returns true unless the given binary expression may panic
+// (i.e., integer division by a non-constant, a shift by a non-constant, or a
+// comparison of values that may contain interfaces).
+func (r *HoistSubexpr) isSafeBinaryExpr(e *ast.BinaryExpr) bool {
+	info := r.SelectedNodePkg.TypesInfo
+	switch e.Op {
+	case token.QUO, token.REM:
+		if basic, ok := info.TypeOf(e).Underlying().(*types.Basic); ok &&
+			basic.Info()&types.IsInteger != 0 {
+			return r.isConstant(e.Y)
+		}
+	case token.SHL, token.SHR:
+		return r.isConstant(e.Y)
+	case token.EQL, token.NEQ:
+		return !mayContainInterface(info.TypeOf(e.X)) &&
+			!mayContainInterface(info.TypeOf(e.Y))
+	}
+	return true
+}
+
+// mayContainInterface returns true if the given type is an interface, or an
+// array or struct containing an interface (whose comparison may panic).
+func mayContainInterface(t types.Type) bool {
+	switch t := t.Underlying().(type) {
+	case *types.Interface:
+		return true
+	case *types.Array:
+		return mayContainInterface(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if mayContainInterface(t.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enclosingBlock returns the innermost statement enclosing the given
+// expression that is a block in the control flow graph, or nil if there is
+// none (e.g., if the expression is in a defer statement).
+func (r *HoistSubexpr) enclosingBlock(expr ast.Expr) ast.Stmt {
+	path, _ := astutil.PathEnclosingInterval(r.File, expr.Pos(), expr.End())
+	for _, node := range path {
+		switch node := node.(type) {
+		case *ast.FuncLit, *ast.DeferStmt:
+			return nil
+		case ast.Stmt:
+			if _, ok := r.blocks[node]; ok {
+				return node
+			}
+		}
+	}
+	return nil
+}
+
+// partitionByValue partitions the given occurrences of an expression into
+// groups that are reached by the same definitions of the variables they use,
+// preserving source order.
+func (r *HoistSubexpr) partitionByValue(occs []ast.Expr) [][]ast.Expr {
+	if len(occs) == 0 {
+		return nil
+	}
+	vars := r.varsIn(occs[0])
+	result := [][]ast.Expr{}
+	index := map[string]int{}
+	for _, occ := range occs {
+		var sig bytes.Buffer
+		reaching := r.defsReaching(r.enclosingBlock(occ))
+		for _, v := range vars {
+			fmt.Fprintf(&sig, "%d:", v.Pos())
+			for _, def := range r.defsOf(v, reaching) {
+				fmt.Fprintf(&sig, " %d", def.Pos())
+			}
+			sig.WriteString(";")
+		}
+		if i, ok := index[sig.String()]; ok {
+			result[i] = append(result[i], occ)
+		} else {
+			index[sig.String()] = len(result)
+			result = append(result, []ast.Expr{occ})
+		}
+	}
+	return result
+}
+
+// checkGroup determines where a variable can be declared for the given
+// occurrences of an expression, which must compute the same value.  If the
+// expression cannot be hoisted, it returns nil and the reason.
+func (r *HoistSubexpr) checkGroup(occs []ast.Expr) (*hoistGroup, string) {
+	info := r.SelectedNodePkg.TypesInfo
+	typ := types.Default(info.TypeOf(occs[0]))
+	if e, ok := astutil.Unparen(occs[0]).(*ast.BinaryExpr); ok && isComparison(e.Op) &&
+		!types.Identical(typ, types.Typ[types.Bool]) {
+		return nil, fmt.Sprintf("The expression has type %s, which a short variable declaration cannot declare.", typ)
+	}
+	for _, occ := range occs[1:] {
+		if !types.Identical(typ, types.Default(info.TypeOf(occ))) {
+			return nil, "The occurrences of the expression do not all have the same type."
+		}
+	}
+
+	insertBefore := r.findStmtToInsertBefore(occs)
+	if insertBefore == nil {
+		return nil, "A variable declaration cannot be inserted at a point that precedes all occurrences of the expression."
+	}
+	group := &hoistGroup{
+		occs:         occs,
+		vars:         r.varsIn(occs[0]),
+		insertBefore: insertBefore,
+	}
+
+	scope := info.Scopes[r.funcDecl.Type].Innermost(insertBefore.Pos())
+	for _, v := range group.vars {
+		if _, obj := scope.LookupParent(v.Name(), insertBefore.Pos()); obj != v {
+			return nil, fmt.Sprintf("%s is not in scope where the variable would be declared.", v.Name())
+		}
+	}
+
+	// The variables used in the expression must have the same values
+	// where the declaration is inserted as they do at each occurrence
+	entry := insertBefore
+	switch s := insertBefore.(type) {
+	case *ast.IfStmt:
+		if s.Init != nil {
+			entry = s.Init
+		}
+	case *ast.ForStmt:
+		if s.Init != nil {
+			entry = s.Init
+		}
+	case *ast.SwitchStmt:
+		if s.Init != nil {
+			entry = s.Init
+		}
+	case *ast.TypeSwitchStmt:
+		if s.Init != nil {
+			entry = s.Init
+		}
+	}
+	// Definitions inside the statement can only reach its entry (e.g., a
+	// loop header) along a back edge, so they do not reach the
+	// declaration inserted before it
+	entryDefs := map[ast.Stmt]struct{}{}
+	for def := range r.defsReaching(entry) {
+		if !(insertBefore.Pos() <= def.Pos() && def.End() <= insertBefore.End()) {
+			entryDefs[def] = struct{}{}
+		}
+	}
+	for _, v := range group.vars {
+		want := r.defsOf(v, entryDefs)
+		for _, occ := range occs {
+			got := r.defsOf(v, r.defsReaching(r.enclosingBlock(occ)))
+			if !sameStmts(want, got) {
+				return nil, fmt.Sprintf("%s may be assigned a different value between the point where the variable would be declared and an occurrence of the expression.", v.Name())
+			}
+			for _, def := range r.cfg.Blocks() {
+				if _, ok := r.definedVars(def)[v]; ok &&
+					insertBefore.Pos() <= def.Pos() && def.Pos() < occ.Pos() &&
+					!(def.Pos() <= occ.Pos() && occ.End() <= def.End()) {
+					return nil, fmt.Sprintf("%s may be assigned a different value between the point where the variable would be declared and an occurrence of the expression.", v.Name())
+				}
+			}
+		}
+	}
+	return group, ""
+}
+
+func isComparison(op token.Token) bool {
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return true
+	default:
+		return false
+	}
+}
+
+// findStmtToInsertBefore returns the statement before which a declaration
+// can be inserted that precedes (and dominates) all of the given occurrences:
+// the first statement containing an occurrence in the innermost statement list
+// that contains all of them.
+func (r *HoistSubexpr) findStmtToInsertBefore(occs []ast.Expr) ast.Stmt {
+	path, _ := astutil.PathEnclosingInterval(r.File, occs[0].Pos(), occs[0].End())
+	for i, node := range path {
+		var list []ast.Stmt
+		switch node := node.(type) {
+		case *ast.BlockStmt:
+			if i+1 < len(path) {
+				switch path[i+1].(type) {
+				case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+					continue // Body is a list of clauses
+				}
+			}
+			list = node.List
+		case *ast.CaseClause:
+			list = node.Body
+		case *ast.CommClause:
+			list = node.Body
+		case *ast.FuncLit, *ast.FuncDecl:
+			return nil
+		default:
+			continue
+		}
+		if stmt := firstStmtContaining(list, occs); stmt != nil {
+			return stmt
+		}
+	}
+	return nil
+}
+
+// firstStmtContaining returns the first statement in the given list that
+// contains one of the given expressions, or nil if some expression is not
+// contained in a statement in the list.
+func firstStmtContaining(list []ast.Stmt, exprs []ast.Expr) ast.Stmt {
+	var first ast.Stmt
+	for _, expr := range exprs {
+		found := false
+		for _, stmt := range list {
+			if stmt.Pos() <= expr.Pos() && expr.End() <= stmt.End() {
+				if first == nil || stmt.Pos() < first.Pos() {
+					first = stmt
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return first
+}
+
+// varsIn returns the local variables used in the given expression, in order
+// of first use.
+func (r *HoistSubexpr) varsIn(expr ast.Expr) []*types.Var {
+	result := []*types.Var{}
+	seen := map[*types.Var]struct{}{}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if v, ok := r.SelectedNodePkg.TypesInfo.Uses[id].(*types.Var); ok {
+				if _, found := seen[v]; !found && !v.IsField() {
+					seen[v] = struct{}{}
+					result = append(result, v)
+				}
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// defsReaching returns the definitions reaching the given CFG block.
+func (r *HoistSubexpr) defsReaching(stmt ast.Stmt) map[ast.Stmt]struct{} {
+	if defs, ok := r.reaching[stmt]; ok {
+		return defs
+	}
+	defs := dataflow.DefsReaching(stmt, r.cfg, r.SelectedNodePkg)
+	r.reaching[stmt] = defs
+	return defs
+}
+
+// definedVars returns the local variables defined (declared or assigned) by
+// the given statement.
+func (r *HoistSubexpr) definedVars(stmt ast.Stmt) map[*types.Var]struct{} {
+	if vars, ok := r.defs[stmt]; ok {
+		return vars
+	}
+	asgt, updt, decl, _ := dataflow.ReferencedVars([]ast.Stmt{stmt}, r.SelectedNodePkg)
+	vars := map[*types.Var]struct{}{}
+	for _, set := range []map[*types.Var]struct{}{asgt, updt, decl} {
+		for v := range set {
+			vars[v] = struct{}{}
+		}
+	}
+	r.defs[stmt] = vars
+	return vars
+}
+
+// defsOf returns the statements in the given set that define the given
+// variable, sorted by position.
+func (r *HoistSubexpr) defsOf(v *types.Var, defs map[ast.Stmt]struct{}) []ast.Stmt {
+	result := []ast.Stmt{}
+	for def := range defs {
+		if _, ok := r.definedVars(def)[v]; ok {
+			result = append(result, def)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Pos() < result[j].Pos()
+	})
+	return result
+}
+
+func sameStmts(a, b []ast.Stmt) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkForNameConflict checks that the new variable's name is not used
+// anywhere in the function, so that declaring it will neither conflict with
+// nor shadow an existing declaration.
+func (r *HoistSubexpr) checkForNameConflict() bool {
+	var conflict *ast.Ident
+	ast.Inspect(r.funcDecl, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == r.varName {
+			conflict = id
+		}
+		return conflict == nil
+	})
+	if conflict != nil {
+		r.Log.Errorf("If a variable named %s is introduced, it will "+
+			"conflict with or shadow an existing declaration.", r.varName)
+		r.Log.AssociateNode(conflict)
+		return false
+	}
+	return true
+}
+
+// addEdits replaces each occurrence with the new variable and inserts its
+// declaration.
+func (r *HoistSubexpr) addEdits(group *hoistGroup) {
+	expr := r.nodeText(group.occs[0])
+	for _, occ := range group.occs {
+		r.Edits[r.Filename].Add(r.Extent(occ), r.varName)
+	}
+	offset := r.Program.Fset.Position(group.insertBefore.Pos()).Offset
+	r.Edits[r.Filename].Add(&text.Extent{offset, 0},
+		r.varName+" := "+expr+"\n")
+}
+
+// nodeText returns the source code for the given node.
+func (r *HoistSubexpr) nodeText(node ast.Node) string {
+	start := r.Program.Fset.Position(node.Pos()).Offset
+	end := r.Program.Fset.Position(node.End()).Offset
+	return string(r.FileContents[start:end])
+}
+
+const hoistSubexprDoc = `
+  <h4>Purpose</h4>
+  <p>The Hoist Common Subexpression refactoring finds an expression that is
+  computed several times in a function, assigns its value to a new local
+  variable, and replaces each occurrence of the expression with that
+  variable.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select one occurrence of the repeated expression.</li>
+    <li>Activate the Hoist Common Subexpression refactoring.</li>
+    <li>Enter a name for the new variable that will be created.</li>
+  </ol>
+
+  <p>Every occurrence of the expression in the function that computes the same
+  value (i.e., where the same assignments to its variables reach it) is
+  replaced.  The variable is declared at the earliest point that precedes all
+  of those occurrences.</p>
+
+  <p>To find the expressions that can be hoisted, select the name of a
+  function instead of an expression.  Each repeated expression is reported,
+  and the function is not changed.</p>
+
+  <p>Only expressions that have no side effects and cannot panic are hoisted.
+  They may contain local variables, constants, arithmetic and logical
+  operators, comparisons, conversions, field accesses (not through pointers),
+  and calls to <tt>len</tt> and <tt>cap</tt> on strings, slices, and arrays.
+  Variables whose address is taken or which are assigned in a function literal
+  are not allowed, since they may change unexpectedly.</p>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of hoisting the highlighted
+  expression into a new local variable <tt>last</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func swapEnds(s []int) {
+    if len(s) > 1 {
+        s[0], s[<span class="highlight">len(s)-1</span>] = s[len(s)-1], s[0]
+    }
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func swapEnds(s []int) {
+    if len(s) > 1 {
+        <span class="highlight">last := len(s) - 1</span>
+        s[0], s[<span class="highlight">last</span>] = s[<span class="highlight">last</span>], s[0]
+    }
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,145 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godoctor/godoctor/analysis/loader"
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/gcexportdata"
+)
+
+func TestRenameWithImporter(t *testing.T) {
+	// Export data for the imported package, as a client would ship it
+	const depSrc = `package dep
+
+func Hello() string { return "hello" }
+`
+	depFset := token.NewFileSet()
+	depFile, err := parser.ParseFile(depFset, "dep.go", depSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{}
+	dep, err := conf.Check("example.com/dep", depFset,
+		[]*ast.File{depFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exportData bytes.Buffer
+	if err := gcexportdata.Write(&exportData, depFset, dep); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod": "module example.com/app\n",
+		"main.go": `package main
+
+import "example.com/dep"
+
+func greeting() string { return dep.Hello() }
+
+func main() { println(greeting()) }
+`,
+	}
+	for name, contents := range files {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filename := filepath.Join(dir, "main.go")
+
+	imported := map[string]bool{}
+	result := new(Rename).Run(&Config{
+		FileSystem: &filesystem.LocalFileSystem{},
+		Scope:      []string{dir},
+		Dir:        dir,
+		Selection: &text.LineColSelection{
+			Filename:  filename,
+			StartLine: 5, StartCol: 6,
+			EndLine: 5, EndCol: 6,
+		},
+		Args: []interface{}{"message", false, false, false, false},
+		NewImporter: func(fset *token.FileSet) types.Importer {
+			return loader.ExportDataImporter(fset,
+				func(path string) (io.ReadCloser, error) {
+					imported[path] = true
+					if path != "example.com/dep" {
+						return nil, fmt.Errorf("not shipped")
+					}
+					return ioutil.NopCloser(bytes.NewReader(
+						exportData.Bytes())), nil
+				})
+		},
+	})
+	if result.Log.ContainsErrors() {
+		t.Fatal(result.Log)
+	}
+	if len(imported) != 1 || !imported["example.com/dep"] {
+		t.Errorf("Expected only example.com/dep to be imported, got %v",
+			imported)
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := text.ApplyToString(result.Edits[filename], string(contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `package main
+
+import "example.com/dep"
+
+func message() string { return dep.Hello() }
+
+func main() { println(message()) }
+`
+	if output != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, output)
+	}
+
+	// Scope filters need the go command
+	result = new(Rename).Run(&Config{
+		FileSystem:   &filesystem.LocalFileSystem{},
+		Scope:        []string{dir},
+		ScopeExclude: []string{"example.com/app"},
+		Dir:          dir,
+		Selection: &text.LineColSelection{
+			Filename:  filename,
+			StartLine: 5, StartCol: 6,
+			EndLine: 5, EndCol: 6,
+		},
+		Args: []interface{}{"message", false, false, false, false},
+		NewImporter: func(fset *token.FileSet) types.Importer {
+			return loader.ExportDataImporter(fset,
+				func(path string) (io.ReadCloser, error) {
+					return nil, fmt.Errorf("not shipped")
+				})
+		},
+	})
+	if !result.Log.ContainsErrors() {
+		t.Errorf("Expected an error for a scope filter")
+	}
+}
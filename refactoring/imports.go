@@ -0,0 +1,356 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines a utility for rendering types as they should appear in
+// the source code of a particular file, adding import declarations for any
+// packages that the file does not already import.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// A typeQualifier renders types for use in a single file.  Types declared in
+// the file's own package are unqualified; types from imported packages are
+// qualified with the name under which the file imports them (which may
+// differ from the package's name if the import is renamed).  When a type
+// refers to a package that the file does not import, the package is recorded
+// so that an import can be added via addImports.
+type typeQualifier struct {
+	pkg     *types.Package            // package containing the file
+	names   map[string]string         // import path -> name used in file
+	missing map[string]*types.Package // import path -> package to import
+}
+
+// newTypeQualifier returns a typeQualifier for the given file, which must
+// belong to the given package.
+func newTypeQualifier(pkg *types.Package, file *ast.File) *typeQualifier {
+	q := &typeQualifier{
+		pkg:     pkg,
+		names:   map[string]string{},
+		missing: map[string]*types.Package{},
+	}
+	imported := map[string]*types.Package{}
+	if pkg != nil {
+		for _, imp := range pkg.Imports() {
+			imported[imp.Path()] = imp
+		}
+	}
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		switch {
+		case spec.Name == nil:
+			if imp, ok := imported[importPath]; ok {
+				q.names[importPath] = imp.Name()
+			} else {
+				q.names[importPath] = path.Base(importPath)
+			}
+		case spec.Name.Name == "_":
+			// Blank imports cannot be used to qualify names
+		case spec.Name.Name == ".":
+			q.names[importPath] = ""
+		default:
+			q.names[importPath] = spec.Name.Name
+		}
+	}
+	return q
+}
+
+// qualify is a types.Qualifier that returns the name used to refer to the
+// given package in the file.  A package that the file does not import is
+// imported under its own name or, if that name is already declared in the
+// file or its package, under an alias (e.g., bytes1 for bytes).
+func (q *typeQualifier) qualify(other *types.Package) string {
+	if other == q.pkg {
+		return "" // same package; unqualified
+	}
+	if name, ok := q.names[other.Path()]; ok {
+		return name
+	}
+	name := other.Name()
+	for i := 1; q.nameTaken(name); i++ {
+		name = other.Name() + strconv.Itoa(i)
+	}
+	q.importAs(other, name)
+	return name
+}
+
+// nameTaken returns true if the given name is declared in the file's package
+// or imports a package into the file (including a package that will be
+// imported via addImports).
+func (q *typeQualifier) nameTaken(name string) bool {
+	if q.pkg != nil && q.pkg.Scope().Lookup(name) != nil {
+		return true
+	}
+	for _, n := range q.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// importedName returns the name used to refer to the given package in the
+// file if the file already imports it (or it will be imported via addImports),
+// and false otherwise.
+func (q *typeQualifier) importedName(other *types.Package) (string, bool) {
+	if other == q.pkg {
+		return "", true
+	}
+	name, ok := q.names[other.Path()]
+	return name, ok
+}
+
+// importAs records that the given package, which the file does not import,
+// will be imported under the given name, which qualify will return for it.
+func (q *typeQualifier) importAs(other *types.Package, name string) {
+	q.names[other.Path()] = name
+	q.missing[other.Path()] = other
+}
+
+// TypeString returns source code for the given type, qualified as it should
+// be written in the file.
+func (q *typeQualifier) TypeString(typ types.Type) string {
+	return types.TypeString(typ, q.qualify)
+}
+
+// addImports adds an edit to r.Edits which adds import declarations to the
+// file being refactored for every package that q qualified but that the file
+// did not import.
+func (r *RefactoringBase) addImports(q *typeQualifier) {
+	r.addImportsToFile(r.Filename, r.FileContents, q)
+}
+
+// addImportsToFile is like addImports, but it adds the import declarations to
+// the given file (with the given contents), which must be the file for which
+// q was created.
+func (r *RefactoringBase) addImportsToFile(filename string, contents []byte, q *typeQualifier) {
+	r.updateImports(filename, contents, q, nil)
+}
+
+// updateImports is like addImportsToFile, but it also removes the given
+// (unused) imports from the file.
+func (r *RefactoringBase) updateImports(filename string, contents []byte, q *typeQualifier, unused []importSpec) {
+	if len(q.missing) == 0 && len(unused) == 0 {
+		return
+	}
+
+	paths := []string{}
+	for importPath := range q.missing {
+		paths = append(paths, importPath)
+	}
+	sort.Strings(paths)
+
+	extent, replacement, err := rewriteImports(filename, contents,
+		func(fset *token.FileSet, file *ast.File) {
+			for _, importPath := range paths {
+				name := q.names[importPath]
+				if name == path.Base(importPath) {
+					astutil.AddImport(fset, file, importPath)
+				} else {
+					astutil.AddNamedImport(fset, file, name, importPath)
+				}
+			}
+			for _, imp := range unused {
+				astutil.DeleteNamedImport(fset, file, imp.name, imp.path)
+			}
+		})
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	r.Edits[filename].Add(extent, replacement)
+}
+
+// rewriteImports parses the import declarations in the given file, allows
+// modify to change them (e.g., using astutil.AddImport), and returns an edit
+// replacing the file's import declarations with the modified ones.  If
+// modify removes every import, the edit removes the import declarations
+// (along with the blank line preceding them).
+func rewriteImports(filename string, contents []byte, modify func(*token.FileSet, *ast.File)) (*text.Extent, string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, contents,
+		parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Find the extent of the existing import declarations (if any)
+	start, end := file.Name.End(), file.Name.End()
+	hasImports := false
+	for _, decl := range file.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			if !hasImports {
+				start = decl.Pos()
+				if decl.Doc != nil {
+					start = decl.Doc.Pos()
+				}
+				hasImports = true
+			}
+			end = decl.End()
+		}
+	}
+
+	modify(fset, file)
+	ast.SortImports(fset, file)
+
+	decls := []string{}
+	for _, decl := range file.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			var buf bytes.Buffer
+			node := &printer.CommentedNode{Node: decl, Comments: file.Comments}
+			if err := printer.Fprint(&buf, fset, node); err != nil {
+				return nil, "", err
+			}
+			decls = append(decls, buf.String())
+		}
+	}
+	replacement := strings.Join(decls, "\n\n")
+	if len(decls) == 0 {
+		start = file.Name.End()
+	} else if !hasImports {
+		replacement = "\n\n" + replacement
+	}
+
+	offset := fset.Position(start).Offset
+	length := fset.Position(end).Offset - offset
+	return &text.Extent{offset, length}, replacement, nil
+}
+
+// preserveImportGroups receives the contents of a file before a refactoring
+// and its formatted contents afterward.  If the refactoring did not add,
+// remove, or rename any imports, it returns the formatted contents with blank
+// lines inserted or removed between import specs, so the imports are grouped
+// as they were originally.  Otherwise, it returns the formatted contents
+// unchanged.
+func preserveImportGroups(orig, formatted string) string {
+	origFset := token.NewFileSet()
+	origFile, err := parser.ParseFile(origFset, "", orig,
+		parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return formatted
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", formatted,
+		parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return formatted
+	}
+
+	origLayout := importLayouts(origFset, origFile)
+	layout := importLayouts(fset, file)
+	if len(layout) != len(origLayout) {
+		return formatted
+	}
+	for i := range layout {
+		if layout[i].decl != origLayout[i].decl ||
+			layout[i].spec != origLayout[i].spec {
+			return formatted
+		}
+	}
+
+	tfile := fset.File(file.Pos())
+	edits := text.NewEditSet()
+	for i, l := range layout {
+		want := origLayout[i].blankLines
+		if l.blankLines < 0 || want < 0 || (l.blankLines > 0) == (want > 0) {
+			continue
+		}
+		if want > 0 {
+			// Separate this spec from the preceding group
+			offset := tfile.Offset(tfile.LineStart(l.line))
+			edits.Add(&text.Extent{offset, 0}, "\n")
+		} else {
+			// Join this spec to the preceding group
+			start := tfile.Offset(tfile.LineStart(l.line - l.blankLines))
+			end := tfile.Offset(tfile.LineStart(l.line))
+			edits.Add(&text.Extent{start, end - start}, "")
+		}
+	}
+	result, err := text.ApplyToString(edits, formatted)
+	if err != nil {
+		return formatted
+	}
+	return result
+}
+
+// An importLayout describes the position of an import spec in a file.
+type importLayout struct {
+	decl int    // index of the import declaration containing the spec
+	spec string // the spec's name (if any) and path, e.g., `m "math"`
+	line int    // line on which the spec, or its doc comment, begins
+	// Number of blank lines between this spec and the preceding spec in
+	// the same declaration, or -1 if this is the first spec in the
+	// declaration or a comment separates them
+	blankLines int
+}
+
+// importLayouts returns an importLayout for each import spec in the given
+// file, in the order they appear.
+func importLayouts(fset *token.FileSet, file *ast.File) []importLayout {
+	result := []importLayout{}
+	decls := 0
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT {
+			continue
+		}
+		var prevEnd token.Pos
+		for i, spec := range decl.Specs {
+			spec := spec.(*ast.ImportSpec)
+			name := ""
+			if spec.Name != nil {
+				name = spec.Name.Name + " "
+			}
+			start := spec.Pos()
+			if spec.Doc != nil {
+				start = spec.Doc.Pos()
+			}
+			l := importLayout{
+				decl:       decls,
+				spec:       name + spec.Path.Value,
+				line:       fset.Position(start).Line,
+				blankLines: -1,
+			}
+			if i > 0 && !commentBetween(file, prevEnd, start) {
+				l.blankLines = l.line - fset.Position(prevEnd).Line - 1
+			}
+			result = append(result, l)
+
+			prevEnd = spec.End()
+			if spec.Comment != nil {
+				prevEnd = spec.Comment.End()
+			}
+		}
+		decls++
+	}
+	return result
+}
+
+// commentBetween returns true if a comment in the given file begins strictly
+// between the positions start and end.
+func commentBetween(file *ast.File, start, end token.Pos) bool {
+	for _, c := range file.Comments {
+		if c.Pos() > start && c.Pos() < end {
+			return true
+		}
+	}
+	return false
+}
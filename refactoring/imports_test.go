@@ -0,0 +1,144 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+func TestPreserveImportGroups(t *testing.T) {
+	const orig = `package p
+
+import (
+	"fmt"
+	"os"
+
+	// Third-party packages
+	"example.com/x"
+
+	"example.com/y" // a line comment
+)
+
+import m "math"
+`
+	tests := []struct {
+		formatted, expected string
+	}{
+		// Groups merged by the refactoring are separated again
+		{`package p
+
+import (
+	"fmt"
+	"os"
+	// Third-party packages
+	"example.com/x"
+	"example.com/y" // a line comment
+)
+
+import m "math"
+`, orig},
+		// A group split by the refactoring is joined again
+		{`package p
+
+import (
+	"fmt"
+
+	"os"
+
+	// Third-party packages
+	"example.com/x"
+
+	"example.com/y" // a line comment
+)
+
+import m "math"
+
+func f() {}
+`, `package p
+
+import (
+	"fmt"
+	"os"
+
+	// Third-party packages
+	"example.com/x"
+
+	"example.com/y" // a line comment
+)
+
+import m "math"
+
+func f() {}
+`},
+		// If the refactoring changes the imports, they are not regrouped
+		{`package p
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"example.com/x"
+	"example.com/y"
+)
+
+import m "math"
+`, ""},
+		{`package p
+
+import (
+	"fmt"
+	"os"
+	"example.com/x"
+	"example.com/y"
+	m "math"
+)
+`, ""},
+	}
+	for i, test := range tests {
+		expected := test.expected
+		if expected == "" {
+			expected = test.formatted
+		}
+		if result := preserveImportGroups(orig, test.formatted); result != expected {
+			t.Errorf("Test %d: expected\n%s\ngot\n%s", i, expected, result)
+		}
+	}
+}
+
+func TestQualifyNameTaken(t *testing.T) {
+	const src = `package p
+
+import rand "crypto/rand"
+
+var bytes = 1
+`
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := types.NewPackage("p", "p")
+	pkg.Scope().Insert(types.NewVar(token.NoPos, pkg, "bytes",
+		types.Typ[types.Int]))
+	q := newTypeQualifier(pkg, file)
+	tests := []struct {
+		pkg      *types.Package
+		expected string
+	}{
+		{types.NewPackage("crypto/rand", "rand"), "rand"},
+		{types.NewPackage("math/rand", "rand"), "rand1"},
+		{types.NewPackage("bytes", "bytes"), "bytes1"},
+		{types.NewPackage("example.com/bytes1", "bytes1"), "bytes11"},
+		{types.NewPackage("math/rand", "rand"), "rand1"},
+	}
+	for i, test := range tests {
+		if result := q.qualify(test.pkg); result != test.expected {
+			t.Errorf("Test %d: expected %s, got %s", i, test.expected,
+				result)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Inline Constant refactoring, which replaces every use
+// of a package-level constant or variable with its value and removes its
+// declaration.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/names"
+	"github.com/godoctor/godoctor/text"
+)
+
+// An Inline refactoring replaces every use of a package-level constant or
+// variable with the expression that initializes it, then removes the
+// declaration.
+//
+// A variable can be inlined only if its initializer is a constant expression
+// and the variable is never assigned (or its address taken), since otherwise
+// evaluating the initializer at each use could change the program's behavior.
+type Inline struct {
+	RefactoringBase
+	files        *sourceFiles
+	obj          types.Object // the constant or variable being inlined
+	spec         *ast.ValueSpec
+	decl         *ast.GenDecl
+	declFile     *ast.File
+	declFilename string
+	value        ast.Expr
+	// Qualifiers for the files containing uses, keyed by filename
+	qualifiers map[string]*typeQualifier
+}
+
+func (r *Inline) Description() *Description {
+	return &Description{
+		Name:           "Inline Constant",
+		Synopsis:       "Replaces a package-level constant or variable with its value",
+		Usage:          "",
+		HTMLDoc:        inlineDoc,
+		Multifile:      true,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+		Quality:        Testing,
+	}
+}
+
+func (r *Inline) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+	r.qualifiers = map[string]*typeQualifier{}
+
+	if !r.findSelectedSpec() || !r.checkValue() {
+		return &r.Result
+	}
+
+	uses := r.findUses()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if len(uses) == 0 {
+		r.Log.Infof("%s is not used; its declaration will be removed",
+			r.obj.Name())
+	}
+	keep := map[*types.PkgName]bool{}
+	for _, use := range uses {
+		r.inline(use, keep)
+	}
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	filenames := []string{}
+	for filename := range r.qualifiers {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		r.addImportsToFile(filename, r.files.contents[filename],
+			r.qualifiers[filename])
+	}
+
+	var node ast.Node = r.spec
+	if len(r.decl.Specs) == 1 {
+		node = r.decl
+	}
+	d := r.newDeclText(r.files, r.declFilename, r.declFile, node)
+	r.removeDecls([]*declText{d}, r.files, keep)
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findSelectedSpec finds the declaration of the constant or variable to
+// inline: either the package-level declaration containing the selection or,
+// if an identifier is selected, the declaration of the constant or variable
+// it refers to.  It logs an error and returns false if neither is found.
+func (r *Inline) findSelectedSpec() bool {
+	var spec *ast.ValueSpec
+	if id, ok := r.SelectedNode.(*ast.Ident); ok {
+		if obj := r.SelectedNodePkg.TypesInfo.ObjectOf(id); obj != nil &&
+			obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope() {
+			_, path, _ := r.Program.PathEnclosingInterval(obj.Pos(), obj.Pos())
+			spec = packageLevelValueSpec(path)
+		}
+	}
+	if spec == nil && r.SelectedNode != nil {
+		spec = packageLevelValueSpec(r.PathEnclosingSelection)
+	}
+	if spec == nil {
+		r.Log.Error("Please select a package-level constant or variable.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	if len(spec.Names) != 1 {
+		r.Log.Error("Please select a declaration of a single constant " +
+			"or variable.")
+		r.Log.AssociateNode(spec)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+
+	obj := r.SelectedNodePkg.TypesInfo.Defs[spec.Names[0]]
+	switch obj.(type) {
+	case *types.Const, *types.Var:
+	default:
+		r.Log.Errorf("%s cannot be inlined", spec.Names[0].Name)
+		r.Log.AssociateNode(spec)
+		return false
+	}
+	_, path, _ := r.Program.PathEnclosingInterval(spec.Pos(), spec.Pos())
+	r.obj = obj
+	r.spec = spec
+	r.decl = path[len(path)-2].(*ast.GenDecl)
+	r.declFile = path[len(path)-1].(*ast.File)
+	r.declFilename = r.Program.Fset.Position(r.declFile.Pos()).Filename
+	if _, err := r.files.read(r.declFilename); err != nil {
+		r.Log.Error(err)
+		return false
+	}
+	return true
+}
+
+// packageLevelValueSpec returns the const or var spec in the given path (as
+// returned by PathEnclosingInterval) if it is part of a package-level
+// declaration, or nil otherwise.  If the path ends at a declaration with a
+// single spec, that spec is returned.
+func packageLevelValueSpec(path []ast.Node) *ast.ValueSpec {
+	for i, node := range path {
+		switch node := node.(type) {
+		case *ast.GenDecl:
+			if node.Tok != token.CONST && node.Tok != token.VAR ||
+				i+1 >= len(path) {
+				return nil
+			}
+			if _, ok := path[i+1].(*ast.File); !ok {
+				return nil
+			}
+			if len(node.Specs) == 1 {
+				return node.Specs[0].(*ast.ValueSpec)
+			}
+			if i > 0 {
+				if spec, ok := path[i-1].(*ast.ValueSpec); ok {
+					return spec
+				}
+			}
+			return nil
+		case *ast.FuncDecl, *ast.FuncLit:
+			return nil
+		}
+	}
+	return nil
+}
+
+// checkValue checks that the constant or variable has a value that can be
+// substituted for each of its uses, logging an error and returning false if
+// it does not.
+func (r *Inline) checkValue() bool {
+	name := r.obj.Name()
+	_, isConst := r.obj.(*types.Const)
+	if len(r.spec.Values) == 0 {
+		if isConst {
+			r.Log.Errorf("%s repeats the expression of a preceding "+
+				"constant declaration, so it cannot be inlined", name)
+		} else {
+			r.Log.Errorf("%s has no initializer, so it cannot be inlined",
+				name)
+		}
+		r.Log.AssociateNode(r.spec)
+		return false
+	}
+	r.value = r.spec.Values[0]
+
+	if basic, ok := r.obj.Type().(*types.Basic); ok &&
+		basic.Kind() == types.Invalid {
+		r.Log.Errorf("The type of %s could not be determined, so it "+
+			"cannot be inlined", name)
+		r.Log.AssociateNode(r.value)
+		return false
+	}
+
+	if isConst && usesIota(r.value, r.SelectedNodePkg.TypesInfo) {
+		r.Log.Errorf("The value of %s depends on iota, so it cannot be "+
+			"inlined", name)
+		r.Log.AssociateNode(r.value)
+		return false
+	}
+
+	// In a grouped constant declaration, a spec without values repeats the
+	// expression of the preceding spec
+	for i, spec := range r.decl.Specs {
+		if spec == r.spec && i+1 < len(r.decl.Specs) && isConst &&
+			len(r.decl.Specs[i+1].(*ast.ValueSpec).Values) == 0 {
+			r.Log.Errorf("The constants following %s repeat its "+
+				"expression, so it cannot be inlined", name)
+			r.Log.AssociateNode(r.decl.Specs[i+1])
+			return false
+		}
+	}
+
+	if !isConst {
+		if tv, ok := r.SelectedNodePkg.TypesInfo.Types[r.value]; !ok ||
+			tv.Value == nil {
+			r.Log.Errorf("The initializer of %s is not a constant "+
+				"expression; evaluating it at each use could have "+
+				"different results or side effects, so it cannot be "+
+				"inlined", name)
+			r.Log.AssociateNode(r.value)
+			return false
+		}
+	}
+	return true
+}
+
+// usesIota returns true if the given expression refers to iota.
+func usesIota(expr ast.Expr, info *types.Info) bool {
+	result := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "iota" &&
+			info.Uses[id] == types.Universe.Lookup("iota") {
+			result = true
+		}
+		return !result
+	})
+	return result
+}
+
+// findUses returns the identifiers referring to the constant or variable
+// (excluding its declaration), sorted by position.  It logs an error if any
+// use cannot be inlined.
+func (r *Inline) findUses() []*ast.Ident {
+	uses := []*ast.Ident{}
+	for id := range names.FindOccurrences(r.obj, r.Program) {
+		if id.Pos() != r.spec.Names[0].Pos() {
+			uses = append(uses, id)
+		}
+	}
+	sort.Slice(uses, func(i, j int) bool { return uses[i].Pos() < uses[j].Pos() })
+
+	_, isVar := r.obj.(*types.Var)
+	for _, use := range uses {
+		pkg, path, _ := r.Program.PathEnclosingInterval(use.Pos(), use.End())
+		if pkg == nil || pkg.Types.Path() != r.obj.Pkg().Path() {
+			r.Log.Errorf("%s is used outside its package, so it cannot "+
+				"be inlined", r.obj.Name())
+			r.Log.AssociateNode(use)
+			continue
+		}
+		file := path[len(path)-1].(*ast.File)
+		if usesCgo(file) {
+			filename := r.Program.Fset.Position(file.Pos()).Filename
+			r.Log.Errorf("%s cannot be modified because it uses cgo "+
+				"(import \"C\")", filepath.Base(filename))
+			r.Log.AssociateNode(use)
+			continue
+		}
+		if isVar && isAssigned(path, pkg.TypesInfo) {
+			r.Log.Errorf("%s is assigned (or its address is taken), so "+
+				"it cannot be inlined", r.obj.Name())
+			r.Log.AssociateNode(use)
+		}
+	}
+	return uses
+}
+
+// isAssigned returns true if the identifier at the start of the given path
+// (as returned by PathEnclosingInterval) is assigned, incremented, or
+// decremented, has its address taken (explicitly or by calling a method with
+// a pointer receiver), or is the operand of a range statement's assignment.
+func isAssigned(path []ast.Node, info *types.Info) bool {
+	node := path[0]
+	for _, parent := range path[1:] {
+		switch parent := parent.(type) {
+		case *ast.ParenExpr:
+			node = parent
+			continue
+		case *ast.AssignStmt:
+			for _, lhs := range parent.Lhs {
+				if lhs == node {
+					return true
+				}
+			}
+		case *ast.IncDecStmt:
+			return parent.X == node
+		case *ast.UnaryExpr:
+			return parent.Op == token.AND
+		case *ast.RangeStmt:
+			return parent.Tok == token.ASSIGN &&
+				(parent.Key == node || parent.Value == node)
+		case *ast.SelectorExpr:
+			sel, ok := info.Selections[parent]
+			if !ok || sel.Kind() != types.MethodVal {
+				return false
+			}
+			recv := sel.Obj().Type().(*types.Signature).Recv()
+			_, ptrRecv := recv.Type().(*types.Pointer)
+			_, ptrOperand := sel.Recv().(*types.Pointer)
+			return ptrRecv && !ptrOperand
+		}
+		return false
+	}
+	return false
+}
+
+// inline adds an edit replacing the given use with the value of the constant
+// or variable.  If the use is in the file containing the declaration, the
+// packages referenced by the value are added to keep, since their imports
+// are still needed after the declaration is removed.
+func (r *Inline) inline(use *ast.Ident, keep map[*types.PkgName]bool) {
+	pkg, path, _ := r.Program.PathEnclosingInterval(use.Pos(), use.End())
+	file := path[len(path)-1].(*ast.File)
+	filename := r.Program.Fset.Position(file.Pos()).Filename
+	contents, err := r.files.read(filename)
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	q, ok := r.qualifiers[filename]
+	if !ok {
+		q = newTypeQualifier(pkg.Types, file)
+		r.qualifiers[filename] = q
+	}
+
+	replacement, ok := r.valueText(q, scopeAt(pkg.TypesInfo, path), use)
+	if !ok {
+		return
+	}
+	if filename == r.declFilename {
+		for pkgName := range r.packagesUsedByValue() {
+			keep[pkgName] = true
+		}
+	}
+
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+		r.Edits[filename].SetBase(contents)
+	}
+	r.Edits[filename].Add(&text.Extent{
+		Offset: r.Program.Fset.Position(use.Pos()).Offset,
+		Length: len(use.Name),
+	}, replacement)
+}
+
+// scopeAt returns the innermost scope containing the node at the start of
+// the given path (as returned by PathEnclosingInterval).
+func scopeAt(info *types.Info, path []ast.Node) *types.Scope {
+	for _, node := range path {
+		if scope, ok := info.Scopes[node]; ok {
+			return scope.Innermost(path[0].Pos())
+		}
+	}
+	return nil
+}
+
+// valueText returns the source code to substitute for the given use: the
+// text of the value, with package qualifiers replaced by the names under
+// which the use's file imports those packages, converted to the type of the
+// constant or variable (if necessary) and parenthesized (if necessary).  It
+// logs an error and returns false if a name in the value would refer to a
+// different declaration at the position of the use.
+func (r *Inline) valueText(q *typeQualifier, scope *types.Scope, use *ast.Ident) (string, bool) {
+	info := r.SelectedNodePkg.TypesInfo
+	contents := r.files.contents[r.declFilename]
+	start := r.Program.Fset.Position(r.value.Pos()).Offset
+	end := r.Program.Fset.Position(r.value.End()).Offset
+
+	type edit struct {
+		start, end  int
+		replacement string
+	}
+	edits := []edit{}
+	refersTo := func(name string, obj types.Object) bool {
+		_, found := scope.LookupParent(name, use.Pos())
+		return found == obj || found != nil && obj != nil &&
+			found.Pos() == obj.Pos() && found.Name() == obj.Name()
+	}
+	conflict := func(id *ast.Ident) {
+		r.Log.Errorf("%s cannot be inlined here, since %s refers to a "+
+			"different declaration at this position", r.obj.Name(),
+			id.Name)
+		r.Log.AssociateNode(use)
+	}
+
+	ok := true
+	ast.Inspect(r.value, func(n ast.Node) bool {
+		if !ok {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			x, isIdent := n.X.(*ast.Ident)
+			if !isIdent {
+				return true
+			}
+			pkgName, isPkg := info.Uses[x].(*types.PkgName)
+			if !isPkg {
+				return true
+			}
+			name := q.qualify(pkgName.Imported())
+			if name == "" { // dot import
+				if !refersTo(n.Sel.Name, info.Uses[n.Sel]) {
+					ok = false
+					conflict(n.Sel)
+				}
+				edits = append(edits, edit{
+					r.OffsetOfPos(x.Pos()) - start,
+					r.OffsetOfPos(n.Sel.Pos()) - start,
+					""})
+				return false
+			}
+			_, found := scope.LookupParent(name, use.Pos())
+			if other, isPkg := found.(*types.PkgName); found != nil &&
+				(!isPkg || other.Imported().Path() != pkgName.Imported().Path()) {
+				ok = false
+				conflict(x)
+			}
+			edits = append(edits, edit{
+				r.OffsetOfPos(x.Pos()) - start,
+				r.OffsetOfPos(x.End()) - start,
+				name})
+			return false
+		case *ast.Ident:
+			obj := info.Uses[n]
+			if obj == nil || obj.Parent() == nil {
+				return true // field, method, or unresolved
+			}
+			if obj.Parent() != types.Universe &&
+				obj.Parent() != obj.Pkg().Scope() {
+				return true
+			}
+			if !refersTo(n.Name, obj) {
+				ok = false
+				conflict(n)
+			}
+		}
+		return true
+	})
+	if !ok {
+		return "", false
+	}
+
+	var buf bytes.Buffer
+	offset := 0
+	value := contents[start:end]
+	for _, e := range edits {
+		buf.Write(value[offset:e.start])
+		buf.WriteString(e.replacement)
+		offset = e.end
+	}
+	buf.Write(value[offset:])
+	result := buf.String()
+
+	if typ := conversionType(r.Program.Fset, r.obj, r.value); typ != nil {
+		return conversion(q.TypeString(typ), result), true
+	}
+	_, path, _ := r.Program.PathEnclosingInterval(use.Pos(), use.End())
+	if needsParens(r.value, path) {
+		return "(" + result + ")", true
+	}
+	return result, true
+}
+
+// packagesUsedByValue returns the imported packages referenced by the value
+// of the constant or variable.
+func (r *Inline) packagesUsedByValue() map[*types.PkgName]bool {
+	result := map[*types.PkgName]bool{}
+	ast.Inspect(r.value, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if pkgName, ok := r.SelectedNodePkg.TypesInfo.Uses[id].(*types.PkgName); ok {
+				result[pkgName] = true
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// conversionType returns the type to which the given value of a constant or
+// variable must be converted when it is inlined, or nil if no conversion is
+// needed.  This is the case when the type of the constant or variable differs
+// from the type the value would have on its own, e.g., const c int64 = 5 or
+// var v = 5 (since v has type int, but the constant 5 is untyped).  Untyped
+// boolean and string values assigned to a bool or string are not converted,
+// since they cannot be used differently than a typed bool or string would be
+// in any program that compiled before the refactoring.
+func conversionType(fset *token.FileSet, obj types.Object, value ast.Expr) types.Type {
+	info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+	err := types.CheckExpr(fset, obj.Pkg(), value.Pos(), value, info)
+	if err != nil {
+		return obj.Type()
+	}
+	typ := info.Types[value].Type
+	if types.Identical(typ, obj.Type()) {
+		return nil
+	}
+	if basic, ok := typ.(*types.Basic); ok &&
+		basic.Info()&(types.IsBoolean|types.IsString) != 0 &&
+		types.Identical(types.Default(typ), obj.Type()) {
+		return nil
+	}
+	return obj.Type()
+}
+
+// conversion returns the source code for a conversion of the given
+// expression to the given type, parenthesizing the type if necessary.
+func conversion(typeString, expr string) string {
+	if strings.HasPrefix(typeString, "*") ||
+		strings.HasPrefix(typeString, "<-") ||
+		strings.HasPrefix(typeString, "func") {
+		typeString = "(" + typeString + ")"
+	}
+	return typeString + "(" + expr + ")"
+}
+
+// needsParens returns true if the given expression must be parenthesized
+// when it replaces the identifier at the start of the given path.
+func needsParens(expr ast.Expr, path []ast.Node) bool {
+	var prec int
+	switch expr := expr.(type) {
+	case *ast.BinaryExpr:
+		prec = expr.Op.Precedence()
+	case *ast.UnaryExpr, *ast.StarExpr:
+		prec = token.UnaryPrec
+	default:
+		return false
+	}
+	switch parent := path[1].(type) {
+	case *ast.BinaryExpr:
+		return prec <= parent.Op.Precedence()
+	case *ast.UnaryExpr, *ast.StarExpr:
+		return true
+	case *ast.SelectorExpr, *ast.TypeAssertExpr:
+		return true
+	case *ast.IndexExpr:
+		return parent.X == path[0]
+	case *ast.SliceExpr:
+		return parent.X == path[0]
+	case *ast.CallExpr:
+		return parent.Fun == path[0]
+	}
+	return false
+}
+
+const inlineDoc = `
+  <h4>Purpose</h4>
+  <p>The Inline Constant refactoring replaces every use of a package-level
+  constant or variable with its value, then removes its declaration.  It is
+  useful for eliminating a constant or variable that is used only once (or a
+  few times) and whose name adds little to the readability of the code.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the declaration of a package-level constant or variable (or
+    any use of it).</li>
+    <li>Activate the Inline Constant refactoring.</li>
+  </ol>
+
+  <p>If the constant or variable has an explicit type (e.g., <tt>const
+  timeout time.Duration = 5</tt>), or if the type of its value would
+  otherwise differ, the value is converted to that type where it is
+  inlined (e.g., <tt>time.Duration(5)</tt>).  Imports are added to files that
+  need them, and imports that are no longer used are removed.</p>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The declaration declares several names, or it has no value.</li>
+    <li>The value of a constant depends on <tt>iota</tt>, or it is repeated
+    by the constants following it in a grouped declaration.</li>
+    <li>The initializer of a variable is not a constant expression (since
+    evaluating it at each use could have different results or side
+    effects), or the variable is assigned or its address is taken.</li>
+    <li>An exported constant or variable is used outside its package.</li>
+    <li>A name in the value refers to a different declaration (e.g., a local
+    variable that shadows it) where the constant or variable is used.</li>
+  </ul>
+`
@@ -0,0 +1,459 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Inline Local Variable refactoring, the inverse of
+// Extract Local Variable, which replaces every use of a local variable with
+// its initializer and removes its declaration.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// An InlineLocal refactoring replaces every use of the selected local
+// variable with the expression that initializes it, then removes the
+// variable's declaration.
+//
+// The variable must never be assigned (or have its address taken) after it is
+// declared.  If its initializer is pure (see HoistSubexpr.exprKey), it may be
+// inlined into any number of uses, provided the variables in the initializer
+// are reached by the same definitions at each use as they are at the
+// declaration.  Otherwise, evaluating the initializer elsewhere could change
+// its value or reorder its side effects, so the variable can only be inlined
+// into a single use in the statement immediately following its declaration.
+// The control flow graph and dataflow analyses are those of HoistSubexpr.
+type InlineLocal struct {
+	HoistSubexpr
+	v        *types.Var
+	declStmt ast.Stmt     // the declaration of the variable
+	next     ast.Stmt     // the statement following declStmt, or nil
+	value    ast.Expr     // the variable's initializer
+	uses     []*ast.Ident // in source order
+}
+
+func (r *InlineLocal) Description() *Description {
+	return &Description{
+		Name:           "Inline Local Variable",
+		Synopsis:       "Replaces a local variable with its initializer",
+		Usage:          "",
+		HTMLDoc:        inlineLocalDoc,
+		Multifile:      false,
+		Params:         nil,
+		OptionalParams: nil,
+		Hidden:         false,
+		Quality:        Testing,
+	}
+}
+
+func (r *InlineLocal) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	if !r.findDecl() {
+		return &r.Result
+	}
+	if r.containsGoto() {
+		r.Log.Error("Functions containing goto statements are not supported.")
+		r.Log.AssociateNode(r.funcDecl.Name)
+		return &r.Result
+	}
+	r.analyzeFunc()
+	r.findUses()
+	if !r.checkUses() {
+		return &r.Result
+	}
+	r.addInlineEdits()
+	r.UpdateLog(config, false)
+	return &r.Result
+}
+
+// findDecl finds the declaration of the selected local variable, which must
+// be a short variable declaration or var declaration with an initializer
+// that declares only that variable.  It logs an error and returns false if
+// the variable cannot be inlined.
+func (r *InlineLocal) findDecl() bool {
+	info := r.SelectedNodePkg.TypesInfo
+	r.v, r.funcDecl = nil, nil
+	if id, ok := r.SelectedNode.(*ast.Ident); ok {
+		r.v, _ = info.ObjectOf(id).(*types.Var)
+	}
+	for _, node := range r.PathEnclosingSelection {
+		if decl, ok := node.(*ast.FuncDecl); ok {
+			r.funcDecl = decl
+			break
+		}
+	}
+	if r.v == nil || r.funcDecl == nil || r.funcDecl.Body == nil ||
+		!r.isLocal(r.v) {
+		r.Log.Error("Please select a local variable.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	name := r.v.Name()
+
+	path, _ := astutil.PathEnclosingInterval(r.File, r.v.Pos(), r.v.Pos())
+	i := 1
+	switch node := path[1].(type) {
+	case *ast.AssignStmt:
+		if node.Tok != token.DEFINE {
+			break
+		}
+		if len(node.Lhs) != 1 || len(node.Rhs) != 1 {
+			r.Log.Errorf("%s is declared together with other variables, "+
+				"so it cannot be inlined", name)
+			r.Log.AssociateNode(node)
+			return false
+		}
+		r.declStmt, r.value = node, node.Rhs[0]
+	case *ast.ValueSpec:
+		decl := path[2].(*ast.GenDecl)
+		if len(node.Names) != 1 || len(decl.Specs) != 1 {
+			r.Log.Errorf("%s is declared together with other variables, "+
+				"so it cannot be inlined", name)
+			r.Log.AssociateNode(decl)
+			return false
+		}
+		if len(node.Values) == 0 {
+			r.Log.Errorf("%s has no initializer, so it cannot be inlined",
+				name)
+			r.Log.AssociateNode(node)
+			return false
+		}
+		r.declStmt, r.value = path[3].(*ast.DeclStmt), node.Values[0]
+		i = 3
+	}
+	if r.declStmt == nil {
+		r.Log.Errorf("%s is not declared by a short variable declaration "+
+			"or var declaration, so it cannot be inlined", name)
+		r.Log.AssociatePos(r.v.Pos(), r.v.Pos())
+		return false
+	}
+
+	var list []ast.Stmt
+	switch parent := path[i+1].(type) {
+	case *ast.BlockStmt:
+		list = parent.List
+	case *ast.CaseClause:
+		list = parent.Body
+	case *ast.CommClause:
+		list = parent.Body
+	default:
+		r.Log.Errorf("The declaration of %s cannot be removed, since it "+
+			"is not in a block (e.g., it is in the header of an if, "+
+			"for, or switch statement)", name)
+		r.Log.AssociateNode(r.declStmt)
+		return false
+	}
+	inList := false
+	r.next = nil
+	for j, stmt := range list {
+		if stmt == r.declStmt {
+			inList = true
+			if j+1 < len(list) {
+				r.next = list[j+1]
+			}
+		}
+	}
+	if !inList {
+		r.Log.Errorf("The declaration of %s cannot be removed, since it "+
+			"is not in a block (e.g., it is a case of a select "+
+			"statement)", name)
+		r.Log.AssociateNode(r.declStmt)
+		return false
+	}
+	for _, node := range path[i+1:] {
+		if _, ok := node.(*ast.FuncLit); ok {
+			r.Log.Errorf("%s is declared in a function literal, so it "+
+				"cannot be inlined", name)
+			r.Log.AssociateNode(r.declStmt)
+			return false
+		}
+	}
+
+	if basic, ok := r.v.Type().(*types.Basic); ok &&
+		basic.Kind() == types.Invalid {
+		r.Log.Errorf("The type of %s could not be determined, so it "+
+			"cannot be inlined", name)
+		r.Log.AssociateNode(r.value)
+		return false
+	}
+	return true
+}
+
+// findUses sets r.uses to the identifiers referring to the variable
+// (excluding its declaration).
+func (r *InlineLocal) findUses() {
+	info := r.SelectedNodePkg.TypesInfo
+	r.uses = []*ast.Ident{}
+	ast.Inspect(r.funcDecl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && info.Uses[id] == r.v {
+			r.uses = append(r.uses, id)
+		}
+		return true
+	})
+}
+
+// checkUses checks that the initializer can be substituted for every use of
+// the variable, logging errors and returning false if it cannot.
+func (r *InlineLocal) checkUses() bool {
+	info := r.SelectedNodePkg.TypesInfo
+	name := r.v.Name()
+	_, pure := r.exprKey(r.value)
+	if !pure && (len(r.uses) != 1 || !r.isImmediateUse(r.uses[0])) {
+		r.Log.Errorf("The initializer of %s may have side effects, or its "+
+			"value may change, so it can only be inlined into a single "+
+			"use in the statement immediately following its "+
+			"declaration", name)
+		r.Log.AssociateNode(r.value)
+		return false
+	}
+	if len(r.uses) == 0 {
+		r.Log.Infof("%s is not used; its declaration will be removed",
+			name)
+	}
+
+	vars := r.varsIn(r.value)
+	want := map[*types.Var][]ast.Stmt{}
+	for _, v := range vars {
+		want[v] = r.defsOf(v, r.defsReaching(r.declStmt))
+	}
+	for _, use := range r.uses {
+		path, _ := astutil.PathEnclosingInterval(r.File, use.Pos(), use.End())
+		if isAssigned(path, info) {
+			r.Log.Errorf("%s is assigned (or its address is taken), so "+
+				"it cannot be inlined", name)
+			r.Log.AssociateNode(use)
+			continue
+		}
+		if !r.checkNames(use, scopeAt(info, path)) || !pure ||
+			len(vars) == 0 {
+			continue
+		}
+
+		// The variables in the initializer must have the same values at
+		// the use as they do at the declaration
+		block := r.enclosingBlock(use)
+		if block == nil {
+			r.Log.Errorf("%s is used in a function literal or defer "+
+				"statement, where the variables in its initializer "+
+				"may have different values", name)
+			r.Log.AssociateNode(use)
+			continue
+		}
+		reaching := r.defsReaching(block)
+		for _, v := range vars {
+			if !sameStmts(want[v], r.defsOf(v, reaching)) ||
+				r.isDefinedBetween(v, use) {
+				r.Log.Errorf("%s may be assigned a different value "+
+					"between the declaration of %s and this use",
+					v.Name(), name)
+				r.Log.AssociateNode(use)
+				break
+			}
+		}
+	}
+	return !r.Log.ContainsErrors()
+}
+
+// isDefinedBetween returns true if a statement between the variable's
+// declaration and the given use (but not containing the use) defines v.
+func (r *InlineLocal) isDefinedBetween(v *types.Var, use *ast.Ident) bool {
+	for _, def := range r.cfg.Blocks() {
+		if _, ok := r.definedVars(def)[v]; ok &&
+			r.declStmt.End() <= def.Pos() && def.Pos() < use.Pos() &&
+			!(def.Pos() <= use.Pos() && use.End() <= def.End()) {
+			return true
+		}
+	}
+	return false
+}
+
+// isImmediateUse returns true if the given use is evaluated exactly once, by
+// the statement immediately following the declaration, before anything in
+// that statement that may have side effects.  An initializer with side
+// effects can be inlined into such a use without changing the order in which
+// side effects occur.
+func (r *InlineLocal) isImmediateUse(use *ast.Ident) bool {
+	if r.next == nil || !(r.next.Pos() <= use.Pos() && use.End() <= r.next.End()) {
+		return false
+	}
+	if _, ok := r.next.(*ast.ForStmt); ok {
+		return false // The condition and post statement are repeated
+	}
+	path, _ := astutil.PathEnclosingInterval(r.File, use.Pos(), use.End())
+	for _, node := range path[1:] {
+		if node == r.next {
+			break
+		}
+		switch node := node.(type) {
+		case *ast.FuncLit, ast.Stmt:
+			return false
+		case *ast.BinaryExpr:
+			// The right operand of && and || may not be evaluated
+			if (node.Op == token.LAND || node.Op == token.LOR) &&
+				node.Y.Pos() <= use.Pos() {
+				return false
+			}
+		}
+	}
+
+	info := r.SelectedNodePkg.TypesInfo
+	effects := false
+	ast.Inspect(r.next, func(n ast.Node) bool {
+		if n == nil || effects || n.Pos() >= use.Pos() {
+			return false
+		}
+		if n.Pos() <= use.Pos() && use.End() <= n.End() {
+			return true // Contains the use, so it is evaluated after it
+		}
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if tv := info.Types[n.Fun]; !tv.IsType() && !tv.IsBuiltin() {
+				effects = true
+			}
+		case *ast.UnaryExpr:
+			effects = n.Op == token.ARROW
+		}
+		return !effects
+	})
+	return !effects
+}
+
+// checkNames checks that every name in the initializer refers to the same
+// declaration at the position of the given use, logging an error and
+// returning false if it does not.
+func (r *InlineLocal) checkNames(use *ast.Ident, scope *types.Scope) bool {
+	info := r.SelectedNodePkg.TypesInfo
+	// The selector of a qualified identifier, field, or method does not
+	// depend on the scope
+	selectors := map[*ast.Ident]bool{}
+	ast.Inspect(r.value, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			selectors[sel.Sel] = true
+		}
+		return true
+	})
+
+	ok := true
+	ast.Inspect(r.value, func(n ast.Node) bool {
+		id, isIdent := n.(*ast.Ident)
+		if !ok || !isIdent || selectors[id] {
+			return ok
+		}
+		obj := info.Uses[id]
+		if obj == nil || obj.Parent() == nil {
+			return true // unresolved
+		}
+		if _, found := scope.LookupParent(id.Name, use.Pos()); found != obj {
+			r.Log.Errorf("%s cannot be inlined here, since %s refers "+
+				"to a different declaration at this position",
+				r.v.Name(), id.Name)
+			r.Log.AssociateNode(use)
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// addInlineEdits replaces each use of the variable with its initializer
+// (converted to the variable's type and parenthesized, if necessary) and
+// removes its declaration.
+func (r *InlineLocal) addInlineEdits() {
+	value := r.nodeText(r.value)
+	typ := conversionType(r.Program.Fset, r.v, r.value)
+	if typ != nil {
+		q := newTypeQualifier(r.SelectedNodePkg.Types, r.File)
+		value = conversion(q.TypeString(typ), value)
+	}
+	for _, use := range r.uses {
+		replacement := value
+		path, _ := astutil.PathEnclosingInterval(r.File, use.Pos(), use.End())
+		if typ == nil && needsParens(r.value, path) {
+			replacement = "(" + value + ")"
+		}
+		r.Edits[r.Filename].Add(r.Extent(use), replacement)
+	}
+	start, end := r.lineExtent(r.declStmt)
+	r.Edits[r.Filename].Add(&text.Extent{Offset: start, Length: end - start}, "")
+}
+
+const inlineLocalDoc = `
+  <h4>Purpose</h4>
+  <p>The Inline Local Variable refactoring is the inverse of Extract Local
+  Variable: it replaces every use of a local variable with the expression
+  that initializes it, then removes the variable's declaration.  It is useful
+  for eliminating a variable whose name adds little to the readability of the
+  code.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the declaration of a local variable (or any use of it).</li>
+    <li>Activate the Inline Local Variable refactoring.</li>
+  </ol>
+
+  <p>The variable must be declared by a short variable declaration (e.g.,
+  <tt>n := len(s)</tt>) or a <tt>var</tt> declaration with an initializer,
+  and it must not be assigned after it is declared.  If the variable has an
+  explicit type, or if the type of its initializer would otherwise differ,
+  the initializer is converted to that type where it is inlined.</p>
+
+  <p>If the initializer has no side effects and cannot panic (see Hoist
+  Common Subexpression), it is substituted for every use of the variable, as
+  long as the variables it refers to are not assigned between the
+  declaration and the use.  Otherwise, the variable can only be inlined if it
+  is used once, in the statement immediately following its declaration, and
+  nothing in that statement with side effects is evaluated before the
+  use.</p>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The declaration declares several names, it has no initializer, or it
+    is in the header of an <tt>if</tt>, <tt>for</tt>, or <tt>switch</tt>
+    statement.</li>
+    <li>The variable is assigned or its address is taken.</li>
+    <li>A variable in the initializer may have a different value at a use
+    than it had at the declaration.</li>
+    <li>A name in the initializer refers to a different declaration (e.g., a
+    local variable that shadows it) where the variable is used.</li>
+    <li>The function contains a <tt>goto</tt> statement.</li>
+  </ul>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of inlining the highlighted
+  variable <tt>last</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func swapEnds(s []int) {
+    if len(s) > 1 {
+        <span class="highlight">last</span> := len(s) - 1
+        s[0], s[last] = s[last], s[0]
+    }
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>func swapEnds(s []int) {
+    if len(s) > 1 {
+        s[0], s[<span class="highlight">len(s)-1</span>] = s[<span class="highlight">len(s)-1</span>], s[0]
+    }
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
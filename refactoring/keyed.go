@@ -0,0 +1,419 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Convert Struct Literals refactoring, which converts
+// struct literals with positional fields (T{1, 2}) to literals with keyed
+// fields (T{X: 1, Y: 2}), or vice versa.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/packages"
+)
+
+// A ConvertStructLit refactoring converts struct literals with positional
+// fields (T{1, 2}) to literals with keyed fields (T{X: 1, Y: 2}), or, if
+// the Positional argument is true, vice versa.  It converts the selected
+// literal, every literal of the selected struct type, or every struct
+// literal in the package.
+type ConvertStructLit struct {
+	RefactoringBase
+	files      *sourceFiles
+	positional bool
+	seen       map[token.Pos]bool // files already searched
+}
+
+// A structLit is a composite literal whose type is a struct type.
+type structLit struct {
+	lit      *ast.CompositeLit
+	st       *types.Struct
+	pkg      *packages.Package
+	filename string
+}
+
+func (r *ConvertStructLit) Description() *Description {
+	return &Description{
+		Name:      "Convert Struct Literals",
+		Synopsis:  "Converts struct literals to keyed (or positional) fields",
+		Usage:     "[<positional> [<entire_package>]]",
+		HTMLDoc:   convertStructLitDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Positional:",
+			Prompt:       "Convert keyed fields to positional fields, rather than vice versa.",
+			DefaultValue: false,
+		}, {
+			Label:        "Entire Package:",
+			Prompt:       "Convert every struct literal in the package, not just the selected literal or type.",
+			DefaultValue: false,
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *ConvertStructLit) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+	r.seen = map[token.Pos]bool{}
+	r.positional = false
+	if len(config.Args) > 0 {
+		r.positional = config.Args[0].(bool)
+	}
+	entirePackage := false
+	if len(config.Args) > 1 {
+		entirePackage = config.Args[1].(bool)
+	}
+
+	if entirePackage {
+		lits := r.literalsIn([]*packages.Package{r.SelectedNodePkg}, nil)
+		r.convertAll(lits, "in package "+r.SelectedNodePkg.Types.Name())
+	} else if lit := r.selectedLiteral(); lit != nil {
+		if reason := r.convert(lit); reason != "" {
+			r.Log.Error(reason)
+			r.Log.AssociateNode(lit.lit)
+			return &r.Result
+		}
+	} else if typeName := r.selectedType(); typeName != nil {
+		pkgs := []*packages.Package{}
+		for _, pkg := range r.Program.AllPackages {
+			pkgs = append(pkgs, pkg)
+		}
+		sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].ID < pkgs[j].ID })
+		lits := r.literalsIn(pkgs, typeName)
+		r.convertAll(lits, "of type "+typeName.Name())
+	} else {
+		if !r.Log.ContainsErrors() {
+			r.Log.Error("Please select a struct literal or the " +
+				"declaration of a struct type.")
+			r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+			r.Log.AssociateCode(CodeInvalidSelection)
+		}
+		return &r.Result
+	}
+
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// selectedLiteral returns the innermost struct literal containing the
+// selection, or nil if there is none.
+func (r *ConvertStructLit) selectedLiteral() *structLit {
+	filename := r.Program.Fset.Position(r.SelectionStart).Filename
+	for _, node := range r.PathEnclosingSelection {
+		if lit, ok := node.(*ast.CompositeLit); ok {
+			return r.structLiteral(r.SelectedNodePkg, filename, lit)
+		}
+		if _, ok := node.(*ast.FuncLit); ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+// selectedType returns the struct type named by the selected identifier or
+// declared by the selected type declaration, or nil if there is none.  It
+// logs an error if the selected type is not a struct type.
+func (r *ConvertStructLit) selectedType() *types.TypeName {
+	info := r.SelectedNodePkg.TypesInfo
+	var obj types.Object
+	if id, ok := r.SelectedNode.(*ast.Ident); ok {
+		obj = info.ObjectOf(id)
+	}
+	if obj == nil {
+		if spec, _ := packageLevelTypeSpec(r.PathEnclosingSelection); spec != nil {
+			obj = info.Defs[spec.Name]
+		}
+	}
+	typeName, ok := obj.(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	if _, ok := typeName.Type().Underlying().(*types.Struct); !ok {
+		r.Log.Errorf("%s is not a struct type", typeName.Name())
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return nil
+	}
+	return typeName
+}
+
+// structLiteral returns a structLit for the given composite literal, or nil
+// if its type is not a struct type.
+func (r *ConvertStructLit) structLiteral(pkg *packages.Package, filename string, lit *ast.CompositeLit) *structLit {
+	tv, ok := pkg.TypesInfo.Types[lit]
+	if !ok {
+		return nil
+	}
+	typ := tv.Type
+	if ptr, ok := typ.(*types.Pointer); ok { // elided &T in []*T{{...}}
+		typ = ptr.Elem()
+	}
+	st, ok := typ.Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	return &structLit{lit: lit, st: st, pkg: pkg, filename: filename}
+}
+
+// literalsIn returns the struct literals in the given packages.  If typeName
+// is non-nil, only literals of that type are returned.  Files that use cgo,
+// or that are under $GOROOT, are skipped.
+func (r *ConvertStructLit) literalsIn(pkgs []*packages.Package, typeName *types.TypeName) []*structLit {
+	result := []*structLit{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			filename := r.Program.Fset.Position(file.Pos()).Filename
+			if isInGoRoot(filename) || r.seen[file.Pos()] {
+				continue
+			}
+			r.seen[file.Pos()] = true // Test variants share files
+			if usesCgo(file) {
+				r.Log.Warnf("%s uses cgo (import \"C\"), so its "+
+					"struct literals will not be converted",
+					filepath.Base(filename))
+				continue
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				lit, ok := n.(*ast.CompositeLit)
+				if !ok {
+					return true
+				}
+				if s := r.structLiteral(pkg, filename, lit); s != nil &&
+					(typeName == nil || hasTypeName(lit, typeName, pkg.TypesInfo)) {
+					result = append(result, s)
+				}
+				return true
+			})
+		}
+	}
+	return result
+}
+
+// hasTypeName returns true if the type of the given literal is the named
+// type declared by typeName.  Declarations are compared by name and position
+// (rather than identity) so that literals in test variants of the declaring
+// package are included.
+func hasTypeName(lit *ast.CompositeLit, typeName *types.TypeName, info *types.Info) bool {
+	typ := info.TypeOf(lit)
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Name() == typeName.Name() && obj.Pos() == typeName.Pos() &&
+		obj.Pkg() != nil && obj.Pkg().Path() == typeName.Pkg().Path()
+}
+
+// convertAll converts each of the given literals that needs to be converted,
+// logging a warning for each literal that cannot be converted, and an
+// informational message if there are no literals to convert.  The
+// description (e.g., "of type T") is used in the message.
+func (r *ConvertStructLit) convertAll(lits []*structLit, description string) {
+	converted := 0
+	for _, lit := range lits {
+		if !r.needsConversion(lit) {
+			continue
+		}
+		if reason := r.convert(lit); reason != "" {
+			r.Log.Warn(reason)
+			r.Log.AssociateNode(lit.lit)
+		} else {
+			converted++
+		}
+	}
+	if converted == 0 {
+		form := "positional"
+		if r.positional {
+			form = "keyed"
+		}
+		r.Log.Infof("There are no struct literals %s with %s fields "+
+			"to convert", description, form)
+	}
+}
+
+// needsConversion returns true if the given literal has at least one field
+// and its fields are not already in the desired form.
+func (r *ConvertStructLit) needsConversion(s *structLit) bool {
+	if len(s.lit.Elts) == 0 {
+		return false
+	}
+	_, keyed := s.lit.Elts[0].(*ast.KeyValueExpr)
+	return keyed == r.positional
+}
+
+// convert adds edits converting the given literal to keyed (or positional)
+// fields.  If the literal cannot be converted, it returns a message
+// explaining why.
+func (r *ConvertStructLit) convert(s *structLit) string {
+	if !r.needsConversion(s) {
+		if len(s.lit.Elts) == 0 {
+			return "The selected struct literal has no fields to convert"
+		}
+		if r.positional {
+			return "The selected struct literal already has positional fields"
+		}
+		return "The selected struct literal already has keyed fields " +
+			"(to convert them to positional fields, set Positional " +
+			"to true)"
+	}
+	contents, err := r.files.read(s.filename)
+	if err != nil {
+		return err.Error()
+	}
+	if r.positional {
+		return r.toPositional(s, contents)
+	}
+	return r.toKeyed(s)
+}
+
+// toKeyed adds edits inserting a key before each field value in the given
+// literal.
+func (r *ConvertStructLit) toKeyed(s *structLit) string {
+	if len(s.lit.Elts) > s.st.NumFields() {
+		return "The struct literal has more values than its type has fields"
+	}
+	edits := r.editSet(r.files, s.filename)
+	for i, elt := range s.lit.Elts {
+		edits.Add(&text.Extent{Offset: r.OffsetOfPos(elt.Pos())},
+			s.st.Field(i).Name()+": ")
+	}
+	return ""
+}
+
+// toPositional adds edits replacing the keyed fields of the given literal
+// with the field values, in the order in which the fields are declared.
+func (r *ConvertStructLit) toPositional(s *structLit, contents []byte) string {
+	if len(s.lit.Elts) != s.st.NumFields() {
+		return "The struct literal does not include every field, so " +
+			"it cannot be converted to positional fields"
+	}
+	for i := 0; i < s.st.NumFields(); i++ {
+		if field := s.st.Field(i); !field.Exported() && field.Pkg() != s.pkg.Types {
+			return "The struct type has unexported fields, so a literal " +
+				"outside its package cannot have positional fields"
+		}
+	}
+
+	values := make([]ast.Expr, s.st.NumFields())
+	reordered := false
+	for i, elt := range s.lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return "The struct literal mixes keyed and positional fields"
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			return "The struct literal has an invalid key"
+		}
+		index := fieldIndex(s.st, key.Name)
+		if index < 0 {
+			return "The struct literal has an invalid key: " + key.Name
+		}
+		values[index] = kv.Value
+		reordered = reordered || index != i
+	}
+	if reordered {
+		for _, value := range values {
+			if hasSideEffects(value, s.pkg.TypesInfo) {
+				return "Reordering the fields of the struct literal " +
+					"could change the order in which their values are " +
+					"evaluated"
+			}
+		}
+	}
+
+	edits := r.editSet(r.files, s.filename)
+	for i, elt := range s.lit.Elts {
+		value := values[i]
+		edits.Add(r.Extent(elt), string(contents[r.OffsetOfPos(value.Pos()):r.OffsetOfPos(value.End())]))
+	}
+	return ""
+}
+
+// fieldIndex returns the index of the field with the given name in the given
+// struct, or -1 if there is no such field.
+func fieldIndex(st *types.Struct, name string) int {
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i).Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasSideEffects returns true if the given expression may have side effects:
+// it contains a function call (other than a conversion) or a receive
+// operation.
+func hasSideEffects(expr ast.Expr, info *types.Info) bool {
+	result := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if tv, ok := info.Types[n.Fun]; !ok || !tv.IsType() {
+				result = true
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW {
+				result = true
+			}
+		case *ast.FuncLit:
+			return false // Not evaluated unless called
+		}
+		return !result
+	})
+	return result
+}
+
+const convertStructLitDoc = `
+  <h4>Purpose</h4>
+  <p>The Convert Struct Literals refactoring converts struct literals with
+  positional fields (e.g., <tt>image.Point{1, 2}</tt>) to literals with
+  keyed fields (e.g., <tt>image.Point{X: 1, Y: 2}</tt>).  Keyed fields make
+  literals easier to read, and they allow fields to be added to or reordered
+  in a struct type without breaking its literals.  (<tt>go vet</tt> reports
+  literals of imported struct types with positional fields.)  The
+  refactoring can also convert keyed fields back to positional fields.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a struct literal (to convert only that literal), or the
+    declaration or name of a struct type (to convert every literal of that
+    type).</li>
+    <li>Activate the Convert Struct Literals refactoring.</li>
+    <li>Optionally, set "Positional" to true to convert keyed fields to
+    positional fields.</li>
+    <li>Optionally, set "Entire Package" to true to convert every struct
+    literal in the package, regardless of the selection.</li>
+  </ol>
+
+  <p>When a type or package is converted, literals that cannot be converted
+  are reported as warnings and left unchanged.</p>
+
+  <p>An error will be reported if the selected literal cannot be converted.
+  Keyed fields cannot be converted to positional fields if:</p>
+  <ul>
+    <li>The literal does not include every field of the struct.</li>
+    <li>The struct has unexported fields, and the literal is in a different
+    package.</li>
+    <li>The fields must be reordered, and their values may have side effects
+    (e.g., function calls), since reordering them would change the order in
+    which they are evaluated.</li>
+  </ul>
+`
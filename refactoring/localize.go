@@ -0,0 +1,506 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Localize Variable refactoring, which moves the
+// declaration of a package-level variable that is used by only one function
+// into the body of that function.
+
+package refactoring
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/names"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/packages"
+)
+
+// A LocalizeVar refactoring moves the declaration of a package-level variable
+// into the only function that uses it, so that the variable becomes a local
+// variable of that function.  The variable must not be modified, since a
+// package-level variable retains its value between calls, while a local
+// variable is initialized each time the function is called.
+type LocalizeVar struct {
+	RefactoringBase
+	files  *sourceFiles
+	global *types.Var
+	spec   *ast.ValueSpec
+	decl   *ast.GenDecl
+	// The function that uses the variable, along with the package and
+	// file containing it
+	funcDecl *ast.FuncDecl
+	funcPkg  *packages.Package
+	funcFile string
+}
+
+func (r *LocalizeVar) Description() *Description {
+	return &Description{
+		Name:      "Localize Variable",
+		Synopsis:  "Moves a package-level variable into the only function that uses it",
+		Usage:     "",
+		HTMLDoc:   localizeVarDoc,
+		Multifile: true,
+		Params:    nil,
+		Hidden:    false,
+		Quality:   Testing,
+	}
+}
+
+func (r *LocalizeVar) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+	r.spec, r.decl, r.funcDecl, r.funcPkg, r.funcFile = nil, nil, nil, nil, ""
+
+	if !r.findDecl() || !r.findFunc() {
+		return &r.Result
+	}
+	r.checkVar()
+	r.checkFunc()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.checkInitializer()
+
+	r.addEdits()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findDecl finds the package-level variable whose declaration (or use) is
+// selected, along with its spec and declaration.  It logs an error and returns
+// false if the selection is not such a variable.
+func (r *LocalizeVar) findDecl() bool {
+	id, ok := r.SelectedNode.(*ast.Ident)
+	if ok {
+		r.global, ok = r.SelectedNodePkg.TypesInfo.ObjectOf(id).(*types.Var)
+	}
+	if !ok || r.global.Pkg() == nil ||
+		r.global.Parent() != r.global.Pkg().Scope() {
+		r.Log.Error("Please select a package-level variable.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	if isInGoRoot(r.Filename) {
+		r.Log.Errorf("%s is defined in $GOROOT and cannot be moved",
+			r.global.Name())
+		return false
+	}
+	if usesCgo(r.File) {
+		r.Log.Error("Variables cannot be localized in files that use " +
+			"cgo (import \"C\")")
+		return false
+	}
+
+	for _, decl := range r.File.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Pos() > r.global.Pos() || decl.End() < r.global.Pos() {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			spec := spec.(*ast.ValueSpec)
+			for _, name := range spec.Names {
+				if name.Pos() == r.global.Pos() {
+					r.decl, r.spec = decl, spec
+				}
+			}
+		}
+	}
+	if r.spec == nil {
+		r.Log.Errorf("The declaration of %s must be in %s",
+			r.global.Name(), displayablePath(r.Filename, ""))
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return false
+	}
+	return true
+}
+
+// findFunc finds the only function that uses the variable.  It logs an error
+// and returns false if the variable is unused, or if it is used outside a
+// function or in more than one function.
+func (r *LocalizeVar) findFunc() bool {
+	uses := []*ast.Ident{}
+	for id := range names.FindOccurrences(r.global, r.Program) {
+		if id.Pos() != r.global.Pos() {
+			uses = append(uses, id)
+		}
+	}
+	if len(uses) == 0 {
+		r.Log.Errorf("%s is not used, so it cannot be moved into a "+
+			"function", r.global.Name())
+		r.Log.AssociateNode(r.spec)
+		return false
+	}
+	sort.Slice(uses, func(i, j int) bool { return uses[i].Pos() < uses[j].Pos() })
+
+	for _, id := range uses {
+		pkg, path, _ := r.Program.PathEnclosingInterval(id.Pos(), id.End())
+		var funcDecl *ast.FuncDecl
+		for _, node := range path {
+			if decl, ok := node.(*ast.FuncDecl); ok {
+				funcDecl = decl
+			}
+		}
+		switch {
+		case funcDecl == nil:
+			r.Log.Errorf("%s is used outside of a function, so it "+
+				"cannot be moved into a function",
+				r.global.Name())
+		case r.funcDecl != nil && funcDecl != r.funcDecl:
+			r.Log.Errorf("%s is used by both %s and %s, so it cannot "+
+				"be moved into a single function",
+				r.global.Name(), r.funcDecl.Name.Name,
+				funcDecl.Name.Name)
+		default:
+			if r.funcDecl == nil {
+				r.funcDecl = funcDecl
+				r.funcPkg = pkg
+				r.funcFile = r.Program.Fset.Position(id.Pos()).Filename
+			}
+			continue
+		}
+		r.Log.AssociateNode(id)
+		return false
+	}
+	return true
+}
+
+// checkVar logs an error if the variable cannot be moved: it is declared
+// together with other variables, it is exported from a package other than
+// main, it has a compiler directive (e.g., //go:embed), or it is modified.
+func (r *LocalizeVar) checkVar() {
+	if len(r.spec.Names) > 1 {
+		r.Log.Errorf("%s is declared together with other variables, so "+
+			"its declaration cannot be moved", r.global.Name())
+		r.Log.AssociateNode(r.spec)
+		return
+	}
+	if r.global.Exported() && r.global.Pkg().Name() != "main" {
+		r.Log.Errorf("%s is exported, so it may be used by other "+
+			"packages", r.global.Name())
+		r.Log.AssociateNode(r.spec)
+		return
+	}
+	for _, doc := range []*ast.CommentGroup{r.decl.Doc, r.spec.Doc} {
+		if doc == nil {
+			continue
+		}
+		for _, c := range doc.List {
+			if strings.HasPrefix(c.Text, "//go:") {
+				r.Log.Errorf("%s has a compiler directive (%s), so "+
+					"it cannot be moved into a function",
+					r.global.Name(), c.Text)
+				r.Log.AssociateNode(c)
+				return
+			}
+		}
+	}
+	for id := range names.FindOccurrences(r.global, r.Program) {
+		pkg, path, _ := r.Program.PathEnclosingInterval(id.Pos(), id.End())
+		if id.Pos() != r.global.Pos() && isModifiedAt(pkg.TypesInfo, path) {
+			r.Log.Errorf("%s is modified, so moving it into %s would "+
+				"change its value between calls", r.global.Name(),
+				r.funcDecl.Name.Name)
+			r.Log.AssociateNode(id)
+			return
+		}
+	}
+}
+
+// checkFunc logs an error if the declaration cannot be moved into the
+// function: the function cannot be modified, it already declares a variable
+// with the same name in its outermost scope, or the names in the
+// declaration refer to different declarations in the function.
+func (r *LocalizeVar) checkFunc() {
+	if isInGoRoot(r.funcFile) {
+		r.Log.Errorf("%s is defined in $GOROOT and cannot be modified",
+			r.funcDecl.Name.Name)
+		return
+	}
+	if _, err := r.files.read(r.funcFile); err != nil {
+		r.Log.Error(err)
+		return
+	}
+	info := r.funcPkg.TypesInfo
+	scope := info.Scopes[r.funcDecl.Type]
+	if scope == nil {
+		return
+	}
+	if obj := scope.Lookup(r.global.Name()); obj != nil {
+		r.Log.Errorf("%s already declares %s, so a local variable "+
+			"with that name cannot be added", r.funcDecl.Name.Name,
+			r.global.Name())
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		r.Log.AssociateCode(CodeRenameConflict)
+		return
+	}
+
+	// Each name in the declaration must refer to the same thing at the
+	// beginning of the function body
+	pos := r.funcDecl.Body.Lbrace + 1
+	var check func(n ast.Node) bool
+	check = func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			// Only the qualifier (or receiver) needs to be checked
+			ast.Inspect(sel.X, check)
+			return false
+		}
+		return r.checkVisible(n, scope, pos)
+	}
+	ast.Inspect(r.spec, check)
+}
+
+// checkVisible logs an error and returns false if the given node is an
+// identifier referring to a package-level (or predeclared) object or to an
+// imported package, and it refers to something else (or nothing) at the given
+// position in the given scope of the function.
+func (r *LocalizeVar) checkVisible(n ast.Node, scope *types.Scope, pos token.Pos) bool {
+	id, ok := n.(*ast.Ident)
+	if !ok {
+		return true
+	}
+	obj := r.SelectedNodePkg.TypesInfo.Uses[id]
+	if obj == nil || obj.Parent() == nil {
+		return true
+	}
+	_, isPkgName := obj.(*types.PkgName)
+	if parent := obj.Parent(); !isPkgName && parent != types.Universe &&
+		parent.Parent() != types.Universe {
+		return true // Declared inside the initializer
+	}
+	_, found := scope.LookupParent(id.Name, pos)
+	if !sameObject(obj, found) {
+		r.Log.Errorf("%s refers to a different declaration (or is "+
+			"not visible) in %s", id.Name, r.funcDecl.Name.Name)
+		r.Log.AssociateNode(id)
+		r.Log.AssociateCode(CodeRenameConflict)
+		return false
+	}
+	return true
+}
+
+// sameObject returns true if the given objects (which may come from
+// different variants of a package, or, for imported package names, from
+// different files) denote the same entity.
+func sameObject(a, b types.Object) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a, ok := a.(*types.PkgName); ok {
+		b, ok := b.(*types.PkgName)
+		return ok && a.Imported().Path() == b.Imported().Path()
+	}
+	return a.Name() == b.Name() && a.Pos() == b.Pos()
+}
+
+// checkInitializer logs warnings if moving the variable's initializer into
+// the function could change when (or how often) it is evaluated in a way that
+// matters: if it calls functions, which will be called each time the function
+// is called rather than once during package initialization; if it refers to
+// other package-level variables, whose values may have changed by then; or if
+// the variable refers to data that may be modified through it, which will no
+// longer be shared between calls.
+func (r *LocalizeVar) checkInitializer() {
+	if len(r.spec.Values) == 0 {
+		return
+	}
+	info := r.SelectedNodePkg.TypesInfo
+	hasCall := false
+	var global *ast.Ident
+	ast.Inspect(r.spec.Values[0], func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if !isConversionOrBuiltin(info, n) {
+				hasCall = true
+			}
+		case *ast.Ident:
+			v, ok := info.Uses[n].(*types.Var)
+			if global == nil && ok && v.Pkg() != nil &&
+				v.Parent() == v.Pkg().Scope() {
+				global = n
+			}
+		}
+		return true
+	})
+
+	name, funcName := r.global.Name(), r.funcDecl.Name.Name
+	if hasCall {
+		r.Log.Warnf("The initializer of %s will be evaluated each time "+
+			"%s is called, rather than once when the package is "+
+			"initialized", name, funcName)
+	}
+	if global != nil {
+		r.Log.Warnf("The initializer of %s refers to %s, whose value "+
+			"may be different when %s is called than when the "+
+			"package is initialized", name, global.Name, funcName)
+	}
+	if containsReferences(r.global.Type()) {
+		r.Log.Warnf("If %s modifies the data that %s refers to, those "+
+			"changes will no longer persist between calls, since %s "+
+			"will be initialized on each call", funcName, name, name)
+	}
+}
+
+// isConversionOrBuiltin returns true if the given call is a type conversion
+// or a call to a built-in function (e.g., len or make).
+func isConversionOrBuiltin(info *types.Info, call *ast.CallExpr) bool {
+	if tv, ok := info.Types[call.Fun]; ok && (tv.IsType() || tv.IsBuiltin()) {
+		return true
+	}
+	return false
+}
+
+// containsReferences returns true if a value of the given type may refer to
+// other data (i.e., it is, or contains, a pointer, slice, map, channel,
+// function, or interface).
+func containsReferences(t types.Type) bool {
+	switch t := t.Underlying().(type) {
+	case *types.Basic:
+		return t.Kind() == types.UnsafePointer
+	case *types.Array:
+		return containsReferences(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if containsReferences(t.Field(i).Type()) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// addEdits removes the variable's declaration and inserts it at the
+// beginning of the function body.
+func (r *LocalizeVar) addEdits() {
+	var removed *declText
+	var moved string
+	if len(r.decl.Specs) == 1 {
+		// Move the declaration's doc comment along with the spec
+		removed = r.newDeclText(r.files, r.Filename, r.File, r.decl)
+		spec := r.newDeclText(r.files, r.Filename, r.File, r.spec)
+		moved = string(r.FileContents[removed.start:r.offset(r.decl.Pos())]) +
+			"var " + string(r.FileContents[spec.start:spec.end])
+	} else {
+		removed = r.newDeclText(r.files, r.Filename, r.File, r.spec)
+		moved = "var " + string(r.FileContents[removed.start:removed.end])
+	}
+
+	// Imports used by the initializer are still needed if the function is
+	// in the same file
+	keep := map[*types.PkgName]bool{}
+	if r.funcFile == r.Filename {
+		ast.Inspect(r.spec, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				if pkgName, ok := r.SelectedNodePkg.TypesInfo.Uses[id].(*types.PkgName); ok {
+					keep[pkgName] = true
+				}
+			}
+			return true
+		})
+	}
+	r.removeDecls([]*declText{removed}, r.files, keep)
+
+	contents := r.files.contents[r.funcFile]
+	if r.Edits[r.funcFile] == nil {
+		r.Edits[r.funcFile] = text.NewEditSet()
+		r.Edits[r.funcFile].SetBase(contents)
+	}
+	offset := r.offset(r.funcDecl.Body.Lbrace) + 1
+	if err := r.Edits[r.funcFile].Add(&text.Extent{Offset: offset},
+		"\n"+moved); err != nil {
+		r.Log.Error(err)
+		return
+	}
+}
+
+// offset returns the byte offset of the given position in its file.
+func (r *LocalizeVar) offset(pos token.Pos) int {
+	return r.Program.Fset.Position(pos).Offset
+}
+
+const localizeVarDoc = `
+  <h4>Purpose</h4>
+  <p>The Localize Variable refactoring moves the declaration of a
+  package-level variable into the only function that uses it, so that the
+  variable becomes a local variable of that function.  This reduces the
+  amount of state shared by the functions in a package.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the name of a package-level variable (in its declaration).</li>
+    <li>Activate the Localize Variable refactoring.</li>
+  </ol>
+
+  <p>The declaration, including its doc comment, is moved to the beginning of
+  the function's body.</p>
+
+  <h4>Example</h4>
+  <p>In this example, <tt>greeting</tt> is used only by <tt>greet</tt>, so its
+  declaration is moved into <tt>greet</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+  <pre>// The greeting to display
+var <span class="highlight">greeting</span> = "Hello"
+
+func greet(name string) {
+    fmt.Println(greeting, name)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+  <pre>func greet(name string) {
+    <span class="highlight">// The greeting to display
+    var greeting = "Hello"</span>
+    fmt.Println(greeting, name)
+}</pre>
+      </td>
+    </tr>
+  </table>
+
+  <p>A package-level variable is initialized once, when the package is
+  initialized, and it keeps its value between calls to the function.  A local
+  variable is initialized each time the function is called.  So, an error will
+  be reported if the variable is assigned, incremented, or has its address
+  taken, and a warning will be reported if:</p>
+  <ul>
+    <li>The variable's initializer calls a function (which will be called
+    each time the function is called).</li>
+    <li>The variable's initializer refers to other package-level variables
+    (whose values may be different when the function is called).</li>
+    <li>The variable may refer to other data, such as a map or a slice's
+    elements (changes to that data will no longer persist between
+    calls).</li>
+  </ul>
+
+  <p>An error will also be reported if:</p>
+  <ul>
+    <li>The variable is unused, or is used outside of a function or by more
+    than one function.</li>
+    <li>The variable is exported (unless it is in package <tt>main</tt>),
+    since other packages may use it.</li>
+    <li>The variable is declared together with other variables (e.g.,
+    <tt>var a, b = 1, 2</tt>), or has a compiler directive (e.g.,
+    <tt>//go:embed</tt>).</li>
+    <li>The function already declares a variable with the same name in its
+    outermost block, or a name in the declaration would refer to something
+    else inside the function (e.g., a parameter with the same name).</li>
+  </ul>
+`
@@ -38,18 +38,66 @@ const (
 	Error                   // the refactoring transformation is, or might be, invalid
 )
 
+// Machine-readable codes that may be associated with log entries (see
+// Log.AssociateCode).  Text editors can use these to recognize particular
+// diagnostics without parsing the (human-readable) message text.
+const (
+	CodeTypeError           = "TYPE_ERROR"               // Semantic error in the input program
+	CodeIntroducedError     = "INTRODUCED_ERROR"         // Error introduced by the transformation
+	CodeInvalidArgs         = "INVALID_ARGS"             // Arguments do not match the Description
+	CodeInvalidSelection    = "INVALID_SELECTION"        // Selection is not valid for the refactoring
+	CodeInvalidName         = "INVALID_NAME"             // Not a valid Go identifier
+	CodeRenameConflict      = "RENAME_CONFLICT"          // New name conflicts with an existing declaration
+	CodeRenameCommentWord   = "RENAME_COMMENT_WORD"      // Word in a comment that was not renamed
+	CodeExtractAnonFunc     = "EXTRACT_ANON_FUNC"        // Extracted code is in/contains a function literal
+	CodeExtractDefer        = "EXTRACT_DEFER"            // Extracted code contains defer statements
+	CodeExtractReturn       = "EXTRACT_RETURN"           // Extracted code contains return statements
+	CodeExtractMultiEntries = "EXTRACT_MULTIPLE_ENTRIES" // Multiple control flow paths into the selection
+	CodeExtractMultiExits   = "EXTRACT_MULTIPLE_EXITS"   // Multiple control flow paths out of the selection
+	CodeExtractBranch       = "EXTRACT_BRANCH"           // Branch statement targets a statement outside the selection
+	CodeExtractAddressTaken = "EXTRACT_ADDRESS_TAKEN"    // Extraction would copy a variable whose address is taken
+	CodeMoveDependence      = "MOVE_DEPENDENCE"          // Moved statements depend on the statements they move past
+	CodeExtractIterator     = "EXTRACT_ITERATOR"         // Loop cannot be converted to range over an iterator
+	CodeGoVersion           = "GO_VERSION"               // Refactored code requires a newer version of Go
+	CodeErrgroupPattern     = "ERRGROUP_PATTERN"         // Code does not match the WaitGroup and error channel pattern
+)
+
+// MaxAggregatePositions is the number of positions that drivers list for an
+// entry that combines several identical entries (see Log.Aggregate).
+const MaxAggregatePositions = 3
+
 // A Entry constitutes a single entry in a Log.  Every Entry has a
 // severity and a message.  If the filename is a nonempty string, the Entry
 // is associated with a particular position in the given file.  Some log
 // entries are marked as "initial."  These indicate semantic errors that were
 // present in the input file (e.g., unresolved identifiers, unnecessary
 // imports, etc.) before the refactoring was started.
+//
+// An Entry may also have a machine-readable Code (one of the Code constants
+// defined in this package, or empty) and a list of Related positions, such as
+// the location of a conflicting declaration.  If the Entry was produced by
+// Log.Aggregate, Count is the number of identical entries it represents;
+// otherwise, Count is 0.
 type Entry struct {
 	isInitial bool
+	isDemoted bool
 	Severity  Severity
 	Message   string
 	Pos       token.Pos
 	End       token.Pos
+	Code      string
+	Related   []*Related
+	Count     int
+}
+
+// A Related position identifies a region of source code that is relevant to a
+// log entry but is not the entry's primary location; for example, when a
+// Rename would introduce a conflict, the conflicting declaration is a related
+// position.
+type Related struct {
+	Message string
+	Pos     token.Pos
+	End     token.Pos
 }
 
 func (entry *Entry) String() string {
@@ -63,6 +111,9 @@ func (entry *Entry) String() string {
 		buffer.WriteString("Error: ")
 	}
 	buffer.WriteString(entry.Message)
+	if entry.Count > 1 {
+		fmt.Fprintf(&buffer, " (%d occurrences)", entry.Count)
+	}
 	return buffer.String()
 }
 
@@ -163,6 +214,34 @@ func (log *Log) AssociateNode(node ast.Node) {
 	log.AssociatePos(node.Pos(), node.End())
 }
 
+// AssociateCode sets the machine-readable code of the most recently-logged
+// entry.
+func (log *Log) AssociateCode(code string) {
+	if len(log.Entries) == 0 {
+		return
+	}
+	log.Entries[len(log.Entries)-1].Code = code
+}
+
+// AddRelated adds a related position, described by the given message, to the
+// most recently-logged entry.
+func (log *Log) AddRelated(message string, start, end token.Pos) {
+	if len(log.Entries) == 0 {
+		return
+	}
+	entry := log.Entries[len(log.Entries)-1]
+	entry.Related = append(entry.Related, &Related{
+		Message: message,
+		Pos:     start,
+		End:     end})
+}
+
+// AddRelatedNode adds the region of source code corresponding to the given
+// AST Node as a related position of the most recently-logged entry.
+func (log *Log) AddRelatedNode(message string, node ast.Node) {
+	log.AddRelated(message, node.Pos(), node.End())
+}
+
 // MarkInitial marks all entries that have been logged so far as initial
 // entries.  Subsequent entries will not be marked as initial unless this
 // method is called again at a later point in time.
@@ -179,17 +258,26 @@ func (log *Log) String() string {
 }
 
 // Write outputs this log in a GNU-style 'file:line:col: message' format.
+// Related positions are listed on indented lines following their entry.
 // Filenames are displayed relative to the given directory, if possible.
 func (log *Log) Write(out io.Writer, cwd string) {
 	for _, entry := range log.Entries {
-		if log.Fset != nil && entry.Pos.IsValid() {
-			pos := log.Fset.Position(entry.Pos)
-			fmt.Fprintf(out, "%s:%d:%d: ",
-				displayablePath(pos.Filename, cwd),
-				pos.Line,
-				pos.Column)
-		}
+		log.writePos(out, entry.Pos, cwd)
 		fmt.Fprintf(out, "%s\n", entry.String())
+		for _, related := range entry.Related {
+			log.writePos(out, related.Pos, cwd)
+			fmt.Fprintf(out, "\t%s\n", related.Message)
+		}
+	}
+}
+
+func (log *Log) writePos(out io.Writer, p token.Pos, cwd string) {
+	if log.Fset != nil && p.IsValid() {
+		pos := log.Fset.Position(p)
+		fmt.Fprintf(out, "%s:%d:%d: ",
+			displayablePath(pos.Filename, cwd),
+			pos.Line,
+			pos.Column)
 	}
 }
 
@@ -197,8 +285,7 @@ func (log *Log) Write(out io.Writer, cwd string) {
 // current directory.  If a relative path cannot be determined, file is
 // returned as-is.  This is intended for use in displaying error messages.
 func displayablePath(file, cwd string) string {
-	stdin, _ := filesystem.FakeStdinPath()
-	if file == stdin {
+	if filesystem.IsFakeStdinPath(file) {
 		return "<stdin>"
 	}
 
@@ -264,13 +351,59 @@ func (log *Log) RemoveInitialEntries() {
 	log.Entries = newEntries
 }
 
+// Aggregate combines entries with the same severity, message, and code into a
+// single entry, so a problem that occurs many times (e.g., an error
+// introduced at every reference to a renamed identifier) is reported once.
+// The first such entry is retained, its Count is set to the number of
+// entries combined, and the positions of the other entries are added to it
+// as related positions, up to a total of maxPositions positions.  Entries
+// that already have related positions are not combined, since those
+// positions describe a particular occurrence.  Drivers should aggregate the
+// log unless the user has requested verbose output.
+func (log *Log) Aggregate(maxPositions int) {
+	type key struct {
+		isInitial bool
+		severity  Severity
+		message   string
+		code      string
+	}
+	first := map[key]*Entry{}
+	newEntries := []*Entry{}
+	for _, entry := range log.Entries {
+		if len(entry.Related) > 0 {
+			newEntries = append(newEntries, entry)
+			continue
+		}
+		k := key{entry.isInitial, entry.Severity, entry.Message, entry.Code}
+		prev, ok := first[k]
+		if !ok {
+			first[k] = entry
+			newEntries = append(newEntries, entry)
+			continue
+		}
+		if prev.Count == 0 {
+			prev.Count = 1
+		}
+		prev.Count++
+		if entry.Pos.IsValid() && len(prev.Related)+1 < maxPositions {
+			prev.Related = append(prev.Related, &Related{
+				Message: "Also occurs here",
+				Pos:     entry.Pos,
+				End:     entry.End})
+		}
+	}
+	log.Entries = newEntries
+}
+
 // ChangeInitialErrorsToWarnings changes the severity of any initial errors to
-// Warning severity.
+// Warning severity.  Errors that turn out to be relevant to the refactoring
+// can be changed back using RestoreInitialErrors.
 func (log *Log) ChangeInitialErrorsToWarnings() {
 	newEntries := []*Entry{}
 	for _, entry := range log.Entries {
 		if entry.isInitial && entry.Severity == Error {
 			entry.Severity = Warning
+			entry.isDemoted = true
 			newEntries = append(newEntries, entry)
 		} else {
 			newEntries = append(newEntries, entry)
@@ -278,3 +411,18 @@ func (log *Log) ChangeInitialErrorsToWarnings() {
 	}
 	log.Entries = newEntries
 }
+
+// RestoreInitialErrors changes the severity of initial errors that were
+// changed to warnings by ChangeInitialErrorsToWarnings back to Error, if the
+// given predicate returns true for them.  It returns the restored entries.
+func (log *Log) RestoreInitialErrors(predicate func(*Entry) bool) []*Entry {
+	restored := []*Entry{}
+	for _, entry := range log.Entries {
+		if entry.isDemoted && predicate(entry) {
+			entry.Severity = Error
+			entry.isDemoted = false
+			restored = append(restored, entry)
+		}
+	}
+	return restored
+}
@@ -11,11 +11,11 @@ import (
 )
 
 func TestEntry(t *testing.T) {
-	e := Entry{false, Info, "Message", token.NoPos, token.NoPos}
+	e := Entry{Severity: Info, Message: "Message"}
 	assertEquals("Message", e.String(), t)
-	e = Entry{false, Warning, "Message", token.NoPos, token.NoPos}
+	e = Entry{Severity: Warning, Message: "Message"}
 	assertEquals("Warning: Message", e.String(), t)
-	e = Entry{false, Error, "Message", token.NoPos, token.NoPos}
+	e = Entry{Severity: Error, Message: "Message"}
 	assertEquals("Error: Message", e.String(), t)
 }
 
@@ -57,6 +57,27 @@ file2:2:1: Error: Another error
 	assertEquals(expected, log.String(), t)
 }
 
+func TestRelated(t *testing.T) {
+	fset := token.NewFileSet()
+	file1 := fset.AddFile("file1", fset.Base(), 10)
+	file1.AddLine(5)
+
+	log := NewLog()
+	log.Fset = fset
+	log.Error("Conflict")
+	log.AssociatePos(file1.Pos(1), file1.Pos(2))
+	log.AssociateCode(CodeRenameConflict)
+	log.AddRelated("Conflicting declaration", file1.Pos(6), file1.Pos(7))
+	if log.Entries[0].Code != CodeRenameConflict ||
+		len(log.Entries[0].Related) != 1 {
+		t.Fatal("Code or related position not recorded")
+	}
+	expected := `file1:1:2: Error: Conflict
+file1:2:2: 	Conflicting declaration
+`
+	assertEquals(expected, log.String(), t)
+}
+
 // assertEquals is a utility method for unit tests that marks a function as
 // having failed if expected != actual
 // TODO(jeff): Copied from util_test.go
@@ -65,3 +86,57 @@ func assertEquals(expected string, actual string, t *testing.T) {
 		t.Fatalf("Expected: %s Actual: %s", expected, actual)
 	}
 }
+
+func TestAggregate(t *testing.T) {
+	fset := token.NewFileSet()
+	file1 := fset.AddFile("file1", fset.Base(), 10)
+	file1.AddLine(5)
+
+	log := NewLog()
+	log.Fset = fset
+	for i := 0; i < 5; i++ {
+		log.Error("Duplicate")
+		log.AssociatePos(file1.Pos(i), file1.Pos(i))
+		log.AssociateCode(CodeIntroducedError)
+		log.Warn("Duplicate")
+	}
+	log.Error("Conflict")
+	log.AddRelated("Conflicting declaration", file1.Pos(6), file1.Pos(7))
+	log.Error("Conflict")
+	log.AddRelated("Conflicting declaration", file1.Pos(8), file1.Pos(9))
+	log.Aggregate(MaxAggregatePositions)
+	if len(log.Entries) != 4 || log.Entries[0].Count != 5 ||
+		log.Entries[1].Count != 5 || log.Entries[2].Count != 0 {
+		t.Fatalf("Entries were not aggregated correctly:\n%s", log)
+	}
+	expected := `file1:1:1: Error: Duplicate (5 occurrences)
+file1:1:2: 	Also occurs here
+file1:1:3: 	Also occurs here
+Warning: Duplicate (5 occurrences)
+Error: Conflict
+file1:2:2: 	Conflicting declaration
+Error: Conflict
+file1:2:4: 	Conflicting declaration
+`
+	assertEquals(expected, log.String(), t)
+}
+
+func TestRestoreInitialErrors(t *testing.T) {
+	log := NewLog()
+	log.Error("relevant")
+	log.Error("irrelevant")
+	log.MarkInitial()
+	log.Error("new")
+	log.ChangeInitialErrorsToWarnings()
+	if log.Entries[0].Severity != Warning || log.Entries[2].Severity != Error {
+		t.Fatal("Initial errors were not changed to warnings")
+	}
+	restored := log.RestoreInitialErrors(func(entry *Entry) bool {
+		return entry.Message != "irrelevant"
+	})
+	if len(restored) != 1 || restored[0] != log.Entries[0] ||
+		log.Entries[0].Severity != Error ||
+		log.Entries[1].Severity != Warning {
+		t.Fatalf("Wrong entries restored:\n%s", log)
+	}
+}
@@ -0,0 +1,726 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Move Statement refactoring, which moves a statement
+// (or a sequence of statements) up or down past the adjacent statement in the
+// same block, provided that neither depends on the other.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/godoctor/godoctor/analysis/dataflow"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// A MoveStmt refactoring swaps the selected statements with the statement
+// immediately before (when moving up) or after (when moving down) them in the
+// enclosing block.  This preserves the program's behavior only if there is no
+// dependence between the statements, which is determined using reaching
+// definitions and live variables (for local variables) and conservatively for
+// other side effects (e.g., function calls).  Otherwise, the dependence that
+// prevents the move is reported.
+type MoveStmt struct {
+	RefactoringBase
+	up bool // Move the selected statements up, rather than down
+	// The statements that will execute first and second, before the move
+	first, second *stmtRange
+}
+
+func (r *MoveStmt) Description() *Description {
+	return &Description{
+		Name:      "Move Statement",
+		Synopsis:  "Moves statements up or down past an adjacent statement",
+		Usage:     "<up|down>",
+		HTMLDoc:   moveStmtDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Direction:",
+			Prompt:       "Move the selected statements up or down (up|down).",
+			DefaultValue: "down",
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *MoveStmt) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	switch strings.ToLower(strings.TrimSpace(config.Args[0].(string))) {
+	case "up":
+		r.up = true
+	case "down":
+		r.up = false
+	default:
+		r.Log.Errorf("The direction must be \"up\" or \"down\", not %q",
+			config.Args[0])
+		r.Log.AssociateCode(CodeInvalidArgs)
+		return &r.Result
+	}
+
+	if !r.findStmts() {
+		return &r.Result
+	}
+	r.checkControlFlow(r.first)
+	r.checkControlFlow(r.second)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	if !r.checkScopes() || !r.checkDataflow() || !r.checkSideEffects() {
+		return &r.Result
+	}
+
+	r.addEdits()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findStmts finds the selected statements and the statement they will move
+// past, setting r.first and r.second.  It logs an error and returns false if
+// the selection is not a sequence of statements in a block or there is no
+// statement to move past.
+func (r *MoveStmt) findStmts() bool {
+	selected, err := newStmtRange(r.File, r.SelectionStart, r.SelectionEnd, r.SelectedNodePkg)
+	if err != nil {
+		r.Log.Error("Please select one or more statements in a block.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	neighbor := selected.adjacent(r.up)
+	if neighbor == nil {
+		where := "last"
+		if r.up {
+			where = "first"
+		}
+		r.Log.Errorf("The selected statements cannot be moved, since "+
+			"they are already the %s statements in the block.", where)
+		r.Log.AssociatePos(selected.Pos(), selected.End())
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	r.first, r.second = selected, neighbor
+	if r.up {
+		r.first, r.second = neighbor, selected
+	}
+	return true
+}
+
+// adjacent returns a stmtRange for the statement immediately before (if up is
+// true) or after the given statements in the enclosing block, or nil if there
+// is no such statement.
+func (r *stmtRange) adjacent(up bool) *stmtRange {
+	idx := r.lastIdx + 1
+	if up {
+		idx = r.firstIdx - 1
+	}
+	if idx < 0 || idx >= len(r.blockStmts()) {
+		return nil
+	}
+	result := *r
+	result.firstIdx, result.lastIdx = idx, idx
+	result.analyzeBlocks()
+	return &result
+}
+
+// checkControlFlow logs an error if the given statements contain a return
+// statement, a branch statement that transfers control outside them, or a
+// label that is the target of a goto statement, since moving them would
+// change which statements execute.
+func (r *MoveStmt) checkControlFlow(stmts *stmtRange) {
+	for _, branch := range stmts.BranchesOutOfRange() {
+		r.Log.Errorf("The statements cannot be reordered, since this %s "+
+			"statement transfers control to a statement outside "+
+			"them.", branch.Tok)
+		r.Log.AssociateNode(branch)
+		r.Log.AssociateCode(CodeMoveDependence)
+	}
+	ast.Inspect(stmts.enclosingFunc, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ReturnStmt:
+			if stmts.Contains(n) && !r.inFuncLit(stmts, n) {
+				r.Log.Error("The statements cannot be reordered, " +
+					"since this return statement would prevent " +
+					"the other statement from executing.")
+				r.Log.AssociateNode(n)
+				r.Log.AssociateCode(CodeMoveDependence)
+			}
+		case *ast.BranchStmt:
+			if n.Tok != token.GOTO || n.Label == nil {
+				return true
+			}
+			obj := stmts.pkgInfo.TypesInfo.ObjectOf(n.Label)
+			if obj != nil && stmts.Pos() <= obj.Pos() && obj.Pos() < stmts.End() {
+				r.Log.Errorf("The statements cannot be reordered, "+
+					"since the label %s is the target of a goto "+
+					"statement.", n.Label.Name)
+				r.Log.AssociatePos(obj.Pos(), obj.Pos())
+				r.Log.AssociateCode(CodeMoveDependence)
+				r.Log.AddRelatedNode("The goto statement", n)
+			}
+		}
+		return true
+	})
+}
+
+// inFuncLit returns true if the given node is inside a function literal in
+// the given statements.
+func (r *MoveStmt) inFuncLit(stmts *stmtRange, node ast.Node) bool {
+	result := false
+	stmts.Inspect(func(n ast.Node) bool {
+		if lit, ok := n.(*ast.FuncLit); ok &&
+			lit.Pos() <= node.Pos() && node.End() <= lit.End() {
+			result = true
+		}
+		return !result
+	})
+	return result
+}
+
+// checkScopes logs an error and returns false if moving the statements would
+// change what an identifier refers to: if the second statement refers to
+// something declared by the first (so it would be used before it is
+// declared), or if it declares a name that the first statement uses to refer
+// to something else (so the new declaration would shadow it).
+func (r *MoveStmt) checkScopes() bool {
+	info := r.SelectedNodePkg.TypesInfo
+	ok := true
+	r.second.Inspect(func(n ast.Node) bool {
+		id, isIdent := n.(*ast.Ident)
+		if !ok || !isIdent {
+			return ok
+		}
+		obj := info.Uses[id]
+		if obj != nil && r.first.Pos() <= obj.Pos() && obj.Pos() < r.first.End() &&
+			obj.Parent() == r.first.Scope() {
+			r.Log.Errorf("The statements cannot be reordered, since %s "+
+				"is declared on line %d and used on line %d.",
+				id.Name, r.line(obj.Pos()), r.line(id.Pos()))
+			r.Log.AssociateNode(id)
+			r.Log.AssociateCode(CodeMoveDependence)
+			ok = false
+		}
+		if obj := info.Defs[id]; obj != nil && obj.Parent() == r.second.Scope() {
+			if use := r.findShadowed(id.Name, obj.Parent()); use != nil {
+				r.Log.Errorf("The statements cannot be reordered, "+
+					"since the declaration of %s on line %d "+
+					"would change the meaning of %s on line %d.",
+					id.Name, r.line(id.Pos()), use.Name,
+					r.line(use.Pos()))
+				r.Log.AssociateNode(use)
+				r.Log.AssociateCode(CodeMoveDependence)
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok
+}
+
+// findShadowed returns an identifier in the first statement with the given
+// name that refers to something declared in the given scope or one enclosing
+// it, so that it would refer to a declaration with that name in the given
+// scope if one were added before it.  It returns nil if there is none.
+func (r *MoveStmt) findShadowed(name string, scope *types.Scope) *ast.Ident {
+	info := r.SelectedNodePkg.TypesInfo
+	var result *ast.Ident
+	var find func(n ast.Node) bool
+	find = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			// Only the qualifier (or receiver) can be shadowed
+			ast.Inspect(n.X, find)
+			return false
+		case *ast.Ident:
+			if obj := info.Uses[n]; result == nil && n.Name == name &&
+				obj != nil && enclosesScope(obj.Parent(), scope) {
+				result = n
+			}
+		}
+		return result == nil
+	}
+	r.first.Inspect(find)
+	return result
+}
+
+// enclosesScope returns true if the given outer scope is the given inner
+// scope or one of its ancestors.
+func enclosesScope(outer, inner *types.Scope) bool {
+	for s := inner; s != nil; s = s.Parent() {
+		if s == outer {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDataflow logs an error and returns false if there is a dependence
+// between the first and second statements involving a local variable: if a
+// definition in the first statement reaches a use in the second (a flow
+// dependence), if the first uses a variable that the second modifies (an anti
+// dependence), or if both modify a variable that is live after them (an
+// output dependence).
+func (r *MoveStmt) checkDataflow() bool {
+	pkg := r.SelectedNodePkg
+	defUse := dataflow.DefUse(r.first.cfg, pkg)
+	for _, def := range r.first.blocksInRange {
+		uses := []ast.Stmt{}
+		for use := range defUse[def] {
+			if r.second.Contains(use) {
+				uses = append(uses, use)
+			}
+		}
+		r.first.cfg.Sort(uses)
+		asgt, updt, decl, _ := dataflow.ReferencedVars([]ast.Stmt{def}, pkg)
+		for _, use := range uses {
+			_, _, _, used := dataflow.ReferencedVars([]ast.Stmt{use}, pkg)
+			for _, v := range sortedVars(used) {
+				if hasVar(v, asgt, updt, decl) {
+					return r.dependence("%s is assigned on line "+
+						"%d and then used on line %d", v,
+						r.reference(def, v), r.reference(use, v))
+				}
+			}
+		}
+	}
+
+	_, _, _, firstUsed := dataflow.ReferencedVars(r.first.blocksInRange, pkg)
+	firstAsgt, firstUpdt, _, _ := dataflow.ReferencedVars(r.first.blocksInRange, pkg)
+	secondAsgt, secondUpdt, _, _ := dataflow.ReferencedVars(r.second.blocksInRange, pkg)
+	for _, v := range sortedVars(firstUsed) {
+		if hasVar(v, secondAsgt, secondUpdt) {
+			return r.dependence("%s is used on line %d and then "+
+				"assigned on line %d", v, r.reference(r.first, v),
+				r.reference(r.second, v))
+		}
+	}
+
+	live := map[*types.Var]struct{}{}
+	for _, v := range r.second.LocalsLiveAfterExit() {
+		live[v] = struct{}{}
+	}
+	for _, v := range sortedVars(live) {
+		if hasVar(v, firstAsgt, firstUpdt) && hasVar(v, secondAsgt, secondUpdt) {
+			return r.dependence("%s is assigned on line %d and line "+
+				"%d, and its value is used afterward", v,
+				r.reference(r.first, v), r.reference(r.second, v))
+		}
+	}
+	return true
+}
+
+// reference returns the first identifier in the given node that refers to the
+// given variable, or the node itself if there is none.
+func (r *MoveStmt) reference(node ast.Node, v *types.Var) ast.Node {
+	info := r.SelectedNodePkg.TypesInfo
+	var result ast.Node
+	inspect := func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && result == nil && info.ObjectOf(id) == v {
+			result = id
+		}
+		return result == nil
+	}
+	if stmts, ok := node.(*stmtRange); ok {
+		stmts.Inspect(inspect)
+	} else {
+		ast.Inspect(node, inspect)
+	}
+	if result == nil {
+		return node
+	}
+	return result
+}
+
+// dependence logs an error describing a dependence on the given variable
+// between the two given nodes, using a format with placeholders for the
+// variable's name and the nodes' line numbers, and returns false.
+func (r *MoveStmt) dependence(format string, v *types.Var, from, to ast.Node) bool {
+	r.Log.Errorf("The statements cannot be reordered, since "+format+".",
+		v.Name(), r.line(from.Pos()), r.line(to.Pos()))
+	r.Log.AssociateNode(to)
+	r.Log.AssociateCode(CodeMoveDependence)
+	r.Log.AddRelatedNode(fmt.Sprintf("%s is referenced here", v.Name()), from)
+	return false
+}
+
+// hasVar returns true if the given variable is in any of the given sets.
+func hasVar(v *types.Var, sets ...map[*types.Var]struct{}) bool {
+	for _, set := range sets {
+		if _, found := set[v]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedVars returns the variables in the given set, sorted by name.
+func sortedVars(set map[*types.Var]struct{}) []*types.Var {
+	result := make([]*types.Var, 0, len(set))
+	for v := range set {
+		result = append(result, v)
+	}
+	SortVars(result)
+	return result
+}
+
+// A sideEffect is a part of a statement that may read or modify memory other
+// than local variables (or have some other side effect, like a function call),
+// which the dataflow analysis does not track.
+type sideEffect struct {
+	node ast.Node
+	what string // description, e.g., "the call to f"
+}
+
+// checkSideEffects logs an error and returns false if one statement may
+// modify memory that the other reads or modifies (or otherwise have a side
+// effect that may affect the other), so that their order may matter.
+func (r *MoveStmt) checkSideEffects() bool {
+	escaped := r.escapedVars()
+	firstRead, firstWrite := r.sideEffects(r.first, escaped)
+	secondRead, secondWrite := r.sideEffects(r.second, escaped)
+	var a, b *sideEffect
+	switch {
+	case firstWrite != nil && secondWrite != nil:
+		a, b = firstWrite, secondWrite
+	case firstWrite != nil && secondRead != nil:
+		a, b = firstWrite, secondRead
+	case firstRead != nil && secondWrite != nil:
+		a, b = firstRead, secondWrite
+	default:
+		return true
+	}
+	r.Log.Errorf("The statements cannot be reordered, since %s on line %d "+
+		"may interfere with %s on line %d.", a.what, r.line(a.node.Pos()),
+		b.what, r.line(b.node.Pos()))
+	r.Log.AssociateNode(b.node)
+	r.Log.AssociateCode(CodeMoveDependence)
+	r.Log.AddRelatedNode(fmt.Sprintf("%s%s may interfere", strings.ToUpper(a.what[:1]), a.what[1:]), a.node)
+	return false
+}
+
+// escapedVars returns the local variables of the enclosing function that may
+// be read or modified other than by referring to them directly: those that are
+// referenced in function literals or whose addresses are taken (explicitly or
+// by calling a method with a pointer receiver).  Uses and assignments of these
+// variables are treated as side effects.
+func (r *MoveStmt) escapedVars() map[*types.Var]bool {
+	info := r.SelectedNodePkg.TypesInfo
+	result := map[*types.Var]bool{}
+	escape := func(expr ast.Expr) {
+		for {
+			switch e := expr.(type) {
+			case *ast.ParenExpr:
+				expr = e.X
+				continue
+			case *ast.SelectorExpr:
+				expr = e.X
+				continue
+			case *ast.IndexExpr:
+				expr = e.X
+				continue
+			case *ast.Ident:
+				if v, ok := info.Uses[e].(*types.Var); ok {
+					result[v] = true
+				}
+			}
+			return
+		}
+	}
+	ast.Inspect(r.first.enclosingFunc.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			ast.Inspect(n.Body, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok {
+					escape(id)
+				}
+				return true
+			})
+			return false
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				escape(n.X)
+			}
+		case *ast.SelectorExpr:
+			sel := info.Selections[n]
+			if sel != nil && sel.Kind() == types.MethodVal {
+				recv := sel.Obj().Type().(*types.Signature).Recv()
+				_, ptrRecv := recv.Type().(*types.Pointer)
+				_, ptrX := sel.Recv().(*types.Pointer)
+				if ptrRecv && !ptrX {
+					escape(n.X)
+				}
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// sideEffects returns the first part of the given statements that may read
+// memory (other than local variables) and the first part that may modify
+// memory or have another side effect, or nil if there are none.
+func (r *MoveStmt) sideEffects(stmts *stmtRange, escaped map[*types.Var]bool) (read, write *sideEffect) {
+	info := r.SelectedNodePkg.TypesInfo
+	found := func(result **sideEffect, node ast.Node, format string, args ...interface{}) {
+		if *result == nil {
+			*result = &sideEffect{node, fmt.Sprintf(format, args...)}
+		}
+	}
+	modifies := func(lhs ast.Expr) {
+		if what := r.memoryAccess(lhs, escaped); what != "" {
+			found(&write, lhs, "the assignment to %s", what)
+		}
+	}
+	stmts.Inspect(func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				modifies(lhs)
+			}
+		case *ast.IncDecStmt:
+			modifies(n.X)
+		case *ast.RangeStmt:
+			if n.Key != nil {
+				modifies(n.Key)
+			}
+			if n.Value != nil {
+				modifies(n.Value)
+			}
+			if _, isChan := info.TypeOf(n.X).Underlying().(*types.Chan); isChan {
+				found(&write, n, "the receive from %s", types.ExprString(n.X))
+			}
+		case *ast.SendStmt:
+			found(&write, n, "the send on %s", types.ExprString(n.Chan))
+		case *ast.GoStmt:
+			found(&write, n, "the go statement")
+		case *ast.DeferStmt:
+			found(&write, n, "the defer statement")
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW {
+				found(&write, n, "the receive from %s", types.ExprString(n.X))
+			}
+		case *ast.CallExpr:
+			if !hasNoSideEffects(info, n) {
+				found(&write, n, "the call to %s", types.ExprString(n.Fun))
+				found(&read, n, "the call to %s", types.ExprString(n.Fun))
+			}
+		case ast.Expr:
+			if what := r.memoryAccess(n, escaped); what != "" {
+				found(&read, n, "the use of %s", what)
+			}
+		}
+		return true
+	})
+	return read, write
+}
+
+// hasNoSideEffects returns true if the given call is a type conversion or a
+// call to a built-in function that neither reads nor modifies memory other
+// than its arguments (e.g., len or append).
+func hasNoSideEffects(info *types.Info, call *ast.CallExpr) bool {
+	if !isConversionOrBuiltin(info, call) {
+		return false
+	}
+	if id, ok := astutil.Unparen(call.Fun).(*ast.Ident); ok {
+		switch id.Name {
+		case "copy", "delete", "close", "panic", "print", "println",
+			"recover", "clear":
+			return false
+		}
+	}
+	return true
+}
+
+// memoryAccess returns a description of the memory accessed by the given
+// expression if it may refer to memory other than an ordinary local variable
+// (e.g., "*p" or "m[k]"), or "" if it does not.  Only the expression itself
+// is considered, not its subexpressions.
+func (r *MoveStmt) memoryAccess(expr ast.Expr, escaped map[*types.Var]bool) string {
+	info := r.SelectedNodePkg.TypesInfo
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return r.memoryAccess(e.X, escaped)
+	case *ast.StarExpr:
+		if tv, ok := info.Types[e]; ok && !tv.IsType() {
+			return types.ExprString(e)
+		}
+	case *ast.IndexExpr:
+		switch info.TypeOf(e.X).Underlying().(type) {
+		case *types.Slice, *types.Map, *types.Pointer:
+			return types.ExprString(e)
+		}
+		return r.memoryAccess(e.X, escaped)
+	case *ast.SelectorExpr:
+		if sel := info.Selections[e]; sel != nil {
+			if sel.Kind() == types.FieldVal && sel.Indirect() {
+				return types.ExprString(e)
+			}
+			if sel.Kind() == types.FieldVal {
+				return r.memoryAccess(e.X, escaped)
+			}
+			return ""
+		}
+		// A qualified identifier, e.g., os.Args
+		if v, ok := info.Uses[e.Sel].(*types.Var); ok && v != nil {
+			return types.ExprString(e)
+		}
+	case *ast.Ident:
+		v, ok := info.Uses[e].(*types.Var)
+		if !ok {
+			v, ok = info.Defs[e].(*types.Var)
+		}
+		if !ok || v == nil {
+			return ""
+		}
+		if v.Pkg() != nil && v.Parent() == v.Pkg().Scope() {
+			return "package-level variable " + v.Name()
+		}
+		if escaped[v] {
+			return v.Name()
+		}
+	}
+	return ""
+}
+
+// addEdits swaps the text of the first and second statements.
+func (r *MoveStmt) addEdits() {
+	firstStart, firstEnd, firstLines := r.moveExtent(r.first)
+	secondStart, secondEnd, secondLines := r.moveExtent(r.second)
+	if !firstLines || !secondLines {
+		// The statements share a line with other code, so move only
+		// the statements themselves
+		firstStart, firstEnd = r.offset(r.first.Pos()), r.offset(r.first.End())
+		secondStart, secondEnd = r.offset(r.second.Pos()), r.offset(r.second.End())
+	}
+	firstText := string(r.FileContents[firstStart:firstEnd])
+	secondText := string(r.FileContents[secondStart:secondEnd])
+	r.Edits[r.Filename].Add(&text.Extent{Offset: firstStart,
+		Length: firstEnd - firstStart}, secondText)
+	r.Edits[r.Filename].Add(&text.Extent{Offset: secondStart,
+		Length: secondEnd - secondStart}, firstText)
+}
+
+// moveExtent returns the offsets of the text that is moved along with the
+// given statements: entire lines, including any comment on the lines
+// immediately above them and any comment following them on the same line.
+// If the statements do not begin and end their lines, it returns false (and
+// the offsets of the statements and comments).
+func (r *MoveStmt) moveExtent(stmts *stmtRange) (start, end int, lines bool) {
+	contents := r.FileContents
+	start, end = r.offset(stmts.Pos()), r.offset(stmts.End())
+	for _, cg := range r.File.Comments {
+		cgStart, cgEnd := r.offset(cg.Pos()), r.offset(cg.End())
+		// A comment on its own line, ending on the line before
+		prevLine := lineStart(contents, start) - 1
+		if cgEnd <= prevLine && contents[prevLine] == '\n' &&
+			isBlank(contents[cgEnd:prevLine]) &&
+			isBlank(contents[lineStart(contents, cgStart):cgStart]) {
+			start = cgStart
+		}
+		// A comment following the statements on the same line
+		if cgStart >= end && isBlank(contents[end:cgStart]) {
+			end = cgEnd
+		}
+	}
+	lineStart := lineStart(contents, start)
+	lineEnd := skipLine(contents, end)
+	if !isBlank(contents[lineStart:start]) || lineEnd == end {
+		return start, end, false
+	}
+	return lineStart, lineEnd, true
+}
+
+// lineStart returns the offset of the beginning of the line containing the
+// given offset.
+func lineStart(contents []byte, offset int) int {
+	for offset > 0 && contents[offset-1] != '\n' {
+		offset--
+	}
+	return offset
+}
+
+// offset returns the byte offset of the given position in the file.
+func (r *MoveStmt) offset(pos token.Pos) int {
+	return r.Program.Fset.Position(pos).Offset
+}
+
+// line returns the line number of the given position.
+func (r *MoveStmt) line(pos token.Pos) int {
+	return r.Program.Fset.Position(pos).Line
+}
+
+const moveStmtDoc = `
+  <h4>Purpose</h4>
+  <p>The Move Statement refactoring moves a statement up or down, past the
+  adjacent statement in the same block, if doing so does not change the
+  program's behavior.  It is useful for grouping related statements (e.g.,
+  before extracting them into a function).</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select one or more statements in a block.</li>
+    <li>Activate the Move Statement refactoring.</li>
+    <li>Enter the direction: <tt>up</tt>, to move the statements before the
+    statement preceding them, or <tt>down</tt>, to move them after the
+    statement following them.</li>
+  </ol>
+
+  <p>Comments on the lines immediately above the moved statements, and any
+  comment on the same line as the end of the statements, move with them.</p>
+
+  <h4>Example</h4>
+  <p>In this example, the declaration of <tt>total</tt> is moved down, so
+  that it is next to the loop that computes it.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+  <pre><span class="highlight">total := 0</span>
+fmt.Println("Adding", len(items), "items")
+for _, item := range items {
+    total += item
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+  <pre>fmt.Println("Adding", len(items), "items")
+<span class="highlight">total := 0</span>
+for _, item := range items {
+    total += item
+}</pre>
+      </td>
+    </tr>
+  </table>
+
+  <p>An error will be reported, identifying the dependence, if:</p>
+  <ul>
+    <li>A local variable assigned by one statement is used by the other
+    statement afterward (according to reaching definitions), a local variable
+    used by one statement is assigned by the other afterward, or both assign
+    a local variable whose value is used later (according to live
+    variables).</li>
+    <li>One statement declares a name that the other uses.</li>
+    <li>One statement may modify memory other than local variables (e.g., by
+    calling a function, sending on a channel, or assigning through a pointer)
+    and the other may read or modify such memory.</li>
+    <li>Either statement contains a return statement, a branch statement
+    that transfers control outside it, or a label targeted by a goto
+    statement.</li>
+  </ul>
+`
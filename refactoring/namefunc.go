@@ -0,0 +1,621 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Convert to Named Function refactoring, which moves a
+// function literal to a new top-level function (or method) and replaces the
+// literal with the name of that function.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// A NameFunc refactoring converts a function literal to a named, top-level
+// function.  Local variables of the enclosing function that the literal
+// refers to (i.e., that it captures) become parameters of the new function,
+// which is only possible if the literal is called immediately, so that the
+// values of those variables can be passed as arguments.  If the literal is
+// declared in a method and captures the method's receiver, it is converted to
+// a method of the same type instead.
+type NameFunc struct {
+	RefactoringBase
+	funcName string
+	lit      *ast.FuncLit
+	// The top-level declaration containing the literal
+	topDecl ast.Decl
+	// If the literal is called immediately, the call and the statement
+	// containing it (if that is a go or defer statement)
+	call     *ast.CallExpr
+	callStmt ast.Stmt
+	// Local variables the literal captures, in order of first use,
+	// excluding the receiver
+	captures []*types.Var
+	// The receiver of the enclosing method, if the literal captures it
+	recv *types.Var
+}
+
+func (r *NameFunc) Description() *Description {
+	return &Description{
+		Name:      "Convert to Named Function",
+		Synopsis:  "Converts a function literal to a top-level function",
+		Usage:     "<new_name>",
+		HTMLDoc:   nameFuncDoc,
+		Multifile: false,
+		Params: []Parameter{{
+			Label:        "Name: ",
+			Prompt:       "Enter a name for the new function.",
+			DefaultValue: "",
+		}},
+		OptionalParams: nil,
+		Hidden:         false,
+		Quality:        Testing,
+	}
+}
+
+func (r *NameFunc) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.funcName = config.Args[0].(string)
+	r.lit, r.topDecl, r.call, r.callStmt = nil, nil, nil, nil
+	r.captures, r.recv = nil, nil
+	if !r.findFuncLit() {
+		return &r.Result
+	}
+	if usesCgo(r.File) {
+		r.Log.Error("Function literals cannot be converted in files " +
+			"that use cgo (import \"C\")")
+		return &r.Result
+	}
+	if !isIdentifierValid(r.funcName) || r.funcName == "_" {
+		r.Log.Errorf("The name \"%s\" is not a valid Go identifier",
+			r.funcName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return &r.Result
+	}
+	if isReservedWord(r.funcName) {
+		r.Log.Errorf("The name \"%s\" is a reserved word", r.funcName)
+		r.Log.AssociateCode(CodeInvalidName)
+		return &r.Result
+	}
+
+	if !r.findCaptures() || !r.checkCaptures() || !r.checkConflicts() {
+		return &r.Result
+	}
+	r.addEdits()
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findFuncLit finds the innermost function literal containing the selection,
+// the top-level declaration containing it, and the call (if any) that
+// immediately invokes it.  It logs an error and returns false if the
+// selection is not in a function literal.
+func (r *NameFunc) findFuncLit() bool {
+	path := r.PathEnclosingSelection
+	for i, node := range path {
+		if lit, ok := node.(*ast.FuncLit); ok && r.lit == nil {
+			r.lit = lit
+			r.findCall(path[i+1:])
+		}
+		if _, ok := node.(*ast.File); ok && i > 0 {
+			r.topDecl, _ = path[i-1].(ast.Decl)
+		}
+	}
+	if r.lit == nil || r.topDecl == nil {
+		r.Log.Error("Please select a function literal.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	return true
+}
+
+// findCall sets r.call if the function literal is called immediately, given
+// the nodes enclosing the literal (from PathEnclosingInterval), and it sets
+// r.callStmt if that call is in a go or defer statement.
+func (r *NameFunc) findCall(parents []ast.Node) {
+	var fun ast.Node = r.lit
+	for len(parents) > 0 {
+		paren, ok := parents[0].(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		fun, parents = paren, parents[1:]
+	}
+	if len(parents) == 0 {
+		return
+	}
+	if call, ok := parents[0].(*ast.CallExpr); !ok || call.Fun != fun {
+		return
+	}
+	r.call = parents[0].(*ast.CallExpr)
+	if len(parents) > 1 {
+		switch stmt := parents[1].(type) {
+		case *ast.GoStmt, *ast.DeferStmt:
+			r.callStmt = stmt.(ast.Stmt)
+		}
+	}
+}
+
+// findCaptures finds the local variables of the enclosing function that the
+// function literal refers to.  It logs an error and returns false if the
+// literal refers to a local constant or type, or if a captured variable's
+// type is a local type, since these cannot be referenced outside the
+// enclosing function.
+func (r *NameFunc) findCaptures() bool {
+	info := r.SelectedNodePkg.TypesInfo
+	seen := map[*types.Var]bool{}
+	var localRef *ast.Ident
+	ast.Inspect(r.lit, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := info.Uses[id]
+		if !r.isLocal(obj) {
+			return true
+		}
+		switch obj := obj.(type) {
+		case *types.Var:
+			if !seen[obj] {
+				seen[obj] = true
+				if r.isReceiver(obj) {
+					r.recv = obj
+				} else {
+					r.captures = append(r.captures, obj)
+				}
+			}
+		case *types.Const, *types.TypeName:
+			if localRef == nil {
+				localRef = id
+			}
+		}
+		return true
+	})
+
+	if localRef != nil {
+		obj := info.Uses[localRef]
+		r.Log.Errorf("The function literal refers to %s, which is "+
+			"declared in the enclosing function", localRef.Name)
+		r.Log.AssociateNode(localRef)
+		r.Log.AddRelated("Declaration", obj.Pos(), obj.Pos())
+		return false
+	}
+	for _, v := range append(r.captures, r.recv) {
+		if v == nil {
+			continue
+		}
+		if local := r.localTypeIn(v.Type()); local != nil {
+			r.Log.Errorf("The type of %s refers to %s, which is "+
+				"declared in the enclosing function", v.Name(),
+				local.Name())
+			r.Log.AssociatePos(v.Pos(), v.Pos())
+			return false
+		}
+	}
+	return true
+}
+
+// isLocal returns true if the given object is declared in the top-level
+// declaration containing the function literal, but outside the literal.
+// Fields, methods, and labels are not considered to be local, since they are
+// not referenced through the enclosing function's scopes.
+func (r *NameFunc) isLocal(obj types.Object) bool {
+	switch obj := obj.(type) {
+	case nil, *types.Func, *types.Label, *types.PkgName:
+		return false
+	case *types.Var:
+		if obj.IsField() {
+			return false
+		}
+	}
+	pos := obj.Pos()
+	return r.topDecl.Pos() <= pos && pos < r.topDecl.End() &&
+		!(r.lit.Pos() <= pos && pos < r.lit.End())
+}
+
+// recvField returns the receiver of the method containing the function
+// literal, or nil if the literal is not in a method.
+func (r *NameFunc) recvField() *ast.Field {
+	decl, ok := r.topDecl.(*ast.FuncDecl)
+	if !ok || decl.Recv == nil || len(decl.Recv.List) != 1 {
+		return nil
+	}
+	return decl.Recv.List[0]
+}
+
+// isReceiver returns true if the given variable is the receiver of the
+// method containing the function literal.
+func (r *NameFunc) isReceiver(v *types.Var) bool {
+	recv := r.recvField()
+	return recv != nil && len(recv.Names) == 1 &&
+		recv.Names[0].Pos() == v.Pos()
+}
+
+// localTypeIn returns a type that is declared in the enclosing function and is referenced by the given type, or nil if there is
+// no such type.
+func (r *NameFunc) localTypeIn(t types.Type) *types.TypeName {
+	switch t := t.(type) {
+	case *types.Named:
+		if r.isLocal(t.Obj()) {
+			return t.Obj()
+		}
+	case *types.Pointer:
+		return r.localTypeIn(t.Elem())
+	case *types.Slice:
+		return r.localTypeIn(t.Elem())
+	case *types.Array:
+		return r.localTypeIn(t.Elem())
+	case *types.Chan:
+		return r.localTypeIn(t.Elem())
+	case *types.Map:
+		if local := r.localTypeIn(t.Key()); local != nil {
+			return local
+		}
+		return r.localTypeIn(t.Elem())
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if local := r.localTypeIn(t.At(i).Type()); local != nil {
+				return local
+			}
+		}
+	case *types.Signature:
+		if local := r.localTypeIn(t.Params()); local != nil {
+			return local
+		}
+		return r.localTypeIn(t.Results())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if local := r.localTypeIn(t.Field(i).Type()); local != nil {
+				return local
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			if local := r.localTypeIn(t.ExplicitMethod(i).Type()); local != nil {
+				return local
+			}
+		}
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			if local := r.localTypeIn(t.EmbeddedType(i)); local != nil {
+				return local
+			}
+		}
+	}
+	return nil
+}
+
+// checkCaptures logs an error and returns false if the captured variables
+// cannot be passed as arguments to the new function (or, for the receiver,
+// used to call the new method) without changing the program's behavior.
+//
+// A captured variable becomes a parameter, which receives a copy of the
+// variable's value when the literal is called.  So, the literal must be
+// called immediately, and the variable must not be modified while the
+// literal executes: it cannot be assigned in the literal or in another
+// function literal, and its address cannot be taken.  If the call is deferred
+// (or in a go statement), or if the receiver is captured by a literal that
+// is not called immediately (so it becomes a method value), the variable
+// must not be modified at all after it is declared.
+func (r *NameFunc) checkCaptures() bool {
+	if len(r.captures) > 0 && r.call == nil {
+		names := []string{}
+		for _, v := range r.captures {
+			names = append(names, v.Name())
+		}
+		r.Log.Errorf("The function literal refers to local variables "+
+			"of the enclosing function (%s), so it can only be "+
+			"converted if it is called immediately",
+			strings.Join(names, ", "))
+		r.Log.AssociateNode(r.lit)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+
+	delayed := r.call == nil || r.callStmt != nil
+	vars := map[*types.Var]bool{}
+	for _, v := range r.captures {
+		vars[v] = true
+	}
+	if r.recv != nil {
+		vars[r.recv] = true
+	}
+
+	info := r.SelectedNodePkg.TypesInfo
+	ok := true
+	ast.Inspect(r.topDecl, func(n ast.Node) bool {
+		id, isIdent := n.(*ast.Ident)
+		if !ok || !isIdent {
+			return ok
+		}
+		v, isVar := info.Uses[id].(*types.Var)
+		if !isVar || !vars[v] {
+			return true
+		}
+		path, _ := astutil.PathEnclosingInterval(r.File, id.Pos(), id.End())
+		if !isModifiedAt(info, path) && !isRedeclaredAt(path) {
+			return true
+		}
+		switch {
+		case r.lit.Pos() <= id.Pos() && id.End() <= r.lit.End():
+			r.Log.Errorf("%s cannot be passed to the new function, "+
+				"since the function literal modifies it", v.Name())
+		case inFuncLitAfter(path, v.Pos()):
+			r.Log.Errorf("%s cannot be passed to the new function, "+
+				"since it is modified in another function literal",
+				v.Name())
+		case delayed:
+			r.Log.Errorf("%s cannot be passed to the new function, "+
+				"since it is modified, and the function literal "+
+				"is not called until later", v.Name())
+		case takesAddressAt(path):
+			r.Log.Errorf("%s cannot be passed to the new function, "+
+				"since its address is taken", v.Name())
+		default:
+			return true
+		}
+		r.Log.AssociateNode(id)
+		ok = false
+		return false
+	})
+	return ok
+}
+
+// inFuncLitAfter returns true if the node at the start of the given path is
+// inside a function literal that begins after the given position.
+func inFuncLitAfter(path []ast.Node, pos token.Pos) bool {
+	for _, node := range path {
+		if lit, ok := node.(*ast.FuncLit); ok && lit.Pos() > pos {
+			return true
+		}
+	}
+	return false
+}
+
+// isRedeclaredAt returns true if the identifier at the start of the given path
+// redeclares an existing variable in a short variable declaration (which
+// isModifiedAt does not consider to be a modification).
+func isRedeclaredAt(path []ast.Node) bool {
+	if assign, ok := path[1].(*ast.AssignStmt); ok && assign.Tok == token.DEFINE {
+		for _, lhs := range assign.Lhs {
+			if lhs == path[0] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// takesAddressAt returns true if the variable referenced by the identifier at
+// the start of the given path, which isModifiedAt reports may be modified, is
+// modified by taking its address (explicitly or by calling a method with a
+// pointer receiver) rather than by assigning to it.
+func takesAddressAt(path []ast.Node) bool {
+	for _, parent := range path[1:] {
+		switch p := parent.(type) {
+		case *ast.ParenExpr, *ast.SelectorExpr, *ast.IndexExpr:
+			// Continue with the parent
+		case *ast.UnaryExpr:
+			return p.Op == token.AND
+		case *ast.CallExpr:
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// checkConflicts logs an error and returns false if the new function (or
+// method) would conflict with an existing declaration, if its name would
+// refer to a different declaration where the literal is replaced, or if a
+// parameter for a captured variable would conflict with a declaration in the
+// literal's body.
+func (r *NameFunc) checkConflicts() bool {
+	pkg := r.SelectedNodePkg
+	if r.recv != nil {
+		if obj, _, _ := types.LookupFieldOrMethod(r.recv.Type(), true,
+			pkg.Types, r.funcName); obj != nil {
+			r.Log.Errorf("The name %s conflicts with an existing "+
+				"field or method", r.funcName)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+	} else {
+		if obj := pkg.Types.Scope().Lookup(r.funcName); obj != nil {
+			r.Log.Errorf("The name %s conflicts with an existing "+
+				"declaration", r.funcName)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+		if obj := pkg.TypesInfo.Scopes[r.File].Lookup(r.funcName); obj != nil {
+			r.Log.Errorf("The name %s conflicts with an imported "+
+				"package name", r.funcName)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+		scope := pkg.TypesInfo.Scopes[r.lit.Type].Parent()
+		if _, obj := scope.LookupParent(r.funcName, r.lit.Pos()); obj != nil {
+			r.Log.Errorf("The name %s would refer to a different "+
+				"declaration where the function literal is used",
+				r.funcName)
+			r.Log.AssociateNode(r.lit)
+			r.Log.AddRelated("Conflicting declaration",
+				obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+	}
+
+	funcScope := pkg.TypesInfo.Scopes[r.lit.Type]
+	for _, v := range r.captures {
+		if obj := funcScope.Lookup(v.Name()); obj != nil {
+			r.Log.Errorf("%s cannot be passed to the new function, "+
+				"since the function literal declares another "+
+				"variable with the same name", v.Name())
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+	}
+	return true
+}
+
+// addEdits replaces the function literal (or the call to it) and inserts the
+// new function after the top-level declaration containing the literal.
+func (r *NameFunc) addEdits() {
+	q := newTypeQualifier(r.SelectedNodePkg.Types, r.File)
+
+	var params bytes.Buffer
+	args := []string{}
+	for _, v := range r.captures {
+		if params.Len() > 0 {
+			params.WriteString(", ")
+		}
+		params.WriteString(v.Name() + " " + q.TypeString(v.Type()))
+		args = append(args, v.Name())
+	}
+	for _, field := range r.lit.Type.Params.List {
+		if len(r.captures) > 0 && len(field.Names) == 0 {
+			// Unnamed parameters cannot follow named parameters
+			if params.Len() > 0 {
+				params.WriteString(", ")
+			}
+			params.WriteString("_ " + r.nodeText(field.Type))
+			continue
+		}
+		if params.Len() > 0 {
+			params.WriteString(", ")
+		}
+		params.WriteString(r.nodeText(field))
+	}
+
+	var fn bytes.Buffer
+	fn.WriteString("\n\nfunc ")
+	if r.recv != nil {
+		fn.WriteString("(" + r.nodeText(r.recvField()) + ") ")
+	}
+	fn.WriteString(r.funcName + "(" + params.String() + ")")
+	if results := r.lit.Type.Results; results != nil {
+		fn.WriteString(" " + r.nodeText(results))
+	}
+	fn.WriteString(" " + r.nodeText(r.lit.Body))
+	offset := r.Program.Fset.Position(r.topDecl.End()).Offset
+	r.Edits[r.Filename].Add(&text.Extent{offset, 0}, fn.String())
+
+	name := r.funcName
+	if r.recv != nil {
+		name = r.recv.Name() + "." + r.funcName
+	}
+	switch {
+	case r.call == nil:
+		r.Edits[r.Filename].Add(r.Extent(r.lit), name)
+	case len(args) == 0:
+		r.Edits[r.Filename].Add(r.Extent(r.call.Fun), name)
+	default:
+		start := r.Program.Fset.Position(r.call.Fun.Pos()).Offset
+		end := r.Program.Fset.Position(r.call.Lparen).Offset + 1
+		replacement := name + "(" + strings.Join(args, ", ")
+		if len(r.call.Args) > 0 {
+			replacement += ", "
+		}
+		r.Edits[r.Filename].Add(&text.Extent{start, end - start},
+			replacement)
+	}
+	r.addImports(q)
+}
+
+// nodeText returns the source code for the given node.
+func (r *NameFunc) nodeText(node ast.Node) string {
+	start := r.Program.Fset.Position(node.Pos()).Offset
+	end := r.Program.Fset.Position(node.End()).Offset
+	return string(r.FileContents[start:end])
+}
+
+const nameFuncDoc = `
+  <h4>Purpose</h4>
+  <p>The Convert to Named Function refactoring moves a function literal (an
+  anonymous function) to a new top-level function and replaces the literal
+  with the name of that function.  Named functions can be tested and reused
+  independently, and their names appear in stack traces and profiles.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function literal (or place the cursor inside it).</li>
+    <li>Activate the Convert to Named Function refactoring.</li>
+    <li>Enter a name for the new function.</li>
+  </ol>
+
+  <p>The new function is inserted after the function containing the
+  literal.  If the literal refers to local variables of the enclosing
+  function, those variables become parameters of the new function, which is
+  only possible if the literal is called immediately (the variables' values
+  are passed as arguments).  If the literal is in a method and refers to the
+  method's receiver, it is converted to a method of the same type.</p>
+
+  <h4>Example</h4>
+  <p>In this example, the function literal refers to the local variable
+  <tt>prefix</tt>, so <tt>prefix</tt> becomes the first parameter of
+  <tt>printAll</tt>.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+  <pre>func main() {
+    prefix := "&gt; "
+    <span class="highlight">func(lines []string) {
+        for _, line := range lines {
+            fmt.Println(prefix + line)
+        }
+    }</span>(os.Args[1:])
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp;&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+  <pre>func main() {
+    prefix := "&gt; "
+    <span class="highlight">printAll(prefix, os.Args[1:])</span>
+}
+
+<span class="highlight">func printAll(prefix string, lines []string) {
+    for _, line := range lines {
+        fmt.Println(prefix + line)
+    }
+}</span></pre>
+      </td>
+    </tr>
+  </table>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The literal refers to local variables, but it is not called
+    immediately.  (The error lists the variables it refers to.)</li>
+    <li>The literal modifies a local variable it refers to, or the variable
+    may be modified while the literal executes (e.g., it is modified in
+    another function literal or its address is taken).</li>
+    <li>The literal is called in a <tt>go</tt> or <tt>defer</tt> statement,
+    and a local variable it refers to is modified after it is declared.</li>
+    <li>The literal refers to a constant or type declared in the enclosing
+    function, or a local variable whose type is declared in the
+    enclosing function.</li>
+    <li>The new name conflicts with an existing declaration.</li>
+  </ul>
+`
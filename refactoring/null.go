@@ -27,6 +27,7 @@ func (r *Null) Description() *Description {
 		}},
 		OptionalParams: nil,
 		Hidden:         true,
+		Quality:        Development,
 	}
 }
 
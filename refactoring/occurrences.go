@@ -0,0 +1,192 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines Occurrence, which classifies the edits in a Result (e.g.,
+// the occurrences of a name changed by the Rename refactoring), so that
+// drivers can display a grouped preview and exclude whole categories of
+// edits before applying them.
+
+package refactoring
+
+import (
+	"go/ast"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// An OccurrenceKind classifies an Occurrence.
+type OccurrenceKind int
+
+const (
+	// The identifier is being declared
+	OccurrenceDeclaration OccurrenceKind = iota
+	// The identifier is used without being assigned a new value
+	OccurrenceRead
+	// The identifier is assigned a new value (e.g., x = 1 or x++)
+	OccurrenceWrite
+	// A method that must be changed along with the selected method so
+	// that a type continues to implement an interface (or the method of
+	// the interface itself)
+	OccurrenceInterfaceMethod
+	// The occurrence is in a comment
+	OccurrenceComment
+	// The occurrence is in a string outside of Go code (e.g., in a file
+	// searched by a SidecarScanner)
+	OccurrenceString
+	// The occurrence is in a file that is excluded from the build by
+	// build constraints, so it was found by matching names in the
+	// file's syntax tree, without type information, and may be wrong
+	OccurrenceSyntactic
+	// The occurrence is the name of a test, benchmark, or example function
+	// (or a reference to one) that is named after the renamed declaration
+	// (e.g., ExampleFoo when Foo is renamed)
+	OccurrenceTestFunction
+)
+
+// occurrenceKindNames are the names returned by OccurrenceKind.String, which
+// are also accepted by ParseOccurrenceKind
+var occurrenceKindNames = []string{
+	"declaration",
+	"read",
+	"write",
+	"interface_method",
+	"comment",
+	"string",
+	"syntactic",
+	"test_function",
+}
+
+// String returns the name of the occurrence kind (e.g., "read"), which
+// drivers can display or use in machine-readable output.
+func (k OccurrenceKind) String() string {
+	if k < 0 || int(k) >= len(occurrenceKindNames) {
+		return "unknown"
+	}
+	return occurrenceKindNames[k]
+}
+
+// ParseOccurrenceKind returns the OccurrenceKind with the given name (as
+// returned by OccurrenceKind.String).  The second result is false if there is
+// no such kind.
+func ParseOccurrenceKind(name string) (OccurrenceKind, bool) {
+	for i, n := range occurrenceKindNames {
+		if n == name {
+			return OccurrenceKind(i), true
+		}
+	}
+	return 0, false
+}
+
+// An Occurrence classifies one of the edits in a Result.
+type Occurrence struct {
+	// The file containing the occurrence
+	Filename string
+	// The region of the file that will be replaced (this is also the
+	// Extent of an edit in the Result's Edits for Filename)
+	Extent *text.Extent
+	// The kind of occurrence
+	Kind OccurrenceKind
+	// For an OccurrenceInterfaceMethod, explains why the method must be
+	// changed (e.g., "T2 implements I, which T1 also implements");
+	// otherwise, empty
+	Reason string
+	// Describes what caused the edit (e.g., "use of Hello declared at
+	// lib.go:4:6"), so that surprising edits can be audited; this is
+	// displayed with the list of edits in the verbose log
+	Cause string
+}
+
+// addOccurrence adds an edit replacing the given extent of the given file,
+// recording an Occurrence of the given kind, with the given cause, if the edit
+// can be added.
+func (r *RefactoringBase) addOccurrence(filename string, extent *text.Extent, replacement string, kind OccurrenceKind, cause string) error {
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+	}
+	if err := r.Edits[filename].Add(extent, replacement); err != nil {
+		return err
+	}
+	r.Occurrences = append(r.Occurrences, Occurrence{
+		Filename: filename,
+		Extent:   extent,
+		Kind:     kind,
+		Cause:    cause,
+	})
+	return nil
+}
+
+// ExcludeOccurrences removes the Occurrences of the given kinds from this
+// Result, along with their edits, so that (e.g.) a user can choose not to
+// rename occurrences in comments after previewing the changes.  Edits that
+// are not associated with an Occurrence are left unchanged.
+func (r *Result) ExcludeOccurrences(kinds ...OccurrenceKind) {
+	excludeKind := map[OccurrenceKind]bool{}
+	for _, kind := range kinds {
+		excludeKind[kind] = true
+	}
+	excluded := map[string]map[text.Extent]bool{}
+	occurrences := []Occurrence{}
+	for _, occ := range r.Occurrences {
+		if !excludeKind[occ.Kind] {
+			occurrences = append(occurrences, occ)
+			continue
+		}
+		if excluded[occ.Filename] == nil {
+			excluded[occ.Filename] = map[text.Extent]bool{}
+		}
+		excluded[occ.Filename][*occ.Extent] = true
+	}
+	r.Occurrences = occurrences
+
+	for filename, extents := range excluded {
+		old := r.Edits[filename]
+		if old == nil {
+			continue
+		}
+		edits := text.NewEditSet()
+		edits.SetBaseHash(old.BaseHash())
+		old.Iterate(func(extent *text.Extent, replacement string) bool {
+			if !extents[*extent] {
+				edits.Add(extent, replacement)
+			}
+			return true
+		})
+		r.Edits[filename] = edits
+	}
+}
+
+// isAssignedAt returns true if the identifier at the start of the given path
+// (from PathEnclosingInterval) is assigned a new value: it is the left-hand
+// side of an assignment (other than one declaring it), the operand of an
+// increment or decrement statement, or a key or value assigned by a range
+// clause.  The identifier may be parenthesized or appear as the selector in
+// a selector expression (e.g., the field f in x.f = 1).
+func isAssignedAt(path []ast.Node) bool {
+	var node ast.Node = path[0]
+	for _, parent := range path[1:] {
+		switch p := parent.(type) {
+		case *ast.ParenExpr:
+			// Continue with the parent
+		case *ast.SelectorExpr:
+			if p.Sel != node {
+				return false
+			}
+		case *ast.AssignStmt:
+			for _, lhs := range p.Lhs {
+				if lhs == node {
+					return true
+				}
+			}
+			return false
+		case *ast.IncDecStmt:
+			return true
+		case *ast.RangeStmt:
+			return p.Key == node || p.Value == node
+		default:
+			return false
+		}
+		node = parent
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestRenameOccurrenceKinds(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	dir := filepath.Join(gopath, "src", "example.com", "app")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const contents = `package main
+
+type I interface{ M() }
+
+type T struct{ f int }
+
+func (T) M() {}
+
+func main() {
+	var x int
+	x = 1
+	x++
+	println(x) // Prints ` + "`x`" + `
+	var i I = T{}
+	i.M()
+	t := T{}
+	t.f = x
+}
+`
+	mainFile := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(mainFile, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rename := func(line, col int) *Result {
+		result := new(Rename).Run(&Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Scope:      []string{mainFile},
+			Selection: &text.LineColSelection{
+				Filename:  mainFile,
+				StartLine: line, StartCol: col,
+				EndLine: line, EndCol: col,
+			},
+			Args:       []interface{}{"z"},
+			GoPath:     gopath,
+			ModulesOff: true,
+		})
+		if result.Log.ContainsErrors() {
+			t.Fatal(result.Log)
+		}
+		return result
+	}
+	kinds := func(result *Result) string {
+		names := []string{}
+		for _, occ := range result.Occurrences {
+			names = append(names, occ.Kind.String())
+		}
+		return strings.Join(names, " ")
+	}
+
+	// x: declaration, writes, reads, and a comment
+	result := rename(10, 6)
+	expected := "declaration write write read read comment"
+	if actual := kinds(result); actual != expected {
+		t.Errorf("Expected occurrences of x to be %s; got %s",
+			expected, actual)
+	}
+	causes := []string{}
+	for _, occ := range result.Occurrences[:3] {
+		causes = append(causes, occ.Cause)
+	}
+	expected = "declaration of x; assignment to x declared at main.go:10:6; " +
+		"assignment to x declared at main.go:10:6"
+	if actual := strings.Join(causes, "; "); actual != expected {
+		t.Errorf("Expected causes %q; got %q", expected, actual)
+	}
+	result.ExcludeOccurrences(OccurrenceComment)
+	output, err := filesystem.ApplyEdits(result.Edits[mainFile],
+		&filesystem.LocalFileSystem{}, mainFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "println(z) // Prints `x`") ||
+		!strings.Contains(string(output), "t.f = z") {
+		t.Errorf("Comment should not have been renamed:\n%s", output)
+	}
+	if kinds(result) != "declaration write write read read" {
+		t.Errorf("Comment occurrence should have been excluded; got %s",
+			kinds(result))
+	}
+
+	// T.M: the interface method must be renamed too
+	result = rename(7, 10)
+	expected = "interface_method declaration read"
+	if actual := kinds(result); actual != expected {
+		t.Errorf("Expected occurrences of M to be %s; got %s",
+			expected, actual)
+	}
+	if reason := result.Occurrences[0].Reason; reason != "T implements I" {
+		t.Errorf("Expected I.M to be renamed since T implements I; "+
+			"got reason %q", reason)
+	}
+	if cause := result.Occurrences[0].Cause; cause != "method M, since T implements I" {
+		t.Errorf("Incorrect cause for I.M: %q", cause)
+	}
+
+	// f: a field declaration and a write through a selector
+	result = rename(5, 16)
+	expected = "declaration write"
+	if actual := kinds(result); actual != expected {
+		t.Errorf("Expected occurrences of f to be %s; got %s",
+			expected, actual)
+	}
+}
+
+func TestParseOccurrenceKind(t *testing.T) {
+	for kind := OccurrenceDeclaration; kind <= OccurrenceString; kind++ {
+		if parsed, ok := ParseOccurrenceKind(kind.String()); !ok || parsed != kind {
+			t.Errorf("Could not parse %s", kind)
+		}
+	}
+	if _, ok := ParseOccurrenceKind("unknown"); ok {
+		t.Errorf("\"unknown\" should not be an occurrence kind")
+	}
+}
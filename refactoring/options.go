@@ -0,0 +1,759 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Introduce Functional Options refactoring, which
+// replaces the trailing parameters of a function (typically a constructor
+// with many parameters) with variadic "functional options," e.g.,
+// NewServer(host, WithPort(8080)).
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/godoctor/godoctor/analysis/names"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/packages"
+)
+
+// An IntroduceOptions refactoring replaces the trailing parameters of a
+// function with functional options.  For example, given
+//
+//	func NewServer(host string, port int, timeout time.Duration) *Server
+//
+// it generates an option type (ServerOption), a struct holding the optional
+// parameters (serverOptions), and a function returning an option for each
+// parameter (WithPort and WithTimeout), and it changes the function to
+//
+//	func NewServer(host string, opts ...ServerOption) *Server
+//
+// The function body begins by applying the options and assigning the
+// results to local variables with the parameters' names, so the rest of the
+// body is unchanged.  Calls are updated to pass options instead of
+// arguments, e.g., NewServer("localhost", WithPort(8080)).
+type IntroduceOptions struct {
+	RefactoringBase
+	files      *sourceFiles
+	fn         *types.Func
+	decl       *ast.FuncDecl
+	declPkg    *packages.Package
+	file       *ast.File
+	filename   string
+	required   []*types.Var // parameters that remain ordinary parameters
+	optional   []*types.Var // parameters replaced by options
+	paramTypes []ast.Expr   // type of each parameter (required, then optional)
+	variadic   bool         // true iff the last parameter is variadic
+	optionType string       // e.g., ServerOption
+	structName string       // e.g., serverOptions
+	withNames  []string     // e.g., WithPort; one for each optional parameter
+}
+
+// An optionsCall is a call to the function that will be updated to pass
+// options instead of arguments.
+type optionsCall struct {
+	call      *ast.CallExpr
+	filename  string
+	qualifier string // e.g., "server." if the call is server.NewServer(...)
+	info      *types.Info
+}
+
+func (r *IntroduceOptions) Description() *Description {
+	return &Description{
+		Name:      "Introduce Functional Options",
+		Synopsis:  "Replaces a function's parameters with functional options",
+		Usage:     "[<num_required_params> [<update_calls>]]",
+		HTMLDoc:   introduceOptionsDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Required Parameters:",
+			Prompt:       "Number of leading parameters that remain ordinary parameters (default: 0).",
+			DefaultValue: "",
+		}, {
+			Label:        "Update Calls:",
+			Prompt:       "Update calls to the function to pass options instead of arguments.",
+			DefaultValue: true,
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *IntroduceOptions) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+
+	numRequired := 0
+	if len(config.Args) > 0 {
+		if arg := strings.TrimSpace(config.Args[0].(string)); arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				r.Log.Errorf("The number of required parameters must "+
+					"be a nonnegative integer, not \"%s\"", arg)
+				r.Log.AssociateCode(CodeInvalidArgs)
+				return &r.Result
+			}
+			numRequired = n
+		}
+	}
+	updateCalls := true
+	if len(config.Args) > 1 {
+		updateCalls = config.Args[1].(bool)
+	}
+
+	if !r.findFunc() || !r.splitParams(numRequired) || !r.chooseNames() {
+		return &r.Result
+	}
+	calls := r.findCalls(updateCalls)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	r.rewriteFunc()
+	for _, call := range calls {
+		r.updateCall(call)
+	}
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.UpdateLog(config, true)
+	return &r.Result
+}
+
+// findFunc finds the function whose parameters will be replaced: the
+// function named by the selected identifier, or the function declaration
+// whose signature contains the selection.  It logs an error and returns
+// false if there is no such function or it cannot be modified.
+func (r *IntroduceOptions) findFunc() bool {
+	var decl *ast.FuncDecl
+	if id, ok := r.SelectedNode.(*ast.Ident); ok {
+		if fn, ok := r.SelectedNodePkg.TypesInfo.ObjectOf(id).(*types.Func); ok {
+			_, path, _ := r.Program.PathEnclosingInterval(fn.Pos(), fn.Pos())
+			if len(path) > 1 {
+				decl, _ = path[1].(*ast.FuncDecl)
+			}
+		}
+	}
+	if decl == nil && r.SelectedNode != nil {
+		for _, node := range r.PathEnclosingSelection {
+			if d, ok := node.(*ast.FuncDecl); ok && (d.Body == nil ||
+				r.SelectionStart < d.Body.Lbrace) {
+				decl = d
+				break
+			}
+		}
+	}
+	if decl == nil {
+		r.Log.Error("Please select a function declaration or the name " +
+			"of a function.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+
+	pkg, path, _ := r.Program.PathEnclosingInterval(decl.Name.Pos(), decl.Name.End())
+	r.decl = decl
+	r.declPkg = pkg
+	r.fn, _ = pkg.TypesInfo.Defs[decl.Name].(*types.Func)
+	r.file = path[len(path)-1].(*ast.File)
+	r.filename = r.Program.Fset.Position(r.file.Pos()).Filename
+	switch {
+	case r.fn == nil:
+		r.Log.Errorf("The declaration of %s could not be type checked",
+			decl.Name.Name)
+	case decl.Recv != nil:
+		r.Log.Errorf("%s is a method; functional options can only be "+
+			"introduced for functions", decl.Name.Name)
+	case decl.Body == nil:
+		r.Log.Errorf("%s has no body, so it cannot be modified",
+			decl.Name.Name)
+	case isInGoRoot(r.filename):
+		r.Log.Errorf("%s is defined in $GOROOT and cannot be modified",
+			decl.Name.Name)
+	case usesCgo(r.file):
+		r.Log.Errorf("%s cannot be modified because it uses cgo "+
+			"(import \"C\")", filepath.Base(r.filename))
+	default:
+		if _, err := r.files.read(r.filename); err != nil {
+			r.Log.Error(err)
+			return false
+		}
+		return true
+	}
+	r.Log.AssociateNode(decl.Name)
+	return false
+}
+
+// splitParams divides the function's parameters into the given number of
+// required parameters, followed by the optional parameters, which will be
+// replaced by options.  It logs an error and returns false if there are no
+// optional parameters or if any of them is unnamed.
+func (r *IntroduceOptions) splitParams(numRequired int) bool {
+	sig := r.fn.Type().(*types.Signature)
+	params := sig.Params()
+	if numRequired >= params.Len() {
+		r.Log.Errorf("%s has %d parameter(s), so at most %d can be "+
+			"required", r.fn.Name(), params.Len(), params.Len()-1)
+		r.Log.AssociateNode(r.decl.Type.Params)
+		r.Log.AssociateCode(CodeInvalidArgs)
+		return false
+	}
+	r.required, r.optional, r.paramTypes = nil, nil, nil
+	for _, field := range r.decl.Type.Params.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			r.paramTypes = append(r.paramTypes, field.Type)
+		}
+	}
+	for i := 0; i < params.Len(); i++ {
+		param := params.At(i)
+		if i < numRequired {
+			r.required = append(r.required, param)
+			continue
+		}
+		if param.Name() == "" || param.Name() == "_" {
+			r.Log.Errorf("Parameters can only be replaced by options if "+
+				"they are named, and parameter %d of %s is not", i+1,
+				r.fn.Name())
+			r.Log.AssociateNode(r.paramTypes[i])
+			return false
+		}
+		r.optional = append(r.optional, param)
+	}
+	r.variadic = sig.Variadic()
+	return true
+}
+
+// chooseNames determines the names of the option type, the struct holding
+// the optional parameters, and the functions returning options.  The names
+// are based on the function's name, with a leading "New" removed; they are
+// exported if the function is.  It logs an error and returns false if any of
+// the names conflicts with an existing declaration.
+func (r *IntroduceOptions) chooseNames() bool {
+	base := r.fn.Name()
+	for _, prefix := range []string{"New", "new"} {
+		rest := strings.TrimPrefix(base, prefix)
+		if first, _ := utf8.DecodeRuneInString(rest); rest != base &&
+			(rest == "" || unicode.IsUpper(first)) {
+			base = rest
+		}
+	}
+	export := unexportedName
+	if r.fn.Exported() {
+		export = exportedName
+	}
+	r.optionType = export(base + "Option")
+	r.structName = unexportedName(base + "Options")
+	r.withNames = nil
+	for _, param := range r.optional {
+		r.withNames = append(r.withNames,
+			export("With"+exportedName(param.Name())))
+	}
+
+	scope := r.fn.Pkg().Scope()
+	seen := map[string]*types.Var{}
+	for i, name := range append([]string{r.optionType, r.structName}, r.withNames...) {
+		if obj := scope.Lookup(name); obj != nil {
+			r.Log.Errorf("The name %s conflicts with an existing "+
+				"declaration", name)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+		if i < 2 {
+			continue
+		}
+		param := r.optional[i-2]
+		if other, ok := seen[name]; ok {
+			r.Log.Errorf("The parameters %s and %s would both be set "+
+				"by %s", other.Name(), param.Name(), name)
+			r.Log.AssociatePos(param.Pos(), param.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+		seen[name] = param
+	}
+	for _, param := range r.required {
+		if param.Name() == r.structName {
+			r.Log.Errorf("The parameter %s conflicts with the name of "+
+				"the new struct type", param.Name())
+			r.Log.AssociatePos(param.Pos(), param.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			return false
+		}
+	}
+	return true
+}
+
+// unexportedName returns the given name with its first letter in lowercase.
+func unexportedName(name string) string {
+	ch, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(ch)) + name[size:]
+}
+
+// findCalls returns the calls to the function, sorted by position, whose
+// arguments will be replaced by options.  If updateCalls is false, it
+// returns nil and logs a warning if the function is used.  Otherwise, it logs
+// an error for each use that cannot be updated: a use that is not a call
+// (e.g., a function value), or a call whose arguments do not correspond
+// one-to-one with the parameters (e.g., f(g()), where g returns several
+// values).
+func (r *IntroduceOptions) findCalls(updateCalls bool) []*optionsCall {
+	uses := []*ast.Ident{}
+	for id := range names.FindOccurrences(r.fn, r.Program) {
+		if id != r.decl.Name {
+			uses = append(uses, id)
+		}
+	}
+	sort.Slice(uses, func(i, j int) bool { return uses[i].Pos() < uses[j].Pos() })
+	if !updateCalls {
+		if len(uses) > 0 {
+			r.Log.Warnf("%s is used %d time(s); these uses will not "+
+				"be updated", r.fn.Name(), len(uses))
+		}
+		return nil
+	}
+
+	numParams := len(r.required) + len(r.optional)
+	result := []*optionsCall{}
+	for _, use := range uses {
+		pkg, path, _ := r.Program.PathEnclosingInterval(use.Pos(), use.End())
+		file := path[len(path)-1].(*ast.File)
+		filename := r.Program.Fset.Position(file.Pos()).Filename
+		if usesCgo(file) {
+			r.Log.Errorf("%s cannot be modified because it uses cgo "+
+				"(import \"C\")", filepath.Base(filename))
+			r.Log.AssociateNode(use)
+			continue
+		}
+		call, qualifier := enclosingCall(path)
+		if call == nil {
+			r.Log.Errorf("This use of %s is not a call, so it cannot "+
+				"be updated to pass options", r.fn.Name())
+			r.Log.AssociateNode(use)
+			continue
+		}
+		var ok bool
+		switch {
+		case call.Ellipsis.IsValid():
+			ok = len(call.Args) == numParams
+		case r.variadic:
+			ok = len(call.Args) >= numParams-1
+		default:
+			ok = len(call.Args) == numParams
+		}
+		if !ok {
+			r.Log.Errorf("The arguments of this call to %s do not "+
+				"correspond to its parameters, so it cannot be "+
+				"updated to pass options", r.fn.Name())
+			r.Log.AssociateNode(call)
+			continue
+		}
+		if qualifier == "" {
+			scope := scopeAt(pkg.TypesInfo, path)
+			for _, name := range r.withNames {
+				if _, obj := scope.LookupParent(name, call.Pos()); obj != nil {
+					r.Log.Errorf("This call to %s cannot be updated, "+
+						"since %s refers to a different "+
+						"declaration here", r.fn.Name(), name)
+					r.Log.AssociateNode(call)
+					r.Log.AssociateCode(CodeRenameConflict)
+					break
+				}
+			}
+		}
+		if _, err := r.files.read(filename); err != nil {
+			r.Log.Error(err)
+			continue
+		}
+		result = append(result, &optionsCall{
+			call:      call,
+			filename:  filename,
+			qualifier: qualifier,
+			info:      pkg.TypesInfo,
+		})
+	}
+	return result
+}
+
+// enclosingCall returns the call expression whose function is the
+// identifier at the start of the given path (as returned by
+// PathEnclosingInterval), along with the package qualifier preceding the
+// identifier (e.g., "server."), if any.  It returns nil if the identifier is
+// not called.
+func enclosingCall(path []ast.Node) (*ast.CallExpr, string) {
+	var fun ast.Node = path[0]
+	qualifier := ""
+	i := 1
+	if len(path) < 3 {
+		return nil, ""
+	}
+	if sel, ok := path[i].(*ast.SelectorExpr); ok && sel.Sel == path[0] {
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return nil, ""
+		}
+		fun, qualifier = sel, x.Name+"."
+		i++
+	}
+	if call, ok := path[i].(*ast.CallExpr); ok && call.Fun == fun {
+		return call, qualifier
+	}
+	return nil, ""
+}
+
+// rewriteFunc adds edits inserting the option type, the struct, and the
+// functions returning options before the function, replacing the optional
+// parameters with a variadic parameter for the options, and inserting
+// statements at the beginning of the function body that apply the options
+// and assign the optional parameters' values to local variables.
+func (r *IntroduceOptions) rewriteFunc() {
+	edits := r.editSet(r.files, r.filename)
+	contents := r.files.contents[r.filename]
+	if edits == nil {
+		return
+	}
+
+	// Choose names that are not used anywhere in the function
+	used := map[string]bool{r.optionType: true, r.structName: true}
+	for _, name := range r.withNames {
+		used[name] = true
+	}
+	ast.Inspect(r.decl, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+	fresh := func(name string) string {
+		result := name
+		for i := 1; used[result]; i++ {
+			result = name + strconv.Itoa(i)
+		}
+		used[result] = true
+		return result
+	}
+	optsName, optionsName, optName := fresh("opts"), fresh("options"), fresh("opt")
+
+	d := r.newDeclText(r.files, r.filename, r.file, r.decl)
+	decls, err := format.Source([]byte(r.declsText()))
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	edits.Add(&text.Extent{Offset: d.start}, string(decls)+"\n")
+
+	params := []string{}
+	i := 0
+	for _, field := range r.decl.Type.Params.List {
+		required := []string{}
+		for _, name := range field.Names {
+			if i < len(r.required) {
+				required = append(required, name.Name)
+			}
+			i++
+		}
+		switch {
+		case len(required) == 0:
+		case len(required) == len(field.Names):
+			params = append(params, r.text(contents, field))
+		default:
+			params = append(params, strings.Join(required, ", ")+" "+
+				r.text(contents, field.Type))
+		}
+	}
+	params = append(params, optsName+" ..."+r.optionType)
+	open := r.OffsetOfPos(r.decl.Type.Params.Opening) + 1
+	close := r.OffsetOfPos(r.decl.Type.Params.Closing)
+	edits.Add(&text.Extent{Offset: open, Length: close - open},
+		strings.Join(params, ", "))
+
+	// Insert statements after the opening brace (and any comment
+	// following it on the same line)
+	offset := r.OffsetOfPos(r.decl.Body.Lbrace) + 1
+	var buf bytes.Buffer
+	if i := bytes.IndexByte(contents[offset:], '\n'); i >= 0 {
+		rest := bytes.TrimSpace(contents[offset : offset+i])
+		if len(rest) == 0 || bytes.HasPrefix(rest, []byte("//")) {
+			offset += i
+		}
+	}
+	fmt.Fprintf(&buf, "\nvar %s %s\n", optionsName, r.structName)
+	fmt.Fprintf(&buf, "for _, %s := range %s {\n%s(&%s)\n}\n", optName,
+		optsName, optName, optionsName)
+	lhs, rhs := []string{}, []string{}
+	for _, param := range r.optional {
+		if r.isUsed(param) {
+			lhs = append(lhs, param.Name())
+			rhs = append(rhs, optionsName+"."+param.Name())
+		}
+	}
+	if len(lhs) > 0 {
+		fmt.Fprintf(&buf, "%s := %s\n", strings.Join(lhs, ", "),
+			strings.Join(rhs, ", "))
+	}
+	if len(r.decl.Body.List) > 0 {
+		buf.WriteString("\n")
+	}
+	edits.Add(&text.Extent{Offset: offset}, strings.TrimSuffix(buf.String(), "\n"))
+}
+
+// declsText returns the source code for the option type, the struct holding
+// the optional parameters, and the functions returning options.
+func (r *IntroduceOptions) declsText() string {
+	contents := r.files.contents[r.filename]
+	typeText := func(i int) string {
+		if ellipsis, ok := r.paramTypes[i].(*ast.Ellipsis); ok {
+			return "[]" + r.text(contents, ellipsis.Elt)
+		}
+		return r.text(contents, r.paramTypes[i])
+	}
+
+	fn := r.fn.Name()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// %s sets an optional parameter of %s.\n",
+		r.optionType, fn)
+	fmt.Fprintf(&buf, "type %s func(*%s)\n\n", r.optionType, r.structName)
+	fmt.Fprintf(&buf, "// %s holds the optional parameters of %s.\n",
+		r.structName, fn)
+	fmt.Fprintf(&buf, "type %s struct {\n", r.structName)
+	for i, param := range r.optional {
+		fmt.Fprintf(&buf, "%s %s\n", param.Name(),
+			typeText(len(r.required)+i))
+	}
+	buf.WriteString("}\n")
+	for i, param := range r.optional {
+		name := param.Name()
+		recv := "o"
+		if name == recv {
+			recv = "options"
+		}
+		fmt.Fprintf(&buf, "\n// %s sets the %s parameter of %s.\n",
+			r.withNames[i], name, fn)
+		fmt.Fprintf(&buf, "func %s(%s %s) %s {\n", r.withNames[i], name,
+			r.text(contents, r.paramTypes[len(r.required)+i]),
+			r.optionType)
+		fmt.Fprintf(&buf, "return func(%s *%s) {\n%s.%s = %s\n}\n}\n",
+			recv, r.structName, recv, name, name)
+	}
+	return buf.String()
+}
+
+// isUsed returns true if the given parameter is referenced in the function
+// body.
+func (r *IntroduceOptions) isUsed(param *types.Var) bool {
+	result := false
+	ast.Inspect(r.decl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && r.declPkg.TypesInfo.Uses[id] == param {
+			result = true
+		}
+		return !result
+	})
+	return result
+}
+
+// updateCall adds an edit replacing the arguments of the given call that
+// correspond to optional parameters with options.  Arguments that are the
+// zero value of their type are omitted, since the optional parameters are
+// zero unless an option sets them.
+func (r *IntroduceOptions) updateCall(c *optionsCall) {
+	edits := r.editSet(r.files, c.filename)
+	if edits == nil {
+		return
+	}
+	contents := r.files.contents[c.filename]
+	call := c.call
+
+	args := []string{}
+	for i := range r.required {
+		args = append(args, r.text(contents, call.Args[i]))
+	}
+	for i, param := range r.optional {
+		index := len(r.required) + i
+		option := c.qualifier + r.withNames[i]
+		if r.variadic && i == len(r.optional)-1 {
+			if index >= len(call.Args) {
+				continue
+			}
+			values := []string{}
+			for _, arg := range call.Args[index:] {
+				values = append(values, r.text(contents, arg))
+			}
+			ellipsis := ""
+			if call.Ellipsis.IsValid() {
+				ellipsis = "..."
+			}
+			args = append(args, fmt.Sprintf("%s(%s%s)", option,
+				strings.Join(values, ", "), ellipsis))
+			continue
+		}
+		arg := call.Args[index]
+		if isZeroValue(arg, param.Type(), c.info) {
+			continue
+		}
+		args = append(args, fmt.Sprintf("%s(%s)", option,
+			r.text(contents, arg)))
+	}
+
+	open := r.OffsetOfPos(call.Lparen) + 1
+	close := r.OffsetOfPos(call.Rparen)
+	edits.Add(&text.Extent{Offset: open, Length: close - open},
+		strings.Join(args, ", "))
+}
+
+// isZeroValue returns true if the given expression is a constant or nil
+// whose value is the zero value of the given type.
+func isZeroValue(expr ast.Expr, typ types.Type, info *types.Info) bool {
+	tv, ok := info.Types[expr]
+	if !ok {
+		return false
+	}
+	if tv.IsNil() {
+		return true
+	}
+	if tv.Value == nil {
+		return false
+	}
+	if _, isInterface := typ.Underlying().(*types.Interface); isInterface {
+		return false // e.g., passing 0 as an interface{} is not nil
+	}
+	switch tv.Value.Kind() {
+	case constant.Bool:
+		return !constant.BoolVal(tv.Value)
+	case constant.String:
+		return constant.StringVal(tv.Value) == ""
+	case constant.Int, constant.Float, constant.Complex:
+		return constant.Sign(tv.Value) == 0
+	}
+	return false
+}
+
+// text returns the source code for the given node, which must be in the file
+// with the given contents.
+func (r *IntroduceOptions) text(contents []byte, node ast.Node) string {
+	return string(contents[r.OffsetOfPos(node.Pos()):r.OffsetOfPos(node.End())])
+}
+
+const introduceOptionsDoc = `
+  <h4>Purpose</h4>
+  <p>The Introduce Functional Options refactoring replaces the trailing
+  parameters of a function&mdash;typically a constructor with many
+  parameters&mdash;with variadic <i>functional options</i>.  Callers pass
+  only the options they need, and new options can be added later without
+  changing existing calls.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select a function declaration, or the name of a function.</li>
+    <li>Activate the Introduce Functional Options refactoring.</li>
+    <li>Optionally, enter the number of leading parameters that should remain
+    ordinary (required) parameters.  By default, every parameter is replaced
+    by an option.</li>
+    <li>Optionally, set "Update Calls" to false to leave calls to the
+    function unchanged.</li>
+  </ol>
+
+  <p>For a function named <tt>NewServer</tt>, the refactoring adds:</p>
+  <ul>
+    <li>an option type, <tt>ServerOption</tt>, which is the type of the new
+    variadic parameter;</li>
+    <li>a struct, <tt>serverOptions</tt>, with a field for each parameter
+    replaced by an option; and</li>
+    <li>a function returning an option for each of these parameters (e.g.,
+    <tt>WithPort</tt> for a parameter named <tt>port</tt>).</li>
+  </ul>
+  <p>The function body begins by applying the options and assigning the
+  parameters' values to local variables with the same names, so the rest of
+  the body is unchanged.  A parameter that is not set by an option has the
+  zero value of its type.  Calls are updated to pass options instead of
+  arguments; arguments that are the zero value of their type (e.g.,
+  <tt>0</tt>, <tt>""</tt>, <tt>false</tt>, or <tt>nil</tt>) are omitted.</p>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The function is a method, or all of its parameters are required.</li>
+    <li>A parameter to be replaced by an option is unnamed.</li>
+    <li>A new name conflicts with an existing declaration.</li>
+    <li>The function is used other than in a call (e.g., it is assigned to
+    a variable), or a call's arguments do not correspond to the function's
+    parameters (e.g., <tt>NewServer(hostAndPort())</tt>).</li>
+  </ul>
+
+  <h4>Example</h4>
+  <p>The example below demonstrates the effect of introducing functional
+  options for <tt>NewServer</tt> with one required parameter.</p>
+  <table cellspacing="5" cellpadding="15" style="border: 0;">
+    <tr>
+      <th>Before</th><th>&nbsp;</th><th>After</th>
+    </tr>
+    <tr>
+      <td class="dotted">
+        <pre>func NewServer(host string, port int, tls bool) *Server {
+    return &amp;Server{host, port, tls}
+}
+
+func main() {
+    NewServer("localhost", 8080, false)
+}</pre>
+      </td>
+      <td>&nbsp;&nbsp;&nbsp;&nbsp;&rArr;&nbsp&nbsp;&nbsp;&nbsp;</td>
+      <td class="dotted">
+        <pre>// ServerOption sets an optional parameter of NewServer.
+type ServerOption func(*serverOptions)
+
+// serverOptions holds the optional parameters of NewServer.
+type serverOptions struct {
+    port int
+    tls  bool
+}
+
+// WithPort sets the port parameter of NewServer.
+func WithPort(port int) ServerOption {
+    return func(o *serverOptions) {
+        o.port = port
+    }
+}
+
+// WithTls sets the tls parameter of NewServer.
+func WithTls(tls bool) ServerOption {
+    return func(o *serverOptions) {
+        o.tls = tls
+    }
+}
+
+func NewServer(host string, opts ...ServerOption) *Server {
+    var options serverOptions
+    for _, opt := range opts {
+        opt(&amp;options)
+    }
+    port, tls := options.port, options.tls
+
+    return &amp;Server{host, port, tls}
+}
+
+func main() {
+    NewServer("localhost", WithPort(8080))
+}</pre>
+      </td>
+    </tr>
+  </table>
+`
@@ -0,0 +1,640 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines PostProcessors, which normalize the files edited by a
+// refactoring (e.g., by formatting the edited code or sorting its imports)
+// after the refactoring's own edits are made.  The post-processors form a
+// pipeline, configured per project (see ReadPostProcessors), which
+// RefactoringBase.UpdateLog runs on every Go file a refactoring edits.
+
+package refactoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// A PostProcessor normalizes the contents of a Go file edited by a
+// refactoring.  Each refactoring's edits are passed through the
+// post-processors in Config.PostProcessors, in order.
+type PostProcessor interface {
+	// PostProcess returns the normalized contents of the given file.
+	// The original contents are the file's contents before the
+	// refactoring; the edited contents, those after the refactoring's
+	// edits (and any earlier post-processors) are applied.
+	PostProcess(filename string, original, edited []byte) ([]byte, error)
+}
+
+// DefaultPostProcessors are used when Config.PostProcessors is nil: the code
+// changed by a refactoring is formatted, as gofmt would format it.  (Rename
+// and Toggle Var, which edit the code exactly, are not post-processed by
+// default.)
+var DefaultPostProcessors = []PostProcessor{FormatRegion{}}
+
+// postProcess runs the post-processors in the given configuration (see
+// PostProcessor) on each Go file edited by the refactoring (see
+// postProcessFile).
+func (r *RefactoringBase) postProcess(config *Config) {
+	processors := config.PostProcessors
+	if processors == nil {
+		if r.noDefaultPostProcessing {
+			return
+		}
+		processors = DefaultPostProcessors
+	}
+	if len(processors) == 0 {
+		return
+	}
+
+	filenames := make([]string, 0, len(r.Edits))
+	for filename, edits := range r.Edits {
+		if strings.HasSuffix(filename, ".go") && edits.Len() > 0 {
+			filenames = append(filenames, filename)
+		}
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		original := r.FileContents
+		if filename != r.Filename {
+			contents, err := readFile(config, filename)
+			if err != nil {
+				continue // e.g., a file created by the refactoring
+			}
+			original = contents
+		}
+		r.postProcessFile(filename, original, processors)
+	}
+}
+
+// postProcessFile runs the given post-processors on the given file (with the
+// given original contents), replacing its edits in r.Edits with edits that
+// produce the post-processed result.  If post-processing does not change the
+// result, the edits are left unchanged.
+func (r *RefactoringBase) postProcessFile(filename string, original []byte, processors []PostProcessor) {
+	edited, err := text.ApplyToString(r.Edits[filename], string(original))
+	if err != nil {
+		r.Log.Errorf("Transformation produced invalid EditSet: %v",
+			err.Error())
+		return
+	}
+
+	result := []byte(edited)
+	for _, p := range processors {
+		result, err = p.PostProcess(filename, original, result)
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		r.Log.Error(err)
+		if filename == r.Filename && r.File != nil {
+			r.Log.AssociatePos(r.File.Pos(), r.File.End())
+		}
+		return
+	}
+	if string(result) == edited {
+		return
+	}
+
+	editSet := text.Diff(
+		strings.SplitAfter(string(original), "\n"),
+		strings.SplitAfter(string(result), "\n"))
+	editSet.SetBaseHash(r.Edits[filename].BaseHash())
+	r.Edits[filename] = editSet
+}
+
+// readFile returns the contents of the given file in the configuration's
+// file system.
+func readFile(config *Config, filename string) ([]byte, error) {
+	reader, err := config.FileSystem.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// ReadPostProcessors reads a pipeline of post-processors from a JSON file,
+// e.g.,
+//
+//	{
+//	    "postProcessors": [
+//	        {"name": "format-region"},
+//	        {"name": "format-file"},
+//	        {"name": "fix-imports"},
+//	        {"name": "license-header", "file": "header.txt"},
+//	        {"name": "directive-preserver"},
+//	        {"name": "command", "args": ["goimports"]}
+//	    ]
+//	}
+//
+// The names correspond to FormatRegion, FormatFile, FixImports, LicenseHeader (whose
+// header is read from the given file), DirectivePreserver, and Command.  A
+// relative filename is resolved with respect to the directory containing the
+// JSON file.
+func ReadPostProcessors(filename string) ([]PostProcessor, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		PostProcessors []struct {
+			Name string   `json:"name"`
+			File string   `json:"file"`
+			Args []string `json:"args"`
+		} `json:"postProcessors"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	base, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	result := []PostProcessor{}
+	for _, p := range config.PostProcessors {
+		switch p.Name {
+		case "format-region":
+			result = append(result, FormatRegion{})
+		case "format-file":
+			result = append(result, FormatFile{})
+		case "fix-imports":
+			result = append(result, FixImports{})
+		case "directive-preserver":
+			result = append(result, DirectivePreserver{})
+		case "license-header":
+			if p.File == "" {
+				return nil, fmt.Errorf("%s: license-header requires "+
+					"a file containing the header", filename)
+			}
+			header := filepath.FromSlash(p.File)
+			if !filepath.IsAbs(header) {
+				header = filepath.Join(base, header)
+			}
+			contents, err := ioutil.ReadFile(header)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", filename, err)
+			}
+			result = append(result, LicenseHeader{Header: string(contents)})
+		case "command":
+			if len(p.Args) == 0 {
+				return nil, fmt.Errorf("%s: command requires args",
+					filename)
+			}
+			result = append(result, Command{Args: p.Args})
+		default:
+			return nil, fmt.Errorf("%s: unknown post-processor %q",
+				filename, p.Name)
+		}
+	}
+	return result, nil
+}
+
+/* -=-=- Format Region -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// FormatRegion is a PostProcessor that formats the code changed by a
+// refactoring as gofmt would, leaving the rest of the file unchanged.  Each
+// package-level declaration containing a changed line is formatted in its
+// entirety (e.g., so that a block of struct fields including an added field
+// is realigned), as is the space between declarations if lines were added or
+// removed there.  Blank lines separating groups of imports are preserved,
+// unless the edits add, remove, or rename imports.
+type FormatRegion struct{}
+
+func (FormatRegion) PostProcess(filename string, original, edited []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", edited, parser.ParseComments)
+	if err != nil {
+		if _, err := parser.ParseFile(token.NewFileSet(), "", original,
+			0); err != nil {
+			// The file could not be formatted before it was
+			// edited, either
+			return edited, nil
+		}
+		return nil, fmt.Errorf("Transformation will introduce syntax "+
+			"errors: %v", err)
+	}
+	printConfig := &printer.Config{
+		Mode:     printer.UseSpaces | printer.TabIndent,
+		Tabwidth: 8}
+	var b bytes.Buffer
+	if err = printConfig.Fprint(&b, fset, file); err != nil {
+		return nil, err
+	}
+	// The printer does not move imports between groups, but edits to the
+	// file may have; unless they changed the imports, restore the groups
+	formatted := preserveImportGroups(string(original), b.String())
+
+	formattedFset := token.NewFileSet()
+	formattedFile, err := parser.ParseFile(formattedFset, "", formatted,
+		parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	segments := declSegments(fset, file, len(edited))
+	formattedSegments := declSegments(formattedFset, formattedFile,
+		len(formatted))
+	if len(segments) != len(formattedSegments) {
+		return edited, nil
+	}
+
+	changed := changedRegions(string(original), string(edited))
+	edits := text.NewEditSet()
+	for i, segment := range segments {
+		for _, region := range changed {
+			if overlaps(segment, region) {
+				edits.Add(segment, formatted[formattedSegments[i].Offset:formattedSegments[i].OffsetPastEnd()])
+				break
+			}
+		}
+	}
+	result, err := text.ApplyToString(edits, string(edited))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(result), nil
+}
+
+// declSegments divides a file of the given length into segments: the text
+// preceding the first package-level declaration (the package clause, etc.),
+// each declaration (including its doc comment), the text between each pair of
+// declarations, and the text following the last declaration.
+func declSegments(fset *token.FileSet, file *ast.File, length int) []*text.Extent {
+	result := []*text.Extent{}
+	offset := 0
+	for _, decl := range file.Decls {
+		start := decl.Pos()
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Doc != nil {
+				start = decl.Doc.Pos()
+			}
+		case *ast.GenDecl:
+			if decl.Doc != nil {
+				start = decl.Doc.Pos()
+			}
+		}
+		startOffset := fset.Position(start).Offset
+		endOffset := fset.Position(decl.End()).Offset
+		result = append(result,
+			&text.Extent{Offset: offset, Length: startOffset - offset},
+			&text.Extent{Offset: startOffset,
+				Length: endOffset - startOffset})
+		offset = endOffset
+	}
+	return append(result,
+		&text.Extent{Offset: offset, Length: length - offset})
+}
+
+// changedRegions returns the extents of the lines in the edited text that
+// differ from the original text, excluding the newline ending the last line
+// of each region.  An empty extent marks the position of lines that were
+// deleted.
+func changedRegions(original, edited string) []*text.Extent {
+	result := []*text.Extent{}
+	var last *text.Extent
+	lastEnd, delta := -1, 0
+	text.Diff(strings.SplitAfter(original, "\n"),
+		strings.SplitAfter(edited, "\n")).Iterate(
+		func(extent *text.Extent, replacement string) bool {
+			// A changed line is deleted and inserted; the deletion
+			// and insertion form a single region
+			if last != nil && extent.Offset <= lastEnd {
+				last.Length += len(replacement)
+			} else {
+				last = &text.Extent{
+					Offset: extent.Offset + delta,
+					Length: len(replacement)}
+				result = append(result, last)
+			}
+			lastEnd = extent.OffsetPastEnd()
+			delta += len(replacement) - extent.Length
+			return true
+		})
+	for _, region := range result {
+		if region.Length > 0 &&
+			edited[region.OffsetPastEnd()-1] == '\n' {
+			region.Length--
+		}
+	}
+	return result
+}
+
+// overlaps returns true if a segment of a file contains text in the given
+// changed region.  A segment adjacent to a region does not overlap it (e.g.,
+// so that formatting a renamed declaration does not insert blank lines
+// around it), unless the region is empty, i.e., it marks lines that were
+// deleted.
+func overlaps(segment, region *text.Extent) bool {
+	if region.Length == 0 {
+		return segment.Offset <= region.Offset &&
+			region.Offset <= segment.OffsetPastEnd()
+	}
+	return segment.Offset < region.OffsetPastEnd() &&
+		region.Offset < segment.OffsetPastEnd()
+}
+
+/* -=-=- Format File -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// FormatFile is a PostProcessor that formats an edited file in its entirety,
+// as gofmt would.  Unlike FormatRegion, it also reformats code the
+// refactoring did not change.  Blank lines separating groups of imports are
+// preserved, unless the edits add, remove, or rename imports.
+type FormatFile struct{}
+
+func (FormatFile) PostProcess(filename string, original, edited []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", edited, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("Transformation will introduce syntax "+
+			"errors: %v", err)
+	}
+	printConfig := &printer.Config{
+		Mode:     printer.UseSpaces | printer.TabIndent,
+		Tabwidth: 8}
+	var b bytes.Buffer
+	if err = printConfig.Fprint(&b, fset, file); err != nil {
+		return nil, err
+	}
+	// The printer does not move imports between groups, but edits to the
+	// file may have; unless they changed the imports, restore the groups
+	return []byte(preserveImportGroups(string(original), b.String())), nil
+}
+
+/* -=-=- Fix Imports -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// FixImports is a PostProcessor that sorts the imports in each group of an
+// edited file's import declarations and removes duplicate imports, as gofmt
+// does.  (It does not add or remove imports based on their use, as goimports
+// does; refactorings do that themselves.)
+type FixImports struct{}
+
+func (FixImports) PostProcess(filename string, original, edited []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", edited,
+		parser.ImportsOnly|parser.ParseComments)
+	if err != nil || len(file.Imports) == 0 {
+		return edited, nil
+	}
+	start, end := -1, -1
+	for _, decl := range file.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			if start < 0 {
+				start = fset.Position(decl.Pos()).Offset
+			}
+			end = fset.Position(decl.End()).Offset
+		}
+	}
+	imports := string(edited[start:end])
+
+	// Sort the import declarations in a file by themselves, so that the
+	// rest of the file is not reformatted
+	const pkgClause = "package p\n\n"
+	fset = token.NewFileSet()
+	file, err = parser.ParseFile(fset, "", pkgClause+imports,
+		parser.ParseComments)
+	if err != nil {
+		return edited, nil
+	}
+	ast.SortImports(fset, file)
+	var b bytes.Buffer
+	if err := format.Node(&b, fset, file); err != nil {
+		return edited, nil
+	}
+	sorted := strings.TrimSuffix(strings.TrimPrefix(b.String(), pkgClause),
+		"\n")
+	if sorted == imports {
+		return edited, nil
+	}
+	result := string(edited[:start]) + sorted + string(edited[end:])
+	return []byte(result), nil
+}
+
+/* -=-=- License Header -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// LicenseHeader is a PostProcessor that adds a license header (e.g., a
+// copyright notice) to each edited file whose header comments do not already
+// contain it.  As for Config.LicenseHeader, lines of the header that are not
+// already comments are commented out.
+type LicenseHeader struct {
+	Header string
+}
+
+func (h LicenseHeader) PostProcess(filename string, original, edited []byte) ([]byte, error) {
+	license := commentText(h.Header)
+	if license == "" {
+		return edited, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", edited,
+		parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return edited, nil
+	}
+	header := readFileHeader(fset, file, edited)
+	if strings.Contains(header.text, license) {
+		return edited, nil
+	}
+
+	// Build constraints may only be preceded by line comments, so a
+	// block comment is added after them
+	offset, insert := 0, license+"\n\n"
+	if strings.HasPrefix(license, "/*") {
+		for _, cg := range file.Comments {
+			if cg.End() > file.Package ||
+				file.Doc != nil && cg.End() > file.Doc.Pos() {
+				break
+			}
+			if isBuildConstraint(cg) {
+				offset = fset.Position(cg.End()).Offset
+				insert = "\n\n" + license
+			}
+		}
+	}
+	result := string(edited[:offset]) + insert + string(edited[offset:])
+	return []byte(result), nil
+}
+
+/* -=-=- Directive Preserver -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// DirectivePreserver is a PostProcessor that restores directives (e.g.,
+// //go:noinline or //nolint comments) that a refactoring's edits removed
+// from the doc comment of a package-level declaration that is still in the
+// file, as well as directives (e.g., //go:build constraints) removed from the
+// file's header.
+type DirectivePreserver struct{}
+
+func (DirectivePreserver) PostProcess(filename string, original, edited []byte) ([]byte, error) {
+	origFset := token.NewFileSet()
+	origFile, err := parser.ParseFile(origFset, "", original,
+		parser.ParseComments)
+	if err != nil {
+		return edited, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", edited, parser.ParseComments)
+	if err != nil {
+		return edited, nil
+	}
+
+	edits := text.NewEditSet()
+	if missing := missingDirectives(headerDirectives(origFile),
+		headerDirectives(file)); len(missing) > 0 {
+		edits.Add(&text.Extent{Offset: 0, Length: 0},
+			strings.Join(missing, "\n")+"\n\n")
+	}
+	origDecls := map[string]ast.Decl{}
+	for _, decl := range origFile.Decls {
+		origDecls[declKey(decl)] = decl
+	}
+	for _, decl := range file.Decls {
+		origDecl, ok := origDecls[declKey(decl)]
+		if !ok || declKey(decl) == "" {
+			continue
+		}
+		missing := missingDirectives(docDirectives(origDecl),
+			docDirectives(decl))
+		if len(missing) > 0 {
+			// Directives are conventionally placed at the end of
+			// the doc comment, immediately before the declaration
+			offset := fset.Position(decl.Pos()).Offset
+			edits.Add(&text.Extent{Offset: offset, Length: 0},
+				strings.Join(missing, "\n")+"\n")
+		}
+	}
+	result, err := text.ApplyToString(edits, string(edited))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(result), nil
+}
+
+// isDirective returns true if the given comment is a directive to the
+// compiler or another tool, rather than documentation.
+func isDirective(comment string) bool {
+	for _, prefix := range []string{"//go:", "// +build", "//line ",
+		"//export ", "//nolint", "//lint:"} {
+		if strings.HasPrefix(comment, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerDirectives returns the directives preceding the package clause (and
+// the package doc comment) of the given file.
+func headerDirectives(file *ast.File) []string {
+	result := []string{}
+	for _, cg := range file.Comments {
+		if cg.End() > file.Package ||
+			file.Doc != nil && cg.End() > file.Doc.Pos() {
+			break
+		}
+		result = append(result, directives(cg)...)
+	}
+	return result
+}
+
+// docDirectives returns the directives in the given declaration's doc
+// comment.
+func docDirectives(decl ast.Decl) []string {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		return directives(decl.Doc)
+	case *ast.GenDecl:
+		return directives(decl.Doc)
+	}
+	return nil
+}
+
+func directives(cg *ast.CommentGroup) []string {
+	result := []string{}
+	if cg != nil {
+		for _, c := range cg.List {
+			if isDirective(c.Text) {
+				result = append(result, c.Text)
+			}
+		}
+	}
+	return result
+}
+
+// missingDirectives returns the directives in orig that are not in current.
+func missingDirectives(orig, current []string) []string {
+	present := map[string]bool{}
+	for _, d := range current {
+		present[d] = true
+	}
+	result := []string{}
+	for _, d := range orig {
+		if !present[d] {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// declKey identifies a package-level declaration by the name it declares
+// (qualified by its receiver type, for a method), or "" if it declares
+// nothing (e.g., an import declaration).
+func declKey(decl ast.Decl) string {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Recv != nil && len(decl.Recv.List) == 1 {
+			return types.ExprString(decl.Recv.List[0].Type) + "." +
+				decl.Name.Name
+		}
+		return decl.Name.Name
+	case *ast.GenDecl:
+		if decl.Tok == token.IMPORT || len(decl.Specs) == 0 {
+			return ""
+		}
+		switch spec := decl.Specs[0].(type) {
+		case *ast.TypeSpec:
+			return spec.Name.Name
+		case *ast.ValueSpec:
+			return spec.Names[0].Name
+		}
+	}
+	return ""
+}
+
+/* -=-=- Command -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// Command is a PostProcessor that pipes each edited file through an external
+// command (e.g., goimports), which must write the processed file to its
+// standard output.  The command is run in the directory containing the file.
+type Command struct {
+	// The command and its arguments
+	Args []string
+}
+
+func (c Command) PostProcess(filename string, original, edited []byte) ([]byte, error) {
+	cmd := exec.Command(c.Args[0], c.Args[1:]...)
+	cmd.Dir = filepath.Dir(filename)
+	cmd.Stdin = bytes.NewReader(edited)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed on %s: %v\n%s", c.Args[0],
+			filepath.Base(filename), err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestReadPostProcessors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "postprocess.json")
+	write := func(contents string) {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := filepath.Join(dir, "header.txt")
+	if err := ioutil.WriteFile(header, []byte("Copyright\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	write(`{"postProcessors": [{"name": "format-file"},
+		{"name": "fix-imports"},
+		{"name": "license-header", "file": "header.txt"},
+		{"name": "command", "args": ["goimports"]}]}`)
+	processors, err := ReadPostProcessors(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processors) != 4 ||
+		processors[0] != (FormatFile{}) ||
+		processors[1] != (FixImports{}) ||
+		processors[2] != (LicenseHeader{Header: "Copyright\n"}) ||
+		processors[3].(Command).Args[0] != "goimports" {
+		t.Fatalf("Incorrect post-processors: %v", processors)
+	}
+
+	for _, contents := range []string{
+		`{"postProcessors": [{"name": "gofumpt"}]}`,
+		`{"postProcessors": [{"name": "license-header"}]}`,
+		`{"postProcessors": [{"name": "command"}]}`,
+		`{"postProcessors": `,
+	} {
+		write(contents)
+		if _, err := ReadPostProcessors(filename); err == nil {
+			t.Errorf("%s should have been rejected", contents)
+		}
+	}
+}
+
+func TestPostProcessors(t *testing.T) {
+	tests := []struct {
+		name             string
+		processor        PostProcessor
+		original, edited string
+		expected         string
+		expectErr        bool
+	}{
+		{
+			name:      "format-region formats only changed lines",
+			processor: FormatRegion{},
+			original:  "package p\n\nvar a=1\n\nfunc f() {\n}\n",
+			edited:    "package p\n\nvar a=1\n\nfunc f() {\ny:=2\nif y>0 {\n}\n}\n",
+			expected:  "package p\n\nvar a=1\n\nfunc f() {\n\ty := 2\n\tif y > 0 {\n\t}\n}\n",
+		},
+		{
+			name:      "format-file formats unchanged lines as well",
+			processor: FormatFile{},
+			original:  "package p\n\nvar a=1\n",
+			edited:    "package p\n\n// a is one\nvar a=1\n",
+			expected:  "package p\n\n// a is one\nvar a = 1\n",
+		},
+		{
+			name:      "format-file rejects syntax errors",
+			processor: FormatFile{},
+			original:  "package p\n",
+			edited:    "package p\n\nfunc {\n",
+			expectErr: true,
+		},
+		{
+			name:      "format-region formats entire declarations",
+			processor: FormatRegion{},
+			original:  "package p\n\ntype T struct {\n\tA int\n\tB int\n}\n",
+			edited:    "package p\n\ntype T struct {\n\tA int\n\tLonger int // x\n\tB int\n}\n",
+			expected:  "package p\n\ntype T struct {\n\tA      int\n\tLonger int // x\n\tB      int\n}\n",
+		},
+		{
+			name:      "format-region does not format lines adjacent to edits",
+			processor: FormatRegion{},
+			original:  "package p\nimport \"fmt\"\nvar a = 1\nfunc f() {\n\tfmt.Println(a)\n}",
+			edited:    "package p\nimport \"fmt\"\nvar b = 1\nfunc f() {\n\tfmt.Println(b)\n}",
+			expected:  "package p\nimport \"fmt\"\nvar b = 1\nfunc f() {\n\tfmt.Println(b)\n}",
+		},
+		{
+			name:      "format-region rejects syntax errors",
+			processor: FormatRegion{},
+			original:  "package p\n",
+			edited:    "package p\n\nfunc {\n",
+			expectErr: true,
+		},
+		{
+			name:      "format-region ignores files that did not parse",
+			processor: FormatRegion{},
+			original:  "package p\n\nfunc {\n",
+			edited:    "package p\n\nfunc  {\n",
+			expected:  "package p\n\nfunc  {\n",
+		},
+		{
+			name:      "fix-imports",
+			processor: FixImports{},
+			original:  "package p\n",
+			edited:    "package p\n\nimport (\n\t\"strings\"\n\t\"fmt\"\n\t\"strings\"\n)\n\nvar x=1\n",
+			expected:  "package p\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\nvar x=1\n",
+		},
+		{
+			name:      "license-header",
+			processor: LicenseHeader{Header: "Copyright 2018"},
+			original:  "package p\n",
+			edited:    "//go:build linux\n\npackage p\n",
+			expected:  "// Copyright 2018\n\n//go:build linux\n\npackage p\n",
+		},
+		{
+			name:      "license-header block comment",
+			processor: LicenseHeader{Header: "/* Copyright 2018 */"},
+			original:  "package p\n",
+			edited:    "//go:build linux\n\npackage p\n",
+			expected:  "//go:build linux\n\n/* Copyright 2018 */\n\npackage p\n",
+		},
+		{
+			name:      "license-header already present",
+			processor: LicenseHeader{Header: "Copyright 2018"},
+			original:  "package p\n",
+			edited:    "// Copyright 2018\n\npackage p\n",
+			expected:  "// Copyright 2018\n\npackage p\n",
+		},
+		{
+			name:      "directive-preserver",
+			processor: DirectivePreserver{},
+			original:  "//go:build linux\n\npackage p\n\n// F does it.\n//go:noinline\nfunc F() {}\n\n//nolint\nfunc G() {}\n",
+			edited:    "package p\n\n// F does it.\nfunc F() { g() }\n\nfunc g() {}\n",
+			expected:  "//go:build linux\n\npackage p\n\n// F does it.\n//go:noinline\nfunc F() { g() }\n\nfunc g() {}\n",
+		},
+	}
+	for _, test := range tests {
+		result, err := test.processor.PostProcess("p.go",
+			[]byte(test.original), []byte(test.edited))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if string(result) != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name,
+				test.expected, result)
+		}
+	}
+}
+
+func TestNoDefaultPostProcessing(t *testing.T) {
+	original := "package p\n\nvar a=1\n"
+	postProcess := func(processors []PostProcessor) string {
+		r := &RefactoringBase{}
+		r.Log = NewLog()
+		r.Filename = "p.go"
+		r.FileContents = []byte(original)
+		r.Edits = map[string]*text.EditSet{"p.go": text.NewEditSet()}
+		r.Edits["p.go"].Add(&text.Extent{Offset: 15, Length: 1}, "b")
+		r.noDefaultPostProcessing = true
+		r.postProcess(&Config{PostProcessors: processors})
+		result, err := text.ApplyToString(r.Edits["p.go"], original)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// The DefaultPostProcessors would format "var b=1"
+	if result := postProcess(nil); result != "package p\n\nvar b=1\n" {
+		t.Errorf("expected no default post-processing; got\n%s", result)
+	}
+	// Post-processors given in the Config are run regardless
+	result := postProcess([]PostProcessor{FormatRegion{}})
+	if result != "package p\n\nvar b = 1\n" {
+		t.Errorf("expected explicit post-processing; got\n%s", result)
+	}
+}
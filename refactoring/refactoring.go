@@ -13,18 +13,21 @@ package refactoring
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"go/ast"
-	"go/parser"
-	"go/printer"
+	"go/build"
 	"go/token"
 	"go/types"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/godoctor/godoctor/analysis/loader"
 	"github.com/godoctor/godoctor/filesystem"
@@ -32,7 +35,7 @@ import (
 	"golang.org/x/tools/go/packages"
 )
 
-// The maximum number of errors from the go/loader that will be reported
+// The maximum number of errors from loading the program that will be reported
 const maxInitialErrors = 10
 
 // Description of a parameter for a refactoring.
@@ -67,6 +70,42 @@ func (p *Parameter) IsBoolean() bool {
 	}
 }
 
+// Name returns a name for this Parameter derived from its Label, suitable for
+// use as a command line flag: the label is converted to lowercase, its
+// trailing colon is removed, and spaces are replaced by hyphens (e.g., "New
+// Name:" becomes "new-name").
+func (p *Parameter) Name() string {
+	label := strings.TrimSuffix(strings.TrimSpace(p.Label), ":")
+	return strings.ToLower(strings.Join(strings.Fields(label), "-"))
+}
+
+// A Quality indicates how mature a refactoring is, so that user interfaces can
+// decide whether to offer it to end users.
+type Quality int
+
+const (
+	// The refactoring is incomplete or intended only for developers of
+	// the Go Doctor (e.g., Debug)
+	Development Quality = iota
+	// The refactoring is complete but has not been used widely; it may
+	// reject or mishandle some programs
+	Testing
+	// The refactoring is suitable for general use
+	Production
+)
+
+// String returns the name of the quality level (e.g., "Production").
+func (q Quality) String() string {
+	switch q {
+	case Production:
+		return "Production"
+	case Testing:
+		return "Testing"
+	default:
+		return "Development"
+	}
+}
+
 // Description provides information about a refactoring suitable for display in
 // a user interface.
 type Description struct {
@@ -103,6 +142,11 @@ type Description struct {
 	OptionalParams []Parameter
 	// False if this refactoring is not intended for production use.
 	Hidden bool
+	// The maturity of this refactoring.  Hidden refactorings should have
+	// Quality=Development.  The zero value is Development, so a
+	// refactoring is not offered to end users by default unless it is
+	// explicitly marked as Production.
+	Quality Quality
 }
 
 // A Config provides the initial configuration for a refactoring, including the
@@ -113,11 +157,19 @@ type Description struct {
 type Config struct {
 	// The File system on which the refactoring will operate.
 	FileSystem filesystem.FileSystem
-	// A set of initial packages to load.  This extents will be passed as-is
-	// to the Config.FromArgs method of go.tools/go/loader.  Typically, the
+	// A set of initial packages to load.  These are passed as patterns to
+	// golang.org/x/tools/go/packages.Load (see createLoader).  Typically, the
 	// scope will consist of a package name or a File containing the
 	// Program entrypoint (main function), which may be different from the
 	// File containing the text selection.
+	//
+	// The scope may include directories in several modules (e.g., a
+	// library and an application using it, in a repository without a
+	// go.work file).  Since the go command can only load packages from
+	// one main module at a time, the packages in each module are loaded
+	// separately (from the module's root directory), and the results are
+	// merged, so that (e.g.) renaming a declaration in the library also
+	// renames references to it in the application.
 	Scope []string
 	// The range of text on which to invoke the refactoring.
 	Selection text.Selection
@@ -142,6 +194,74 @@ type Config struct {
 	GoRoot string
 	// Set GO111MODULE=off if true, else determine from the environment.
 	ModulesOff bool
+	// If non-empty, only the packages in the scope whose import paths
+	// begin with one of these prefixes are loaded (after patterns such as
+	// ./... are expanded); their dependencies are still loaded as needed.
+	// This bounds the analysis in very large repositories.
+	ScopeInclude []string
+	// Packages in the scope whose import paths begin with one of these
+	// prefixes are not loaded (unless they are dependencies of other
+	// packages in the scope).
+	ScopeExclude []string
+	// Determines the scope if Scope is nil.  If this is also nil, the
+	// scope is guessed based on the GOPATH.
+	ScopeProvider ScopeProvider
+	// Scanners that find references to identifiers in files that are not
+	// Go source code (e.g., configuration files), which the Rename
+	// refactoring should update along with the Go code.
+	SidecarScanners []SidecarScanner
+	// If non-empty, the license header (e.g., a copyright notice) to place
+	// at the beginning of files created by a refactoring.  Lines that are
+	// not already comments are commented out.  If this is empty, the
+	// header is copied from an existing file in the package.
+	LicenseHeader string
+	// If non-nil, templates that override the defaults used to generate
+	// code, such as doc comment stubs and extracted functions (see
+	// CodeTemplates and ReadCodeTemplates).
+	Templates CodeTemplates
+	// Additional environment variables (of the form key=value) to use
+	// when loading the program.
+	Env []string
+	// The directory in which to load the program (i.e., run the go
+	// command).  If this is empty, the current directory is used.  If
+	// the scope is guessed from a file outside $GOPATH/src, this is set to
+	// the directory containing the file.
+	Dir string
+	// If non-nil, loading the program is aborted (and an error is logged)
+	// when this context is cancelled.  This allows a client, such as a
+	// text editor, to abort a refactoring that is taking too long.
+	Context context.Context
+	// If non-nil, this is called periodically while the program is
+	// loaded, with the number of packages loaded so far and the total
+	// number of packages to load, so that a client can display progress
+	// (see loader.LoadWithProgress).  The program may be loaded more than
+	// once (e.g., to check the refactored program for errors).
+	Progress func(done, total int)
+	// If non-nil, this is called each time the program is loaded, with
+	// the time it took to load, so that a long-running client (e.g., the
+	// protocol daemon) can monitor load times.
+	Loaded func(elapsed time.Duration)
+	// The target operating system, architecture, and build tags under
+	// which the program is loaded.  The zero value loads the program
+	// under the default build configuration.  To refactor code that is
+	// only compiled under certain configurations (e.g., files named
+	// *_windows.go), see RunInConfigurations.
+	Build BuildConfig
+	// If non-nil, the program is loaded without running the go command, so
+	// a Go toolchain is not required (e.g., when the Go Doctor is embedded
+	// in a code review bot).  The packages in the scope, which must be
+	// directories or source files, are type checked from source, and the
+	// packages they import are obtained from the importer this returns
+	// (e.g., loader.ExportDataImporter, reading precompiled export data
+	// shipped with the client).  It is called with the FileSet into which
+	// the program is loaded.  See loader.LoadWithImporter.
+	NewImporter func(fset *token.FileSet) types.Importer
+	// Post-processors applied, in order, to each Go file edited by the
+	// refactoring (e.g., to format the edited code), before the edits are
+	// checked for errors.  If this is nil, DefaultPostProcessors are used;
+	// to disable post-processing, set this to an empty slice.  See
+	// PostProcessor and ReadPostProcessors.
+	PostProcessors []PostProcessor
 }
 
 // The Refactoring interface identifies methods common to all refactorings.
@@ -169,16 +289,41 @@ type Result struct {
 	// refactoring.
 	Log *Log
 	// Maps filenames to the text edits that should be applied to those
-	// files.
+	// files.  To apply these, drivers should use Transaction, so that
+	// the edits and FSChanges are applied together.
 	Edits map[string]*text.EditSet
+	// Changes to the file system (e.g., creating new files) that should
+	// be made in addition to the text edits in Edits.
+	FSChanges []filesystem.Change
+	// Classifies some or all of the Edits (e.g., the Rename refactoring
+	// classifies each occurrence of the name being changed as a
+	// declaration, read, write, etc.), so that drivers can display a
+	// grouped preview.  See ExcludeOccurrences.
+	Occurrences []Occurrence
+	// Changes to the exported API of the refactored packages (e.g., an
+	// exported name removed by the Rename refactoring), so that library
+	// maintainers can review them.  See APIReport.
+	APIChanges []APIChange
+	// If the refactoring was applied to a different region of the file
+	// than the one selected (e.g., Extract Function extends a selection to
+	// enclose complete statements), the region it was applied to, so that
+	// editors can show it; otherwise, nil.
+	AdjustedSelection *text.OffsetLengthSelection
 	// DebugOutput is used by the debug refactoring to output additional
 	// information (e.g., the description of the AST or control flow graph)
 	// that doesn't belong in the log or the output file
 	DebugOutput bytes.Buffer
 }
 
+// Transaction returns the Edits and FSChanges of this Result as a single
+// transaction, which can be validated and then applied all at once.
+func (r *Result) Transaction() *filesystem.EditTransaction {
+	return filesystem.NewEditTransaction(r.Edits, r.FSChanges)
+}
+
 const cgoError1 = "could not import C ("
 const cgoError2 = "undeclared name: C"
+const importError = "could not import "
 
 type RefactoringBase struct {
 	// The Program to be refactored, including all dependent files
@@ -204,6 +349,15 @@ type RefactoringBase struct {
 	SelectedNodePkg *packages.Package
 	// The Result of this refactoring, returned to the client invoking it
 	Result
+	// The configuration with which the Program was loaded: a copy of the
+	// Config given to Init, with its scope (and the directory and
+	// environment in which the scope is loaded) resolved, so that the
+	// Config itself is not changed and can be reused for another file
+	loadConfig *Config
+	// If true, the DefaultPostProcessors are not run on this refactoring's
+	// edits; post-processors given in the Config still are (see
+	// PostProcessor)
+	noDefaultPostProcessing bool
 }
 
 // Setup code for a Run method.  Most refactorings should invoke this
@@ -213,7 +367,11 @@ type RefactoringBase struct {
 func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 	r.Log = NewLog()
 	r.Edits = map[string]*text.EditSet{}
+	r.FSChanges = []filesystem.Change{}
+	r.Occurrences = nil
+	r.AdjustedSelection = nil
 	r.DebugOutput.Reset()
+	r.noDefaultPostProcessing = false
 
 	if config.FileSystem == nil {
 		r.Log.Error("INTERNAL ERROR: null Config.FileSystem")
@@ -224,9 +382,21 @@ func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 		return &r.Result
 	}
 
-	if config.Scope == nil {
+	lconfig := *config
+	r.loadConfig = &lconfig
+	if config.Scope == nil && config.ScopeProvider != nil {
+		scope, env, err := config.ScopeProvider.Scope(
+			config.Selection.GetFilename())
+		if err != nil {
+			r.Log.Error(err)
+			return &r.Result
+		}
+		lconfig.Scope = scope
+		lconfig.Env = append(append([]string{}, config.Env...), env...)
+		r.Log.Infof("Scope is %s", strings.Join(lconfig.Scope, " "))
+	} else if config.Scope == nil {
 		var msg string
-		config.Scope, msg = r.guessScope(config)
+		lconfig.Scope, lconfig.Dir, msg = r.guessScope(config)
 		r.Log.Infof(msg)
 	} else {
 		r.Log.Infof("Scope is %s", strings.Join(config.Scope, " "))
@@ -236,7 +406,7 @@ func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 
 	var err error
 	mutex := &sync.Mutex{}
-	r.Program, err = createLoader(config, func(err error) {
+	r.Program, err = createLoader(&lconfig, func(err error) {
 		message := strings.Replace(err.Error(), stdin+":", "<stdin>:", -1)
 		// TODO: This is temporary until go/loader handles cgo
 		if !strings.Contains(message, cgoError1) &&
@@ -249,6 +419,7 @@ func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 			} else {
 				r.Log.Error(message)
 			}
+			r.Log.AssociateCode(CodeTypeError)
 			mutex.Unlock()
 		}
 	})
@@ -264,7 +435,11 @@ func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 
 	r.Log.Fset = r.Program.Fset
 
-	r.SelectionStart, r.SelectionEnd, err = config.Selection.Convert(r.Program.Fset)
+	if decl, ok := config.Selection.(*DeclSelection); ok {
+		r.SelectionStart, r.SelectionEnd, err = decl.resolve(r.Program)
+	} else {
+		r.SelectionStart, r.SelectionEnd, err = config.Selection.Convert(r.Program.Fset)
+	}
 	if err != nil {
 		r.Log.Error(err)
 		return &r.Result
@@ -276,7 +451,7 @@ func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 		r.Log.Errorf("The selected file, %s, was not found in the "+
 			"provided scope: %s",
 			config.Selection.GetFilename(),
-			config.Scope)
+			lconfig.Scope)
 		// This can happen on files containing +build
 		return &r.Result
 	}
@@ -306,11 +481,17 @@ func (r *RefactoringBase) Init(config *Config, desc *Description) *Result {
 	r.Edits = map[string]*text.EditSet{
 		r.Filename: text.NewEditSet(),
 	}
+	// Refuse to apply the edits if the file changes after it is analyzed
+	r.Edits[r.Filename].SetBase(r.FileContents)
 
 	return &r.Result
 }
 
 func createLoader(config *Config, errorHandler func(error)) (*loader.Program, error) {
+	if config.NewImporter != nil {
+		return loadWithImporter(config, errorHandler)
+	}
+
 	// TODO: need to rehack most of this probably to go away as now modules
 	// do not require this GOPATH hackery, it may "just work" in PWD as is
 	env := os.Environ()
@@ -336,9 +517,14 @@ func createLoader(config *Config, errorHandler func(error)) (*loader.Program, er
 	if config.ModulesOff {
 		env = append(env, "GO111MODULE=off")
 	}
+	env = append(env, config.Build.env()...)
+	env = append(env, config.Env...)
 
 	var lconfig packages.Config
 	lconfig.Env = env
+	lconfig.BuildFlags = config.Build.buildFlags()
+	lconfig.Dir = config.Dir
+	lconfig.Context = config.Context
 
 	switch fs := config.FileSystem.(type) {
 	case *filesystem.EditedFileSystem:
@@ -358,29 +544,107 @@ func createLoader(config *Config, errorHandler func(error)) (*loader.Program, er
 		}
 	}
 
-	return loader.Load(&lconfig, errorHandler, config.Scope...)
+	roots := []scopeRoot{{dir: config.Dir, patterns: config.Scope}}
+	if !config.ModulesOff {
+		if multi := scopeRoots(config.Dir, config.Scope); multi != nil {
+			roots = multi
+			// All packages must be in the same FileSet so that the
+			// programs can be merged
+			lconfig.Fset = token.NewFileSet()
+		}
+	}
+
+	start := time.Now()
+	var prog *loader.Program
+	var loadErr error
+	for _, root := range roots {
+		rconfig := lconfig
+		rconfig.Dir = root.dir
+		scope := root.patterns
+		if len(config.ScopeInclude) > 0 || len(config.ScopeExclude) > 0 {
+			var err error
+			scope, err = filterScope(&rconfig, scope,
+				config.ScopeInclude, config.ScopeExclude)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		rprog, err := loader.LoadWithProgress(&rconfig, errorHandler,
+			config.Progress, scope...)
+		if err != nil {
+			prog = nil
+			loadErr = err
+			break
+		}
+		if prog == nil {
+			prog = rprog
+		} else {
+			prog.Merge(rprog)
+		}
+	}
+	if config.Loaded != nil {
+		config.Loaded(time.Since(start))
+	}
+	return prog, loadErr
+}
+
+// loadWithImporter loads the program without the go command, using the
+// importer returned by config.NewImporter.  Files are read from the
+// refactoring's file system, so (unlike the go command) no overlay is needed.
+func loadWithImporter(config *Config, errorHandler func(error)) (*loader.Program, error) {
+	if len(config.ScopeInclude) > 0 || len(config.ScopeExclude) > 0 {
+		return nil, fmt.Errorf("Scope filters require the go command, " +
+			"which is not used when an importer is provided")
+	}
+	ctxt := config.Build.Context(config.FileSystem)
+	if config.GoPath != "" {
+		ctxt.GOPATH = config.GoPath
+	}
+	fset := token.NewFileSet()
+	start := time.Now()
+	prog, err := loader.LoadWithImporter(ctxt, fset,
+		config.NewImporter(fset), errorHandler, config.Dir,
+		config.Scope...)
+	if config.Loaded != nil {
+		config.Loaded(time.Since(start))
+	}
+	return prog, err
 }
 
 // guessScope makes a reasonable guess at the refactoring scope if the user
-// does not provide an explicit scope.  It guesses as follows:
-//     1. If Filename is not in $GOPATH/src, Filename is used as the scope.
+// does not provide an explicit scope, returning the scope and the directory
+// from which it should be loaded, along with a message
+// describing the guess.  It guesses as follows:
+//     1. If Filename is not in $GOPATH/src, the package in the directory
+//        containing Filename is used as the scope.
 //     2. If Filename is in $GOPATH/src, a package name is guessed by stripping
 //        $GOPATH/src/ from the Filename, and that package is used as the scope.
-func (r *RefactoringBase) guessScope(config *Config) ([]string, string) {
+// If $GOPATH lists several directories, each is tried in turn.  In either
+// case, the package's tests (including an external foo_test package) are
+// loaded along with it, so references in tests are updated as well.  Standard
+// input is always refactored using file scope.
+func (r *RefactoringBase) guessScope(config *Config) ([]string, string, string) {
 	fname := config.Selection.GetFilename()
 	fnameScope := []string{fname}
 
-	var fnameMsg string
 	if filepath.Base(fname) == filesystem.FakeStdinFilename {
-		fnameMsg = "Defaulting to file scope for refactoring (provide an explicit scope to change this)"
-	} else {
-		fnameMsg = fmt.Sprintf("Defaulting to file scope %s for refactoring (provide an explicit scope to change this)", fname)
+		return fnameScope, config.Dir, "Defaulting to file scope for refactoring (provide an explicit scope to change this)"
 	}
 
 	absFilename, err := filepath.Abs(fname)
 	if err != nil {
 		r.Log.Error(err.Error())
-		return fnameScope, fnameMsg
+		return fnameScope, config.Dir, fmt.Sprintf("Defaulting to file scope %s for refactoring (provide an explicit scope to change this)", fname)
+	}
+
+	// A file pattern would load only the given file, as an ad hoc package
+	// with no tests, so load the package in its directory instead.  The
+	// package is loaded as "." from that directory, which works in both
+	// GOPATH and module mode (even if the current directory is outside
+	// the module).
+	dirScope := func() ([]string, string, string) {
+		return []string{"."}, filepath.Dir(absFilename), fmt.Sprintf("Defaulting to the package containing %s for refactoring (provide an explicit scope to change this)", fname)
 	}
 
 	gopath := config.GoPath
@@ -389,34 +653,110 @@ func (r *RefactoringBase) guessScope(config *Config) ([]string, string) {
 	}
 	if gopath == "" {
 		r.Log.Warn("GOPATH not set")
-		return fnameScope, fnameMsg
+		return dirScope()
+	}
+
+	for _, dir := range filepath.SplitList(gopath) {
+		dir, err = filepath.Abs(dir)
+		if err != nil {
+			r.Log.Error(err)
+			return dirScope()
+		}
+		if pkg, ok := packageInGoPath(absFilename, dir); ok {
+			return []string{pkg}, config.Dir,
+				fmt.Sprintf("Defaulting to package scope %s for refactoring (provide an explicit scope to change this)", pkg)
+		}
+	}
+	return dirScope()
+}
+
+// findModuleRoot returns the directory containing the go.mod file for the
+// module enclosing the given (absolute) directory, or "" if there is none.
+func findModuleRoot(dir string) string {
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil &&
+			!fi.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// goVersionAtLeast determines whether code in the given (absolute) directory
+// may use language features introduced in Go 1.minor.  In a module, this is
+// determined by the go directive in the module's go.mod file; otherwise (if
+// dir is "" because modules are off, or there is no go directive), by the
+// release of the Go toolchain.  It also returns the version that was checked
+// (e.g., "1.21"), for use in error messages.
+func goVersionAtLeast(dir string, minor int) (bool, string) {
+	root := ""
+	if dir != "" {
+		root = findModuleRoot(dir)
 	}
-	gopath, err = filepath.Abs(gopath)
+	if root != "" {
+		contents, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(contents), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) == 2 && fields[0] == "go" {
+					return goMinorVersion(fields[1]) >= minor, fields[1]
+				}
+			}
+		}
+	}
+	tags := build.Default.ReleaseTags
+	version := strings.TrimPrefix(tags[len(tags)-1], "go")
+	return goMinorVersion(version) >= minor, version
+}
+
+// goMinorVersion returns the minor version number of a Go version such as
+// "1.21", "1.21.3", or "1.22rc1", or -1 if the version is not of that form.
+func goMinorVersion(version string) int {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 || parts[0] != "1" {
+		return -1
+	}
+	digits := parts[1]
+	for i, c := range digits {
+		if c < '0' || c > '9' {
+			digits = digits[:i]
+			break
+		}
+	}
+	minor, err := strconv.Atoi(digits)
 	if err != nil {
-		r.Log.Error(err)
-		return fnameScope, fnameMsg
+		return -1
 	}
+	return minor
+}
 
+// packageInGoPath determines whether the given (absolute) filename is in a
+// package under gopath/src.  If so, it returns the package's import path
+// (which always uses forward slashes) and true; otherwise, it returns false.
+// A file on a different volume than gopath (on Windows) is not in a package.
+func packageInGoPath(absFilename, gopath string) (string, bool) {
 	gopathSrc := filepath.Join(gopath, "src")
 
 	relFilename, err := filepath.Rel(gopathSrc, absFilename)
 	if err != nil {
-		r.Log.Error(err)
-		return fnameScope, fnameMsg
+		return "", false
 	}
 
-	if strings.HasPrefix(relFilename, "..") {
-		return fnameScope, fnameMsg
+	if relFilename == ".." ||
+		strings.HasPrefix(relFilename, ".."+string(filepath.Separator)) {
+		return "", false
 	}
 
 	dir := filepath.Dir(relFilename)
 	if dir == "." {
-		return fnameScope, fnameMsg
+		return "", false
 	}
 
-	pkg := filepath.ToSlash(dir)
-	return []string{pkg},
-		fmt.Sprintf("Defaulting to package scope %s for refactoring (provide an explicit scope to change this)", pkg)
+	return filepath.ToSlash(dir), true
 }
 
 // validateArgs determines whether the arguments supplied in the given Config
@@ -448,6 +788,7 @@ func validateArgs(config *Config, desc *Description, log *Log) bool {
 			expectedPlural,
 			numArgsSupplied,
 			wasWere)
+		log.AssociateCode(CodeInvalidArgs)
 		return false
 	}
 	if numArgsSupplied > maxArgsExpected {
@@ -470,6 +811,7 @@ func validateArgs(config *Config, desc *Description, log *Log) bool {
 			expectedPlural,
 			numArgsSupplied,
 			wasWere)
+		log.AssociateCode(CodeInvalidArgs)
 		return false
 	}
 
@@ -479,6 +821,7 @@ func validateArgs(config *Config, desc *Description, log *Log) bool {
 			if reflect.TypeOf(arg) != expected {
 				paramName := desc.Params[i].Label
 				log.Errorf("%s must be a %s", paramName, expected)
+				log.AssociateCode(CodeInvalidArgs)
 				return false
 			}
 		} else {
@@ -487,6 +830,7 @@ func validateArgs(config *Config, desc *Description, log *Log) bool {
 			if reflect.TypeOf(arg) != expected {
 				paramName := desc.OptionalParams[index].Label
 				log.Errorf("%s must be a %s", paramName, expected)
+				log.AssociateCode(CodeInvalidArgs)
 				return false
 			}
 		}
@@ -520,41 +864,35 @@ func (r *RefactoringBase) lineColToPos(file *ast.File, line int, column int) tok
 	return file.Pos()
 }
 
-func (r *RefactoringBase) FormatFileInEditor() {
-	oldFileContents := string(r.FileContents)
-	string, err := text.ApplyToString(r.Edits[r.Filename], oldFileContents)
-	if err != nil {
-		r.Log.Errorf("Transformation produced invalid EditSet: %v",
-			err.Error())
+// adjustSelection records the region from start to end of the file being
+// refactored as the Result's AdjustedSelection, unless it is the region the
+// user selected.
+func (r *RefactoringBase) adjustSelection(start, end token.Pos) {
+	if start == r.SelectionStart && end == r.SelectionEnd {
 		return
 	}
-
-	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, "", string, parser.ParseComments)
-	if err != nil {
-		r.Log.Errorf("Transformation will introduce syntax errors: %v", err)
-		r.Log.AssociatePos(r.File.Pos(), r.File.End())
-		return
-	}
-
-	printConfig := &printer.Config{
-		Mode:     printer.UseSpaces | printer.TabIndent,
-		Tabwidth: 8}
-	var b bytes.Buffer
-	if err = printConfig.Fprint(&b, fset, file); err != nil {
-		r.Log.Error(err)
-		return
+	file := r.Program.Fset.File(start)
+	r.AdjustedSelection = &text.OffsetLengthSelection{
+		Filename: r.Filename,
+		Offset:   file.Offset(start),
+		Length:   file.Offset(end) - file.Offset(start),
 	}
-	newFileContents := b.String()
+}
 
-	editSet := text.Diff(
-		strings.SplitAfter(oldFileContents, "\n"),
-		strings.SplitAfter(newFileContents, "\n"))
-	r.Edits[r.Filename] = editSet
+// FormatFileInEditor formats the file being refactored, as gofmt would,
+// including any edits already made to it.
+//
+// Deprecated: Refactorings are formatted by the DefaultPostProcessors, or by
+// the post-processors given in their Config (see PostProcessor), when they
+// call UpdateLog.
+func (r *RefactoringBase) FormatFileInEditor() {
+	r.postProcessFile(r.Filename, r.FileContents, []PostProcessor{FormatFile{}})
 }
 
-// UpdateLog applies the edits in r.Edits and updates existing error messages
-// in r.Log to reflect their locations in the resulting Program.  If
+// UpdateLog post-processes the edits in r.Edits (see PostProcessor), applies
+// them, and updates existing error messages in r.Log to reflect their
+// locations in the resulting Program.  Every refactoring should invoke it
+// after making its edits.  If
 // checkForErrors is true, and if the log does not contain any initial errors,
 // the resulting Program will be type checked, and any new errors introduced by
 // the refactoring will be logged.
@@ -563,7 +901,10 @@ func (r *RefactoringBase) UpdateLog(config *Config, checkForErrors bool) {
 		return
 	}
 
-	// Avoid loading the refactored Program into a new go/loader if at all
+	r.postProcess(config)
+	r.triageInitialErrors()
+
+	// Avoid loading the refactored Program again if at all
 	// possible.  If we won't update the positions of any log entries and
 	// won't report any new errors, then we can avoid loading the
 	// refactored Program.
@@ -583,18 +924,28 @@ func (r *RefactoringBase) UpdateLog(config *Config, checkForErrors bool) {
 		return true
 	})
 
+	// Edits are listed in order by filename, so the log is reproducible
+	filenames := make([]string, 0, len(r.Edits))
+	for filename := range r.Edits {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
 	fileCount := len(r.Edits)
 	if fileCount >= 2 && config.Verbosity >= 1 {
 		fileNum := 1
-		for filename, edits := range r.Edits {
-			edits.Iterate(func(extent *text.Extent, _ string) bool {
-				file := programFiles[filename]
-				oldPos := file.Pos(extent.Offset)
+		for _, filename := range filenames {
+			r.Edits[filename].Iterate(func(extent *text.Extent, _ string) bool {
 				r.Log.Infof("File %d of %d: %s",
 					fileNum,
 					fileCount,
 					filepath.Base(filename))
-				r.Log.AssociatePos(oldPos, oldPos)
+				// Files other than Go source files (e.g., those
+				// edited by a SidecarScanner) have no positions
+				if file := programFiles[filename]; file != nil {
+					oldPos := file.Pos(extent.Offset)
+					r.Log.AssociatePos(oldPos, oldPos)
+				}
 				fileNum++
 				return false
 			})
@@ -605,9 +956,10 @@ func (r *RefactoringBase) UpdateLog(config *Config, checkForErrors bool) {
 		return
 	}
 
-	oldFS := config.FileSystem
-	defer func() { config.FileSystem = oldFS }()
-	config.FileSystem = filesystem.NewEditedFileSystem(oldFS, r.Edits)
+	// The refactored Program is loaded from the same scope as the original
+	lconfig := *r.loadConfig
+	lconfig.FileSystem = filesystem.NewEditedFileSystem(config.FileSystem,
+		r.Edits)
 
 	newLogOldPos := NewLog()
 	newLogOldPos.Fset = r.Program.Fset
@@ -617,7 +969,7 @@ func (r *RefactoringBase) UpdateLog(config *Config, checkForErrors bool) {
 
 	mutex := &sync.Mutex{}
 	errors := 0
-	newProg, err := createLoader(config, func(err error) {
+	newProg, err := createLoader(&lconfig, func(err error) {
 		if !checkForErrors {
 			return
 		}
@@ -640,6 +992,8 @@ func (r *RefactoringBase) UpdateLog(config *Config, checkForErrors bool) {
 				newLogOldPos.Error(msg)
 				newLogNewPos.Error(msg)
 			}
+			newLogOldPos.AssociateCode(CodeIntroducedError)
+			newLogNewPos.AssociateCode(CodeIntroducedError)
 			mutex.Unlock()
 		}
 	})
@@ -657,17 +1011,39 @@ func (r *RefactoringBase) UpdateLog(config *Config, checkForErrors bool) {
 	r.Log.Fset = newProg.Fset
 	for _, entry := range r.Log.Entries {
 		entry.Pos = mapPos(r.Program.Fset, entry.Pos, r.Edits, newProgFiles, false)
+		for _, related := range entry.Related {
+			related.Pos = mapPos(r.Program.Fset, related.Pos, r.Edits, newProgFiles, false)
+			related.End = mapPos(r.Program.Fset, related.End, r.Edits, newProgFiles, false)
+		}
 	}
 	r.Log.Append(newLogNewPos.Entries)
 
 	if config.Verbosity >= 2 {
-		for filename, edits := range r.Edits {
-			edits.Iterate(func(extent *text.Extent, replace string) bool {
+		// Each edit is annotated with the cause of the corresponding
+		// Occurrence, if any
+		causes := map[string]map[text.Extent]string{}
+		for _, occ := range r.Occurrences {
+			if causes[occ.Filename] == nil {
+				causes[occ.Filename] = map[text.Extent]string{}
+			}
+			causes[occ.Filename][*occ.Extent] = occ.Cause
+		}
+		for _, filename := range filenames {
+			r.Edits[filename].Iterate(func(extent *text.Extent, replace string) bool {
+				description := describeEdit(extent, replace)
+				if cause := causes[filename][*extent]; cause != "" {
+					description += " (" + cause + ")"
+				}
 				oldFile := programFiles[filename]
+				if oldFile == nil {
+					r.Log.Infof("%s in %s", description,
+						filepath.Base(filename))
+					return true
+				}
 				oldPos := oldFile.Pos(extent.Offset)
 				newPos := mapPos(r.Program.Fset, oldPos,
 					r.Edits, newProgFiles, false)
-				r.Log.Infof(describeEdit(extent, replace))
+				r.Log.Info(description)
 				r.Log.AssociatePos(newPos, newPos)
 				return true
 			})
@@ -675,6 +1051,66 @@ func (r *RefactoringBase) UpdateLog(config *Config, checkForErrors bool) {
 	}
 }
 
+// triageInitialErrors changes initial errors that were changed to warnings
+// (by Log.ChangeInitialErrorsToWarnings) back to errors if they occur in a
+// file that this refactoring edits.  Since such a file could not be type
+// checked completely, the refactoring's analysis of it may be incorrect, and
+// the edits may hide or compound the errors.  Errors elsewhere in the program
+// (e.g., in packages that are loaded only as dependencies) remain warnings, as
+// do failures to import a package, which describe the environment (e.g., a
+// missing dependency) rather than the contents of the file.
+func (r *RefactoringBase) triageInitialErrors() {
+	if r.Program == nil {
+		return
+	}
+	filenames := []string{}
+	seen := map[string]bool{}
+	r.Log.RestoreInitialErrors(func(entry *Entry) bool {
+		if strings.Contains(entry.Message, importError) {
+			return false
+		}
+		filename := r.initialErrorFilename(entry)
+		// Init adds an empty EditSet for the selected file, even if
+		// the refactoring does not change it
+		if edits, ok := r.Edits[filename]; !ok || edits.Len() == 0 {
+			return false
+		}
+		if !seen[filename] {
+			seen[filename] = true
+			filenames = append(filenames, displayablePath(filename, ""))
+		}
+		return true
+	})
+	if len(filenames) == 0 {
+		return
+	}
+
+	r.Log.Errorf("The refactoring would modify file(s) containing "+
+		"errors, so it may be incorrect; correct the errors in %s "+
+		"and try again", strings.Join(filenames, ", "))
+}
+
+// initialErrorFilename returns the name of the file containing the error
+// described by the given initial log entry, or "" if it cannot be determined.
+// Errors reported by the go command (rather than the type checker) have no
+// Pos, but their messages begin with the filename (as in "file:line:col: ").
+func (r *RefactoringBase) initialErrorFilename(entry *Entry) string {
+	if entry.Pos.IsValid() {
+		return r.Program.Fset.Position(entry.Pos).Filename
+	}
+	stdin, _ := filesystem.FakeStdinPath()
+	for filename := range r.Edits {
+		prefix := filename
+		if filename == stdin {
+			prefix = "<stdin>"
+		}
+		if strings.HasPrefix(entry.Message, prefix+":") {
+			return filename
+		}
+	}
+	return ""
+}
+
 // describeEdit returns a human-readable, one-line description of a text edit
 func describeEdit(extent *text.Extent, replacement string) string {
 	if extent.Length == 0 {
@@ -722,8 +1158,14 @@ func mapPos(from *token.FileSet, pos token.Pos, edits map[string]*text.EditSet,
 
 /* -=-=- Utility Methods -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
 
+// InterpretArgs converts command line arguments to the values expected by
+// the given refactoring: "true" and "false" are converted to booleans when
+// the corresponding parameter (or optional parameter) is boolean, and all
+// other arguments are left as strings.
 func InterpretArgs(args []string, r Refactoring) []interface{} {
-	params := r.Description().Params
+	desc := r.Description()
+	params := append(append([]Parameter{}, desc.Params...),
+		desc.OptionalParams...)
 	result := []interface{}{}
 	for i, opt := range args {
 		if i < len(params) && params[i].IsBoolean() {
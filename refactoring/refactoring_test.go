@@ -13,3 +13,8 @@ func TestRefactorings(t *testing.T) {
 	engine.AddDefaultRefactorings()
 	testutil.TestRefactorings(directory, t)
 }
+
+func TestRefactoringsInModuleMode(t *testing.T) {
+	engine.AddDefaultRefactorings()
+	testutil.TestRefactoringsInModuleMode(directory, t)
+}
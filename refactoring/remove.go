@@ -0,0 +1,298 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines utilities for removing package-level declarations from
+// the files of a package, along with any imports that are no longer used as
+// a result.
+
+package refactoring
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"sort"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// A sourceFiles reads (and caches) the contents of files other than the file
+// being refactored, which a multi-file refactoring may need to modify.
+type sourceFiles struct {
+	fileSystem filesystem.FileSystem
+	contents   map[string][]byte // keyed by filename
+}
+
+// newSourceFiles returns a sourceFiles that reads files from the given file
+// system; the contents of the file being refactored are already known.
+func newSourceFiles(fs filesystem.FileSystem, filename string, contents []byte) *sourceFiles {
+	return &sourceFiles{
+		fileSystem: fs,
+		contents:   map[string][]byte{filename: contents},
+	}
+}
+
+// read returns the contents of the given file.
+func (s *sourceFiles) read(filename string) ([]byte, error) {
+	if contents, ok := s.contents[filename]; ok {
+		return contents, nil
+	}
+	reader, err := s.fileSystem.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	s.contents[filename] = contents
+	return contents, nil
+}
+
+// editSet returns the EditSet in r.Edits for the given file, creating it if
+// necessary with the file's contents (read from files) as its base.  It logs
+// an error and returns nil if the file cannot be read.
+func (r *RefactoringBase) editSet(files *sourceFiles, filename string) *text.EditSet {
+	if r.Edits[filename] == nil {
+		contents, err := files.read(filename)
+		if err != nil {
+			r.Log.Error(err)
+			return nil
+		}
+		r.Edits[filename] = text.NewEditSet()
+		r.Edits[filename].SetBase(contents)
+	}
+	return r.Edits[filename]
+}
+
+// A declText describes the text of a declaration (or, in a grouped
+// declaration, a spec) that will be removed from its file.
+type declText struct {
+	filename string
+	file     *ast.File
+	node     ast.Node
+	// Offsets of the declaration's text, including its doc comment and
+	// any comment following it on the same line
+	start, end int
+	// Offsets of the text to remove, which also includes the indentation
+	// before the declaration, the newline after it, and one following
+	// blank line (if present)
+	removeStart, removeEnd int
+}
+
+// newDeclText returns a declText for the given node, which must be a
+// declaration or spec in the given file, whose contents have already been
+// read into files.
+func (r *RefactoringBase) newDeclText(files *sourceFiles, filename string, file *ast.File, node ast.Node) *declText {
+	d := &declText{filename: filename, file: file, node: node}
+	contents := files.contents[filename]
+	start, end := node.Pos(), node.End()
+	switch node := node.(type) {
+	case *ast.GenDecl:
+		if node.Doc != nil {
+			start = node.Doc.Pos()
+		}
+	case *ast.TypeSpec:
+		if node.Doc != nil {
+			start = node.Doc.Pos()
+		}
+	case *ast.ValueSpec:
+		if node.Doc != nil {
+			start = node.Doc.Pos()
+		}
+	case *ast.FuncDecl:
+		if node.Doc != nil {
+			start = node.Doc.Pos()
+		}
+	}
+	d.start = r.Program.Fset.Position(start).Offset
+	d.end = r.Program.Fset.Position(end).Offset
+
+	// Include a comment following the declaration on the same line
+	for _, cg := range file.Comments {
+		offset := r.Program.Fset.Position(cg.Pos()).Offset
+		if offset >= d.end && isBlank(contents[d.end:offset]) {
+			d.end = r.Program.Fset.Position(cg.End()).Offset
+			break
+		}
+	}
+
+	d.removeStart = d.start
+	for d.removeStart > 0 && isBlank(contents[d.removeStart-1:d.removeStart]) {
+		d.removeStart--
+	}
+	d.removeEnd = skipLine(contents, d.end)
+	d.removeEnd = skipLine(contents, d.removeEnd)
+	return d
+}
+
+// isBlank returns true if the given text contains only spaces and tabs.
+func isBlank(text []byte) bool {
+	return len(bytes.Trim(text, " \t\r")) == 0
+}
+
+// skipLine returns the offset of the first character after the newline that
+// ends the line containing the given offset (or the end of the file), if the
+// remainder of that line is blank; otherwise, it returns offset.
+func skipLine(contents []byte, offset int) int {
+	i := offset
+	for i < len(contents) && (contents[i] == ' ' || contents[i] == '\t' ||
+		contents[i] == '\r') {
+		i++
+	}
+	if i < len(contents) && contents[i] == '\n' {
+		return i + 1
+	}
+	if i == len(contents) {
+		return i
+	}
+	return offset
+}
+
+// lineExtent returns the offsets of the text to remove in order to remove
+// the given statement from the file being refactored: the entire line, if it
+// contains only the statement, or otherwise just the statement.
+func (r *RefactoringBase) lineExtent(stmt ast.Stmt) (start, end int) {
+	start, end = r.OffsetOfPos(stmt.Pos()), r.OffsetOfPos(stmt.End())
+	lineStart := lineStart(r.FileContents, start)
+	lineEnd := skipLine(r.FileContents, end)
+	if !isBlank(r.FileContents[lineStart:start]) || lineEnd == end {
+		return start, end
+	}
+	return lineStart, lineEnd
+}
+
+// removeDecls adds edits removing the given declarations from their files,
+// along with any imports that are no longer used as a result.  Imports of the
+// packages in keep are not removed, even if they are no longer used.
+func (r *RefactoringBase) removeDecls(decls []*declText, files *sourceFiles, keep map[*types.PkgName]bool) {
+	byFile := map[string][]*declText{}
+	filenames := []string{}
+	for _, d := range decls {
+		if _, ok := byFile[d.filename]; !ok {
+			filenames = append(filenames, d.filename)
+		}
+		byFile[d.filename] = append(byFile[d.filename], d)
+	}
+
+	for _, filename := range filenames {
+		contents := files.contents[filename]
+		r.removeDeclText(filename, contents, byFile[filename])
+		r.removeUnusedImports(filename, contents, byFile[filename], keep)
+	}
+}
+
+// removeDeclText adds edits removing the text of the given declarations, which
+// must all be in the given file (with the given contents).  Unlike
+// removeDecls, it does not remove imports.
+func (r *RefactoringBase) removeDeclText(filename string, contents []byte, fileDecls []*declText) {
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+		r.Edits[filename].SetBase(contents)
+	}
+	sort.Slice(fileDecls, func(i, j int) bool {
+		return fileDecls[i].start < fileDecls[j].start
+	})
+	// Merge the text removed for adjacent declarations
+	extents := []*text.Extent{}
+	for _, d := range fileDecls {
+		if n := len(extents); n > 0 &&
+			d.removeStart <= extents[n-1].OffsetPastEnd() {
+			extents[n-1].Length = d.removeEnd - extents[n-1].Offset
+		} else {
+			extents = append(extents, &text.Extent{
+				Offset: d.removeStart,
+				Length: d.removeEnd - d.removeStart,
+			})
+		}
+	}
+	// Don't leave blank lines at the end of the file
+	if last := extents[len(extents)-1]; last.OffsetPastEnd() == len(contents) {
+		for last.Offset >= 2 &&
+			string(contents[last.Offset-2:last.Offset]) == "\n\n" {
+			last.Offset--
+			last.Length++
+		}
+	}
+	for _, extent := range extents {
+		r.Edits[filename].Add(extent, "")
+	}
+}
+
+// removeUnusedImports adds an edit removing the imports in the given file
+// that are used only by the given (removed) declarations, except for those
+// in keep.
+func (r *RefactoringBase) removeUnusedImports(filename string, contents []byte, decls []*declText, keep map[*types.PkgName]bool) {
+	unused := r.unusedImports(decls, keep)
+	if len(unused) == 0 {
+		return
+	}
+
+	extent, replacement, err := rewriteImports(filename, contents,
+		func(fset *token.FileSet, file *ast.File) {
+			for _, imp := range unused {
+				astutil.DeleteNamedImport(fset, file, imp.name, imp.path)
+			}
+		})
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	r.Edits[filename].Add(extent, replacement)
+}
+
+// unusedImports returns the imports in the file containing the given
+// declarations (or other removed text) that are used only by the removed
+// text, except for those in keep.
+func (r *RefactoringBase) unusedImports(decls []*declText, keep map[*types.PkgName]bool) []importSpec {
+	info := r.SelectedNodePkg.TypesInfo
+	file := decls[0].file
+	isRemoved := func(pos token.Pos) bool {
+		offset := r.Program.Fset.Position(pos).Offset
+		for _, d := range decls {
+			if d.start <= offset && offset < d.end {
+				return true
+			}
+		}
+		return false
+	}
+
+	usesInFile, usesRemaining := map[*types.PkgName]int{}, map[*types.PkgName]int{}
+	for id, obj := range info.Uses {
+		pkgName, ok := obj.(*types.PkgName)
+		if !ok || id.Pos() < file.Pos() || id.Pos() > file.End() {
+			continue
+		}
+		usesInFile[pkgName]++
+		if !isRemoved(id.Pos()) {
+			usesRemaining[pkgName]++
+		}
+	}
+
+	unused := []importSpec{}
+	for _, spec := range file.Imports {
+		var obj types.Object
+		if spec.Name != nil {
+			obj = info.Defs[spec.Name]
+		} else {
+			obj = info.Implicits[spec]
+		}
+		pkgName, ok := obj.(*types.PkgName)
+		if !ok || usesInFile[pkgName] == 0 || usesRemaining[pkgName] > 0 ||
+			keep[pkgName] {
+			continue
+		}
+		imp := importSpec{path: pkgName.Imported().Path()}
+		if spec.Name != nil {
+			imp.name = spec.Name.Name
+		}
+		unused = append(unused, imp)
+	}
+	return unused
+}
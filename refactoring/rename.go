@@ -8,6 +8,7 @@
 package refactoring
 
 import (
+	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
@@ -16,9 +17,12 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/godoctor/godoctor/analysis/names"
+	"github.com/godoctor/godoctor/filesystem"
 	"github.com/godoctor/godoctor/text"
 
 	"golang.org/x/tools/go/packages"
@@ -31,13 +35,27 @@ import (
 type Rename struct {
 	RefactoringBase
 	newName string // New name to be given to the selected identifier
+	// If true, rename every occurrence of the name (as a word) in comments,
+	// not just those that appear to refer to code
+	renameCommentWords bool
+	// If true and a method receiver is selected, rename the receivers of
+	// all methods of the same type
+	renameAllReceivers bool
+	// If true, also rename syntactic matches in files excluded from the
+	// build by build constraints (see renameInExcludedFiles)
+	renameInExcluded bool
+	// If true and the selected name is part of the exported API of its
+	// package, declare the old name as a deprecated alias for the new one
+	// (see declareDeprecatedAlias)
+	keepAlias bool
+	files     *sourceFiles
 }
 
 func (r *Rename) Description() *Description {
 	return &Description{
 		Name:      "Rename",
 		Synopsis:  "Changes the name of an identifier",
-		Usage:     "<new_name>",
+		Usage:     "<new_name> [<rename_comment_words> [<rename_all_receivers> [<rename_in_excluded_files> [<keep_deprecated_alias>]]]]",
 		HTMLDoc:   renameDoc,
 		Multifile: true,
 		Params: []Parameter{{
@@ -45,13 +63,43 @@ func (r *Rename) Description() *Description {
 			Prompt:       "What to rename this identifier to.",
 			DefaultValue: "",
 		}},
-		OptionalParams: nil,
-		Hidden:         false,
+		OptionalParams: []Parameter{{
+			Label:        "Rename Words in Comments:",
+			Prompt:       "Also rename words in comments that do not appear to refer to code.",
+			DefaultValue: false,
+		}, {
+			Label:        "Rename All Receivers:",
+			Prompt:       "If a method receiver is selected, give the same name to the receivers of all methods of that type.",
+			DefaultValue: false,
+		}, {
+			Label:        "Rename in Excluded Files:",
+			Prompt:       "Also rename matching names in files excluded by build constraints (without type checking).",
+			DefaultValue: false,
+		}, {
+			Label:        "Keep Deprecated Alias:",
+			Prompt:       "If an exported API name is renamed, keep the old name as a deprecated alias for the new one.",
+			DefaultValue: false,
+		}},
+		Hidden:  false,
+		Quality: Production,
 	}
 }
 
 func (r *Rename) Run(config *Config) *Result {
+	return r.run(config, config.Scope == nil && config.ScopeProvider == nil, "")
+}
+
+// run performs the rename.  If canExpandScope is true, the scope was guessed
+// rather than provided, so it is expanded to the enclosing module when the
+// selected name is exported; scopeNote explains an expansion already made.
+func (r *Rename) run(config *Config, canExpandScope bool, scopeNote string) *Result {
 	r.Init(config, r.Description())
+	// Rename's edits are exactly the Occurrences it reports (which
+	// ProtectFiles relies on), so it is not formatted by default
+	r.noDefaultPostProcessing = true
+	if scopeNote != "" {
+		r.Log.Info(scopeNote)
+	}
 	r.Log.ChangeInitialErrorsToWarnings()
 	if r.Log.ContainsErrors() {
 		return &r.Result
@@ -63,17 +111,36 @@ func (r *Rename) Run(config *Config) *Result {
 		return &r.Result
 	}
 
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
 	r.newName = config.Args[0].(string)
+	r.renameCommentWords = false
+	if len(config.Args) > 1 {
+		r.renameCommentWords = config.Args[1].(bool)
+	}
+	r.renameAllReceivers = false
+	if len(config.Args) > 2 {
+		r.renameAllReceivers = config.Args[2].(bool)
+	}
+	r.renameInExcluded = false
+	if len(config.Args) > 3 {
+		r.renameInExcluded = config.Args[3].(bool)
+	}
+	r.keepAlias = false
+	if len(config.Args) > 4 {
+		r.keepAlias = config.Args[4].(bool)
+	}
 	if r.newName == "" {
 		r.Log.Error("newName cannot be empty")
 		return &r.Result
 	}
 	if !isIdentifierValid(r.newName) {
 		r.Log.Errorf("The new name \"%s\" is not a valid Go identifier", r.newName)
+		r.Log.AssociateCode(CodeInvalidName)
 		return &r.Result
 	}
 	if isReservedWord(r.newName) {
 		r.Log.Errorf("The new name \"%s\" is a reserved word", r.newName)
+		r.Log.AssociateCode(CodeInvalidName)
 		return &r.Result
 	}
 
@@ -104,16 +171,74 @@ func (r *Rename) Run(config *Config) *Result {
 		return &r.Result
 	}
 
+	if canExpandScope {
+		// The scope is expanded in a copy, so that the caller's Config
+		// can be reused for another file
+		expanded := *config
+		if note := r.expandScope(ident, &expanded); note != "" {
+			return r.run(&expanded, false, note)
+		}
+	}
+
 	if ast.IsExported(ident.Name) && !ast.IsExported(r.newName) {
 		r.Log.Warn("Renaming an exported name to an unexported name will introduce errors outside the package in which it is declared.")
 	}
+	if ast.IsExported(ident.Name) &&
+		(len(config.ScopeInclude) > 0 || len(config.ScopeExclude) > 0) {
+		r.Log.Warnf("%s is exported, but the scope is filtered, so "+
+			"references in packages excluded from the scope will "+
+			"not be renamed.", ident.Name)
+	}
 
-	r.rename(ident, r.SelectedNodePkg)
+	if r.renameAllReceivers {
+		r.renameReceivers(ident)
+	} else {
+		r.rename(ident, r.SelectedNodePkg)
+		obj := r.SelectedNodePkg.TypesInfo.ObjectOf(ident)
+		r.renameTestFuncs(obj)
+		r.addSidecarOccurrences(obj, config.SidecarScanners)
+		if r.renameInExcluded && !r.Log.ContainsErrors() {
+			r.renameInExcludedFiles(obj, config.Build)
+		}
+		if !r.Log.ContainsErrors() {
+			r.checkAPICompatibility(obj)
+		}
+	}
+	r.reflowDocComments()
 	r.UpdateLog(config, false)
 	return &r.Result
 
 }
 
+// expandScope determines whether the selected identifier may be referenced
+// outside the package that was loaded: that is, whether it names an exported
+// package-level declaration, method, or field outside a main package.  If so,
+// and the file is in a module, it changes the configuration's scope to the
+// entire module and returns a message explaining why; otherwise, it returns
+// "" and leaves the configuration unchanged.
+func (r *Rename) expandScope(ident *ast.Ident, config *Config) string {
+	obj := r.SelectedNodePkg.TypesInfo.ObjectOf(ident)
+	if obj == nil || !obj.Exported() || obj.Pkg() == nil ||
+		obj.Pkg().Name() == "main" {
+		return ""
+	}
+	if obj.Parent() != nil && obj.Parent() != obj.Pkg().Scope() {
+		return "" // Local declaration
+	}
+	if config.ModulesOff || filesystem.IsFakeStdinPath(r.Filename) {
+		return ""
+	}
+	root := findModuleRoot(filepath.Dir(r.Filename))
+	if root == "" {
+		return ""
+	}
+	config.Scope = []string{"./..."}
+	config.Dir = root
+	return fmt.Sprintf("%s is exported, so it may be referenced outside "+
+		"its package; expanding the scope to the module in %s",
+		ident.Name, root)
+}
+
 func isIdentifierValid(newName string) bool {
 	b, _ := regexp.MatchString("^[\\p{L}|_][\\p{L}|_|\\p{N}]*$", newName)
 	return b
@@ -140,19 +265,45 @@ func (r *Rename) rename(ident *ast.Ident, pkgInfo *packages.Package) {
 		return
 	}
 
+	if pkgName, ok := obj.(*types.PkgName); ok && !r.canRenameImport(ident, pkgName) {
+		return
+	}
+
 	if obj != nil && isInGoRoot(r.Program.Fset.Position(obj.Pos()).Filename) {
 		r.Log.Errorf("%s is defined in $GOROOT and cannot be renamed",
 			ident.Name)
 		r.Log.AssociateNode(ident)
 		return
 	}
-	if conflict := names.FindConflict(obj, r.newName); conflict != nil {
+	ts := r.selectedTypeSwitchVar(ident)
+	var conflict types.Object
+	if ts != nil {
+		conflict = names.FindTypeSwitchVarConflict(ts, r.SelectedNodePkg, r.newName)
+	} else {
+		conflict = names.FindConflict(obj, r.newName)
+	}
+	if pkgName, ok := conflict.(*types.PkgName); ok {
+		renamed := []types.Object{obj}
+		if ts != nil {
+			renamed = names.TypeSwitchVars(ts, r.SelectedNodePkg)
+		}
+		r.checkImportConflict(ident, renamed, pkgName)
+	} else if conflict != nil {
 		r.Log.Errorf("Renaming %s to %s may cause conflicts with an existing declaration", ident.Name, r.newName)
 		r.Log.AssociatePos(conflict.Pos(), conflict.Pos())
+		r.Log.AssociateCode(CodeRenameConflict)
+		r.Log.AddRelatedNode("Identifier being renamed", ident)
+	} else if conflict, dot := names.FindDotImportConflict(obj, r.newName, r.Program); conflict != nil {
+		r.Log.Errorf("Renaming %s to %s may cause conflicts with an "+
+			"existing declaration in a file that dot-imports %s",
+			ident.Name, r.newName, obj.Pkg().Name())
+		r.Log.AssociatePos(conflict.Pos(), conflict.Pos())
+		r.Log.AssociateCode(CodeRenameConflict)
+		r.Log.AddRelatedNode("Dot import", dot.Spec)
 	}
 	var scope *types.Scope
 	var idents map[*ast.Ident]bool
-	if ts := r.selectedTypeSwitchVar(ident); ts != nil {
+	if ts != nil {
 		scope = types.NewScope(nil, ts.Pos(), ts.End(), "artificial scope for typeswitch")
 		idents = names.FindTypeSwitchVarOccurrences(ts, r.SelectedNodePkg, r.Program)
 	} else {
@@ -162,7 +313,280 @@ func (r *Rename) rename(ident *ast.Ident, pkgInfo *packages.Package) {
 		idents = names.FindOccurrences(obj, r.Program)
 	}
 
-	r.addOccurrences(ident.Name, scope, r.extents(idents, r.Program.Fset))
+	reasons := r.explainInterfaceMethods(obj)
+	r.addOccurrences(ident.Name, scope, r.occurrences(obj, idents, reasons))
+	r.addDocCommentOccurrences(ident.Name, obj)
+	r.addDocLinkOccurrences(idents)
+	r.warnDotImports(obj, idents)
+}
+
+// warnDotImports warns about each file that dot-imports the package declaring
+// the given object and refers to it.  References in such a file are not
+// qualified by a package name, so they are hard to distinguish from
+// references to declarations in the file's own package.
+func (r *Rename) warnDotImports(obj types.Object, idents map[*ast.Ident]bool) {
+	if obj == nil || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() ||
+		!obj.Exported() {
+		return
+	}
+	files := map[*token.File]bool{}
+	for id := range idents {
+		files[r.Program.Fset.File(id.Pos())] = true
+	}
+	warned := map[*token.File]bool{}
+	for _, dot := range names.FindDotImports(obj.Pkg().Path(), r.Program) {
+		file := r.Program.Fset.File(dot.File.Pos())
+		if !files[file] || warned[file] {
+			continue
+		}
+		warned[file] = true
+		r.Log.Warnf("%s is dot-imported into %s, so references to %s "+
+			"there are unqualified; review the changes to this file",
+			obj.Pkg().Name(), filepath.Base(file.Name()), obj.Name())
+		r.Log.AssociateNode(dot.Spec)
+	}
+}
+
+// checkImportConflict logs an error or warning when the given objects (the
+// selected object or, for a type switch variable, the variables declared by
+// its case clauses) are renamed to the name of the given import, suggesting
+// an alternative name.  A package-level object cannot have the same name as
+// an import in its package.  A local variable can, but it shadows the import,
+// so this is an error if the import is used where the variable is visible,
+// and a warning otherwise (since the package cannot be used there later).
+func (r *Rename) checkImportConflict(ident *ast.Ident, renamed []types.Object, pkgName *types.PkgName) {
+	alternative := ""
+	for i := 2; i < 10 && alternative == ""; i++ {
+		alternative = r.newName + strconv.Itoa(i)
+		for _, obj := range renamed {
+			if names.FindConflict(obj, alternative) != nil {
+				alternative = ""
+				break
+			}
+		}
+	}
+	suggestion := "choose a different name or rename the import"
+	if alternative != "" {
+		suggestion = fmt.Sprintf("choose a different name (e.g., %s) "+
+			"or rename the import", alternative)
+	}
+
+	obj := renamed[0]
+	switch {
+	case obj.Parent() == obj.Pkg().Scope():
+		r.Log.Errorf("Renaming %s to %s would conflict with the import "+
+			"of %s; %s", ident.Name, r.newName,
+			pkgName.Imported().Path(), suggestion)
+	case r.importVisibleTo(pkgName, renamed):
+		r.Log.Errorf("Renaming %s to %s would shadow the import of %s, "+
+			"which is used where %s is visible; %s", ident.Name,
+			r.newName, pkgName.Imported().Path(), ident.Name,
+			suggestion)
+	default:
+		r.Log.Warnf("Renaming %s to %s will shadow the import of %s, "+
+			"so it cannot be used where %s is visible; to avoid "+
+			"this, %s", ident.Name, r.newName,
+			pkgName.Imported().Path(), r.newName, suggestion)
+	}
+	r.Log.AssociatePos(pkgName.Pos(), pkgName.Pos())
+	r.Log.AssociateCode(CodeRenameConflict)
+	r.Log.AddRelatedNode("Identifier being renamed", ident)
+}
+
+// importVisibleTo returns true if the given import is used where one of the
+// given (local) objects is visible, i.e., if renaming the objects to the
+// import's name would change what those uses refer to.
+func (r *Rename) importVisibleTo(pkgName *types.PkgName, objs []types.Object) bool {
+	pkg := r.SelectedNodePkg
+	for id, obj := range pkg.TypesInfo.Uses {
+		if obj != pkgName {
+			continue
+		}
+		scope := pkg.Types.Scope().Innermost(id.Pos())
+		if scope == nil {
+			continue
+		}
+		_, visible := scope.LookupParent(objs[0].Name(), id.Pos())
+		for _, obj := range objs {
+			if visible == obj {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canRenameImport determines whether the name declared by an import can be
+// renamed, logging an error if it cannot.  Blank imports (import _ "pkg")
+// exist only for the side effects of initializing the imported package, and
+// dot imports do not declare a name, so neither can be renamed.  Likewise, an
+// import cannot be renamed to _, since that would turn it into a blank
+// import, breaking every reference to it.
+func (r *Rename) canRenameImport(ident *ast.Ident, pkgName *types.PkgName) bool {
+	switch {
+	case pkgName.Name() == "_":
+		r.Log.Errorf("The blank import of %s cannot be renamed, since "+
+			"it is used only for its side effects",
+			pkgName.Imported().Path())
+	case pkgName.Name() == ".":
+		r.Log.Errorf("The dot import of %s does not declare a "+
+			"package name, so it cannot be renamed",
+			pkgName.Imported().Path())
+	case r.newName == "_":
+		r.Log.Errorf("The import of %s cannot be renamed to _: this "+
+			"would make it a blank import, which cannot be referenced",
+			pkgName.Imported().Path())
+	default:
+		return true
+	}
+	r.Log.AssociateNode(ident)
+	return false
+}
+
+// renameReceivers renames the selected method receiver, together with the
+// receivers of all other methods declared on the same type.  Each receiver is
+// renamed (and checked for conflicts) as if it had been selected
+// individually.  Unnamed and blank receivers are left unchanged.
+func (r *Rename) renameReceivers(ident *ast.Ident) {
+	pkg := r.SelectedNodePkg
+	typeName := receiverBaseType(pkg, ident)
+	if typeName == nil {
+		r.Log.Warnf("%s is not a method receiver, so it is the only "+
+			"identifier that will be renamed.", ident.Name)
+		r.rename(ident, pkg)
+		return
+	}
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Recv == nil ||
+				len(funcDecl.Recv.List[0].Names) == 0 {
+				continue
+			}
+			recv := funcDecl.Recv.List[0].Names[0]
+			if recv.Name == "_" || recv.Name == r.newName ||
+				receiverBaseType(pkg, recv) != typeName {
+				continue
+			}
+			r.rename(recv, pkg)
+		}
+	}
+}
+
+// receiverBaseType returns the type name of the type whose method has the
+// given receiver identifier, or nil if the identifier does not declare a
+// method receiver.
+func receiverBaseType(pkg *packages.Package, ident *ast.Ident) *types.TypeName {
+	v, ok := pkg.TypesInfo.Defs[ident].(*types.Var)
+	if !ok {
+		return nil
+	}
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Recv == nil ||
+				!(funcDecl.Recv.Pos() <= v.Pos() && v.Pos() < funcDecl.Recv.End()) {
+				continue
+			}
+			typ := v.Type()
+			if ptr, ok := typ.(*types.Pointer); ok {
+				typ = ptr.Elem()
+			}
+			if named, ok := typ.(*types.Named); ok {
+				return named.Obj()
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// addSidecarOccurrences renames references to the given object that the
+// given scanners find in files other than Go source files.  Local variables
+// cannot be referenced outside of Go code, so only package-level objects,
+// methods, and fields are searched for.
+func (r *Rename) addSidecarOccurrences(obj types.Object, scanners []SidecarScanner) {
+	if obj == nil || obj.Pkg() == nil ||
+		(obj.Parent() != nil && obj.Parent() != obj.Pkg().Scope()) {
+		return
+	}
+	added := map[string]map[int]bool{}
+	for _, scanner := range scanners {
+		occurrences, err := scanner.Occurrences(obj)
+		if err != nil {
+			r.Log.Error(err)
+			continue
+		}
+		for filename, extents := range occurrences {
+			if r.Edits[filename] == nil {
+				r.Edits[filename] = text.NewEditSet()
+			}
+			if added[filename] == nil {
+				added[filename] = map[int]bool{}
+			}
+			for _, extent := range text.Sort(extents) {
+				if added[filename][extent.Offset] {
+					continue
+				}
+				added[filename][extent.Offset] = true
+				if err := r.addOccurrence(filename, extent, r.newName,
+					OccurrenceString, fmt.Sprintf("reference to %s "+
+						"found by a sidecar scanner", obj.Name())); err != nil {
+					r.Log.Errorf("%s: %v", filename, err)
+				}
+			}
+		}
+	}
+}
+
+// addDocCommentOccurrences renames occurrences of a parameter, result, or
+// receiver name in the doc comment of the function declaring it.  (The doc
+// comment precedes the function's scope, so these occurrences are not found
+// by the scope-limited comment search in addOccurrences.)
+func (r *Rename) addDocCommentOccurrences(name string, obj types.Object) {
+	if _, ok := obj.(*types.Var); !ok {
+		return
+	}
+	filename := r.Program.Fset.Position(obj.Pos()).Filename
+	if isInGoRoot(filename) {
+		return
+	}
+	_, file := r.fileNamed(filename)
+	if file == nil {
+		return
+	}
+	funcDecl := enclosingFuncDeclSignature(file, obj.Pos())
+	if funcDecl == nil || funcDecl.Doc == nil {
+		return
+	}
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+	}
+	for _, occurrence := range names.FindInDocComment(name, funcDecl.Doc, r.Program.Fset) {
+		r.addOccurrence(filename, occurrence, r.newName,
+			OccurrenceComment, fmt.Sprintf("mention of %s in the doc "+
+				"comment of %s", name, funcDecl.Name.Name))
+	}
+}
+
+// enclosingFuncDeclSignature returns the function declaration whose receiver,
+// parameter list, or result list contains the given position, or nil if there
+// is no such declaration in the given file.
+func enclosingFuncDeclSignature(file *ast.File, pos token.Pos) *ast.FuncDecl {
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if funcDecl.Recv != nil &&
+			funcDecl.Recv.Pos() <= pos && pos < funcDecl.Recv.End() {
+			return funcDecl
+		}
+		if funcDecl.Type.Params.Pos() <= pos && pos < funcDecl.Type.End() {
+			return funcDecl
+		}
+	}
+	return nil
 }
 
 func (r *Rename) selectedTypeSwitchVar(ident *ast.Ident) *ast.TypeSwitchStmt {
@@ -188,25 +612,144 @@ func (r *Rename) selectedTypeSwitchVar(ident *ast.Ident) *ast.TypeSwitchStmt {
 	return nil
 }
 
-func (r *Rename) extents(ids map[*ast.Ident]bool, fset *token.FileSet) map[string][]*text.Extent {
-	result := map[string][]*text.Extent{}
+// occurrences classifies the given identifiers, which refer to the given
+// object (nil for a type switch variable), returning them grouped by filename
+// and sorted by offset.
+func (r *Rename) occurrences(obj types.Object, ids map[*ast.Ident]bool, reasons map[token.Position]string) map[string][]Occurrence {
+	result := map[string][]Occurrence{}
 	for id := range ids {
-		pos := fset.Position(id.Pos())
-		if _, ok := result[pos.Filename]; !ok {
-			result[pos.Filename] = []*text.Extent{}
+		pos := r.Program.Fset.Position(id.Pos())
+		kind := r.occurrenceKind(obj, id)
+		reason := ""
+		if kind == OccurrenceInterfaceMethod {
+			reason = reasons[pos]
 		}
-		result[pos.Filename] = append(result[pos.Filename],
-			&text.Extent{Offset: pos.Offset, Length: len(id.Name)})
+		result[pos.Filename] = append(result[pos.Filename], Occurrence{
+			Filename: pos.Filename,
+			Extent:   &text.Extent{Offset: pos.Offset, Length: len(id.Name)},
+			Kind:     kind,
+			Reason:   reason,
+			Cause:    r.occurrenceCause(obj, id, kind, reason),
+		})
+	}
+	for _, occurrences := range result {
+		sort.Slice(occurrences, func(i, j int) bool {
+			return occurrences[i].Extent.Offset < occurrences[j].Extent.Offset
+		})
+	}
+	return result
+}
+
+// occurrenceCause describes why the given identifier, an occurrence of the
+// given kind, is renamed along with the given object (which may be nil for a
+// type switch variable), for display in the verbose log.
+func (r *Rename) occurrenceCause(obj types.Object, id *ast.Ident, kind OccurrenceKind, reason string) string {
+	declared := ""
+	if obj != nil && obj.Pos().IsValid() {
+		pos := r.Program.Fset.Position(obj.Pos())
+		declared = fmt.Sprintf(" declared at %s:%d:%d",
+			filepath.Base(pos.Filename), pos.Line, pos.Column)
+	}
+	switch kind {
+	case OccurrenceDeclaration:
+		return fmt.Sprintf("declaration of %s", id.Name)
+	case OccurrenceWrite:
+		return fmt.Sprintf("assignment to %s%s", id.Name, declared)
+	case OccurrenceInterfaceMethod:
+		if reason == "" {
+			return fmt.Sprintf("method %s renamed along with %s%s",
+				id.Name, obj.Name(), declared)
+		}
+		return fmt.Sprintf("method %s, since %s", id.Name, reason)
+	default:
+		return fmt.Sprintf("use of %s%s", id.Name, declared)
+	}
+}
+
+// explainInterfaceMethods logs an informational message for each method that
+// must be renamed along with the given object so that types continue to
+// implement the same interfaces, explaining why (since the methods may be
+// declared in seemingly unrelated files).  It returns the explanations, keyed
+// by the positions of those methods' declarations.
+func (r *Rename) explainInterfaceMethods(obj types.Object) map[token.Position]string {
+	result := map[token.Position]string{}
+	if obj == nil {
+		return result
 	}
+	for _, link := range names.ExplainDeclarationsAcrossInterfaces(obj, r.Program) {
+		reason := methodLinkReason(link)
+		r.Log.Infof("Renaming %s also renames %s, since %s",
+			methodName(obj), methodName(link.Method), reason)
+		r.Log.AssociatePos(link.Method.Pos(), link.Method.Pos())
+		result[r.Program.Fset.Position(link.Method.Pos())] = reason
+	}
+	return result
+}
 
-	sorted := map[string][]*text.Extent{}
-	for fname, extents := range result {
-		sorted[fname] = text.Sort(extents)
+// methodLinkReason describes why link.Method must be renamed along with
+// link.Via (e.g., "T2 implements I, which T1 also implements").
+func methodLinkReason(link names.MethodLink) string {
+	qualifier := types.RelativeTo(link.Method.Pkg())
+	iface := types.TypeString(link.Interface, qualifier)
+	method := types.TypeString(methodRecvType(link.Method), qualifier)
+	via := types.TypeString(methodRecvType(link.Via), qualifier)
+	switch {
+	case types.Identical(methodRecvType(link.Method), link.Interface):
+		return fmt.Sprintf("%s implements %s", via, iface)
+	case types.Identical(methodRecvType(link.Via), link.Interface):
+		return fmt.Sprintf("%s implements %s", method, iface)
+	default:
+		return fmt.Sprintf("%s implements %s, which %s also implements",
+			method, iface, via)
+	}
+}
+
+// methodName returns the name of the given method, qualified by the name of
+// its receiver's type (e.g., T.Method).
+func methodName(method types.Object) string {
+	recv := methodRecvType(method)
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+	}
+	return types.TypeString(recv, types.RelativeTo(method.Pkg())) +
+		"." + method.Name()
+}
+
+// methodRecvType returns the type of the receiver of the given method.
+func methodRecvType(method types.Object) types.Type {
+	return method.Type().(*types.Signature).Recv().Type()
+}
+
+// occurrenceKind classifies the given identifier, which refers to the given
+// object (nil for a type switch variable).  Declarations of methods other
+// than the selected one were found because they implement (or are declared
+// in) the same interfaces, and declarations of embedded fields are references
+// to the type being renamed.
+func (r *Rename) occurrenceKind(obj types.Object, id *ast.Ident) OccurrenceKind {
+	pkg, path, _ := r.Program.PathEnclosingInterval(id.Pos(), id.End())
+	if pkg == nil || len(path) == 0 {
+		return OccurrenceRead
+	}
+	if def, isDef := pkg.TypesInfo.Defs[id]; isDef {
+		switch def := def.(type) {
+		case *types.Func:
+			if obj != nil && def.Pos() != obj.Pos() {
+				return OccurrenceInterfaceMethod
+			}
+		case *types.Var:
+			if def.Embedded() && isTypeName(obj) {
+				return OccurrenceRead
+			}
+		}
+		return OccurrenceDeclaration
 	}
-	return sorted
+	if isAssignedAt(path) {
+		return OccurrenceWrite
+	}
+	return OccurrenceRead
 }
 
-func (r *Rename) addOccurrences(name string, scope *types.Scope, allOccurrences map[string][]*text.Extent) {
+func (r *Rename) addOccurrences(name string, scope *types.Scope, allOccurrences map[string][]Occurrence) {
 	hasOccsInGoRoot := false
 	for filename, occurrences := range allOccurrences {
 		if isInGoRoot(filename) {
@@ -216,14 +759,15 @@ func (r *Rename) addOccurrences(name string, scope *types.Scope, allOccurrences
 				r.Edits[filename] = text.NewEditSet()
 			}
 			for _, occurrence := range occurrences {
-				r.Edits[filename].Add(occurrence, r.newName)
+				err := r.addOccurrence(filename, occurrence.Extent,
+					r.newName, occurrence.Kind, occurrence.Cause)
+				if err == nil && occurrence.Reason != "" {
+					r.Occurrences[len(r.Occurrences)-1].Reason =
+						occurrence.Reason
+				}
 			}
 			_, file := r.fileNamed(filename)
-			commentOccurrences := names.FindInComments(
-				name, file, scope, r.Program.Fset)
-			for _, occurrence := range commentOccurrences {
-				r.Edits[filename].Add(occurrence, r.newName)
-			}
+			r.addCommentOccurrences(name, filename, file, scope)
 		}
 	}
 	if hasOccsInGoRoot {
@@ -231,6 +775,130 @@ func (r *Rename) addOccurrences(name string, scope *types.Scope, allOccurrences
 	}
 }
 
+// addCommentOccurrences renames occurrences of the given name in comments in
+// the given file, other than those in doc links.  Unless renameCommentWords
+// is set, only occurrences that appear to refer to code (e.g., `Name` or
+// Name()) are renamed; the others are logged so that the user can review
+// them.
+func (r *Rename) addCommentOccurrences(name, filename string, file *ast.File, scope *types.Scope) {
+	if file == nil {
+		return
+	}
+	tfile := r.Program.Fset.File(file.Pos())
+	occurrences := names.FindCommentOccurrences(name, file, scope, r.Program.Fset)
+	for _, occurrence := range occurrences {
+		if occurrence.Kind == names.CommentDocLink {
+			continue // See addDocLinkOccurrences
+		}
+		if occurrence.Kind == names.CommentReference {
+			r.addOccurrence(filename, occurrence.Extent, r.newName,
+				OccurrenceComment, fmt.Sprintf("comment referring "+
+					"to %s as code", name))
+		} else if r.renameCommentWords {
+			r.addOccurrence(filename, occurrence.Extent, r.newName,
+				OccurrenceComment, fmt.Sprintf("the word %s in a "+
+					"comment", name))
+		} else {
+			r.Log.Infof("The word \"%s\" in this comment was not "+
+				"renamed, since it does not appear to refer to code",
+				name)
+			r.Log.AssociatePos(tfile.Pos(occurrence.Offset),
+				tfile.Pos(occurrence.OffsetPastEnd()))
+			r.Log.AssociateCode(CodeRenameCommentWord)
+		}
+	}
+}
+
+// addDocLinkOccurrences renames the doc links (e.g., [Name], [T.Name], or
+// [pkg.Name]) that refer to the identifier being renamed, in every file in
+// the program.  Unlike other comment occurrences, doc links can be resolved
+// precisely, so links to other objects with the same name are left alone.
+func (r *Rename) addDocLinkOccurrences(idents map[*ast.Ident]bool) {
+	fset := r.Program.Fset
+	renamed := map[token.Position]bool{}
+	for id := range idents {
+		renamed[fset.Position(id.Pos())] = true
+	}
+	for _, pkgInfo := range r.Program.AllPackages {
+		for _, file := range pkgInfo.Syntax {
+			filename := fset.Position(file.Pos()).Filename
+			if isInGoRoot(filename) {
+				continue
+			}
+			for _, link := range names.FindDocLinks(file, fset) {
+				objs := resolveDocLink(pkgInfo.Types, file, link)
+				for i, obj := range objs {
+					if obj == nil || !renamed[fset.Position(obj.Pos())] {
+						continue
+					}
+					r.addOccurrence(filename, &text.Extent{
+						Offset: link.Offsets[i],
+						Length: len(link.Names[i]),
+					}, r.newName, OccurrenceComment,
+						fmt.Sprintf("doc link to %s", link.Names[i]))
+				}
+			}
+		}
+	}
+}
+
+// resolveDocLink returns the object referred to by each name in the given
+// doc link, which appears in the given file of the given package.  The
+// result has one element per name in the link; elements are nil for package
+// names and for names that cannot be resolved.
+func resolveDocLink(pkg *types.Package, file *ast.File, link names.DocLink) []types.Object {
+	result := make([]types.Object, len(link.Names))
+	start := 0
+	if link.ImportPath != "" {
+		pkg = importedPackage(pkg, file, link.ImportPath, "")
+	} else if len(link.Names) == 3 ||
+		(len(link.Names) == 2 && !isTypeName(pkg.Scope().Lookup(link.Names[0]))) {
+		pkg = importedPackage(pkg, file, "", link.Names[0])
+		start = 1
+	}
+	if pkg == nil {
+		return result
+	}
+
+	obj := pkg.Scope().Lookup(link.Names[start])
+	result[start] = obj
+	if start+1 < len(link.Names) {
+		if typeName, ok := obj.(*types.TypeName); ok {
+			result[start+1], _, _ = types.LookupFieldOrMethod(
+				typeName.Type(), true, pkg, link.Names[start+1])
+		}
+	}
+	return result
+}
+
+// importedPackage returns the package imported by pkg with the given import
+// path (if path is nonempty) or name, or nil if there is no such package.
+// Import names in the given file take precedence over package names.
+func importedPackage(pkg *types.Package, file *ast.File, path, name string) *types.Package {
+	if path == "" {
+		for _, spec := range file.Imports {
+			if spec.Name != nil && spec.Name.Name == name {
+				path, _ = strconv.Unquote(spec.Path.Value)
+				name = ""
+				break
+			}
+		}
+	}
+	for _, imported := range pkg.Imports() {
+		if (path != "" && imported.Path() == path) ||
+			(path == "" && imported.Name() == name) {
+			return imported
+		}
+	}
+	return nil
+}
+
+// isTypeName returns true if the given object is a type name.
+func isTypeName(obj types.Object) bool {
+	_, ok := obj.(*types.TypeName)
+	return ok
+}
+
 func isInGoRoot(absPath string) bool {
 	goRoot := os.Getenv("GOROOT")
 	if goRoot == "" {
@@ -243,6 +911,119 @@ func isInGoRoot(absPath string) bool {
 	return strings.HasPrefix(absPath, goRoot)
 }
 
+// reflowDocComments rewraps each doc comment in which a name was renamed if
+// the new name makes more of its lines extend past text.DefaultCommentColumn.
+// The edits to such a comment are replaced by a single edit, which replaces
+// the entire comment (and is recorded as an OccurrenceComment).
+func (r *Rename) reflowDocComments() {
+	for _, filename := range sortedFilenames(r.Edits) {
+		if r.Edits[filename].Len() == 0 {
+			continue
+		}
+		_, file := r.fileNamed(filename)
+		if file == nil {
+			continue
+		}
+		contents, err := r.files.read(filename)
+		if err != nil {
+			continue
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			var doc *ast.CommentGroup
+			switch n := n.(type) {
+			case *ast.File:
+				doc = n.Doc
+			case *ast.FuncDecl:
+				doc = n.Doc
+			case *ast.GenDecl:
+				doc = n.Doc
+			case *ast.TypeSpec:
+				doc = n.Doc
+			case *ast.ValueSpec:
+				doc = n.Doc
+			case *ast.Field:
+				doc = n.Doc
+			}
+			if doc != nil {
+				r.reflowDocComment(filename, contents, doc)
+			}
+			return true
+		})
+	}
+}
+
+// reflowDocComment rewraps the given doc comment if necessary (see
+// reflowDocComments).
+func (r *Rename) reflowDocComment(filename string, contents []byte, doc *ast.CommentGroup) {
+	start := r.Program.Fset.Position(doc.Pos())
+	end := r.Program.Fset.Position(doc.End()).Offset
+	if end > len(contents) {
+		return
+	}
+	indent := string(contents[start.Offset-(start.Column-1) : start.Offset])
+	if strings.TrimSpace(indent) != "" {
+		return // not a doc comment on lines by itself
+	}
+
+	// Apply the edits in the comment to its text
+	inComment := map[text.Extent]bool{}
+	edits := text.NewEditSet()
+	r.Edits[filename].Iterate(func(extent *text.Extent, replacement string) bool {
+		if extent.Offset >= start.Offset && extent.OffsetPastEnd() <= end {
+			inComment[*extent] = true
+			edits.Add(&text.Extent{extent.Offset - start.Offset,
+				extent.Length}, replacement)
+		}
+		return true
+	})
+	if len(inComment) == 0 {
+		return
+	}
+	original := string(contents[start.Offset:end])
+	renamed, err := text.ApplyToString(edits, original)
+	if err != nil || longLines(renamed, indent) <= longLines(original, indent) {
+		return
+	}
+
+	// Replace the edits with a single edit replacing the entire comment
+	old := r.Edits[filename]
+	r.Edits[filename] = text.NewEditSet()
+	r.Edits[filename].SetBaseHash(old.BaseHash())
+	old.Iterate(func(extent *text.Extent, replacement string) bool {
+		if !inComment[*extent] {
+			r.Edits[filename].Add(extent, replacement)
+		}
+		return true
+	})
+	occurrences := []Occurrence{}
+	causes := []string{}
+	for _, occ := range r.Occurrences {
+		if occ.Filename != filename || !inComment[*occ.Extent] {
+			occurrences = append(occurrences, occ)
+		} else if len(causes) == 0 || causes[len(causes)-1] != occ.Cause {
+			causes = append(causes, occ.Cause)
+		}
+	}
+	r.Occurrences = occurrences
+	r.addOccurrence(filename, &text.Extent{start.Offset, end - start.Offset},
+		text.ReflowComment(renamed, indent, text.DefaultCommentColumn),
+		OccurrenceComment, fmt.Sprintf("comment rewrapped after "+
+			"renaming (%s)", strings.Join(causes, "; ")))
+}
+
+// longLines returns the number of lines in the given comment (whose first line
+// is preceded by the given indentation) that extend past
+// text.DefaultCommentColumn.
+func longLines(comment, indent string) int {
+	count := 0
+	for _, line := range strings.Split(indent+comment, "\n") {
+		if text.Width(line) > text.DefaultCommentColumn {
+			count++
+		}
+	}
+	return count
+}
+
 func (r *Rename) fileNamed(filename string) (*packages.Package, *ast.File) {
 	absFilename, _ := filepath.Abs(filename)
 	for _, pkgInfo := range r.Program.AllPackages {
@@ -277,6 +1058,101 @@ const renameDoc = `
     the name of a function in the Go standard library).</li>
   </ul>
 
+  <p>Doc links in comments (e.g., <tt>[Name]</tt>, <tt>[T.Name]</tt>, or
+  <tt>[pkg.Name]</tt>) are renamed if, and only if, they refer to the renamed
+  identifier.  Other occurrences of the name in comments are renamed if they
+  appear to refer to code: the name is enclosed in backquotes
+  (<tt>` + "`Name`" + `</tt>), is followed by a parenthesis
+  (<tt>Name()</tt>), or follows a selector (<tt>x.Name</tt>).  Other
+  occurrences of the name as a word (e.g., "Run" in "Run the tests") are not
+  renamed, but they are listed as informational messages so they can be
+  reviewed.  To rename these as well, set the optional "Rename Words in
+  Comments" parameter to true.</p>
+
+  <p>When a method is renamed, methods with the same name and signature
+  must sometimes be renamed too, so that every type continues to implement the
+  same interfaces.  For example, if types <tt>T1</tt> and <tt>T2</tt> both
+  implement an interface <tt>I</tt>, renaming <tt>T1.M</tt> also renames
+  <tt>I.M</tt> and <tt>T2.M</tt>.  Each such method is listed as an
+  informational message explaining why it is renamed (e.g., "Renaming T1.M
+  also renames T2.M, since T2 implements I, which T1 also implements").</p>
+
+  <p>When no scope is provided, only the package containing the selected
+  identifier is normally loaded.  However, an exported name may be referenced
+  in other packages, so if the selected identifier is exported (and is not in
+  a <tt>main</tt> package), the scope is expanded to the entire module
+  containing it, and an informational message says so.  Provide an explicit
+  scope to prevent this.</p>
+
+  <p>References in files other than Go source code (e.g., YAML files that
+  name handler functions) can be renamed as well by configuring sidecar
+  scanners.  From the command line, use the <tt>-sidecar</tt> flag to name a
+  JSON file listing the files to search and, optionally, a regular expression
+  identifying references in those files.</p>
+
+  <p>Files excluded from the build by build constraints (e.g.,
+  <tt>foo_windows.go</tt> when refactoring on Linux) are not loaded, so they
+  are not normally changed.  Setting the optional "Rename in Excluded Files"
+  parameter to true renames matching names in these files as well.  Since
+  they cannot be type checked, names are matched syntactically; a warning
+  identifies each file changed this way so it can be checked by hand.</p>
+
+  <p>Test, benchmark, and example functions named after the renamed identifier
+  are renamed along with it, so that (e.g.) godoc continues to attach
+  examples to the declarations they document.  For example, renaming
+  <tt>Foo</tt> also renames <tt>TestFoo</tt>, <tt>BenchmarkFoo</tt>,
+  <tt>ExampleFoo</tt>, and <tt>ExampleFoo_suffix</tt>, and renaming a method
+  <tt>T.M</tt> renames <tt>ExampleT_M</tt>.  Each is listed as an informational
+  message; clients that preview changes can exclude these edits (they are
+  occurrences of kind <tt>test_function</tt>).  A function is not renamed if its
+  new name would conflict with an existing declaration or would no longer be
+  run by <tt>go test</tt> (e.g., when an exported name is made
+  unexported).</p>
+
+  <p>Renaming an exported name in a package that can be imported from outside
+  its module (i.e., other than a <tt>main</tt> or <tt>internal</tt> package)
+  removes the old name from the package's API, which will break code that
+  uses it.  A warning is reported, and the changes to the API are included in
+  the result in the style of the <tt>apidiff</tt> tool (e.g.,
+  "<tt>Greet: removed</tt>" and "<tt>Welcome: added</tt>").  Setting the
+  optional "Keep Deprecated Alias" parameter to true keeps the old name,
+  declaring it after the renamed declaration with a comment such as
+  <tt>// Deprecated: use Welcome.</tt>, so that code in other modules does not
+  break immediately: a function or method becomes a thin wrapper that calls
+  the renamed one,
+  a type becomes a type alias, and a constant is defined as the new constant.
+  Variables, fields, and interface methods cannot be aliased.</p>
+
+  <p>When a method receiver is selected, setting the optional "Rename All
+  Receivers" parameter to true gives the same name to the receivers of every
+  method of that type (e.g., to make <tt>func (this *T)</tt> and
+  <tt>func (t T)</tt> consistent).  Each receiver is checked for conflicts
+  individually.  Unnamed receivers and receivers named <tt>_</tt> are not
+  changed.</p>
+
+  <p>In a file that dot-imports a package (<tt>import . "pkg"</tt>), the
+  package's exported names are referenced without a qualifier.  When such a
+  name is renamed, its references in these files are renamed as well, and
+  the new name is checked for conflicts with the declarations and other
+  imports visible in them.  A warning identifies each of these files, since
+  their unqualified references are easy to mistake for references to local
+  declarations.</p>
+
+  <p>The name of an aliased import (e.g., <tt>s</tt> in
+  <tt>import s "strings"</tt>) can be renamed; other imports of the same
+  package, including blank imports (<tt>import _ "pkg"</tt>), are left
+  unchanged.  Blank imports exist only for the side effects of initializing
+  the imported package, so they cannot be renamed, nor can an import be
+  renamed to <tt>_</tt>.</p>
+
+  <p>If the new name is the name of an imported package (e.g., renaming a
+  local variable to <tt>fmt</tt> in a file that imports <tt>fmt</tt>), the
+  renamed identifier would shadow the import.  This is an error if the
+  package is used where the identifier is visible (or if the identifier is
+  declared at the package level), and a warning otherwise, since the
+  package could no longer be used there.  The message suggests an
+  alternative name.</p>
+
   <h4>Example</h4>
   <p>The example below demonstrates the effect of renaming the highlighted
   occurrence of <tt>hello</tt> to <tt>goodnight</tt>.  Note that there are two
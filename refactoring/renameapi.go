@@ -0,0 +1,238 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the part of the Rename refactoring that reports
+// changes to the exported API of a package.  Renaming an exported name
+// removes the old name from the package's API, breaking any code outside the
+// module that uses it; optionally, the old name can be kept as a deprecated
+// alias for the new one.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// checkAPICompatibility records the changes that renaming the given object
+// makes to the exported API of its package (see Result.APIChanges) and warns
+// if they are incompatible.  If keepAlias is set, the old name is declared as a
+// deprecated alias for the new one (see declareDeprecatedAlias), so that the
+// old name is not removed.
+func (r *Rename) checkAPICompatibility(obj types.Object) {
+	oldName, iface := apiName(obj)
+	if oldName == "" {
+		if r.keepAlias && obj != nil {
+			r.Log.Infof("No deprecated alias was declared for %s, "+
+				"since it is not part of the exported API of a "+
+				"package", obj.Name())
+		}
+		return
+	}
+	newName := r.newName
+	if strings.Contains(oldName, ".") {
+		newName = oldName[:strings.Index(oldName, ".")+1] + r.newName
+	}
+	path := obj.Pkg().Path()
+
+	aliased := r.keepAlias && r.declareDeprecatedAlias(obj)
+	if !aliased {
+		r.APIChanges = append(r.APIChanges, APIChange{
+			Package: path,
+			Name:    oldName,
+			Message: "removed",
+		})
+	}
+	if ast.IsExported(r.newName) {
+		message := "added"
+		if iface {
+			message = "added to interface"
+		}
+		r.APIChanges = append(r.APIChanges, APIChange{
+			Package:    path,
+			Name:       newName,
+			Message:    message,
+			Compatible: !iface,
+		})
+	}
+
+	switch {
+	case !aliased && r.keepAlias:
+		r.Log.Warnf("%s is part of the exported API of %s, so renaming "+
+			"it will break code in other modules that uses it",
+			oldName, path)
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+	case !aliased:
+		r.Log.Warnf("%s is part of the exported API of %s, so renaming "+
+			"it will break code in other modules that uses it; to "+
+			"keep the old name, set the optional \"Keep Deprecated "+
+			"Alias\" parameter to true", oldName, path)
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+	case iface:
+		r.Log.Warnf("Adding %s to an interface will break types in "+
+			"other modules that implement %s", newName,
+			oldName[:strings.Index(oldName, ".")])
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+	}
+}
+
+// apiName returns the name of the given object as it appears in the exported
+// API of its package (e.g., "F" for a function or "T.M" for a method of a
+// type T), or "" if the object is not part of an API.  Exported package-level
+// names, and exported methods and fields of exported package-level types, are
+// part of the API of any package other than a main package, a test package,
+// or an internal package (one whose import path contains an "internal"
+// element).  The second result is true if the object is a method of an
+// interface.
+func apiName(obj types.Object) (string, bool) {
+	if obj == nil || obj.Pkg() == nil || !obj.Exported() ||
+		!isAPIPackage(obj.Pkg()) {
+		return "", false
+	}
+	if obj.Parent() == obj.Pkg().Scope() {
+		return obj.Name(), false
+	}
+	typeName := memberTypeName(obj)
+	if typeName == "" || !ast.IsExported(typeName) {
+		return "", false
+	}
+	typ, ok := obj.Pkg().Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return "", false // A local type
+	}
+	_, iface := typ.Type().Underlying().(*types.Interface)
+	return typeName + "." + obj.Name(), iface && !isField(obj)
+}
+
+// isAPIPackage returns true if code outside the given package's module can
+// import it (see apiName).
+func isAPIPackage(pkg *types.Package) bool {
+	if pkg.Name() == "main" || strings.HasSuffix(pkg.Path(), "_test") {
+		return false
+	}
+	for _, elt := range strings.Split(pkg.Path(), "/") {
+		if elt == "internal" {
+			return false
+		}
+	}
+	return true
+}
+
+func isField(obj types.Object) bool {
+	v, ok := obj.(*types.Var)
+	return ok && v.IsField()
+}
+
+// declareDeprecatedAlias declares the old name of the given object as a
+// deprecated alias for the new name, immediately following the object's
+// declaration, returning true if it was declared.  A function or method is
+// aliased by a function or method with the same signature that calls the
+// renamed one; a type, by a type alias; and a constant, by a constant.
+// Variables, fields, and interface methods cannot be aliased.
+func (r *Rename) declareDeprecatedAlias(obj types.Object) bool {
+	filename := r.Program.Fset.Position(obj.Pos()).Filename
+	_, file := r.fileNamed(filename)
+	contents, err := r.files.read(filename)
+	if file == nil || err != nil {
+		r.Log.Errorf("The file declaring %s could not be read, so a "+
+			"deprecated alias was not declared", obj.Name())
+		return false
+	}
+	var decl ast.Decl
+	for _, d := range file.Decls {
+		if d.Pos() <= obj.Pos() && obj.Pos() < d.End() {
+			decl = d
+		}
+	}
+
+	var alias string
+	switch obj.(type) {
+	case *types.TypeName:
+		alias = fmt.Sprintf("type %s = %s", obj.Name(), r.newName)
+	case *types.Const:
+		alias = fmt.Sprintf("const %s = %s", obj.Name(), r.newName)
+	case *types.Func:
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+			alias = r.deprecatedWrapper(funcDecl, contents)
+		}
+	}
+	if alias == "" || decl == nil {
+		r.Log.Warnf("A deprecated alias cannot be declared for %s; "+
+			"variables, fields, and interface methods cannot be "+
+			"aliased", obj.Name())
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		return false
+	}
+
+	end := r.newDeclText(r.files, filename, file, decl).end
+	if r.Edits[filename] == nil {
+		r.Edits[filename] = text.NewEditSet()
+	}
+	if err := r.Edits[filename].Add(&text.Extent{Offset: end, Length: 0},
+		fmt.Sprintf("\n\n// Deprecated: use %s.\n%s",
+			r.newName, alias)); err != nil {
+		r.Log.Errorf("%s: %v", filename, err)
+		return false
+	}
+	r.Log.Infof("%s was declared as a deprecated alias for %s",
+		obj.Name(), r.newName)
+	r.Log.AssociatePos(obj.Pos(), obj.Pos())
+	return true
+}
+
+// deprecatedWrapper returns the text of a function (or method) with the same
+// name and signature as the given one that calls it by its new name.
+// Unnamed and blank parameters are given names so they can be passed.
+func (r *Rename) deprecatedWrapper(funcDecl *ast.FuncDecl, contents []byte) string {
+	source := func(n ast.Node) string {
+		return string(contents[r.Program.Fset.Position(n.Pos()).Offset:r.Program.Fset.Position(n.End()).Offset])
+	}
+
+	recv, callee := "", r.newName
+	if funcDecl.Recv != nil && len(funcDecl.Recv.List) == 1 {
+		field := funcDecl.Recv.List[0]
+		name := "recv"
+		if len(field.Names) == 1 && field.Names[0].Name != "_" {
+			name = field.Names[0].Name
+		}
+		recv = fmt.Sprintf("(%s %s) ", name, source(field.Type))
+		callee = name + "." + r.newName
+	}
+
+	params, args := []string{}, []string{}
+	for _, field := range funcDecl.Type.Params.List {
+		names := []string{}
+		for _, id := range field.Names {
+			names = append(names, id.Name)
+		}
+		if len(names) == 0 {
+			names = append(names, "_")
+		}
+		for i, name := range names {
+			if name == "_" {
+				names[i] = fmt.Sprintf("p%d", len(args))
+			}
+			arg := names[i]
+			if _, ok := field.Type.(*ast.Ellipsis); ok {
+				arg += "..."
+			}
+			args = append(args, arg)
+		}
+		params = append(params,
+			strings.Join(names, ", ")+" "+source(field.Type))
+	}
+
+	results, ret := "", ""
+	if funcDecl.Type.Results != nil && len(funcDecl.Type.Results.List) > 0 {
+		results = " " + source(funcDecl.Type.Results)
+		ret = "return "
+	}
+	return fmt.Sprintf("func %s%s(%s)%s {\n\t%s%s(%s)\n}", recv,
+		funcDecl.Name.Name, strings.Join(params, ", "), results, ret,
+		callee, strings.Join(args, ", "))
+}
@@ -0,0 +1,108 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestRenameAPIChanges(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	const contents = `package greet
+
+func Greet() {}
+
+type Speaker interface {
+	Speak()
+}
+
+func helper() {}
+`
+	paths := map[string]string{}
+	write := func(path string) string {
+		dir := filepath.Join(gopath, "src", filepath.FromSlash(path))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(dir, "greet.go")
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths[filename] = path
+		return filename
+	}
+	greetFile := write("example.com/greet")
+	internalFile := write("example.com/internal/greet")
+
+	rename := func(filename string, line, col int, newName string, alias bool) *Result {
+		result := new(Rename).Run(&Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Scope:      []string{paths[filename]},
+			Selection: &text.LineColSelection{
+				Filename:  filename,
+				StartLine: line, StartCol: col,
+				EndLine: line, EndCol: col,
+			},
+			Args:       []interface{}{newName, false, false, false, alias},
+			GoPath:     gopath,
+			ModulesOff: true,
+		})
+		if result.Log.ContainsErrors() {
+			t.Fatal(result.Log)
+		}
+		return result
+	}
+	report := func(result *Result) string {
+		return APIReport(result.APIChanges)
+	}
+
+	result := rename(greetFile, 3, 6, "Welcome", false)
+	expected := "example.com/greet\nIncompatible changes:\n- Greet: removed\n" +
+		"Compatible changes:\n- Welcome: added\n"
+	if actual := report(result); actual != expected {
+		t.Errorf("Expected report\n%s\ngot\n%s", expected, actual)
+	}
+	if !strings.Contains(result.Log.String(), "exported API") {
+		t.Errorf("Expected a warning that Greet is exported:\n%s",
+			result.Log)
+	}
+
+	result = rename(greetFile, 3, 6, "Welcome", true)
+	expected = "example.com/greet\nCompatible changes:\n- Welcome: added\n"
+	if actual := report(result); actual != expected {
+		t.Errorf("Expected report\n%s\ngot\n%s", expected, actual)
+	}
+
+	result = rename(greetFile, 6, 2, "Talk", false)
+	expected = "example.com/greet\nIncompatible changes:\n- Speaker.Speak: removed\n" +
+		"- Speaker.Talk: added to interface\n"
+	if actual := report(result); actual != expected {
+		t.Errorf("Expected report\n%s\ngot\n%s", expected, actual)
+	}
+
+	// Unexported names and internal packages are not part of an API
+	expected = "example.com/greet\nIncompatible changes:\n- Greet: removed\n"
+	if actual := report(rename(greetFile, 3, 6, "welcome", false)); actual != expected {
+		t.Errorf("Expected report\n%s\ngot\n%s", expected, actual)
+	}
+	if actual := report(rename(greetFile, 9, 6, "assist", false)); actual != "" {
+		t.Errorf("Unexported names should not be reported:\n%s", actual)
+	}
+	if actual := report(rename(internalFile, 3, 6, "Welcome", false)); actual != "" {
+		t.Errorf("Internal packages should not be reported:\n%s", actual)
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the optional pass of the Rename refactoring that
+// renames occurrences in files excluded from the build by build constraints
+// (e.g., foo_windows.go when the program is loaded on Linux).  These files are
+// not loaded, so they cannot be type checked; instead, they are parsed, and
+// names are matched syntactically.  This is imprecise, so every such edit is
+// recorded as an OccurrenceSyntactic and reported in a warning.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// renameInExcludedFiles renames syntactic matches for the given object in the
+// files excluded from the build (in the given build configuration) that are in
+// the directory of the package declaring it or in a directory containing a
+// file that was modified.
+//
+// In the declaring package, references to a package-level name are matched
+// if they are not qualified and do not refer to a local declaration; for a
+// method or field of a type T, declarations of the member in T and all
+// selectors with the member's name are matched.  In other packages, only
+// qualified references to an exported package-level name (pkg.Name) are
+// matched.  Other objects (e.g., local variables) are not renamed.
+func (r *Rename) renameInExcludedFiles(obj types.Object, buildConfig BuildConfig) {
+	if obj == nil || obj.Pkg() == nil || !obj.Pos().IsValid() {
+		return
+	}
+	typeName := memberTypeName(obj)
+	if obj.Parent() != obj.Pkg().Scope() && typeName == "" {
+		r.Log.Infof("Only package-level names, methods, and fields "+
+			"are renamed in files excluded by build constraints; "+
+			"%s was not", obj.Name())
+		return
+	}
+
+	declDir := filepath.Dir(r.Program.Fset.Position(obj.Pos()).Filename)
+	dirs := map[string]bool{declDir: true}
+	for filename, edits := range r.Edits {
+		if edits.Len() > 0 {
+			dirs[filepath.Dir(filename)] = true
+		}
+	}
+
+	ctxt := buildConfig.Context(r.files.fileSystem)
+	for _, filename := range excludedGoFiles(ctxt, dirs) {
+		contents, err := r.files.read(filename)
+		if err != nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filename, contents, 0)
+		if err != nil {
+			r.Log.Warnf("%s is excluded by build constraints and "+
+				"could not be parsed, so it was not updated: %s",
+				filename, err)
+			continue
+		}
+
+		var matches []*ast.Ident
+		if filepath.Dir(filename) == declDir &&
+			file.Name.Name == obj.Pkg().Name() {
+			if typeName != "" {
+				matches = memberMatches(file, typeName, obj.Name())
+			} else {
+				matches = packageLevelMatches(file, obj.Name())
+			}
+		} else if typeName == "" && obj.Exported() {
+			matches = qualifiedMatches(file, obj.Pkg(), obj.Name())
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		if r.Edits[filename] == nil {
+			r.Edits[filename] = text.NewEditSet()
+			r.Edits[filename].SetBase(contents)
+		}
+		for _, id := range matches {
+			offset := fset.Position(id.Pos()).Offset
+			r.addOccurrence(filename,
+				&text.Extent{Offset: offset, Length: len(id.Name)},
+				r.newName, OccurrenceSyntactic, fmt.Sprintf(
+					"name matching %s in a file excluded by build "+
+						"constraints", obj.Name()))
+		}
+		r.Log.Warnf("%s is excluded by build constraints, so it was "+
+			"not type checked; %d occurrence(s) of %s in it were "+
+			"renamed by matching names alone and should be "+
+			"checked by hand", filename, len(matches), obj.Name())
+	}
+}
+
+// memberTypeName returns the name of the type declaring the given method or
+// field, or "" if the object is not a method or field of a package-level named
+// type.
+func memberTypeName(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Func:
+		sig, ok := obj.Type().(*types.Signature)
+		if !ok || sig.Recv() == nil {
+			return ""
+		}
+		recv := sig.Recv().Type()
+		if ptr, ok := recv.(*types.Pointer); ok {
+			recv = ptr.Elem()
+		}
+		if named, ok := recv.(*types.Named); ok {
+			return named.Obj().Name()
+		}
+		// An interface method
+		return declaringTypeName(obj)
+	case *types.Var:
+		if obj.IsField() {
+			return declaringTypeName(obj)
+		}
+	}
+	return ""
+}
+
+// declaringTypeName returns the name of the package-level type whose struct
+// or interface type declares the given field or interface method, or "" if
+// there is none.
+func declaringTypeName(member types.Object) string {
+	scope := member.Pkg().Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		switch t := tn.Type().Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				if t.Field(i) == member {
+					return name
+				}
+			}
+		case *types.Interface:
+			for i := 0; i < t.NumExplicitMethods(); i++ {
+				if t.ExplicitMethod(i) == member {
+					return name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// excludedGoFiles returns the Go files in the given directories that are
+// excluded from the build in the given build context, in sorted order.
+func excludedGoFiles(ctxt *build.Context, dirs map[string]bool) []string {
+	result := []string{}
+	for dir := range dirs {
+		infos, err := ctxt.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			name := info.Name()
+			if info.IsDir() || !strings.HasSuffix(name, ".go") ||
+				strings.HasPrefix(name, "_") ||
+				strings.HasPrefix(name, ".") {
+				continue
+			}
+			if match, err := ctxt.MatchFile(dir, name); err == nil && !match {
+				result = append(result, filepath.Join(dir, name))
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// packageLevelMatches returns the identifiers in the given file that may refer
+// to the package-level declaration with the given name: its declaration (if
+// the file contains a declaration with that name, e.g., a platform-specific
+// version of a function) and unqualified references that the parser did not
+// resolve to a local declaration.
+func packageLevelMatches(file *ast.File, name string) []*ast.Ident {
+	topLevel := map[interface{}]bool{}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				topLevel[decl] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				topLevel[spec] = true
+			}
+		}
+	}
+	unresolved := map[*ast.Ident]bool{}
+	for _, id := range file.Unresolved {
+		unresolved[id] = true
+	}
+
+	result := []*ast.Ident{}
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			// The selected name is a field, method, or qualified
+			// name, not a reference to the declaration
+			ast.Inspect(n.X, visit)
+			return false
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				// A method with the same name does not conflict
+				ast.Inspect(n.Recv, visit)
+				ast.Inspect(n.Type, visit)
+				if n.Body != nil {
+					ast.Inspect(n.Body, visit)
+				}
+				return false
+			}
+		case *ast.Ident:
+			if n.Name == name && (unresolved[n] ||
+				n.Obj != nil && topLevel[n.Obj.Decl]) {
+				result = append(result, n)
+			}
+		}
+		return true
+	}
+	ast.Inspect(file, visit)
+	return result
+}
+
+// memberMatches returns the identifiers in the given file that may refer to
+// the method or field with the given name of the type with the given name:
+// declarations of the member in that type, and all selectors with that name.
+func memberMatches(file *ast.File, typeName, name string) []*ast.Ident {
+	result := []*ast.Ident{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Recv != nil && n.Name.Name == name &&
+				len(n.Recv.List) == 1 &&
+				receiverBaseName(n.Recv.List[0].Type) == typeName {
+				result = append(result, n.Name)
+			}
+		case *ast.TypeSpec:
+			if n.Name.Name != typeName {
+				return true
+			}
+			var fields *ast.FieldList
+			switch t := n.Type.(type) {
+			case *ast.StructType:
+				fields = t.Fields
+			case *ast.InterfaceType:
+				fields = t.Methods
+			}
+			if fields != nil {
+				for _, field := range fields.List {
+					for _, id := range field.Names {
+						if id.Name == name {
+							result = append(result, id)
+						}
+					}
+				}
+			}
+		case *ast.SelectorExpr:
+			if n.Sel.Name == name {
+				result = append(result, n.Sel)
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// receiverBaseName returns the name of the type in a method receiver,
+// ignoring pointers and type parameters (e.g., T for *T or T[K]).
+func receiverBaseName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// qualifiedMatches returns the selected identifiers in qualified references
+// (pkg.Name) to the given name in the given package in a file that imports it.
+func qualifiedMatches(file *ast.File, pkg *types.Package, name string) []*ast.Ident {
+	local := ""
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil &&
+			path == pkg.Path() {
+			local = pkg.Name()
+			if spec.Name != nil {
+				local = spec.Name.Name
+			}
+		}
+	}
+	if local == "" || local == "." || local == "_" {
+		return nil
+	}
+	result := []*ast.Ident{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok && sel.Sel.Name == name {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == local &&
+				x.Obj == nil {
+				result = append(result, sel.Sel)
+			}
+		}
+		return true
+	})
+	return result
+}
@@ -0,0 +1,205 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the pass of the Rename refactoring that renames the
+// test, benchmark, and example functions named after a renamed declaration
+// (e.g., TestFoo, BenchmarkFoo, ExampleFoo, and ExampleFoo_suffix when Foo is
+// renamed).  These are associated with the declaration only by naming
+// convention; godoc uses the names to attach examples to the declarations
+// they document.  Every such edit is recorded as an OccurrenceTestFunction,
+// so it can be excluded after the changes are previewed.
+
+package refactoring
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/godoctor/godoctor/analysis/names"
+	"github.com/godoctor/godoctor/text"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// testFuncPrefixes are the prefixes of the names of functions in _test.go
+// files that are run by "go test" (see "go help testfunc").
+var testFuncPrefixes = []string{"Test", "Benchmark", "Example"}
+
+// renameTestFuncs renames the test, benchmark, and example functions in the
+// package declaring the given object (and its external test package) whose
+// names refer to the object: for a package-level name Foo, these are TestFoo,
+// BenchmarkFoo, and ExampleFoo, optionally followed by an underscore and a
+// suffix (e.g., ExampleFoo_second or ExampleFoo_Method); for a method M of a
+// type T, these are TestT_M, BenchmarkT_M, and ExampleT_M (and similarly
+// with a suffix).  Functions whose new names would conflict with an existing
+// declaration, or would no longer be run by "go test", are not renamed.
+func (r *Rename) renameTestFuncs(obj types.Object) {
+	if obj == nil || obj.Pkg() == nil || !obj.Pos().IsValid() {
+		return
+	}
+	oldBase, newBase := obj.Name(), r.newName
+	if obj.Parent() != obj.Pkg().Scope() {
+		typeName := memberTypeName(obj)
+		if _, isFunc := obj.(*types.Func); !isFunc || typeName == "" {
+			return
+		}
+		oldBase = typeName + "_" + oldBase
+		newBase = typeName + "_" + newBase
+	}
+
+	path := obj.Pkg().Path()
+	renamed := map[token.Position]bool{}
+	for _, decl := range r.testFuncDecls(path) {
+		name := decl.ident.Name
+		if renamed[decl.key] || decl.ident.Pos() == obj.Pos() {
+			continue
+		}
+		prefix, rest := testFuncNameParts(name, oldBase)
+		if prefix == "" {
+			continue
+		}
+		renamed[decl.key] = true
+		newFuncName := prefix + newBase + rest
+		if !isTestFuncName(newFuncName, prefix) {
+			r.Log.Warnf("%s was not renamed to %s, since %s would "+
+				"not be run by \"go test\"", name, newFuncName,
+				newFuncName)
+			r.Log.AssociateNode(decl.ident)
+			continue
+		}
+		testObj := decl.pkg.TypesInfo.Defs[decl.ident]
+		if conflict := names.FindConflict(testObj, newFuncName); conflict != nil {
+			r.Log.Warnf("%s was not renamed to %s, since that would "+
+				"conflict with an existing declaration", name,
+				newFuncName)
+			r.Log.AssociatePos(conflict.Pos(), conflict.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+			r.Log.AddRelatedNode("Function not renamed", decl.ident)
+			continue
+		}
+		r.Log.Infof("Renaming %s also renames %s, which is named after it",
+			obj.Name(), name)
+		r.Log.AssociateNode(decl.ident)
+		r.addTestFuncOccurrences(testObj, name, newFuncName, obj.Name())
+	}
+}
+
+// addTestFuncOccurrences renames the declaration of the given test function,
+// along with any references to it, recording them as OccurrenceTestFunctions.
+// Only _test.go files can refer to a test function; the others are skipped,
+// since the test main package that "go test" generates (which is loaded with
+// the program) refers to every test function.
+func (r *Rename) addTestFuncOccurrences(testObj types.Object, name, newName, renamedName string) {
+	idents := names.FindOccurrences(testObj, r.Program)
+	sorted := make([]*ast.Ident, 0, len(idents))
+	for id := range idents {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Pos() < sorted[j].Pos() })
+	for _, id := range sorted {
+		pos := r.Program.Fset.Position(id.Pos())
+		if !isTestFile(pos.Filename) || isInGoRoot(pos.Filename) {
+			continue
+		}
+		extent := &text.Extent{Offset: pos.Offset, Length: len(id.Name)}
+		if err := r.addOccurrence(pos.Filename, extent, newName,
+			OccurrenceTestFunction, fmt.Sprintf("%s is named after %s",
+				name, renamedName)); err != nil {
+			r.Log.Errorf("%s: %v", pos.Filename, err)
+		}
+	}
+}
+
+// A testFuncDecl is a package-level function declared in a _test.go file.
+type testFuncDecl struct {
+	ident *ast.Ident
+	pkg   *packages.Package
+	// The position of the declaration, which is shared by the variants of
+	// a package that are loaded when tests are (see names.FindOccurrences)
+	key token.Position
+}
+
+// testFuncDecls returns the package-level functions declared in _test.go files
+// in the package with the given path and its external test package, sorted by
+// position.
+func (r *Rename) testFuncDecls(path string) []testFuncDecl {
+	result := []testFuncDecl{}
+	for _, pkg := range r.Program.AllPackages {
+		if pkg.Types == nil || pkg.TypesInfo == nil ||
+			(pkg.Types.Path() != path && pkg.Types.Path() != path+"_test") {
+			continue
+		}
+		for _, file := range pkg.Syntax {
+			filename := r.Program.Fset.Position(file.Pos()).Filename
+			if !isTestFile(filename) {
+				continue
+			}
+			for _, decl := range file.Decls {
+				funcDecl, ok := decl.(*ast.FuncDecl)
+				if !ok || funcDecl.Recv != nil {
+					continue
+				}
+				result = append(result, testFuncDecl{
+					ident: funcDecl.Name,
+					pkg:   pkg,
+					key:   r.Program.Fset.Position(funcDecl.Name.Pos()),
+				})
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		ki, kj := result[i].key, result[j].key
+		if ki.Filename != kj.Filename {
+			return ki.Filename < kj.Filename
+		}
+		return ki.Offset < kj.Offset
+	})
+	return result
+}
+
+// testFuncNameParts determines whether the given function name is the name
+// of a test, benchmark, or example function named after the given base name
+// (see renameTestFuncs).  If so, it returns the function's prefix (e.g.,
+// "Example") and the suffix following the base name (e.g., "" or "_second");
+// otherwise, it returns "" for both.
+func testFuncNameParts(name, base string) (prefix, rest string) {
+	for _, prefix := range testFuncPrefixes {
+		if !strings.HasPrefix(name, prefix+base) ||
+			!isTestFuncName(name, prefix) {
+			continue
+		}
+		rest := name[len(prefix+base):]
+		if rest == "" || strings.HasPrefix(rest, "_") {
+			return prefix, rest
+		}
+	}
+	return "", ""
+}
+
+// isTestFuncName returns true if "go test" treats a function with the given
+// name as a function of the kind with the given prefix: that is, if the name
+// consists of the prefix followed by a string that does not begin with a
+// lowercase letter.
+func isTestFuncName(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	ch, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(ch)
+}
+
+// isTestFile returns true if the given file is a _test.go file.
+func isTestFile(filename string) bool {
+	return strings.HasSuffix(filepath.Base(filename), "_test.go")
+}
@@ -0,0 +1,193 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// The refactoring tests in testdata load only the files named in the scope,
+// so _test.go files are not loaded; this test loads the whole package.
+func TestRenameTestFuncs(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	dir := filepath.Join(gopath, "src", "example.com", "greet")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"greet.go": `package greet
+
+import "fmt"
+
+func Greet(name string) {
+	fmt.Println("Hello,", name)
+}
+
+type Greeter struct{}
+
+func (Greeter) Say(name string) {
+	fmt.Println("Hello,", name)
+}
+`,
+		"greet_test.go": `package greet
+
+import "testing"
+
+var tests = []func(*testing.T){TestGreet, TestGreeting}
+
+func TestGreet(t *testing.T) {
+	Greet("test")
+}
+
+func TestGreeting(t *testing.T) {
+}
+
+func BenchmarkGreet(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Greet("benchmark")
+	}
+}
+
+func TestGreeter_Say(t *testing.T) {
+	Greeter{}.Say("test")
+}
+
+func TestGreeter_Speak(t *testing.T) {
+}
+`,
+		"example_test.go": `package greet_test
+
+import "example.com/greet"
+
+func ExampleGreet() {
+	greet.Greet("example")
+	// Output: Hello, example
+}
+
+func ExampleGreet_second() {
+	greet.Greet("second")
+	// Output: Hello, second
+}
+
+func ExampleGreeter_Say() {
+	greet.Greeter{}.Say("example")
+	// Output: Hello, example
+}
+`,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mainFile := filepath.Join(dir, "greet.go")
+
+	rename := func(line, col int, newName string) *Result {
+		result := new(Rename).Run(&Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Scope:      []string{"example.com/greet"},
+			Selection: &text.LineColSelection{
+				Filename:  mainFile,
+				StartLine: line, StartCol: col,
+				EndLine: line, EndCol: col,
+			},
+			Args:       []interface{}{newName},
+			GoPath:     gopath,
+			ModulesOff: true,
+		})
+		if result.Log.ContainsErrors() {
+			t.Fatal(result.Log)
+		}
+		return result
+	}
+	output := func(result *Result, filename string) string {
+		path := filepath.Join(dir, filename)
+		edits, ok := result.Edits[path]
+		if !ok {
+			return files[filename]
+		}
+		output, err := filesystem.ApplyEdits(edits, &filesystem.LocalFileSystem{}, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(output)
+	}
+	testFuncs := func(result *Result) int {
+		count := 0
+		for _, occ := range result.Occurrences {
+			if occ.Kind == OccurrenceTestFunction {
+				count++
+			}
+		}
+		return count
+	}
+
+	// Greet: TestGreeting is not named after Greet, so it is unchanged
+	result := rename(5, 6, "Welcome")
+	actual := output(result, "greet_test.go")
+	for _, s := range []string{
+		"[]func(*testing.T){TestWelcome, TestGreeting}",
+		"func TestWelcome(t *testing.T) {\n\tWelcome(",
+		"func TestGreeting(",
+		"func BenchmarkWelcome(",
+	} {
+		if !strings.Contains(actual, s) {
+			t.Errorf("Expected greet_test.go to contain %q:\n%s", s, actual)
+		}
+	}
+	actual = output(result, "example_test.go")
+	for _, s := range []string{
+		"func ExampleWelcome() {",
+		"func ExampleWelcome_second() {",
+		"func ExampleGreeter_Say() {",
+	} {
+		if !strings.Contains(actual, s) {
+			t.Errorf("Expected example_test.go to contain %q:\n%s", s, actual)
+		}
+	}
+	if count := testFuncs(result); count != 5 {
+		t.Errorf("Expected 5 test function occurrences; got %d", count)
+	}
+	result.ExcludeOccurrences(OccurrenceTestFunction)
+	if actual := output(result, "example_test.go"); !strings.Contains(actual,
+		"func ExampleGreet() {\n\tgreet.Welcome(") {
+		t.Errorf("Test functions should not have been renamed:\n%s", actual)
+	}
+
+	// Greet to greet: Testgreet would not be a test
+	result = rename(5, 6, "greet")
+	if count := testFuncs(result); count != 0 {
+		t.Errorf("Expected no test function occurrences; got %d", count)
+	}
+	if !strings.Contains(result.Log.String(), "would not be run") {
+		t.Errorf("Expected a warning about Testgreet:\n%s", result.Log)
+	}
+
+	// Greeter.Say: TestGreeter_Speak already exists
+	result = rename(11, 16, "Speak")
+	if actual := output(result, "greet_test.go"); !strings.Contains(actual,
+		"func TestGreeter_Say(") {
+		t.Errorf("TestGreeter_Say should not have been renamed:\n%s", actual)
+	}
+	if actual := output(result, "example_test.go"); !strings.Contains(actual,
+		"func ExampleGreeter_Speak() {") {
+		t.Errorf("ExampleGreeter_Say should have been renamed:\n%s", actual)
+	}
+	if !strings.Contains(result.Log.String(), "conflict") {
+		t.Errorf("Expected a warning about TestGreeter_Speak:\n%s", result.Log)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines SafetyLevel, which summarizes the log of a refactoring's
+// Result so that automated tools can decide whether to apply its changes
+// without review.
+
+package refactoring
+
+// A SafetyLevel indicates how confident a refactoring is that its changes
+// preserve the behavior of the program.  It is computed from the log entries
+// in a Result (see Result.Safety).
+type SafetyLevel int
+
+const (
+	// No errors or warnings were reported
+	Safe SafetyLevel = iota
+	// Warnings were reported (or some other uncertainty was noted, e.g.,
+	// words in comments that were not renamed): the changes preserve
+	// behavior only if the assumptions described in the log hold
+	BehaviorPreservingUnderAssumptions
+	// Errors were reported: the changes may not compile, or may change
+	// the program's behavior (e.g., extracting code containing a return
+	// statement)
+	Unsafe
+)
+
+// Codes of entries that indicate that a refactoring made an assumption, even
+// if their severity is Info
+var assumptionCodes = map[string]bool{
+	CodeRenameCommentWord: true,
+}
+
+// String returns the name of the safety level (e.g., "Safe"), which drivers
+// can display or use in machine-readable output.
+func (s SafetyLevel) String() string {
+	switch s {
+	case Safe:
+		return "Safe"
+	case BehaviorPreservingUnderAssumptions:
+		return "BehaviorPreservingUnderAssumptions"
+	default:
+		return "Unsafe"
+	}
+}
+
+// Safety returns the safety level of this Result, based on the most severe
+// entry in its log.  Any error makes a Result Unsafe; any warning, or any
+// entry with a code indicating that the refactoring made an assumption, makes
+// it BehaviorPreservingUnderAssumptions.  (Initial errors that a refactoring
+// demoted to warnings count as warnings, since the refactoring's analysis may
+// be incomplete.)  Automated tools may apply Safe results without review.
+func (r *Result) Safety() SafetyLevel {
+	level := Safe
+	if r.Log == nil {
+		return level
+	}
+	for _, entry := range r.Log.Entries {
+		switch {
+		case entry.Severity == Error:
+			return Unsafe
+		case entry.Severity == Warning || assumptionCodes[entry.Code]:
+			level = BehaviorPreservingUnderAssumptions
+		}
+	}
+	return level
+}
@@ -0,0 +1,31 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import "testing"
+
+func TestSafety(t *testing.T) {
+	result := &Result{}
+	assertEquals("Safe", result.Safety().String(), t)
+
+	result.Log = NewLog()
+	result.Log.Info("Informational message")
+	assertEquals("Safe", result.Safety().String(), t)
+
+	result.Log.Info("Comment word not renamed")
+	result.Log.AssociateCode(CodeRenameCommentWord)
+	assertEquals("BehaviorPreservingUnderAssumptions",
+		result.Safety().String(), t)
+
+	result.Log = NewLog()
+	result.Log.Warn("Warning")
+	assertEquals("BehaviorPreservingUnderAssumptions",
+		result.Safety().String(), t)
+
+	result.Log.Error("Code containing defer statements may change behavior")
+	result.Log.AssociateCode(CodeExtractDefer)
+	result.Log.Warn("Another warning")
+	assertEquals("Unsafe", result.Safety().String(), t)
+}
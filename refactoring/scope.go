@@ -0,0 +1,357 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines ScopeProviders, which determine the scope of a
+// refactoring in build environments where the GOPATH heuristic used by
+// guessScope does not work (e.g., Bazel monorepos).
+
+package refactoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// A ScopeProvider determines which packages to load when a refactoring is
+// invoked without an explicit scope.
+type ScopeProvider interface {
+	// Scope returns the patterns that must be loaded (passed as-is to
+	// go/packages) in order to refactor the given file, along with any
+	// environment variables (of the form key=value) that the loader needs
+	// in order to load them.
+	Scope(filename string) (scope []string, env []string, err error)
+}
+
+/* -=-=- JSON Scope Provider -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// A JSONScopeProvider determines the scope from a JSON file listing source
+// roots and the import paths they correspond to, e.g.,
+//     {
+//         "env": ["GOPACKAGESDRIVER=/path/to/gopackagesdriver"],
+//         "roots": [
+//             {"dir": "go/src", "importPath": "example.com/repo"}
+//         ]
+//     }
+// Relative directories are resolved with respect to the directory containing
+// the JSON file.  A file in go/src/a/b is in package example.com/repo/a/b.
+type JSONScopeProvider struct {
+	Env   []string     `json:"env"`
+	Roots []SourceRoot `json:"roots"`
+}
+
+// A SourceRoot maps a directory to the import path of the package in that
+// directory; packages in its subdirectories have corresponding import paths.
+type SourceRoot struct {
+	Dir        string `json:"dir"`
+	ImportPath string `json:"importPath"`
+}
+
+// NewJSONScopeProvider reads a JSONScopeProvider from the given file.
+func NewJSONScopeProvider(filename string) (*JSONScopeProvider, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := &JSONScopeProvider{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if len(p.Roots) == 0 {
+		return nil, fmt.Errorf("%s does not list any source roots",
+			filename)
+	}
+	base, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	for i, root := range p.Roots {
+		if root.Dir == "" || root.ImportPath == "" {
+			return nil, fmt.Errorf("%s: each source root must have "+
+				"a dir and an importPath", filename)
+		}
+		dir := filepath.FromSlash(root.Dir)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(base, dir)
+		}
+		p.Roots[i].Dir = filepath.Clean(dir)
+	}
+	return p, nil
+}
+
+// Scope returns the import path of the package containing the given file,
+// as determined by the source root that most closely encloses it.
+func (p *JSONScopeProvider) Scope(filename string) ([]string, []string, error) {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	dir := filepath.Dir(absFilename)
+
+	bestRoot, bestRel := -1, ""
+	for i, root := range p.Roots {
+		rel, err := filepath.Rel(root.Dir, dir)
+		if err != nil || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if bestRoot < 0 || len(root.Dir) > len(p.Roots[bestRoot].Dir) {
+			bestRoot, bestRel = i, rel
+		}
+	}
+	if bestRoot < 0 {
+		return nil, nil, fmt.Errorf("%s is not in any of the listed "+
+			"source roots", filename)
+	}
+
+	importPath := p.Roots[bestRoot].ImportPath
+	if bestRel != "." {
+		importPath = importPath + "/" + filepath.ToSlash(bestRel)
+	}
+	return []string{importPath}, p.Env, nil
+}
+
+/* -=-=- Bazel Scope Provider -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-= */
+
+// A BazelScopeProvider determines the scope by running "bazel query" to find
+// the targets whose srcs include the given file.  Targets are loaded by
+// label, so go/packages must be configured to use a driver that understands
+// Bazel labels (e.g., the gopackagesdriver from rules_go), either by setting
+// GOPACKAGESDRIVER in the environment or by setting Driver.
+type BazelScopeProvider struct {
+	// Path to the go/packages driver.  If this is empty, the
+	// GOPACKAGESDRIVER environment variable is used as-is.
+	Driver string
+	// Runs the given command in the given directory, returning its
+	// standard output.  If this is nil, the command is run with os/exec.
+	Command func(dir string, name string, args ...string) ([]byte, error)
+}
+
+// Scope returns the labels of the Bazel targets that contain the given file.
+func (p *BazelScopeProvider) Scope(filename string) ([]string, []string, error) {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	workspace := findEnclosingDir(filepath.Dir(absFilename), "",
+		"MODULE.bazel", "WORKSPACE", "WORKSPACE.bazel")
+	if workspace == "" {
+		return nil, nil, fmt.Errorf("%s is not in a Bazel workspace",
+			filename)
+	}
+	pkgDir := findEnclosingDir(filepath.Dir(absFilename), workspace,
+		"BUILD", "BUILD.bazel")
+	if pkgDir == "" {
+		return nil, nil, fmt.Errorf("%s is not in a Bazel package",
+			filename)
+	}
+
+	pkg, err := filepath.Rel(workspace, pkgDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pkg == "." {
+		pkg = ""
+	}
+	target, err := filepath.Rel(pkgDir, absFilename)
+	if err != nil {
+		return nil, nil, err
+	}
+	label := fmt.Sprintf("//%s:%s",
+		filepath.ToSlash(pkg), filepath.ToSlash(target))
+	query := fmt.Sprintf("attr(srcs, '%s', //%s:*)",
+		label, filepath.ToSlash(pkg))
+
+	command := p.Command
+	if command == nil {
+		command = runCommand
+	}
+	output, err := command(workspace, "bazel", "query", "--output=label", query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bazel query %s: %v", query, err)
+	}
+
+	scope := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			scope = append(scope, line)
+		}
+	}
+	if len(scope) == 0 {
+		return nil, nil, fmt.Errorf("No Bazel target contains %s",
+			label)
+	}
+
+	var env []string
+	if p.Driver != "" {
+		env = []string{"GOPACKAGESDRIVER=" + p.Driver}
+	}
+	return scope, env, nil
+}
+
+/* -=-=- Scope Filters -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// filterScope expands the package patterns in the given scope (e.g., ./...)
+// and returns the import paths of the packages that match the include and
+// exclude filters (see matchesImportPathPrefix).  If include is empty, all
+// packages not excluded are returned.  Source files in the scope are
+// returned unchanged, since they do not have meaningful import paths.
+func filterScope(lconfig *packages.Config, scope, include, exclude []string) ([]string, error) {
+	result := []string{}
+	patterns := []string{}
+	for _, pattern := range scope {
+		if strings.HasSuffix(pattern, ".go") {
+			result = append(result, pattern)
+		} else {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) > 0 {
+		cfg := *lconfig
+		cfg.Mode = packages.NeedName
+		pkgs, err := packages.Load(&cfg, patterns...)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range pkgs {
+			if (len(include) == 0 || matchesImportPathPrefix(pkg.PkgPath, include)) &&
+				!matchesImportPathPrefix(pkg.PkgPath, exclude) {
+				result = append(result, pkg.PkgPath)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("No packages in the scope (%s) match the "+
+			"scope filters", strings.Join(scope, " "))
+	}
+	return result, nil
+}
+
+// matchesImportPathPrefix returns true if the given import path begins with
+// one of the given prefixes.  A prefix ending with a slash also matches the
+// package whose import path is the prefix without the slash (e.g.,
+// github.com/org/legacy/ matches github.com/org/legacy and its
+// subpackages).
+func matchesImportPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) ||
+			path == strings.TrimSuffix(prefix, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// findEnclosingDir returns the nearest directory that is dir or one of its
+// ancestors (but not an ancestor of stop, if stop is non-empty) and that
+// contains a file with one of the given names, or "" if there is none.
+func findEnclosingDir(dir, stop string, names ...string) string {
+	for {
+		for _, name := range names {
+			if fi, err := os.Stat(filepath.Join(dir, name)); err == nil && !fi.IsDir() {
+				return dir
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || dir == stop {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// runCommand runs the given command in the given directory, returning its
+// standard output.
+func runCommand(dir string, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return output, fmt.Errorf("%v: %s", err,
+			strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return output, err
+}
+
+/* -=-=- Multiple Modules -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-= */
+
+// A scopeRoot is a set of scope patterns that are loaded together, from the
+// root directory of the module containing them.
+type scopeRoot struct {
+	dir      string
+	patterns []string
+}
+
+// scopeRoots divides the given scope among the modules containing its
+// patterns, so that each module can be loaded separately (the go command
+// can only load packages from a single main module).  Patterns that are
+// directories or files (e.g., ./... or /src/lib/...) are assigned to the
+// module containing them and made absolute; other patterns (e.g., import
+// paths) are loaded from dir, the directory in which the program would
+// otherwise be loaded.  If the scope does not span several modules, scopeRoots
+// returns nil, and the scope should be loaded as usual.
+func scopeRoots(dir string, scope []string) []scopeRoot {
+	base := dir
+	if base == "" {
+		if cwd, err := os.Getwd(); err == nil {
+			base = cwd
+		}
+	}
+	defaultRoot := findModuleRoot(base)
+
+	roots := []scopeRoot{}
+	index := map[string]int{}
+	add := func(root, pattern string) {
+		if _, ok := index[root]; !ok {
+			index[root] = len(roots)
+			roots = append(roots, scopeRoot{dir: root})
+		}
+		i := index[root]
+		roots[i].patterns = append(roots[i].patterns, pattern)
+	}
+	for _, pattern := range scope {
+		if !isPathPattern(pattern) {
+			add(defaultRoot, pattern)
+			continue
+		}
+		abs := pattern
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(base, abs)
+		}
+		path := strings.TrimSuffix(abs, "...")
+		if strings.HasSuffix(path, ".go") {
+			path = filepath.Dir(path)
+		}
+		root := findModuleRoot(filepath.Clean(path))
+		if root == "" {
+			root = defaultRoot
+		}
+		add(root, abs)
+	}
+	if len(roots) < 2 {
+		return nil
+	}
+	for i := range roots {
+		if roots[i].dir == "" {
+			roots[i].dir = dir
+		}
+	}
+	return roots
+}
+
+// isPathPattern returns true if the given scope pattern names a file or
+// directory, rather than an import path.
+func isPathPattern(pattern string) bool {
+	slash := filepath.ToSlash(pattern)
+	return filepath.IsAbs(pattern) || strings.HasSuffix(pattern, ".go") ||
+		slash == "." || slash == ".." ||
+		strings.HasPrefix(slash, "./") || strings.HasPrefix(slash, "../")
+}
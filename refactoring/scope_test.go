@@ -0,0 +1,233 @@
+// Copyright 2015 Auburn University. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestJSONScopeProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "roots.json")
+	if err := ioutil.WriteFile(config, []byte(`{
+		"env": ["GOPACKAGESDRIVER=driver"],
+		"roots": [
+			{"dir": "go", "importPath": "example.com/repo"},
+			{"dir": "go/third_party/x", "importPath": "golang.org/x"}
+		]
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewJSONScopeProvider(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]string{
+		"go/main.go":                     "example.com/repo",
+		"go/a/b/b.go":                    "example.com/repo/a/b",
+		"go/third_party/x/tools/tool.go": "golang.org/x/tools",
+		"go/third_party/y/y.go":          "example.com/repo/third_party/y",
+	} {
+		scope, env, err := p.Scope(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(scope) != 1 || scope[0] != expected {
+			t.Errorf("Scope of %s should be %s, not %v",
+				file, expected, scope)
+		}
+		if len(env) != 1 || env[0] != "GOPACKAGESDRIVER=driver" {
+			t.Errorf("Incorrect environment: %v", env)
+		}
+	}
+
+	if _, _, err := p.Scope(filepath.Join(dir, "other", "x.go")); err == nil {
+		t.Error("File outside source roots should not have a scope")
+	}
+}
+
+func TestBazelScopeProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{"WORKSPACE", "a/BUILD.bazel", "a/b/c/c.go"} {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var cmdDir, cmdLine string
+	p := &BazelScopeProvider{
+		Driver: "driver",
+		Command: func(dir string, name string, args ...string) ([]byte, error) {
+			cmdDir = dir
+			cmdLine = name + " " + strings.Join(args, " ")
+			return []byte("//a:go_default_library\n//a:go_default_test\n"), nil
+		},
+	}
+	scope, env, err := p.Scope(filepath.Join(dir, "a", "b", "c", "c.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmdDir != dir {
+		t.Errorf("bazel should run in the workspace root, not %s", cmdDir)
+	}
+	expected := "bazel query --output=label attr(srcs, '//a:b/c/c.go', //a:*)"
+	if cmdLine != expected {
+		t.Errorf("Expected command\n%s\nbut found\n%s", expected, cmdLine)
+	}
+	if strings.Join(scope, " ") != "//a:go_default_library //a:go_default_test" {
+		t.Errorf("Incorrect scope: %v", scope)
+	}
+	if len(env) != 1 || env[0] != "GOPACKAGESDRIVER=driver" {
+		t.Errorf("Incorrect environment: %v", env)
+	}
+
+	if _, _, err := p.Scope(filepath.Join(os.TempDir(), "x.go")); err == nil {
+		t.Error("File outside a workspace should not have a scope")
+	}
+}
+
+func TestFilterScope(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	for _, pkg := range []string{"org/a", "org/legacy", "org/legacy/b", "other/c"} {
+		dir := filepath.Join(gopath, "src", "example.com", filepath.FromSlash(pkg))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		src := "package " + filepath.Base(dir) + "\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "x.go"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lconfig := &packages.Config{
+		Env: append(os.Environ(), "GOPATH="+gopath, "GO111MODULE=off"),
+		Dir: filepath.Join(gopath, "src", "example.com"),
+	}
+
+	tests := []struct {
+		include, exclude []string
+		expected         string
+	}{
+		{nil, nil, "example.com/org/a example.com/org/legacy example.com/org/legacy/b example.com/other/c"},
+		{[]string{"example.com/org/"}, nil, "example.com/org/a example.com/org/legacy example.com/org/legacy/b"},
+		{[]string{"example.com/org/"}, []string{"example.com/org/legacy/"}, "example.com/org/a"},
+		{nil, []string{"example.com/org/legacy/b", "example.com/other"}, "example.com/org/a example.com/org/legacy"},
+		{nil, nil, "example.com/org/a example.com/org/legacy example.com/org/legacy/b example.com/other/c main.go"},
+	}
+	for i, test := range tests {
+		scope := []string{"./..."}
+		if i == len(tests)-1 {
+			scope = []string{"main.go", "./..."}
+		}
+		result, err := filterScope(lconfig, scope, test.include, test.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(result)
+		if actual := strings.Join(result, " "); actual != test.expected {
+			t.Errorf("Include %v, exclude %v: expected %s, got %s",
+				test.include, test.exclude, test.expected, actual)
+		}
+	}
+
+	_, err = filterScope(lconfig, []string{"./..."}, []string{"example.com/none/"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "No packages") {
+		t.Errorf("Expected an error when no packages match (%v)", err)
+	}
+}
+
+func TestMultiModuleScope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The app module uses the lib module, but there is no go.work file
+	// including both, so they cannot be loaded together
+	for file, contents := range map[string]string{
+		"lib/go.mod": "module example.com/lib\n\ngo 1.14\n",
+		"lib/lib.go": "package lib\n\nfunc Hello() string { return \"hi\" }\n",
+		"app/go.mod": "module example.com/app\n\ngo 1.14\n\n" +
+			"require example.com/lib v0.0.0\n\n" +
+			"replace example.com/lib => ../lib\n",
+		"app/main.go": "package main\n\nimport \"example.com/lib\"\n\n" +
+			"func main() { println(lib.Hello()) }\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	libDir, appDir := filepath.Join(dir, "lib"), filepath.Join(dir, "app")
+
+	scope := []string{"./lib/...", filepath.Join(appDir, "main.go"), "fmt"}
+	roots := scopeRoots(dir, scope)
+	if len(roots) != 3 ||
+		roots[0].dir != libDir || roots[0].patterns[0] != filepath.Join(libDir, "...") ||
+		roots[1].dir != appDir || roots[1].patterns[0] != scope[1] ||
+		roots[2].dir != dir || roots[2].patterns[0] != "fmt" {
+		t.Errorf("Incorrect scope roots: %v", roots)
+	}
+	if roots := scopeRoots(dir, []string{"./lib/...", "fmt"}); len(roots) != 2 {
+		t.Errorf("Incorrect scope roots: %v", roots)
+	}
+	if roots := scopeRoots(libDir, []string{"./...", "fmt"}); roots != nil {
+		t.Errorf("A single module should be loaded as usual: %v", roots)
+	}
+
+	// Rename lib.Hello from its use in the app module
+	mainFile := filepath.Join(appDir, "main.go")
+	result := new(Rename).Run(&Config{
+		FileSystem: &filesystem.LocalFileSystem{},
+		Scope:      []string{"./lib/...", "./app/..."},
+		Dir:        dir,
+		Selection: &text.LineColSelection{
+			Filename:  mainFile,
+			StartLine: 5, StartCol: 27,
+			EndLine: 5, EndCol: 27,
+		},
+		Args: []interface{}{"Greet"},
+	})
+	if result.Log.ContainsErrors() {
+		t.Fatal(result.Log)
+	}
+	for _, file := range []string{mainFile, filepath.Join(libDir, "lib.go")} {
+		if edits, ok := result.Edits[file]; !ok || edits.Len() != 1 {
+			t.Errorf("Expected one edit in %s", file)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines SidecarScanners, which find references to Go identifiers
+// in files that are not Go source code (e.g., YAML configuration files that
+// name handler functions, or SQL migrations that embed type names), so that
+// the Rename refactoring can keep them consistent.
+
+package refactoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+// A SidecarScanner finds references to a Go identifier outside of Go source
+// code.  When a package-level identifier, method, or field is renamed, the
+// occurrences returned by each scanner in Config.SidecarScanners are renamed
+// as well.
+type SidecarScanner interface {
+	// Occurrences returns the extents of references to the given object,
+	// keyed by (absolute) filename.  Each extent must cover exactly the
+	// text to replace with the object's new name.
+	Occurrences(obj types.Object) (map[string][]*text.Extent, error)
+}
+
+// identifierPattern matches a Go identifier.  It is the default pattern for
+// a RegexpScanner.
+const identifierPattern = `[\p{L}_][\p{L}\p{N}_]*`
+
+/* -=-=- Regexp Scanner -=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=- */
+
+// A RegexpScanner is a SidecarScanner that searches the files matching a set
+// of glob patterns for a regular expression.  A match refers to an object if
+// the text matched by the subexpression named "name" (or the entire match,
+// if there is no such subexpression) is the object's name.
+type RegexpScanner struct {
+	// Glob patterns (see filepath.Match) for the files to search.
+	Files []string `json:"files"`
+	// The regular expression to search for.  If this is empty, every Go
+	// identifier in the files is a potential reference.
+	Pattern string `json:"pattern"`
+	// If non-empty, only objects declared in the package with this import
+	// path are searched for.
+	Package string `json:"package"`
+
+	re *regexp.Regexp
+}
+
+// ReadSidecarScanners reads a list of RegexpScanners from a JSON file, e.g.,
+//
+//	{
+//	    "scanners": [
+//	        {"files": ["config/*.yaml"], "pattern": "handler: (?P<name>\\w+)"},
+//	        {"files": ["migrations/*.sql"], "package": "example.com/model"}
+//	    ]
+//	}
+//
+// Relative glob patterns are resolved with respect to the directory
+// containing the JSON file.
+func ReadSidecarScanners(filename string) ([]SidecarScanner, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Scanners []*RegexpScanner `json:"scanners"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	base, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	result := []SidecarScanner{}
+	for _, s := range config.Scanners {
+		if len(s.Files) == 0 {
+			return nil, fmt.Errorf("%s: each scanner must list the "+
+				"files to search", filename)
+		}
+		for i, pattern := range s.Files {
+			pattern = filepath.FromSlash(pattern)
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(base, pattern)
+			}
+			s.Files[i] = pattern
+		}
+		if err := s.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// compile compiles the scanner's regular expression.
+func (s *RegexpScanner) compile() error {
+	pattern := s.Pattern
+	if pattern == "" {
+		pattern = identifierPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %s: %v", pattern, err)
+	}
+	s.re = re
+	return nil
+}
+
+// Occurrences returns the extents of the matches that refer to the given
+// object in the files matching the scanner's glob patterns.  Go source files
+// are not searched.
+func (s *RegexpScanner) Occurrences(obj types.Object) (map[string][]*text.Extent, error) {
+	if s.re == nil {
+		if err := s.compile(); err != nil {
+			return nil, err
+		}
+	}
+	if s.Package != "" && (obj.Pkg() == nil || obj.Pkg().Path() != s.Package) {
+		return nil, nil
+	}
+
+	set := map[string]struct{}{}
+	for _, pattern := range s.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern %s: %v",
+				pattern, err)
+		}
+		for _, filename := range matches {
+			if abs, err := filepath.Abs(filename); err == nil {
+				filename = abs
+			}
+			if !strings.HasSuffix(filename, ".go") {
+				set[filename] = struct{}{}
+			}
+		}
+	}
+	filenames := []string{}
+	for filename := range set {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	group := 0
+	for i, name := range s.re.SubexpNames() {
+		if name == "name" {
+			group = i
+		}
+	}
+
+	result := map[string][]*text.Extent{}
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range s.re.FindAllSubmatchIndex(data, -1) {
+			start, end := match[2*group], match[2*group+1]
+			if start >= 0 && string(data[start:end]) == obj.Name() {
+				result[filename] = append(result[filename],
+					&text.Extent{Offset: start, Length: end - start})
+			}
+		}
+	}
+	return result, nil
+}
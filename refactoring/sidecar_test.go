@@ -0,0 +1,150 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestReadSidecarScanners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "sidecar.json")
+	write := func(contents string) {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"scanners": [{"files": ["config/*.yaml", "/abs/*.sql"], "package": "a"}]}`)
+	scanners, err := ReadSidecarScanners(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := scanners[0].(*RegexpScanner)
+	if len(scanners) != 1 || s.Package != "a" ||
+		s.Files[0] != filepath.Join(dir, "config", "*.yaml") ||
+		s.Files[1] != filepath.FromSlash("/abs/*.sql") {
+		t.Fatalf("Incorrect scanners: %v", scanners)
+	}
+
+	for _, contents := range []string{
+		`{"scanners": [{"pattern": "x"}]}`,
+		`{"scanners": [{"files": ["*.yaml"], "pattern": "("}]}`,
+		`{"scanners": `,
+	} {
+		write(contents)
+		if _, err := ReadSidecarScanners(filename); err == nil {
+			t.Errorf("%s should have been rejected", contents)
+		}
+	}
+}
+
+func TestRenameSidecarOccurrences(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	dir := filepath.Join(gopath, "src", "example.com", "app")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"main.go": `package main
+
+func HandleIndex() {}
+
+func main() {
+	HandleIndex := 1
+	_ = HandleIndex
+}
+`,
+		"routes.yaml": `- path: /
+  handler: HandleIndex
+- path: /about
+  handler: HandleIndexPage # HandleIndex
+`,
+		"notes.txt": "HandleIndex is the handler for /\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mainFile := filepath.Join(dir, "main.go")
+
+	rename := func(line, col int, scanners ...SidecarScanner) *Result {
+		return new(Rename).Run(&Config{
+			FileSystem: &filesystem.LocalFileSystem{},
+			Scope:      []string{mainFile},
+			Selection: &text.LineColSelection{
+				Filename:  mainFile,
+				StartLine: line, StartCol: col,
+				EndLine: line, EndCol: col,
+			},
+			Args:            []interface{}{"Index"},
+			GoPath:          gopath,
+			ModulesOff:      true,
+			SidecarScanners: scanners,
+		})
+	}
+	output := func(result *Result, filename string) string {
+		path := filepath.Join(dir, filename)
+		edits, ok := result.Edits[path]
+		if !ok {
+			return files[filename]
+		}
+		output, err := filesystem.ApplyEdits(edits, &filesystem.LocalFileSystem{}, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(output)
+	}
+
+	scanners := []SidecarScanner{
+		&RegexpScanner{
+			Files:   []string{filepath.Join(dir, "*.yaml")},
+			Pattern: `handler: (?P<name>\w+)`,
+		},
+		&RegexpScanner{Files: []string{filepath.Join(dir, "*")}},
+		&RegexpScanner{Files: []string{filepath.Join(dir, "*.txt")}, Package: "other"},
+	}
+	result := rename(3, 6, scanners...)
+	if result.Log.ContainsErrors() {
+		t.Fatal(result.Log)
+	}
+	expected := strings.Replace(files["routes.yaml"], "HandleIndex\n", "Index\n", 1)
+	expected = strings.Replace(expected, "# HandleIndex", "# Index", 1)
+	if actual := output(result, "routes.yaml"); actual != expected {
+		t.Errorf("Expected routes.yaml to be\n%s\ngot\n%s", expected, actual)
+	}
+	expected = "Index is the handler for /\n"
+	if actual := output(result, "notes.txt"); actual != expected {
+		t.Errorf("Expected notes.txt to be\n%s\ngot\n%s", expected, actual)
+	}
+
+	// Local variables are not searched for
+	result = rename(6, 2, scanners...)
+	if result.Log.ContainsErrors() {
+		t.Fatal(result.Log)
+	}
+	if len(result.Edits) != 1 {
+		t.Errorf("Only main.go should have been edited; edited %d files",
+			len(result.Edits))
+	}
+}
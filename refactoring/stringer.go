@@ -0,0 +1,580 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines the Generate String Method refactoring, which adds a
+// String method to an integer type with constants, like the stringer tool
+// (golang.org/x/tools/cmd/stringer) but without go:generate.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/godoctor/godoctor/filesystem"
+	"github.com/godoctor/godoctor/text"
+)
+
+// A GenerateStringer refactoring adds a String method to a defined integer
+// type, which returns the name of the constant with the receiver's value.
+// The method is either added after the type's constants or written to a new
+// file.
+type GenerateStringer struct {
+	RefactoringBase
+	files    *sourceFiles
+	typeName *types.TypeName
+	basic    *types.Basic   // underlying type
+	consts   []*types.Const // sorted by value, without duplicate values
+	typeSpec *ast.TypeSpec  // declaration of the type
+	typeDecl *ast.GenDecl   // declaration containing typeSpec
+	typeFile *ast.File      // file containing the type declaration
+}
+
+func (r *GenerateStringer) Description() *Description {
+	return &Description{
+		Name:      "Generate String Method",
+		Synopsis:  "Generates a String method for a type's constants",
+		Usage:     "[<style> [<filename>]]",
+		HTMLDoc:   generateStringerDoc,
+		Multifile: true,
+		Params:    nil,
+		OptionalParams: []Parameter{{
+			Label:        "Style:",
+			Prompt:       "switch or index (default: index if the values are consecutive, otherwise switch).",
+			DefaultValue: "",
+		}, {
+			Label:        "File Name:",
+			Prompt:       "Name of a new file for the method (default: add it after the constants).",
+			DefaultValue: "",
+		}},
+		Hidden:  false,
+		Quality: Testing,
+	}
+}
+
+func (r *GenerateStringer) Run(config *Config) *Result {
+	r.Init(config, r.Description())
+	r.Log.ChangeInitialErrorsToWarnings()
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+	r.files = newSourceFiles(config.FileSystem, r.Filename, r.FileContents)
+
+	if r.SelectedNode == nil {
+		r.Log.Error("Please select a type declaration or constant.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		return &r.Result
+	}
+
+	if !r.findType() || !r.findConsts() {
+		return &r.Result
+	}
+	style := ""
+	if len(config.Args) > 0 {
+		style = strings.ToLower(strings.TrimSpace(config.Args[0].(string)))
+	}
+	useIndex, ok := r.useIndex(style)
+	if !ok {
+		return &r.Result
+	}
+	newFilename := ""
+	if len(config.Args) > 1 {
+		if name := strings.TrimSpace(config.Args[1].(string)); name != "" {
+			if newFilename = r.newFilename(name); newFilename == "" {
+				return &r.Result
+			}
+		}
+	}
+
+	typeFilename := r.Program.Fset.Position(r.typeFile.Pos()).Filename
+	if _, err := r.files.read(typeFilename); err != nil {
+		r.Log.Error(err)
+		return &r.Result
+	}
+	q := newTypeQualifier(r.typeName.Pkg(), r.typeFile)
+	if newFilename != "" {
+		q = newTypeQualifier(r.typeName.Pkg(), &ast.File{})
+	}
+	src := r.methodText(q, useIndex)
+	if r.Log.ContainsErrors() {
+		return &r.Result
+	}
+
+	if newFilename == "" {
+		r.addMethod(typeFilename, src, q)
+	} else {
+		contents, err := r.newFileContents(src, q, config.LicenseHeader)
+		if err != nil {
+			r.Log.Errorf("Unable to create %s: %v",
+				filepath.Base(newFilename), err)
+			return &r.Result
+		}
+		r.FSChanges = append(r.FSChanges, &filesystem.CreateFile{
+			Path:     newFilename,
+			Contents: contents,
+		})
+	}
+	r.UpdateLog(config, false)
+	return &r.Result
+}
+
+// findType finds the type for which to generate a String method: the type
+// declared by the selected type declaration, the type of the selected
+// constant, or the type named by the selected identifier.  It logs an error
+// and returns false if there is no such type, or if the type is not a
+// defined integer type without a String method.
+func (r *GenerateStringer) findType() bool {
+	info := r.SelectedNodePkg.TypesInfo
+	var obj types.Object
+	if id, ok := r.SelectedNode.(*ast.Ident); ok {
+		obj = info.ObjectOf(id)
+	}
+	if obj == nil {
+		if spec, _ := packageLevelTypeSpec(r.PathEnclosingSelection); spec != nil {
+			obj = info.Defs[spec.Name]
+		} else if spec := packageLevelValueSpec(r.PathEnclosingSelection); spec != nil {
+			obj = info.Defs[spec.Names[0]]
+		}
+	}
+	var named *types.Named
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		named, _ = obj.Type().(*types.Named)
+	case *types.Const:
+		named, _ = obj.Type().(*types.Named)
+	}
+	if named == nil || named.Obj().Pkg() != r.SelectedNodePkg.Types {
+		r.Log.Error("Please select the declaration of a type (or a " +
+			"constant of that type) declared in this package.")
+		r.Log.AssociatePos(r.SelectionStart, r.SelectionEnd)
+		r.Log.AssociateCode(CodeInvalidSelection)
+		return false
+	}
+	r.typeName = named.Obj()
+
+	basic, ok := named.Underlying().(*types.Basic)
+	if !ok || basic.Info()&types.IsInteger == 0 {
+		r.Log.Errorf("A String method can only be generated for an "+
+			"integer type, and the underlying type of %s is %s",
+			r.typeName.Name(), named.Underlying())
+		r.Log.AssociatePos(r.typeName.Pos(), r.typeName.Pos())
+		return false
+	}
+	r.basic = basic
+
+	if obj, _, _ := types.LookupFieldOrMethod(named, true, r.typeName.Pkg(), "String"); obj != nil {
+		r.Log.Errorf("%s already has a String method or field",
+			r.typeName.Name())
+		r.Log.AssociatePos(obj.Pos(), obj.Pos())
+		return false
+	}
+
+	_, path, _ := r.Program.PathEnclosingInterval(r.typeName.Pos(), r.typeName.Pos())
+	r.typeSpec, r.typeDecl = packageLevelTypeSpec(path)
+	if r.typeSpec == nil {
+		r.Log.Errorf("The declaration of %s could not be found",
+			r.typeName.Name())
+		return false
+	}
+	r.typeFile = path[len(path)-1].(*ast.File)
+	return true
+}
+
+// findConsts finds the package-level constants of the type, sorted by
+// value.  When several constants have the same value, only the first (in
+// source order) is kept.  It logs an error and returns false if there are no
+// constants of the type.
+func (r *GenerateStringer) findConsts() bool {
+	consts := []*types.Const{}
+	scope := r.typeName.Pkg().Scope()
+	for _, name := range scope.Names() {
+		if c, ok := scope.Lookup(name).(*types.Const); ok &&
+			types.Identical(c.Type(), r.typeName.Type()) {
+			consts = append(consts, c)
+		}
+	}
+	if len(consts) == 0 {
+		r.Log.Errorf("There are no constants of type %s",
+			r.typeName.Name())
+		r.Log.AssociatePos(r.typeName.Pos(), r.typeName.Pos())
+		return false
+	}
+	sort.Slice(consts, func(i, j int) bool {
+		return consts[i].Pos() < consts[j].Pos()
+	})
+	sort.SliceStable(consts, func(i, j int) bool {
+		return constant.Compare(consts[i].Val(), token.LSS, consts[j].Val())
+	})
+
+	r.consts = []*types.Const{}
+	for i, c := range consts {
+		if i == 0 || constant.Compare(c.Val(), token.NEQ, consts[i-1].Val()) {
+			r.consts = append(r.consts, c)
+		}
+	}
+	return true
+}
+
+// useIndex returns true if the String method should index into a string
+// containing the constants' names (like stringer) rather than using a switch
+// statement.  This is possible only if the constants' values are
+// consecutive.  It logs an error and returns false as its second result if
+// the style is invalid or the index style was requested but is not possible.
+func (r *GenerateStringer) useIndex(style string) (bool, bool) {
+	consecutive := true
+	for i := 1; i < len(r.consts); i++ {
+		next := constant.BinaryOp(r.consts[i-1].Val(), token.ADD,
+			constant.MakeInt64(1))
+		if constant.Compare(r.consts[i].Val(), token.NEQ, next) {
+			consecutive = false
+		}
+	}
+	switch style {
+	case "":
+		return consecutive, true
+	case "switch":
+		return false, true
+	case "index":
+		if !consecutive {
+			r.Log.Errorf("The values of the constants of type %s are "+
+				"not consecutive, so the index style cannot be used",
+				r.typeName.Name())
+			r.Log.AssociatePos(r.typeName.Pos(), r.typeName.Pos())
+			return false, false
+		}
+		return true, true
+	default:
+		r.Log.Errorf("The style must be \"switch\" or \"index\", not "+
+			"\"%s\"", style)
+		r.Log.AssociateCode(CodeInvalidArgs)
+		return false, false
+	}
+}
+
+// newFilename returns the absolute path of the file to create, or "" (after
+// logging an error) if the file cannot be created.
+func (r *GenerateStringer) newFilename(name string) string {
+	if !strings.HasSuffix(name, ".go") {
+		name += ".go"
+	}
+	typeFilename := r.Program.Fset.Position(r.typeFile.Pos()).Filename
+	if filepath.Base(name) != name || name == ".go" {
+		r.Log.Errorf("The new file name must be a file name, not a "+
+			"path: %s", name)
+		return ""
+	}
+	if strings.HasSuffix(name, "_test.go") !=
+		strings.HasSuffix(typeFilename, "_test.go") {
+		r.Log.Errorf("The method cannot be added to a test file for a "+
+			"type declared in a non-test file, or vice versa (%s)",
+			name)
+		return ""
+	}
+
+	path := filepath.Join(filepath.Dir(typeFilename), name)
+	if f, err := r.files.fileSystem.OpenFile(path); err == nil {
+		f.Close()
+		r.Log.Errorf("The file %s already exists; provide a different "+
+			"file name", name)
+		return ""
+	}
+	return path
+}
+
+// methodText returns the source code for the String method (and, for the
+// index style, the declarations it uses).
+func (r *GenerateStringer) methodText(q *typeQualifier, useIndex bool) string {
+	names := make([]string, len(r.consts))
+	for i, c := range r.consts {
+		names[i] = c.Name()
+	}
+	typeName := r.typeName.Name()
+	strconv := strconvQualifier(q)
+	// Use the same receiver name as the type's other methods, unless the
+	// method would need to refer to something else with that name
+	recv := existingReceiverName(r.typeName.Type().(*types.Named))
+	for _, name := range append(names, typeName, strings.TrimSuffix(strconv, ".")) {
+		if recv == name {
+			recv = ""
+		}
+	}
+	if recv == "" {
+		recv = receiverName(typeName)
+	}
+	if !useIndex {
+		return switchStringMethod(typeName, recv, names, r.basic, strconv)
+	}
+	for _, name := range []string{"_" + typeName + "_name", "_" + typeName + "_index"} {
+		if obj := r.typeName.Pkg().Scope().Lookup(name); obj != nil {
+			r.Log.Errorf("The name %s conflicts with an existing "+
+				"declaration", name)
+			r.Log.AssociatePos(obj.Pos(), obj.Pos())
+			r.Log.AssociateCode(CodeRenameConflict)
+		}
+	}
+	return indexStringMethod(typeName, recv, names, r.consts[0].Val(),
+		r.basic, strconv)
+}
+
+// addMethod adds an edit inserting the given source code after the last
+// constant declaration of the type in the file containing the type
+// declaration (or after the type declaration, if the file does not declare
+// any of the constants).
+func (r *GenerateStringer) addMethod(filename, src string, q *typeQualifier) {
+	if usesCgo(r.typeFile) {
+		r.Log.Errorf("%s cannot be modified because it uses cgo "+
+			"(import \"C\")", filepath.Base(filename))
+		return
+	}
+	after := r.typeDecl
+	for _, decl := range r.typeFile.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.CONST &&
+			decl.End() > after.End() && r.declaresConst(decl) {
+			after = decl
+		}
+	}
+	d := r.newDeclText(r.files, filename, r.typeFile, after)
+
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		r.Log.Error(err)
+		return
+	}
+	r.Edits[filename] = text.NewEditSet()
+	r.Edits[filename].SetBase(r.files.contents[filename])
+	r.Edits[filename].Add(&text.Extent{Offset: d.end},
+		"\n\n"+strings.TrimSuffix(string(formatted), "\n"))
+	r.addImportsToFile(filename, r.files.contents[filename], q)
+}
+
+// declaresConst returns true if the given declaration declares a constant of
+// the type.
+func (r *GenerateStringer) declaresConst(decl *ast.GenDecl) bool {
+	for _, spec := range decl.Specs {
+		for _, name := range spec.(*ast.ValueSpec).Names {
+			if c, ok := r.SelectedNodePkg.TypesInfo.Defs[name].(*types.Const); ok &&
+				types.Identical(c.Type(), r.typeName.Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newFileContents returns the contents of a new file containing the given
+// source code: header comments (e.g., copyright notice and build
+// constraints; see newFileHeader), a package clause, an import declaration
+// (if needed), and the source code.
+func (r *GenerateStringer) newFileContents(src string, q *typeQualifier, licenseHeader string) (string, error) {
+	var buf bytes.Buffer
+	header := r.newFileHeader(r.files, r.typeFile, licenseHeader)
+	if header != "" {
+		buf.WriteString(header)
+		buf.WriteString("\n\n")
+	}
+	fmt.Fprintf(&buf, "package %s\n\n", r.typeFile.Name.Name)
+	if len(q.missing) > 0 {
+		buf.WriteString("import \"strconv\"\n\n")
+	}
+	buf.WriteString(src)
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+	return string(formatted), nil
+}
+
+// packageLevelTypeSpec returns the type spec in the given path (as returned
+// by PathEnclosingInterval), along with the declaration containing it, if it
+// is part of a package-level type declaration, or nil otherwise.  If the
+// path ends at a declaration with a single spec, that spec is returned.
+func packageLevelTypeSpec(path []ast.Node) (*ast.TypeSpec, *ast.GenDecl) {
+	for i, node := range path {
+		switch node := node.(type) {
+		case *ast.GenDecl:
+			if node.Tok != token.TYPE || i+1 >= len(path) {
+				return nil, nil
+			}
+			if _, ok := path[i+1].(*ast.File); !ok {
+				return nil, nil
+			}
+			if len(node.Specs) == 1 {
+				return node.Specs[0].(*ast.TypeSpec), node
+			}
+			if i > 0 {
+				if spec, ok := path[i-1].(*ast.TypeSpec); ok {
+					return spec, node
+				}
+			}
+			return nil, nil
+		case *ast.FuncDecl, *ast.FuncLit:
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// strconvQualifier returns the qualifier ("strconv." or, for a dot import,
+// "") for references to package strconv in the file for which q was created.
+// If the file does not import strconv, q records that it is missing.
+func strconvQualifier(q *typeQualifier) string {
+	name := q.qualify(types.NewPackage("strconv", "strconv"))
+	if name == "" {
+		return ""
+	}
+	return name + "."
+}
+
+// receiverName returns the receiver name for a method on the given type: the
+// first letter of the type's name, in lowercase.
+func receiverName(typeName string) string {
+	first, _ := utf8.DecodeRuneInString(typeName)
+	return string(unicode.ToLower(first))
+}
+
+// existingReceiverName returns the receiver name used most often by the
+// existing methods of the given type (the earliest such name, if there is a
+// tie), so that new methods can follow the same convention.  It returns "" if
+// none of the type's methods has a named receiver.
+func existingReceiverName(named *types.Named) string {
+	result, count := "", map[string]int{}
+	for i := 0; i < named.NumMethods(); i++ {
+		name := named.Method(i).Type().(*types.Signature).Recv().Name()
+		if name == "" || name == "_" {
+			continue
+		}
+		count[name]++
+		if count[name] > count[result] {
+			result = name
+		}
+	}
+	return result
+}
+
+// formatIntText returns an expression that formats the given integer
+// expression as typeName(value), using the given qualifier for package
+// strconv.
+func formatIntText(typeName, expr string, basic *types.Basic, strconv string) string {
+	fn, conversion := "FormatInt", "int64"
+	if basic.Info()&types.IsUnsigned != 0 {
+		fn, conversion = "FormatUint", "uint64"
+	}
+	return fmt.Sprintf("\"%s(\" + %s%s(%s(%s), 10) + \")\"", typeName,
+		strconv, fn, conversion, expr)
+}
+
+// switchStringMethod returns the source code for a String method on the
+// given integer type, with the given receiver name, which uses a switch
+// statement to return the name of the constant (among the given names) whose
+// value is equal to the receiver's.
+func switchStringMethod(typeName, recv string, names []string, basic *types.Basic, strconv string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "func (%s %s) String() string {\n", recv, typeName)
+	fmt.Fprintf(&buf, "\tswitch %s {\n", recv)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "\tcase %s:\n\t\treturn %q\n", name, name)
+	}
+	fmt.Fprintf(&buf, "\t}\n\treturn %s\n}\n",
+		formatIntText(typeName, recv, basic, strconv))
+	return buf.String()
+}
+
+// indexStringMethod returns the source code for a String method on the given
+// integer type (with the given receiver name), whose constants have
+// consecutive values starting at min and the given names.  Like the methods generated by stringer, the method
+// slices a string containing all of the names, using an array of indices.
+func indexStringMethod(typeName, recv string, names []string, min constant.Value, basic *types.Basic, strconv string) string {
+	nameConst := "_" + typeName + "_name"
+	indexVar := "_" + typeName + "_index"
+
+	indices := []string{"0"}
+	length := 0
+	for _, name := range names {
+		length += len(name)
+		indices = append(indices, fmt.Sprint(length))
+	}
+	indexType := "uint8"
+	if length >= 1<<16 {
+		indexType = "uint32"
+	} else if length >= 1<<8 {
+		indexType = "uint16"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "const %s = %q\n\n", nameConst,
+		strings.Join(names, ""))
+	fmt.Fprintf(&buf, "var %s = [...]%s{%s}\n\n", indexVar, indexType,
+		strings.Join(indices, ", "))
+	fmt.Fprintf(&buf, "func (%s %s) String() string {\n", recv, typeName)
+	value := recv
+	switch constant.Sign(min) {
+	case 1:
+		fmt.Fprintf(&buf, "\t%s -= %s\n", recv, min.ExactString())
+		value = fmt.Sprintf("%s+%s", recv, min.ExactString())
+	case -1:
+		abs := constant.UnaryOp(token.SUB, min, 0).ExactString()
+		fmt.Fprintf(&buf, "\t%s += %s\n", recv, abs)
+		value = fmt.Sprintf("%s-%s", recv, abs)
+	}
+	cond := fmt.Sprintf("%s >= %s(len(%s)-1)", recv, typeName, indexVar)
+	if basic.Info()&types.IsUnsigned == 0 {
+		cond = fmt.Sprintf("%s < 0 || %s", recv, cond)
+	}
+	fmt.Fprintf(&buf, "\tif %s {\n\t\treturn %s\n\t}\n", cond,
+		formatIntText(typeName, value, basic, strconv))
+	fmt.Fprintf(&buf, "\treturn %s[%s[%s]:%s[%s+1]]\n}\n", nameConst,
+		indexVar, recv, indexVar, recv)
+	return buf.String()
+}
+
+const generateStringerDoc = `
+  <h4>Purpose</h4>
+  <p>The Generate String Method refactoring adds a <tt>String()</tt> method
+  to a defined integer type, which returns the name of the constant whose
+  value is equal to the receiver's.  It is similar to the
+  <tt>stringer</tt> tool, but it does not require <tt>go generate</tt>.</p>
+
+  <h4>Usage</h4>
+  <ol class="enum">
+    <li>Select the declaration of a type, or a constant of that type.</li>
+    <li>Activate the Generate String Method refactoring.</li>
+    <li>Optionally, choose a style: <tt>switch</tt> (a switch statement with
+    a case for each constant) or <tt>index</tt> (like <tt>stringer</tt>,
+    which slices a string containing the constants' names).  By default, the
+    index style is used if the constants' values are consecutive, and the
+    switch style is used otherwise.</li>
+    <li>Optionally, enter the name of a new file for the method (e.g.,
+    <tt>color_string.go</tt>).  By default, the method is added after the
+    type's constants.  A new file begins with the same copyright notice as
+    the file containing the type (or, if it has none, another file in the
+    package).</li>
+  </ol>
+
+  <p>If several constants have the same value, the first one (in source
+  order) is used.  Values without a constant are formatted as, e.g.,
+  <tt>Color(7)</tt>.  The method's receiver has the same name as the receivers
+  of the type's other methods (the most common one, if they differ); if the
+  type has no other methods, it is named after the first letter of the
+  type.</p>
+
+  <p>An error will be reported if:</p>
+  <ul>
+    <li>The type is not an integer type, or it already has a <tt>String</tt>
+    method.</li>
+    <li>There are no constants of the type.</li>
+    <li>The index style is requested, but the constants' values are not
+    consecutive.</li>
+    <li>The new file already exists.</li>
+  </ul>
+`
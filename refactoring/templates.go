@@ -0,0 +1,148 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines CodeTemplates, which determine the text of some of the
+// code that refactorings generate (e.g., doc comment stubs), so that a
+// project can make generated code follow its own style conventions.
+
+package refactoring
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Names of the templates that refactorings use to generate code.  A
+// CodeTemplates may override any of these.
+const (
+	// DocCommentTemplate generates the text of a doc comment stub, such as
+	// those added by the Add GoDoc refactoring.  It is executed with a
+	// DocCommentData.  Each line of its output becomes a line of the
+	// comment, which is then wrapped (see text.ReflowComment).
+	DocCommentTemplate = "docComment"
+	// ExtractedFuncTemplate generates the declaration of the function
+	// created by the Extract Function refactoring.  It is executed with an
+	// ExtractedFuncData.  The result is reformatted (with gofmt), so its
+	// whitespace need not be exact.
+	ExtractedFuncTemplate = "extractedFunc"
+)
+
+// CodeTemplates provides templates (see text/template) that override the
+// defaults used to generate code.  Since a *template.Template has a Lookup
+// method, a set of templates defined by {{define "name"}}...{{end}} actions
+// is a CodeTemplates.
+type CodeTemplates interface {
+	// Lookup returns the template with the given name (e.g.,
+	// DocCommentTemplate), or nil if the default template should be used.
+	Lookup(name string) *template.Template
+}
+
+// DocCommentData is the data provided to the DocCommentTemplate.
+type DocCommentData struct {
+	// The name of the declaration being commented, or "" if the comment
+	// is for a group of declarations, e.g., var ( ... ).
+	Name string
+	// The first sentence of the default comment, e.g., "ParseHeader
+	// parses a header." or just the name if no sentence can be built.
+	Stub string
+}
+
+// ExtractedFuncData is the data provided to the ExtractedFuncTemplate.
+type ExtractedFuncData struct {
+	// The function's doc comment (including the comment markers and a
+	// trailing newline), or "" if no doc comment was requested.
+	Doc string
+	// The receiver, e.g., "c *counter", or "" if the function is not a
+	// method.
+	Recv string
+	// The name of the function.
+	Name string
+	// The parameter list, without parentheses, e.g., "a int, b string".
+	Params string
+	// The result list, e.g., "int" or "(int, error)", or "" if the
+	// function does not return results.
+	Results string
+	// The statements in the function body (without braces).
+	Body string
+}
+
+// defaultTemplates are used when a CodeTemplates does not override them.
+var defaultTemplates = template.Must(template.New("defaults").Parse(`
+{{- define "docComment"}}{{.Stub}} TODO: NEEDS COMMENT INFO{{end}}
+{{- define "extractedFunc"}}{{.Doc}}func {{with .Recv}}({{.}}) {{end}}{{.Name}}({{.Params}}) {{with .Results}}{{.}} {{end}}{
+{{.Body}}
+}
+{{end}}`))
+
+// sampleTemplateData maps each template name to data used to check that a
+// template can be executed.
+var sampleTemplateData = map[string]interface{}{
+	DocCommentTemplate:    DocCommentData{Name: "F", Stub: "F"},
+	ExtractedFuncTemplate: ExtractedFuncData{Name: "f"},
+}
+
+// ReadCodeTemplates reads a file containing templates that override the
+// default CodeTemplates.  Each template is defined by a {{define}} action
+// whose name is one of the template names above (e.g., DocCommentTemplate),
+// e.g.,
+//
+//	{{define "docComment"}}{{.Stub}}
+//
+//	TODO({{.Name}}): Document this.{{end}}
+//
+// Text outside of {{define}} actions is ignored.
+func ReadCodeTemplates(filename string) (CodeTemplates, error) {
+	t, err := template.ParseFiles(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, defined := range t.Templates() {
+		name := defined.Name()
+		if name == filepath.Base(filename) {
+			continue
+		}
+		data, ok := sampleTemplateData[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown template %s", filename,
+				name)
+		}
+		if err := defined.Execute(&bytes.Buffer{}, data); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	return t, nil
+}
+
+// executeTemplate executes the template with the given name, using the
+// override provided by templates (which may be nil) if there is one.
+func executeTemplate(templates CodeTemplates, name string, data interface{}) (string, error) {
+	t := defaultTemplates.Lookup(name)
+	if templates != nil {
+		if override := templates.Lookup(name); override != nil {
+			t = override
+		}
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// commentLines converts text into a line comment, prefixing each line with
+// "//" (and a space, unless the line is blank).
+func commentLines(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = "//"
+		} else {
+			lines[i] = "// " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
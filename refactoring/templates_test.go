@@ -0,0 +1,67 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactoring
+
+import (
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCodeTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godoctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "templates.tmpl")
+	write := func(contents string) {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`Ignored text
+{{define "docComment"}}{{.Stub}}
+
+Owner: {{.Name}} team{{end}}`)
+	templates, err := ReadCodeTemplates(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment, err := docCommentStub(&ast.FuncDecl{}, "ParseHeader", "",
+		templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "// ParseHeader parses a header.\n//\n// Owner: ParseHeader team"
+	if comment != expected {
+		t.Errorf("Expected %q, got %q", expected, comment)
+	}
+
+	// Templates that are not overridden use the defaults
+	f := &extractedFunc{name: "f", code: []byte("x()"), templates: templates}
+	decl, call, err := f.SourceCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl != "\n\nfunc f() {\nx()\n}\n" || call != "f()" {
+		t.Errorf("Incorrect extracted function: %q, %q", decl, call)
+	}
+
+	for _, contents := range []string{
+		`{{define "unknown"}}x{{end}}`,
+		`{{define "docComment"}}{{.Missing}}{{end}}`,
+		`{{define "docComment"}}{{.Stub}`,
+	} {
+		write(contents)
+		if _, err := ReadCodeTemplates(filename); err == nil {
+			t.Errorf("%s should have been rejected", contents)
+		}
+	}
+}
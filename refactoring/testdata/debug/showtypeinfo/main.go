@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+type point struct{ x, y int }
+
+func main() {
+	p := point{1, 2}
+	for i := 0; i < 2; i++ {
+		fmt.Println(p.x + i) //<<<<<debug,10,15,10,17,showtypeinfo,pass
+	}
+}
@@ -0,0 +1,8 @@
+package main // <<<<< editscript,1,1,1,1,script.json,fail
+
+import "fmt"
+
+func main() {
+	x := 1
+	fmt.Println(x)
+}
@@ -0,0 +1,11 @@
+package main // <<<<< editscript,1,1,1,1,script.json,pass
+
+import (
+	"fmt"
+
+	"example.com/edit/util"
+)
+
+func main() {
+	fmt.Println(util.Double(2))
+}
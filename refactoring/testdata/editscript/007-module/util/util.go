@@ -0,0 +1,6 @@
+package util
+
+// Double returns twice n.
+func Double(n int) int {
+	return n * 2
+}
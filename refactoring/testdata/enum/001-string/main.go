@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+// describe returns the temperature of a color.
+func describe(color string) string {
+	switch color { // <<<<< enum,7,2,7,7,Color,pass
+	case "red":
+		return "warm"
+	case "light-blue", "green":
+		return "cool"
+	}
+	return "unknown"
+}
+
+func main() {
+	c := "red"
+	if c == "red" {
+		fmt.Println(describe(c))
+	}
+	fmt.Println("red", isBlue(c))
+}
+
+func isBlue(c string) bool {
+	return "light-blue" != c || c == "blue"
+}
@@ -0,0 +1,19 @@
+package main
+
+import "fmt"
+
+func name(n int) string {
+	switch n { // <<<<< enum,6,2,6,7,Level,true,pass
+	case 2:
+		return "high"
+	case 0:
+		return "low"
+	case 1:
+		return "medium"
+	}
+	return ""
+}
+
+func main() {
+	fmt.Println(name(1))
+}
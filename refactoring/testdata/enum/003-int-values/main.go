@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+func message(code uint16) string {
+	switch code { // <<<<< enum,6,2,6,7,status,true,pass
+	case 404:
+		return "not found"
+	case 200, 0x12e:
+		return "ok"
+	}
+	return "?"
+}
+
+func main() {
+	fmt.Println(message(200))
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	n := 5
+	switch { // <<<<< enum,7,2,7,7,N,fail
+	case n == 1:
+		fmt.Println("one")
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+const two = 2
+
+func main() {
+	n := 5
+	switch n { // <<<<< enum,9,2,9,7,N,fail
+	case 1:
+		fmt.Println("one")
+	case two:
+		fmt.Println("two")
+	}
+}
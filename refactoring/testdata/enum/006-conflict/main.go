@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+var ColorRed = "#f00"
+
+func main() {
+	color := "red"
+	switch color { // <<<<< enum,9,2,9,7,Color,fail
+	case "red":
+		fmt.Println(ColorRed)
+	}
+}
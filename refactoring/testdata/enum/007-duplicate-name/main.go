@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func main() {
+	color := "red"
+	switch color { // <<<<< enum,8,2,8,7,Color,fail
+	case "dark-blue":
+		fmt.Println(1)
+	case "dark_blue":
+		fmt.Println(2)
+	}
+}
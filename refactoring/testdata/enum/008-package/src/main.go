@@ -0,0 +1,10 @@
+package main
+
+import (
+	"fmt"
+	"paint"
+)
+
+func main() {
+	fmt.Println(paint.Mix("red", "blue"))
+}
@@ -0,0 +1,16 @@
+// Package paint mixes colors.
+package paint
+
+// Mix returns the result of mixing two primary colors.
+func Mix(a, b string) string {
+	if a == b {
+		return a
+	}
+	if a == "blue" && b == "yellow" {
+		return "green"
+	}
+	if isPrimary(a) && isPrimary(b) {
+		return a + "-" + b
+	}
+	return "brown"
+}
@@ -0,0 +1,9 @@
+package paint
+
+func isPrimary(c string) bool {
+	switch c { // <<<<< enum,4,2,4,7,Primary,true,pass
+	case "red", "yellow", "blue":
+		return true
+	}
+	return c == "brown" || c != "yellow" && false
+}
@@ -0,0 +1,39 @@
+// <<<<<errgroup,14,6,14,8,g,pass
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+func fetch(url string) error {
+	return nil
+}
+
+func fetchAll(urls []string) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(urls))
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			if err := fetch(url); err != nil {
+				errs <- fmt.Errorf("fetching %s: %v", url, err)
+				return
+			}
+			fmt.Println("fetched", url)
+		}(url)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	fmt.Println(fetchAll([]string{"a", "b"}))
+}
@@ -0,0 +1,10 @@
+// Package errgroup is a stub of golang.org/x/sync/errgroup for testing.
+package errgroup
+
+type Group struct{}
+
+func (g *Group) Go(f func() error) {}
+
+func (g *Group) Wait() error { return nil }
+
+func (g *Group) SetLimit(n int) {}
@@ -0,0 +1,44 @@
+// <<<<<errgroup,14,2,14,23,group,4,pass
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+func check(n int) error {
+	return errors.New("failed")
+}
+
+func checkAll() error {
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	var mu sync.Mutex
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			if n > 0 {
+				errs <- check(n)
+			}
+		}(i * 2)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs <- check(-1)
+	}()
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return fmt.Errorf("check failed: %v", err)
+	}
+	return nil
+}
+
+func main() {
+	fmt.Println(checkAll())
+}
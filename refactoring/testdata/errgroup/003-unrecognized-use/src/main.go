@@ -0,0 +1,25 @@
+// <<<<<errgroup,15,6,15,8,g,fail
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+func work(wg *sync.WaitGroup, errs chan<- error) {
+	defer wg.Done()
+	errs <- nil
+}
+
+func main() {
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	wg.Add(2)
+	go work(&wg, errs)
+	go func() {
+		defer wg.Done()
+		errs <- fmt.Errorf("failed")
+	}()
+	wg.Wait()
+	fmt.Println(<-errs)
+}
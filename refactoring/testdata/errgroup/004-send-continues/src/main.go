@@ -0,0 +1,20 @@
+// <<<<<errgroup,10,6,10,8,g,fail
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+func main() {
+	var wg sync.WaitGroup
+	errs := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs <- fmt.Errorf("first")
+		fmt.Println("still running")
+	}()
+	wg.Wait()
+	fmt.Println(<-errs)
+}
@@ -0,0 +1,21 @@
+// <<<<<errgroup,10,6,10,8,g,fail
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+func main() {
+	var wg sync.WaitGroup
+	errs := make(chan error, 1)
+	g := "group"
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs <- fmt.Errorf("%s failed", g)
+	}()
+	wg.Wait()
+	close(errs)
+	fmt.Println(<-errs)
+}
@@ -0,0 +1,33 @@
+// Copyright 2015 Example Authors.  All rights reserved.
+
+// Package main demonstrates the Extract to New File refactoring.
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// A Point is a point in the plane.
+type Point struct { //<<<<<extractfile,12,6,12,11,pass
+	X, Y float64 // coordinates
+}
+
+// NewPoint returns a new Point.
+func NewPoint(x, y float64) *Point {
+	return &Point{x, y}
+}
+
+func main() {
+	p := NewPoint(3, 4)
+	fmt.Println(p.Abs(), p)
+}
+
+// Abs returns the distance of p from the origin.
+func (p *Point) Abs() float64 {
+	return math.Sqrt(p.X*p.X + p.Y*p.Y)
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("(%g, %g)", p.X, p.Y)
+}
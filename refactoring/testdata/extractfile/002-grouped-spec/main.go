@@ -0,0 +1,27 @@
+//go:build !plan9
+// +build !plan9
+
+package main
+
+import (
+	"fmt"
+	str "strings"
+)
+
+type (
+	// Name is a person's name.
+	Name  string //<<<<<extractfile,13,2,13,6,names,pass
+	count int
+)
+
+func main() {
+	var n Name = "gopher"
+	println(n.Upper(), count(1))
+}
+
+func (n Name) Upper() string { return str.ToUpper(string(n)) }
+
+// Lower returns n in lowercase.
+func (n *Name) Lower() string {
+	return fmt.Sprint(str.ToLower(string(*n)))
+}
@@ -0,0 +1,8 @@
+package main
+
+type T int
+
+func main() {
+	var t T //<<<<<extractfile,6,6,6,7,fail
+	_ = t
+}
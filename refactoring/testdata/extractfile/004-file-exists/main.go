@@ -0,0 +1,6 @@
+package main
+
+type T int //<<<<<extractfile,3,6,3,7,main,fail
+
+func main() {
+}
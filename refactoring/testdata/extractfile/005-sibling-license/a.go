@@ -0,0 +1,4 @@
+// Copyright 2020 Example Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style license.
+
+package other
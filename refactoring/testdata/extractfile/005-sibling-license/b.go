@@ -0,0 +1,7 @@
+//go:build !windows
+
+/*
+ * Copyright 2021 Example Authors.  All rights reserved.
+ */
+
+package main
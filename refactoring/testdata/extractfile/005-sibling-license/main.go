@@ -0,0 +1,14 @@
+//go:build !windows
+
+// Package main demonstrates copying the license header from another file.
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(Point{1, 2})
+}
+
+type Point struct { //<<<<<extractfile,12,6,12,11,pass
+	X, Y int
+}
@@ -0,0 +1,18 @@
+// <<<<<extract,8,2,16,3,Foo,pass
+package main
+
+import "fmt"
+
+func main() {
+	n := 0
+outer:
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if i*j == 2 {
+				continue outer
+			}
+			fmt.Println(i, j)
+		}
+	}
+	fmt.Println("done", n)
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func main() {
+	cmd := exec.Command("true")
+	p := cmd.Process
+	fmt.Println(p) // <<<<<extract,11,2,11,16,Foo,pass
+}
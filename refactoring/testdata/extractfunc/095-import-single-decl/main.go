@@ -0,0 +1,9 @@
+package main
+
+import "os/exec"
+
+func main() {
+	cmd := exec.Command("true")
+	p := cmd.Process
+	println(p) // <<<<<extract,8,2,8,11,Foo,pass
+}
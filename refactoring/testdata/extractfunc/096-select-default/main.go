@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+// Test for extracting a select statement with a default case
+func main() {
+	ch := make(chan int, 1)
+	ch <- 1
+	select { // <<<<<extract,9,2,14,2,foo,pass
+	case v := <-ch:
+		fmt.Println(v)
+	default:
+		fmt.Println("none")
+	}
+	fmt.Println("after")
+}
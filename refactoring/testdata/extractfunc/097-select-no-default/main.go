@@ -0,0 +1,19 @@
+package main
+
+import "fmt"
+
+// Test for extracting a select statement without a default case, which
+// assigns a variable used after the select
+func main() {
+	ch := make(chan int, 1)
+	done := make(chan bool)
+	ch <- 1
+	n := cap(ch)
+	select { // <<<<<extract,12,2,17,2,foo,pass
+	case v, ok := <-ch:
+		n = v
+		fmt.Println(v, ok)
+	case <-done:
+	}
+	fmt.Println(n)
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+// Test for extracting statements in a select case, where the selection
+// extends into the whitespace preceding the next case
+func main() {
+	ch := make(chan int, 1)
+	ch <- 1
+	select {
+	case v := <-ch:
+		v++
+		fmt.Println(v) // <<<<<extract,12,1,14,1,foo,pass
+	default:
+		fmt.Println("none")
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+// Test for extracting a statement in the last case of a switch, where the
+// selection extends to the line containing the closing brace
+func main() {
+	x := 1
+	switch x {
+	case 0:
+		fmt.Println("zero")
+	default:
+		fmt.Println(x) // <<<<<extract,13,3,14,1,foo,pass
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+// Test for extracting channel sends and receives in a loop
+func main() {
+	ch := make(chan int, 1)
+	total := 0
+	for i := 0; i < 3; i++ {
+		ch <- i       // <<<<<extract,10,3,11,15,foo,pass
+		total += <-ch
+	}
+	fmt.Println(total)
+}
@@ -0,0 +1,28 @@
+package main
+
+import "fmt"
+
+// Test for extracting a select statement in a loop, where a case breaks out
+// of the select
+func main() {
+	ch := make(chan int)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 3; i++ {
+			ch <- i
+		}
+		close(done)
+	}()
+	count := 0
+	for count < 3 {
+		select { // <<<<<extract,18,3,25,3,foo,pass
+		case v := <-ch:
+			if v < 0 {
+				break
+			}
+			count++
+		case <-done:
+		}
+	}
+	fmt.Println(count)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+// Test for extracting statements from more than one case of a select
+func main() {
+	ch := make(chan int, 1)
+	ch <- 1
+	select {
+	case v := <-ch:
+		fmt.Println(v) // <<<<<extract,11,3,13,22,foo,fail
+	default:
+		fmt.Println("none")
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"util"
+)
+
+// Test for extracting a function to a different package, which must import
+// the packages used by the extracted code
+func main() {
+	name := util.Trim("  world")
+	greeting := strings.ToUpper("hello") // <<<<<extract,14,2,15,25,joinGreeting,util,pass
+	greeting += ", " + name
+	fmt.Println(greeting)
+}
@@ -0,0 +1,9 @@
+package util
+
+// Trim removes leading spaces from s.
+func Trim(s string) string {
+	for len(s) > 0 && s[0] == ' ' {
+		s = s[1:]
+	}
+	return s
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"util"
+)
+
+type point struct {
+	x, y int
+}
+
+// Test for extracting a function to a different package, where an unexported
+// type would appear in its signature
+func main() {
+	p := point{1, 2}
+	p.x = util.Abs(p.x - p.y) // <<<<<extract,17,2,18,14,scale,util,fail
+	p.y = p.x * 2
+	fmt.Println(p)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+
+	"util"
+)
+
+var scale = 10
+
+// Test for extracting a function to a different package, where the selected
+// statements refer to a declaration in the current package
+func main() {
+	n := util.Abs(-5)
+	n *= scale // <<<<<extract,15,2,15,11,scaleIt,util,fail
+	fmt.Println(n)
+}
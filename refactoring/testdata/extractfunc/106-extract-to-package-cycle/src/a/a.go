@@ -0,0 +1,10 @@
+package a
+
+import "fmt"
+
+// Test for extracting a function to a package that imports the current
+// package, which would create an import cycle
+func Hello() {
+	msg := "hello" // <<<<<extract,8,2,9,18,greet,b,fail
+	fmt.Println(msg)
+}
@@ -0,0 +1,9 @@
+package b
+
+import "a"
+
+// Goodbye says hello, then goodbye.
+func Goodbye() {
+	a.Hello()
+	println("goodbye")
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"a"
+	"b"
+)
+
+func main() {
+	a.Hello()
+	b.Goodbye()
+}
@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+// Test for extracting a function to a package that is not loaded
+func main() {
+	x := 5
+	fmt.Println(x) // <<<<<extract,8,2,8,15,show,notfound,fail
+}
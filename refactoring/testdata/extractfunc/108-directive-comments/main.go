@@ -0,0 +1,14 @@
+// <<<<<extract,11,2,12,19,writeAll,pass
+package main
+
+import "os"
+
+func main() {
+	name := "out.txt"
+	f, _ := os.Create(name)
+	// Write the header
+	//nolint:errcheck
+	f.WriteString("a")
+	f.WriteString("b") //nolint
+	f.Close()
+}
@@ -0,0 +1,15 @@
+// <<<<<extract,10,2,11,19,writeAll,pass
+package main
+
+import "os"
+
+func main() {
+	f, _ := os.Create("out.txt")
+	//lint:ignore SA9003 empty branch
+	//nolint:errcheck
+	f.WriteString("a")
+	f.WriteString("b") //nolint:errcheck // the error is checked by Close
+	if err := f.Close(); err != nil { //nolint:gocritic
+		panic(err)
+	}
+}
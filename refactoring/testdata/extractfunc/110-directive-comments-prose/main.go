@@ -0,0 +1,12 @@
+// <<<<<extract,9,2,10,19,writeAll,pass
+package main
+
+import "os"
+
+func main() {
+	f, _ := os.Create("out.txt")
+	// nolint is not a directive when there is a space
+	f.WriteString("a")
+	f.WriteString("b") // go:noinline
+	f.Close()           //nolint
+}
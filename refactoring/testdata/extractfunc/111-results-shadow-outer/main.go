@@ -0,0 +1,15 @@
+// <<<<<extract,10,3,11,8,compute,pass
+package main
+
+import "fmt"
+
+func main() {
+	b := 0
+	name := "x"
+	if len(name) > 0 {
+		a := len(name)
+		b = a * 2
+		fmt.Println(a, b)
+	}
+	fmt.Println(b)
+}
@@ -0,0 +1,12 @@
+// <<<<<extract,9,2,10,7,compute,pass
+package main
+
+import "fmt"
+
+func main() {
+	b := 0
+	name := "x"
+	a := len(name)
+	b = a * 2
+	fmt.Println(a, b, name)
+}
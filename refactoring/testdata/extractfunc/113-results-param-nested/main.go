@@ -0,0 +1,17 @@
+// <<<<<extract,12,3,13,13,step,pass
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(count(3, 0))
+}
+
+func count(n int, total int) int {
+	for i := 0; i < n; i++ {
+		k := i + 1
+		total += k
+		fmt.Println(k)
+	}
+	return total
+}
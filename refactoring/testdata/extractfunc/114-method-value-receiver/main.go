@@ -0,0 +1,21 @@
+// <<<<<extract,19,2,20,35,describe,,a,pass
+package main
+
+import "fmt"
+
+type account struct {
+	owner   string
+	balance int
+}
+
+func main() {
+	a := account{owner: "alice", balance: 10}
+	report(a, "summary")
+}
+
+func report(a account, title string) {
+	fmt.Println(title)
+
+	fmt.Println("Owner:", a.owner)
+	fmt.Println("Balance:", a.balance)
+}
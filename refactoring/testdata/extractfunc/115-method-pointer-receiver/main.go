@@ -0,0 +1,21 @@
+// <<<<<extract,14,2,15,12,deposit,,a,pass
+package main
+
+import "fmt"
+
+type account struct {
+	owner   string
+	balance int
+}
+
+func main() {
+	a := account{owner: "alice"}
+	amount := len(a.owner)
+	a.balance += amount
+	a.record()
+	fmt.Println(a.balance)
+}
+
+func (a *account) record() {
+	fmt.Println("Recorded", a.owner)
+}
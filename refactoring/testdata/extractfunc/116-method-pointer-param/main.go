@@ -0,0 +1,20 @@
+// <<<<<extract,17,2,18,9,reset,,c,pass
+package main
+
+import "fmt"
+
+type counter struct {
+	n     int
+	total int
+}
+
+func main() {
+	c := &counter{n: 3}
+	update(c)
+}
+
+func update(c *counter) {
+	c.total += c.n
+	c.n = 0
+	fmt.Println(c.total)
+}
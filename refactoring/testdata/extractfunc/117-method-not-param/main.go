@@ -0,0 +1,13 @@
+// <<<<<extract,11,2,12,16,show,,s,fail
+package main
+
+import "fmt"
+
+type point struct{ x, y int }
+
+func main() {
+	p := point{1, 2}
+	n := 3
+	fmt.Println(p.x * n)
+	fmt.Println(p.y)
+}
@@ -0,0 +1,15 @@
+// <<<<<extract,14,2,14,18,String,,p,fail
+package main
+
+import "fmt"
+
+type point struct{ x, y int }
+
+func (p point) String() string {
+	return fmt.Sprintf("(%d, %d)", p.x, p.y)
+}
+
+func main() {
+	p := point{1, 2}
+	fmt.Println(p.x)
+}
@@ -0,0 +1,18 @@
+// <<<<<extract,11,2,12,11,move,,p,fail
+package main
+
+import "fmt"
+
+type point struct{ x, y int }
+
+func main() {
+	p := point{1, 2}
+	fmt.Println(p)
+	p.x++
+	show(p)
+	fmt.Println(p)
+}
+
+func show(p point) {
+	fmt.Println(p.x, p.y)
+}
@@ -0,0 +1,13 @@
+// <<<<<extract,10,2,11,40,ParseHeader,,,true,pass
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+	line := "Content-Type: text/plain"
+	fields := strings.SplitN(line, ":", 2)
+	fmt.Println(strings.TrimSpace(fields[1]))
+}
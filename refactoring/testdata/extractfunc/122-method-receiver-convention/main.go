@@ -0,0 +1,26 @@
+// <<<<<extract,16,2,17,38,describe,,acct,pass
+package main
+
+import "fmt"
+
+type account struct {
+	owner   string
+	balance int
+}
+
+func (a *account) deposit(amount int) {
+	a.balance += amount
+}
+
+func report(acct account) {
+	fmt.Println("Owner:", acct.owner)
+	fmt.Println("Balance:", acct.balance)
+}
+
+func (a account) owes() bool {
+	return a.balance < 0
+}
+
+func main() {
+	report(account{owner: "alice", balance: 10})
+}
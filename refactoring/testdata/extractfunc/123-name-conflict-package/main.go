@@ -0,0 +1,14 @@
+// <<<<<extract,13,2,13,20,helper,fail
+package main
+
+import "fmt"
+
+func helper() int {
+	return 1
+}
+
+func main() {
+	x := helper()
+	fmt.Println(x)
+	fmt.Println(x + 1)
+}
@@ -0,0 +1,9 @@
+// <<<<<extract,8,2,8,16,fmt,fail
+package main
+
+import "fmt"
+
+func main() {
+	x := 1
+	fmt.Println(x)
+}
@@ -0,0 +1,16 @@
+// <<<<<extract,14,2,14,26,decode,fail
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type config struct{ Name string }
+
+func main() {
+	var c config
+	data := []byte(`{"Name": "x"}`)
+	json.Unmarshal(data, &c)
+	fmt.Println(c.Name)
+}
@@ -0,0 +1,11 @@
+// <<<<<extract,9,2,9,7,assign,fail
+package main
+
+import "fmt"
+
+func main() {
+	x := 1
+	p := &x
+	x = 2
+	fmt.Println(*p)
+}
@@ -0,0 +1,13 @@
+// <<<<<extract,11,2,11,20,write,fail
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+	var b strings.Builder
+	b.WriteString("a")
+	fmt.Println(b.String())
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+var os = "linux"
+
+func main() {
+	cmd := exec.Command("true")
+	p := cmd.Process
+	fmt.Println(p) // <<<<<extract,13,2,13,16,Foo,pass
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+func main() {
+	fmt.Println(divmod(7, 2)) // <<<<< var,10,14,10,25,v,pass
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+func main() {
+	x, y := divmod(7, 2) // <<<<< var,10,10,10,21,a b c,fail
+	fmt.Println(x, y)
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := 2
+	defer fmt.Println(x * 10) // <<<<< var,7,20,7,25,product,pass
+	x = 3
+	fmt.Println(x)
+}
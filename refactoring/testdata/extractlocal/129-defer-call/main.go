@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func square(n int) int {
+	fmt.Println(n * n)
+	return n * n
+}
+
+func main() {
+	x := 2
+	defer square(x) // <<<<< var,12,8,12,16,call,fail
+	fmt.Println(x)
+}
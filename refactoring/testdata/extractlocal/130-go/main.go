@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+func show(ch chan bool, s string) {
+	fmt.Println(s)
+	ch <- true
+}
+
+func main() {
+	ch := make(chan bool)
+	name := "world"
+	go show(ch, "hello, "+name) // <<<<< var,13,14,13,27,greeting,pass
+	<-ch
+}
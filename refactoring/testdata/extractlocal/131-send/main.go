@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	ch := make(chan int, 1)
+	x := 4
+	ch <- x * x // <<<<< var,8,8,8,12,square,pass
+	fmt.Println(<-ch)
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	counts := make([]int, 4)
+	i := 1
+	counts[i+2]++ // <<<<< var,8,9,8,11,index,pass
+	fmt.Println(counts)
+}
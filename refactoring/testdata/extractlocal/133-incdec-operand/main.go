@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	counts := make([]int, 4)
+	i := 1
+	counts[i+2]-- // <<<<< var,8,2,8,12,count,fail
+	fmt.Println(counts)
+}
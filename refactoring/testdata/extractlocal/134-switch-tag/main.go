@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := 3
+	switch x % 2 { // <<<<< var,7,9,7,13,parity,pass
+	case 0:
+		fmt.Println("even")
+	default:
+		fmt.Println("odd")
+	}
+}
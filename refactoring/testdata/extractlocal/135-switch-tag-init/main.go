@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func main() {
+	switch x := 3; x % 2 { // <<<<< var,6,17,6,21,parity,fail
+	case 0:
+		fmt.Println("even")
+	default:
+		fmt.Println("odd")
+	}
+}
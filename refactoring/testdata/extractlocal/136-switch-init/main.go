@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func main() {
+	y := 4
+	switch x := y * 2; x % 3 { // <<<<< var,7,14,7,18,double,pass
+	case 0:
+		fmt.Println("divisible")
+	default:
+		fmt.Println(x)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+func value(n int) interface{} {
+	return n
+}
+
+func main() {
+	switch v := value(3).(type) { // <<<<< var,10,14,10,21,val,pass
+	case int:
+		fmt.Println("int", v)
+	default:
+		fmt.Println("other")
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func main() {
+	ch := make(chan int, 1)
+	x := 2
+	select {
+	case ch <- x * 3: // <<<<< var,9,13,9,17,value,fail
+		fmt.Println(<-ch)
+	default:
+	}
+}
@@ -0,0 +1,18 @@
+// <<<<<extractloop,9,2,9,5,printRow,pass
+package main
+
+import "fmt"
+
+func main() {
+	grid := [][]int{{1, 2}, {-1, 3}, {4, 5}}
+rows:
+	for _, row := range grid {
+		for _, x := range row {
+			if x < 0 {
+				continue rows
+			}
+			fmt.Println(x)
+		}
+		fmt.Println("row", row)
+	}
+}
@@ -0,0 +1,14 @@
+// <<<<<extractloop,8,2,8,5,check,fail
+package main
+
+import "fmt"
+
+func main() {
+	nums := []int{1, 2, 3, -1, 4}
+	for _, n := range nums {
+		if n < 0 {
+			break
+		}
+		fmt.Println(n)
+	}
+}
@@ -0,0 +1,17 @@
+// <<<<<extractloop,9,2,9,5,indexed,true,pass
+package main
+
+import "fmt"
+
+func main() {
+	words := []string{"apple", "", "banana", "cherry"}
+	count := 0
+	for i, w := range words[1:] {
+		if w == "" {
+			continue
+		}
+		fmt.Println(i, w)
+		count++
+	}
+	fmt.Println(count, "words")
+}
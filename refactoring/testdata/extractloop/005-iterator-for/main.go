@@ -0,0 +1,14 @@
+// <<<<<extractloop,8,8,8,28,evens,true,pass
+package main
+
+import "fmt"
+
+func main() {
+	n := 10
+	for i := 0; i < n; i += 2 {
+		if i == 6 {
+			break
+		}
+		fmt.Println(i)
+	}
+}
@@ -0,0 +1,16 @@
+// <<<<<extractloop,9,2,9,5,forever,true,pass
+package main
+
+import "fmt"
+
+func main() {
+	count := 0
+	// Loop until done
+	for {
+		count++
+		if count > 3 {
+			break
+		}
+	}
+	fmt.Println(count)
+}
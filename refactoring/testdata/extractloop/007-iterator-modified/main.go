@@ -0,0 +1,14 @@
+// <<<<<extractloop,8,2,8,5,upTo,true,fail
+package main
+
+import "fmt"
+
+func main() {
+	n := 10
+	for j := 0; j < n; j++ {
+		if j == 3 {
+			n--
+		}
+		fmt.Println(j)
+	}
+}
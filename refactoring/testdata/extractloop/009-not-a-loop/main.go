@@ -0,0 +1,9 @@
+// <<<<<extractloop,8,2,8,16,f,fail
+package main
+
+import "fmt"
+
+func main() {
+	x := 1
+	fmt.Println(x)
+}
@@ -0,0 +1,29 @@
+// Copyright 2015 Example Authors.  All rights reserved.
+
+// Package geo provides geometric utilities.
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// A Point is a point in the plane.
+type Point struct { //<<<<<extractpackage,12,1,12,5,geo/shapes,distance,pass
+	X, Y float64
+}
+
+// distance returns the distance between p and q.
+func distance(p, q Point) float64 {
+	return math.Hypot(p.X-q.X, p.Y-q.Y)
+}
+
+// Describe describes p.
+func Describe(p Point) string {
+	return fmt.Sprintf("%v is %.1f from (1, 1)", p, distance(p, Point{1, 1}))
+}
+
+// Abs returns the distance of p from the origin.
+func (p Point) Abs() float64 {
+	return distance(p, Point{})
+}
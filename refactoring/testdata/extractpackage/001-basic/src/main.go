@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+
+	"geo"
+)
+
+func main() {
+	p := geo.Point{X: 3, Y: 4}
+	fmt.Println(p.Abs(), geo.Describe(p))
+}
@@ -0,0 +1,16 @@
+package geo
+
+import "fmt"
+
+type Point struct {
+	X, Y float64
+}
+
+func origin() Point {
+	return Point{}
+}
+
+// Describe refers to origin, which is not moved
+func Describe(p Point) string { //<<<<<extractpackage,14,1,14,5,geo/describe,fail
+	return fmt.Sprintf("%v (origin %v)", p, origin())
+}
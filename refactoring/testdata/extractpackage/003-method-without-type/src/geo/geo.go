@@ -0,0 +1,12 @@
+package geo
+
+import "math"
+
+type Point struct {
+	X, Y float64
+}
+
+// The method cannot be moved without its receiver type
+func (p Point) Abs() float64 { //<<<<<extractpackage,10,1,10,5,geo/abs,fail
+	return math.Hypot(p.X, p.Y)
+}
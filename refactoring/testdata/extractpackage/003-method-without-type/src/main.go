@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"geo"
+)
+
+func main() {
+	fmt.Println(geo.Point{X: 3, Y: 4}.Abs())
+}
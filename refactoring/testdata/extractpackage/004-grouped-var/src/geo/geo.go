@@ -0,0 +1,19 @@
+package geo
+
+import "fmt"
+
+var (
+	// precision is the number of digits printed
+	precision = 2 //<<<<<extractpackage,7,1,7,5,geo/config,pass
+	factor    = 10.0
+)
+
+// Scale scales x by factor.
+func Scale(x float64) float64 {
+	return x * factor
+}
+
+// Format formats x with the configured precision.
+func Format(x float64) string {
+	return fmt.Sprintf("%.*f", precision, x)
+}
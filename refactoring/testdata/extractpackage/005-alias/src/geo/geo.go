@@ -0,0 +1,15 @@
+// Package geo provides geometric utilities.
+package geo
+
+import "fmt"
+
+// A Point is a point in the plane.
+type Point struct { //<<<<<extractpackage,7,1,7,5,geo/shapes,pass
+	X, Y float64
+}
+
+// Describe describes p.
+func Describe(p Point) string {
+	shapes := 1
+	return fmt.Sprintf("%d shape: %v", shapes, Point(p))
+}
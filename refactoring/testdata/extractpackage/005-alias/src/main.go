@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+
+	"geo"
+	"shapes"
+)
+
+func main() {
+	p := geo.Point{X: 3, Y: 4}
+	fmt.Println(shapes.Draw("point"), geo.Describe(p))
+}
@@ -0,0 +1,7 @@
+// Package shapes draws shapes.
+package shapes
+
+// Draw draws the named shape.
+func Draw(name string) string {
+	return "<" + name + ">"
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A server passes requests to a handler.
+type server struct {
+	handler func(req string) error // <<<<< functype,10,10,10,10,Handler,pass
+}
+
+// An errorHandler's Handle method has the same signature, but it is not a
+// function type, so it is not replaced.
+type errorHandler interface {
+	Handle(req string) error
+}
+
+func (s *server) handle(h func(string) error) {
+	s.handler = h
+}
+
+func reject(req string) error {
+	return errors.New("rejected: " + req)
+}
+
+func main() {
+	var h func(string) error = reject
+	s := &server{}
+	s.handle(h)
+	fmt.Println(s.handler("hello"))
+	var other func(int) error
+	fmt.Println(other == nil)
+}
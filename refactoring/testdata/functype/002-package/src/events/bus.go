@@ -0,0 +1,17 @@
+// Package events delivers events to subscribers.
+package events
+
+// A Bus delivers each published event to its subscribers.
+type Bus struct {
+	subscribers []func(string, []byte)
+}
+
+// NewBus returns a Bus with no subscribers.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a subscriber to the bus.
+func (b *Bus) Subscribe(fn func(name string, data []byte)) { // <<<<< functype,15,29,15,29,Listener,pass
+	b.subscribers = append(b.subscribers, fn)
+}
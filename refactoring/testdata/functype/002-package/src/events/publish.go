@@ -0,0 +1,14 @@
+package events
+
+// Publish delivers an event to each subscriber.
+func (b *Bus) Publish(name string, data []byte) {
+	b.each(func(fn func(string, []byte)) {
+		fn(name, data)
+	})
+}
+
+func (b *Bus) each(visit func(func(string, []byte))) {
+	for _, fn := range b.subscribers {
+		visit(fn)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"events"
+	"fmt"
+)
+
+func main() {
+	b := events.NewBus()
+	b.Subscribe(func(name string, data []byte) {
+		fmt.Println(name, string(data))
+	})
+	b.Publish("hello", nil)
+}
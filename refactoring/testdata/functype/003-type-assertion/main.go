@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func call(f interface{}) {
+	if fn, ok := f.(func(int) int); ok {
+		fmt.Println(fn(1))
+	}
+}
+
+func main() {
+	var double func(int) int = func(n int) int { return 2 * n } // <<<<< functype,12,13,12,13,intFunc,fail
+	call(double)
+}
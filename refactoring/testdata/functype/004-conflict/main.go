@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+type callback int
+
+func main() {
+	var f func() = func() { fmt.Println("hello") } // <<<<< functype,8,9,8,9,callback,fail
+	f()
+}
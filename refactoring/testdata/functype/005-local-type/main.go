@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	type point struct{ x, y int }
+	var show func(point) = func(p point) { fmt.Println(p.x, p.y) } // <<<<< functype,7,12,7,12,showFunc,fail
+	show(point{1, 2})
+}
@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+var hooks []func() // <<<<< functype,5,15,5,15,hook,pass
+
+func register(h func()) {
+	hooks = append(hooks, h)
+}
+
+func main() {
+	register(func() { fmt.Println("hook") })
+	for _, h := range hooks {
+		h()
+	}
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func greet(name string) { // <<<<< functype,5,6,5,6,greeter,fail
+	fmt.Println("Hello,", name)
+}
+
+func main() {
+	greet("world")
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func apply(n int, f func(int) int) int { // <<<<< functype,5,21,5,21,op,fail
+	return f(n)
+}
+
+func main() {
+	op := 1
+	var inc func(int) int = func(n int) int { return n + op }
+	fmt.Println(apply(1, inc))
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+var prefix = "> "
+
+func main() {
+	greet("world")
+	fmt.Println(format("x"))
+}
+
+func greet(name string) { // <<<<< globalparam,5,5,5,5,greet,pass
+	fmt.Println(format(name))
+}
+
+func format(s string) string {
+	return prefix + s
+}
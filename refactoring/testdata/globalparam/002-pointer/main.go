@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+type Stats struct {
+	Count int
+	Names []string
+}
+
+var stats Stats
+
+func main() {
+	record("a")
+	record("b")
+	fmt.Println(stats.Count)
+}
+
+func record(name string) { // <<<<< globalparam,10,5,10,5,record,pass
+	stats.Count++
+	stats.Names = append(stats.Names, name)
+	reset(&stats)
+	fmt.Println(stats, len(stats.Names))
+}
+
+func reset(s *Stats) {
+	s.Count = 0
+}
@@ -0,0 +1,24 @@
+package main
+
+import "fmt"
+
+var verbose bool
+
+func main() {
+	run(3)
+}
+
+func run(n int) { // <<<<< globalparam,5,5,5,5,run,0,pass
+	if verbose {
+		fmt.Println("running")
+	}
+	for i := 0; i < n; i++ {
+		step(i)
+	}
+}
+
+func step(i int) {
+	if verbose {
+		fmt.Println("step", i)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+var Limit = 10
+
+func main() {
+	fmt.Println(clamp(5), clamp(20))
+	f := func() int { return clamp(1) }
+	fmt.Println(f())
+}
+
+func clamp(n int) int { // <<<<< globalparam,5,5,5,5,clamp,pass
+	if n > Limit {
+		return Limit
+	}
+	return n
+}
@@ -0,0 +1,19 @@
+package main
+
+import "fmt"
+
+var sep = ","
+
+func main() {
+	fmt.Println(join(1, 2, 3))
+}
+
+func join(xs ...int) string { // <<<<< globalparam,5,5,5,5,join,2,pass
+	if len(xs) == 0 {
+		return ""
+	}
+	if len(xs) == 1 {
+		return fmt.Sprint(xs[0])
+	}
+	return fmt.Sprint(xs[0]) + sep + join(xs[1:]...)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+var out = os.Stdout
+
+func main() {
+	fmt.Println(write())
+}
+
+func write() error { // <<<<< globalparam,8,5,8,5,write,pass
+	_, err := fmt.Fprintln(out, "hello")
+	return err
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+var count int
+
+func main() {
+	show(1)
+}
+
+func show(n int) { // <<<<< globalparam,5,5,5,5,show,fail
+	count := n + count
+	fmt.Println(count)
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+var name = "x"
+
+func main() {
+	f := hello
+	f()
+}
+
+func hello() { // <<<<< globalparam,5,5,5,5,hello,fail
+	fmt.Println(name)
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := 1
+	show(x)
+}
+
+func show(n int) { // <<<<< globalparam,6,2,6,2,show,fail
+	fmt.Println(n)
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+var name = "x"
+
+func main() {
+	fmt.Println(name)
+	show()
+}
+
+func show() { // <<<<< globalparam,5,5,5,5,show,fail
+	fmt.Println("show")
+}
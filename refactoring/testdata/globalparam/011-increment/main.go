@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+var total int
+
+func main() {
+	incr()
+	fmt.Println(total)
+}
+
+func incr() { // <<<<< globalparam,5,5,5,5,incr,pass
+	total++
+	for total, _ = range []int{1, 2} {
+	}
+	fmt.Println(total)
+}
@@ -0,0 +1,12 @@
+package p
+
+import (
+	"fmt"
+	"os"
+)
+
+var out = os.Stdout
+
+func Main() {
+	fmt.Println(write())
+}
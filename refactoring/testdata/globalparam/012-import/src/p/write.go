@@ -0,0 +1,8 @@
+package p
+
+import "fmt"
+
+func write() error {
+	_, err := fmt.Fprintln(out, "hello") // <<<<< globalparam,6,25,6,25,write,pass
+	return err
+}
@@ -0,0 +1,36 @@
+package main // <<<<< godoc,1,1,1,1,false,exclude.txt,pass
+
+import "testing"
+
+func main() {
+}
+
+func Exported() {
+}
+
+func TestHelper(t *testing.T) {
+}
+
+type MockStore struct {
+}
+
+func (m *MockStore) Get(key string) string {
+	return ""
+}
+
+type Store struct {
+}
+
+func (s Store) Get(key string) string {
+	return ""
+}
+
+const (
+	MockValue = 1
+	MockOther = 2
+)
+
+var (
+	Value     = 1
+	MockValue2 = 2
+)
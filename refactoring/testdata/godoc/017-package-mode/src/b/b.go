@@ -0,0 +1,4 @@
+package b
+
+func Exported() {
+}
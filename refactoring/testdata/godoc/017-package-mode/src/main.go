@@ -0,0 +1,13 @@
+package main // <<<<< godoc,1,1,1,1,true,exclusions,pass
+
+import "b"
+
+func main() {
+	b.Exported()
+}
+
+func Exported() {
+}
+
+func TestHelper() {
+}
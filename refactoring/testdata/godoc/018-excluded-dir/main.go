@@ -0,0 +1,7 @@
+package main // <<<<< godoc,1,1,1,1,false,exclude.txt,pass
+
+func main() {
+}
+
+func Exported() {
+}
@@ -0,0 +1,47 @@
+package main // <<<<< godoc,1,1,1,1,pass
+
+import "net/http"
+
+func main() {
+}
+
+func ParseHTTPRequest(s string) *http.Request {
+	return nil
+}
+
+func NewRequestParser() *RequestParser {
+	return &RequestParser{}
+}
+
+func CopyUserIDs(ids []int) []int {
+	return ids
+}
+
+func ReadAll() {
+}
+
+func ToUpper(s string) string {
+	return s
+}
+
+type RequestParser struct {
+	MaxLen int
+}
+
+func (p *RequestParser) IsEmpty() bool {
+	return true
+}
+
+func (p *RequestParser) String() string {
+	return ""
+}
+
+type URLMap map[string]string
+
+type EventHandler func()
+
+const DefaultTimeout = 10
+
+var max_line_len = 80
+
+var Max_line_len = 80
@@ -0,0 +1,13 @@
+package main // <<<<< godoc,1,1,1,1,pass
+
+func main() {
+}
+
+func ReadConfigurationFromEnvironmentVariablesAndCommandLineFlags() {
+}
+
+type (
+	RetryPolicyForTransientNetworkErrorsDuringUpload struct{}
+	// Short is short.
+	Short int
+)
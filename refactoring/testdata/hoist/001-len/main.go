@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func printLast(s []int) {
+	if len(s) > 0 {
+		fmt.Println(s[len(s)-1]) // <<<<< hoist,7,17,7,24,last,pass
+		fmt.Println(len(s)-1, s[len(s)-1]*2)
+	}
+}
+
+func main() {
+	printLast([]int{1, 2, 3})
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+func ends(s []int) int {
+	a := len(s) - 1 // <<<<< hoist,6,7,6,16,n,pass
+	b := len(s) - 1
+	s = append(s, 1)
+	c := len(s) - 1
+	return a + b + c
+}
+
+func main() {
+	fmt.Println(ends([]int{1, 2, 3}))
+}
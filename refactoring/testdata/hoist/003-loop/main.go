@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+func area(x, y int) int {
+	total := x*y + 1 // <<<<< hoist,6,11,6,13,product,pass
+	for i := 0; i < 3; i++ {
+		total += x * y
+	}
+	return total + x*y
+}
+
+func main() {
+	fmt.Println(area(2, 3))
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func report(s []int, x, y int) { // <<<<< hoist,5,6,5,11,unused,pass
+	fmt.Println(s[len(s)-1], x*y)
+	fmt.Println(len(s)-1, x*y)
+	fmt.Println(x + y)
+}
+
+func main() {
+	report([]int{1, 2, 3}, 1, 2)
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+func next(x int) int {
+	return x + 1
+}
+
+func twice(x int) int {
+	a := next(x) + 1 // <<<<< hoist,10,7,10,17,n,fail
+	b := next(x) + 1
+	return a + b
+}
+
+func main() {
+	fmt.Println(twice(1))
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func ratio(a, b int) int {
+	if b == 0 {
+		return 0
+	}
+	return a/b + a/b // <<<<< hoist,9,9,9,11,q,fail
+}
+
+func main() {
+	fmt.Println(ratio(4, 2))
+}
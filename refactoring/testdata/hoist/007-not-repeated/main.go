@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func sum(x, y int) int {
+	a := x + y // <<<<< hoist,6,7,6,11,s,fail
+	x = 3
+	b := x + y
+	return a + b
+}
+
+func main() {
+	fmt.Println(sum(1, 2))
+}
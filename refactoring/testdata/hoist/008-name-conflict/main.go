@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func sum(x, y int) int {
+	a := x + y // <<<<< hoist,6,7,6,11,b,fail
+	b := x + y
+	return a + b
+}
+
+func main() {
+	fmt.Println(sum(1, 2))
+}
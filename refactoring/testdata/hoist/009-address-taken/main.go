@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+func inc(p *int) {
+	*p++
+}
+
+func sum(x, y int) int {
+	a := x + y // <<<<< hoist,10,7,10,11,s,fail
+	inc(&x)
+	b := x + y
+	return a + b
+}
+
+func main() {
+	fmt.Println(sum(1, 2))
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+func sum(x, y int) int {
+	bump := func() { x++ }
+	a := x + y // <<<<< hoist,7,7,7,11,s,fail
+	bump()
+	b := x + y
+	return a + b
+}
+
+func main() {
+	fmt.Println(sum(1, 2))
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeout is how long to wait.
+const timeout = 5 * time.Second //<<<<<inline,9,7,9,7,pass
+
+func main() {
+	fmt.Println(timeout, timeout*2)
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+var retries = 3
+
+var greeting = "hello"
+
+func main() {
+	fmt.Println(greeting)
+	for i := 0; i < retries; i++ { //<<<<<inline,11,18,11,24,pass
+		fmt.Println(i, -retries)
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+const (
+	a = iota //<<<<<inline,6,2,6,2,fail
+	b = 5
+)
+
+func main() {
+	fmt.Println(a, b)
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+var count = 1 //<<<<<inline,5,5,5,5,fail
+
+func main() {
+	count++
+	fmt.Println(count)
+}
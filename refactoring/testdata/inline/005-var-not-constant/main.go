@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var start = time.Now() //<<<<<inline,8,5,8,5,fail
+
+func main() {
+	fmt.Println(time.Since(start))
+}
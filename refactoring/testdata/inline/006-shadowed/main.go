@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+const size = 4
+
+const max = size * 2 //<<<<<inline,7,7,7,7,fail
+
+func main() {
+	size := 1
+	fmt.Println(size, max)
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+const (
+	first = 1
+	// name is the name to print.
+	name  = "gopher" //<<<<<inline,8,2,8,2,pass
+	third = 3
+)
+
+func main() {
+	fmt.Println(first, name, len(name), third)
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+const (
+	a = 5 //<<<<<inline,6,2,6,2,fail
+	b
+)
+
+func main() {
+	fmt.Println(a, b)
+}
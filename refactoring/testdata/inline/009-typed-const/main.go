@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const delay time.Duration = 5
+
+func main() {
+	fmt.Println(delay * time.Millisecond) //<<<<<inline,11,14,11,18,pass
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const pi = math.Pi //<<<<<inline,8,7,8,7,pass
+
+func main() {
+	fmt.Println("unused")
+}
@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+func swapEnds(s []int) {
+	if len(s) > 1 {
+		last := len(s) - 1
+		s[0], s[last] = s[last], s[0] // <<<<< inlinelocal,8,11,8,11,pass
+	}
+}
+
+func main() {
+	s := []int{1, 2, 3}
+	swapEnds(s)
+	fmt.Println(s)
+}
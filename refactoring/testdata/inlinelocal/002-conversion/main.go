@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func main() {
+	var timeout time.Duration = 5
+	fmt.Println(timeout * time.Second) // <<<<< inlinelocal,10,14,10,14,pass
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+	name := "gopher"
+	upper := strings.ToUpper(name)
+	fmt.Println("Hello,", upper) // <<<<< inlinelocal,11,24,11,24,pass
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func next() int {
+	fmt.Println("next")
+	return 1
+}
+
+func main() {
+	n := next() // <<<<< inlinelocal,11,2,11,2,fail
+	fmt.Println("before")
+	fmt.Println(n)
+}
@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	total := 1 // <<<<< inlinelocal,6,2,6,2,fail
+	total++
+	fmt.Println(total)
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := 1
+	y := x + 1 // <<<<< inlinelocal,7,2,7,2,fail
+	x = 5
+	fmt.Println(x, y)
+}
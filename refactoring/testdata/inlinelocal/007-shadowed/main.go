@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := 1
+	y := x * 2 // <<<<< inlinelocal,7,2,7,2,fail
+	for x := 0; x < 2; x++ {
+		fmt.Println(y)
+	}
+	fmt.Println(x)
+}
@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	if n := 5; n > 3 { // <<<<< inlinelocal,6,5,6,5,fail
+		fmt.Println(n)
+	}
+}
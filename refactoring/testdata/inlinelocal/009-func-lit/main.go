@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := 1
+	y := x + 1 // <<<<< inlinelocal,7,2,7,2,fail
+	f := func() {
+		fmt.Println(y)
+	}
+	x = 2
+	f()
+}
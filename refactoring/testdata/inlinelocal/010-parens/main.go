@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	a, b := 1, 2
+	sum := a + b
+	fmt.Println(sum*2, -sum, sum) // <<<<< inlinelocal,8,14,8,14,pass
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"image"
+)
+
+type Pair struct {
+	Key   string
+	Value int
+}
+
+func main() {
+	p := Pair{"a", 1} // <<<<< keyed,14,7,14,7,pass
+	q := Pair{"b", 2}
+	r := image.Rectangle{image.Point{0, 0}, image.Point{1, 1}}
+	fmt.Println(p, q, r)
+}
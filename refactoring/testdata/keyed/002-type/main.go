@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+type Pair struct { // <<<<< keyed,5,6,5,6,pass
+	Key   string
+	Value int
+}
+
+type Other struct{ A, B int }
+
+func main() {
+	pairs := []*Pair{
+		{"a", 1},
+		&Pair{
+			"b",
+			2, // two
+		},
+	}
+	o := Other{1, 2}
+	fmt.Println(pairs, o, Pair{Key: "c"})
+}
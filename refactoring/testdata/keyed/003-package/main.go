@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"image"
+)
+
+type embedded struct{ n int }
+
+type T struct {
+	*embedded
+	s string
+}
+
+func main() { // <<<<< keyed,15,6,15,6,false,true,pass
+	t := T{&embedded{1}, "x"}
+	r := image.Rectangle{image.Point{0, 0}, image.Pt(1, 1)}
+	anon := struct{ a, b int }{1, 2}
+	fmt.Println(t, r, anon)
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+type Pair struct {
+	Key   string
+	Value int
+}
+
+func main() {
+	p := Pair{Key: "a"} // <<<<< keyed,11,7,11,7,true,fail
+	fmt.Println(p)
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+type Pair struct {
+	Key   string
+	Value int
+}
+
+func next() int { return 1 }
+
+func key() string { return "a" }
+
+func main() {
+	p := Pair{Value: next(), Key: key()} // <<<<< keyed,15,7,15,7,true,fail
+	fmt.Println(p)
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+type Pair struct {
+	Key   string
+	Value int
+}
+
+func main() {
+	p := Pair{Key: "a", Value: 1} // <<<<< keyed,11,7,11,7,fail
+	fmt.Println(p)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+func main() {
+	s := []int{1, 2} // <<<<< keyed,6,7,6,7,fail
+	fmt.Println(s)
+}
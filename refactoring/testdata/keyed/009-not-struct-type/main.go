@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+type List []int // <<<<< keyed,5,6,5,6,fail
+
+func main() {
+	fmt.Println(List{1, 2})
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+// The greeting to display
+var greeting = "Hello" // <<<<< localize,6,5,6,5,pass
+
+func main() {
+	greet("world")
+}
+
+func greet(name string) {
+	fmt.Println(greeting, name)
+}
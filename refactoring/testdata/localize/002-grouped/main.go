@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+var (
+	width  = 80
+	height = 24 // <<<<< localize,7,2,7,2,pass
+)
+
+func main() {
+	fmt.Println(width)
+	area()
+}
+
+func area() {
+	// Compute the area
+	fmt.Println(width * height)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var input = "a,b"
+
+var names = strings.Split(input, ",") // <<<<< localize,10,5,10,5,pass
+
+func main() {
+	fmt.Println(input)
+	show()
+}
+
+func show() {
+	for _, name := range names {
+		fmt.Println(name)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+var counter int // <<<<< localize,5,5,5,5,fail
+
+func main() {
+	next()
+	next()
+}
+
+func next() {
+	counter++
+	fmt.Println(counter)
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+var limit = 3 // <<<<< localize,5,5,5,5,fail
+
+func main() {
+	fmt.Println(limit)
+	check()
+}
+
+func check() {
+	fmt.Println(limit > 2)
+}
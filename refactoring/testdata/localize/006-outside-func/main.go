@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+var limit = 3 // <<<<< localize,5,5,5,5,fail
+
+var double = limit * 2
+
+func main() {
+	fmt.Println(limit, double)
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+var total = 3 // <<<<< localize,5,5,5,5,fail
+
+func main() {
+	fmt.Println(total)
+	total := 4
+	fmt.Println(total)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+const size = 10
+
+var buf = [size]byte{} // <<<<< localize,7,5,7,5,fail
+
+func main() {
+	show(1)
+}
+
+func show(size int) {
+	fmt.Println(len(buf), size)
+}
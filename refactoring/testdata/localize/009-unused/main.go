@@ -0,0 +1,6 @@
+package main
+
+var unused = 3 // <<<<< localize,3,5,3,5,fail
+
+func main() {
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+// Version is the program's version
+var Version = "1.0" // <<<<< localize,6,5,6,5,pass
+
+func main() {
+	fmt.Println(Version)
+}
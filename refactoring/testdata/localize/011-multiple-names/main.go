@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+var a, b = 1, 2 // <<<<< localize,5,8,5,8,fail
+
+func main() {
+	fmt.Println(a, b)
+}
@@ -0,0 +1,7 @@
+package main
+
+import "p"
+
+func main() {
+	p.Run()
+}
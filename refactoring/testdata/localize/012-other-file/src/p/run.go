@@ -0,0 +1,7 @@
+package p
+
+import "fmt"
+
+func Run() {
+	fmt.Fprintln(out, prefix+"hello")
+}
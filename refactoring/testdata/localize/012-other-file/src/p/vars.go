@@ -0,0 +1,8 @@
+package p
+
+import "os"
+
+// Where to write output
+var out = os.Stdout // <<<<< localize,6,5,6,5,fail
+
+var prefix = "> "
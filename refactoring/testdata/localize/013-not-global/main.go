@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := 1 // <<<<< localize,6,2,6,2,fail
+	fmt.Println(x)
+}
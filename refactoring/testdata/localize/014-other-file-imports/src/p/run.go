@@ -0,0 +1,11 @@
+package p
+
+import (
+	"fmt"
+	"os"
+)
+
+func Run() {
+	fmt.Fprintln(out, prefix+"hello")
+	os.Exit(0)
+}
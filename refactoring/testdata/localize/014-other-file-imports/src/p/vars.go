@@ -0,0 +1,11 @@
+package p
+
+import (
+	"fmt"
+	"os"
+)
+
+// Where to write output
+var out = os.Stdout // <<<<< localize,9,5,9,5,pass
+
+var prefix = fmt.Sprint("> ")
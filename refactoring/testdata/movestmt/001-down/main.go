@@ -0,0 +1,16 @@
+// <<<<<move,10,2,10,12,down,pass
+package main
+
+import "fmt"
+
+func main() {
+	items := []int{1, 2, 3}
+
+	// Running total
+	total := 0 // starts at zero
+	fmt.Println("Adding", len(items), "items")
+	for _, item := range items {
+		total += item
+	}
+	fmt.Println(total)
+}
@@ -0,0 +1,14 @@
+// <<<<<move,11,2,12,9,up,pass
+package main
+
+import "fmt"
+
+type point struct{ x, y int }
+
+func main() {
+	p := point{1, 2}
+	fmt.Println("start")
+	q := p
+	q.x = 3
+	fmt.Println(p, q)
+}
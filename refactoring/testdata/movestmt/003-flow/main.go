@@ -0,0 +1,12 @@
+// <<<<<move,9,2,9,7,down,fail
+package main
+
+import "fmt"
+
+func main() {
+	a := 1
+	b := 2
+	a = 3
+	c := a + b
+	fmt.Println(c)
+}
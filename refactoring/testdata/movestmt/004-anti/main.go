@@ -0,0 +1,11 @@
+// <<<<<move,8,2,8,8,down,fail
+package main
+
+import "fmt"
+
+func main() {
+	a := 1
+	b := a
+	a = 3
+	fmt.Println(a, b)
+}
@@ -0,0 +1,12 @@
+// <<<<<move,9,2,9,11,down,fail
+package main
+
+import "fmt"
+
+func main() {
+	a, b := 1, 2
+	fmt.Println(a, b)
+	a = b * 2
+	a = b + 1
+	fmt.Println(a)
+}
@@ -0,0 +1,10 @@
+// <<<<<move,8,2,8,9,up,fail
+package main
+
+import "fmt"
+
+func main() {
+	type celsius float64
+	var t celsius = 20
+	fmt.Println(t)
+}
@@ -0,0 +1,13 @@
+// <<<<<move,10,3,10,9,up,fail
+package main
+
+import "fmt"
+
+func main() {
+	n := 1
+	{
+		fmt.Println(n)
+		n := 2
+		_ = n
+	}
+}
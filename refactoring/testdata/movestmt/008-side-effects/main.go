@@ -0,0 +1,15 @@
+// <<<<<move,12,2,12,11,down,fail
+package main
+
+import "fmt"
+
+var counter int
+
+func record() { fmt.Println(counter) }
+
+func main() {
+	x := 1
+	counter++
+	record()
+	fmt.Println(x)
+}
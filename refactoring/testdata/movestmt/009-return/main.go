@@ -0,0 +1,17 @@
+// <<<<<move,8,2,10,3,down,fail
+package main
+
+import "fmt"
+
+func check(n int) int {
+	result := n * 2
+	if n < 0 {
+		return 0
+	}
+	fmt.Println("checked")
+	return result
+}
+
+func main() {
+	fmt.Println(check(3))
+}
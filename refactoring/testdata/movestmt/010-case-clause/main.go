@@ -0,0 +1,18 @@
+// <<<<<move,12,3,12,13,up,pass
+package main
+
+import "fmt"
+
+func main() {
+	for i := 0; i < 3; i++ {
+		switch i {
+		case 1:
+			fmt.Println("one")
+			x := i * 2
+			y := i + 1 // the successor
+			fmt.Println(x, y)
+		default:
+			fmt.Println("other")
+		}
+	}
+}
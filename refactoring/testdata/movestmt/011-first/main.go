@@ -0,0 +1,9 @@
+// <<<<<move,7,2,7,8,up,fail
+package main
+
+import "fmt"
+
+func main() {
+	a := 1
+	fmt.Println(a)
+}
@@ -0,0 +1,15 @@
+// <<<<<move,9,1,10,5,up,fail
+package main
+
+import "fmt"
+
+func main() {
+	n := 0
+	m := 1
+again:
+	n++
+	if n < 3 {
+		goto again
+	}
+	fmt.Println(n, m)
+}
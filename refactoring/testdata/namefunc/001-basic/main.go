@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+func main() {
+	words := []string{"pear", "fig", "banana"}
+	less := func(i, j int) bool { // <<<<< namefunc,10,10,10,10,byLength,pass
+		return i < j
+	}
+	sort.Slice(words, less)
+	fmt.Println(words)
+}
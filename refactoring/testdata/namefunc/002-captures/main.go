@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func main() {
+	prefix, count := "> ", 0
+	for _, arg := range []string{"a", "b"} {
+		count++
+		func(s string) { // <<<<< namefunc,9,3,9,3,printLine,pass
+			fmt.Println(prefix, count, s)
+		}(arg)
+	}
+}
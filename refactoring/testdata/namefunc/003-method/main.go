@@ -0,0 +1,19 @@
+package main
+
+import "fmt"
+
+type counter struct {
+	n int
+}
+
+func (c *counter) incrementer() func(int) {
+	return func(by int) { // <<<<< namefunc,10,9,10,9,add,pass
+		c.n += by
+	}
+}
+
+func main() {
+	c := &counter{}
+	c.incrementer()(2)
+	fmt.Println(c.n)
+}
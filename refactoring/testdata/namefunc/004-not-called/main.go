@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	x, y := 1, 2
+	f := func() int { // <<<<< namefunc,7,7,7,7,sum,fail
+		return x + y
+	}
+	fmt.Println(f())
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	total := 0
+	func(n int) { // <<<<< namefunc,7,2,7,2,add,fail
+		total += n
+	}(5)
+	fmt.Println(total)
+}
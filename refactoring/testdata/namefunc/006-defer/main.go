@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func run(name string) {
+	defer func() { // <<<<< namefunc,6,8,6,8,done,pass
+		fmt.Println("done:", name)
+	}()
+	fmt.Println("running:", name)
+}
+
+func main() {
+	run("job")
+}
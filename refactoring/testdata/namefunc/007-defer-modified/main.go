@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func run(name string) {
+	defer func() { // <<<<< namefunc,6,8,6,8,done,fail
+		fmt.Println("done:", name)
+	}()
+	name = "renamed"
+}
+
+func main() {
+	run("job")
+}
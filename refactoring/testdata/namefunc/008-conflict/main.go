@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func main() {
+	f := func() { // <<<<< namefunc,6,7,6,7,helper,fail
+		fmt.Println("hello")
+	}
+	f()
+}
+
+func helper() {}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	type point struct{ x, y int }
+	p := point{1, 2}
+	func() { // <<<<< namefunc,8,2,8,2,show,fail
+		fmt.Println(p.x, p.y)
+	}()
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func main() {
+	n := 1
+	p := &n
+	func() { // <<<<< namefunc,8,2,8,2,show,fail
+		*p = 2
+		fmt.Println(n)
+	}()
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+)
+
+func main() {
+	h := md5.New()
+	sum := func(s string) []byte { // <<<<< namefunc,10,9,10,9,hashString,pass
+		h.Reset()
+		h.Write([]byte(s))
+		return h.Sum(nil)
+	}("hello")
+	fmt.Printf("%x\n", sum)
+}
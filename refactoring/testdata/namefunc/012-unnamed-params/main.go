@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	n := 42
+	(func(string) { // <<<<< namefunc,7,3,7,3,show,pass
+		fmt.Println(n)
+	})("ignored")
+}
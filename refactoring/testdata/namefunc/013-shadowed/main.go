@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+func main() {
+	show := 1
+	f := func() { // <<<<< namefunc,7,7,7,7,show,fail
+		fmt.Println("hello")
+	}
+	f()
+	fmt.Println(show)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type Server struct {
+	host    string
+	port    int
+	timeout time.Duration
+}
+
+// NewServer returns a new Server.
+func NewServer(host string, port int, timeout time.Duration) *Server { // <<<<< options,15,6,15,6,pass
+	if port == 0 {
+		port = 80
+	}
+	return &Server{host, port, timeout}
+}
+
+func main() {
+	s := NewServer("localhost", 8080, 5*time.Second)
+	t := NewServer("example.com", 0, 0)
+	fmt.Println(s, t)
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+type Client struct {
+	name, addr string
+	retries    int
+	verbose    bool
+}
+
+func NewClient(name, addr string, retries int, verbose bool) *Client { // <<<<< options,11,6,11,6,1,pass
+	return &Client{name, addr, retries, verbose}
+}
+
+func main() {
+	fmt.Println(NewClient("a", "b", 3, false))
+	fmt.Println(NewClient("a", "", 0, true))
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+func newGreeter(greeting string, names ...string) string { // <<<<< options,5,6,5,6,pass
+	s := greeting
+	for _, name := range names {
+		s += " " + name
+	}
+	return s
+}
+
+func main() {
+	fmt.Println(newGreeter("Hello"))
+	fmt.Println(newGreeter("Hi", "Alice", "Bob"))
+	others := []string{"Carol"}
+	fmt.Println(newGreeter("", others...))
+}
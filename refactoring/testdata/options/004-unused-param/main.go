@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+type T struct{ a int }
+
+func New(a int, reserved string, opts bool) *T { // <<<<< options,7,6,7,6,pass
+	if opts {
+		return nil
+	}
+	return &T{a}
+}
+
+func main() {
+	fmt.Println(New(1, "x", false))
+}
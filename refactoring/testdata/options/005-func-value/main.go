@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+func NewPair(a, b int) [2]int { // <<<<< options,5,6,5,6,fail
+	return [2]int{a, b}
+}
+
+func two() (int, int) { return 1, 2 }
+
+func main() {
+	f := NewPair
+	fmt.Println(f(1, 2), NewPair(two()))
+}
@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func NewPair(a, b int) [2]int { // <<<<< options,5,6,5,6,fail
+	return [2]int{a, b}
+}
+
+func WithB() {}
+
+func main() {
+	fmt.Println(NewPair(1, 2))
+}
@@ -0,0 +1,11 @@
+package main
+
+type T struct{}
+
+func (T) Make(a, b int) int { // <<<<< options,5,10,5,10,fail
+	return a + b
+}
+
+func main() {
+	println(T{}.Make(1, 2))
+}
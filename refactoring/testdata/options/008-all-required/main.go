@@ -0,0 +1,9 @@
+package main
+
+func NewPair(a, b int) [2]int { // <<<<< options,3,6,3,6,2,fail
+	return [2]int{a, b}
+}
+
+func main() {
+	println(NewPair(1, 2)[0])
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func NewPair(a, b int) [2]int { // <<<<< options,5,6,5,6,1,false,pass
+	return [2]int{a, b}
+}
+
+func main() {
+	fmt.Println("no calls")
+}
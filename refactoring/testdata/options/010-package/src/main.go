@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	srv "server"
+)
+
+func main() {
+	fmt.Println(srv.New("localhost", 8080))
+}
@@ -0,0 +1,12 @@
+package server
+
+// Server is a server.
+type Server struct {
+	Host string
+	Port int
+}
+
+// New returns a new Server.
+func New(host string, port int) *Server { // <<<<< options,10,6,10,6,1,pass
+	return &Server{host, port}
+}
@@ -8,7 +8,7 @@ var hello = ":-(" // This is a different hello
 func main() {
 	hello = ":-)" // Don't change this
 
-	var hello string = "Hello" // <<<<< rename,11,6,11,6,renamed,pass
+	var hello string = "Hello" // <<<<< rename,11,6,11,6,renamed,true,pass
 	var world string = "world"
 	hello = hello + ", " + world // hello
 	hello += "!"
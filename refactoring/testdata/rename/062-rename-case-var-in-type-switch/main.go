@@ -10,7 +10,7 @@ func main() {
 	case bool:
 		fmt.Printf("boolean %t\n", t)
 	case int:
-		fmt.Printf("integer %d\n", t) //<<<<<rename,13,30,13,30,renamed,pass
+		fmt.Printf("integer %d\n", t) //<<<<<rename,13,30,13,30,renamed,fail
 	case *bool:
 		fmt.Printf("pointer to boolean %t\n", *t)
 	case *int:
@@ -8,7 +8,7 @@ func main() {
 	// hello
 	hello := "hello"
 	// hello
-	x := func(hello string) { // <<<<<rename,11,12,11,12,xxx,pass
+	x := func(hello string) { // <<<<<rename,11,12,11,12,xxx,true,pass
 		// hello
 		fmt.Println(hello)
 		// hello
@@ -9,5 +9,5 @@ type I interface {
 type T int
 
 // m
-func (T) m() { //<<<<<rename,12,10,12,10,xyz,pass
+func (T) m() { //<<<<<rename,12,10,12,10,xyz,true,pass
 }
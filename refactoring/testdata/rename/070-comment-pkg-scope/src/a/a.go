@@ -5,5 +5,5 @@ func M() {
 }
 
 // m
-func m() { //<<<<<rename,8,6,8,6,xyz,pass
+func m() { //<<<<<rename,8,6,8,6,xyz,true,pass
 }
@@ -8,7 +8,7 @@ func main() {
 	// hello
 	var x interface{} = "hello"
 	// hello
-	switch hello := x.(type) { // <<<<<rename,11,9,11,9,xxx,pass
+	switch hello := x.(type) { // <<<<<rename,11,9,11,9,xxx,true,pass
 	// hello
 	case int:
 		// hello
@@ -0,0 +1,19 @@
+package main
+
+import "fmt"
+
+// count is a package-level variable; it should not be renamed.
+var count = 3
+
+// repeat prints s count times.  If count is negative, repeat prints nothing;
+// the word "counts" and the name s are left alone unless they are the
+// parameter being renamed.
+func repeat(s string, count int) { // <<<<<rename,11,23,11,23,n,pass
+	for i := 0; i < count; i++ {
+		fmt.Println(s)
+	}
+}
+
+func main() {
+	repeat("hello", count)
+}
@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+// Runner runs things.
+type Runner struct{}
+
+// Run the task.  Call `Run` (or r.Run, or [Runner.Run], or Run()) to run it;
+// Runs and RunAll are unrelated.
+func (r Runner) Run() { // <<<<< rename,10,17,10,17,Start,pass
+	fmt.Println("Run") // Run is called below
+}
+
+func main() {
+	Runner{}.Run()
+}
@@ -0,0 +1,20 @@
+// Package a provides [T] and [U].  Use [T.Run] to run a [T], and [U.Run] to
+// run a [U].
+package a
+
+// T is a runnable type.
+type T struct{}
+
+// Run runs [T]; see also [U.Run] and [Helper].
+func (T) Run() { //<<<<<rename,9,10,9,10,Start,pass
+	Helper()
+}
+
+// U is another runnable type.
+type U struct{}
+
+// Run runs [U], not [T.Run].
+func (U) Run() {}
+
+// Helper is called by [T.Run] and [*T.Run].
+func Helper() {}
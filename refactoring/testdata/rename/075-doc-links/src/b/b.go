@@ -0,0 +1,8 @@
+package b
+
+import "a"
+
+// Wrapper wraps an [a.T]; call [a.T.Run] (not [a.U.Run]) to run it.
+type Wrapper struct {
+	a.T
+}
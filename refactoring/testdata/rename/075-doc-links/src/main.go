@@ -0,0 +1,12 @@
+package main
+
+import (
+	"a"
+	"b"
+)
+
+// main calls [a.T.Run] via [b.Wrapper.Run], and [a.U.Run].
+func main() {
+	b.Wrapper{}.Run()
+	a.U{}.Run()
+}
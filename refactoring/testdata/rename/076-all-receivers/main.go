@@ -0,0 +1,30 @@
+package main
+
+import "fmt"
+
+type T struct{ n int }
+
+// Get returns the value of this.
+func (this *T) Get() int { // <<<<< rename,8,7,8,7,t,false,true,pass
+	return this.n
+}
+
+func (self *T) Set(n int) {
+	self.n = n
+}
+
+func (T) Unnamed() {}
+
+func (_ T) Blank() {}
+
+func (t T) Already() int { return t.n }
+
+type U struct{}
+
+func (this U) Other() {}
+
+func main() {
+	this := &T{}
+	this.Set(1)
+	fmt.Println(this.Get())
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+type T struct{ n int }
+
+func (this *T) Get() int { // <<<<< rename,7,7,7,7,t,false,true,fail
+	return this.n
+}
+
+func (self *T) Set(t int) {
+	self.n = t
+}
+
+func main() {
+	fmt.Println(new(T).Get())
+}
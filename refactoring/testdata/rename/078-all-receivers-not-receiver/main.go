@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+type T struct{ n int }
+
+func (this *T) Get() int {
+	return this.n
+}
+
+func main() {
+	this := &T{} // <<<<< rename,12,2,12,2,t,false,true,pass
+	fmt.Println(this.Get())
+}
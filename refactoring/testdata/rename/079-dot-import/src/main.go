@@ -0,0 +1,10 @@
+package main
+
+import . "a"
+
+// main calls Greet().
+func main() {
+	Greet()
+	f := Greet
+	f()
+}
@@ -0,0 +1,6 @@
+package a
+
+// Greet prints a greeting.
+func Greet() { //<<<<<rename,4,6,4,6,Hello,fail
+	println("hi")
+}
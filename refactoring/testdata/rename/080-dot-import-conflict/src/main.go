@@ -0,0 +1,12 @@
+package main
+
+import . "a"
+
+func Hello() {
+	println("hello")
+}
+
+func main() {
+	Greet()
+	Hello()
+}
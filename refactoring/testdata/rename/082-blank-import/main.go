@@ -0,0 +1,10 @@
+package main
+
+import (
+	_ "image/png" //<<<<<rename,4,2,4,2,png,fail
+	"strings"
+)
+
+func main() {
+	println(strings.ToUpper("a"))
+}
@@ -0,0 +1,7 @@
+package main
+
+import . "strings" //<<<<<rename,3,8,3,8,s,fail
+
+func main() {
+	println(ToUpper("a"))
+}
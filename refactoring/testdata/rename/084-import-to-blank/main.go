@@ -0,0 +1,10 @@
+package main
+
+import (
+	_ "image/png"
+	s "strings" //<<<<<rename,5,2,5,2,_,fail
+)
+
+func main() {
+	println(s.ToUpper("a"))
+}
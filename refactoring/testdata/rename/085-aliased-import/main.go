@@ -0,0 +1,10 @@
+package main
+
+import (
+	_ "strings"
+	s "strings" //<<<<<rename,5,2,5,2,str,pass
+)
+
+func main() {
+	println(s.ToUpper("a"))
+}
@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	count := 1 //<<<<<rename,6,2,6,2,total,fail
+	fmt.Println(count)
+	fmt.Println(undefinedName)
+}
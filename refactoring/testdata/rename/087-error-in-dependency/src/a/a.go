@@ -0,0 +1,9 @@
+package a
+
+func Value() int {
+	return 1
+}
+
+func broken() {
+	undefinedName()
+}
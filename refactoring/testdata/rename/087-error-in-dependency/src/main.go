@@ -0,0 +1,11 @@
+package main
+
+import (
+	"a"
+	"fmt"
+)
+
+func main() {
+	count := a.Value() //<<<<<rename,9,2,9,2,total,pass
+	fmt.Println(count)
+}
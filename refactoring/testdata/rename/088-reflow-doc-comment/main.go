@@ -0,0 +1,19 @@
+package main
+
+// Config holds the settings read from the command line.  A Config is created
+// by parsing the arguments:
+//
+//	c := parse(os.Args)
+type Config struct { //<<<<<rename,7,6,7,6,ApplicationConfiguration,true,pass
+	// Verbose reports whether a Config was created with -v.
+	Verbose bool
+}
+
+// parse returns a Config.
+func parse(args []string) Config {
+	return Config{Verbose: len(args) > 1}
+}
+
+func main() {
+	println(parse(nil).Verbose)
+}
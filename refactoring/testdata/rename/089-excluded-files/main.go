@@ -0,0 +1,13 @@
+package main
+
+type Greeter struct{}
+
+func (g Greeter) helper() string { return "method" }
+
+func helper() string { //<<<<<rename,7,6,7,6,assist,false,false,true,pass
+	return "default"
+}
+
+func main() {
+	println(helper(), Greeter{}.helper())
+}
@@ -0,0 +1,15 @@
+//go:build plan9
+// +build plan9
+
+package main
+
+func init() {
+	println(helper())
+	println(Greeter{}.helper())
+	{
+		helper := 1 // a local variable, not the function
+		println(helper)
+	}
+}
+
+func (g Greeter) other() func() string { return helper }
@@ -0,0 +1,13 @@
+package main
+
+type Greeter struct{}
+
+func (g Greeter) helper() string { return "method" } //<<<<<rename,5,18,5,18,greet,false,false,true,pass
+
+func helper() string {
+	return "default"
+}
+
+func main() {
+	println(helper(), Greeter{}.helper())
+}
@@ -0,0 +1,12 @@
+//go:build plan9
+// +build plan9
+
+package main
+
+type Other struct{}
+
+func (o Other) helper() {}
+
+func (g *Greeter) String() string {
+	return g.helper() + helper()
+}
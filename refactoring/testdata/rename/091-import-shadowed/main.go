@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+func main() {
+	n := 1 //<<<<<rename,6,2,6,2,fmt,fail
+	fmt.Println(n)
+}
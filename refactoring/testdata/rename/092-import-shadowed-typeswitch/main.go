@@ -0,0 +1,13 @@
+package main
+
+import "fmt"
+
+func main() {
+	var x interface{} = 1
+	switch v := x.(type) { //<<<<<rename,7,9,7,9,fmt,fail
+	case int:
+		fmt.Println(v + 1)
+	case string:
+		println(v)
+	}
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(double(2))
+}
+
+func double(n int) int { //<<<<<rename,9,13,9,13,fmt,pass
+	return n * 2
+}
@@ -0,0 +1,12 @@
+package greet
+
+import "fmt"
+
+// Greet prints a greeting to each of the given names.
+func Greet(_ string, names ...string) (int, error) { //<<<<<rename,6,6,6,6,Welcome,false,false,false,true,pass
+	return fmt.Println("Hello,", names)
+}
+
+func greetAll() {
+	Greet("", "world")
+}
@@ -0,0 +1,10 @@
+package greet
+
+import "fmt"
+
+type Greeter struct{ greeting string }
+
+// Say prints a greeting.
+func (*Greeter) Say(name string) { //<<<<<rename,8,17,8,17,Speak,false,false,false,true,pass
+	fmt.Println("Hello,", name)
+}
@@ -0,0 +1,10 @@
+package greet
+
+type (
+	Name  string //<<<<<rename,4,2,4,2,Text,false,false,false,true,pass
+	Count int
+)
+
+func (n Name) String() string {
+	return string(n)
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+// A Weekday is a day of the week.
+type Weekday int // <<<<< stringer,6,6,6,12,pass
+
+const (
+	Sunday Weekday = 0
+	Monday Weekday = 1
+	Friday Weekday = 5
+	Funday Weekday = 5 // Same as Friday
+)
+
+func main() {
+	fmt.Println(Monday, Weekday(3))
+}
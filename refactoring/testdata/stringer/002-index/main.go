@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+type Color int
+
+const (
+	Red Color = iota
+	Green // <<<<< stringer,9,2,9,6,pass
+	Blue
+)
+
+func main() {
+	fmt.Println(Red, Blue)
+}
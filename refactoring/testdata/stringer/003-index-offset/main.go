@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	conv "strconv"
+)
+
+type Level int8
+
+const (
+	Low Level = iota - 1
+	Medium
+	High // <<<<< stringer,13,2,13,5,index,pass
+)
+
+func main() {
+	fmt.Println(Low, conv.Itoa(int(High)))
+}
@@ -0,0 +1,18 @@
+// Copyright 2018 The Authors.
+
+package main
+
+import "fmt"
+
+type Suit int // <<<<< stringer,7,6,7,9,,suit_string,pass
+
+const (
+	Clubs Suit = iota + 1
+	Diamonds
+	Hearts
+	Spades
+)
+
+func main() {
+	fmt.Println(Hearts)
+}
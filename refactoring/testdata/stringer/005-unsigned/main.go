@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+type Flag uint
+
+const (
+	FlagA Flag = 1 << iota // <<<<< stringer,8,2,8,6,switch,pass
+	FlagB
+	FlagC
+)
+
+const FlagNone Flag = 0
+
+func main() {
+	fmt.Println(FlagA | FlagC)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+type Color int // <<<<< stringer,5,6,5,10,fail
+
+const Red Color = 0
+
+func (c Color) String() string {
+	return "red"
+}
+
+func main() {
+	fmt.Println(Red)
+}
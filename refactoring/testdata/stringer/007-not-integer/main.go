@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+type Color string // <<<<< stringer,5,6,5,10,fail
+
+const Red Color = "red"
+
+func main() {
+	fmt.Println(Red)
+}
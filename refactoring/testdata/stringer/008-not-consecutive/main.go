@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+type Code int // <<<<< stringer,5,6,5,9,index,fail
+
+const (
+	OK       Code = 200
+	NotFound Code = 404
+)
+
+func main() {
+	fmt.Println(OK, NotFound)
+}
@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+type Count int // <<<<< stringer,5,6,5,10,fail
+
+func main() {
+	fmt.Println(Count(3))
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+type Suit int // <<<<< stringer,5,6,5,9,,suit_string,pass
+
+const (
+	Clubs Suit = iota + 1
+	Diamonds
+)
+
+func main() {
+	fmt.Println(Diamonds)
+}
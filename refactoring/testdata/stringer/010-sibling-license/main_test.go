@@ -0,0 +1,3 @@
+// Copyright 2018 The Authors.
+
+package main
@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+// A Level is a logging level.
+type Level int // <<<<< stringer,6,6,6,10,pass
+
+const (
+	Debug Level = iota
+	Info
+	Error
+)
+
+// Enabled reports whether messages at level m should be logged.
+func (lvl Level) Enabled(m Level) bool {
+	return m >= lvl
+}
+
+func (lvl Level) Next() Level {
+	return lvl + 1
+}
+
+func (Level) Max() Level {
+	return Error
+}
+
+func main() {
+	fmt.Println(Info, Info.Enabled(Error))
+}
@@ -0,0 +1,11 @@
+// <<<<< toggle,8,3,8,15,pass
+package main
+
+import "fmt"
+
+func main() {
+	if true {
+		i, j := 2, 7.9
+		fmt.Println("The value of variables i,j are :", i, j)
+	}
+}
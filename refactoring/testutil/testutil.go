@@ -29,6 +29,15 @@
 // the refactoring is expected to succeed, the resulting file is compared
 // against a .golden file with the same name in the same directory.
 //
+// Each test directory is run as a subtest, so a single test can also be run
+// with -run, e.g.,
+//     go test -run TestRefactorings/rename/001-local
+//
+// The same tests can be run in module mode using TestRefactoringsInModuleMode,
+// which synthesizes a go.mod file for each test directory; the same .golden
+// files are expected in both modes.  Since this doubles the time taken by the
+// tests, the module-mode tests are skipped when -short is given.
+//
 // Each test directory (001-test-name, 002-test-name, etc.) is treated as the
 // root of a Go workspace when its tests are run; i.e., the GOPATH is set to
 // the test directory.  This allows it to define its own packages.  In such
@@ -54,12 +63,18 @@
 // The actual debug output usually includes absolute paths; to be testable,
 // all occurrences of the current working directory are replaced with "." when
 // comparing against this file.
+//
+// If the expected output depends on the Go version, filename.go.go1.N.golden
+// (or filename.go.go1.N.debugOutput) gives the output expected from Go 1.N and
+// later; the file with the largest N not exceeding the current Go version is
+// used, or the .golden (or .debugOutput) file if there is none.
 
 package testutil
 
 import (
 	"flag"
 	"fmt"
+	"go/build"
 	"go/parser"
 	"go/token"
 	"io"
@@ -88,36 +103,95 @@ var filterFlag = flag.String("filter", "",
 	"Only tests from directories containing this substring will be run")
 
 func TestRefactorings(directory string, t *testing.T) {
+	cwd, err := os.Getwd()
+	failIfError(err, t)
+	runAllTests(directory, cwd, t)
+}
+
+// TestRefactoringsInModuleMode runs the same tests as TestRefactorings, but
+// in module mode.  The given directory is copied into a temporary directory,
+// and a go.mod file is synthesized for each test directory that does not
+// already contain one (see synthesizeModule), so that the same .golden files
+// are expected whether the tests are loaded from a GOPATH or from a module.
+// The tests are skipped in short mode.
+func TestRefactoringsInModuleMode(directory string, t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping refactoring tests in module mode in short mode")
+	}
+	tmp, err := ioutil.TempDir("", "godoctor")
+	failIfError(err, t)
+	defer os.RemoveAll(tmp)
+	// Debug output contains paths in the copy, which may differ from
+	// tmp if it is reached via a symbolic link (e.g., on macOS)
+	tmp, err = filepath.EvalSymlinks(tmp)
+	failIfError(err, t)
+
+	dir := filepath.Join(tmp, filepath.Clean(directory))
+	failIfError(copyDir(directory, dir), t)
+	testDirs, err := ioutil.ReadDir(dir)
+	failIfError(err, t)
+	for _, testDirInfo := range testDirs {
+		if !testDirInfo.IsDir() {
+			continue
+		}
+		subDirs, err := ioutil.ReadDir(filepath.Join(dir, testDirInfo.Name()))
+		failIfError(err, t)
+		for _, subDirInfo := range subDirs {
+			if subDirInfo.IsDir() {
+				subDirPath := filepath.Join(dir,
+					testDirInfo.Name(), subDirInfo.Name())
+				failIfError(synthesizeModule(subDirPath), t)
+			}
+		}
+	}
+
+	// Arguments naming files (e.g., an edit script) are relative to the
+	// current directory, so the tests are run from the copy
+	cwd, err := os.Getwd()
+	failIfError(err, t)
+	failIfError(os.Chdir(tmp), t)
+	defer os.Chdir(cwd)
+	runAllTests(dir, tmp, t)
+}
+
+// runAllTests runs the tests in each subdirectory of the given directory.
+// Occurrences of root are replaced with "." when debug output is compared
+// against the expected output; it is normally the current directory.
+func runAllTests(directory string, root string, t *testing.T) {
 	testDirs, err := ioutil.ReadDir(directory)
 	failIfError(err, t)
 	for _, testDirInfo := range testDirs {
 		if testDirInfo.IsDir() {
-			runAllTestsInSubdirectories(directory, testDirInfo, t)
+			runAllTestsInSubdirectories(directory, root, testDirInfo, t)
 		}
 	}
 }
 
-func runAllTestsInSubdirectories(directory string, testDirInfo os.FileInfo, t *testing.T) {
+func runAllTestsInSubdirectories(directory string, root string, testDirInfo os.FileInfo, t *testing.T) {
 	testDirPath := filepath.Join(directory, testDirInfo.Name())
 	subDirs, err := ioutil.ReadDir(testDirPath)
 	failIfError(err, t)
-	for _, subDirInfo := range subDirs {
-		if subDirInfo.IsDir() {
-			subDirPath := filepath.Join(testDirPath, subDirInfo.Name())
-			if strings.Contains(subDirPath, *filterFlag) {
-				runAllTestsInDirectory(subDirPath, t)
+	t.Run(testDirInfo.Name(), func(t *testing.T) {
+		for _, subDirInfo := range subDirs {
+			if subDirInfo.IsDir() {
+				subDirPath := filepath.Join(testDirPath, subDirInfo.Name())
+				if strings.Contains(subDirPath, *filterFlag) {
+					t.Run(subDirInfo.Name(), func(t *testing.T) {
+						runAllTestsInDirectory(subDirPath, root, t)
+					})
+				}
 			}
 		}
-	}
+	})
 }
 
 // RunAllTests is a utility method that runs a set of refactoring tests
 // based on markers in all of the files in subdirectories of a given directory
-func runAllTestsInDirectory(directory string, t *testing.T) {
+func runAllTestsInDirectory(directory string, root string, t *testing.T) {
 	files, err := recursiveReadDir(directory)
 	failIfError(err, t)
 
-	runTestsInFiles(directory, files, t)
+	runTestsInFiles(directory, root, files, t)
 }
 
 // Assumes no duplication or circularity due to symbolic links
@@ -154,7 +228,7 @@ func failIfError(err error, t *testing.T) {
 	}
 }
 
-func runTestsInFiles(directory string, files []string, t *testing.T) {
+func runTestsInFiles(directory string, root string, files []string, t *testing.T) {
 	markers := make(map[string][]string)
 	for _, path := range files {
 		if strings.HasSuffix(path, ".go") {
@@ -171,12 +245,12 @@ func runTestsInFiles(directory string, files []string, t *testing.T) {
 
 	for path, markersInFile := range markers {
 		for _, marker := range markersInFile {
-			runRefactoring(directory, path, marker, t)
+			runRefactoring(directory, root, path, marker, t)
 		}
 	}
 }
 
-func runRefactoring(directory string, filename string, marker string, t *testing.T) {
+func runRefactoring(directory string, root string, filename string, marker string, t *testing.T) {
 	refac, selection, remainder, passFail := splitMarker(filename, marker, t)
 
 	r := engine.GetRefactoring(refac)
@@ -220,9 +294,17 @@ func runRefactoring(directory string, filename string, marker string, t *testing
 		Scope:      []string{mainFile},
 		Selection:  selection,
 		Args:       args,
-		GoPath:     gopath,
 		ModulesOff: modulesOff,
 	}
+	if modulesOff {
+		config.GoPath = gopath
+	} else {
+		// Run the go command in the module, and never let it download
+		// modules or update go.mod
+		config.Dir = gopath
+		config.Env = []string{"GOWORK=off", "GOPROXY=off",
+			"GOFLAGS=-mod=mod"}
+	}
 	result := r.Run(config)
 	if shouldPass && result.Log.ContainsErrors() {
 		t.Log(result.Log)
@@ -236,7 +318,8 @@ func runRefactoring(directory string, filename string, marker string, t *testing
 
 	debugOutput := result.DebugOutput.String()
 	if len(debugOutput) > 0 {
-		debugOutputFilename, err := findExpectedOutput(filename, t)
+		debugOutputFilename, err := findExpectedOutput(filename,
+			"debugOutput", filename+".debugOutput", t)
 		if err != nil {
 			t.Error(err)
 			return
@@ -246,8 +329,8 @@ func runRefactoring(directory string, filename string, marker string, t *testing
 			t.Error(err)
 			return
 		}
-		expectedOutput := sanitize(string(bytes), false)
-		actualOutput := sanitize(debugOutput, true)
+		expectedOutput := sanitize(string(bytes), "")
+		actualOutput := sanitize(debugOutput, root)
 		if expectedOutput != actualOutput {
 			fmt.Printf(">>>>> Debug output does not match contents of %s\n", debugOutputFilename)
 			fmt.Printf(">>>>> NOTE: All occurrences of the working directory name are replaced by \".\"\n")
@@ -283,6 +366,105 @@ func runRefactoring(directory string, filename string, marker string, t *testing
 	if err != nil {
 		t.Error(err)
 	}
+
+	// Files that the refactoring would create are compared against .golden
+	// files, just like the files it edits (e.g., a new point.go is compared
+	// against point.golden), but they are not actually created
+	if shouldPass {
+		for _, change := range result.FSChanges {
+			if c, ok := change.(*filesystem.CreateFile); ok {
+				checkResult(c.Path, c.Contents, t)
+			}
+		}
+	}
+}
+
+// copyDir recursively copies the files in the directory src into dst.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, contents, info.Mode().Perm())
+	})
+}
+
+// synthesizeModule makes the given test directory, which is laid out as a
+// GOPATH workspace, the root of a module, unless it already contains a go.mod
+// file.  Packages in the directory itself (and its src subdirectory) belong
+// to the main module.  Packages below src are imported by their GOPATH import
+// paths (e.g., "mypackage"), so the topmost directory below src containing
+// each such package is made the root of a module whose path is that import
+// path, and the main module requires it and replaces it with the directory.
+// Each module declares the version of the running Go toolchain, which is the
+// version assumed in GOPATH mode.
+func synthesizeModule(directory string) error {
+	if _, err := os.Stat(filepath.Join(directory, GO_DOT_MOD)); err == nil {
+		return nil
+	}
+	tags := build.Default.ReleaseTags
+	goVersion := strings.TrimPrefix(tags[len(tags)-1], "go")
+
+	src := filepath.Join(directory, "src")
+	modules := []string{}
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == src {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if !info.IsDir() || path == src {
+			return nil
+		}
+		if !containsGoFiles(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		modules = append(modules, filepath.ToSlash(rel))
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "module %s\n\ngo %s\n", filepath.Base(directory), goVersion)
+	for _, module := range modules {
+		fmt.Fprintf(&b, "\nrequire %s v0.0.0\n", module)
+		fmt.Fprintf(&b, "\nreplace %s => ./src/%s\n", module, module)
+		modFile := filepath.Join(src, filepath.FromSlash(module), GO_DOT_MOD)
+		contents := fmt.Sprintf("module %s\n\ngo %s\n", module, goVersion)
+		if err := ioutil.WriteFile(modFile, []byte(contents), 0644); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(directory, GO_DOT_MOD), []byte(b.String()), 0644)
+}
+
+// containsGoFiles returns true if the given directory contains .go files.
+func containsGoFiles(directory string) bool {
+	files, _ := ioutil.ReadDir(directory)
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".go") {
+			return true
+		}
+	}
+	return false
 }
 
 func exists(filename string, t *testing.T) bool {
@@ -313,31 +495,49 @@ func getGoVersion() (major, minor int, err error) {
 	return
 }
 
-func findExpectedOutput(filename string, t *testing.T) (string, error) {
+// findExpectedOutput returns the name of the file containing the output
+// expected for the given file with the current Go version: the
+// filename.go1.N.ext file with the largest N not exceeding the current minor
+// version, or defaultFilename if there is none.
+func findExpectedOutput(filename, ext, defaultFilename string, t *testing.T) (string, error) {
 	_, minor, err := getGoVersion()
 	if err != nil {
 		return "", err
 	}
 	for i := minor; i >= 1; i-- {
-		debugOutputFilename := fmt.Sprintf("%s.go1.%d.debugOutput", filename, i)
-		if exists(debugOutputFilename, t) {
-			return debugOutputFilename, nil
+		expectedFilename := fmt.Sprintf("%s.go1.%d.%s", filename, i, ext)
+		if exists(expectedFilename, t) {
+			return expectedFilename, nil
 		}
 	}
-	return filename + ".debugOutput", nil
+	return defaultFilename, nil
 }
 
-func sanitize(debugOutput string, replaceCwd bool) string {
-	cwd, _ := os.Getwd()
+// sanitize normalizes line endings in debug output and, if root is not empty,
+// replaces occurrences of root (and of the current directory) with ".".
+// Paths relative to the current directory are made relative to root.
+func sanitize(debugOutput string, root string) string {
 	debugOutput = strings.Replace(debugOutput, "\r\n", "\n", -1)
-	if replaceCwd {
+	if root != "" {
+		cwd, _ := os.Getwd()
+		if rel, err := filepath.Rel(cwd, root); err == nil && rel != "." {
+			debugOutput = strings.Replace(debugOutput,
+				rel+string(filepath.Separator), "", -1)
+		}
+		debugOutput = strings.Replace(debugOutput, root, ".", -1)
 		debugOutput = strings.Replace(debugOutput, cwd, ".", -1)
 	}
 	return debugOutput
 }
 
 func checkResult(filename string, actualOutput string, t *testing.T) {
-	bytes, err := ioutil.ReadFile(filename + "lden")
+	goldenFilename, err := findExpectedOutput(filename, "golden",
+		filename+"lden", t)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	bytes, err := ioutil.ReadFile(goldenFilename)
 	if err != nil {
 		t.Error(err)
 		return
@@ -351,7 +551,7 @@ func checkResult(filename string, actualOutput string, t *testing.T) {
 		actualOutput = strings.Replace(actualOutput, "\n\n\n", "\n\n", -1)
 	}
 	if expectedOutput != actualOutput {
-		fmt.Printf(">>>>> Output does not match %slden\n", filename)
+		fmt.Printf(">>>>> Output does not match %s\n", goldenFilename)
 		showExpectedAndActual(expectedOutput, actualOutput)
 		t.Errorf("Refactoring test failed - %s", filename)
 	}
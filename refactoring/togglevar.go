@@ -37,6 +37,7 @@ func (r *ToggleVar) Description() *Description {
 		Params:         nil,
 		OptionalParams: nil,
 		Hidden:         false,
+		Quality:        Production,
 	}
 }
 
@@ -79,11 +80,15 @@ func (r *ToggleVar) Run(config *Config) *Result {
 }
 
 func (r *ToggleVar) short2var(assign *ast.AssignStmt) {
-	replacement := r.varDeclString(assign)
-	r.Edits[r.Filename].Add(r.Extent(assign), replacement)
-	if strings.Contains(replacement, "\n") {
-		r.FormatFileInEditor()
+	// Each declaration after the first is indented like the assignment
+	pos := r.Program.Fset.Position(assign.Pos())
+	indent := string(r.FileContents[pos.Offset-(pos.Column-1) : pos.Offset])
+	if strings.TrimSpace(indent) != "" {
+		indent = ""
 	}
+	replacement := strings.Replace(r.varDeclString(assign), "\n", "\n"+indent, -1)
+	r.Edits[r.Filename].Add(r.Extent(assign), replacement)
+	r.noDefaultPostProcessing = true
 }
 
 func (r *ToggleVar) rhsExprs(assign *ast.AssignStmt) []string {
@@ -176,6 +181,7 @@ func (r *ToggleVar) var2short(decl *ast.GenDecl) {
 	start, _ := r.OffsetLength(decl)
 	repstrlen := r.Program.Fset.Position(decl.Specs[0].(*ast.ValueSpec).Values[0].Pos()).Offset - r.Program.Fset.Position(decl.Pos()).Offset
 	r.Edits[r.Filename].Add(&text.Extent{Offset: start, Length: repstrlen}, r.shortAssignString(decl))
+	r.noDefaultPostProcessing = true
 }
 
 func (r *ToggleVar) varDeclLHS(decl *ast.GenDecl) string {
@@ -6,6 +6,8 @@
 // subsequence/shortest edit script (LCS/SES) algorithm described in
 // Eugene W. Myers, "An O(ND) Difference Algorithm and Its Variations"
 //
+// (The patience and histogram diff algorithms are in diffalgo.go.)
+//
 // It also contains support for creating unified diffs (i.e., patch files).
 // The unified diff format is documented in the POSIX standard (IEEE 1003.1),
 // "diff - compare two files", section: "Diff -u or -U Output Format"
@@ -165,8 +167,9 @@ const numCtxLines int = 3
 // EditSet by invoking the CreatePatch method.  To get the contents of the
 // unified diff, invoke the Write method.
 type Patch struct {
-	filename string
-	hunks    []*hunk
+	filename  string
+	hunks     []*hunk
+	algorithm DiffAlgorithm
 }
 
 // IsEmpty returns true iff this patch contains no hunks
@@ -174,6 +177,15 @@ func (p *Patch) IsEmpty() bool {
 	return len(p.hunks) == 0
 }
 
+// SetDiffAlgorithm sets the algorithm used to determine which lines in each
+// hunk are added and removed when this patch is written (and counted by
+// Stats).  The default is DiffMyers.  The algorithm does not affect the
+// boundaries of hunks, which are determined by the edits in the EditSet from
+// which the patch was created.
+func (p *Patch) SetDiffAlgorithm(algo DiffAlgorithm) {
+	p.algorithm = algo
+}
+
 // add appends a hunk to this patch.  It is the caller's responsibility to
 // ensure that hunks are added in the correct order.
 func (p *Patch) add(hunk *hunk) {
@@ -193,7 +205,7 @@ func (p *Patch) Write(origFile, newFile string, origTime, newTime time.Time, out
 			newFile, newTime.Format(layout))
 		lineOffset := 0
 		for _, hunk := range p.hunks {
-			adjust, err := writeDiffHunk(hunk, lineOffset, out)
+			adjust, err := writeDiffHunk(hunk, p.algorithm, lineOffset, out)
 			if err != nil {
 				return err
 			}
@@ -203,12 +215,34 @@ func (p *Patch) Write(origFile, newFile string, origTime, newTime time.Time, out
 	return nil
 }
 
-// writeDiffHunk writes a single hunk in unified diff format.  If the
+// Stats returns the number of lines that will be added and removed by this
+// patch, i.e., the number of lines that will be prefixed by + and - in the
+// unified diff output by Write.
+func (p *Patch) Stats() (added, removed int, err error) {
+	for _, h := range p.hunks {
+		origLines, newLines, err := computeLines(h)
+		if err != nil {
+			return 0, 0, err
+		}
+		p.algorithm.Diff(origLines, newLines).Iterate(func(extent *Extent, replacement string) bool {
+			if extent.Length > 0 {
+				removed++
+			} else if replacement != "" {
+				added++
+			}
+			return true
+		})
+	}
+	return added, removed, nil
+}
+
+// writeDiffHunk writes a single hunk in unified diff format, using the given
+// algorithm to determine which lines were added and removed.  If the
 // edits in that hunk add lines, it returns the number of lines added; if the
 // edits delete lines, it returns a negative number indicating the number of
 // lines deleted (0 - number of lines deleted).  If the edits in the hunk do
 // not change the number of lines, returns 0.
-func writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
+func writeDiffHunk(h *hunk, algo DiffAlgorithm, outputLineOffset int, out io.Writer) (int, error) {
 	// Determine the lines in this hunk before and after applying edits
 	origLines, newLines, err := computeLines(h)
 	if err != nil {
@@ -218,14 +252,22 @@ func writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
 	// Write the unified diff header
 	numOrigLines := lenWithoutLastIfEmpty(origLines)
 	numNewLines := lenWithoutLastIfEmpty(newLines)
+	// An empty range is identified by the line preceding it (e.g., a hunk
+	// creating a file is described as -0,0 rather than -1,0)
+	origStart, newStart := h.startLine, h.startLine+outputLineOffset
+	if numOrigLines == 0 {
+		origStart--
+	}
+	if numNewLines == 0 {
+		newStart--
+	}
 	if _, err = fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n",
-		h.startLine, numOrigLines,
-		h.startLine+outputLineOffset, numNewLines); err != nil {
+		origStart, numOrigLines, newStart, numNewLines); err != nil {
 		return 0, err
 	}
 
 	// Create an iterator that will traverse deletions and additions
-	it := Diff(origLines, newLines).newEditIter()
+	it := algo.Diff(origLines, newLines).newEditIter()
 
 	// For each line in the original file, add one or more lines to the
 	// unified diff output
@@ -234,7 +276,7 @@ func writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
 		if it.edit() == nil || it.edit().Offset > offset {
 			// This line was not affected by any edits
 			if i < len(origLines)-1 || line != "" {
-				fmt.Fprintf(out, " %s", origLines[i])
+				writeDiffLine(out, " ", origLines[i])
 			}
 		} else {
 			// This line was deleted (and possibly replaced by a
@@ -246,34 +288,43 @@ func writeDiffHunk(h *hunk, outputLineOffset int, out io.Writer) (int, error) {
 				edit := it.edit()
 				if edit.Length > 0 {
 					// Delete line
-					line := origLines[i]
-					fmt.Fprintf(out, "-%s", line)
-					if !strings.HasSuffix(line, "\n") {
-						fmt.Fprintf(out, "\n\\ No newline at end of file\n")
-					}
+					writeDiffLine(out, "-", origLines[i])
 					deleted = true
 				} else if edit.replacement != "" {
 					// Insert line
-					repl := edit.replacement
-					fmt.Fprintf(out, "+%s", repl)
-					if !strings.HasSuffix(repl, "\n") {
-						fmt.Fprintf(out, "\n\\ No newline at end of file\n")
-					}
-
+					writeDiffLine(out, "+", edit.replacement)
 				}
 				it.moveToNextEdit()
 			}
 			if !deleted {
 				if i < len(origLines)-1 || line != "" {
-					fmt.Fprintf(out, " %s", origLines[i])
+					writeDiffLine(out, " ", origLines[i])
 				}
 			}
 		}
 		offset += len(line)
 	}
+	// Lines may be inserted after the last line of the hunk if its
+	// trailing context lines were removed (see computeLines)
+	for ; it.edit() != nil; it.moveToNextEdit() {
+		if it.edit().replacement != "" {
+			writeDiffLine(out, "+", it.edit().replacement)
+		}
+	}
 	return numNewLines - numOrigLines, nil
 }
 
+// writeDiffLine writes a single line of a hunk, preceded by the given prefix
+// (" ", "-", or "+").  A line without a trailing newline (i.e., the last line
+// of a file) is followed by "\ No newline at end of file", so that the diff
+// output continues on the next line.
+func writeDiffLine(out io.Writer, prefix, line string) {
+	fmt.Fprintf(out, "%s%s", prefix, line)
+	if !strings.HasSuffix(line, "\n") {
+		fmt.Fprintf(out, "\n\\ No newline at end of file\n")
+	}
+}
+
 // If the last string in the slice is the empty string, returns len(ss)-1;
 // otherwise, returns len(ss).
 func lenWithoutLastIfEmpty(ss []string) int {
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -148,6 +149,29 @@ func TestCreatePatch(t *testing.T) {
 	assertTrue(len(p.hunks[1].edits) == 1, t)
 }
 
+func TestPatchStats(t *testing.T) {
+	a := "Line1\nLine2\nLine3\nLine4\n"
+	b := "Line1\nLine2a\nLine2b\nLine3\n"
+	edits := Diff(strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n"))
+	p, err := edits.CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, removed, err := p.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTrue(added == 2, t)
+	assertTrue(removed == 2, t)
+
+	p, err = NewEditSet().CreatePatch(strings.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, removed, err = p.Stats()
+	assertTrue(added == 0 && removed == 0 && err == nil, t)
+}
+
 func TestUnifiedDiff(t *testing.T) {
 	testDirs, err := ioutil.ReadDir(diffTestDir)
 	if err != nil {
@@ -160,7 +184,18 @@ func TestUnifiedDiff(t *testing.T) {
 			from := readFile(filepath.Join(dir, "from.txt"), t)
 			to := readFile(filepath.Join(dir, "to.txt"), t)
 			diff := readFile(filepath.Join(dir, "diff.txt"), t)
-			testUnifiedDiff(from, to, diff, testDirInfo.Name(), t)
+			testUnifiedDiff(from, to, diff, DiffMyers,
+				testDirInfo.Name(), t)
+			// diff-patience.txt, etc. give the expected output
+			// for the other algorithms, if it differs
+			for _, algo := range []DiffAlgorithm{DiffPatience, DiffHistogram} {
+				filename := filepath.Join(dir, "diff-"+algo.String()+".txt")
+				if _, err := os.Stat(filename); err == nil {
+					diff = readFile(filename, t)
+				}
+				testUnifiedDiff(from, to, diff, algo,
+					testDirInfo.Name(), t)
+			}
 		}
 	}
 }
@@ -173,20 +208,21 @@ func readFile(path string, t *testing.T) string {
 	return string(bytes)
 }
 
-func testUnifiedDiff(a, b, expected, name string, t *testing.T) {
-	edits := Diff(strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n"))
+func testUnifiedDiff(a, b, expected string, algo DiffAlgorithm, name string, t *testing.T) {
+	edits := algo.Diff(strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n"))
 	s, _ := ApplyToString(edits, a)
 	assertEquals(b, s, t)
 
 	patch, _ := edits.CreatePatch(strings.NewReader(a))
+	patch.SetDiffAlgorithm(algo)
 	var result bytes.Buffer
 	patch.Write("filename", "filename", time.Time{}, time.Time{}, &result)
 	diff := strings.Replace(result.String(), "\r\n", "\n", -1)
 	expected = strings.Replace(expected, "\r\n", "\n", -1)
 
 	if diff != expected {
-		t.Fatalf("Diff test %s failed.  Expected:\n[%s]\nActual:\n[%s]\n",
-			name, expected, diff)
+		t.Fatalf("Diff test %s (%s) failed.  Expected:\n[%s]\nActual:\n[%s]\n",
+			name, algo, expected, diff)
 	}
 }
 
@@ -198,11 +234,13 @@ func TestRandomDiffs(t *testing.T) {
 		s1s := strings.Join(s1, "")
 		s2 := makeLines(100, r)
 		s2s := strings.Join(s2, "")
-		edits := Diff(s1, s2)
-		result, err := ApplyToString(edits, s1s)
-		if err != nil || result != s2s {
-			t.Errorf("Random diff failed - seed %d, iteration %d",
-				seed, i)
+		for algo := range diffAlgorithmNames {
+			edits := DiffAlgorithm(algo).Diff(s1, s2)
+			result, err := ApplyToString(edits, s1s)
+			if err != nil || result != s2s {
+				t.Errorf("Random %s diff failed - seed %d, "+
+					"iteration %d", DiffAlgorithm(algo), seed, i)
+			}
 		}
 	}
 }
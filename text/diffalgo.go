@@ -0,0 +1,364 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains implementations of the patience and histogram diff
+// algorithms, which can be used instead of Myers' algorithm (see diff.go) to
+// compute the lines added and removed in each hunk of a unified diff.
+//
+// Myers' algorithm produces a diff with the minimum number of added and
+// removed lines, but when a region of a file has been heavily edited, that
+// diff often matches lines that are common but unrelated (blank lines,
+// closing braces), interleaving the old and new code.  Patience diff (as
+// described by Bram Cohen) instead matches lines that occur exactly once in
+// both texts, then diffs the regions between those lines recursively.
+// Histogram diff (as implemented in JGit and git) is a variation that matches
+// the least frequently occurring lines, so it also works well when few lines
+// are unique.  Both fall back to Myers' algorithm when they cannot choose
+// lines to match.
+
+package text
+
+import "sort"
+
+// A DiffAlgorithm determines how the lines of two texts are matched when
+// computing a diff.  Every algorithm produces a correct diff; they differ in
+// which lines are considered unchanged, and hence in how readable the diff is.
+type DiffAlgorithm int
+
+const (
+	// Myers' algorithm, which minimizes the number of added and removed
+	// lines (see Diff)
+	DiffMyers DiffAlgorithm = iota
+	// Patience diff, which first matches lines that are unique in both
+	// texts
+	DiffPatience
+	// Histogram diff, which first matches the lines that occur least
+	// frequently
+	DiffHistogram
+)
+
+// diffAlgorithmNames are the names returned by DiffAlgorithm.String, which are
+// also accepted by ParseDiffAlgorithm
+var diffAlgorithmNames = []string{
+	"myers",
+	"patience",
+	"histogram",
+}
+
+// String returns the name of the diff algorithm (e.g., "patience").
+func (algo DiffAlgorithm) String() string {
+	if algo < 0 || int(algo) >= len(diffAlgorithmNames) {
+		return "unknown"
+	}
+	return diffAlgorithmNames[algo]
+}
+
+// ParseDiffAlgorithm returns the DiffAlgorithm with the given name (as
+// returned by DiffAlgorithm.String).  The second result is false if there is
+// no such algorithm.
+func ParseDiffAlgorithm(name string) (DiffAlgorithm, bool) {
+	for i, n := range diffAlgorithmNames {
+		if n == name {
+			return DiffAlgorithm(i), true
+		}
+	}
+	return 0, false
+}
+
+// Diff creates an EditSet that changes a into b, using this algorithm to
+// determine which lines are unchanged.  The resulting EditSet has the same
+// form as one returned by the Diff function (which implements DiffMyers).
+func (algo DiffAlgorithm) Diff(a []string, b []string) *EditSet {
+	switch algo {
+	case DiffPatience:
+		return editsFromMatches(a, b,
+			matchLines(a, b, 0, len(a), 0, len(b), patienceAnchors, nil))
+	case DiffHistogram:
+		return editsFromMatches(a, b,
+			matchLines(a, b, 0, len(a), 0, len(b), histogramAnchors, nil))
+	default:
+		return Diff(a, b)
+	}
+}
+
+// A lineMatch pairs a line of one text, a[a], with an identical line of
+// another text, b[b], indicating that the line is unchanged.
+type lineMatch struct {
+	a, b int
+}
+
+// An anchorFunc chooses lines of a[aLo:aHi] and b[bLo:bHi] that should be
+// matched, returning the matches in increasing order.  The regions between
+// them are then diffed recursively.  It returns nil if Myers' algorithm
+// should be used to diff the regions instead.
+type anchorFunc func(a, b []string, aLo, aHi, bLo, bHi int) []lineMatch
+
+// matchLines appends to matches the lines of a[aLo:aHi] and b[bLo:bHi] that
+// are unchanged, in increasing order, using the given function to choose the
+// lines to match first.
+func matchLines(a, b []string, aLo, aHi, bLo, bHi int, anchors anchorFunc, matches []lineMatch) []lineMatch {
+	// Identical lines at the beginning and end are always matched
+	for aLo < aHi && bLo < bHi && a[aLo] == b[bLo] {
+		matches = append(matches, lineMatch{aLo, bLo})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix &&
+		a[aHi-suffix-1] == b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	if aLo < aHi && bLo < bHi {
+		found := anchors(a, b, aLo, aHi, bLo, bHi)
+		if found == nil {
+			matches = myersMatches(a, b, aLo, aHi, bLo, bHi, matches)
+		} else if len(found) > 0 {
+			for _, m := range found {
+				matches = matchLines(a, b, aLo, m.a, bLo, m.b,
+					anchors, matches)
+				matches = append(matches, m)
+				aLo, bLo = m.a+1, m.b+1
+			}
+			matches = matchLines(a, b, aLo, aHi, bLo, bHi,
+				anchors, matches)
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		matches = append(matches, lineMatch{aHi + i, bHi + i})
+	}
+	return matches
+}
+
+// patienceAnchors matches the lines that occur exactly once in both a[aLo:aHi]
+// and b[bLo:bHi].  If the matched lines do not appear in the same order in
+// both texts, it returns the longest sequence of matches that do.  It returns
+// nil if there are no such lines.
+func patienceAnchors(a, b []string, aLo, aHi, bLo, bHi int) []lineMatch {
+	type count struct {
+		a, b   int // Number of occurrences in a and b
+		bIndex int // Index of the (last) occurrence in b
+	}
+	counts := map[string]*count{}
+	for j := bLo; j < bHi; j++ {
+		c := counts[b[j]]
+		if c == nil {
+			c = &count{}
+			counts[b[j]] = c
+		}
+		c.b++
+		c.bIndex = j
+	}
+	for i := aLo; i < aHi; i++ {
+		if c := counts[a[i]]; c != nil {
+			c.a++
+		}
+	}
+
+	unique := []lineMatch{}
+	for i := aLo; i < aHi; i++ {
+		if c := counts[a[i]]; c != nil && c.a == 1 && c.b == 1 {
+			unique = append(unique, lineMatch{i, c.bIndex})
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	return longestIncreasing(unique)
+}
+
+// longestIncreasing receives matches sorted by their indices in a and returns
+// the longest subsequence whose indices in b are also increasing.  It uses
+// patience sorting, from which patience diff gets its name.  (When there are
+// several such subsequences, it chooses the same one as git.)
+func longestIncreasing(matches []lineMatch) []lineMatch {
+	// tails[k] is the index (in matches) of the match ending the
+	// increasing subsequence of length k+1 with the smallest index in b;
+	// prev links each match to its predecessor in such a subsequence
+	tails := []int{}
+	prev := make([]int, len(matches))
+	for i, m := range matches {
+		k := sort.Search(len(tails), func(k int) bool {
+			return matches[tails[k]].b > m.b
+		})
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	result := make([]lineMatch, len(tails))
+	for k, i := len(tails)-1, tails[len(tails)-1]; k >= 0; k, i = k-1, prev[i] {
+		result[k] = matches[i]
+	}
+	return result
+}
+
+// maxHistogramOccurrences is the maximum number of times a line can occur in
+// a region before histogram diff falls back to Myers' algorithm
+const maxHistogramOccurrences = 64
+
+// histogramAnchors finds the longest run of identical lines in a[aLo:aHi] and
+// b[bLo:bHi] that contains a line occurring as few times in a[aLo:aHi] as
+// possible, returning the matches in that run.  It returns an empty slice if
+// the regions have no lines in common, and nil if every common line occurs
+// more than maxHistogramOccurrences times.
+func histogramAnchors(a, b []string, aLo, aHi, bLo, bHi int) []lineMatch {
+	occurrences := map[string][]int{}
+	for i := aLo; i < aHi; i++ {
+		occurrences[a[i]] = append(occurrences[a[i]], i)
+	}
+
+	common := false
+	bestCount := maxHistogramOccurrences + 1
+	bestStart, bestLen := lineMatch{}, 0
+	for j := bLo; j < bHi; j++ {
+		indices := occurrences[b[j]]
+		if len(indices) == 0 {
+			continue
+		}
+		common = true
+		if len(indices) > bestCount {
+			continue
+		}
+		for _, i := range indices {
+			// Extend the match in both directions, finding the
+			// fewest occurrences of any line in the run
+			count := len(indices)
+			before, after := 0, 1
+			for i-before > aLo && j-before > bLo &&
+				a[i-before-1] == b[j-before-1] {
+				before++
+				count = min(count, len(occurrences[a[i-before]]))
+			}
+			for i+after < aHi && j+after < bHi &&
+				a[i+after] == b[j+after] {
+				count = min(count, len(occurrences[a[i+after]]))
+				after++
+			}
+			if count < bestCount ||
+				count == bestCount && before+after > bestLen {
+				bestCount = count
+				bestStart = lineMatch{i - before, j - before}
+				bestLen = before + after
+			}
+		}
+	}
+
+	if !common {
+		return []lineMatch{}
+	} else if bestLen == 0 {
+		return nil
+	}
+	result := make([]lineMatch, bestLen)
+	for k := range result {
+		result[k] = lineMatch{bestStart.a + k, bestStart.b + k}
+	}
+	return result
+}
+
+// myersMatches appends to matches the lines of a[aLo:aHi] and b[bLo:bHi] that
+// are unchanged in the diff computed by Myers' algorithm.
+func myersMatches(a, b []string, aLo, aHi, bLo, bHi int, matches []lineMatch) []lineMatch {
+	it := Diff(a[aLo:aHi], b[bLo:bHi]).newEditIter()
+	offset, j := 0, bLo
+	for i := aLo; i < aHi; i++ {
+		// Skip lines inserted before this line, then determine whether
+		// it was deleted
+		for it.edit() != nil && it.edit().Offset == offset &&
+			it.edit().Length == 0 {
+			j++
+			it.moveToNextEdit()
+		}
+		if it.edit() != nil && it.edit().Offset == offset &&
+			it.edit().Length > 0 {
+			it.moveToNextEdit()
+		} else if j < bHi && a[i] == b[j] {
+			matches = append(matches, lineMatch{i, j})
+			j++
+		}
+		offset += len(a[i])
+	}
+	return matches
+}
+
+// editsFromMatches creates an EditSet that changes a into b, deleting every
+// line of a and inserting every line of b that is not in the given matches.
+// The edits have the same form as those created by Diff: each deletes a
+// single line or inserts a single line, and lines replacing deleted lines are
+// inserted after them.
+func editsFromMatches(a, b []string, matches []lineMatch) *EditSet {
+	deleted := make([]bool, len(a))
+	inserted := make([]bool, len(b))
+	for i := range deleted {
+		deleted[i] = true
+	}
+	for j := range inserted {
+		inserted[j] = true
+	}
+	for _, m := range matches {
+		deleted[m.a], inserted[m.b] = false, false
+	}
+	slideChanges(a, deleted)
+	slideChanges(b, inserted)
+
+	// Edits are appended directly, since Add would insert each edit
+	// before previous edits at the same offset
+	result := NewEditSet()
+	offset := 0
+	for i, j := 0, 0; i < len(a) || j < len(b); i, j = i+1, j+1 {
+		for ; i < len(a) && deleted[i]; i++ {
+			if a[i] != "" {
+				result.edits = append(result.edits, edit{
+					&Extent{offset, len(a[i])}, ""})
+			}
+			offset += len(a[i])
+		}
+		for ; j < len(b) && inserted[j]; j++ {
+			if b[j] != "" {
+				result.edits = append(result.edits, edit{
+					&Extent{offset, 0}, b[j]})
+			}
+		}
+		if i < len(a) {
+			offset += len(a[i])
+		}
+	}
+	return result
+}
+
+// slideChanges moves each run of changed (i.e., deleted or inserted) lines
+// down as far as possible, so that when the first changed line is identical to
+// the unchanged line following the run, the former is marked unchanged and the
+// latter is marked changed instead.  The resulting diff is equivalent, but
+// this tends to keep blocks of code together; for example, the closing brace
+// at the end of an inserted function is shown as inserted, rather than the
+// closing brace of the preceding function.  GNU diff and git do the same.
+func slideChanges(lines []string, changed []bool) {
+	for i := 0; i < len(lines); {
+		if !changed[i] {
+			i++
+			continue
+		}
+		start := i
+		for i < len(lines) && changed[i] {
+			i++
+		}
+		for i < len(lines) && lines[start] == lines[i] {
+			changed[start], changed[i] = false, true
+			start++
+			for i < len(lines) && changed[i] {
+				i++
+			}
+		}
+	}
+}
@@ -10,6 +10,9 @@ package text
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -95,8 +98,13 @@ func Sort(extents []*Extent) []*Extent {
 // Edits are added to an EditSet via the Add method, and the edits in an
 // EditSet can be applied to an input by invoking the ApplyTo method or
 // one of the utility functions ApplyToString, ApplyToFile, or ApplyToReader.
+//
+// An EditSet may optionally record a hash of the text it is intended to be
+// applied to (see SetBase).  If it does, ApplyTo and CreatePatch verify that
+// their input matches that text, returning a *StaleError if it does not.
 type EditSet struct {
-	edits []edit // edits are sorted by offset and are non-overlapping
+	edits    []edit // edits are sorted by offset and are non-overlapping
+	baseHash string // hex-encoded SHA-256 hash of the original text, or ""
 }
 
 type edit struct {
@@ -202,6 +210,11 @@ func (e *EditSet) OldOffset(offset int) int {
 	return offset - adjust
 }
 
+// Len returns the number of edits in this EditSet.
+func (e *EditSet) Len() int {
+	return len(e.edits)
+}
+
 // SizeChange returns the total number of bytes that will be added or removed
 // when this EditSet is applied.  A positive value indicates that bytes will be
 // added; negative, bytes will be removed.  A zero value indicates that the
@@ -235,11 +248,116 @@ func (e *EditSet) String() string {
 	return buffer.String()
 }
 
+// jsonEdit is the JSON representation of a single edit in an EditSet.
+type jsonEdit struct {
+	Offset      int    `json:"offset"`
+	Length      int    `json:"length"`
+	Replacement string `json:"replacement"`
+}
+
+// MarshalJSON encodes this EditSet as a JSON array of objects with offset,
+// length, and replacement keys, ordered by offset.
+func (e *EditSet) MarshalJSON() ([]byte, error) {
+	edits := make([]jsonEdit, 0, len(e.edits))
+	for _, edit := range e.edits {
+		edits = append(edits, jsonEdit{
+			Offset:      edit.Offset,
+			Length:      edit.Length,
+			Replacement: edit.replacement,
+		})
+	}
+	return json.Marshal(edits)
+}
+
+// UnmarshalJSON decodes an EditSet encoded by MarshalJSON, returning an error
+// if any of the edits are invalid or overlap.
+func (e *EditSet) UnmarshalJSON(data []byte) error {
+	var edits []jsonEdit
+	if err := json.Unmarshal(data, &edits); err != nil {
+		return err
+	}
+	e.edits = []edit{}
+	for _, edit := range edits {
+		if edit.Length < 0 {
+			return fmt.Errorf("Edit at offset %d has negative length",
+				edit.Offset)
+		}
+		extent := &Extent{Offset: edit.Offset, Length: edit.Length}
+		if err := e.Add(extent, edit.Replacement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetBase records a hash of the text to which this EditSet is intended to be
+// applied, typically the contents of a file at the time it was analyzed.
+func (e *EditSet) SetBase(contents []byte) {
+	e.baseHash = hashOf(contents)
+}
+
+// SetBaseHash is equivalent to SetBase, but it receives a hex-encoded SHA-256
+// hash (as returned by BaseHash) rather than the text itself.
+func (e *EditSet) SetBaseHash(hash string) {
+	e.baseHash = hash
+}
+
+// BaseHash returns the hex-encoded SHA-256 hash of the text recorded by
+// SetBase, or "" if no text has been recorded.
+func (e *EditSet) BaseHash() string {
+	return e.baseHash
+}
+
+// A StaleError indicates that an EditSet could not be applied because its
+// input differs from the text recorded by SetBase, i.e., the file has
+// changed since it was analyzed.
+type StaleError struct {
+	// The file that changed, or "" if unknown
+	Filename string
+	// Hex-encoded SHA-256 hashes of the recorded text and the actual input
+	Expected, Actual string
+}
+
+func (e *StaleError) Error() string {
+	if e.Filename == "" {
+		return "The text has changed since it was analyzed"
+	}
+	return fmt.Sprintf("%s has changed since it was analyzed", e.Filename)
+}
+
+// checkBase returns a reader equivalent to the given reader, or a *StaleError
+// if this EditSet has recorded a base hash that does not match the reader's
+// contents.
+func (e *EditSet) checkBase(in io.Reader) (io.Reader, error) {
+	if e.baseHash == "" {
+		return in, nil
+	}
+	contents, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	if hash := hashOf(contents); hash != e.baseHash {
+		return nil, &StaleError{Expected: e.baseHash, Actual: hash}
+	}
+	return bytes.NewReader(contents), nil
+}
+
+func hashOf(contents []byte) string {
+	hash := sha256.Sum256(contents)
+	return hex.EncodeToString(hash[:])
+}
+
 // ApplyTo reads from the given reader, applying the edits in this EditSet as
 // it reads, and writes the output to the given writer.  It returns an error if
 // there are edits with offsets beyond the end of the input or some other error
-// occurs, such as an I/O error.
+// occurs, such as an I/O error.  If a base has been recorded (see SetBase)
+// and the input does not match it, a *StaleError is returned, and nothing is
+// written.
 func (e *EditSet) ApplyTo(in io.Reader, out io.Writer) error {
+	in, err := e.checkBase(in)
+	if err != nil {
+		return err
+	}
 	bufin := bufio.NewReader(in)
 	bufout := bufio.NewWriter(out)
 	return e.applyTo(bufin, bufout)
@@ -293,8 +411,13 @@ func (e *EditSet) applyTo(in *bufio.Reader, out *bufio.Writer) error {
 }
 
 // CreatePatch creates a Patch from this EditSet.  A Patch can be output as a
-// unified diff by invoking the Patch's Write method.
+// unified diff by invoking the Patch's Write method.  As with ApplyTo, a
+// *StaleError is returned if the input does not match a recorded base.
 func (e *EditSet) CreatePatch(in io.Reader) (result *Patch, err error) {
+	in, err = e.checkBase(in)
+	if err != nil {
+		return nil, err
+	}
 	return createPatch(e, in)
 }
 
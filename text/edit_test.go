@@ -4,7 +4,11 @@
 
 package text
 
-import "testing"
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
 
 // -=-= Extent =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-
 
@@ -224,3 +228,49 @@ func TestEditApply(t *testing.T) {
 	es.Add(&Extent{0, 0}, "")
 	assertEquals("", applyToString(es, ""), t)
 }
+
+func TestEditSetJSON(t *testing.T) {
+	es := NewEditSet()
+	es.Add(&Extent{5, 2}, "\"x\"\n")
+	es.Add(&Extent{0, 0}, "AAA")
+	data, err := json.Marshal(es)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(`[{"offset":0,"length":0,"replacement":"AAA"},`+
+		`{"offset":5,"length":2,"replacement":"\"x\"\n"}]`, string(data), t)
+
+	decoded := NewEditSet()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(es.String(), decoded.String(), t)
+
+	err = json.Unmarshal([]byte(`[{"offset":0,"length":3},{"offset":1}]`), decoded)
+	assertTrue(err != nil, t)
+}
+
+func TestEditSetBase(t *testing.T) {
+	es := NewEditSet()
+	es.Add(&Extent{1, 1}, "X")
+	assertEquals("", es.BaseHash(), t)
+	es.SetBase([]byte("abc"))
+	assertEquals("aXc", applyToString(es, "abc"), t)
+	if _, err := es.CreatePatch(strings.NewReader("abc")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ApplyToString(es, "abd")
+	if stale, ok := err.(*StaleError); !ok || stale.Expected != es.BaseHash() {
+		t.Fatalf("Expected StaleError, got %v", err)
+	}
+	_, err = es.CreatePatch(strings.NewReader("abd"))
+	if _, ok := err.(*StaleError); !ok {
+		t.Fatalf("Expected StaleError, got %v", err)
+	}
+
+	copied := NewEditSet()
+	copied.SetBaseHash(es.BaseHash())
+	_, err = ApplyToString(copied, "abd")
+	assertTrue(err != nil, t)
+}
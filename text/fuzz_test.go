@@ -0,0 +1,287 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+// This file contains fuzz targets for the EditSet and diff code.  They check
+// that applying an EditSet, and applying the unified diff created from it,
+// produce the same text.  With no flags, "go test" runs them on the seed
+// inputs below; to fuzz, run (e.g.)
+//     go test -run=NONE -fuzz=FuzzEditSet ./text
+
+package text
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fuzzTexts are seed inputs for the fuzz targets, chosen to exercise lines
+// without trailing newlines, empty lines, and carriage returns.
+var fuzzTexts = []string{
+	"",
+	"\n",
+	"a",
+	"a\n",
+	"a\nb",
+	"a\nb\n",
+	"\n\n\n",
+	"Line1\nLine2\nLine3\nLine4\nLine5\nLine6\nLine7\nLine8\nLine9\n",
+	"Line1\nLine2\nLine3\nLine4\nLine5\nLine6\nLine7\nLine8\nLine9",
+	"a\r\nb\r\nc",
+}
+
+// FuzzDiff checks that the EditSet computed by each DiffAlgorithm transforms
+// one text into another, and that the unified diff created from it (and
+// written using the same algorithm) does the same.
+func FuzzDiff(f *testing.F) {
+	for _, a := range fuzzTexts {
+		for _, b := range fuzzTexts {
+			f.Add(a, b)
+		}
+	}
+	f.Fuzz(func(t *testing.T, a, b string) {
+		for algo := range diffAlgorithmNames {
+			algo := DiffAlgorithm(algo)
+			es := algo.Diff(strings.SplitAfter(a, "\n"),
+				strings.SplitAfter(b, "\n"))
+			result, err := ApplyToString(es, a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != b {
+				t.Fatalf("Applying %s diff of %q and %q produced %q",
+					algo, a, b, result)
+			}
+			checkPatch(t, es, algo, a, b)
+		}
+	})
+}
+
+// FuzzEditSet builds an EditSet from a sequence of bytes (see fuzzEdits) and
+// checks that applying it, and applying the unified diff created from it,
+// produce the same text as applying the edits independently.
+func FuzzEditSet(f *testing.F) {
+	for _, s := range fuzzTexts {
+		f.Add(s, []byte{})
+		f.Add(s, []byte{0, 0, 1})
+		f.Add(s, []byte{0, 255, 0})
+		f.Add(s, []byte{1, 1, 2, 255, 0, 3})
+		f.Add(s, []byte{3, 2, 4, 9, 9, 5, 30, 4, 2})
+	}
+	f.Fuzz(func(t *testing.T, s string, ops []byte) {
+		es, expected := fuzzEdits(s, ops)
+		result, err := ApplyToString(es, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != expected {
+			t.Fatalf("Applying %s to %q produced %q; expected %q",
+				es, s, result, expected)
+		}
+		if got := int64(len(result) - len(s)); es.SizeChange() != got {
+			t.Fatalf("SizeChange of %s is %d; expected %d",
+				es, es.SizeChange(), got)
+		}
+		for algo := range diffAlgorithmNames {
+			checkPatch(t, es, DiffAlgorithm(algo), s, expected)
+		}
+	})
+}
+
+// fuzzReplacements are the replacement strings used by fuzzEdits.
+var fuzzReplacements = []string{"", "x", "\n", "xy\n", "\nx", "x\ny\nz\n", "\r\n"}
+
+// fuzzEdits interprets each triple of bytes in ops as an edit to s (an offset,
+// a length, and an index into fuzzReplacements), returning an EditSet
+// containing the edits and the result of applying them to s.  Edits that
+// overlap or start at the same offset as a previous edit are skipped.
+func fuzzEdits(s string, ops []byte) (*EditSet, string) {
+	es := NewEditSet()
+	type fuzzEdit struct {
+		offset, length int
+		replacement    string
+	}
+	added := []fuzzEdit{}
+	for i := 0; i+3 <= len(ops); i += 3 {
+		offset := int(ops[i]) % (len(s) + 1)
+		length := int(ops[i+1]) % (len(s) - offset + 1)
+		replacement := fuzzReplacements[int(ops[i+2])%len(fuzzReplacements)]
+		ok := true
+		for _, e := range added {
+			if offset == e.offset ||
+				offset < e.offset+e.length && e.offset < offset+length {
+				ok = false
+			}
+		}
+		if ok && es.Add(&Extent{offset, length}, replacement) == nil {
+			added = append(added, fuzzEdit{offset, length, replacement})
+		}
+	}
+
+	sort.Slice(added, func(i, j int) bool {
+		return added[i].offset < added[j].offset
+	})
+	var result strings.Builder
+	prev := 0
+	for _, e := range added {
+		result.WriteString(s[prev:e.offset])
+		result.WriteString(e.replacement)
+		prev = e.offset + e.length
+	}
+	result.WriteString(s[prev:])
+	return es, result.String()
+}
+
+// checkPatch creates a unified diff from the given EditSet, using the given
+// algorithm, checking that applying it to orig produces expected and that its
+// Stats match the lines it adds and removes.
+func checkPatch(t *testing.T, es *EditSet, algo DiffAlgorithm, orig, expected string) {
+	patch, err := es.CreatePatch(strings.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch.SetDiffAlgorithm(algo)
+	var buf bytes.Buffer
+	if err := patch.Write("a", "b", time.Time{}, time.Time{}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	diff := buf.String()
+	result, err := applyUnifiedDiff(orig, diff)
+	if err != nil {
+		t.Fatalf("Invalid %s diff for %s applied to %q: %s\n%s", algo,
+			es, orig, err, diff)
+	}
+	if result != expected {
+		t.Fatalf("Applying the diff for %s to %q produced %q; "+
+			"expected %q\n%s", es, orig, result, expected, diff)
+	}
+
+	added, removed, err := patch.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plus, minus := 0, 0
+	for i, line := range strings.SplitAfter(diff, "\n") {
+		if i >= 2 && strings.HasPrefix(line, "+") {
+			plus++
+		} else if i >= 2 && strings.HasPrefix(line, "-") {
+			minus++
+		}
+	}
+	if added != plus || removed != minus {
+		t.Fatalf("Stats for %s applied to %q are +%d -%d; the diff "+
+			"has +%d -%d\n%s", es, orig, added, removed, plus, minus,
+			diff)
+	}
+}
+
+// noNewline is the line that follows a line without a trailing newline in a
+// unified diff.
+const noNewline = "\\ No newline at end of file\n"
+
+// applyUnifiedDiff applies a unified diff for a single file (as output by
+// Patch.Write) to the given text.  It is deliberately strict, as GNU patch
+// is: it returns an error if a hunk header does not match the lines in the
+// hunk, if the context and removed lines do not match the text, or if a line
+// of the diff does not end with a newline (a line of the text without a
+// trailing newline must be followed by "\ No newline at end of file").
+func applyUnifiedDiff(orig, diff string) (string, error) {
+	if diff == "" {
+		return orig, nil
+	}
+	if !strings.HasSuffix(diff, "\n") {
+		return "", fmt.Errorf("the diff does not end with a newline")
+	}
+	origLines := strings.SplitAfter(orig, "\n")
+	if origLines[len(origLines)-1] == "" {
+		origLines = origLines[:len(origLines)-1]
+	}
+	lines := strings.SplitAfter(diff, "\n")
+	lines = lines[:len(lines)-1]
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "--- ") ||
+		!strings.HasPrefix(lines[1], "+++ ") {
+		return "", fmt.Errorf("the diff does not begin with --- and +++")
+	}
+
+	result := []string{}
+	next := 0 // Index of the next line of orig to be copied
+	for i := 2; i < len(lines); {
+		var origStart, origLen, newStart, newLen int
+		header := strings.TrimSuffix(lines[i], "\n")
+		_, err := fmt.Sscanf(header, "@@ -%d,%d +%d,%d @@",
+			&origStart, &origLen, &newStart, &newLen)
+		if err != nil || header != fmt.Sprintf("@@ -%d,%d +%d,%d @@",
+			origStart, origLen, newStart, newLen) {
+			return "", fmt.Errorf("invalid hunk header %q", header)
+		}
+		i++
+
+		// An empty range is identified by the line preceding it
+		start := origStart - 1
+		if origLen == 0 {
+			start++
+		}
+		if start < next || start > len(origLines) {
+			return "", fmt.Errorf("hunk %q is out of order or "+
+				"out of range", header)
+		}
+		result = append(result, origLines[next:start]...)
+		next = start
+		if newLen > 0 && newStart != len(result)+1 ||
+			newLen == 0 && newStart != len(result) {
+			return "", fmt.Errorf("hunk %q should start at line "+
+				"%d of the new text", header, len(result)+1)
+		}
+
+		origCount, newCount := 0, 0
+		for i < len(lines) && !strings.HasPrefix(lines[i], "@@") {
+			line := lines[i]
+			i++
+			text := line[1:]
+			if i < len(lines) && lines[i] == noNewline {
+				text = strings.TrimSuffix(text, "\n")
+				i++
+			}
+			switch line[0] {
+			case ' ', '-':
+				if next >= len(origLines) || origLines[next] != text {
+					return "", fmt.Errorf("line %q of hunk %q "+
+						"does not match line %d of the text",
+						line, header, next+1)
+				}
+				next++
+				origCount++
+				if line[0] == ' ' {
+					result = append(result, text)
+					newCount++
+				}
+			case '+':
+				result = append(result, text)
+				newCount++
+			default:
+				return "", fmt.Errorf("invalid line %q in hunk %q",
+					line, header)
+			}
+		}
+		if origCount != origLen || newCount != newLen {
+			return "", fmt.Errorf("hunk %q has %d original and %d "+
+				"new lines", header, origCount, newCount)
+		}
+	}
+	result = append(result, origLines[next:]...)
+
+	for i, line := range result {
+		if i < len(result)-1 && !strings.HasSuffix(line, "\n") {
+			return "", fmt.Errorf("line %d of the result, %q, does "+
+				"not end with a newline", i+1, line)
+		}
+	}
+	return strings.Join(result, ""), nil
+}
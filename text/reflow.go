@@ -0,0 +1,198 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file defines ReflowComment, which rewraps a block of line comments
+// (e.g., a doc comment) so that its lines fit within a given column.
+// Refactorings that change the text of a comment use it so that the edited
+// comment remains tidy.
+
+package text
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultCommentColumn is the column at which comments are wrapped if no
+// column is given to ReflowComment.
+const DefaultCommentColumn = 80
+
+// tabWidth is the number of columns a tab is assumed to occupy when
+// determining the width of an indented comment.
+const tabWidth = 8
+
+// listMarker matches the beginning of a list item in a comment (e.g., "- ",
+// "* ", "1. ", or "2) "), including any indentation before the marker.
+var listMarker = regexp.MustCompile(`^[ \t]*([-*+•]|[0-9]+[.)])[ \t]+`)
+
+// ReflowComment rewraps a block of line comments so that, where possible, no
+// line extends past the given column (if column ≤ 0, DefaultCommentColumn is
+// used).  The comment is given as it appears in the source code, from the
+// first "//" to the end of the last comment; each line after the first may
+// be preceded by whitespace.  The indent is the whitespace preceding the
+// first line, which is used to indent each subsequent line of the result.
+// The result replaces the given comment, so its first line is not indented.
+//
+// Paragraphs are separated by blank comment lines and are filled as in a
+// text editor.  List items (lines beginning with a marker like "-" or "1.")
+// are filled separately, with continuation lines aligned to the text
+// following the marker.  Other indented lines (e.g., code examples) and
+// directives (e.g., //go:generate) are left unchanged, as are block
+// comments.  A word that is too long to fit on a line is not broken.  If the
+// comment uses two spaces between sentences, sentences joined from different
+// lines are also separated by two spaces.
+func ReflowComment(comment, indent string, column int) string {
+	if column <= 0 {
+		column = DefaultCommentColumn
+	}
+	lines := strings.Split(strings.TrimRight(comment, "\r\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(strings.TrimLeft(line, " \t"), "\r")
+		if !strings.HasPrefix(lines[i], "//") {
+			return comment
+		}
+	}
+
+	f := &commentFiller{
+		width:       column - Width(indent),
+		twoSpaces:   strings.Contains(comment, ".  "),
+		currentHang: -1,
+	}
+	for _, line := range lines {
+		f.addLine(strings.TrimPrefix(line, "//"))
+	}
+	f.flush()
+	return strings.Join(f.result, "\n"+indent)
+}
+
+// A commentFiller accumulates the words of the paragraph or list item being
+// filled (see ReflowComment).
+type commentFiller struct {
+	// The number of columns available, excluding indentation
+	width int
+	// Whether two spaces separate sentences
+	twoSpaces bool
+	// The reflowed lines (without indentation)
+	result []string
+	// The prefix of the first line of the paragraph or list item being
+	// filled (e.g., "// " or "//   - "), and the prefix of its remaining
+	// lines
+	firstPrefix, restPrefix string
+	// The words of the paragraph or list item being filled, each followed
+	// by the space that separated it from the next word
+	words, spaces []string
+	// The width of restPrefix (after "//") if a list item is being
+	// filled, or -1 if not
+	currentHang int
+}
+
+// addLine adds a line of the comment, given the text following "//".
+func (f *commentFiller) addLine(body string) {
+	switch {
+	case strings.TrimSpace(body) == "":
+		f.flush()
+		f.result = append(f.result, "//")
+	case body[0] != ' ' && body[0] != '\t':
+		// A directive (e.g., //go:generate) or commented-out code
+		f.flush()
+		f.result = append(f.result, "//"+body)
+	default:
+		text := body
+		if text[0] == ' ' {
+			text = text[1:]
+		}
+		if m := listMarker.FindString(text); m != "" {
+			f.flush()
+			marker := strings.TrimRight(m, " \t") + " "
+			f.firstPrefix = "// " + marker
+			f.restPrefix = "// " + strings.Repeat(" ", Width(marker))
+			f.currentHang = Width(marker)
+			f.addWords(text[len(m):])
+		} else if text[0] == ' ' || text[0] == '\t' {
+			lead := text[:len(text)-len(strings.TrimLeft(text, " \t"))]
+			if f.currentHang > 0 && Width(lead) >= f.currentHang {
+				// A continuation line of a list item
+				f.addWords(text)
+				return
+			}
+			// A code block, which is left unchanged
+			f.flush()
+			f.result = append(f.result, "//"+body)
+		} else {
+			if f.currentHang >= 0 {
+				f.flush()
+			}
+			if len(f.words) == 0 {
+				f.firstPrefix, f.restPrefix = "// ", "// "
+				f.currentHang = -1
+			}
+			f.addWords(text)
+		}
+	}
+}
+
+// addWords adds the words in the given line of text to the paragraph or list
+// item being filled, preserving the spacing between words.
+func (f *commentFiller) addWords(text string) {
+	text = strings.TrimSpace(text)
+	if len(f.words) > 0 {
+		// Join this line to the previous one
+		f.spaces[len(f.spaces)-1] = " "
+		if f.twoSpaces && endsSentence(f.words[len(f.words)-1]) {
+			f.spaces[len(f.spaces)-1] = "  "
+		}
+	}
+	for text != "" {
+		end := strings.IndexAny(text, " \t")
+		if end < 0 {
+			f.words = append(f.words, text)
+			f.spaces = append(f.spaces, "")
+			return
+		}
+		word := text[:end]
+		text = text[end:]
+		rest := strings.TrimLeft(text, " \t")
+		f.words = append(f.words, word)
+		f.spaces = append(f.spaces, text[:len(text)-len(rest)])
+		text = rest
+	}
+}
+
+// flush fills the paragraph or list item being filled, adding its lines to
+// the result.
+func (f *commentFiller) flush() {
+	if len(f.words) > 0 {
+		prefix := f.firstPrefix
+		line := prefix + f.words[0]
+		for i := 1; i < len(f.words); i++ {
+			next := line + f.spaces[i-1] + f.words[i]
+			if Width(next) > f.width {
+				f.result = append(f.result, line)
+				prefix = f.restPrefix
+				line = prefix + f.words[i]
+			} else {
+				line = next
+			}
+		}
+		f.result = append(f.result, line)
+	}
+	f.words, f.spaces = nil, nil
+	f.currentHang = -1
+}
+
+// endsSentence returns true if the given word appears to end a sentence.
+func endsSentence(word string) bool {
+	word = strings.TrimRight(word, `)"'`)
+	return strings.HasSuffix(word, ".") || strings.HasSuffix(word, "?") ||
+		strings.HasSuffix(word, "!")
+}
+
+// Width returns the number of columns the given text (e.g., a line of a
+// comment, including its indentation) occupies, assuming each tab occupies
+// eight columns.
+func Width(text string) int {
+	return utf8.RuneCountInString(text) +
+		strings.Count(text, "\t")*(tabWidth-1)
+}
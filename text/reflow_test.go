@@ -0,0 +1,55 @@
+// Copyright 2015-2018 Auburn University and others. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package text_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/godoctor/godoctor/text"
+)
+
+func TestReflowComment(t *testing.T) {
+	tests := []struct {
+		comment, indent string
+		column          int
+		expected        string
+	}{
+		// Short lines are joined; long lines are split
+		{"// one two\n// three four five six", "", 20,
+			"// one two three\n// four five six"},
+		// Subsequent lines are indented (tabs occupy 8 columns)
+		{"// one two three four", "\t", 24,
+			"// one two three\n\t// four"},
+		// The default column is 80
+		{"// " + strings.Repeat("word ", 20), "", 0,
+			"// " + strings.Repeat("word ", 14) + "word\n// word word word word word"},
+		// Paragraphs, code blocks, and directives are preserved
+		{"// a b c\n//\n//\tcode(x, y)\n//     more(code)\n// d e\n//go:generate x", "", 10,
+			"// a b c\n//\n//\tcode(x, y)\n//     more(code)\n// d e\n//go:generate x"},
+		// List items are filled separately, with hanging indents
+		{"// Items:\n//   - first item\n//     continues\n//   - second item here\n// after", "", 20,
+			"// Items:\n//   - first item\n//     continues\n//   - second item\n//     here\n// after"},
+		{"//  1. one two three four\n//  2. five", "", 17,
+			"//  1. one two\n//     three four\n//  2. five"},
+		// Two spaces between sentences are preserved
+		{"// First one.  Second\n// one.\n// Third.", "", 80,
+			"// First one.  Second one.  Third."},
+		{"// First one.\n// Second.", "", 80,
+			"// First one. Second."},
+		// Long words are not broken
+		{"// a http://example.com/very/long/url b", "", 10,
+			"// a\n// http://example.com/very/long/url\n// b"},
+		// Block comments are not changed
+		{"/* a b c d */", "", 5, "/* a b c d */"},
+	}
+	for _, test := range tests {
+		actual := text.ReflowComment(test.comment, test.indent, test.column)
+		if actual != test.expected {
+			t.Errorf("Reflowing %q to column %d:\nExpected:\n%s\nActual:\n%s",
+				test.comment, test.column, test.expected, actual)
+		}
+	}
+}
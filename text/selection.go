@@ -53,7 +53,7 @@ type LineColSelection struct {
 // returns an error if this selection corresponds to a file that is not in the
 // given FileSet, or if the selected region is not in range.
 func (lc *LineColSelection) Convert(fset *token.FileSet) (token.Pos, token.Pos, error) {
-	file := findFile(fset, lc.Filename)
+	file := FindFile(fset, lc.Filename)
 	if file == nil {
 		return 0, 0, fmt.Errorf(fileNotFoundFmt, lc.Filename)
 	}
@@ -115,7 +115,7 @@ type OffsetLengthSelection struct {
 // returns an error if this selection corresponds to a file that is not in the
 // given FileSet, or if the selected region is not in range.
 func (ol *OffsetLengthSelection) Convert(fset *token.FileSet) (token.Pos, token.Pos, error) {
-	file := findFile(fset, ol.Filename)
+	file := FindFile(fset, ol.Filename)
 	if file == nil {
 		return 0, 0, fmt.Errorf(fileNotFoundFmt, ol.Filename)
 	}
@@ -145,10 +145,10 @@ func (ol *OffsetLengthSelection) String() string {
 		ol.Offset, ol.Length)
 }
 
-// findFile returns the file corresponding to the given filename, or nil if no
+// FindFile returns the file corresponding to the given filename, or nil if no
 // file can be found with that filename.  The absolute path of the returned
 // file can be found via f.Name().
-func findFile(fset *token.FileSet, filename string) *token.File {
+func FindFile(fset *token.FileSet, filename string) *token.File {
 	// from findQueryPos in go.tools/oracle/pos.go
 	var file *token.File
 	fset.Iterate(func(f *token.File) bool {
@@ -232,9 +232,11 @@ func lineColToPos(file *token.File, line int, column int) (token.Pos, error) {
 	return pos, nil
 }
 
-// NewSelection takes an input string of the form "line,col:line,col" or
-// "offset,length" and returns a Selection (either LineColSelection or
-// OffsetLengthSelection) corresponding to that selection in the given file.
+// NewSelection takes an input string of the form "line,col:line,col",
+// "offset,length", or "offset+length" and returns a Selection (either
+// LineColSelection or OffsetLengthSelection) corresponding to that selection
+// in the given file.  The "offset+length" form is equivalent to
+// "offset,length"; it is provided for tools that report byte ranges.
 func NewSelection(filename string, pos string) (Selection, error) {
 	if ok, _ := regexp.MatchString("^\\d+,\\d+:\\d+,\\d+$", pos); ok {
 		args := strings.Split(pos, ":")
@@ -249,8 +251,8 @@ func NewSelection(filename string, pos string) (Selection, error) {
 			StartCol:  sc,
 			EndLine:   el,
 			EndCol:    ec}, nil
-	} else if ok, _ := regexp.MatchString("^\\d+,\\d+$", pos); ok {
-		offset, length := parseLineCol(pos)
+	} else if ok, _ := regexp.MatchString("^\\d+[,+]\\d+$", pos); ok {
+		offset, length := parseLineCol(strings.Replace(pos, "+", ",", 1))
 		if offset < 0 || length < 0 {
 			return nil, fmt.Errorf("Invalid offset/length")
 		}
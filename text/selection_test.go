@@ -208,6 +208,18 @@ func TestNewSelection(t *testing.T) {
 		t.Fatalf("Wrong offset/length")
 	}
 
+	olsel, err = text.NewSelection("main.go", "1200+45")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ol, ok = olsel.(*text.OffsetLengthSelection)
+	if !ok {
+		t.Fatalf("Unexpected type %s", reflect.TypeOf(ol))
+	}
+	if ol.Offset != 1200 || ol.Length != 45 {
+		t.Fatalf("Wrong offset+length")
+	}
+
 	lcsel, err := text.NewSelection("main.go", "1,2:3,4")
 	if err != nil {
 		t.Fatal(err)
@@ -229,6 +241,12 @@ func TestNewSelectionErrors(t *testing.T) {
 		"3,",
 		",3",
 		"1,2,3",
+		"3+",
+		"+3",
+		"1+2+3",
+		"1,2+3",
+		"1+2:3,4",
+		"-3+16",
 		"1,2:3,4:5,6",
 		"1:3,4",
 		"1,2:3",
@@ -239,6 +257,7 @@ func TestNewSelectionErrors(t *testing.T) {
 		"1,1:2,0",
 		"99999999999999999999,1",
 		"1,99999999999999999999",
+		"1+99999999999999999999",
 		"1,1:99999999999999999999,1",
 		"1,1:1,99999999999999999999",
 	}